@@ -161,6 +161,10 @@ func (h *AlwaysOnInboundHandler) Start() error {
 			return err
 		}
 	}
+	// Proxies with listeners of their own run them with the handler.
+	if p, ok := h.proxy.(common.Runnable); ok {
+		return p.Start()
+	}
 	return nil
 }
 
@@ -171,6 +175,9 @@ func (h *AlwaysOnInboundHandler) Close() error {
 		errs = append(errs, worker.Close())
 	}
 	errs = append(errs, h.mux.Close())
+	if p, ok := h.proxy.(common.Runnable); ok {
+		errs = append(errs, p.Close())
+	}
 	if err := errors.Combine(errs...); err != nil {
 		return errors.New("failed to close all resources").Base(err)
 	}
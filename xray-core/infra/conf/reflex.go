@@ -1,53 +1,536 @@
 package conf
 
 import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
 	"encoding/json"
+	"mime"
+	"os"
+	"strings"
 
 	"github.com/xtls/xray-core/common/errors"
 	"github.com/xtls/xray-core/common/uuid"
 	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	reflexin "github.com/xtls/xray-core/proxy/reflex/inbound"
+	"github.com/xtls/xray-core/transport/internet/tls"
+	"golang.org/x/net/http/httpguts"
 	"google.golang.org/protobuf/proto"
 )
 
+// ReflexFallbackConfig is a local fallback destination, optionally chosen
+// by the client's GeoIP.
+type ReflexFallbackConfig struct {
+	Dest uint32                     `json:"dest"`
+	Geo  []*ReflexGeoFallbackConfig `json:"geo"`
+	// Prefetch lists decoy paths to serve from memory, refreshed every
+	// PrefetchRefresh seconds and fetched with PrefetchHost as Host.
+	Prefetch        []string `json:"prefetch"`
+	PrefetchRefresh uint32   `json:"prefetchRefresh"`
+	PrefetchHost    string   `json:"prefetchHost"`
+	// ErrorPages maps error statuses to decoy paths answering with them.
+	ErrorPages map[uint32]string `json:"errorPages"`
+}
+
+// ReflexGeoFallbackConfig is the fallback for clients matching IP, given as
+// in routing rules, e.g. "geoip:ir" or a CIDR.
+type ReflexGeoFallbackConfig struct {
+	IP   StringList `json:"ip"`
+	Dest uint32     `json:"dest"`
+}
+
+// Build builds the fallback, loading its GeoIP lists.
+func (c *ReflexFallbackConfig) Build() (*reflex.Fallback, error) {
+	fallback := &reflex.Fallback{
+		Dest:            c.Dest,
+		Prefetch:        c.Prefetch,
+		PrefetchRefresh: c.PrefetchRefresh,
+		PrefetchHost:    c.PrefetchHost,
+		ErrorPages:      c.ErrorPages,
+	}
+	if c.Dest > 65535 {
+		return nil, errors.New("Reflex fallback: dest ", c.Dest, " is not a port")
+	}
+	for _, path := range c.Prefetch {
+		if !strings.HasPrefix(path, "/") {
+			return nil, errors.New("Reflex fallback: prefetch paths must start with /: ", path)
+		}
+	}
+	for status, path := range c.ErrorPages {
+		if status < 400 || status > 599 {
+			return nil, errors.New("Reflex fallback: errorPages status ", status, " is not an error")
+		}
+		if !strings.HasPrefix(path, "/") {
+			return nil, errors.New("Reflex fallback: errorPages paths must start with /: ", path)
+		}
+	}
+	for i, geo := range c.Geo {
+		if geo == nil || len(geo.IP) == 0 || geo.Dest == 0 {
+			return nil, errors.New("Reflex fallback: geo[", i, "] needs ip and dest")
+		}
+		if geo.Dest > 65535 {
+			return nil, errors.New("Reflex fallback: geo[", i, "].dest ", geo.Dest, " is not a port")
+		}
+		geoips, err := ToCidrList(geo.IP)
+		if err != nil {
+			return nil, errors.New("Reflex fallback: invalid geo ip").Base(err)
+		}
+		fallback.Geo = append(fallback.Geo, &reflex.GeoFallback{Geoip: geoips, Dest: geo.Dest})
+	}
+	return fallback, nil
+}
+
+// ReflexPuzzleConfig configures the handshake client puzzle.
+type ReflexPuzzleConfig struct {
+	Difficulty  uint32 `json:"difficulty"`
+	TriggerRate uint32 `json:"triggerRate"`
+}
+
+// ReflexRateLimitConfig is a session rate limit in bytes per second.
+type ReflexRateLimitConfig struct {
+	Uplink   uint64 `json:"uplink"`
+	Downlink uint64 `json:"downlink"`
+}
+
+// Build builds the rate limit; a nil config has none.
+func (c *ReflexRateLimitConfig) Build() *reflex.RateLimit {
+	if c == nil {
+		return nil
+	}
+	return &reflex.RateLimit{Uplink: c.Uplink, Downlink: c.Downlink}
+}
+
 // ReflexUserConfig is one inbound Reflex user entry.
 type ReflexUserConfig struct {
-	ID     string `json:"id"`
-	Policy string `json:"policy"`
+	// ID may be given as "env:NAME" or "file:PATH"; see resolveReflexSecret.
+	ID              string                 `json:"id"`
+	Email           string                 `json:"email"`
+	Level           uint32                 `json:"level"`
+	Policy          string                 `json:"policy"`
+	UplinkPolicy    string                 `json:"uplinkPolicy"`
+	DownlinkPolicy  string                 `json:"downlinkPolicy"`
+	AllowedPolicies []string               `json:"allowedPolicies"`
+	Fallback        *ReflexFallbackConfig  `json:"fallback"`
+	AllowedSources  []string               `json:"allowedSources"`
+	DeniedSources   []string               `json:"deniedSources"`
+	RateLimit       *ReflexRateLimitConfig `json:"rateLimit"`
+	// ExpiresAt is a Unix time.
+	ExpiresAt int64  `json:"expiresAt"`
+	Quota     uint64 `json:"quota"`
+}
+
+// ReflexSourceBanConfig configures temporary bans of sources that keep
+// failing handshakes.
+type ReflexSourceBanConfig struct {
+	MaxFailures uint32 `json:"maxFailures"`
+	Window      uint32 `json:"window"`
+	Duration    uint32 `json:"duration"`
+}
+
+// ReflexAuthBackendConfig configures the HTTP endpoint that looks up users
+// missing from clients.
+type ReflexAuthBackendConfig struct {
+	URL      string `json:"url"`
+	CacheTTL uint32 `json:"cacheTtl"`
+	Timeout  uint32 `json:"timeout"`
+}
+
+// ReflexTrafficAccountingConfig configures the file per-user traffic totals
+// are kept in.
+type ReflexTrafficAccountingConfig struct {
+	File          string `json:"file"`
+	FlushInterval uint32 `json:"flushInterval"`
+}
+
+// Build returns nil when c is nil.
+func (c *ReflexTrafficAccountingConfig) Build() (*reflex.TrafficAccounting, error) {
+	if c == nil {
+		return nil, nil
+	}
+	if c.File == "" {
+		return nil, errors.New("trafficAccounting needs a file")
+	}
+	return &reflex.TrafficAccounting{File: c.File, FlushInterval: c.FlushInterval}, nil
+}
+
+// ReflexUserStoreConfig is a named set of users that Reflex inbounds share
+// by naming it in their userStore.
+type ReflexUserStoreConfig struct {
+	Name              string                         `json:"name"`
+	Clients           []json.RawMessage              `json:"clients"`
+	TrafficAccounting *ReflexTrafficAccountingConfig `json:"trafficAccounting"`
+	MaxNonces         uint32                         `json:"maxNonces"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown fields.
+func (c *ReflexUserStoreConfig) UnmarshalJSON(data []byte) error {
+	type plain ReflexUserStoreConfig
+	return decodeReflexStrict(data, (*plain)(c))
+}
+
+// ReflexUserStoresConfig is the top-level "reflexUserStores" setting.
+type ReflexUserStoresConfig []*ReflexUserStoreConfig
+
+// Build implements Buildable.
+func (c ReflexUserStoresConfig) Build() (proto.Message, error) {
+	config := &reflex.UserStoreConfig{}
+	names := make(map[string]bool, len(c))
+	for _, s := range c {
+		if s.Name == "" {
+			return nil, errors.New("Reflex user store: name is not set")
+		}
+		if names[s.Name] {
+			return nil, errors.New("Reflex user store: duplicate name ", s.Name)
+		}
+		names[s.Name] = true
+		clients, err := buildReflexUsers(s.Clients)
+		if err != nil {
+			return nil, errors.New("Reflex user store ", s.Name).Base(err)
+		}
+		accounting, err := s.TrafficAccounting.Build()
+		if err != nil {
+			return nil, errors.New("Reflex user store ", s.Name).Base(err)
+		}
+		config.Stores = append(config.Stores, &reflex.UserStore{
+			Name:              s.Name,
+			Clients:           clients,
+			TrafficAccounting: accounting,
+			MaxNonces:         s.MaxNonces,
+		})
+	}
+	return config, nil
+}
+
+// buildReflexUsers parses the clients of an inbound or user store.
+func buildReflexUsers(rawUsers []json.RawMessage) ([]*reflex.User, error) {
+	users := make([]*reflex.User, 0, len(rawUsers))
+	for i, rawUser := range rawUsers {
+		user := new(ReflexUserConfig)
+		if err := decodeReflexStrict(rawUser, user); err != nil {
+			return nil, errors.New("clients[", i, "]: invalid Reflex user").Base(err)
+		}
+		id, err := resolveReflexSecret(user.ID)
+		if err != nil {
+			return nil, errors.New("clients[", i, "].id").Base(err)
+		}
+		u, err := uuid.ParseString(id)
+		if err != nil {
+			return nil, errors.New("clients[", i, "]: invalid id ", user.ID).Base(err)
+		}
+		if user.ExpiresAt < 0 {
+			return nil, errors.New("clients[", i, "]: expiresAt must be a Unix time")
+		}
+		account := &reflex.User{
+			Id:              u.String(),
+			Email:           user.Email,
+			Level:           user.Level,
+			Policy:          user.Policy,
+			UplinkPolicy:    user.UplinkPolicy,
+			DownlinkPolicy:  user.DownlinkPolicy,
+			AllowedPolicies: user.AllowedPolicies,
+			AllowedSources:  user.AllowedSources,
+			DeniedSources:   user.DeniedSources,
+			RateLimit:       user.RateLimit.Build(),
+			ExpiresAt:       user.ExpiresAt,
+			Quota:           user.Quota,
+		}
+		if user.Fallback != nil {
+			if account.Fallback, err = user.Fallback.Build(); err != nil {
+				return nil, errors.New("clients[", i, "].fallback").Base(err)
+			}
+		}
+		users = append(users, account)
+	}
+	return users, nil
+}
+
+// resolveReflexSecret returns value, or for "env:NAME" the environment
+// variable NAME and for "file:PATH" the contents of PATH without surrounding
+// whitespace, so credentials can stay out of shipped config files.
+func resolveReflexSecret(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "env:"):
+		name := strings.TrimPrefix(value, "env:")
+		secret := os.Getenv(name)
+		if secret == "" {
+			return "", errors.New("environment variable ", name, " is not set")
+		}
+		return secret, nil
+	case strings.HasPrefix(value, "file:"):
+		data, err := os.ReadFile(strings.TrimPrefix(value, "file:"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(data)), nil
+	}
+	return value, nil
+}
+
+// decodeReflexStrict decodes data into v, failing on fields v doesn't have
+// so that a misspelt option is reported instead of silently not applying.
+func decodeReflexStrict(data []byte, v interface{}) error {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
 }
 
 // ReflexInboundConfig is the JSON inbound settings for protocol=reflex.
 type ReflexInboundConfig struct {
-	Clients  []json.RawMessage `json:"clients"`
-	Fallback *struct {
-		Dest uint32 `json:"dest"`
-	} `json:"fallback"`
+	Clients        []json.RawMessage        `json:"clients"`
+	Fallback       *ReflexFallbackConfig    `json:"fallback"`
+	CoverTraffic   bool                     `json:"coverTraffic"`
+	Puzzle         *ReflexPuzzleConfig      `json:"puzzle"`
+	ProfileDir     string                   `json:"profileDir"`
+	CoalesceWrites bool                     `json:"coalesceWrites"`
+	WebSocketPath  string                   `json:"websocketPath"`
+	GRPCService    string                   `json:"grpcService"`
+	GRPCMethod     string                   `json:"grpcMethod"`
+	QUICListen     string                   `json:"quicListen"`
+	QUICCertFile   string                   `json:"quicCertificateFile"`
+	QUICKeyFile    string                   `json:"quicKeyFile"`
+	HTTPHosts      []string                 `json:"httpHosts"`
+	HTTPPaths      []string                 `json:"httpPaths"`
+	HTTPHeaders    map[string]string        `json:"httpHeaders"`
+	MaxFrameSize   uint32                   `json:"maxFrameSize"`
+	HighWatermark  uint32                   `json:"highWatermark"`
+	LowWatermark   uint32                   `json:"lowWatermark"`
+	LogVerbosity   uint32                   `json:"logVerbosity"`
+	LogUsers       []string                 `json:"logUsers"`
+	AuditLog       string                   `json:"auditLog"`
+	AuditAccessLog bool                     `json:"auditAccessLog"`
+	SourceBan      *ReflexSourceBanConfig   `json:"sourceBan"`
+	AuthBackend    *ReflexAuthBackendConfig `json:"authBackend"`
+	// PolicyRateLimits maps policy names to their session rate limits.
+	PolicyRateLimits  map[string]*ReflexRateLimitConfig `json:"policyRateLimits"`
+	TrafficAccounting *ReflexTrafficAccountingConfig    `json:"trafficAccounting"`
+	HandshakeBinding  string                            `json:"handshakeBinding"`
+	// UserStore names the ReflexUserStoreConfig to take users from.
+	UserStore           string   `json:"userStore"`
+	HTTPRequiredHeaders []string `json:"httpRequiredHeaders"`
+	HTTPContentType     string   `json:"httpContentType"`
+	// HandshakeResponseFloor is in milliseconds.
+	HandshakeResponseFloor uint32 `json:"handshakeResponseFloor"`
+	MaxNonces              uint32 `json:"maxNonces"`
+	EntropyMonitor         bool   `json:"entropyMonitor"`
+	// Unmatched is "close", "reset" or "tarpit".
+	Unmatched   string `json:"unmatched"`
+	MaxSessions uint32 `json:"maxSessions"`
+	// DrainTimeout is in seconds.
+	DrainTimeout        uint32            `json:"drainTimeout"`
+	HTTPServer          string            `json:"httpServer"`
+	HTTPResponseHeaders map[string]string `json:"httpResponseHeaders"`
+	// IdentityKey is the base64 Ed25519 seed from "xray reflex gen
+	// -identity", or an env: or file: reference to it.
+	IdentityKey string `json:"identityKey"`
+	// PSK is the base64 32-byte pre-shared key every client must share, or
+	// an env: or file: reference to it.
+	PSK string `json:"psk"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown fields.
+func (c *ReflexInboundConfig) UnmarshalJSON(data []byte) error {
+	type plain ReflexInboundConfig
+	return decodeReflexStrict(data, (*plain)(c))
 }
 
 // Build implements Buildable.
 func (c *ReflexInboundConfig) Build() (proto.Message, error) {
-	config := &reflex.InboundConfig{Clients: make([]*reflex.User, 0, len(c.Clients))}
-	for _, rawUser := range c.Clients {
-		user := new(ReflexUserConfig)
-		if err := json.Unmarshal(rawUser, user); err != nil {
-			return nil, errors.New("invalid Reflex user").Base(err)
+	config := &reflex.InboundConfig{
+		CoverTraffic:           c.CoverTraffic,
+		ProfileDir:             c.ProfileDir,
+		CoalesceWrites:         c.CoalesceWrites,
+		WebsocketPath:          c.WebSocketPath,
+		GrpcService:            c.GRPCService,
+		GrpcMethod:             c.GRPCMethod,
+		QuicListen:             c.QUICListen,
+		QuicCertificateFile:    c.QUICCertFile,
+		QuicKeyFile:            c.QUICKeyFile,
+		HttpHosts:              c.HTTPHosts,
+		HttpPaths:              c.HTTPPaths,
+		HttpHeaders:            c.HTTPHeaders,
+		MaxFrameSize:           c.MaxFrameSize,
+		HighWatermark:          c.HighWatermark,
+		LowWatermark:           c.LowWatermark,
+		LogVerbosity:           c.LogVerbosity,
+		LogUsers:               c.LogUsers,
+		AuditLog:               c.AuditLog,
+		AuditAccessLog:         c.AuditAccessLog,
+		HandshakeBinding:       c.HandshakeBinding,
+		UserStore:              c.UserStore,
+		HttpRequiredHeaders:    c.HTTPRequiredHeaders,
+		HttpContentType:        c.HTTPContentType,
+		HandshakeResponseFloor: c.HandshakeResponseFloor,
+		MaxNonces:              c.MaxNonces,
+		EntropyMonitor:         c.EntropyMonitor,
+		Unmatched:              c.Unmatched,
+		MaxSessions:            c.MaxSessions,
+		DrainTimeout:           c.DrainTimeout,
+		HttpServer:             c.HTTPServer,
+		HttpResponseHeaders:    c.HTTPResponseHeaders,
+	}
+	if !reflexin.KnownUnmatched(c.Unmatched) {
+		return nil, errors.New("Reflex inbound: unknown unmatched action ", c.Unmatched)
+	}
+	if !reflexin.KnownHTTPServer(c.HTTPServer) {
+		return nil, errors.New("Reflex inbound: unknown httpServer ", c.HTTPServer)
+	}
+	if c.IdentityKey != "" {
+		secret, err := resolveReflexSecret(c.IdentityKey)
+		if err != nil {
+			return nil, errors.New("Reflex inbound: identityKey").Base(err)
 		}
-		u, err := uuid.ParseString(user.ID)
+		if config.IdentityKey, err = decodeReflexKey(secret, ed25519.SeedSize); err != nil {
+			return nil, errors.New("Reflex inbound: identityKey").Base(err)
+		}
+	}
+	if c.PSK != "" {
+		secret, err := resolveReflexSecret(c.PSK)
 		if err != nil {
-			return nil, err
+			return nil, errors.New("Reflex inbound: psk").Base(err)
+		}
+		if config.Psk, err = decodeReflexKey(secret, encoding.PSKSize); err != nil {
+			return nil, errors.New("Reflex inbound: psk").Base(err)
+		}
+	}
+	if c.WebSocketPath != "" && !strings.HasPrefix(c.WebSocketPath, "/") {
+		return nil, errors.New("Reflex inbound: websocketPath must start with /")
+	}
+	for _, path := range c.HTTPPaths {
+		if !strings.HasPrefix(path, "/") {
+			return nil, errors.New("Reflex inbound: httpPaths must start with /")
+		}
+	}
+	for i, name := range c.HTTPRequiredHeaders {
+		if !httpguts.ValidHeaderFieldName(name) {
+			return nil, errors.New("Reflex inbound: httpRequiredHeaders[", i, "] is not a header name: ", name)
+		}
+	}
+	if c.HTTPContentType != "" {
+		if _, params, err := mime.ParseMediaType(c.HTTPContentType); err != nil || len(params) > 0 {
+			return nil, errors.New("Reflex inbound: httpContentType must be a bare media type such as application/json")
 		}
-		config.Clients = append(config.Clients, &reflex.User{Id: u.String(), Policy: user.Policy})
 	}
+	if !validReflexFrameSize(c.MaxFrameSize) {
+		return nil, errors.New("Reflex inbound: maxFrameSize must be 0 or between 128 and 65538")
+	}
+	if c.HighWatermark != 0 && c.LowWatermark > c.HighWatermark {
+		return nil, errors.New("Reflex inbound: lowWatermark must not exceed highWatermark")
+	}
+	if c.LogVerbosity > 2 {
+		return nil, errors.New("Reflex inbound: logVerbosity must be 0, 1 or 2")
+	}
+	if c.QUICListen != "" && (c.QUICCertFile == "" || c.QUICKeyFile == "") {
+		return nil, errors.New("Reflex inbound: quicListen needs quicCertificateFile and quicKeyFile")
+	}
+	clients, err := buildReflexUsers(c.Clients)
+	if err != nil {
+		return nil, errors.New("Reflex inbound").Base(err)
+	}
+	config.Clients = clients
 	if c.Fallback != nil {
-		config.Fallback = &reflex.Fallback{Dest: c.Fallback.Dest}
+		fallback, err := c.Fallback.Build()
+		if err != nil {
+			return nil, errors.New("Reflex inbound: fallback").Base(err)
+		}
+		config.Fallback = fallback
+	}
+	if c.Puzzle != nil {
+		if c.Puzzle.Difficulty > 32 {
+			return nil, errors.New("Reflex inbound: puzzle difficulty must not exceed 32")
+		}
+		config.Puzzle = &reflex.HandshakePuzzle{Difficulty: c.Puzzle.Difficulty, TriggerRate: c.Puzzle.TriggerRate}
+	}
+	if c.AuthBackend != nil {
+		if !strings.HasPrefix(c.AuthBackend.URL, "http://") && !strings.HasPrefix(c.AuthBackend.URL, "https://") {
+			return nil, errors.New("Reflex inbound: authBackend url must be http:// or https://")
+		}
+		config.AuthBackend = &reflex.AuthBackend{
+			Url:      c.AuthBackend.URL,
+			CacheTtl: c.AuthBackend.CacheTTL,
+			Timeout:  c.AuthBackend.Timeout,
+		}
+	}
+	if len(c.PolicyRateLimits) > 0 {
+		config.PolicyRateLimits = make(map[string]*reflex.RateLimit, len(c.PolicyRateLimits))
+		for name, limit := range c.PolicyRateLimits {
+			config.PolicyRateLimits[name] = limit.Build()
+		}
+	}
+	if config.TrafficAccounting, err = c.TrafficAccounting.Build(); err != nil {
+		return nil, errors.New("Reflex inbound").Base(err)
+	}
+	if c.UserStore != "" && (len(c.Clients) > 0 || c.TrafficAccounting != nil || c.MaxNonces != 0) {
+		return nil, errors.New("Reflex inbound: userStore excludes clients, trafficAccounting and maxNonces")
+	}
+	if c.SourceBan != nil {
+		config.SourceBan = &reflex.SourceBan{
+			MaxFailures: c.SourceBan.MaxFailures,
+			Window:      c.SourceBan.Window,
+			Duration:    c.SourceBan.Duration,
+		}
 	}
 	return config, nil
 }
 
 // ReflexOutboundConfig is the JSON outbound settings for protocol=reflex.
 type ReflexOutboundConfig struct {
-	Address *Address `json:"address"`
-	Port    uint16   `json:"port"`
-	ID      string   `json:"id"`
+	Address          *Address              `json:"address"`
+	Port             uint16                `json:"port"`
+	ID               string                `json:"id"`
+	UplinkPolicy     string                `json:"uplinkPolicy"`
+	DownlinkPolicy   string                `json:"downlinkPolicy"`
+	Features         []string              `json:"features"`
+	Padding          string                `json:"padding"`
+	PuzzleDifficulty uint32                `json:"puzzleDifficulty"`
+	CoalesceWrites   bool                  `json:"coalesceWrites"`
+	WebSocketPath    string                `json:"websocketPath"`
+	ChunkedPath      string                `json:"chunkedPath"`
+	Host             string                `json:"host"`
+	GRPCService      string                `json:"grpcService"`
+	GRPCMethod       string                `json:"grpcMethod"`
+	QUIC             bool                  `json:"quic"`
+	QUICInsecure     bool                  `json:"quicAllowInsecure"`
+	HTTPPath         string                `json:"httpPath"`
+	HTTPHeaders      map[string]string     `json:"httpHeaders"`
+	HTTPBrowser      string                `json:"httpBrowser"`
+	Fingerprint      string                `json:"fingerprint"`
+	PoolSize         uint32                `json:"poolSize"`
+	PoolMaxAge       uint32                `json:"poolMaxAge"`
+	PoolConcurrency  uint32                `json:"poolConcurrency"`
+	HappyEyeballs    bool                  `json:"happyEyeballs"`
+	MaxFrameSize     uint32                `json:"maxFrameSize"`
+	HighWatermark    uint32                `json:"highWatermark"`
+	LowWatermark     uint32                `json:"lowWatermark"`
+	PortRange        *PortRange            `json:"portRange"`
+	HopInterval      uint32                `json:"hopInterval"`
+	Fragment         *ReflexFragmentConfig `json:"fragment"`
+	HandshakeBinding string                `json:"handshakeBinding"`
+	// Policy is proposed for the directions uplinkPolicy and downlinkPolicy
+	// leave unset.
+	Policy             string `json:"policy"`
+	Level              uint32 `json:"level"`
+	MinProtocolVersion uint32 `json:"minProtocolVersion"`
+	// HTTPUpgrade asks for a 101 switch to this protocol after the httpPath
+	// handshake.
+	HTTPUpgrade string `json:"httpUpgrade"`
+	// ServerIdentity is the base64 public key of the server's identityKey.
+	ServerIdentity string `json:"serverIdentity"`
+	// PSK is the server's psk, or an env: or file: reference to it.
+	PSK string `json:"psk"`
+}
+
+// ReflexFragmentConfig splits the handshake like freedom's fragment: pieces
+// of length bytes with interval milliseconds between them.
+type ReflexFragmentConfig struct {
+	Length   *Int32Range `json:"length"`
+	Interval *Int32Range `json:"interval"`
+}
+
+// UnmarshalJSON implements json.Unmarshaler, rejecting unknown fields.
+func (c *ReflexOutboundConfig) UnmarshalJSON(data []byte) error {
+	type plain ReflexOutboundConfig
+	return decodeReflexStrict(data, (*plain)(c))
 }
 
 // Build implements Buildable.
@@ -55,12 +538,171 @@ func (c *ReflexOutboundConfig) Build() (proto.Message, error) {
 	if c.Address == nil {
 		return nil, errors.New("Reflex outbound: address is not set")
 	}
-	if c.Port == 0 {
+	if c.Port == 0 && c.PortRange == nil {
 		return nil, errors.New("Reflex outbound: port is not set")
 	}
-	u, err := uuid.ParseString(c.ID)
+	if c.HopInterval > 0 && (c.PortRange == nil || c.PoolSize == 0) {
+		return nil, errors.New("Reflex outbound: hopInterval needs portRange and poolSize")
+	}
+	id, err := resolveReflexSecret(c.ID)
 	if err != nil {
-		return nil, err
+		return nil, errors.New("Reflex outbound: id").Base(err)
+	}
+	u, err := uuid.ParseString(id)
+	if err != nil {
+		return nil, errors.New("Reflex outbound: invalid id ", c.ID).Base(err)
+	}
+	for _, feature := range c.Features {
+		if !encoding.KnownFeature(feature) {
+			return nil, errors.New("Reflex outbound: unknown feature ", feature, " in features")
+		}
+	}
+	switch c.Padding {
+	case "", "none", "profile", "max":
+	default:
+		return nil, errors.New("Reflex outbound: unknown padding level ", c.Padding)
 	}
-	return &reflex.OutboundConfig{Address: c.Address.String(), Port: uint32(c.Port), Id: u.String()}, nil
+	if c.PuzzleDifficulty > 32 {
+		return nil, errors.New("Reflex outbound: puzzle difficulty must not exceed 32")
+	}
+	if c.WebSocketPath != "" && !strings.HasPrefix(c.WebSocketPath, "/") {
+		return nil, errors.New("Reflex outbound: websocketPath must start with /")
+	}
+	if c.ChunkedPath != "" && !strings.HasPrefix(c.ChunkedPath, "/") {
+		return nil, errors.New("Reflex outbound: chunkedPath must start with /")
+	}
+	if c.HTTPPath != "" && !strings.HasPrefix(c.HTTPPath, "/") {
+		return nil, errors.New("Reflex outbound: httpPath must start with /")
+	}
+	if c.HTTPUpgrade != "" {
+		if c.HTTPPath == "" {
+			return nil, errors.New("Reflex outbound: httpUpgrade needs httpPath")
+		}
+		// protocol-name ["/" protocol-version], per RFC 9110 section 7.8.
+		name, version, versioned := strings.Cut(c.HTTPUpgrade, "/")
+		if !httpguts.ValidHeaderFieldName(name) || versioned && !httpguts.ValidHeaderFieldName(version) {
+			return nil, errors.New("Reflex outbound: httpUpgrade is not a valid protocol token: ", c.HTTPUpgrade)
+		}
+	}
+	fingerprint := strings.ToLower(c.Fingerprint)
+	if fingerprint != "" {
+		if tls.GetFingerprint(fingerprint) == nil {
+			return nil, errors.New(`Reflex outbound: unknown "fingerprint": `, c.Fingerprint)
+		}
+		if c.QUIC {
+			return nil, errors.New("Reflex outbound: fingerprint does not apply to quic")
+		}
+	}
+	if !validReflexFrameSize(c.MaxFrameSize) {
+		return nil, errors.New("Reflex outbound: maxFrameSize must be 0 or between 128 and 65538")
+	}
+	if c.HighWatermark != 0 && c.LowWatermark > c.HighWatermark {
+		return nil, errors.New("Reflex outbound: lowWatermark must not exceed highWatermark")
+	}
+	var serverIdentity []byte
+	if c.ServerIdentity != "" {
+		if serverIdentity, err = decodeReflexKey(c.ServerIdentity, ed25519.PublicKeySize); err != nil {
+			return nil, errors.New("Reflex outbound: serverIdentity").Base(err)
+		}
+	}
+	var psk []byte
+	if c.PSK != "" {
+		secret, err := resolveReflexSecret(c.PSK)
+		if err != nil {
+			return nil, errors.New("Reflex outbound: psk").Base(err)
+		}
+		if psk, err = decodeReflexKey(secret, encoding.PSKSize); err != nil {
+			return nil, errors.New("Reflex outbound: psk").Base(err)
+		}
+	}
+	switch c.HTTPBrowser {
+	case "", "chrome", "firefox":
+	default:
+		return nil, errors.New("Reflex outbound: unknown httpBrowser ", c.HTTPBrowser)
+	}
+	modes := 0
+	for _, set := range []bool{c.WebSocketPath != "", c.ChunkedPath != "", c.GRPCService != "", c.QUIC, c.HTTPPath != ""} {
+		if set {
+			modes++
+		}
+	}
+	if modes > 1 {
+		return nil, errors.New("Reflex outbound: websocketPath, chunkedPath, grpcService, quic and httpPath are mutually exclusive")
+	}
+	config := &reflex.OutboundConfig{
+		Address:            c.Address.String(),
+		Port:               uint32(c.Port),
+		Id:                 u.String(),
+		UplinkPolicy:       c.UplinkPolicy,
+		DownlinkPolicy:     c.DownlinkPolicy,
+		Features:           c.Features,
+		Padding:            c.Padding,
+		PuzzleDifficulty:   c.PuzzleDifficulty,
+		CoalesceWrites:     c.CoalesceWrites,
+		WebsocketPath:      c.WebSocketPath,
+		ChunkedPath:        c.ChunkedPath,
+		Host:               c.Host,
+		GrpcService:        c.GRPCService,
+		GrpcMethod:         c.GRPCMethod,
+		Quic:               c.QUIC,
+		QuicAllowInsecure:  c.QUICInsecure,
+		HttpPath:           c.HTTPPath,
+		HttpHeaders:        c.HTTPHeaders,
+		HttpBrowser:        c.HTTPBrowser,
+		HttpUpgrade:        c.HTTPUpgrade,
+		Fingerprint:        fingerprint,
+		HandshakeBinding:   c.HandshakeBinding,
+		Policy:             c.Policy,
+		Level:              c.Level,
+		MinProtocolVersion: c.MinProtocolVersion,
+		PoolSize:           c.PoolSize,
+		PoolMaxAge:         c.PoolMaxAge,
+		PoolConcurrency:    c.PoolConcurrency,
+		HappyEyeballs:      c.HappyEyeballs,
+		MaxFrameSize:       c.MaxFrameSize,
+		HighWatermark:      c.HighWatermark,
+		LowWatermark:       c.LowWatermark,
+		HopInterval:        c.HopInterval,
+		ServerIdentity:     serverIdentity,
+		Psk:                psk,
+	}
+	if c.PortRange != nil {
+		config.PortRange = c.PortRange.Build()
+	}
+	if c.Fragment != nil {
+		if c.Fragment.Length == nil || c.Fragment.Length.From <= 0 {
+			return nil, errors.New("Reflex outbound: fragment length must be positive")
+		}
+		config.Fragment = &reflex.Fragment{
+			LengthMin: uint32(c.Fragment.Length.From),
+			LengthMax: uint32(c.Fragment.Length.To),
+		}
+		if c.Fragment.Interval != nil {
+			config.Fragment.IntervalMin = uint32(c.Fragment.Interval.From)
+			config.Fragment.IntervalMax = uint32(c.Fragment.Interval.To)
+		}
+	}
+	return config, nil
+}
+
+// decodeReflexKey decodes a key of size bytes printed by "xray reflex gen",
+// in either of the base64 encodings it offers.
+func decodeReflexKey(value string, size int) ([]byte, error) {
+	key, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		key, err = base64.StdEncoding.DecodeString(value)
+	}
+	if err != nil {
+		return nil, errors.New("not valid base64").Base(err)
+	}
+	if len(key) != size {
+		return nil, errors.New("must be ", size, " bytes, got ", len(key))
+	}
+	return key, nil
+}
+
+// validReflexFrameSize bounds maxFrameSize by the smallest frame that still
+// carries data and the largest the frame header can describe.
+func validReflexFrameSize(size uint32) bool {
+	return size == 0 || (size >= 128 && size <= 3+65535)
 }
@@ -0,0 +1,167 @@
+package conf_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	. "github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestReflexInbound(t *testing.T) {
+	creator := func() Buildable {
+		return new(ReflexInboundConfig)
+	}
+
+	runMultiTestCase(t, []TestCase{
+		{
+			Input: `{
+				"clients": [{
+					"id": "27848739-7e62-4138-9fd3-098a63964b6b",
+					"email": "love@example.com",
+					"policy": "zoom",
+					"expiresAt": 1900000000,
+					"quota": 1000000
+				}],
+				"fallback": {"dest": 8080, "errorPages": {"404": "/missing"}},
+				"trafficAccounting": {"file": "traffic.json"},
+				"handshakeBinding": "example.com:443",
+				"handshakeResponseFloor": 50,
+				"maxNonces": 100000,
+				"entropyMonitor": true,
+				"maxSessions": 5000,
+				"drainTimeout": 30,
+				"httpServer": "nginx",
+				"httpResponseHeaders": {"Server": "nginx/1.24.0"},
+				"identityKey": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA",
+				"psk": "AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+			}`,
+			Parser: loadJSON(creator),
+			Output: &reflex.InboundConfig{
+				Clients: []*reflex.User{{
+					Id:        "27848739-7e62-4138-9fd3-098a63964b6b",
+					Email:     "love@example.com",
+					Policy:    "zoom",
+					ExpiresAt: 1900000000,
+					Quota:     1000000,
+				}},
+				Fallback:               &reflex.Fallback{Dest: 8080, ErrorPages: map[uint32]string{404: "/missing"}},
+				TrafficAccounting:      &reflex.TrafficAccounting{File: "traffic.json"},
+				HandshakeBinding:       "example.com:443",
+				HandshakeResponseFloor: 50,
+				MaxNonces:              100000,
+				EntropyMonitor:         true,
+				MaxSessions:            5000,
+				DrainTimeout:           30,
+				HttpServer:             "nginx",
+				HttpResponseHeaders:    map[string]string{"Server": "nginx/1.24.0"},
+				IdentityKey:            make([]byte, 32),
+				Psk:                    make([]byte, 32),
+			},
+		},
+	})
+}
+
+func TestReflexConfigErrorsNameTheField(t *testing.T) {
+	inbound := loadJSON(func() Buildable { return new(ReflexInboundConfig) })
+	outbound := loadJSON(func() Buildable { return new(ReflexOutboundConfig) })
+	const id = `"id": "27848739-7e62-4138-9fd3-098a63964b6b"`
+	for _, tc := range []struct {
+		parse func(string) (proto.Message, error)
+		input string
+		want  string
+	}{
+		{inbound, `{"fallbak": {"dest": 80}}`, `"fallbak"`},
+		{inbound, `{"clients": [{` + id + `, "polcy": "zoom"}]}`, `clients[0]`},
+		{inbound, `{"clients": [{"id": "this-id-is-too-long-to-be-hashed-into-a-uuid"}]}`, `clients[0]: invalid id`},
+		{inbound, `{"fallback": {"dest": 80, "geo": [{"ip": ["10.0.0.0/8"], "dest": 70000}]}}`, `geo[0].dest`},
+		{inbound, `{"userStore": "shared", "clients": [{` + id + `}]}`, `userStore`},
+		{inbound, `{"httpRequiredHeaders": ["Origin", "X Token"]}`, `httpRequiredHeaders[1]`},
+		{inbound, `{"httpContentType": "application/json; charset=utf-8"}`, `httpContentType`},
+		{inbound, `{"unmatched": "drop"}`, `unmatched`},
+		{inbound, `{"httpServer": "iis"}`, `httpServer`},
+		{inbound, `{"fallback": {"dest": 80, "errorPages": {"200": "/"}}}`, `errorPages`},
+		{inbound, `{"identityKey": "c2hvcnQ"}`, `identityKey`},
+		{inbound, `{"psk": "c2hvcnQ"}`, `psk`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "feature": ["mux"]}`, `"feature"`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "features": ["muxx"]}`, `unknown feature muxx`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "httpUpgrade": "sync"}`, `httpUpgrade`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "httpPath": "/s", "httpUpgrade": "a b"}`, `httpUpgrade`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "serverIdentity": "not base64!"}`, `serverIdentity`},
+		{outbound, `{"address": "example.com", "port": 443, ` + id + `, "psk": "not base64!"}`, `psk`},
+	} {
+		_, err := tc.parse(tc.input)
+		if err == nil || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s: got %v, want an error naming %s", tc.input, err, tc.want)
+		}
+	}
+}
+
+func TestReflexIDFromEnvironmentAndFile(t *testing.T) {
+	const id = "27848739-7e62-4138-9fd3-098a63964b6b"
+	t.Setenv("REFLEX_TEST_UUID", id)
+	file := filepath.Join(t.TempDir(), "uuid")
+	if err := os.WriteFile(file, []byte(id+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	inbound := loadJSON(func() Buildable { return new(ReflexInboundConfig) })
+	config, err := inbound(`{"clients": [{"id": "env:REFLEX_TEST_UUID"}, {"id": "file:` + file + `", "email": "f"}]}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, c := range config.(*reflex.InboundConfig).GetClients() {
+		if c.GetId() != id {
+			t.Fatalf("id resolved to %q", c.GetId())
+		}
+	}
+	outbound := loadJSON(func() Buildable { return new(ReflexOutboundConfig) })
+	config, err = outbound(`{"address": "example.com", "port": 443, "id": "file:` + file + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.(*reflex.OutboundConfig).GetId(); got != id {
+		t.Fatalf("outbound id resolved to %q", got)
+	}
+
+	if _, err := inbound(`{"clients": [{"id": "env:REFLEX_TEST_UNSET"}]}`); err == nil || !strings.Contains(err.Error(), "REFLEX_TEST_UNSET") {
+		t.Fatalf("unset variable reported as %v", err)
+	}
+	if _, err := outbound(`{"address": "example.com", "port": 443, "id": "file:/nonexistent/uuid"}`); err == nil {
+		t.Fatal("missing file accepted")
+	}
+}
+
+func TestReflexPSKFromEnvironmentAndFile(t *testing.T) {
+	const psk = "BwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwcHBwc"
+	t.Setenv("REFLEX_TEST_PSK", psk)
+	file := filepath.Join(t.TempDir(), "psk")
+	if err := os.WriteFile(file, []byte(psk+"\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	want := []byte(strings.Repeat("\x07", 32))
+
+	inbound := loadJSON(func() Buildable { return new(ReflexInboundConfig) })
+	config, err := inbound(`{"psk": "env:REFLEX_TEST_PSK"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.(*reflex.InboundConfig).GetPsk(); string(got) != string(want) {
+		t.Fatalf("inbound psk resolved to %x", got)
+	}
+	outbound := loadJSON(func() Buildable { return new(ReflexOutboundConfig) })
+	config, err = outbound(`{"address": "example.com", "port": 443, "id": "27848739-7e62-4138-9fd3-098a63964b6b", "psk": "file:` + file + `"}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := config.(*reflex.OutboundConfig).GetPsk(); string(got) != string(want) {
+		t.Fatalf("outbound psk resolved to %x", got)
+	}
+
+	if _, err := inbound(`{"psk": "env:REFLEX_TEST_UNSET"}`); err == nil || !strings.Contains(err.Error(), "REFLEX_TEST_UNSET") {
+		t.Fatalf("unset variable reported as %v", err)
+	}
+}
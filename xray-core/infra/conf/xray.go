@@ -349,6 +349,7 @@ type Config struct {
 	Observatory      *ObservatoryConfig      `json:"observatory"`
 	BurstObservatory *BurstObservatoryConfig `json:"burstObservatory"`
 	Version          *VersionConfig          `json:"version"`
+	ReflexUserStores ReflexUserStoresConfig  `json:"reflexUserStores"`
 }
 
 func (c *Config) findInboundTag(tag string) int {
@@ -421,6 +422,10 @@ func (c *Config) Override(o *Config, fn string) {
 		c.Version = o.Version
 	}
 
+	if o.ReflexUserStores != nil {
+		c.ReflexUserStores = o.ReflexUserStores
+	}
+
 	// update the Inbound in slice if the only one in override config has same tag
 	if len(o.InboundConfigs) > 0 {
 		for i := range o.InboundConfigs {
@@ -569,6 +574,14 @@ func (c *Config) Build() (*core.Config, error) {
 		config.App = append(config.App, serial.ToTypedMessage(r))
 	}
 
+	if c.ReflexUserStores != nil {
+		r, err := c.ReflexUserStores.Build()
+		if err != nil {
+			return nil, errors.New("failed to build reflex user stores").Base(err)
+		}
+		config.App = append(config.App, serial.ToTypedMessage(r))
+	}
+
 	var inbounds []InboundDetourConfig
 
 	if len(c.InboundConfigs) > 0 {
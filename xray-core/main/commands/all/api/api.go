@@ -33,5 +33,10 @@ var CmdAPI = &base.Command{
 		cmdOnlineStats,
 		cmdOnlineStatsIpList,
 		cmdGetAllOnlineUsers,
+		cmdReflexPolicy,
+		cmdReflexSessions,
+		cmdReflexSession,
+		cmdReflexTraffic,
+		cmdReflexReload,
 	},
 }
@@ -0,0 +1,72 @@
+package api
+
+import (
+	"fmt"
+
+	handlerService "github.com/xtls/xray-core/app/proxyman/command"
+	cserial "github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/proxy/reflex"
+
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+var cmdReflexPolicy = &base.Command{
+	CustomFlags: true,
+	UsageLine:   "{{.Exec}} api rfpolicy [--server=127.0.0.1:8080] -tag=tag [-email=email] [-uplink=profile] [-downlink=profile]",
+	Short:       "Switch the profiles of live Reflex sessions",
+	Long: `
+Switch the traffic profiles of live Reflex sessions without closing them.
+Clients that negotiate policies receive the new grant in-band; older clients
+only see the new downlink shaping.
+Arguments:
+	-s, -server
+		The API server address. Default 127.0.0.1:8080
+	-t, -timeout
+		Timeout seconds to call API. Default 3
+	-tag
+		Inbound tag
+	-email
+		Only update this user's sessions. Default: all sessions
+	-uplink
+		New uplink profile. Default: unchanged
+	-downlink
+		New downlink profile. Default: unchanged
+Example:
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -tag="reflex-in" -uplink=zoom -downlink=zoom
+`,
+	Run: executeReflexPolicy,
+}
+
+func executeReflexPolicy(cmd *base.Command, args []string) {
+	setSharedFlags(cmd)
+	var tag, email, uplink, downlink string
+	cmd.Flag.StringVar(&tag, "tag", "", "")
+	cmd.Flag.StringVar(&email, "email", "", "")
+	cmd.Flag.StringVar(&uplink, "uplink", "", "")
+	cmd.Flag.StringVar(&downlink, "downlink", "", "")
+	cmd.Flag.Parse(args)
+	if len(tag) < 1 {
+		base.Fatalf("inbound tag not specified")
+	}
+	if uplink == "" && downlink == "" {
+		base.Fatalf("specify -uplink and/or -downlink")
+	}
+
+	conn, ctx, close := dialAPIServer()
+	defer close()
+	client := handlerService.NewHandlerServiceClient(conn)
+
+	_, err := client.AlterInbound(ctx, &handlerService.AlterInboundRequest{
+		Tag: tag,
+		Operation: cserial.ToTypedMessage(
+			&reflex.UpdatePolicyOperation{
+				Email:          email,
+				UplinkPolicy:   uplink,
+				DownlinkPolicy: downlink,
+			}),
+	})
+	if err != nil {
+		base.Fatalf("failed to update policy: %s", err)
+	}
+	fmt.Println("Policy update sent.")
+}
@@ -0,0 +1,85 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+
+	handlerService "github.com/xtls/xray-core/app/proxyman/command"
+	cserial "github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/reflex"
+
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+var cmdReflexReload = &base.Command{
+	CustomFlags: true,
+	UsageLine:   "{{.Exec}} api rfreload [--server=127.0.0.1:8080] -tag=tag [-profiles] [settings.json]",
+	Short:       "Swap the fallback and rate limits of a running Reflex inbound",
+	Long: `
+Swap the fallback and policyRateLimits of a running Reflex inbound without
+restarting it. The settings file holds them as in the inbound's settings;
+both replace the current ones, so one left out is removed. Running sessions
+keep their rate limits; new sessions and connections use the new settings.
+Arguments:
+	-s, -server
+		The API server address. Default 127.0.0.1:8080
+	-t, -timeout
+		Timeout seconds to call API. Default 3
+	-tag
+		Inbound tag
+	-profiles
+		Also re-read the inbound's profileDir
+Example:
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -tag="reflex-in" settings.json
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -tag="reflex-in" -profiles settings.json
+`,
+	Run: executeReflexReload,
+}
+
+func executeReflexReload(cmd *base.Command, args []string) {
+	setSharedFlags(cmd)
+	var tag string
+	var profiles bool
+	cmd.Flag.StringVar(&tag, "tag", "", "")
+	cmd.Flag.BoolVar(&profiles, "profiles", false, "")
+	cmd.Flag.Parse(args)
+	if len(tag) < 1 {
+		base.Fatalf("inbound tag not specified")
+	}
+	if cmd.Flag.NArg() != 1 {
+		base.Fatalf("specify one settings file")
+	}
+
+	r, err := loadArg(cmd.Flag.Arg(0))
+	if err != nil {
+		base.Fatalf("failed to load %s: %s", cmd.Flag.Arg(0), err)
+	}
+	settings := new(conf.ReflexInboundConfig)
+	if err := json.NewDecoder(r).Decode(settings); err != nil {
+		base.Fatalf("failed to parse %s: %s", cmd.Flag.Arg(0), err)
+	}
+	built, err := settings.Build()
+	if err != nil {
+		base.Fatalf("invalid settings: %s", err)
+	}
+	config := built.(*reflex.InboundConfig)
+
+	conn, ctx, close := dialAPIServer()
+	defer close()
+	client := handlerService.NewHandlerServiceClient(conn)
+
+	_, err = client.AlterInbound(ctx, &handlerService.AlterInboundRequest{
+		Tag: tag,
+		Operation: cserial.ToTypedMessage(
+			&reflex.ReloadOperation{
+				Fallback:         config.GetFallback(),
+				PolicyRateLimits: config.GetPolicyRateLimits(),
+				ReloadProfiles:   profiles,
+			}),
+	})
+	if err != nil {
+		base.Fatalf("failed to reload: %s", err)
+	}
+	fmt.Println("Reflex inbound reloaded.")
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"fmt"
+
+	reflexService "github.com/xtls/xray-core/proxy/reflex/command"
+
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+var cmdReflexSessions = &base.Command{
+	CustomFlags: true,
+	UsageLine:   "{{.Exec}} api rfsessions [--server=127.0.0.1:8080] [-tag=tag] [-email=email]",
+	Short:       "List live Reflex sessions",
+	Long: `
+List live Reflex sessions with their user, source, uptime, traffic, profiles
+and the KS distance of their recent frame sizes from the downlink profile.
+Arguments:
+	-s, -server
+		The API server address. Default 127.0.0.1:8080
+	-t, -timeout
+		Timeout seconds to call API. Default 3
+	-tag
+		Inbound tag. Default: all Reflex inbounds
+	-email
+		Only list this user's sessions. Default: all sessions
+Example:
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -tag="reflex-in"
+`,
+	Run: executeReflexSessions,
+}
+
+func executeReflexSessions(cmd *base.Command, args []string) {
+	setSharedFlags(cmd)
+	var tag, email string
+	cmd.Flag.StringVar(&tag, "tag", "", "")
+	cmd.Flag.StringVar(&email, "email", "", "")
+	cmd.Flag.Parse(args)
+
+	conn, ctx, close := dialAPIServer()
+	defer close()
+	client := reflexService.NewReflexServiceClient(conn)
+
+	resp, err := client.ListSessions(ctx, &reflexService.ListSessionsRequest{
+		Tag:   tag,
+		Email: email,
+	})
+	if err != nil {
+		base.Fatalf("failed to list sessions: %s", err)
+	}
+	showJSONResponse(resp)
+}
+
+var cmdReflexSession = &base.Command{
+	CustomFlags: true,
+	UsageLine:   "{{.Exec}} api rfsession [--server=127.0.0.1:8080] [-tag=tag] -id=id [-close] [-uplink=profile] [-downlink=profile]",
+	Short:       "Close or re-profile one live Reflex session",
+	Long: `
+Close one live Reflex session, or switch its traffic profiles without closing
+it. Session IDs are listed by rfsessions and tag the session's log lines.
+Arguments:
+	-s, -server
+		The API server address. Default 127.0.0.1:8080
+	-t, -timeout
+		Timeout seconds to call API. Default 3
+	-tag
+		Inbound tag. Default: all Reflex inbounds
+	-id
+		Session ID
+	-close
+		Close the session
+	-uplink
+		New uplink profile. Default: unchanged
+	-downlink
+		New downlink profile. Default: unchanged
+Example:
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -id=1234567 -downlink=zoom
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -id=1234567 -close
+`,
+	Run: executeReflexSession,
+}
+
+func executeReflexSession(cmd *base.Command, args []string) {
+	setSharedFlags(cmd)
+	var tag, uplink, downlink string
+	var id uint
+	var closeSession bool
+	cmd.Flag.StringVar(&tag, "tag", "", "")
+	cmd.Flag.UintVar(&id, "id", 0, "")
+	cmd.Flag.BoolVar(&closeSession, "close", false, "")
+	cmd.Flag.StringVar(&uplink, "uplink", "", "")
+	cmd.Flag.StringVar(&downlink, "downlink", "", "")
+	cmd.Flag.Parse(args)
+	if id == 0 {
+		base.Fatalf("session id not specified")
+	}
+	if closeSession == (uplink != "" || downlink != "") {
+		base.Fatalf("specify either -close or -uplink and/or -downlink")
+	}
+
+	conn, ctx, close := dialAPIServer()
+	defer close()
+	client := reflexService.NewReflexServiceClient(conn)
+
+	if closeSession {
+		_, err := client.CloseSession(ctx, &reflexService.CloseSessionRequest{
+			Tag: tag,
+			Id:  uint32(id),
+		})
+		if err != nil {
+			base.Fatalf("failed to close session: %s", err)
+		}
+		fmt.Println("Session closed.")
+		return
+	}
+	_, err := client.UpdateSession(ctx, &reflexService.UpdateSessionRequest{
+		Tag:            tag,
+		Id:             uint32(id),
+		UplinkPolicy:   uplink,
+		DownlinkPolicy: downlink,
+	})
+	if err != nil {
+		base.Fatalf("failed to update session: %s", err)
+	}
+	fmt.Println("Policy update sent.")
+}
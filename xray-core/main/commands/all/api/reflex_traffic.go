@@ -0,0 +1,56 @@
+package api
+
+import (
+	reflexService "github.com/xtls/xray-core/proxy/reflex/command"
+
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+var cmdReflexTraffic = &base.Command{
+	CustomFlags: true,
+	UsageLine:   "{{.Exec}} api rftraffic [--server=127.0.0.1:8080] [-tag=tag] [-email=email] [-reset]",
+	Short:       "Query or reset accounted Reflex traffic",
+	Long: `
+Query the payload bytes each Reflex user moved since the totals were last
+reset, as kept by inbounds with trafficAccounting, or reset them.
+Arguments:
+	-s, -server
+		The API server address. Default 127.0.0.1:8080
+	-t, -timeout
+		Timeout seconds to call API. Default 3
+	-tag
+		Inbound tag. Default: all Reflex inbounds
+	-email
+		Only this user's totals. Default: all users
+	-reset
+		Reset the totals, printing them as they were
+Example:
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -email="user@example.com"
+    {{.Exec}} {{.LongName}} --server=127.0.0.1:8080 -reset
+`,
+	Run: executeReflexTraffic,
+}
+
+func executeReflexTraffic(cmd *base.Command, args []string) {
+	setSharedFlags(cmd)
+	var tag, email string
+	var reset bool
+	cmd.Flag.StringVar(&tag, "tag", "", "")
+	cmd.Flag.StringVar(&email, "email", "", "")
+	cmd.Flag.BoolVar(&reset, "reset", false, "")
+	cmd.Flag.Parse(args)
+
+	conn, ctx, close := dialAPIServer()
+	defer close()
+	client := reflexService.NewReflexServiceClient(conn)
+
+	resp, err := client.GetTraffic(ctx, &reflexService.GetTrafficRequest{
+		Tag:    tag,
+		Email:  email,
+		Reset_: reset,
+	})
+	if err != nil {
+		base.Fatalf("failed to get traffic: %s", err)
+	}
+	showJSONResponse(resp)
+}
@@ -0,0 +1,80 @@
+package reflex
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/xtls/xray-core/main/commands/base"
+	"github.com/xtls/xray-core/proxy/reflex/analysis"
+)
+
+var cmdAnalyze = &base.Command{
+	UsageLine: `{{.Exec}} reflex analyze -reflex <file> -target <file> [-reflex-flow <index>] [-target-flow <index>]`,
+	Short:     `Compare a captured Reflex session with its target application`,
+	Long: `
+Compare a pcap capture of a Reflex session with one of the application its
+profile imitates, and print a JSON report of how far apart they are: KS and
+Jensen-Shannon distances of sizes and inter-arrival delays, KS distances of
+burst lengths and gaps, and per-trace burst and entropy statistics.
+Distances near 0 mean a classifier looking at these features has little to
+go on.
+
+Arguments:
+
+	-reflex <file>
+		Capture of the Reflex session. Required.
+
+	-target <file>
+		Capture of the target application. Required.
+
+	-reflex-flow <index>, -target-flow <index>
+		Flow of each capture to use, as numbered by "reflex profile -list".
+		Default: 0, the flow that carried the most payload bytes.
+
+Example:
+
+	{{.Exec}} reflex analyze -reflex reflex.pcap -target meet.pcap
+`,
+}
+
+func init() {
+	cmdAnalyze.Run = executeAnalyze // break init loop
+}
+
+var (
+	analyzeReflex     = cmdAnalyze.Flag.String("reflex", "", "")
+	analyzeTarget     = cmdAnalyze.Flag.String("target", "", "")
+	analyzeReflexFlow = cmdAnalyze.Flag.Int("reflex-flow", 0, "")
+	analyzeTargetFlow = cmdAnalyze.Flag.Int("target-flow", 0, "")
+)
+
+func executeAnalyze(cmd *base.Command, args []string) {
+	if *analyzeReflex == "" || *analyzeTarget == "" {
+		base.Fatalf("-reflex and -target are required")
+	}
+	reflexTrace := readTrace(*analyzeReflex, *analyzeReflexFlow)
+	targetTrace := readTrace(*analyzeTarget, *analyzeTargetFlow)
+	report, err := analysis.Compare(reflexTrace, targetTrace)
+	if err != nil {
+		base.Fatalf("failed to compare: %s", err)
+	}
+	out, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		base.Fatalf("failed to encode report: %s", err)
+	}
+	fmt.Println(string(out))
+}
+
+func readTrace(file string, flow int) analysis.Trace {
+	f, err := os.Open(file)
+	if err != nil {
+		base.Fatalf("failed to open capture: %s", err)
+	}
+	defer f.Close()
+	trace, err := analysis.ReadTrace(f, flow)
+	if err != nil {
+		base.Fatalf("%s: %s", file, err)
+	}
+	return trace
+}
@@ -0,0 +1,192 @@
+package reflex
+
+import (
+	"context"
+	"fmt"
+	stdnet "net"
+	"strconv"
+	"time"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/infra/conf/serial"
+	"github.com/xtls/xray-core/main/commands/base"
+	"github.com/xtls/xray-core/main/confloader"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	reflexin "github.com/xtls/xray-core/proxy/reflex/inbound"
+)
+
+var cmdCheck = &base.Command{
+	UsageLine: `{{.Exec}} reflex check [-handshake] -c <config.json>`,
+	Short:     `Check the Reflex inbounds and outbounds of a config`,
+	Long: `
+Check the Reflex inbounds and outbounds of an Xray JSON config before
+deploying it. Beyond what "xray run -test" verifies, it reports user IDs that
+collide, policies that name no profile and would silently fall back to the
+default, profile files that do not parse and fallback ports nothing listens
+on. Outbounds are checked as "xray run -test" would.
+
+Exits with status 1 if any problem is found.
+
+Arguments:
+
+	-c <config.json>
+		Config to check. Required.
+
+	-handshake
+		Also perform a handshake as the first user of each inbound against
+		its listener, which must be running. Inbounds behind TLS, WebSocket
+		or gRPC are skipped.
+
+Example:
+
+	{{.Exec}} reflex check -handshake -c /etc/xray/config.json
+`,
+}
+
+func init() {
+	cmdCheck.Run = executeCheck // break init loop
+}
+
+var (
+	checkConfig    = cmdCheck.Flag.String("c", "", "")
+	checkHandshake = cmdCheck.Flag.Bool("handshake", false, "")
+)
+
+// checkHandshakeTimeout bounds the loopback handshake.
+const checkHandshakeTimeout = 5 * time.Second
+
+func executeCheck(cmd *base.Command, args []string) {
+	if *checkConfig == "" {
+		base.Fatalf("-c is required")
+	}
+	reader, err := confloader.LoadConfig(*checkConfig)
+	if err != nil {
+		base.Fatalf("failed to load config: %s", err)
+	}
+	config, err := serial.DecodeJSONConfig(reader)
+	if err != nil {
+		base.Fatalf("failed to parse config: %s", err)
+	}
+
+	found := 0
+	for i, detour := range config.InboundConfigs {
+		if detour.Protocol != "reflex" {
+			continue
+		}
+		found++
+		name := detourName("inbound", detour.Tag, i)
+		report(name, checkInbound(name, &detour))
+	}
+	for i, detour := range config.OutboundConfigs {
+		if detour.Protocol != "reflex" {
+			continue
+		}
+		found++
+		report(detourName("outbound", detour.Tag, i), checkOutbound(&detour))
+	}
+	if found == 0 {
+		base.Fatalf("no reflex inbounds or outbounds in %s", *checkConfig)
+	}
+	base.Exit()
+}
+
+func detourName(kind, tag string, index int) string {
+	if tag != "" {
+		return kind + " " + tag
+	}
+	return kind + " #" + strconv.Itoa(index)
+}
+
+// report prints name's problems, or that it passed.
+func report(name string, problems []string) {
+	if len(problems) == 0 {
+		fmt.Printf("%s: ok\n", name)
+		return
+	}
+	for _, p := range problems {
+		base.Errorf("%s: %s", name, p)
+	}
+}
+
+func checkInbound(name string, detour *conf.InboundDetourConfig) []string {
+	handler, err := detour.Build()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	instance, err := handler.ProxySettings.GetInstance()
+	if err != nil {
+		return []string{err.Error()}
+	}
+	settings := instance.(*reflex.InboundConfig)
+	var problems []string
+	for _, err := range reflexin.CheckConfig(settings) {
+		problems = append(problems, err.Error())
+	}
+	if *checkHandshake {
+		if err := loopbackHandshake(name, detour, settings); err != nil {
+			problems = append(problems, err.Error())
+		}
+	}
+	return problems
+}
+
+// loopbackHandshake authenticates as the inbound's first user against its
+// listener.
+func loopbackHandshake(name string, detour *conf.InboundDetourConfig, settings *reflex.InboundConfig) error {
+	skip := ""
+	switch {
+	case len(settings.GetClients()) == 0:
+		skip = "no users"
+	case detour.StreamSetting != nil && detour.StreamSetting.Security != "" && detour.StreamSetting.Security != "none":
+		skip = detour.StreamSetting.Security + " security"
+	case settings.GetWebsocketPath() != "" || settings.GetGrpcService() != "":
+		skip = "WebSocket or gRPC transport"
+	case detour.PortList == nil || len(detour.PortList.Range) == 0:
+		skip = "no port"
+	}
+	if skip != "" {
+		fmt.Printf("%s: handshake skipped: %s\n", name, skip)
+		return nil
+	}
+	host := "127.0.0.1"
+	if detour.ListenOn != nil && detour.ListenOn.Family().IsIP() && !detour.ListenOn.IP().IsUnspecified() {
+		host = detour.ListenOn.IP().String()
+	}
+	address := stdnet.JoinHostPort(host, strconv.Itoa(int(detour.PortList.Range[0].From)))
+
+	id, err := uuid.ParseString(settings.GetClients()[0].GetId())
+	if err != nil {
+		return err
+	}
+	client := &encoding.ClientConfig{
+		PuzzleDifficulty: settings.GetPuzzle().GetDifficulty(),
+		Binding:          settings.GetHandshakeBinding(),
+	}
+	copy(client.UserID[:], id.Bytes())
+
+	conn, err := stdnet.DialTimeout("tcp", address, checkHandshakeTimeout)
+	if err != nil {
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(checkHandshakeTimeout))
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session, err := encoding.NewClientConn(ctx, conn, client)
+	if err != nil {
+		return fmt.Errorf("handshake with %s failed: %w", address, err)
+	}
+	defer session.Close()
+	grant := session.Grant()
+	fmt.Printf("%s: handshake with %s: uplink %s, downlink %s\n", name, address, grant.Uplink, grant.Downlink)
+	return nil
+}
+
+func checkOutbound(detour *conf.OutboundDetourConfig) []string {
+	if _, err := detour.Build(); err != nil {
+		return []string{err.Error()}
+	}
+	return nil
+}
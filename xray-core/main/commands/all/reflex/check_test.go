@@ -0,0 +1,114 @@
+package reflex
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/infra/conf"
+)
+
+const (
+	checkID      = "b831381d-6324-4d53-ad4f-8cda48b30811"
+	checkOtherID = "27848739-7e62-4138-9fd3-098a63964b6b"
+)
+
+func TestCheckInbound(t *testing.T) {
+	for _, c := range []struct {
+		name     string
+		settings string
+		problems []string
+	}{
+		{
+			name:     "valid",
+			settings: `{"clients": [{"id": "` + checkID + `", "policy": "youtube"}, {"id": "` + checkOtherID + `"}]}`,
+		},
+		{
+			name:     "duplicate id",
+			settings: `{"clients": [{"id": "` + checkID + `", "email": "a"}, {"id": "` + strings.ToUpper(checkID) + `", "email": "b"}]}`,
+			problems: []string{"user b: duplicate id"},
+		},
+		{
+			name:     "unknown policies",
+			settings: `{"clients": [{"id": "` + checkID + `", "email": "a", "policy": "nope", "allowedPolicies": ["youtube", "nada"]}]}`,
+			problems: []string{"user a: unknown policy nope", "user a: unknown policy nada"},
+		},
+		{
+			name:     "missing profile dir",
+			settings: `{"clients": [{"id": "` + checkID + `"}], "profileDir": "/nonexistent/reflex-profiles"}`,
+			problems: []string{"invalid profileDir"},
+		},
+		{
+			name:     "unknown field",
+			settings: `{"clients": [{"id": "` + checkID + `"}], "bogus": true}`,
+			problems: []string{"bogus"},
+		},
+	} {
+		settings := json.RawMessage(c.settings)
+		detour := &conf.InboundDetourConfig{
+			Protocol: "reflex",
+			PortList: &conf.PortList{Range: []conf.PortRange{{From: 443, To: 443}}},
+			Settings: &settings,
+		}
+		problems := checkInbound("inbound test", detour)
+		if len(problems) != len(c.problems) {
+			t.Errorf("%s: got problems %q; want %d", c.name, problems, len(c.problems))
+			continue
+		}
+		for i, want := range c.problems {
+			if !strings.Contains(problems[i], want) {
+				t.Errorf("%s: problem %q lacks %q", c.name, problems[i], want)
+			}
+		}
+	}
+}
+
+func TestCheckInboundSkipsHandshake(t *testing.T) {
+	*checkHandshake = true
+	defer func() { *checkHandshake = false }()
+
+	for _, settings := range []string{
+		`{"clients": []}`,
+		`{"clients": [{"id": "` + checkID + `"}], "websocketPath": "/ws"}`,
+	} {
+		raw := json.RawMessage(settings)
+		detour := &conf.InboundDetourConfig{
+			Protocol: "reflex",
+			PortList: &conf.PortList{Range: []conf.PortRange{{From: 1, To: 1}}},
+			Settings: &raw,
+		}
+		if problems := checkInbound("inbound test", detour); len(problems) != 0 {
+			t.Errorf("%s: got problems %q", settings, problems)
+		}
+	}
+}
+
+func TestCheckOutbound(t *testing.T) {
+	for _, c := range []struct {
+		settings string
+		problem  string
+	}{
+		{settings: `{"address": "example.com", "port": 443, "id": "` + checkID + `"}`},
+		{settings: `{"port": 443, "id": "` + checkID + `"}`, problem: "address is not set"},
+		{settings: `{"address": "example.com", "port": 443, "id": "` + checkID + `", "hopInterval": 30}`, problem: "hopInterval needs portRange"},
+		{settings: `{"address": "example.com", "port": 443, "id": "` + checkID + `", "serverIdentity": "short"}`, problem: "serverIdentity"},
+	} {
+		raw := json.RawMessage(c.settings)
+		problems := checkOutbound(&conf.OutboundDetourConfig{Protocol: "reflex", Settings: &raw})
+		switch {
+		case c.problem == "" && len(problems) != 0:
+			t.Errorf("%s: got problems %q", c.settings, problems)
+		case c.problem != "" && (len(problems) != 1 || !strings.Contains(problems[0], c.problem)):
+			t.Errorf("%s: got problems %q; want one about %s", c.settings, problems, c.problem)
+		}
+	}
+}
+
+func TestDetourName(t *testing.T) {
+	if got := detourName("inbound", "edge", 3); got != "inbound edge" {
+		t.Errorf("tagged detour named %q", got)
+	}
+	if got := detourName("outbound", "", 3); got != "outbound #3" {
+		t.Errorf("untagged detour named %q", got)
+	}
+}
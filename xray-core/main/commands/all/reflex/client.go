@@ -0,0 +1,224 @@
+package reflex
+
+import (
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	stdnet "net"
+	"os"
+	"strings"
+
+	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/task"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/main/commands/base"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+var cmdClient = &base.Command{
+	UsageLine: `{{.Exec}} reflex client [-listen <addr>] -server <host:port> -id <uuid> [-uplink <profile>] [-downlink <profile>] [-features <list>] [-padding none|profile|max] [-puzzle <difficulty>] [-binding <value>]`,
+	Short:     `Tunnel a local SOCKS5 proxy through a Reflex server`,
+	Long: `
+Open a SOCKS5 listener and carry every connection made through it over its
+own Reflex session to the server, for smoke-testing a server without
+configuring a full Xray client. Only CONNECT without authentication is
+supported.
+
+Arguments:
+
+	-server <host:port>
+		Reflex server to connect to. Required.
+
+	-id <uuid>
+		User ID. Required.
+
+	-listen <addr>
+		Address of the SOCKS5 listener. Default: 127.0.0.1:1080.
+
+	-uplink <profile>, -downlink <profile>
+		Profiles to request. Default: the account's policy.
+
+	-features <list>
+		Comma-separated features to request, e.g. "heartbeat,flow".
+
+	-padding none|profile|max
+		Padding level to request.
+
+	-puzzle <difficulty>
+		Handshake puzzle difficulty to pre-solve, matching the server's.
+
+	-binding <value>
+		The server's handshakeBinding, if it sets one.
+
+Example:
+
+	{{.Exec}} reflex client -server example.com:443 -id 27848739-7e62-4138-9fd3-098a63964b6b
+	curl -x socks5h://127.0.0.1:1080 https://example.com
+`,
+}
+
+func init() {
+	cmdClient.Run = executeClient // break init loop
+}
+
+var (
+	clientServer   = cmdClient.Flag.String("server", "", "")
+	clientID       = cmdClient.Flag.String("id", "", "")
+	clientListen   = cmdClient.Flag.String("listen", "127.0.0.1:1080", "")
+	clientUplink   = cmdClient.Flag.String("uplink", "", "")
+	clientDownlink = cmdClient.Flag.String("downlink", "", "")
+	clientFeatures = cmdClient.Flag.String("features", "", "")
+	clientPadding  = cmdClient.Flag.String("padding", "", "")
+	clientPuzzle   = cmdClient.Flag.Uint("puzzle", 0, "")
+	clientBinding  = cmdClient.Flag.String("binding", "", "")
+)
+
+func executeClient(cmd *base.Command, args []string) {
+	if *clientServer == "" || *clientID == "" {
+		base.Fatalf("-server and -id are required")
+	}
+	id, err := uuid.ParseString(*clientID)
+	if err != nil {
+		base.Fatalf("invalid -id: %s", err)
+	}
+	config := &encoding.ClientConfig{
+		PuzzleDifficulty: uint32(*clientPuzzle),
+		Binding:          *clientBinding,
+		Policy: &encoding.PolicyRequest{
+			Uplink:   *clientUplink,
+			Downlink: *clientDownlink,
+			Padding:  *clientPadding,
+		},
+	}
+	copy(config.UserID[:], id.Bytes())
+	if *clientFeatures != "" {
+		config.Policy.Features = strings.Split(*clientFeatures, ",")
+	}
+
+	ln, err := stdnet.Listen("tcp", *clientListen)
+	if err != nil {
+		base.Fatalf("failed to listen: %s", err)
+	}
+	fmt.Fprintf(os.Stderr, "SOCKS5 on %s, tunnelling through %s\n", ln.Addr(), *clientServer)
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			base.Fatalf("failed to accept: %s", err)
+		}
+		go func() {
+			defer conn.Close()
+			if err := tunnel(conn, config); err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %s\n", conn.RemoteAddr(), err)
+			}
+		}()
+	}
+}
+
+// tunnel serves one SOCKS5 connection over a new Reflex session.
+func tunnel(conn stdnet.Conn, config *encoding.ClientConfig) error {
+	dest, err := socksConnect(conn)
+	if err != nil {
+		return err
+	}
+	server, err := stdnet.Dial("tcp", *clientServer)
+	if err != nil {
+		socksReply(conn, 0x05)
+		return err
+	}
+	defer server.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	session, err := encoding.NewClientConn(ctx, server, config)
+	if err != nil {
+		socksReply(conn, 0x01)
+		return fmt.Errorf("handshake failed: %w", err)
+	}
+	defer session.Close()
+	if err := session.WriteDestination(dest); err != nil {
+		socksReply(conn, 0x01)
+		return err
+	}
+	if err := socksReply(conn, 0x00); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "%s: %s via %s\n", conn.RemoteAddr(), dest, session.Grant().Downlink)
+
+	requestDone := func() error {
+		return session.CopyFrom(buf.NewReader(conn))
+	}
+	// The server ends the session once upstream is done, which is the end
+	// of the tunnel even if the local client is still sending.
+	responseDone := func() error {
+		return session.CopyTo(buf.NewWriter(conn))
+	}
+	return task.Run(ctx, requestDone, task.OnSuccess(responseDone, task.Close(conn)))
+}
+
+// socksConnect reads a SOCKS5 greeting and CONNECT request and returns the
+// requested destination.
+func socksConnect(conn io.ReadWriter) (net.Destination, error) {
+	var header [2]byte
+	if _, err := io.ReadFull(conn, header[:]); err != nil {
+		return net.Destination{}, err
+	}
+	if header[0] != 0x05 {
+		return net.Destination{}, fmt.Errorf("not a SOCKS5 client")
+	}
+	if _, err := io.ReadFull(conn, make([]byte, header[1])); err != nil {
+		return net.Destination{}, err
+	}
+	// No authentication.
+	if _, err := conn.Write([]byte{0x05, 0x00}); err != nil {
+		return net.Destination{}, err
+	}
+	var request [4]byte
+	if _, err := io.ReadFull(conn, request[:]); err != nil {
+		return net.Destination{}, err
+	}
+	if request[1] != 0x01 {
+		socksReply(conn, 0x07)
+		return net.Destination{}, fmt.Errorf("unsupported SOCKS5 command %d", request[1])
+	}
+	var address net.Address
+	switch request[3] {
+	case 0x01:
+		ip := make([]byte, 4)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return net.Destination{}, err
+		}
+		address = net.IPAddress(ip)
+	case 0x04:
+		ip := make([]byte, 16)
+		if _, err := io.ReadFull(conn, ip); err != nil {
+			return net.Destination{}, err
+		}
+		address = net.IPAddress(ip)
+	case 0x03:
+		var n [1]byte
+		if _, err := io.ReadFull(conn, n[:]); err != nil {
+			return net.Destination{}, err
+		}
+		domain := make([]byte, n[0])
+		if _, err := io.ReadFull(conn, domain); err != nil {
+			return net.Destination{}, err
+		}
+		address = net.DomainAddress(string(domain))
+	default:
+		socksReply(conn, 0x08)
+		return net.Destination{}, fmt.Errorf("unsupported SOCKS5 address type %d", request[3])
+	}
+	var port [2]byte
+	if _, err := io.ReadFull(conn, port[:]); err != nil {
+		return net.Destination{}, err
+	}
+	return net.TCPDestination(address, net.Port(binary.BigEndian.Uint16(port[:]))), nil
+}
+
+// socksReply answers the CONNECT request with status and an unspecified
+// bound address.
+func socksReply(w io.Writer, status byte) error {
+	_, err := w.Write([]byte{0x05, status, 0x00, 0x01, 0, 0, 0, 0, 0, 0})
+	return err
+}
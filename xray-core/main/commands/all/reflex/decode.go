@@ -0,0 +1,253 @@
+package reflex
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/main/commands/base"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+var cmdDecode = &base.Command{
+	UsageLine: `{{.Exec}} reflex decode [-type client|server|frame] [-key <session key>] [-version <n>] [-stream] [dump]`,
+	Short:     `Decode captured Reflex handshakes and frames`,
+	Long: `
+Decode a captured Reflex handshake or frame stream and print its fields.
+
+The dump is read from the argument or, if omitted, from stdin, and may be
+hex or base64. Server handshakes may also be given as the raw HTTP response
+or its JSON body.
+
+Arguments:
+
+	-type client|server|frame
+		What the dump contains. Default: client.
+
+	-key <hex|base64>
+		Session key. Decrypts the policy grant of a server handshake, or
+		the payloads of a frame stream starting at its first frame.
+
+	-version <n>
+		Protocol version the frame stream's session negotiated. Versions
+		3 and later authenticate frame headers and 4 and later mask
+		their lengths, so those streams can only be split with -key.
+		Default: 5.
+
+	-stream
+		The session was granted the "stream" feature, which seals frame
+		types inside the records. Needs -key.
+
+Example:
+
+	{{.Exec}} reflex decode -type frame -key <key> 0005011f...
+`,
+}
+
+func init() {
+	cmdDecode.Run = executeDecode // break init loop
+}
+
+var (
+	decodeType    = cmdDecode.Flag.String("type", "client", "")
+	decodeKey     = cmdDecode.Flag.String("key", "", "")
+	decodeVersion = cmdDecode.Flag.Uint("version", uint(encoding.ProtocolVersion5), "")
+	decodeStream  = cmdDecode.Flag.Bool("stream", false, "")
+)
+
+func executeDecode(cmd *base.Command, args []string) {
+	var input []byte
+	var err error
+	if len(args) > 0 {
+		input = []byte(strings.Join(args, ""))
+	} else {
+		input, err = io.ReadAll(os.Stdin)
+		if err != nil {
+			base.Fatalf("failed to read stdin: %s", err)
+		}
+	}
+	var key []byte
+	if *decodeKey != "" {
+		if key, err = decodeDump([]byte(*decodeKey)); err != nil {
+			base.Fatalf("invalid key: %s", err)
+		}
+	}
+
+	switch *decodeType {
+	case "client":
+		raw, err := decodeDump(input)
+		if err != nil {
+			base.Fatalf("invalid dump: %s", err)
+		}
+		printClientHandshake(raw)
+	case "server":
+		raw, err := serverPayload(input)
+		if err != nil {
+			base.Fatalf("invalid dump: %s", err)
+		}
+		printServerHandshake(raw, key)
+	case "frame":
+		raw, err := decodeDump(input)
+		if err != nil {
+			base.Fatalf("invalid dump: %s", err)
+		}
+		if *decodeStream && key == nil {
+			base.Fatalf("-stream needs -key")
+		}
+		printFrames(os.Stdout, raw, key, uint8(*decodeVersion), *decodeStream)
+	default:
+		base.Fatalf("unknown type: %s", *decodeType)
+	}
+}
+
+// decodeDump accepts hex (with optional whitespace and colons) or base64.
+func decodeDump(input []byte) ([]byte, error) {
+	cleaned := strings.Map(func(r rune) rune {
+		switch r {
+		case ' ', '\t', '\r', '\n', ':':
+			return -1
+		}
+		return r
+	}, string(input))
+	if raw, err := hex.DecodeString(cleaned); err == nil {
+		return raw, nil
+	}
+	if raw, err := base64.StdEncoding.DecodeString(cleaned); err == nil {
+		return raw, nil
+	}
+	return base64.RawURLEncoding.DecodeString(cleaned)
+}
+
+// serverPayload extracts the binary server handshake from an HTTP response,
+// its JSON body, or a plain dump.
+func serverPayload(input []byte) ([]byte, error) {
+	if i := bytes.Index(input, []byte("\r\n\r\n")); i >= 0 {
+		input = input[i+4:]
+	}
+	trimmed := bytes.TrimSpace(input)
+	if len(trimmed) > 0 && trimmed[0] == '{' {
+		var envelope struct {
+			Data string `json:"data"`
+		}
+		if err := json.Unmarshal(trimmed, &envelope); err != nil {
+			return nil, err
+		}
+		return base64.StdEncoding.DecodeString(envelope.Data)
+	}
+	return decodeDump(trimmed)
+}
+
+func printClientHandshake(raw []byte) {
+	hasMagic := len(raw) >= 4 && binary.BigEndian.Uint32(raw[:4]) == encoding.ReflexMagic
+	hs, err := encoding.ParseClientHandshake(raw)
+	if err != nil {
+		base.Fatalf("malformed client handshake: %s", err)
+	}
+	fmt.Printf("Client handshake (%d bytes, magic: %v)\n", len(raw), hasMagic)
+	fmt.Printf("  PublicKey: %x\n", hs.PublicKey)
+	if hs.Versions != 0 {
+		fmt.Printf("  UserToken: %x\n", hs.UserID)
+	} else if id, err := uuid.ParseBytes(hs.UserID[:]); err == nil {
+		fmt.Printf("  UserID:    %x (%s)\n", hs.UserID, id.String())
+	} else {
+		fmt.Printf("  UserID:    %x\n", hs.UserID)
+	}
+	ts := time.Unix(hs.Timestamp, 0)
+	fmt.Printf("  Timestamp: %d (%s, skew %s)\n", hs.Timestamp, ts.UTC().Format(time.RFC3339), time.Since(ts).Round(time.Second))
+	fmt.Printf("  Nonce:     %x\n", hs.Nonce)
+	if hs.Versions != 0 {
+		fmt.Printf("  Versions:  %#02x\n", hs.Versions)
+	}
+	fmt.Printf("  PolicyReq: %d bytes %q\n", len(hs.PolicyReq), hs.PolicyReq)
+	fmt.Printf("  Padding:   %d bytes\n", len(hs.Padding))
+}
+
+func printServerHandshake(raw []byte, key []byte) {
+	hs, err := encoding.ParseServerHandshake(raw)
+	if err != nil {
+		base.Fatalf("malformed server handshake: %s", err)
+	}
+	fmt.Printf("Server handshake (%d bytes)\n", len(raw))
+	fmt.Printf("  PublicKey:   %x\n", hs.PublicKey)
+	if hs.Version != 0 {
+		fmt.Printf("  Version:     %d\n", hs.Version)
+	}
+	fmt.Printf("  PolicyGrant: %d bytes\n", len(hs.PolicyGrant))
+	if key != nil {
+		if policy, err := encoding.DecryptPolicyGrant(key, hs.PolicyGrant); err != nil {
+			fmt.Printf("    (decrypt failed: %s)\n", err)
+		} else {
+			fmt.Printf("    Policy: %q\n", policy)
+		}
+	}
+	fmt.Printf("  Padding:     %d bytes\n", len(hs.Padding))
+}
+
+func frameTypeName(t uint8) string {
+	switch t {
+	case encoding.FrameTypeData:
+		return "DATA"
+	case encoding.FrameTypePadding:
+		return "PADDING"
+	case encoding.FrameTypeTiming:
+		return "TIMING"
+	case encoding.FrameTypeClose:
+		return "CLOSE"
+	case encoding.FrameTypePolicyUpdate:
+		return "POLICY_UPDATE"
+	case encoding.FrameTypeWindowUpdate:
+		return "WINDOW_UPDATE"
+	case encoding.FrameTypePing:
+		return "PING"
+	case encoding.FrameTypePolicyContinuation:
+		return "POLICY_CONTINUATION"
+	}
+	return fmt.Sprintf("UNKNOWN(0x%02x)", t)
+}
+
+// printFrames writes one line per frame of raw to w. Without a key only the
+// plain headers of versions before 3 can be split.
+func printFrames(w io.Writer, raw []byte, key []byte, version uint8, stream bool) {
+	var session *encoding.Session
+	if key != nil {
+		var err error
+		if session, err = encoding.NewSession(key); err != nil {
+			base.Fatalf("invalid key: %s", err)
+		}
+		session.SetProtocolVersion(version)
+		session.SetStreamMode(stream)
+	}
+	reader := bytes.NewReader(raw)
+	for i := 0; reader.Len() > 0; i++ {
+		offset := len(raw) - reader.Len()
+		if reader.Len() < 3 {
+			fmt.Fprintf(w, "#%d @%d: truncated header (%d bytes left)\n", i, offset, reader.Len())
+			return
+		}
+		if session == nil {
+			length := binary.BigEndian.Uint16(raw[offset : offset+2])
+			fmt.Fprintf(w, "#%d @%d: %s length=%d\n", i, offset, frameTypeName(raw[offset+2]), length)
+			if int(length)+3 > reader.Len() {
+				fmt.Fprintf(w, "  truncated payload (%d bytes left)\n", reader.Len()-3)
+				return
+			}
+			reader.Seek(int64(length)+3, io.SeekCurrent)
+			continue
+		}
+		frame, err := session.ReadFrame(reader)
+		if err != nil {
+			fmt.Fprintf(w, "#%d @%d: decode failed: %s\n", i, offset, err)
+			return
+		}
+		fmt.Fprintf(w, "#%d @%d: %s length=%d\n", i, offset, frameTypeName(frame.Type), frame.Length)
+		fmt.Fprintf(w, "  payload: %d bytes %x\n", len(frame.Payload), frame.Payload)
+	}
+}
@@ -0,0 +1,170 @@
+package reflex
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestFrameTypeName(t *testing.T) {
+	for _, c := range []struct {
+		frameType uint8
+		name      string
+	}{
+		{encoding.FrameTypeData, "DATA"},
+		{encoding.FrameTypePadding, "PADDING"},
+		{encoding.FrameTypeTiming, "TIMING"},
+		{encoding.FrameTypeClose, "CLOSE"},
+		{encoding.FrameTypePolicyUpdate, "POLICY_UPDATE"},
+		{encoding.FrameTypeWindowUpdate, "WINDOW_UPDATE"},
+		{encoding.FrameTypePing, "PING"},
+		{encoding.FrameTypePolicyContinuation, "POLICY_CONTINUATION"},
+		{0x00, "UNKNOWN(0x00)"},
+		{0xab, "UNKNOWN(0xab)"},
+	} {
+		if got := frameTypeName(c.frameType); got != c.name {
+			t.Errorf("frameTypeName(%#02x) = %s; want %s", c.frameType, got, c.name)
+		}
+	}
+}
+
+func TestDecodeDump(t *testing.T) {
+	want := []byte{0xde, 0xad, 0xbe, 0xef, 0xfb}
+	for _, input := range []string{
+		"deadbeeffb",
+		"de:ad:be:ef:fb",
+		"de ad\tbe\r\nef fb\n",
+		"3q2+7/s=",
+		"3q2-7_s",
+	} {
+		got, err := decodeDump([]byte(input))
+		if err != nil {
+			t.Errorf("decodeDump(%q): %v", input, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("decodeDump(%q) = %x; want %x", input, got, want)
+		}
+	}
+	if _, err := decodeDump([]byte("not a dump!")); err == nil {
+		t.Error("decodeDump accepted garbage")
+	}
+}
+
+func TestServerPayload(t *testing.T) {
+	want := []byte{1, 2, 3, 4}
+	for _, input := range []string{
+		"01020304",
+		`{"data":"AQIDBA=="}`,
+		"HTTP/1.1 200 OK\r\nContent-Type: application/json\r\n\r\n{\"data\":\"AQIDBA==\"}\r\n",
+		"HTTP/1.1 200 OK\r\n\r\n01020304",
+	} {
+		got, err := serverPayload([]byte(input))
+		if err != nil {
+			t.Errorf("serverPayload(%q): %v", input, err)
+		} else if !bytes.Equal(got, want) {
+			t.Errorf("serverPayload(%q) = %x; want %x", input, got, want)
+		}
+	}
+	if _, err := serverPayload([]byte(`{"data":`)); err == nil {
+		t.Error("serverPayload accepted truncated JSON")
+	}
+}
+
+func TestPrintFrames(t *testing.T) {
+	key := bytes.Repeat([]byte{7}, 32)
+	stream := func(version uint8, streamMode bool) []byte {
+		session, err := encoding.NewSession(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.SetProtocolVersion(version)
+		session.SetStreamMode(streamMode)
+		var buf bytes.Buffer
+		for _, f := range []struct {
+			frameType uint8
+			data      []byte
+		}{
+			{encoding.FrameTypeData, []byte("hello")},
+			{encoding.FrameTypePing, make([]byte, 8)},
+			{encoding.FrameTypeClose, nil},
+		} {
+			if err := session.WriteFrame(&buf, f.frameType, f.data); err != nil {
+				t.Fatal(err)
+			}
+		}
+		return buf.Bytes()
+	}
+	plain := stream(encoding.ProtocolVersion2, false)
+	sealed := stream(encoding.ProtocolVersion5, true)
+
+	for _, c := range []struct {
+		name     string
+		raw      []byte
+		key      []byte
+		version  uint8
+		stream   bool
+		contains []string
+		excludes []string
+	}{
+		{
+			name:     "plain headers without key",
+			raw:      plain,
+			contains: []string{"#0 @0: DATA", "#1 @", ": PING", "#2 @", ": CLOSE"},
+			excludes: []string{"payload:", "truncated"},
+		},
+		{
+			name:     "plain headers with key",
+			raw:      plain,
+			key:      key,
+			version:  encoding.ProtocolVersion2,
+			contains: []string{"#0 @0: DATA", "payload: 5 bytes 68656c6c6f", ": PING", "payload: 8 bytes", ": CLOSE", "payload: 0 bytes"},
+		},
+		{
+			name:     "sealed stream with key",
+			raw:      sealed,
+			key:      key,
+			version:  encoding.ProtocolVersion5,
+			stream:   true,
+			contains: []string{"#0 @0: DATA", "payload: 5 bytes 68656c6c6f", ": PING", "payload: 8 bytes", ": CLOSE", "payload: 0 bytes"},
+			excludes: []string{"decode failed"},
+		},
+		{
+			name:     "sealed stream without stream mode",
+			raw:      sealed,
+			key:      key,
+			version:  encoding.ProtocolVersion5,
+			contains: []string{"#0 @0: decode failed"},
+		},
+		{
+			name:     "wrong key",
+			raw:      plain,
+			key:      bytes.Repeat([]byte{8}, 32),
+			version:  encoding.ProtocolVersion2,
+			contains: []string{"#0 @0: decode failed"},
+		},
+		{
+			name:     "truncated header",
+			raw:      plain[:2],
+			contains: []string{"#0 @0: truncated header (2 bytes left)"},
+		},
+		{
+			name:     "truncated payload",
+			raw:      plain[:6],
+			contains: []string{"#0 @0: DATA", "truncated payload (3 bytes left)"},
+		},
+	} {
+		var out bytes.Buffer
+		printFrames(&out, c.raw, c.key, c.version, c.stream)
+		for _, s := range c.contains {
+			if !strings.Contains(out.String(), s) {
+				t.Errorf("%s: output lacks %q:\n%s", c.name, s, out.String())
+			}
+		}
+		for _, s := range c.excludes {
+			if strings.Contains(out.String(), s) {
+				t.Errorf("%s: output has %q:\n%s", c.name, s, out.String())
+			}
+		}
+	}
+}
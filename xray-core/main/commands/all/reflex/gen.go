@@ -0,0 +1,97 @@
+package reflex
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+var cmdGen = &base.Command{
+	UsageLine: `{{.Exec}} reflex gen [-psk] [-identity] [-std-encoding]`,
+	Short:     `Generate a Reflex user ID and keys`,
+	Long: `
+Generate a fresh Reflex user ID, printed both as a UUID and base64, with the
+JSON snippets that add it to a server's clients and a client's outbound.
+
+Arguments:
+
+	-psk
+		Also generate a random 32-byte pre-shared key, set as psk on both
+		sides.
+
+	-identity
+		Also generate an Ed25519 server identity key pair. The private key
+		stays on the server as identityKey; clients pin the public key as
+		serverIdentity.
+
+	-std-encoding
+		Print keys in standard base64 instead of base64.RawURLEncoding.
+
+Example:
+
+	{{.Exec}} reflex gen -identity
+`,
+}
+
+func init() {
+	cmdGen.Run = executeGen // break init loop
+}
+
+var (
+	genPSK         = cmdGen.Flag.Bool("psk", false, "")
+	genIdentity    = cmdGen.Flag.Bool("identity", false, "")
+	genStdEncoding = cmdGen.Flag.Bool("std-encoding", false, "")
+)
+
+func executeGen(cmd *base.Command, args []string) {
+	encoding := base64.RawURLEncoding
+	if *genStdEncoding {
+		encoding = base64.StdEncoding
+	}
+	writeGen(os.Stdout, encoding, *genPSK, *genIdentity)
+}
+
+// writeGen writes a fresh user ID, the requested keys and the settings
+// snippets using them to w.
+func writeGen(w io.Writer, encoding *base64.Encoding, psk, identity bool) {
+	id := uuid.New()
+	fmt.Fprintf(w, "UUID: %s\nUUID (base64): %s\n", id.String(), encoding.EncodeToString(id.Bytes()))
+	serverSettings := map[string]any{
+		"clients": []map[string]string{{"id": id.String()}},
+	}
+	clientSettings := map[string]any{
+		"address": "example.com",
+		"port":    443,
+		"id":      id.String(),
+	}
+	if psk {
+		key := make([]byte, 32)
+		if _, err := rand.Read(key); err != nil {
+			base.Fatalf("failed to generate PSK: %s", err)
+		}
+		fmt.Fprintf(w, "PSK: %s\n", encoding.EncodeToString(key))
+		serverSettings["psk"] = encoding.EncodeToString(key)
+		clientSettings["psk"] = encoding.EncodeToString(key)
+	}
+	if identity {
+		public, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			base.Fatalf("failed to generate identity key: %s", err)
+		}
+		fmt.Fprintf(w, "IdentityPrivateKey: %s\nIdentityPublicKey: %s\n",
+			encoding.EncodeToString(private.Seed()), encoding.EncodeToString(public))
+		serverSettings["identityKey"] = encoding.EncodeToString(private.Seed())
+		clientSettings["serverIdentity"] = encoding.EncodeToString(public)
+	}
+
+	server, _ := json.MarshalIndent(serverSettings, "", "  ")
+	client, _ := json.MarshalIndent(clientSettings, "", "  ")
+	fmt.Fprintf(w, "\nInbound settings:\n%s\n\nOutbound settings:\n%s\n", server, client)
+}
@@ -0,0 +1,78 @@
+package reflex
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/infra/conf"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+func TestGenOutputBuilds(t *testing.T) {
+	for _, encoding := range []*base64.Encoding{base64.RawURLEncoding, base64.StdEncoding} {
+		var out bytes.Buffer
+		writeGen(&out, encoding, true, true)
+		lines := map[string]string{}
+		for _, line := range strings.Split(out.String(), "\n") {
+			if k, v, ok := strings.Cut(line, ": "); ok {
+				lines[k] = v
+			}
+		}
+		psk, err := encoding.DecodeString(lines["PSK"])
+		if err != nil || lines["PSK"] == "" {
+			t.Fatalf("PSK %q is not in the requested encoding", lines["PSK"])
+		}
+		_, settings, ok := strings.Cut(out.String(), "Inbound settings:\n")
+		if !ok {
+			t.Fatalf("no inbound settings in:\n%s", out.String())
+		}
+		inbound, outbound, ok := strings.Cut(settings, "Outbound settings:\n")
+		if !ok {
+			t.Fatalf("no outbound settings in:\n%s", out.String())
+		}
+
+		var in conf.ReflexInboundConfig
+		if err := json.Unmarshal([]byte(inbound), &in); err != nil {
+			t.Fatalf("inbound settings: %v", err)
+		}
+		built, err := in.Build()
+		if err != nil {
+			t.Fatalf("inbound settings: %v", err)
+		}
+		server := built.(*reflex.InboundConfig)
+		if got := server.GetClients()[0].GetId(); got != lines["UUID"] {
+			t.Errorf("inbound user %s; want %s", got, lines["UUID"])
+		}
+		seed, _ := encoding.DecodeString(lines["IdentityPrivateKey"])
+		if !bytes.Equal(server.GetIdentityKey(), seed) {
+			t.Errorf("inbound identity key %x; want %x", server.GetIdentityKey(), seed)
+		}
+		if !bytes.Equal(server.GetPsk(), psk) {
+			t.Errorf("inbound psk %x; want %x", server.GetPsk(), psk)
+		}
+
+		var o conf.ReflexOutboundConfig
+		if err := json.Unmarshal([]byte(outbound), &o); err != nil {
+			t.Fatalf("outbound settings: %v", err)
+		}
+		built, err = o.Build()
+		if err != nil {
+			t.Fatalf("outbound settings: %v", err)
+		}
+		client := built.(*reflex.OutboundConfig)
+		if client.GetId() != lines["UUID"] {
+			t.Errorf("outbound user %s; want %s", client.GetId(), lines["UUID"])
+		}
+		public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+		if !bytes.Equal(client.GetServerIdentity(), public) {
+			t.Errorf("outbound server identity %x; want %x", client.GetServerIdentity(), public)
+		}
+		if !bytes.Equal(client.GetPsk(), psk) {
+			t.Errorf("outbound psk %x; want %x", client.GetPsk(), psk)
+		}
+	}
+}
@@ -0,0 +1,163 @@
+package reflex
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/main/commands/base"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/proxy/reflex/pcap"
+)
+
+var cmdProfile = &base.Command{
+	UsageLine: `{{.Exec}} reflex profile [-name <name>] -pcap <file> [-flow <index>] [-model independent|markov|trace] [-o <file>] [-score <profile.json> [-metric ks|chi2|js|ad]]`,
+	Short:     `Generate a traffic profile from a pcap capture`,
+	Long: `
+Generate a Reflex traffic profile from a classic pcap capture. Payload sizes
+and inter-arrival delays of one flow direction are turned into a profile JSON
+that can be dropped into the inbound's profileDir.
+
+Arguments:
+
+	-pcap <file>
+		Capture to read. pcapng is not supported; convert it with
+		"editcap -F pcap" first.
+
+	-name <name>
+		Profile name. Default: the capture file name.
+
+	-flow <index>
+		Flow to use, as numbered by -list. Default: 0, the flow that
+		carried the most payload bytes.
+
+	-model independent|markov|trace
+		Sampling model. markov also records which size and delay
+		followed which, preserving the capture's autocorrelation.
+		trace records the flow itself, which sessions then replay
+		packet by packet, for measuring against a reference flow.
+		Default: independent.
+
+	-list
+		List the flows found in the capture and exit.
+
+	-o <file>
+		Write the profile to file instead of stdout.
+
+	-score <profile.json>
+		Instead of generating a profile, report how closely an existing
+		profile matches the flow's sizes and delays.
+
+	-metric ks|chi2|js|ad
+		Distance used by -score: Kolmogorov-Smirnov, chi-square,
+		Jensen-Shannon or Anderson-Darling. Default: ks.
+
+Example:
+
+	{{.Exec}} reflex profile -pcap capture.pcap -name meet -o profiles/meet.json
+`,
+}
+
+func init() {
+	cmdProfile.Run = executeProfile // break init loop
+}
+
+var (
+	profilePcap   = cmdProfile.Flag.String("pcap", "", "")
+	profileName   = cmdProfile.Flag.String("name", "", "")
+	profileFlow   = cmdProfile.Flag.Int("flow", 0, "")
+	profileList   = cmdProfile.Flag.Bool("list", false, "")
+	profileModel  = cmdProfile.Flag.String("model", "independent", "")
+	profileScore  = cmdProfile.Flag.String("score", "", "")
+	profileMetric = cmdProfile.Flag.String("metric", "ks", "")
+	profileOut    = cmdProfile.Flag.String("o", "", "")
+)
+
+func executeProfile(cmd *base.Command, args []string) {
+	if *profilePcap == "" {
+		base.Fatalf("-pcap is required")
+	}
+	f, err := os.Open(*profilePcap)
+	if err != nil {
+		base.Fatalf("failed to open capture: %s", err)
+	}
+	packets, err := pcap.ReadPackets(f)
+	f.Close()
+	if err != nil {
+		base.Fatalf("failed to parse capture: %s", err)
+	}
+
+	flows := pcap.Flows(packets)
+	if *profileList {
+		for i, s := range flows {
+			fmt.Printf("%d: %s packets=%d bytes=%d\n", i, s.Flow, s.Packets, s.Bytes)
+		}
+		return
+	}
+	if *profileFlow < 0 || *profileFlow >= len(flows) {
+		base.Fatalf("flow %d not found, capture has %d flows with payload", *profileFlow, len(flows))
+	}
+
+	name := *profileName
+	if name == "" {
+		file := filepath.Base(*profilePcap)
+		name = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	sizes, delays := pcap.Observations(packets, flows[*profileFlow].Flow)
+	if *profileScore != "" {
+		scoreProfile(sizes, delays)
+		return
+	}
+	var profile *encoding.TrafficProfile
+	switch *profileModel {
+	case "independent":
+		profile, err = encoding.CreateProfileFromObservations(name, sizes, delays)
+	case "markov":
+		profile, err = encoding.CreateMarkovProfileFromObservations(name, sizes, delays)
+	case "trace":
+		profile, err = encoding.CreateTraceProfileFromObservations(name, sizes, delays)
+	default:
+		base.Fatalf("unknown model: %s", *profileModel)
+	}
+	if err != nil {
+		base.Fatalf("failed to build profile: %s", err)
+	}
+	out, err := encoding.MarshalProfileJSON(profile)
+	if err != nil {
+		base.Fatalf("failed to encode profile: %s", err)
+	}
+	if *profileOut == "" {
+		fmt.Println(string(out))
+		return
+	}
+	if err := os.WriteFile(*profileOut, append(out, '\n'), 0o644); err != nil {
+		base.Fatalf("failed to write profile: %s", err)
+	}
+}
+
+func scoreProfile(sizes []int, delays []time.Duration) {
+	metric, err := encoding.ParseDistanceMetric(*profileMetric)
+	if err != nil {
+		base.Fatalf("%s", err)
+	}
+	data, err := os.ReadFile(*profileScore)
+	if err != nil {
+		base.Fatalf("failed to read profile: %s", err)
+	}
+	profile, err := encoding.ParseProfileJSON(data)
+	if err != nil {
+		base.Fatalf("invalid profile: %s", err)
+	}
+	observedSizes := make([]float64, len(sizes))
+	for i, v := range sizes {
+		observedSizes[i] = float64(v)
+	}
+	observedDelays := make([]float64, len(delays))
+	for i, v := range delays {
+		observedDelays[i] = float64(v) / float64(time.Millisecond)
+	}
+	sizeDistance, delayDistance := encoding.ScoreProfile(profile, observedSizes, observedDelays, metric)
+	fmt.Printf("%s vs %d packets (%s): sizes=%.4f delays=%.4f\n", profile.Name, len(sizes), *profileMetric, sizeDistance, delayDistance)
+}
@@ -0,0 +1,21 @@
+package reflex
+
+import (
+	"github.com/xtls/xray-core/main/commands/base"
+)
+
+// CmdReflex holds all reflex sub commands
+var CmdReflex = &base.Command{
+	UsageLine: "{{.Exec}} reflex",
+	Short:     "Reflex protocol tools",
+	Long: `{{.Exec}} {{.LongName}} provides tools for the Reflex protocol.
+`,
+	Commands: []*base.Command{
+		cmdDecode,
+		cmdProfile,
+		cmdClient,
+		cmdCheck,
+		cmdGen,
+		cmdAnalyze,
+	},
+}
@@ -0,0 +1,114 @@
+package reflex
+
+import (
+	"net"
+	"time"
+
+	"google.golang.org/protobuf/proto"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/uuid"
+)
+
+// AsAccount implements protocol.AsAccount.
+func (a *Account) AsAccount() (protocol.Account, error) {
+	if _, err := uuid.ParseString(a.GetId()); err != nil {
+		return nil, errors.New("invalid reflex user id ", a.GetId()).Base(err)
+	}
+	sources, err := newSourceFilter(a.GetAllowedSources(), a.GetDeniedSources())
+	if err != nil {
+		return nil, err
+	}
+	account := &MemoryAccount{
+		ID:              a.GetId(),
+		Policy:          a.GetPolicy(),
+		UplinkPolicy:    a.GetUplinkPolicy(),
+		DownlinkPolicy:  a.GetDownlinkPolicy(),
+		AllowedPolicies: a.GetAllowedPolicies(),
+		Fallback:        a.GetFallback(),
+		RateLimit:       a.GetRateLimit(),
+		Quota:           a.GetQuota(),
+		AllowedSources:  a.GetAllowedSources(),
+		DeniedSources:   a.GetDeniedSources(),
+		sources:         sources,
+	}
+	if at := a.GetExpiresAt(); at != 0 {
+		account.ExpiresAt = time.Unix(at, 0)
+	}
+	return account, nil
+}
+
+// Account returns the account of a configured user.
+func (u *User) Account() *Account {
+	return &Account{
+		Id:              u.GetId(),
+		Policy:          u.GetPolicy(),
+		UplinkPolicy:    u.GetUplinkPolicy(),
+		DownlinkPolicy:  u.GetDownlinkPolicy(),
+		AllowedPolicies: u.GetAllowedPolicies(),
+		RateLimit:       u.GetRateLimit(),
+		Fallback:        u.GetFallback(),
+		AllowedSources:  u.GetAllowedSources(),
+		DeniedSources:   u.GetDeniedSources(),
+		ExpiresAt:       u.GetExpiresAt(),
+		Quota:           u.GetQuota(),
+	}
+}
+
+// MemoryAccount is the in-memory Reflex user account.
+type MemoryAccount struct {
+	ID              string
+	Policy          string
+	UplinkPolicy    string
+	DownlinkPolicy  string
+	AllowedPolicies []string
+	Fallback        *Fallback
+	RateLimit       *RateLimit
+	// ExpiresAt, if set, is when the user's handshakes start being refused
+	// and their sessions end.
+	ExpiresAt time.Time
+	// Quota caps the payload bytes of an accounting period; 0 is unlimited.
+	Quota uint64
+	// AllowedSources and DeniedSources limit where the user may connect
+	// from; see Admits.
+	AllowedSources []string
+	DeniedSources  []string
+
+	sources *sourceFilter
+}
+
+// Admits reports whether the user may connect from ip, which is nil when
+// the source is not known.
+func (a *MemoryAccount) Admits(ip net.IP) bool {
+	return a.sources.admits(ip)
+}
+
+// Equals implements protocol.Account.
+func (a *MemoryAccount) Equals(account protocol.Account) bool {
+	other, ok := account.(*MemoryAccount)
+	if !ok {
+		return false
+	}
+	return a.ID == other.ID
+}
+
+// ToProto implements protocol.Account.
+func (a *MemoryAccount) ToProto() proto.Message {
+	account := &Account{
+		Id:              a.ID,
+		Policy:          a.Policy,
+		UplinkPolicy:    a.UplinkPolicy,
+		DownlinkPolicy:  a.DownlinkPolicy,
+		AllowedPolicies: a.AllowedPolicies,
+		RateLimit:       a.RateLimit,
+		Fallback:        a.Fallback,
+		AllowedSources:  a.AllowedSources,
+		DeniedSources:   a.DeniedSources,
+		Quota:           a.Quota,
+	}
+	if !a.ExpiresAt.IsZero() {
+		account.ExpiresAt = a.ExpiresAt.Unix()
+	}
+	return account
+}
@@ -0,0 +1,44 @@
+package reflex
+
+import (
+	"net"
+	"testing"
+
+	"google.golang.org/protobuf/proto"
+)
+
+func TestAccountRoundTrip(t *testing.T) {
+	a := &Account{
+		Id:              "b831381d-6324-4d53-ad4f-8cda48b30811",
+		Policy:          "zoom",
+		UplinkPolicy:    "zoom-up",
+		DownlinkPolicy:  "zoom-down",
+		AllowedPolicies: []string{"youtube"},
+		RateLimit:       &RateLimit{Uplink: 1000},
+		Fallback:        &Fallback{Dest: 8080},
+		AllowedSources:  []string{"192.0.2.0/24"},
+		DeniedSources:   []string{"192.0.2.66"},
+		ExpiresAt:       1900000000,
+		Quota:           1 << 30,
+	}
+	account, err := a.AsAccount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := account.ToProto(); !proto.Equal(got, a) {
+		t.Fatalf("account round-tripped as %v", got)
+	}
+	m := account.(*MemoryAccount)
+	if !m.Admits(net.ParseIP("192.0.2.1")) || m.Admits(net.ParseIP("192.0.2.66")) {
+		t.Fatal("account sources not applied")
+	}
+
+	u := &User{Id: a.Id, Email: "u", Policy: "zoom", Quota: 5, AllowedSources: []string{"198.51.100.0/24"}}
+	if got := u.Account(); got.GetId() != u.Id || got.GetQuota() != 5 || got.GetAllowedSources()[0] != "198.51.100.0/24" {
+		t.Fatalf("user account %v", got)
+	}
+
+	if _, err := (&Account{Id: a.Id, DeniedSources: []string{"bogus"}}).AsAccount(); err == nil {
+		t.Fatal("invalid source list accepted")
+	}
+}
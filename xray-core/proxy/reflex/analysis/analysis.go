@@ -0,0 +1,173 @@
+// Package analysis compares a captured Reflex session with a capture of the
+// application it imitates, reporting how far apart a classifier could find
+// them. Operators run it to validate their traffic profiles.
+package analysis
+
+import (
+	"io"
+	"math"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/proxy/reflex/pcap"
+)
+
+// burstGap splits a trace into bursts, as when profiles are built from
+// captures: any delay at least this long is an idle gap.
+const burstGap = 100 * time.Millisecond
+
+// Trace is one direction of a flow: its payload sizes in order and the
+// delays between them.
+type Trace struct {
+	Sizes  []int
+	Delays []time.Duration
+}
+
+// ReadTrace reads a classic pcap capture and returns the trace of its flow
+// at index, flows being numbered busiest first as by "xray reflex profile".
+func ReadTrace(r io.Reader, index int) (Trace, error) {
+	packets, err := pcap.ReadPackets(r)
+	if err != nil {
+		return Trace{}, err
+	}
+	flows := pcap.Flows(packets)
+	if index < 0 || index >= len(flows) {
+		return Trace{}, errors.New("flow ", index, " not found, capture has ", len(flows), " flows with payload")
+	}
+	sizes, delays := pcap.Observations(packets, flows[index].Flow)
+	return Trace{Sizes: sizes, Delays: delays}, nil
+}
+
+// Report is the outcome of Compare. Distances are 0 for identical samples;
+// KS and JS distances are at most 1.
+type Report struct {
+	SizeKS  float64 `json:"sizeKS"`
+	DelayKS float64 `json:"delayKS"`
+	SizeJS  float64 `json:"sizeJS"`
+	DelayJS float64 `json:"delayJS"`
+	// BurstLengthKS and BurstGapKS compare the packets per burst and the
+	// idle gaps between bursts.
+	BurstLengthKS float64 `json:"burstLengthKS"`
+	BurstGapKS    float64 `json:"burstGapKS"`
+	Reflex        Summary `json:"reflex"`
+	Target        Summary `json:"target"`
+}
+
+// Summary describes one trace.
+type Summary struct {
+	Packets int `json:"packets"`
+	Bursts  int `json:"bursts"`
+	// MeanBurstLength is in packets, MeanBurstGapMs in milliseconds.
+	MeanBurstLength float64 `json:"meanBurstLength"`
+	MeanBurstGapMs  float64 `json:"meanBurstGapMs"`
+	// SizeEntropy and DelayEntropy are the Shannon entropy, in bits, of
+	// the sizes and of the delays rounded to the millisecond. A shaper
+	// drawing from a few buckets shows as lower entropy than the target.
+	SizeEntropy  float64 `json:"sizeEntropy"`
+	DelayEntropy float64 `json:"delayEntropy"`
+}
+
+// Compare computes the report for a Reflex trace against a target trace.
+func Compare(reflex, target Trace) (*Report, error) {
+	if len(reflex.Sizes) < 2 || len(target.Sizes) < 2 {
+		return nil, errors.New("traces need at least two packets")
+	}
+	rs, rd := reflex.samples()
+	ts, td := target.samples()
+	rl, rg := reflex.bursts()
+	tl, tg := target.bursts()
+	return &Report{
+		SizeKS:        encoding.KolmogorovSmirnovStatistic(rs, ts),
+		DelayKS:       encoding.KolmogorovSmirnovStatistic(rd, td),
+		SizeJS:        encoding.JensenShannonDivergence(rs, ts),
+		DelayJS:       encoding.JensenShannonDivergence(rd, td),
+		BurstLengthKS: encoding.KolmogorovSmirnovStatistic(rl, tl),
+		BurstGapKS:    gapDistance(rg, tg),
+		Reflex:        reflex.summary(),
+		Target:        target.summary(),
+	}, nil
+}
+
+// samples returns the sizes and the delays in milliseconds as floats.
+func (t Trace) samples() (sizes, delaysMs []float64) {
+	sizes = make([]float64, len(t.Sizes))
+	for i, s := range t.Sizes {
+		sizes[i] = float64(s)
+	}
+	delaysMs = make([]float64, len(t.Delays))
+	for i, d := range t.Delays {
+		delaysMs[i] = float64(d) / float64(time.Millisecond)
+	}
+	return sizes, delaysMs
+}
+
+// bursts returns the length in packets of every burst and the gaps between
+// them in milliseconds.
+func (t Trace) bursts() (lengths, gapsMs []float64) {
+	packets := 1
+	for _, d := range t.Delays {
+		if d < burstGap {
+			packets++
+			continue
+		}
+		lengths = append(lengths, float64(packets))
+		gapsMs = append(gapsMs, float64(d)/float64(time.Millisecond))
+		packets = 1
+	}
+	return append(lengths, float64(packets)), gapsMs
+}
+
+func (t Trace) summary() Summary {
+	lengths, gaps := t.bursts()
+	delays := make([]int64, len(t.Delays))
+	for i, d := range t.Delays {
+		delays[i] = d.Round(time.Millisecond).Milliseconds()
+	}
+	sizes := make([]int64, len(t.Sizes))
+	for i, s := range t.Sizes {
+		sizes[i] = int64(s)
+	}
+	return Summary{
+		Packets:         len(t.Sizes),
+		Bursts:          len(lengths),
+		MeanBurstLength: mean(lengths),
+		MeanBurstGapMs:  mean(gaps),
+		SizeEntropy:     entropy(sizes),
+		DelayEntropy:    entropy(delays),
+	}
+}
+
+// gapDistance is the KS distance of burst gaps, 0 when neither trace pauses
+// and 1 when only one does.
+func gapDistance(a, b []float64) float64 {
+	if len(a) == 0 && len(b) == 0 {
+		return 0
+	}
+	return encoding.KolmogorovSmirnovStatistic(a, b)
+}
+
+func mean(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	var sum float64
+	for _, v := range values {
+		sum += v
+	}
+	return sum / float64(len(values))
+}
+
+// entropy is the Shannon entropy of values in bits.
+func entropy(values []int64) float64 {
+	counts := make(map[int64]int)
+	for _, v := range values {
+		counts[v]++
+	}
+	var h float64
+	for _, c := range counts {
+		p := float64(c) / float64(len(values))
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,43 @@
+package analysis
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompareSeparatesDifferentTraces(t *testing.T) {
+	ms := time.Millisecond
+	target := Trace{
+		Sizes:  []int{1400, 1400, 600, 1400, 1400, 600},
+		Delays: []time.Duration{2 * ms, 3 * ms, 500 * ms, 2 * ms, 3 * ms},
+	}
+	same, err := Compare(target, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if same.SizeKS != 0 || same.DelayKS != 0 || same.BurstLengthKS != 0 || same.BurstGapKS != 0 {
+		t.Fatalf("identical traces reported apart: %+v", same)
+	}
+	if s := same.Target; s.Bursts != 2 || s.MeanBurstLength != 3 || s.MeanBurstGapMs != 500 {
+		t.Fatalf("unexpected burst summary: %+v", s)
+	}
+
+	steady := Trace{
+		Sizes:  []int{100, 100, 100, 100, 100, 100},
+		Delays: []time.Duration{ms, ms, ms, ms, ms},
+	}
+	apart, err := Compare(steady, target)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if apart.SizeKS != 1 || apart.DelayKS != 1 || apart.BurstGapKS != 1 {
+		t.Fatalf("disjoint traces not reported apart: %+v", apart)
+	}
+	if apart.Reflex.SizeEntropy != 0 || apart.Target.SizeEntropy <= 0 {
+		t.Fatalf("unexpected entropies: %+v, %+v", apart.Reflex, apart.Target)
+	}
+
+	if _, err := Compare(Trace{Sizes: []int{1}}, target); err == nil {
+		t.Fatal("one-packet trace accepted")
+	}
+}
@@ -0,0 +1,173 @@
+// Package command implements the Reflex API service, which lets operators
+// inspect, terminate and re-profile individual live sessions and read or
+// reset per-user traffic totals.
+package command
+
+import (
+	"context"
+	"time"
+
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/inbound"
+	"github.com/xtls/xray-core/proxy"
+	"github.com/xtls/xray-core/proxy/reflex"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// reflexServer is an implementation of ReflexService.
+type reflexServer struct {
+	inboundManager inbound.Manager
+}
+
+// NewReflexServer returns a ReflexService backed by the inbounds of m.
+func NewReflexServer(m inbound.Manager) ReflexServiceServer {
+	return &reflexServer{inboundManager: m}
+}
+
+// taggedController is a Reflex inbound and its tag.
+type taggedController struct {
+	tag        string
+	controller reflex.SessionController
+}
+
+// controllers returns the Reflex inbound with tag, or every Reflex inbound
+// if tag is empty.
+func (s *reflexServer) controllers(ctx context.Context, tag string) ([]taggedController, error) {
+	var handlers []inbound.Handler
+	if tag == "" {
+		handlers = s.inboundManager.ListHandlers(ctx)
+	} else {
+		h, err := s.inboundManager.GetHandler(ctx, tag)
+		if err != nil {
+			return nil, status.Error(codes.NotFound, err.Error())
+		}
+		handlers = []inbound.Handler{h}
+	}
+	var controllers []taggedController
+	for _, h := range handlers {
+		gi, ok := h.(proxy.GetInbound)
+		if !ok {
+			continue
+		}
+		if sc, ok := gi.GetInbound().(reflex.SessionController); ok {
+			controllers = append(controllers, taggedController{tag: h.Tag(), controller: sc})
+		}
+	}
+	if tag != "" && len(controllers) == 0 {
+		return nil, status.Error(codes.InvalidArgument, tag+" is not a reflex inbound")
+	}
+	return controllers, nil
+}
+
+func (s *reflexServer) ListSessions(ctx context.Context, request *ListSessionsRequest) (*ListSessionsResponse, error) {
+	controllers, err := s.controllers(ctx, request.Tag)
+	if err != nil {
+		return nil, err
+	}
+	response := &ListSessionsResponse{}
+	for _, tc := range controllers {
+		for _, info := range tc.controller.Sessions(request.Email) {
+			response.Sessions = append(response.Sessions, &SessionInfo{
+				Id:              info.ID,
+				Tag:             tc.tag,
+				Email:           info.Email,
+				Source:          info.Source,
+				Uptime:          uint32(time.Since(info.Started).Seconds()),
+				BytesSent:       info.BytesSent,
+				BytesReceived:   info.BytesReceived,
+				UplinkPolicy:    info.UplinkPolicy,
+				DownlinkPolicy:  info.DownlinkPolicy,
+				SizeDistance:    info.SizeDistance,
+				RttMs:           uint32(info.RTT.Milliseconds()),
+				Replays:         info.Replays,
+				PaddingOverhead: info.PaddingOverhead,
+				AddedDelayMs:    float64(info.AddedDelay) / float64(time.Millisecond),
+			})
+		}
+	}
+	return response, nil
+}
+
+func (s *reflexServer) CloseSession(ctx context.Context, request *CloseSessionRequest) (*CloseSessionResponse, error) {
+	controllers, err := s.controllers(ctx, request.Tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, tc := range controllers {
+		if tc.controller.CloseSession(request.Id) {
+			return &CloseSessionResponse{}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no live reflex session %d", request.Id)
+}
+
+func (s *reflexServer) UpdateSession(ctx context.Context, request *UpdateSessionRequest) (*UpdateSessionResponse, error) {
+	if request.UplinkPolicy == "" && request.DownlinkPolicy == "" {
+		return nil, status.Error(codes.InvalidArgument, "no policy to update")
+	}
+	controllers, err := s.controllers(ctx, request.Tag)
+	if err != nil {
+		return nil, err
+	}
+	for _, tc := range controllers {
+		found, err := tc.controller.UpdateSession(ctx, request.Id, request.UplinkPolicy, request.DownlinkPolicy)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		if found {
+			return &UpdateSessionResponse{}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "no live reflex session %d", request.Id)
+}
+
+func (s *reflexServer) GetTraffic(ctx context.Context, request *GetTrafficRequest) (*GetTrafficResponse, error) {
+	controllers, err := s.controllers(ctx, request.Tag)
+	if err != nil {
+		return nil, err
+	}
+	response := &GetTrafficResponse{}
+	for _, tc := range controllers {
+		accountant, ok := tc.controller.(reflex.TrafficAccountant)
+		if !ok {
+			continue
+		}
+		traffic := accountant.Traffic
+		if request.Reset_ {
+			traffic = accountant.ResetTraffic
+		}
+		for _, t := range traffic(request.Email) {
+			response.Users = append(response.Users, &UserTraffic{
+				Tag:      tc.tag,
+				Email:    t.Email,
+				Uplink:   t.Uplink,
+				Downlink: t.Downlink,
+				Since:    t.Since.Unix(),
+			})
+		}
+	}
+	return response, nil
+}
+
+func (s *reflexServer) mustEmbedUnimplementedReflexServiceServer() {}
+
+type service struct {
+	inboundManager inbound.Manager
+}
+
+func (s *service) Register(server *grpc.Server) {
+	RegisterReflexServiceServer(server, NewReflexServer(s.inboundManager))
+}
+
+func init() {
+	common.Must(common.RegisterConfig((*Config)(nil), func(ctx context.Context, cfg interface{}) (interface{}, error) {
+		s := new(service)
+		core.RequireFeatures(ctx, func(im inbound.Manager) {
+			s.inboundManager = im
+		})
+		return s, nil
+	}))
+}
@@ -0,0 +1,163 @@
+package command_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/features/inbound"
+	"github.com/xtls/xray-core/proxy"
+	"github.com/xtls/xray-core/proxy/reflex"
+	. "github.com/xtls/xray-core/proxy/reflex/command"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type fakeController struct {
+	proxy.Inbound
+	sessions []reflex.SessionInfo
+	closed   []uint32
+	resets   []string
+}
+
+func (c *fakeController) Sessions(email string) []reflex.SessionInfo {
+	var infos []reflex.SessionInfo
+	for _, info := range c.sessions {
+		if email == "" || info.Email == email {
+			infos = append(infos, info)
+		}
+	}
+	return infos
+}
+
+func (c *fakeController) live(id uint32) bool {
+	for _, info := range c.sessions {
+		if info.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *fakeController) CloseSession(id uint32) bool {
+	if !c.live(id) {
+		return false
+	}
+	c.closed = append(c.closed, id)
+	return true
+}
+
+func (c *fakeController) UpdateSession(ctx context.Context, id uint32, uplink, downlink string) (bool, error) {
+	if !c.live(id) {
+		return false, nil
+	}
+	if downlink == "bad" {
+		return true, errors.New("unknown reflex profile bad")
+	}
+	return true, nil
+}
+
+func (c *fakeController) Traffic(email string) []reflex.UserTraffic {
+	return []reflex.UserTraffic{{Email: "a@example.com", Uplink: 10, Downlink: 20}}
+}
+
+func (c *fakeController) ResetTraffic(email string) []reflex.UserTraffic {
+	c.resets = append(c.resets, email)
+	return c.Traffic(email)
+}
+
+type fakeHandler struct {
+	inbound.Handler
+	tag     string
+	inbound proxy.Inbound
+}
+
+func (h *fakeHandler) Tag() string               { return h.tag }
+func (h *fakeHandler) GetInbound() proxy.Inbound { return h.inbound }
+
+type fakeManager struct {
+	inbound.Manager
+	handlers []inbound.Handler
+}
+
+func (m *fakeManager) GetHandler(ctx context.Context, tag string) (inbound.Handler, error) {
+	for _, h := range m.handlers {
+		if h.Tag() == tag {
+			return h, nil
+		}
+	}
+	return nil, errors.New("handler not found: ", tag)
+}
+
+func (m *fakeManager) ListHandlers(ctx context.Context) []inbound.Handler {
+	return m.handlers
+}
+
+func TestReflexServer(t *testing.T) {
+	controller := &fakeController{sessions: []reflex.SessionInfo{
+		{ID: 1, Email: "a@example.com", Source: "1.2.3.4:5", Started: time.Now().Add(-time.Minute), DownlinkPolicy: "youtube", SizeDistance: 0.1},
+		{ID: 2, Email: "b@example.com", Started: time.Now()},
+	}}
+	server := NewReflexServer(&fakeManager{handlers: []inbound.Handler{
+		&fakeHandler{tag: "other"},
+		&fakeHandler{tag: "reflex-in", inbound: controller},
+	}})
+	ctx := context.Background()
+
+	resp, err := server.ListSessions(ctx, &ListSessionsRequest{Email: "a@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Sessions) != 1 {
+		t.Fatalf("expected one session, got %d", len(resp.Sessions))
+	}
+	s := resp.Sessions[0]
+	if s.Id != 1 || s.Tag != "reflex-in" || s.Source != "1.2.3.4:5" || s.DownlinkPolicy != "youtube" || s.Uptime < 59 {
+		t.Fatalf("unexpected session: %v", s)
+	}
+
+	if _, err := server.ListSessions(ctx, &ListSessionsRequest{Tag: "other"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("listing a non-reflex inbound: %v", err)
+	}
+	if _, err := server.ListSessions(ctx, &ListSessionsRequest{Tag: "missing"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("listing a missing inbound: %v", err)
+	}
+
+	if _, err := server.CloseSession(ctx, &CloseSessionRequest{Id: 3}); status.Code(err) != codes.NotFound {
+		t.Fatalf("closing a missing session: %v", err)
+	}
+	if _, err := server.CloseSession(ctx, &CloseSessionRequest{Tag: "reflex-in", Id: 2}); err != nil {
+		t.Fatal(err)
+	}
+	if len(controller.closed) != 1 || controller.closed[0] != 2 {
+		t.Fatalf("unexpected closed sessions: %v", controller.closed)
+	}
+
+	if _, err := server.UpdateSession(ctx, &UpdateSessionRequest{Id: 1}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("update without a policy: %v", err)
+	}
+	if _, err := server.UpdateSession(ctx, &UpdateSessionRequest{Id: 1, DownlinkPolicy: "bad"}); status.Code(err) != codes.InvalidArgument {
+		t.Fatalf("update to an unknown profile: %v", err)
+	}
+	if _, err := server.UpdateSession(ctx, &UpdateSessionRequest{Id: 3, DownlinkPolicy: "zoom"}); status.Code(err) != codes.NotFound {
+		t.Fatalf("updating a missing session: %v", err)
+	}
+	if _, err := server.UpdateSession(ctx, &UpdateSessionRequest{Id: 1, DownlinkPolicy: "zoom"}); err != nil {
+		t.Fatal(err)
+	}
+
+	traffic, err := server.GetTraffic(ctx, &GetTrafficRequest{Tag: "reflex-in"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(traffic.Users) != 1 || traffic.Users[0].Tag != "reflex-in" || traffic.Users[0].Downlink != 20 || len(controller.resets) != 0 {
+		t.Fatalf("unexpected traffic: %v", traffic.Users)
+	}
+	if _, err := server.GetTraffic(ctx, &GetTrafficRequest{Email: "a@example.com", Reset_: true}); err != nil {
+		t.Fatal(err)
+	}
+	if len(controller.resets) != 1 || controller.resets[0] != "a@example.com" {
+		t.Fatalf("unexpected resets: %v", controller.resets)
+	}
+}
@@ -7,6 +7,8 @@
 package reflex
 
 import (
+	router "github.com/xtls/xray-core/app/router"
+	net "github.com/xtls/xray-core/common/net"
 	protoreflect "google.golang.org/protobuf/reflect/protoreflect"
 	protoimpl "google.golang.org/protobuf/runtime/protoimpl"
 	reflect "reflect"
@@ -27,6 +29,35 @@ type User struct {
 
 	Id     string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
 	Policy string `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	// Fallback receives this user's connection when its authenticated session
+	// violates policy, instead of the inbound-wide decoy fallback.
+	Fallback *Fallback `protobuf:"bytes,3,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	// Uplink and downlink profiles override policy for one direction, e.g.
+	// "zoom-up" and "zoom-down".
+	UplinkPolicy   string `protobuf:"bytes,4,opt,name=uplink_policy,json=uplinkPolicy,proto3" json:"uplink_policy,omitempty"`
+	DownlinkPolicy string `protobuf:"bytes,5,opt,name=downlink_policy,json=downlinkPolicy,proto3" json:"downlink_policy,omitempty"`
+	// Profiles the client may request in its PolicyReq instead of the
+	// configured ones.
+	AllowedPolicies []string `protobuf:"bytes,6,rep,name=allowed_policies,json=allowedPolicies,proto3" json:"allowed_policies,omitempty"`
+	// Email and level identify the user to routing rules, stats and policy
+	// levels. The email defaults to id.
+	Email string `protobuf:"bytes,7,opt,name=email,proto3" json:"email,omitempty"`
+	Level uint32 `protobuf:"varint,8,opt,name=level,proto3" json:"level,omitempty"`
+	// CIDRs or addresses the user may connect from, and ones it may not.
+	// Denials win; an empty allow list admits any source. Behind a CDN the
+	// source is the CDN's edge.
+	AllowedSources []string `protobuf:"bytes,9,rep,name=allowed_sources,json=allowedSources,proto3" json:"allowed_sources,omitempty"`
+	DeniedSources  []string `protobuf:"bytes,10,rep,name=denied_sources,json=deniedSources,proto3" json:"denied_sources,omitempty"`
+	// Overrides the rate limits of the user's policies.
+	RateLimit *RateLimit `protobuf:"bytes,11,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	// Unix time from which the user's handshakes are refused and their live
+	// sessions closed; 0 never expires.
+	ExpiresAt int64 `protobuf:"varint,12,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	// Payload bytes, both directions together, the user may move per
+	// accounting period, i.e. until its traffic is reset through the API. Once
+	// used up, new handshakes are refused, and live sessions are closed when
+	// they go past it. Needs traffic_accounting. 0 is unlimited.
+	Quota uint64 `protobuf:"varint,13,opt,name=quota,proto3" json:"quota,omitempty"`
 }
 
 func (x *User) Reset() {
@@ -73,12 +104,103 @@ func (x *User) GetPolicy() string {
 	return ""
 }
 
+func (x *User) GetFallback() *Fallback {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
+func (x *User) GetUplinkPolicy() string {
+	if x != nil {
+		return x.UplinkPolicy
+	}
+	return ""
+}
+
+func (x *User) GetDownlinkPolicy() string {
+	if x != nil {
+		return x.DownlinkPolicy
+	}
+	return ""
+}
+
+func (x *User) GetAllowedPolicies() []string {
+	if x != nil {
+		return x.AllowedPolicies
+	}
+	return nil
+}
+
+func (x *User) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *User) GetLevel() uint32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *User) GetAllowedSources() []string {
+	if x != nil {
+		return x.AllowedSources
+	}
+	return nil
+}
+
+func (x *User) GetDeniedSources() []string {
+	if x != nil {
+		return x.DeniedSources
+	}
+	return nil
+}
+
+func (x *User) GetRateLimit() *RateLimit {
+	if x != nil {
+		return x.RateLimit
+	}
+	return nil
+}
+
+func (x *User) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *User) GetQuota() uint64 {
+	if x != nil {
+		return x.Quota
+	}
+	return 0
+}
+
+// Account is a user's Reflex account as added through the handler API: the
+// fields of User that aren't carried by protocol.User, meaning the same.
+// Inbounds refuse accounts with a quota unless they keep traffic accounting,
+// and fallbacks with geo entries, which only configured users may have.
 type Account struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
 	unknownFields protoimpl.UnknownFields
 
-	Id string `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Id              string     `protobuf:"bytes,1,opt,name=id,proto3" json:"id,omitempty"`
+	Policy          string     `protobuf:"bytes,2,opt,name=policy,proto3" json:"policy,omitempty"`
+	UplinkPolicy    string     `protobuf:"bytes,3,opt,name=uplink_policy,json=uplinkPolicy,proto3" json:"uplink_policy,omitempty"`
+	DownlinkPolicy  string     `protobuf:"bytes,4,opt,name=downlink_policy,json=downlinkPolicy,proto3" json:"downlink_policy,omitempty"`
+	AllowedPolicies []string   `protobuf:"bytes,5,rep,name=allowed_policies,json=allowedPolicies,proto3" json:"allowed_policies,omitempty"`
+	RateLimit       *RateLimit `protobuf:"bytes,6,opt,name=rate_limit,json=rateLimit,proto3" json:"rate_limit,omitempty"`
+	Fallback        *Fallback  `protobuf:"bytes,7,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	AllowedSources  []string   `protobuf:"bytes,8,rep,name=allowed_sources,json=allowedSources,proto3" json:"allowed_sources,omitempty"`
+	DeniedSources   []string   `protobuf:"bytes,9,rep,name=denied_sources,json=deniedSources,proto3" json:"denied_sources,omitempty"`
+	ExpiresAt       int64      `protobuf:"varint,10,opt,name=expires_at,json=expiresAt,proto3" json:"expires_at,omitempty"`
+	Quota           uint64     `protobuf:"varint,11,opt,name=quota,proto3" json:"quota,omitempty"`
 }
 
 func (x *Account) Reset() {
@@ -118,6 +240,76 @@ func (x *Account) GetId() string {
 	return ""
 }
 
+func (x *Account) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *Account) GetUplinkPolicy() string {
+	if x != nil {
+		return x.UplinkPolicy
+	}
+	return ""
+}
+
+func (x *Account) GetDownlinkPolicy() string {
+	if x != nil {
+		return x.DownlinkPolicy
+	}
+	return ""
+}
+
+func (x *Account) GetAllowedPolicies() []string {
+	if x != nil {
+		return x.AllowedPolicies
+	}
+	return nil
+}
+
+func (x *Account) GetRateLimit() *RateLimit {
+	if x != nil {
+		return x.RateLimit
+	}
+	return nil
+}
+
+func (x *Account) GetFallback() *Fallback {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
+func (x *Account) GetAllowedSources() []string {
+	if x != nil {
+		return x.AllowedSources
+	}
+	return nil
+}
+
+func (x *Account) GetDeniedSources() []string {
+	if x != nil {
+		return x.DeniedSources
+	}
+	return nil
+}
+
+func (x *Account) GetExpiresAt() int64 {
+	if x != nil {
+		return x.ExpiresAt
+	}
+	return 0
+}
+
+func (x *Account) GetQuota() uint64 {
+	if x != nil {
+		return x.Quota
+	}
+	return 0
+}
+
 type InboundConfig struct {
 	state         protoimpl.MessageState
 	sizeCache     protoimpl.SizeCache
@@ -125,6 +317,118 @@ type InboundConfig struct {
 
 	Clients  []*User   `protobuf:"bytes,1,rep,name=clients,proto3" json:"clients,omitempty"`
 	Fallback *Fallback `protobuf:"bytes,2,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	// Emit padding frames along the profile's delay distribution while a
+	// session is idle.
+	CoverTraffic bool             `protobuf:"varint,3,opt,name=cover_traffic,json=coverTraffic,proto3" json:"cover_traffic,omitempty"`
+	Puzzle       *HandshakePuzzle `protobuf:"bytes,4,opt,name=puzzle,proto3" json:"puzzle,omitempty"`
+	// Directory of JSON traffic profiles of this inbound, reloaded through
+	// ReloadOperation. User policies may name any profile loaded from it.
+	ProfileDir string `protobuf:"bytes,5,opt,name=profile_dir,json=profileDir,proto3" json:"profile_dir,omitempty"`
+	// Batch each data chunk with its padding and timing frames into a single
+	// write instead of writing every frame separately.
+	CoalesceWrites bool `protobuf:"varint,6,opt,name=coalesce_writes,json=coalesceWrites,proto3" json:"coalesce_writes,omitempty"`
+	// Accept sessions inside a WebSocket upgrade on this path, so the inbound
+	// can sit behind a CDN. Other requests still reach the fallback. Chunked
+	// POST sessions are always accepted.
+	WebsocketPath string `protobuf:"bytes,7,opt,name=websocket_path,json=websocketPath,proto3" json:"websocket_path,omitempty"`
+	// Serve HTTP/2 connections and carry sessions in the streaming gRPC call
+	// grpc_service/grpc_method, so the inbound can sit behind gRPC-aware load
+	// balancers. The method defaults to "Tun".
+	GrpcService string `protobuf:"bytes,8,opt,name=grpc_service,json=grpcService,proto3" json:"grpc_service,omitempty"`
+	GrpcMethod  string `protobuf:"bytes,9,opt,name=grpc_method,json=grpcMethod,proto3" json:"grpc_method,omitempty"`
+	// Also listen for QUIC on this host:port and run a session on every
+	// bidirectional stream, negotiating ALPN "reflex". Streams that are not
+	// Reflex sessions go to the fallback. QUIC always needs a certificate and
+	// key.
+	QuicListen          string `protobuf:"bytes,10,opt,name=quic_listen,json=quicListen,proto3" json:"quic_listen,omitempty"`
+	QuicCertificateFile string `protobuf:"bytes,11,opt,name=quic_certificate_file,json=quicCertificateFile,proto3" json:"quic_certificate_file,omitempty"`
+	QuicKeyFile         string `protobuf:"bytes,12,opt,name=quic_key_file,json=quicKeyFile,proto3" json:"quic_key_file,omitempty"`
+	// What an HTTP handshake request must look like: one of these Host values
+	// and paths, and these header values. Anything else goes to the fallback
+	// untouched, as the fronted site would see it. Empty accepts any.
+	HttpHosts   []string          `protobuf:"bytes,13,rep,name=http_hosts,json=httpHosts,proto3" json:"http_hosts,omitempty"`
+	HttpPaths   []string          `protobuf:"bytes,14,rep,name=http_paths,json=httpPaths,proto3" json:"http_paths,omitempty"`
+	HttpHeaders map[string]string `protobuf:"bytes,15,rep,name=http_headers,json=httpHeaders,proto3" json:"http_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Largest frame, header and tag included, that shaped downlink data is
+	// cut into, so each frame fits one TCP segment. 0 uses the socket's MSS,
+	// or 1400 when the session runs inside an envelope.
+	MaxFrameSize uint32 `protobuf:"varint,16,opt,name=max_frame_size,json=maxFrameSize,proto3" json:"max_frame_size,omitempty"`
+	// Bytes of downlink data a session queues for shaping before it stops
+	// reading from upstream, and the level the queue must drain to before
+	// reading resumes. Default 512 KiB and half of high_watermark.
+	HighWatermark uint32 `protobuf:"varint,17,opt,name=high_watermark,json=highWatermark,proto3" json:"high_watermark,omitempty"`
+	LowWatermark  uint32 `protobuf:"varint,18,opt,name=low_watermark,json=lowWatermark,proto3" json:"low_watermark,omitempty"`
+	// Debug logging of sessions, at Info severity and tagged with the session
+	// ID: 0 logs nothing extra, 1 handshake outcomes and session starts and
+	// ends, 2 also every frame and morphing decision. With log_users set, only
+	// sessions of users with these emails are logged.
+	LogVerbosity uint32   `protobuf:"varint,19,opt,name=log_verbosity,json=logVerbosity,proto3" json:"log_verbosity,omitempty"`
+	LogUsers     []string `protobuf:"bytes,20,rep,name=log_users,json=logUsers,proto3" json:"log_users,omitempty"`
+	// Audit trail of handshakes for fail2ban-style tooling: every accepted or
+	// rejected handshake is appended to the file audit_log as a JSON line and,
+	// with audit_access_log, also recorded in Xray's access log.
+	AuditLog       string       `protobuf:"bytes,21,opt,name=audit_log,json=auditLog,proto3" json:"audit_log,omitempty"`
+	AuditAccessLog bool         `protobuf:"varint,22,opt,name=audit_access_log,json=auditAccessLog,proto3" json:"audit_access_log,omitempty"`
+	SourceBan      *SourceBan   `protobuf:"bytes,23,opt,name=source_ban,json=sourceBan,proto3" json:"source_ban,omitempty"`
+	AuthBackend    *AuthBackend `protobuf:"bytes,24,opt,name=auth_backend,json=authBackend,proto3" json:"auth_backend,omitempty"`
+	// Rate limits of sessions by the name of their negotiated policy: the
+	// uplink limit of the uplink policy and the downlink limit of the
+	// downlink policy apply, shared by each user's sessions under it.
+	PolicyRateLimits  map[string]*RateLimit `protobuf:"bytes,25,rep,name=policy_rate_limits,json=policyRateLimits,proto3" json:"policy_rate_limits,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	TrafficAccounting *TrafficAccounting    `protobuf:"bytes,26,opt,name=traffic_accounting,json=trafficAccounting,proto3" json:"traffic_accounting,omitempty"`
+	// Binds handshakes to this server: negotiating clients must be configured
+	// with the same value, such as the address and port they dial, so a
+	// handshake captured here authenticates at no other server sharing the
+	// users. Clients that don't negotiate are refused. Empty disables it.
+	HandshakeBinding string `protobuf:"bytes,27,opt,name=handshake_binding,json=handshakeBinding,proto3" json:"handshake_binding,omitempty"`
+	// Takes clients, traffic_accounting and max_nonces from the UserStore of
+	// this name, which must leave them unset here.
+	UserStore string `protobuf:"bytes,28,opt,name=user_store,json=userStore,proto3" json:"user_store,omitempty"`
+	// Further conditions on HTTP handshake requests, failing which they go to
+	// the fallback: headers that must be present with any value, and the
+	// media type of the body, parameters such as charset aside.
+	HttpRequiredHeaders []string `protobuf:"bytes,29,rep,name=http_required_headers,json=httpRequiredHeaders,proto3" json:"http_required_headers,omitempty"`
+	HttpContentType     string   `protobuf:"bytes,30,opt,name=http_content_type,json=httpContentType,proto3" json:"http_content_type,omitempty"`
+	// Milliseconds after its arrival before any handshake is answered,
+	// accepted or not, so response times don't reveal why one failed.
+	// Defaults to 10; set it above the slowest successful handshake, which
+	// grows with the number of users and with an auth_backend.
+	HandshakeResponseFloor uint32 `protobuf:"varint,31,opt,name=handshake_response_floor,json=handshakeResponseFloor,proto3" json:"handshake_response_floor,omitempty"`
+	// Most handshake nonces remembered against replay. Once that many
+	// unexpired nonces are held, further handshakes are refused until some
+	// expire, rather than forgetting one early. Defaults to 262144, about
+	// 30 MB.
+	MaxNonces uint32 `protobuf:"varint,32,opt,name=max_nonces,json=maxNonces,proto3" json:"max_nonces,omitempty"`
+	// Estimate the byte entropy of what each session writes and warn, and
+	// count under reflex>>>integrity>>>low_entropy, when it doesn't look
+	// encrypted: a canary for plaintext reaching the wire.
+	EntropyMonitor bool `protobuf:"varint,33,opt,name=entropy_monitor,json=entropyMonitor,proto3" json:"entropy_monitor,omitempty"`
+	// How a connection that fails the handshake ends when there is no
+	// fallback for it: "close" (the default) closes it gracefully, "reset"
+	// with a RST, and "tarpit" holds it open for minutes, dripping a random
+	// byte every few seconds.
+	Unmatched string `protobuf:"bytes,34,opt,name=unmatched,proto3" json:"unmatched,omitempty"`
+	// Most sessions running at once; 0 is unlimited. Authenticated clients
+	// over the limit get a 503, which they retry.
+	MaxSessions uint32 `protobuf:"varint,35,opt,name=max_sessions,json=maxSessions,proto3" json:"max_sessions,omitempty"`
+	// Seconds that closing the inbound, as on a restart, waits for running
+	// sessions to end on their own. New handshakes get a 503 meanwhile;
+	// whatever still runs after is reset with a shutdown Close frame.
+	DrainTimeout uint32 `protobuf:"varint,36,opt,name=drain_timeout,json=drainTimeout,proto3" json:"drain_timeout,omitempty"`
+	// The server whose JSON API responses HTTP handshake responses imitate,
+	// with its header order and its Server, caching and request ID headers:
+	// "go" (the default), "nginx", "cloudflare" or "apache". Headers in
+	// http_response_headers override the preset's values or follow them.
+	HttpServer          string            `protobuf:"bytes,37,opt,name=http_server,json=httpServer,proto3" json:"http_server,omitempty"`
+	HttpResponseHeaders map[string]string `protobuf:"bytes,38,rep,name=http_response_headers,json=httpResponseHeaders,proto3" json:"http_response_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Ed25519 private key seed (32 bytes) the server signs policy grants
+	// with, binding each to its session. Clients that pin the public key as
+	// server_identity reject grants altered or stripped on the way.
+	IdentityKey []byte `protobuf:"bytes,39,opt,name=identity_key,json=identityKey,proto3" json:"identity_key,omitempty"`
+	// Pre-shared key (32 bytes) mixed into every session key, so a session
+	// also depends on a secret that never crosses the wire. Clients must be
+	// configured with the same psk, or their sessions fail to decrypt.
+	Psk []byte `protobuf:"bytes,40,opt,name=psk,proto3" json:"psk,omitempty"`
 }
 
 func (x *InboundConfig) Reset() {
@@ -171,140 +475,1813 @@ func (x *InboundConfig) GetFallback() *Fallback {
 	return nil
 }
 
-type Fallback struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
+func (x *InboundConfig) GetCoverTraffic() bool {
+	if x != nil {
+		return x.CoverTraffic
+	}
+	return false
+}
 
-	Dest uint32 `protobuf:"varint,1,opt,name=dest,proto3" json:"dest,omitempty"`
+func (x *InboundConfig) GetPuzzle() *HandshakePuzzle {
+	if x != nil {
+		return x.Puzzle
+	}
+	return nil
 }
 
-func (x *Fallback) Reset() {
-	*x = Fallback{}
-	mi := &file_proxy_reflex_config_proto_msgTypes[3]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *InboundConfig) GetProfileDir() string {
+	if x != nil {
+		return x.ProfileDir
+	}
+	return ""
 }
 
-func (x *Fallback) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *InboundConfig) GetCoalesceWrites() bool {
+	if x != nil {
+		return x.CoalesceWrites
+	}
+	return false
 }
 
-func (*Fallback) ProtoMessage() {}
+func (x *InboundConfig) GetWebsocketPath() string {
+	if x != nil {
+		return x.WebsocketPath
+	}
+	return ""
+}
 
-func (x *Fallback) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_reflex_config_proto_msgTypes[3]
+func (x *InboundConfig) GetGrpcService() string {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.GrpcService
 	}
-	return mi.MessageOf(x)
+	return ""
 }
 
-// Deprecated: Use Fallback.ProtoReflect.Descriptor instead.
-func (*Fallback) Descriptor() ([]byte, []int) {
-	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{3}
+func (x *InboundConfig) GetGrpcMethod() string {
+	if x != nil {
+		return x.GrpcMethod
+	}
+	return ""
 }
 
-func (x *Fallback) GetDest() uint32 {
+func (x *InboundConfig) GetQuicListen() string {
 	if x != nil {
-		return x.Dest
+		return x.QuicListen
 	}
-	return 0
+	return ""
 }
 
-type OutboundConfig struct {
-	state         protoimpl.MessageState
-	sizeCache     protoimpl.SizeCache
-	unknownFields protoimpl.UnknownFields
+func (x *InboundConfig) GetQuicCertificateFile() string {
+	if x != nil {
+		return x.QuicCertificateFile
+	}
+	return ""
+}
 
-	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
-	Port    uint32 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
-	Id      string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+func (x *InboundConfig) GetQuicKeyFile() string {
+	if x != nil {
+		return x.QuicKeyFile
+	}
+	return ""
 }
 
-func (x *OutboundConfig) Reset() {
-	*x = OutboundConfig{}
-	mi := &file_proxy_reflex_config_proto_msgTypes[4]
-	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-	ms.StoreMessageInfo(mi)
+func (x *InboundConfig) GetHttpHosts() []string {
+	if x != nil {
+		return x.HttpHosts
+	}
+	return nil
 }
 
-func (x *OutboundConfig) String() string {
-	return protoimpl.X.MessageStringOf(x)
+func (x *InboundConfig) GetHttpPaths() []string {
+	if x != nil {
+		return x.HttpPaths
+	}
+	return nil
 }
 
-func (*OutboundConfig) ProtoMessage() {}
+func (x *InboundConfig) GetHttpHeaders() map[string]string {
+	if x != nil {
+		return x.HttpHeaders
+	}
+	return nil
+}
 
-func (x *OutboundConfig) ProtoReflect() protoreflect.Message {
-	mi := &file_proxy_reflex_config_proto_msgTypes[4]
+func (x *InboundConfig) GetMaxFrameSize() uint32 {
 	if x != nil {
-		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
-		if ms.LoadMessageInfo() == nil {
-			ms.StoreMessageInfo(mi)
-		}
-		return ms
+		return x.MaxFrameSize
 	}
-	return mi.MessageOf(x)
+	return 0
 }
 
-// Deprecated: Use OutboundConfig.ProtoReflect.Descriptor instead.
-func (*OutboundConfig) Descriptor() ([]byte, []int) {
-	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{4}
+func (x *InboundConfig) GetHighWatermark() uint32 {
+	if x != nil {
+		return x.HighWatermark
+	}
+	return 0
 }
 
-func (x *OutboundConfig) GetAddress() string {
+func (x *InboundConfig) GetLowWatermark() uint32 {
 	if x != nil {
-		return x.Address
+		return x.LowWatermark
 	}
-	return ""
+	return 0
 }
 
-func (x *OutboundConfig) GetPort() uint32 {
+func (x *InboundConfig) GetLogVerbosity() uint32 {
 	if x != nil {
-		return x.Port
+		return x.LogVerbosity
 	}
 	return 0
 }
 
-func (x *OutboundConfig) GetId() string {
+func (x *InboundConfig) GetLogUsers() []string {
 	if x != nil {
-		return x.Id
+		return x.LogUsers
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetAuditLog() string {
+	if x != nil {
+		return x.AuditLog
+	}
+	return ""
+}
+
+func (x *InboundConfig) GetAuditAccessLog() bool {
+	if x != nil {
+		return x.AuditAccessLog
+	}
+	return false
+}
+
+func (x *InboundConfig) GetSourceBan() *SourceBan {
+	if x != nil {
+		return x.SourceBan
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetAuthBackend() *AuthBackend {
+	if x != nil {
+		return x.AuthBackend
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetPolicyRateLimits() map[string]*RateLimit {
+	if x != nil {
+		return x.PolicyRateLimits
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetTrafficAccounting() *TrafficAccounting {
+	if x != nil {
+		return x.TrafficAccounting
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetHandshakeBinding() string {
+	if x != nil {
+		return x.HandshakeBinding
+	}
+	return ""
+}
+
+func (x *InboundConfig) GetUserStore() string {
+	if x != nil {
+		return x.UserStore
 	}
 	return ""
 }
 
+func (x *InboundConfig) GetHttpRequiredHeaders() []string {
+	if x != nil {
+		return x.HttpRequiredHeaders
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetHttpContentType() string {
+	if x != nil {
+		return x.HttpContentType
+	}
+	return ""
+}
+
+func (x *InboundConfig) GetHandshakeResponseFloor() uint32 {
+	if x != nil {
+		return x.HandshakeResponseFloor
+	}
+	return 0
+}
+
+func (x *InboundConfig) GetMaxNonces() uint32 {
+	if x != nil {
+		return x.MaxNonces
+	}
+	return 0
+}
+
+func (x *InboundConfig) GetEntropyMonitor() bool {
+	if x != nil {
+		return x.EntropyMonitor
+	}
+	return false
+}
+
+func (x *InboundConfig) GetUnmatched() string {
+	if x != nil {
+		return x.Unmatched
+	}
+	return ""
+}
+
+func (x *InboundConfig) GetMaxSessions() uint32 {
+	if x != nil {
+		return x.MaxSessions
+	}
+	return 0
+}
+
+func (x *InboundConfig) GetDrainTimeout() uint32 {
+	if x != nil {
+		return x.DrainTimeout
+	}
+	return 0
+}
+
+func (x *InboundConfig) GetHttpServer() string {
+	if x != nil {
+		return x.HttpServer
+	}
+	return ""
+}
+
+func (x *InboundConfig) GetHttpResponseHeaders() map[string]string {
+	if x != nil {
+		return x.HttpResponseHeaders
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetIdentityKey() []byte {
+	if x != nil {
+		return x.IdentityKey
+	}
+	return nil
+}
+
+func (x *InboundConfig) GetPsk() []byte {
+	if x != nil {
+		return x.Psk
+	}
+	return nil
+}
+
+// UserStoreConfig is an app holding users that several Reflex inbounds, say
+// on different ports or transports, share by naming a store in user_store.
+// Inbounds sharing a store also share replay protection, so a handshake one
+// accepted is refused by the others.
+type UserStoreConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Stores []*UserStore `protobuf:"bytes,1,rep,name=stores,proto3" json:"stores,omitempty"`
+}
+
+func (x *UserStoreConfig) Reset() {
+	*x = UserStoreConfig{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[3]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserStoreConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserStoreConfig) ProtoMessage() {}
+
+func (x *UserStoreConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[3]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserStoreConfig.ProtoReflect.Descriptor instead.
+func (*UserStoreConfig) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{3}
+}
+
+func (x *UserStoreConfig) GetStores() []*UserStore {
+	if x != nil {
+		return x.Stores
+	}
+	return nil
+}
+
+type UserStore struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Name              string             `protobuf:"bytes,1,opt,name=name,proto3" json:"name,omitempty"`
+	Clients           []*User            `protobuf:"bytes,2,rep,name=clients,proto3" json:"clients,omitempty"`
+	TrafficAccounting *TrafficAccounting `protobuf:"bytes,3,opt,name=traffic_accounting,json=trafficAccounting,proto3" json:"traffic_accounting,omitempty"`
+	// As in InboundConfig.
+	MaxNonces uint32 `protobuf:"varint,4,opt,name=max_nonces,json=maxNonces,proto3" json:"max_nonces,omitempty"`
+}
+
+func (x *UserStore) Reset() {
+	*x = UserStore{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[4]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UserStore) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UserStore) ProtoMessage() {}
+
+func (x *UserStore) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[4]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UserStore.ProtoReflect.Descriptor instead.
+func (*UserStore) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{4}
+}
+
+func (x *UserStore) GetName() string {
+	if x != nil {
+		return x.Name
+	}
+	return ""
+}
+
+func (x *UserStore) GetClients() []*User {
+	if x != nil {
+		return x.Clients
+	}
+	return nil
+}
+
+func (x *UserStore) GetTrafficAccounting() *TrafficAccounting {
+	if x != nil {
+		return x.TrafficAccounting
+	}
+	return nil
+}
+
+func (x *UserStore) GetMaxNonces() uint32 {
+	if x != nil {
+		return x.MaxNonces
+	}
+	return 0
+}
+
+// TrafficAccounting keeps cumulative per-user payload byte counts in the
+// JSON file file, written every flush_interval seconds, default 60, and when
+// the inbound closes. Totals can be read and reset through the Reflex API.
+type TrafficAccounting struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	File          string `protobuf:"bytes,1,opt,name=file,proto3" json:"file,omitempty"`
+	FlushInterval uint32 `protobuf:"varint,2,opt,name=flush_interval,json=flushInterval,proto3" json:"flush_interval,omitempty"`
+}
+
+func (x *TrafficAccounting) Reset() {
+	*x = TrafficAccounting{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[5]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *TrafficAccounting) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*TrafficAccounting) ProtoMessage() {}
+
+func (x *TrafficAccounting) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[5]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use TrafficAccounting.ProtoReflect.Descriptor instead.
+func (*TrafficAccounting) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{5}
+}
+
+func (x *TrafficAccounting) GetFile() string {
+	if x != nil {
+		return x.File
+	}
+	return ""
+}
+
+func (x *TrafficAccounting) GetFlushInterval() uint32 {
+	if x != nil {
+		return x.FlushInterval
+	}
+	return 0
+}
+
+// RateLimit throttles a user to uplink and downlink bytes per second of
+// payload, shared by all of the user's sessions; 0 leaves a direction
+// unlimited. Limits set on a policy apply to each user's sessions under it.
+type RateLimit struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Uplink   uint64 `protobuf:"varint,1,opt,name=uplink,proto3" json:"uplink,omitempty"`
+	Downlink uint64 `protobuf:"varint,2,opt,name=downlink,proto3" json:"downlink,omitempty"`
+}
+
+func (x *RateLimit) Reset() {
+	*x = RateLimit{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[6]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *RateLimit) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*RateLimit) ProtoMessage() {}
+
+func (x *RateLimit) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[6]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use RateLimit.ProtoReflect.Descriptor instead.
+func (*RateLimit) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{6}
+}
+
+func (x *RateLimit) GetUplink() uint64 {
+	if x != nil {
+		return x.Uplink
+	}
+	return 0
+}
+
+func (x *RateLimit) GetDownlink() uint64 {
+	if x != nil {
+		return x.Downlink
+	}
+	return 0
+}
+
+// AuthBackend looks up users that aren't in clients over HTTP, so panels can
+// manage users without config reloads. Handshakes are POSTed to url as JSON
+// and the users it admits are cached for cache_ttl seconds, default 60.
+// timeout is in milliseconds, default 2000.
+type AuthBackend struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Url      string `protobuf:"bytes,1,opt,name=url,proto3" json:"url,omitempty"`
+	CacheTtl uint32 `protobuf:"varint,2,opt,name=cache_ttl,json=cacheTtl,proto3" json:"cache_ttl,omitempty"`
+	Timeout  uint32 `protobuf:"varint,3,opt,name=timeout,proto3" json:"timeout,omitempty"`
+}
+
+func (x *AuthBackend) Reset() {
+	*x = AuthBackend{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[7]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *AuthBackend) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*AuthBackend) ProtoMessage() {}
+
+func (x *AuthBackend) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[7]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use AuthBackend.ProtoReflect.Descriptor instead.
+func (*AuthBackend) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{7}
+}
+
+func (x *AuthBackend) GetUrl() string {
+	if x != nil {
+		return x.Url
+	}
+	return ""
+}
+
+func (x *AuthBackend) GetCacheTtl() uint32 {
+	if x != nil {
+		return x.CacheTtl
+	}
+	return 0
+}
+
+func (x *AuthBackend) GetTimeout() uint32 {
+	if x != nil {
+		return x.Timeout
+	}
+	return 0
+}
+
+// HandshakePuzzle requires clients to grind their handshake nonce until
+// SHA-256(public key || nonce || timestamp) has difficulty leading zero bits.
+// Handshakes that don't are answered 429 with the difficulty, so clients can
+// solve it and retry.
+type HandshakePuzzle struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Difficulty uint32 `protobuf:"varint,1,opt,name=difficulty,proto3" json:"difficulty,omitempty"`
+	// Handshakes per second above which the puzzle is enforced; 0 means always.
+	TriggerRate uint32 `protobuf:"varint,2,opt,name=trigger_rate,json=triggerRate,proto3" json:"trigger_rate,omitempty"`
+}
+
+func (x *HandshakePuzzle) Reset() {
+	*x = HandshakePuzzle{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[8]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *HandshakePuzzle) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*HandshakePuzzle) ProtoMessage() {}
+
+func (x *HandshakePuzzle) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[8]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use HandshakePuzzle.ProtoReflect.Descriptor instead.
+func (*HandshakePuzzle) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{8}
+}
+
+func (x *HandshakePuzzle) GetDifficulty() uint32 {
+	if x != nil {
+		return x.Difficulty
+	}
+	return 0
+}
+
+func (x *HandshakePuzzle) GetTriggerRate() uint32 {
+	if x != nil {
+		return x.TriggerRate
+	}
+	return 0
+}
+
+// SourceBan sends every connection from a source straight to the fallback
+// for duration seconds once max_failures of its handshakes failed within
+// window seconds. IPv6 sources are banned by /64. The window defaults to 60
+// seconds and the duration to 600.
+type SourceBan struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	MaxFailures uint32 `protobuf:"varint,1,opt,name=max_failures,json=maxFailures,proto3" json:"max_failures,omitempty"`
+	Window      uint32 `protobuf:"varint,2,opt,name=window,proto3" json:"window,omitempty"`
+	Duration    uint32 `protobuf:"varint,3,opt,name=duration,proto3" json:"duration,omitempty"`
+}
+
+func (x *SourceBan) Reset() {
+	*x = SourceBan{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[9]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *SourceBan) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*SourceBan) ProtoMessage() {}
+
+func (x *SourceBan) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[9]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use SourceBan.ProtoReflect.Descriptor instead.
+func (*SourceBan) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{9}
+}
+
+func (x *SourceBan) GetMaxFailures() uint32 {
+	if x != nil {
+		return x.MaxFailures
+	}
+	return 0
+}
+
+func (x *SourceBan) GetWindow() uint32 {
+	if x != nil {
+		return x.Window
+	}
+	return 0
+}
+
+func (x *SourceBan) GetDuration() uint32 {
+	if x != nil {
+		return x.Duration
+	}
+	return 0
+}
+
+type Fallback struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Dest uint32 `protobuf:"varint,1,opt,name=dest,proto3" json:"dest,omitempty"`
+	// Decoys for clients from particular networks, e.g. a local-language site
+	// for domestic probers. The first match wins; dest serves everyone else.
+	Geo []*GeoFallback `protobuf:"bytes,2,rep,name=geo,proto3" json:"geo,omitempty"`
+	// Paths fetched from the decoys ahead of time and answered from memory,
+	// so fallback responses are as fast as a locally hosted site's even when
+	// the decoy is remote. Other requests still reach the decoy.
+	Prefetch []string `protobuf:"bytes,3,rep,name=prefetch,proto3" json:"prefetch,omitempty"`
+	// Seconds between refreshes of the prefetched responses; 0 means 300.
+	PrefetchRefresh uint32 `protobuf:"varint,4,opt,name=prefetch_refresh,json=prefetchRefresh,proto3" json:"prefetch_refresh,omitempty"`
+	// Host header of the prefetch requests; defaults to localhost.
+	PrefetchHost string `protobuf:"bytes,5,opt,name=prefetch_host,json=prefetchHost,proto3" json:"prefetch_host,omitempty"`
+	// Decoy paths answering with an error status, by that status, e.g. 404
+	// to a path that doesn't exist. They are prefetched like prefetch, and a
+	// handshake refused with one of these statuses gets the decoy's own page
+	// instead of a bare one.
+	ErrorPages map[uint32]string `protobuf:"bytes,6,rep,name=error_pages,json=errorPages,proto3" json:"error_pages,omitempty" protobuf_key:"varint,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+}
+
+func (x *Fallback) Reset() {
+	*x = Fallback{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[10]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Fallback) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Fallback) ProtoMessage() {}
+
+func (x *Fallback) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[10]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Fallback.ProtoReflect.Descriptor instead.
+func (*Fallback) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{10}
+}
+
+func (x *Fallback) GetDest() uint32 {
+	if x != nil {
+		return x.Dest
+	}
+	return 0
+}
+
+func (x *Fallback) GetGeo() []*GeoFallback {
+	if x != nil {
+		return x.Geo
+	}
+	return nil
+}
+
+func (x *Fallback) GetPrefetch() []string {
+	if x != nil {
+		return x.Prefetch
+	}
+	return nil
+}
+
+func (x *Fallback) GetPrefetchRefresh() uint32 {
+	if x != nil {
+		return x.PrefetchRefresh
+	}
+	return 0
+}
+
+func (x *Fallback) GetPrefetchHost() string {
+	if x != nil {
+		return x.PrefetchHost
+	}
+	return ""
+}
+
+func (x *Fallback) GetErrorPages() map[uint32]string {
+	if x != nil {
+		return x.ErrorPages
+	}
+	return nil
+}
+
+type GeoFallback struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Geoip []*router.GeoIP `protobuf:"bytes,1,rep,name=geoip,proto3" json:"geoip,omitempty"`
+	Dest  uint32          `protobuf:"varint,2,opt,name=dest,proto3" json:"dest,omitempty"`
+}
+
+func (x *GeoFallback) Reset() {
+	*x = GeoFallback{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[11]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *GeoFallback) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*GeoFallback) ProtoMessage() {}
+
+func (x *GeoFallback) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[11]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use GeoFallback.ProtoReflect.Descriptor instead.
+func (*GeoFallback) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{11}
+}
+
+func (x *GeoFallback) GetGeoip() []*router.GeoIP {
+	if x != nil {
+		return x.Geoip
+	}
+	return nil
+}
+
+func (x *GeoFallback) GetDest() uint32 {
+	if x != nil {
+		return x.Dest
+	}
+	return 0
+}
+
+type OutboundConfig struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Address string `protobuf:"bytes,1,opt,name=address,proto3" json:"address,omitempty"`
+	Port    uint32 `protobuf:"varint,2,opt,name=port,proto3" json:"port,omitempty"`
+	Id      string `protobuf:"bytes,3,opt,name=id,proto3" json:"id,omitempty"`
+	// Profiles, features and padding level proposed to the server. The
+	// server's grant decides what is actually used.
+	UplinkPolicy   string   `protobuf:"bytes,4,opt,name=uplink_policy,json=uplinkPolicy,proto3" json:"uplink_policy,omitempty"`
+	DownlinkPolicy string   `protobuf:"bytes,5,opt,name=downlink_policy,json=downlinkPolicy,proto3" json:"downlink_policy,omitempty"`
+	Features       []string `protobuf:"bytes,6,rep,name=features,proto3" json:"features,omitempty"`
+	Padding        string   `protobuf:"bytes,7,opt,name=padding,proto3" json:"padding,omitempty"`
+	// Handshake puzzle difficulty to pre-solve. A server demanding a harder
+	// one names it in its refusal, and the handshakes of the next minute
+	// solve that instead.
+	PuzzleDifficulty uint32 `protobuf:"varint,8,opt,name=puzzle_difficulty,json=puzzleDifficulty,proto3" json:"puzzle_difficulty,omitempty"`
+	// Batch uplink frames into fewer writes, as InboundConfig.coalesce_writes.
+	CoalesceWrites bool `protobuf:"varint,9,opt,name=coalesce_writes,json=coalesceWrites,proto3" json:"coalesce_writes,omitempty"`
+	// Run the session inside a WebSocket upgrade on this path. This and the
+	// chunked and gRPC envelopes need streamSettings' raw transport; its
+	// security, if any, runs beneath them.
+	WebsocketPath string `protobuf:"bytes,10,opt,name=websocket_path,json=websocketPath,proto3" json:"websocket_path,omitempty"`
+	// Host header for the WebSocket and chunked HTTP modes; defaults to
+	// address.
+	Host string `protobuf:"bytes,11,opt,name=host,proto3" json:"host,omitempty"`
+	// Run the session as one chunked HTTP POST to this path.
+	ChunkedPath string `protobuf:"bytes,12,opt,name=chunked_path,json=chunkedPath,proto3" json:"chunked_path,omitempty"`
+	// Run the session as a streaming gRPC call, as InboundConfig.grpc_service.
+	GrpcService string `protobuf:"bytes,13,opt,name=grpc_service,json=grpcService,proto3" json:"grpc_service,omitempty"`
+	GrpcMethod  string `protobuf:"bytes,14,opt,name=grpc_method,json=grpcMethod,proto3" json:"grpc_method,omitempty"`
+	// Dial the server over QUIC and run the session on one stream. host is
+	// used as the TLS server name.
+	Quic bool `protobuf:"varint,15,opt,name=quic,proto3" json:"quic,omitempty"`
+	// Skip verification of the server's QUIC certificate.
+	QuicAllowInsecure bool `protobuf:"varint,16,opt,name=quic_allow_insecure,json=quicAllowInsecure,proto3" json:"quic_allow_insecure,omitempty"`
+	// Send the handshake as a JSON POST to this path instead of in binary.
+	HttpPath string `protobuf:"bytes,17,opt,name=http_path,json=httpPath,proto3" json:"http_path,omitempty"`
+	// Extra headers for the HTTP handshake, chunked and WebSocket requests,
+	// to match the fronted domain's real API traffic.
+	HttpHeaders map[string]string `protobuf:"bytes,18,rep,name=http_headers,json=httpHeaders,proto3" json:"http_headers,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	// Render the http_path handshake like this browser's fetch(): "chrome" or
+	// "firefox". Cookies the server sets are kept for later handshakes.
+	HttpBrowser string `protobuf:"bytes,19,opt,name=http_browser,json=httpBrowser,proto3" json:"http_browser,omitempty"`
+	// Run TLS over the dialed connection with this uTLS ClientHello
+	// fingerprint (chrome, firefox, safari, randomized, ...) and host as the
+	// server name, before any envelope. For streams whose TLS is applied by
+	// the transport, set tlsSettings.fingerprint there instead.
+	Fingerprint string `protobuf:"bytes,20,opt,name=fingerprint,proto3" json:"fingerprint,omitempty"`
+	// Keep this many sessions running Xray's mux warm and attach new links to
+	// them instead of dialing. Sessions carrying Xray's mux, pooled or from
+	// mux settings, propose the "mux" feature whether or not it is listed.
+	PoolSize uint32 `protobuf:"varint,21,opt,name=pool_size,json=poolSize,proto3" json:"pool_size,omitempty"`
+	// Seconds after which a pooled session takes no new links; 0 is no limit.
+	PoolMaxAge uint32 `protobuf:"varint,22,opt,name=pool_max_age,json=poolMaxAge,proto3" json:"pool_max_age,omitempty"`
+	// Links sharing one pooled session; defaults to 8.
+	PoolConcurrency uint32 `protobuf:"varint,23,opt,name=pool_concurrency,json=poolConcurrency,proto3" json:"pool_concurrency,omitempty"`
+	// When address is a domain, resolve both families and race the dials per
+	// RFC 8305. Dials go to IPs, so a TLS transport needs its serverName set.
+	// Ignored when chained behind another outbound, which resolves the name.
+	HappyEyeballs bool `protobuf:"varint,24,opt,name=happy_eyeballs,json=happyEyeballs,proto3" json:"happy_eyeballs,omitempty"`
+	// Uplink counterpart of InboundConfig.max_frame_size.
+	MaxFrameSize uint32 `protobuf:"varint,25,opt,name=max_frame_size,json=maxFrameSize,proto3" json:"max_frame_size,omitempty"`
+	// Uplink counterparts of InboundConfig.high_watermark and low_watermark.
+	HighWatermark uint32 `protobuf:"varint,26,opt,name=high_watermark,json=highWatermark,proto3" json:"high_watermark,omitempty"`
+	LowWatermark  uint32 `protobuf:"varint,27,opt,name=low_watermark,json=lowWatermark,proto3" json:"low_watermark,omitempty"`
+	// Dial a random port of this range instead of port, for servers
+	// listening on the whole range.
+	PortRange *net.PortRange `protobuf:"bytes,28,opt,name=port_range,json=portRange,proto3" json:"port_range,omitempty"`
+	// Seconds after which a pooled session takes no new links, so the pool
+	// keeps moving to fresh ports. Links already on a session stay on its
+	// port until they end.
+	HopInterval uint32 `protobuf:"varint,29,opt,name=hop_interval,json=hopInterval,proto3" json:"hop_interval,omitempty"`
+	// Split the handshake into small TCP segments with pauses between them.
+	Fragment *Fragment `protobuf:"bytes,30,opt,name=fragment,proto3" json:"fragment,omitempty"`
+	// The server's handshake_binding.
+	HandshakeBinding string `protobuf:"bytes,31,opt,name=handshake_binding,json=handshakeBinding,proto3" json:"handshake_binding,omitempty"`
+	// Profile proposed for both directions where uplink_policy or
+	// downlink_policy is unset, like User.policy.
+	Policy string `protobuf:"bytes,32,opt,name=policy,proto3" json:"policy,omitempty"`
+	// Policy level whose timeouts apply to the outbound's connections.
+	Level uint32 `protobuf:"varint,33,opt,name=level,proto3" json:"level,omitempty"`
+	// Lowest protocol version offered, e.g. 4 to insist on masked frame
+	// lengths; servers that only speak older versions are refused. 0 offers
+	// every supported version.
+	MinProtocolVersion uint32 `protobuf:"varint,34,opt,name=min_protocol_version,json=minProtocolVersion,proto3" json:"min_protocol_version,omitempty"`
+	// With http_path, ask the server to switch the connection to this Upgrade
+	// protocol with a 101 response, so frames after the handshake don't
+	// follow a keep-alive 200 on the same connection.
+	HttpUpgrade string `protobuf:"bytes,35,opt,name=http_upgrade,json=httpUpgrade,proto3" json:"http_upgrade,omitempty"`
+	// Ed25519 public key of the server's identity_key. With it, grants must
+	// carry the server's signature, and the last one is cached per server and
+	// user to shape the handshake of the next connection.
+	ServerIdentity []byte `protobuf:"bytes,36,opt,name=server_identity,json=serverIdentity,proto3" json:"server_identity,omitempty"`
+	// The server's psk.
+	Psk []byte `protobuf:"bytes,37,opt,name=psk,proto3" json:"psk,omitempty"`
+}
+
+func (x *OutboundConfig) Reset() {
+	*x = OutboundConfig{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[12]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *OutboundConfig) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*OutboundConfig) ProtoMessage() {}
+
+func (x *OutboundConfig) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[12]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use OutboundConfig.ProtoReflect.Descriptor instead.
+func (*OutboundConfig) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{12}
+}
+
+func (x *OutboundConfig) GetAddress() string {
+	if x != nil {
+		return x.Address
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetPort() uint32 {
+	if x != nil {
+		return x.Port
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetId() string {
+	if x != nil {
+		return x.Id
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetUplinkPolicy() string {
+	if x != nil {
+		return x.UplinkPolicy
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetDownlinkPolicy() string {
+	if x != nil {
+		return x.DownlinkPolicy
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetFeatures() []string {
+	if x != nil {
+		return x.Features
+	}
+	return nil
+}
+
+func (x *OutboundConfig) GetPadding() string {
+	if x != nil {
+		return x.Padding
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetPuzzleDifficulty() uint32 {
+	if x != nil {
+		return x.PuzzleDifficulty
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetCoalesceWrites() bool {
+	if x != nil {
+		return x.CoalesceWrites
+	}
+	return false
+}
+
+func (x *OutboundConfig) GetWebsocketPath() string {
+	if x != nil {
+		return x.WebsocketPath
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetHost() string {
+	if x != nil {
+		return x.Host
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetChunkedPath() string {
+	if x != nil {
+		return x.ChunkedPath
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetGrpcService() string {
+	if x != nil {
+		return x.GrpcService
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetGrpcMethod() string {
+	if x != nil {
+		return x.GrpcMethod
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetQuic() bool {
+	if x != nil {
+		return x.Quic
+	}
+	return false
+}
+
+func (x *OutboundConfig) GetQuicAllowInsecure() bool {
+	if x != nil {
+		return x.QuicAllowInsecure
+	}
+	return false
+}
+
+func (x *OutboundConfig) GetHttpPath() string {
+	if x != nil {
+		return x.HttpPath
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetHttpHeaders() map[string]string {
+	if x != nil {
+		return x.HttpHeaders
+	}
+	return nil
+}
+
+func (x *OutboundConfig) GetHttpBrowser() string {
+	if x != nil {
+		return x.HttpBrowser
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetFingerprint() string {
+	if x != nil {
+		return x.Fingerprint
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetPoolSize() uint32 {
+	if x != nil {
+		return x.PoolSize
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetPoolMaxAge() uint32 {
+	if x != nil {
+		return x.PoolMaxAge
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetPoolConcurrency() uint32 {
+	if x != nil {
+		return x.PoolConcurrency
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetHappyEyeballs() bool {
+	if x != nil {
+		return x.HappyEyeballs
+	}
+	return false
+}
+
+func (x *OutboundConfig) GetMaxFrameSize() uint32 {
+	if x != nil {
+		return x.MaxFrameSize
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetHighWatermark() uint32 {
+	if x != nil {
+		return x.HighWatermark
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetLowWatermark() uint32 {
+	if x != nil {
+		return x.LowWatermark
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetPortRange() *net.PortRange {
+	if x != nil {
+		return x.PortRange
+	}
+	return nil
+}
+
+func (x *OutboundConfig) GetHopInterval() uint32 {
+	if x != nil {
+		return x.HopInterval
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetFragment() *Fragment {
+	if x != nil {
+		return x.Fragment
+	}
+	return nil
+}
+
+func (x *OutboundConfig) GetHandshakeBinding() string {
+	if x != nil {
+		return x.HandshakeBinding
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetPolicy() string {
+	if x != nil {
+		return x.Policy
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetLevel() uint32 {
+	if x != nil {
+		return x.Level
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetMinProtocolVersion() uint32 {
+	if x != nil {
+		return x.MinProtocolVersion
+	}
+	return 0
+}
+
+func (x *OutboundConfig) GetHttpUpgrade() string {
+	if x != nil {
+		return x.HttpUpgrade
+	}
+	return ""
+}
+
+func (x *OutboundConfig) GetServerIdentity() []byte {
+	if x != nil {
+		return x.ServerIdentity
+	}
+	return nil
+}
+
+func (x *OutboundConfig) GetPsk() []byte {
+	if x != nil {
+		return x.Psk
+	}
+	return nil
+}
+
+// Fragment sends the first flight in pieces of length_min to length_max
+// bytes, pausing interval_min to interval_max milliseconds after each.
+type Fragment struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	LengthMin   uint32 `protobuf:"varint,1,opt,name=length_min,json=lengthMin,proto3" json:"length_min,omitempty"`
+	LengthMax   uint32 `protobuf:"varint,2,opt,name=length_max,json=lengthMax,proto3" json:"length_max,omitempty"`
+	IntervalMin uint32 `protobuf:"varint,3,opt,name=interval_min,json=intervalMin,proto3" json:"interval_min,omitempty"`
+	IntervalMax uint32 `protobuf:"varint,4,opt,name=interval_max,json=intervalMax,proto3" json:"interval_max,omitempty"`
+}
+
+func (x *Fragment) Reset() {
+	*x = Fragment{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[13]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *Fragment) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*Fragment) ProtoMessage() {}
+
+func (x *Fragment) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[13]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use Fragment.ProtoReflect.Descriptor instead.
+func (*Fragment) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{13}
+}
+
+func (x *Fragment) GetLengthMin() uint32 {
+	if x != nil {
+		return x.LengthMin
+	}
+	return 0
+}
+
+func (x *Fragment) GetLengthMax() uint32 {
+	if x != nil {
+		return x.LengthMax
+	}
+	return 0
+}
+
+func (x *Fragment) GetIntervalMin() uint32 {
+	if x != nil {
+		return x.IntervalMin
+	}
+	return 0
+}
+
+func (x *Fragment) GetIntervalMax() uint32 {
+	if x != nil {
+		return x.IntervalMax
+	}
+	return 0
+}
+
+// UpdatePolicyOperation switches the profiles of live sessions through the
+// handler API's AlterInbound. An empty email selects every session; empty
+// policies keep the session's current profile for that direction.
+type UpdatePolicyOperation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Email          string `protobuf:"bytes,1,opt,name=email,proto3" json:"email,omitempty"`
+	UplinkPolicy   string `protobuf:"bytes,2,opt,name=uplink_policy,json=uplinkPolicy,proto3" json:"uplink_policy,omitempty"`
+	DownlinkPolicy string `protobuf:"bytes,3,opt,name=downlink_policy,json=downlinkPolicy,proto3" json:"downlink_policy,omitempty"`
+}
+
+func (x *UpdatePolicyOperation) Reset() {
+	*x = UpdatePolicyOperation{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[14]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *UpdatePolicyOperation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*UpdatePolicyOperation) ProtoMessage() {}
+
+func (x *UpdatePolicyOperation) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[14]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use UpdatePolicyOperation.ProtoReflect.Descriptor instead.
+func (*UpdatePolicyOperation) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{14}
+}
+
+func (x *UpdatePolicyOperation) GetEmail() string {
+	if x != nil {
+		return x.Email
+	}
+	return ""
+}
+
+func (x *UpdatePolicyOperation) GetUplinkPolicy() string {
+	if x != nil {
+		return x.UplinkPolicy
+	}
+	return ""
+}
+
+func (x *UpdatePolicyOperation) GetDownlinkPolicy() string {
+	if x != nil {
+		return x.DownlinkPolicy
+	}
+	return ""
+}
+
+// ReloadOperation swaps an inbound's fallback and policy rate limits
+// through the handler API's AlterInbound without restarting it. Both
+// replace the current ones, so leaving fallback unset removes it. With
+// reload_profiles the inbound also re-reads its profile_dir first.
+type ReloadOperation struct {
+	state         protoimpl.MessageState
+	sizeCache     protoimpl.SizeCache
+	unknownFields protoimpl.UnknownFields
+
+	Fallback         *Fallback             `protobuf:"bytes,1,opt,name=fallback,proto3" json:"fallback,omitempty"`
+	PolicyRateLimits map[string]*RateLimit `protobuf:"bytes,2,rep,name=policy_rate_limits,json=policyRateLimits,proto3" json:"policy_rate_limits,omitempty" protobuf_key:"bytes,1,opt,name=key,proto3" protobuf_val:"bytes,2,opt,name=value,proto3"`
+	ReloadProfiles   bool                  `protobuf:"varint,3,opt,name=reload_profiles,json=reloadProfiles,proto3" json:"reload_profiles,omitempty"`
+}
+
+func (x *ReloadOperation) Reset() {
+	*x = ReloadOperation{}
+	mi := &file_proxy_reflex_config_proto_msgTypes[15]
+	ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+	ms.StoreMessageInfo(mi)
+}
+
+func (x *ReloadOperation) String() string {
+	return protoimpl.X.MessageStringOf(x)
+}
+
+func (*ReloadOperation) ProtoMessage() {}
+
+func (x *ReloadOperation) ProtoReflect() protoreflect.Message {
+	mi := &file_proxy_reflex_config_proto_msgTypes[15]
+	if x != nil {
+		ms := protoimpl.X.MessageStateOf(protoimpl.Pointer(x))
+		if ms.LoadMessageInfo() == nil {
+			ms.StoreMessageInfo(mi)
+		}
+		return ms
+	}
+	return mi.MessageOf(x)
+}
+
+// Deprecated: Use ReloadOperation.ProtoReflect.Descriptor instead.
+func (*ReloadOperation) Descriptor() ([]byte, []int) {
+	return file_proxy_reflex_config_proto_rawDescGZIP(), []int{15}
+}
+
+func (x *ReloadOperation) GetFallback() *Fallback {
+	if x != nil {
+		return x.Fallback
+	}
+	return nil
+}
+
+func (x *ReloadOperation) GetPolicyRateLimits() map[string]*RateLimit {
+	if x != nil {
+		return x.PolicyRateLimits
+	}
+	return nil
+}
+
+func (x *ReloadOperation) GetReloadProfiles() bool {
+	if x != nil {
+		return x.ReloadProfiles
+	}
+	return false
+}
+
 var File_proxy_reflex_config_proto protoreflect.FileDescriptor
 
 var file_proxy_reflex_config_proto_rawDesc = []byte{
 	0x0a, 0x19, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2f, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2f, 0x63,
 	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x12, 0x0c, 0x72, 0x65, 0x66,
-	0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x22, 0x2e, 0x0a, 0x04, 0x55, 0x73, 0x65,
-	0x72, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69,
-	0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x09, 0x52, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x22, 0x19, 0x0a, 0x07, 0x41, 0x63, 0x63,
-	0x6f, 0x75, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09,
-	0x52, 0x02, 0x69, 0x64, 0x22, 0x71, 0x0a, 0x0d, 0x49, 0x6e, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43,
-	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x2c, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73,
-	0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e,
-	0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x07, 0x63, 0x6c, 0x69, 0x65,
-	0x6e, 0x74, 0x73, 0x12, 0x32, 0x0a, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x18,
-	0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70,
-	0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x52, 0x08, 0x66,
-	0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x22, 0x1e, 0x0a, 0x08, 0x46, 0x61, 0x6c, 0x6c, 0x62,
-	0x61, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x65, 0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28,
-	0x0d, 0x52, 0x04, 0x64, 0x65, 0x73, 0x74, 0x22, 0x4e, 0x0a, 0x0e, 0x4f, 0x75, 0x74, 0x62, 0x6f,
-	0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64, 0x64,
-	0x72, 0x65, 0x73, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72,
-	0x65, 0x73, 0x73, 0x12, 0x12, 0x0a, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28,
-	0x0d, 0x52, 0x04, 0x70, 0x6f, 0x72, 0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x03, 0x20,
-	0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x42, 0x28, 0x5a, 0x26, 0x67, 0x69, 0x74, 0x68, 0x75,
-	0x62, 0x2e, 0x63, 0x6f, 0x6d, 0x2f, 0x78, 0x74, 0x6c, 0x73, 0x2f, 0x78, 0x72, 0x61, 0x79, 0x2d,
-	0x63, 0x6f, 0x72, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2f, 0x72, 0x65, 0x66, 0x6c, 0x65,
-	0x78, 0x62, 0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
+	0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x1a, 0x17, 0x61, 0x70, 0x70, 0x2f, 0x72,
+	0x6f, 0x75, 0x74, 0x65, 0x72, 0x2f, 0x63, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x1a, 0x15, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2f, 0x6e, 0x65, 0x74, 0x2f, 0x70,
+	0x6f, 0x72, 0x74, 0x2e, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x22, 0xc4, 0x03, 0x0a, 0x04, 0x55, 0x73,
+	0x65, 0x72, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02,
+	0x69, 0x64, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x32, 0x0a, 0x08, 0x66, 0x61,
+	0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x72,
+	0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x61, 0x6c, 0x6c,
+	0x62, 0x61, 0x63, 0x6b, 0x52, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x23,
+	0x0a, 0x0d, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18,
+	0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c,
+	0x69, 0x63, 0x79, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x5f,
+	0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0e, 0x64, 0x6f,
+	0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x29, 0x0a, 0x10,
+	0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73,
+	0x18, 0x06, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x50,
+	0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x12, 0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c,
+	0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x14, 0x0a,
+	0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05, 0x6c, 0x65,
+	0x76, 0x65, 0x6c, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x73,
+	0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0e, 0x61, 0x6c,
+	0x6c, 0x6f, 0x77, 0x65, 0x64, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e,
+	0x64, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x5f, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x0a,
+	0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x64, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x53, 0x6f, 0x75, 0x72,
+	0x63, 0x65, 0x73, 0x12, 0x36, 0x0a, 0x0a, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78,
+	0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74,
+	0x52, 0x09, 0x72, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x65,
+	0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x5f, 0x61, 0x74, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x03, 0x52,
+	0x09, 0x65, 0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75,
+	0x6f, 0x74, 0x61, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x71, 0x75, 0x6f, 0x74, 0x61,
+	0x22, 0x9b, 0x03, 0x0a, 0x07, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x12, 0x0e, 0x0a, 0x02,
+	0x69, 0x64, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69, 0x64, 0x12, 0x16, 0x0a, 0x06,
+	0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6f,
+	0x6c, 0x69, 0x63, 0x79, 0x12, 0x23, 0x0a, 0x0d, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x5f, 0x70,
+	0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x75, 0x70, 0x6c,
+	0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x6f, 0x77,
+	0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x04, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x0e, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c, 0x69,
+	0x63, 0x79, 0x12, 0x29, 0x0a, 0x10, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x5f, 0x70, 0x6f,
+	0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x18, 0x05, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0f, 0x61, 0x6c,
+	0x6c, 0x6f, 0x77, 0x65, 0x64, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x69, 0x65, 0x73, 0x12, 0x36, 0x0a,
+	0x0a, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74, 0x18, 0x06, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x52, 0x09, 0x72, 0x61, 0x74, 0x65,
+	0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x32, 0x0a, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63,
+	0x6b, 0x18, 0x07, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78,
+	0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x52,
+	0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x27, 0x0a, 0x0f, 0x61, 0x6c, 0x6c,
+	0x6f, 0x77, 0x65, 0x64, 0x5f, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x18, 0x08, 0x20, 0x03,
+	0x28, 0x09, 0x52, 0x0e, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x65, 0x64, 0x53, 0x6f, 0x75, 0x72, 0x63,
+	0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x64, 0x65, 0x6e, 0x69, 0x65, 0x64, 0x5f, 0x73, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x73, 0x18, 0x09, 0x20, 0x03, 0x28, 0x09, 0x52, 0x0d, 0x64, 0x65, 0x6e, 0x69,
+	0x65, 0x64, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x65, 0x78, 0x70,
+	0x69, 0x72, 0x65, 0x73, 0x5f, 0x61, 0x74, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x03, 0x52, 0x09, 0x65,
+	0x78, 0x70, 0x69, 0x72, 0x65, 0x73, 0x41, 0x74, 0x12, 0x14, 0x0a, 0x05, 0x71, 0x75, 0x6f, 0x74,
+	0x61, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x04, 0x52, 0x05, 0x71, 0x75, 0x6f, 0x74, 0x61, 0x22, 0xe6,
+	0x0f, 0x0a, 0x0d, 0x49, 0x6e, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67,
+	0x12, 0x2c, 0x0a, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x12, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x2e, 0x55, 0x73, 0x65, 0x72, 0x52, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x32,
+	0x0a, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b,
+	0x32, 0x16, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e,
+	0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x52, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61,
+	0x63, 0x6b, 0x12, 0x23, 0x0a, 0x0d, 0x63, 0x6f, 0x76, 0x65, 0x72, 0x5f, 0x74, 0x72, 0x61, 0x66,
+	0x66, 0x69, 0x63, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0c, 0x63, 0x6f, 0x76, 0x65, 0x72,
+	0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x12, 0x35, 0x0a, 0x06, 0x70, 0x75, 0x7a, 0x7a, 0x6c,
+	0x65, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1d, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78,
+	0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x50, 0x75, 0x7a, 0x7a, 0x6c, 0x65, 0x52, 0x06, 0x70, 0x75, 0x7a, 0x7a, 0x6c, 0x65, 0x12, 0x1f,
+	0x0a, 0x0b, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x5f, 0x64, 0x69, 0x72, 0x18, 0x05, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0a, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x44, 0x69, 0x72, 0x12,
+	0x27, 0x0a, 0x0f, 0x63, 0x6f, 0x61, 0x6c, 0x65, 0x73, 0x63, 0x65, 0x5f, 0x77, 0x72, 0x69, 0x74,
+	0x65, 0x73, 0x18, 0x06, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x63, 0x6f, 0x61, 0x6c, 0x65, 0x73,
+	0x63, 0x65, 0x57, 0x72, 0x69, 0x74, 0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x77, 0x65, 0x62, 0x73,
+	0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x0d, 0x77, 0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x50, 0x61, 0x74, 0x68, 0x12,
+	0x21, 0x0a, 0x0c, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x18,
+	0x08, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x67, 0x72, 0x70, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69,
+	0x63, 0x65, 0x12, 0x1f, 0x0a, 0x0b, 0x67, 0x72, 0x70, 0x63, 0x5f, 0x6d, 0x65, 0x74, 0x68, 0x6f,
+	0x64, 0x18, 0x09, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x67, 0x72, 0x70, 0x63, 0x4d, 0x65, 0x74,
+	0x68, 0x6f, 0x64, 0x12, 0x1f, 0x0a, 0x0b, 0x71, 0x75, 0x69, 0x63, 0x5f, 0x6c, 0x69, 0x73, 0x74,
+	0x65, 0x6e, 0x18, 0x0a, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x71, 0x75, 0x69, 0x63, 0x4c, 0x69,
+	0x73, 0x74, 0x65, 0x6e, 0x12, 0x32, 0x0a, 0x15, 0x71, 0x75, 0x69, 0x63, 0x5f, 0x63, 0x65, 0x72,
+	0x74, 0x69, 0x66, 0x69, 0x63, 0x61, 0x74, 0x65, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x0b, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x13, 0x71, 0x75, 0x69, 0x63, 0x43, 0x65, 0x72, 0x74, 0x69, 0x66, 0x69,
+	0x63, 0x61, 0x74, 0x65, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x22, 0x0a, 0x0d, 0x71, 0x75, 0x69, 0x63,
+	0x5f, 0x6b, 0x65, 0x79, 0x5f, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x71, 0x75, 0x69, 0x63, 0x4b, 0x65, 0x79, 0x46, 0x69, 0x6c, 0x65, 0x12, 0x1d, 0x0a, 0x0a,
+	0x68, 0x74, 0x74, 0x70, 0x5f, 0x68, 0x6f, 0x73, 0x74, 0x73, 0x18, 0x0d, 0x20, 0x03, 0x28, 0x09,
+	0x52, 0x09, 0x68, 0x74, 0x74, 0x70, 0x48, 0x6f, 0x73, 0x74, 0x73, 0x12, 0x1d, 0x0a, 0x0a, 0x68,
+	0x74, 0x74, 0x70, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x73, 0x18, 0x0e, 0x20, 0x03, 0x28, 0x09, 0x52,
+	0x09, 0x68, 0x74, 0x74, 0x70, 0x50, 0x61, 0x74, 0x68, 0x73, 0x12, 0x4f, 0x0a, 0x0c, 0x68, 0x74,
+	0x74, 0x70, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x0f, 0x20, 0x03, 0x28, 0x0b,
+	0x32, 0x2c, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e,
+	0x49, 0x6e, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x48, 0x74,
+	0x74, 0x70, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x0b,
+	0x68, 0x74, 0x74, 0x70, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x24, 0x0a, 0x0e, 0x6d,
+	0x61, 0x78, 0x5f, 0x66, 0x72, 0x61, 0x6d, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x10, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0c, 0x6d, 0x61, 0x78, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x69, 0x7a,
+	0x65, 0x12, 0x25, 0x0a, 0x0e, 0x68, 0x69, 0x67, 0x68, 0x5f, 0x77, 0x61, 0x74, 0x65, 0x72, 0x6d,
+	0x61, 0x72, 0x6b, 0x18, 0x11, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x68, 0x69, 0x67, 0x68, 0x57,
+	0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x12, 0x23, 0x0a, 0x0d, 0x6c, 0x6f, 0x77, 0x5f,
+	0x77, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x18, 0x12, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0c, 0x6c, 0x6f, 0x77, 0x57, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x12, 0x23, 0x0a,
+	0x0d, 0x6c, 0x6f, 0x67, 0x5f, 0x76, 0x65, 0x72, 0x62, 0x6f, 0x73, 0x69, 0x74, 0x79, 0x18, 0x13,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x6c, 0x6f, 0x67, 0x56, 0x65, 0x72, 0x62, 0x6f, 0x73, 0x69,
+	0x74, 0x79, 0x12, 0x1b, 0x0a, 0x09, 0x6c, 0x6f, 0x67, 0x5f, 0x75, 0x73, 0x65, 0x72, 0x73, 0x18,
+	0x14, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x6c, 0x6f, 0x67, 0x55, 0x73, 0x65, 0x72, 0x73, 0x12,
+	0x1b, 0x0a, 0x09, 0x61, 0x75, 0x64, 0x69, 0x74, 0x5f, 0x6c, 0x6f, 0x67, 0x18, 0x15, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x08, 0x61, 0x75, 0x64, 0x69, 0x74, 0x4c, 0x6f, 0x67, 0x12, 0x28, 0x0a, 0x10,
+	0x61, 0x75, 0x64, 0x69, 0x74, 0x5f, 0x61, 0x63, 0x63, 0x65, 0x73, 0x73, 0x5f, 0x6c, 0x6f, 0x67,
+	0x18, 0x16, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x61, 0x75, 0x64, 0x69, 0x74, 0x41, 0x63, 0x63,
+	0x65, 0x73, 0x73, 0x4c, 0x6f, 0x67, 0x12, 0x36, 0x0a, 0x0a, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x5f, 0x62, 0x61, 0x6e, 0x18, 0x17, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x66,
+	0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x53, 0x6f, 0x75, 0x72, 0x63, 0x65,
+	0x42, 0x61, 0x6e, 0x52, 0x09, 0x73, 0x6f, 0x75, 0x72, 0x63, 0x65, 0x42, 0x61, 0x6e, 0x12, 0x3c,
+	0x0a, 0x0c, 0x61, 0x75, 0x74, 0x68, 0x5f, 0x62, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x18, 0x18,
+	0x20, 0x01, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72,
+	0x6f, 0x78, 0x79, 0x2e, 0x41, 0x75, 0x74, 0x68, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x52,
+	0x0b, 0x61, 0x75, 0x74, 0x68, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x5f, 0x0a, 0x12,
+	0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69,
+	0x74, 0x73, 0x18, 0x19, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x31, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65,
+	0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x49, 0x6e, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43,
+	0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x61, 0x74, 0x65,
+	0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x10, 0x70, 0x6f, 0x6c,
+	0x69, 0x63, 0x79, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x12, 0x4e, 0x0a,
+	0x12, 0x74, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x5f, 0x61, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74,
+	0x69, 0x6e, 0x67, 0x18, 0x1a, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x72, 0x65, 0x66, 0x6c,
+	0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63,
+	0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x52, 0x11, 0x74, 0x72, 0x61, 0x66,
+	0x66, 0x69, 0x63, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x2b, 0x0a,
+	0x11, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x5f, 0x62, 0x69, 0x6e, 0x64, 0x69,
+	0x6e, 0x67, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68,
+	0x61, 0x6b, 0x65, 0x42, 0x69, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x75, 0x73,
+	0x65, 0x72, 0x5f, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x75, 0x73, 0x65, 0x72, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x12, 0x32, 0x0a, 0x15, 0x68, 0x74, 0x74,
+	0x70, 0x5f, 0x72, 0x65, 0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x73, 0x18, 0x1d, 0x20, 0x03, 0x28, 0x09, 0x52, 0x13, 0x68, 0x74, 0x74, 0x70, 0x52, 0x65,
+	0x71, 0x75, 0x69, 0x72, 0x65, 0x64, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x2a, 0x0a,
+	0x11, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x63, 0x6f, 0x6e, 0x74, 0x65, 0x6e, 0x74, 0x5f, 0x74, 0x79,
+	0x70, 0x65, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0f, 0x68, 0x74, 0x74, 0x70, 0x43, 0x6f,
+	0x6e, 0x74, 0x65, 0x6e, 0x74, 0x54, 0x79, 0x70, 0x65, 0x12, 0x38, 0x0a, 0x18, 0x68, 0x61, 0x6e,
+	0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x5f,
+	0x66, 0x6c, 0x6f, 0x6f, 0x72, 0x18, 0x1f, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x16, 0x68, 0x61, 0x6e,
+	0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x46, 0x6c,
+	0x6f, 0x6f, 0x72, 0x12, 0x1d, 0x0a, 0x0a, 0x6d, 0x61, 0x78, 0x5f, 0x6e, 0x6f, 0x6e, 0x63, 0x65,
+	0x73, 0x18, 0x20, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6d, 0x61, 0x78, 0x4e, 0x6f, 0x6e, 0x63,
+	0x65, 0x73, 0x12, 0x27, 0x0a, 0x0f, 0x65, 0x6e, 0x74, 0x72, 0x6f, 0x70, 0x79, 0x5f, 0x6d, 0x6f,
+	0x6e, 0x69, 0x74, 0x6f, 0x72, 0x18, 0x21, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x65, 0x6e, 0x74,
+	0x72, 0x6f, 0x70, 0x79, 0x4d, 0x6f, 0x6e, 0x69, 0x74, 0x6f, 0x72, 0x12, 0x1c, 0x0a, 0x09, 0x75,
+	0x6e, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x18, 0x22, 0x20, 0x01, 0x28, 0x09, 0x52, 0x09,
+	0x75, 0x6e, 0x6d, 0x61, 0x74, 0x63, 0x68, 0x65, 0x64, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x61, 0x78,
+	0x5f, 0x73, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x18, 0x23, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x0b, 0x6d, 0x61, 0x78, 0x53, 0x65, 0x73, 0x73, 0x69, 0x6f, 0x6e, 0x73, 0x12, 0x23, 0x0a, 0x0d,
+	0x64, 0x72, 0x61, 0x69, 0x6e, 0x5f, 0x74, 0x69, 0x6d, 0x65, 0x6f, 0x75, 0x74, 0x18, 0x24, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x0c, 0x64, 0x72, 0x61, 0x69, 0x6e, 0x54, 0x69, 0x6d, 0x65, 0x6f, 0x75,
+	0x74, 0x12, 0x1f, 0x0a, 0x0b, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72,
+	0x18, 0x25, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0a, 0x68, 0x74, 0x74, 0x70, 0x53, 0x65, 0x72, 0x76,
+	0x65, 0x72, 0x12, 0x68, 0x0a, 0x15, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x72, 0x65, 0x73, 0x70, 0x6f,
+	0x6e, 0x73, 0x65, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x26, 0x20, 0x03, 0x28,
+	0x0b, 0x32, 0x34, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x2e, 0x49, 0x6e, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x2e, 0x48,
+	0x74, 0x74, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65,
+	0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x13, 0x68, 0x74, 0x74, 0x70, 0x52, 0x65, 0x73,
+	0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x12, 0x21, 0x0a, 0x0c,
+	0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x5f, 0x6b, 0x65, 0x79, 0x18, 0x27, 0x20, 0x01,
+	0x28, 0x0c, 0x52, 0x0b, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x4b, 0x65, 0x79, 0x12,
+	0x10, 0x0a, 0x03, 0x70, 0x73, 0x6b, 0x18, 0x28, 0x20, 0x01, 0x28, 0x0c, 0x52, 0x03, 0x70, 0x73,
+	0x6b, 0x1a, 0x3e, 0x0a, 0x10, 0x48, 0x74, 0x74, 0x70, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
+	0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01,
+	0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65,
+	0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38,
+	0x01, 0x1a, 0x5c, 0x0a, 0x15, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x61, 0x74, 0x65, 0x4c,
+	0x69, 0x6d, 0x69, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65,
+	0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x2d, 0x0a, 0x05,
+	0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65,
+	0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c,
+	0x69, 0x6d, 0x69, 0x74, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x1a,
+	0x46, 0x0a, 0x18, 0x48, 0x74, 0x74, 0x70, 0x52, 0x65, 0x73, 0x70, 0x6f, 0x6e, 0x73, 0x65, 0x48,
+	0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b,
+	0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a,
+	0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61,
+	0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x42, 0x0a, 0x0f, 0x55, 0x73, 0x65, 0x72, 0x53,
+	0x74, 0x6f, 0x72, 0x65, 0x43, 0x6f, 0x6e, 0x66, 0x69, 0x67, 0x12, 0x2f, 0x0a, 0x06, 0x73, 0x74,
+	0x6f, 0x72, 0x65, 0x73, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x66,
+	0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x55, 0x73, 0x65, 0x72, 0x53, 0x74,
+	0x6f, 0x72, 0x65, 0x52, 0x06, 0x73, 0x74, 0x6f, 0x72, 0x65, 0x73, 0x22, 0xbc, 0x01, 0x0a, 0x09,
+	0x55, 0x73, 0x65, 0x72, 0x53, 0x74, 0x6f, 0x72, 0x65, 0x12, 0x12, 0x0a, 0x04, 0x6e, 0x61, 0x6d,
+	0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x6e, 0x61, 0x6d, 0x65, 0x12, 0x2c, 0x0a,
+	0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x12,
+	0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x55, 0x73,
+	0x65, 0x72, 0x52, 0x07, 0x63, 0x6c, 0x69, 0x65, 0x6e, 0x74, 0x73, 0x12, 0x4e, 0x0a, 0x12, 0x74,
+	0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x5f, 0x61, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e,
+	0x67, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1f, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78,
+	0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x54, 0x72, 0x61, 0x66, 0x66, 0x69, 0x63, 0x41, 0x63,
+	0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x52, 0x11, 0x74, 0x72, 0x61, 0x66, 0x66, 0x69,
+	0x63, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x12, 0x1d, 0x0a, 0x0a, 0x6d,
+	0x61, 0x78, 0x5f, 0x6e, 0x6f, 0x6e, 0x63, 0x65, 0x73, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x09, 0x6d, 0x61, 0x78, 0x4e, 0x6f, 0x6e, 0x63, 0x65, 0x73, 0x22, 0x4e, 0x0a, 0x11, 0x54, 0x72,
+	0x61, 0x66, 0x66, 0x69, 0x63, 0x41, 0x63, 0x63, 0x6f, 0x75, 0x6e, 0x74, 0x69, 0x6e, 0x67, 0x12,
+	0x12, 0x0a, 0x04, 0x66, 0x69, 0x6c, 0x65, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x04, 0x66,
+	0x69, 0x6c, 0x65, 0x12, 0x25, 0x0a, 0x0e, 0x66, 0x6c, 0x75, 0x73, 0x68, 0x5f, 0x69, 0x6e, 0x74,
+	0x65, 0x72, 0x76, 0x61, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x66, 0x6c, 0x75,
+	0x73, 0x68, 0x49, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x22, 0x3f, 0x0a, 0x09, 0x52, 0x61,
+	0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x12, 0x16, 0x0a, 0x06, 0x75, 0x70, 0x6c, 0x69, 0x6e,
+	0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x04, 0x52, 0x06, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x12,
+	0x1a, 0x0a, 0x08, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x04, 0x52, 0x08, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x22, 0x56, 0x0a, 0x0b, 0x41,
+	0x75, 0x74, 0x68, 0x42, 0x61, 0x63, 0x6b, 0x65, 0x6e, 0x64, 0x12, 0x10, 0x0a, 0x03, 0x75, 0x72,
+	0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x75, 0x72, 0x6c, 0x12, 0x1b, 0x0a, 0x09,
+	0x63, 0x61, 0x63, 0x68, 0x65, 0x5f, 0x74, 0x74, 0x6c, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52,
+	0x08, 0x63, 0x61, 0x63, 0x68, 0x65, 0x54, 0x74, 0x6c, 0x12, 0x18, 0x0a, 0x07, 0x74, 0x69, 0x6d,
+	0x65, 0x6f, 0x75, 0x74, 0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x07, 0x74, 0x69, 0x6d, 0x65,
+	0x6f, 0x75, 0x74, 0x22, 0x54, 0x0a, 0x0f, 0x48, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x50, 0x75, 0x7a, 0x7a, 0x6c, 0x65, 0x12, 0x1e, 0x0a, 0x0a, 0x64, 0x69, 0x66, 0x66, 0x69, 0x63,
+	0x75, 0x6c, 0x74, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x64, 0x69, 0x66, 0x66,
+	0x69, 0x63, 0x75, 0x6c, 0x74, 0x79, 0x12, 0x21, 0x0a, 0x0c, 0x74, 0x72, 0x69, 0x67, 0x67, 0x65,
+	0x72, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x74, 0x72,
+	0x69, 0x67, 0x67, 0x65, 0x72, 0x52, 0x61, 0x74, 0x65, 0x22, 0x62, 0x0a, 0x09, 0x53, 0x6f, 0x75,
+	0x72, 0x63, 0x65, 0x42, 0x61, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x6d, 0x61, 0x78, 0x5f, 0x66, 0x61,
+	0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x6d, 0x61,
+	0x78, 0x46, 0x61, 0x69, 0x6c, 0x75, 0x72, 0x65, 0x73, 0x12, 0x16, 0x0a, 0x06, 0x77, 0x69, 0x6e,
+	0x64, 0x6f, 0x77, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x06, 0x77, 0x69, 0x6e, 0x64, 0x6f,
+	0x77, 0x12, 0x1a, 0x0a, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x08, 0x64, 0x75, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x22, 0xbf, 0x02,
+	0x0a, 0x08, 0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x12, 0x0a, 0x04, 0x64, 0x65,
+	0x73, 0x74, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x64, 0x65, 0x73, 0x74, 0x12, 0x2b,
+	0x0a, 0x03, 0x67, 0x65, 0x6f, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x19, 0x2e, 0x72, 0x65,
+	0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x47, 0x65, 0x6f, 0x46, 0x61,
+	0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x52, 0x03, 0x67, 0x65, 0x6f, 0x12, 0x1a, 0x0a, 0x08, 0x70,
+	0x72, 0x65, 0x66, 0x65, 0x74, 0x63, 0x68, 0x18, 0x03, 0x20, 0x03, 0x28, 0x09, 0x52, 0x08, 0x70,
+	0x72, 0x65, 0x66, 0x65, 0x74, 0x63, 0x68, 0x12, 0x29, 0x0a, 0x10, 0x70, 0x72, 0x65, 0x66, 0x65,
+	0x74, 0x63, 0x68, 0x5f, 0x72, 0x65, 0x66, 0x72, 0x65, 0x73, 0x68, 0x18, 0x04, 0x20, 0x01, 0x28,
+	0x0d, 0x52, 0x0f, 0x70, 0x72, 0x65, 0x66, 0x65, 0x74, 0x63, 0x68, 0x52, 0x65, 0x66, 0x72, 0x65,
+	0x73, 0x68, 0x12, 0x23, 0x0a, 0x0d, 0x70, 0x72, 0x65, 0x66, 0x65, 0x74, 0x63, 0x68, 0x5f, 0x68,
+	0x6f, 0x73, 0x74, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x70, 0x72, 0x65, 0x66, 0x65,
+	0x74, 0x63, 0x68, 0x48, 0x6f, 0x73, 0x74, 0x12, 0x47, 0x0a, 0x0b, 0x65, 0x72, 0x72, 0x6f, 0x72,
+	0x5f, 0x70, 0x61, 0x67, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x26, 0x2e, 0x72,
+	0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x61, 0x6c, 0x6c,
+	0x62, 0x61, 0x63, 0x6b, 0x2e, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x50, 0x61, 0x67, 0x65, 0x73, 0x45,
+	0x6e, 0x74, 0x72, 0x79, 0x52, 0x0a, 0x65, 0x72, 0x72, 0x6f, 0x72, 0x50, 0x61, 0x67, 0x65, 0x73,
+	0x1a, 0x3d, 0x0a, 0x0f, 0x45, 0x72, 0x72, 0x6f, 0x72, 0x50, 0x61, 0x67, 0x65, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x3a, 0x02, 0x38, 0x01, 0x22,
+	0x4f, 0x0a, 0x0b, 0x47, 0x65, 0x6f, 0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x2c,
+	0x0a, 0x05, 0x67, 0x65, 0x6f, 0x69, 0x70, 0x18, 0x01, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x16, 0x2e,
+	0x78, 0x72, 0x61, 0x79, 0x2e, 0x61, 0x70, 0x70, 0x2e, 0x72, 0x6f, 0x75, 0x74, 0x65, 0x72, 0x2e,
+	0x47, 0x65, 0x6f, 0x49, 0x50, 0x52, 0x05, 0x67, 0x65, 0x6f, 0x69, 0x70, 0x12, 0x12, 0x0a, 0x04,
+	0x64, 0x65, 0x73, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x64, 0x65, 0x73, 0x74,
+	0x22, 0x82, 0x0b, 0x0a, 0x0e, 0x4f, 0x75, 0x74, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e,
+	0x66, 0x69, 0x67, 0x12, 0x18, 0x0a, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x18, 0x01,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x61, 0x64, 0x64, 0x72, 0x65, 0x73, 0x73, 0x12, 0x12, 0x0a,
+	0x04, 0x70, 0x6f, 0x72, 0x74, 0x18, 0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x04, 0x70, 0x6f, 0x72,
+	0x74, 0x12, 0x0e, 0x0a, 0x02, 0x69, 0x64, 0x18, 0x03, 0x20, 0x01, 0x28, 0x09, 0x52, 0x02, 0x69,
+	0x64, 0x12, 0x23, 0x0a, 0x0d, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x5f, 0x70, 0x6f, 0x6c, 0x69,
+	0x63, 0x79, 0x18, 0x04, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b,
+	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69,
+	0x6e, 0x6b, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x05, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0e, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12,
+	0x1a, 0x0a, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x18, 0x06, 0x20, 0x03, 0x28,
+	0x09, 0x52, 0x08, 0x66, 0x65, 0x61, 0x74, 0x75, 0x72, 0x65, 0x73, 0x12, 0x18, 0x0a, 0x07, 0x70,
+	0x61, 0x64, 0x64, 0x69, 0x6e, 0x67, 0x18, 0x07, 0x20, 0x01, 0x28, 0x09, 0x52, 0x07, 0x70, 0x61,
+	0x64, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x2b, 0x0a, 0x11, 0x70, 0x75, 0x7a, 0x7a, 0x6c, 0x65, 0x5f,
+	0x64, 0x69, 0x66, 0x66, 0x69, 0x63, 0x75, 0x6c, 0x74, 0x79, 0x18, 0x08, 0x20, 0x01, 0x28, 0x0d,
+	0x52, 0x10, 0x70, 0x75, 0x7a, 0x7a, 0x6c, 0x65, 0x44, 0x69, 0x66, 0x66, 0x69, 0x63, 0x75, 0x6c,
+	0x74, 0x79, 0x12, 0x27, 0x0a, 0x0f, 0x63, 0x6f, 0x61, 0x6c, 0x65, 0x73, 0x63, 0x65, 0x5f, 0x77,
+	0x72, 0x69, 0x74, 0x65, 0x73, 0x18, 0x09, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x63, 0x6f, 0x61,
+	0x6c, 0x65, 0x73, 0x63, 0x65, 0x57, 0x72, 0x69, 0x74, 0x65, 0x73, 0x12, 0x25, 0x0a, 0x0e, 0x77,
+	0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x0a, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0d, 0x77, 0x65, 0x62, 0x73, 0x6f, 0x63, 0x6b, 0x65, 0x74, 0x50, 0x61,
+	0x74, 0x68, 0x12, 0x12, 0x0a, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x18, 0x0b, 0x20, 0x01, 0x28, 0x09,
+	0x52, 0x04, 0x68, 0x6f, 0x73, 0x74, 0x12, 0x21, 0x0a, 0x0c, 0x63, 0x68, 0x75, 0x6e, 0x6b, 0x65,
+	0x64, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x0c, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x63, 0x68,
+	0x75, 0x6e, 0x6b, 0x65, 0x64, 0x50, 0x61, 0x74, 0x68, 0x12, 0x21, 0x0a, 0x0c, 0x67, 0x72, 0x70,
+	0x63, 0x5f, 0x73, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x18, 0x0d, 0x20, 0x01, 0x28, 0x09, 0x52,
+	0x0b, 0x67, 0x72, 0x70, 0x63, 0x53, 0x65, 0x72, 0x76, 0x69, 0x63, 0x65, 0x12, 0x1f, 0x0a, 0x0b,
+	0x67, 0x72, 0x70, 0x63, 0x5f, 0x6d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x18, 0x0e, 0x20, 0x01, 0x28,
+	0x09, 0x52, 0x0a, 0x67, 0x72, 0x70, 0x63, 0x4d, 0x65, 0x74, 0x68, 0x6f, 0x64, 0x12, 0x12, 0x0a,
+	0x04, 0x71, 0x75, 0x69, 0x63, 0x18, 0x0f, 0x20, 0x01, 0x28, 0x08, 0x52, 0x04, 0x71, 0x75, 0x69,
+	0x63, 0x12, 0x2e, 0x0a, 0x13, 0x71, 0x75, 0x69, 0x63, 0x5f, 0x61, 0x6c, 0x6c, 0x6f, 0x77, 0x5f,
+	0x69, 0x6e, 0x73, 0x65, 0x63, 0x75, 0x72, 0x65, 0x18, 0x10, 0x20, 0x01, 0x28, 0x08, 0x52, 0x11,
+	0x71, 0x75, 0x69, 0x63, 0x41, 0x6c, 0x6c, 0x6f, 0x77, 0x49, 0x6e, 0x73, 0x65, 0x63, 0x75, 0x72,
+	0x65, 0x12, 0x1b, 0x0a, 0x09, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x70, 0x61, 0x74, 0x68, 0x18, 0x11,
+	0x20, 0x01, 0x28, 0x09, 0x52, 0x08, 0x68, 0x74, 0x74, 0x70, 0x50, 0x61, 0x74, 0x68, 0x12, 0x50,
+	0x0a, 0x0c, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x68, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x18, 0x12,
+	0x20, 0x03, 0x28, 0x0b, 0x32, 0x2d, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72,
+	0x6f, 0x78, 0x79, 0x2e, 0x4f, 0x75, 0x74, 0x62, 0x6f, 0x75, 0x6e, 0x64, 0x43, 0x6f, 0x6e, 0x66,
+	0x69, 0x67, 0x2e, 0x48, 0x74, 0x74, 0x70, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73, 0x45, 0x6e,
+	0x74, 0x72, 0x79, 0x52, 0x0b, 0x68, 0x74, 0x74, 0x70, 0x48, 0x65, 0x61, 0x64, 0x65, 0x72, 0x73,
+	0x12, 0x21, 0x0a, 0x0c, 0x68, 0x74, 0x74, 0x70, 0x5f, 0x62, 0x72, 0x6f, 0x77, 0x73, 0x65, 0x72,
+	0x18, 0x13, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x68, 0x74, 0x74, 0x70, 0x42, 0x72, 0x6f, 0x77,
+	0x73, 0x65, 0x72, 0x12, 0x20, 0x0a, 0x0b, 0x66, 0x69, 0x6e, 0x67, 0x65, 0x72, 0x70, 0x72, 0x69,
+	0x6e, 0x74, 0x18, 0x14, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x66, 0x69, 0x6e, 0x67, 0x65, 0x72,
+	0x70, 0x72, 0x69, 0x6e, 0x74, 0x12, 0x1b, 0x0a, 0x09, 0x70, 0x6f, 0x6f, 0x6c, 0x5f, 0x73, 0x69,
+	0x7a, 0x65, 0x18, 0x15, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x08, 0x70, 0x6f, 0x6f, 0x6c, 0x53, 0x69,
+	0x7a, 0x65, 0x12, 0x20, 0x0a, 0x0c, 0x70, 0x6f, 0x6f, 0x6c, 0x5f, 0x6d, 0x61, 0x78, 0x5f, 0x61,
+	0x67, 0x65, 0x18, 0x16, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0a, 0x70, 0x6f, 0x6f, 0x6c, 0x4d, 0x61,
+	0x78, 0x41, 0x67, 0x65, 0x12, 0x29, 0x0a, 0x10, 0x70, 0x6f, 0x6f, 0x6c, 0x5f, 0x63, 0x6f, 0x6e,
+	0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x18, 0x17, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0f,
+	0x70, 0x6f, 0x6f, 0x6c, 0x43, 0x6f, 0x6e, 0x63, 0x75, 0x72, 0x72, 0x65, 0x6e, 0x63, 0x79, 0x12,
+	0x25, 0x0a, 0x0e, 0x68, 0x61, 0x70, 0x70, 0x79, 0x5f, 0x65, 0x79, 0x65, 0x62, 0x61, 0x6c, 0x6c,
+	0x73, 0x18, 0x18, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0d, 0x68, 0x61, 0x70, 0x70, 0x79, 0x45, 0x79,
+	0x65, 0x62, 0x61, 0x6c, 0x6c, 0x73, 0x12, 0x24, 0x0a, 0x0e, 0x6d, 0x61, 0x78, 0x5f, 0x66, 0x72,
+	0x61, 0x6d, 0x65, 0x5f, 0x73, 0x69, 0x7a, 0x65, 0x18, 0x19, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c,
+	0x6d, 0x61, 0x78, 0x46, 0x72, 0x61, 0x6d, 0x65, 0x53, 0x69, 0x7a, 0x65, 0x12, 0x25, 0x0a, 0x0e,
+	0x68, 0x69, 0x67, 0x68, 0x5f, 0x77, 0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x18, 0x1a,
+	0x20, 0x01, 0x28, 0x0d, 0x52, 0x0d, 0x68, 0x69, 0x67, 0x68, 0x57, 0x61, 0x74, 0x65, 0x72, 0x6d,
+	0x61, 0x72, 0x6b, 0x12, 0x23, 0x0a, 0x0d, 0x6c, 0x6f, 0x77, 0x5f, 0x77, 0x61, 0x74, 0x65, 0x72,
+	0x6d, 0x61, 0x72, 0x6b, 0x18, 0x1b, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0c, 0x6c, 0x6f, 0x77, 0x57,
+	0x61, 0x74, 0x65, 0x72, 0x6d, 0x61, 0x72, 0x6b, 0x12, 0x39, 0x0a, 0x0a, 0x70, 0x6f, 0x72, 0x74,
+	0x5f, 0x72, 0x61, 0x6e, 0x67, 0x65, 0x18, 0x1c, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x1a, 0x2e, 0x78,
+	0x72, 0x61, 0x79, 0x2e, 0x63, 0x6f, 0x6d, 0x6d, 0x6f, 0x6e, 0x2e, 0x6e, 0x65, 0x74, 0x2e, 0x50,
+	0x6f, 0x72, 0x74, 0x52, 0x61, 0x6e, 0x67, 0x65, 0x52, 0x09, 0x70, 0x6f, 0x72, 0x74, 0x52, 0x61,
+	0x6e, 0x67, 0x65, 0x12, 0x21, 0x0a, 0x0c, 0x68, 0x6f, 0x70, 0x5f, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x76, 0x61, 0x6c, 0x18, 0x1d, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x68, 0x6f, 0x70, 0x49, 0x6e,
+	0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x12, 0x32, 0x0a, 0x08, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x18, 0x1e, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65,
+	0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74,
+	0x52, 0x08, 0x66, 0x72, 0x61, 0x67, 0x6d, 0x65, 0x6e, 0x74, 0x12, 0x2b, 0x0a, 0x11, 0x68, 0x61,
+	0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65, 0x5f, 0x62, 0x69, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x18,
+	0x1f, 0x20, 0x01, 0x28, 0x09, 0x52, 0x10, 0x68, 0x61, 0x6e, 0x64, 0x73, 0x68, 0x61, 0x6b, 0x65,
+	0x42, 0x69, 0x6e, 0x64, 0x69, 0x6e, 0x67, 0x12, 0x16, 0x0a, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63,
+	0x79, 0x18, 0x20, 0x20, 0x01, 0x28, 0x09, 0x52, 0x06, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12,
+	0x14, 0x0a, 0x05, 0x6c, 0x65, 0x76, 0x65, 0x6c, 0x18, 0x21, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x05,
+	0x6c, 0x65, 0x76, 0x65, 0x6c, 0x12, 0x30, 0x0a, 0x14, 0x6d, 0x69, 0x6e, 0x5f, 0x70, 0x72, 0x6f,
+	0x74, 0x6f, 0x63, 0x6f, 0x6c, 0x5f, 0x76, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x18, 0x22, 0x20,
+	0x01, 0x28, 0x0d, 0x52, 0x12, 0x6d, 0x69, 0x6e, 0x50, 0x72, 0x6f, 0x74, 0x6f, 0x63, 0x6f, 0x6c,
+	0x56, 0x65, 0x72, 0x73, 0x69, 0x6f, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x68, 0x74, 0x74, 0x70, 0x5f,
+	0x75, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x18, 0x23, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0b, 0x68,
+	0x74, 0x74, 0x70, 0x55, 0x70, 0x67, 0x72, 0x61, 0x64, 0x65, 0x12, 0x27, 0x0a, 0x0f, 0x73, 0x65,
+	0x72, 0x76, 0x65, 0x72, 0x5f, 0x69, 0x64, 0x65, 0x6e, 0x74, 0x69, 0x74, 0x79, 0x18, 0x24, 0x20,
+	0x01, 0x28, 0x0c, 0x52, 0x0e, 0x73, 0x65, 0x72, 0x76, 0x65, 0x72, 0x49, 0x64, 0x65, 0x6e, 0x74,
+	0x69, 0x74, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x70, 0x73, 0x6b, 0x18, 0x25, 0x20, 0x01, 0x28, 0x0c,
+	0x52, 0x03, 0x70, 0x73, 0x6b, 0x1a, 0x3e, 0x0a, 0x10, 0x48, 0x74, 0x74, 0x70, 0x48, 0x65, 0x61,
+	0x64, 0x65, 0x72, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b, 0x65, 0x79, 0x12, 0x14, 0x0a, 0x05, 0x76,
+	0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x3a, 0x02, 0x38, 0x01, 0x22, 0x8e, 0x01, 0x0a, 0x08, 0x46, 0x72, 0x61, 0x67, 0x6d, 0x65,
+	0x6e, 0x74, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x5f, 0x6d, 0x69, 0x6e,
+	0x18, 0x01, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x4d, 0x69,
+	0x6e, 0x12, 0x1d, 0x0a, 0x0a, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x5f, 0x6d, 0x61, 0x78, 0x18,
+	0x02, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x09, 0x6c, 0x65, 0x6e, 0x67, 0x74, 0x68, 0x4d, 0x61, 0x78,
+	0x12, 0x21, 0x0a, 0x0c, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x5f, 0x6d, 0x69, 0x6e,
+	0x18, 0x03, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c,
+	0x4d, 0x69, 0x6e, 0x12, 0x21, 0x0a, 0x0c, 0x69, 0x6e, 0x74, 0x65, 0x72, 0x76, 0x61, 0x6c, 0x5f,
+	0x6d, 0x61, 0x78, 0x18, 0x04, 0x20, 0x01, 0x28, 0x0d, 0x52, 0x0b, 0x69, 0x6e, 0x74, 0x65, 0x72,
+	0x76, 0x61, 0x6c, 0x4d, 0x61, 0x78, 0x22, 0x7b, 0x0a, 0x15, 0x55, 0x70, 0x64, 0x61, 0x74, 0x65,
+	0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x4f, 0x70, 0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12,
+	0x14, 0x0a, 0x05, 0x65, 0x6d, 0x61, 0x69, 0x6c, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x05,
+	0x65, 0x6d, 0x61, 0x69, 0x6c, 0x12, 0x23, 0x0a, 0x0d, 0x75, 0x70, 0x6c, 0x69, 0x6e, 0x6b, 0x5f,
+	0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x02, 0x20, 0x01, 0x28, 0x09, 0x52, 0x0c, 0x75, 0x70,
+	0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x12, 0x27, 0x0a, 0x0f, 0x64, 0x6f,
+	0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x5f, 0x70, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x18, 0x03, 0x20,
+	0x01, 0x28, 0x09, 0x52, 0x0e, 0x64, 0x6f, 0x77, 0x6e, 0x6c, 0x69, 0x6e, 0x6b, 0x50, 0x6f, 0x6c,
+	0x69, 0x63, 0x79, 0x22, 0xaf, 0x02, 0x0a, 0x0f, 0x52, 0x65, 0x6c, 0x6f, 0x61, 0x64, 0x4f, 0x70,
+	0x65, 0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x12, 0x32, 0x0a, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62,
+	0x61, 0x63, 0x6b, 0x18, 0x01, 0x20, 0x01, 0x28, 0x0b, 0x32, 0x16, 0x2e, 0x72, 0x65, 0x66, 0x6c,
+	0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x46, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63,
+	0x6b, 0x52, 0x08, 0x66, 0x61, 0x6c, 0x6c, 0x62, 0x61, 0x63, 0x6b, 0x12, 0x61, 0x0a, 0x12, 0x70,
+	0x6f, 0x6c, 0x69, 0x63, 0x79, 0x5f, 0x72, 0x61, 0x74, 0x65, 0x5f, 0x6c, 0x69, 0x6d, 0x69, 0x74,
+	0x73, 0x18, 0x02, 0x20, 0x03, 0x28, 0x0b, 0x32, 0x33, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78,
+	0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2e, 0x52, 0x65, 0x6c, 0x6f, 0x61, 0x64, 0x4f, 0x70, 0x65,
+	0x72, 0x61, 0x74, 0x69, 0x6f, 0x6e, 0x2e, 0x50, 0x6f, 0x6c, 0x69, 0x63, 0x79, 0x52, 0x61, 0x74,
+	0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79, 0x52, 0x10, 0x70, 0x6f,
+	0x6c, 0x69, 0x63, 0x79, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x12, 0x27,
+	0x0a, 0x0f, 0x72, 0x65, 0x6c, 0x6f, 0x61, 0x64, 0x5f, 0x70, 0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65,
+	0x73, 0x18, 0x03, 0x20, 0x01, 0x28, 0x08, 0x52, 0x0e, 0x72, 0x65, 0x6c, 0x6f, 0x61, 0x64, 0x50,
+	0x72, 0x6f, 0x66, 0x69, 0x6c, 0x65, 0x73, 0x1a, 0x5c, 0x0a, 0x15, 0x50, 0x6f, 0x6c, 0x69, 0x63,
+	0x79, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x73, 0x45, 0x6e, 0x74, 0x72, 0x79,
+	0x12, 0x10, 0x0a, 0x03, 0x6b, 0x65, 0x79, 0x18, 0x01, 0x20, 0x01, 0x28, 0x09, 0x52, 0x03, 0x6b,
+	0x65, 0x79, 0x12, 0x2d, 0x0a, 0x05, 0x76, 0x61, 0x6c, 0x75, 0x65, 0x18, 0x02, 0x20, 0x01, 0x28,
+	0x0b, 0x32, 0x17, 0x2e, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x2e, 0x70, 0x72, 0x6f, 0x78, 0x79,
+	0x2e, 0x52, 0x61, 0x74, 0x65, 0x4c, 0x69, 0x6d, 0x69, 0x74, 0x52, 0x05, 0x76, 0x61, 0x6c, 0x75,
+	0x65, 0x3a, 0x02, 0x38, 0x01, 0x42, 0x28, 0x5a, 0x26, 0x67, 0x69, 0x74, 0x68, 0x75, 0x62, 0x2e,
+	0x63, 0x6f, 0x6d, 0x2f, 0x78, 0x74, 0x6c, 0x73, 0x2f, 0x78, 0x72, 0x61, 0x79, 0x2d, 0x63, 0x6f,
+	0x72, 0x65, 0x2f, 0x70, 0x72, 0x6f, 0x78, 0x79, 0x2f, 0x72, 0x65, 0x66, 0x6c, 0x65, 0x78, 0x62,
+	0x06, 0x70, 0x72, 0x6f, 0x74, 0x6f, 0x33,
 }
 
 var (
@@ -319,22 +2296,65 @@ func file_proxy_reflex_config_proto_rawDescGZIP() []byte {
 	return file_proxy_reflex_config_proto_rawDescData
 }
 
-var file_proxy_reflex_config_proto_msgTypes = make([]protoimpl.MessageInfo, 5)
+var file_proxy_reflex_config_proto_msgTypes = make([]protoimpl.MessageInfo, 22)
 var file_proxy_reflex_config_proto_goTypes = []any{
-	(*User)(nil),           // 0: reflex.proxy.User
-	(*Account)(nil),        // 1: reflex.proxy.Account
-	(*InboundConfig)(nil),  // 2: reflex.proxy.InboundConfig
-	(*Fallback)(nil),       // 3: reflex.proxy.Fallback
-	(*OutboundConfig)(nil), // 4: reflex.proxy.OutboundConfig
+	(*User)(nil),                  // 0: reflex.proxy.User
+	(*Account)(nil),               // 1: reflex.proxy.Account
+	(*InboundConfig)(nil),         // 2: reflex.proxy.InboundConfig
+	(*UserStoreConfig)(nil),       // 3: reflex.proxy.UserStoreConfig
+	(*UserStore)(nil),             // 4: reflex.proxy.UserStore
+	(*TrafficAccounting)(nil),     // 5: reflex.proxy.TrafficAccounting
+	(*RateLimit)(nil),             // 6: reflex.proxy.RateLimit
+	(*AuthBackend)(nil),           // 7: reflex.proxy.AuthBackend
+	(*HandshakePuzzle)(nil),       // 8: reflex.proxy.HandshakePuzzle
+	(*SourceBan)(nil),             // 9: reflex.proxy.SourceBan
+	(*Fallback)(nil),              // 10: reflex.proxy.Fallback
+	(*GeoFallback)(nil),           // 11: reflex.proxy.GeoFallback
+	(*OutboundConfig)(nil),        // 12: reflex.proxy.OutboundConfig
+	(*Fragment)(nil),              // 13: reflex.proxy.Fragment
+	(*UpdatePolicyOperation)(nil), // 14: reflex.proxy.UpdatePolicyOperation
+	(*ReloadOperation)(nil),       // 15: reflex.proxy.ReloadOperation
+	nil,                           // 16: reflex.proxy.InboundConfig.HttpHeadersEntry
+	nil,                           // 17: reflex.proxy.InboundConfig.PolicyRateLimitsEntry
+	nil,                           // 18: reflex.proxy.InboundConfig.HttpResponseHeadersEntry
+	nil,                           // 19: reflex.proxy.Fallback.ErrorPagesEntry
+	nil,                           // 20: reflex.proxy.OutboundConfig.HttpHeadersEntry
+	nil,                           // 21: reflex.proxy.ReloadOperation.PolicyRateLimitsEntry
+	(*router.GeoIP)(nil),          // 22: xray.app.router.GeoIP
+	(*net.PortRange)(nil),         // 23: xray.common.net.PortRange
 }
 var file_proxy_reflex_config_proto_depIdxs = []int32{
-	0, // 0: reflex.proxy.InboundConfig.clients:type_name -> reflex.proxy.User
-	3, // 1: reflex.proxy.InboundConfig.fallback:type_name -> reflex.proxy.Fallback
-	2, // [2:2] is the sub-list for method output_type
-	2, // [2:2] is the sub-list for method input_type
-	2, // [2:2] is the sub-list for extension type_name
-	2, // [2:2] is the sub-list for extension extendee
-	0, // [0:2] is the sub-list for field type_name
+	10, // 0: reflex.proxy.User.fallback:type_name -> reflex.proxy.Fallback
+	6,  // 1: reflex.proxy.User.rate_limit:type_name -> reflex.proxy.RateLimit
+	6,  // 2: reflex.proxy.Account.rate_limit:type_name -> reflex.proxy.RateLimit
+	10, // 3: reflex.proxy.Account.fallback:type_name -> reflex.proxy.Fallback
+	0,  // 4: reflex.proxy.InboundConfig.clients:type_name -> reflex.proxy.User
+	10, // 5: reflex.proxy.InboundConfig.fallback:type_name -> reflex.proxy.Fallback
+	8,  // 6: reflex.proxy.InboundConfig.puzzle:type_name -> reflex.proxy.HandshakePuzzle
+	16, // 7: reflex.proxy.InboundConfig.http_headers:type_name -> reflex.proxy.InboundConfig.HttpHeadersEntry
+	9,  // 8: reflex.proxy.InboundConfig.source_ban:type_name -> reflex.proxy.SourceBan
+	7,  // 9: reflex.proxy.InboundConfig.auth_backend:type_name -> reflex.proxy.AuthBackend
+	17, // 10: reflex.proxy.InboundConfig.policy_rate_limits:type_name -> reflex.proxy.InboundConfig.PolicyRateLimitsEntry
+	5,  // 11: reflex.proxy.InboundConfig.traffic_accounting:type_name -> reflex.proxy.TrafficAccounting
+	18, // 12: reflex.proxy.InboundConfig.http_response_headers:type_name -> reflex.proxy.InboundConfig.HttpResponseHeadersEntry
+	4,  // 13: reflex.proxy.UserStoreConfig.stores:type_name -> reflex.proxy.UserStore
+	0,  // 14: reflex.proxy.UserStore.clients:type_name -> reflex.proxy.User
+	5,  // 15: reflex.proxy.UserStore.traffic_accounting:type_name -> reflex.proxy.TrafficAccounting
+	11, // 16: reflex.proxy.Fallback.geo:type_name -> reflex.proxy.GeoFallback
+	19, // 17: reflex.proxy.Fallback.error_pages:type_name -> reflex.proxy.Fallback.ErrorPagesEntry
+	22, // 18: reflex.proxy.GeoFallback.geoip:type_name -> xray.app.router.GeoIP
+	20, // 19: reflex.proxy.OutboundConfig.http_headers:type_name -> reflex.proxy.OutboundConfig.HttpHeadersEntry
+	23, // 20: reflex.proxy.OutboundConfig.port_range:type_name -> xray.common.net.PortRange
+	13, // 21: reflex.proxy.OutboundConfig.fragment:type_name -> reflex.proxy.Fragment
+	10, // 22: reflex.proxy.ReloadOperation.fallback:type_name -> reflex.proxy.Fallback
+	21, // 23: reflex.proxy.ReloadOperation.policy_rate_limits:type_name -> reflex.proxy.ReloadOperation.PolicyRateLimitsEntry
+	6,  // 24: reflex.proxy.InboundConfig.PolicyRateLimitsEntry.value:type_name -> reflex.proxy.RateLimit
+	6,  // 25: reflex.proxy.ReloadOperation.PolicyRateLimitsEntry.value:type_name -> reflex.proxy.RateLimit
+	26, // [26:26] is the sub-list for method output_type
+	26, // [26:26] is the sub-list for method input_type
+	26, // [26:26] is the sub-list for extension type_name
+	26, // [26:26] is the sub-list for extension extendee
+	0,  // [0:26] is the sub-list for field type_name
 }
 
 func init() { file_proxy_reflex_config_proto_init() }
@@ -348,7 +2368,7 @@ func file_proxy_reflex_config_proto_init() {
 			GoPackagePath: reflect.TypeOf(x{}).PkgPath(),
 			RawDescriptor: file_proxy_reflex_config_proto_rawDesc,
 			NumEnums:      0,
-			NumMessages:   5,
+			NumMessages:   22,
 			NumExtensions: 0,
 			NumServices:   0,
 		},
@@ -0,0 +1,111 @@
+package reflex
+
+import (
+	"encoding/binary"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/net"
+)
+
+// Commands that open the first DATA frame of a session.
+const (
+	CommandTCP byte = 0x01
+	CommandUDP byte = 0x02
+)
+
+// Address types, numbered as in VLESS. AddressTypeNone carries only a port
+// and is limited to UDP associate, where every packet names its own target.
+const (
+	AddressTypeNone   byte = 0x00
+	AddressTypeIPv4   byte = 0x01
+	AddressTypeDomain byte = 0x02
+	AddressTypeIPv6   byte = 0x03
+)
+
+// EncodeDestination builds the header of the first DATA frame:
+// command (1 byte) | port (2 bytes, big endian) | address type (1 byte) |
+// address, which is 4 or 16 bytes of IP, or a length byte and up to 255
+// bytes of domain. The request payload follows directly. A UDP destination
+// on the unspecified address is sent port-only.
+func EncodeDestination(dest net.Destination) ([]byte, error) {
+	var cmd byte
+	switch dest.Network {
+	case net.Network_TCP:
+		cmd = CommandTCP
+	case net.Network_UDP:
+		cmd = CommandUDP
+	default:
+		return nil, errors.New("unsupported reflex destination network ", dest.Network)
+	}
+	header := []byte{cmd}
+	header = binary.BigEndian.AppendUint16(header, uint16(dest.Port))
+
+	if dest.Address == nil {
+		return nil, errors.New("reflex destination has no address")
+	}
+	switch dest.Address.Family() {
+	case net.AddressFamilyIPv4:
+		if cmd == CommandUDP && dest.Address == net.AnyIP {
+			return append(header, AddressTypeNone), nil
+		}
+		header = append(header, AddressTypeIPv4)
+		return append(header, dest.Address.IP()...), nil
+	case net.AddressFamilyIPv6:
+		header = append(header, AddressTypeIPv6)
+		return append(header, dest.Address.IP()...), nil
+	default:
+		domain := dest.Address.Domain()
+		if len(domain) == 0 || len(domain) > 255 {
+			return nil, errors.New("invalid reflex destination domain length ", len(domain))
+		}
+		header = append(header, AddressTypeDomain, byte(len(domain)))
+		return append(header, domain...), nil
+	}
+}
+
+// ParseDestination reads the header written by EncodeDestination and returns
+// the destination along with the payload that follows it.
+func ParseDestination(data []byte) (net.Destination, []byte, error) {
+	if len(data) < 4 {
+		return net.Destination{}, nil, errors.New("data frame too short")
+	}
+	var network net.Network
+	switch data[0] {
+	case CommandTCP:
+		network = net.Network_TCP
+	case CommandUDP:
+		network = net.Network_UDP
+	default:
+		return net.Destination{}, nil, errors.New("unknown reflex command ", data[0])
+	}
+	port := net.Port(binary.BigEndian.Uint16(data[1:3]))
+	atyp, rest := data[3], data[4:]
+
+	var addr net.Address
+	switch atyp {
+	case AddressTypeNone:
+		if network != net.Network_UDP {
+			return net.Destination{}, nil, errors.New("port-only destination requires udp")
+		}
+		addr = net.AnyIP
+	case AddressTypeIPv4:
+		if len(rest) < net.IPv4len {
+			return net.Destination{}, nil, errors.New("data frame missing destination")
+		}
+		addr, rest = net.IPAddress(rest[:net.IPv4len]), rest[net.IPv4len:]
+	case AddressTypeIPv6:
+		if len(rest) < net.IPv6len {
+			return net.Destination{}, nil, errors.New("data frame missing destination")
+		}
+		addr, rest = net.IPAddress(rest[:net.IPv6len]), rest[net.IPv6len:]
+	case AddressTypeDomain:
+		if len(rest) < 1 || len(rest) < 1+int(rest[0]) || rest[0] == 0 {
+			return net.Destination{}, nil, errors.New("data frame missing destination")
+		}
+		addr = net.DomainAddress(string(rest[1 : 1+int(rest[0])]))
+		rest = rest[1+int(rest[0]):]
+	default:
+		return net.Destination{}, nil, errors.New("unknown reflex address type ", atyp)
+	}
+	return net.Destination{Network: network, Address: addr, Port: port}, rest, nil
+}
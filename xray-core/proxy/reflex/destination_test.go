@@ -0,0 +1,107 @@
+package reflex
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xtls/xray-core/common/net"
+)
+
+func TestDestinationRoundTrip(t *testing.T) {
+	cases := []struct {
+		dest net.Destination
+		size int
+	}{
+		{net.TCPDestination(net.ParseAddress("1.2.3.4"), 443), 8},
+		{net.TCPDestination(net.ParseAddress("2001:db8::1"), 443), 20},
+		{net.TCPDestination(net.DomainAddress("example.com"), 80), 16},
+		{net.UDPDestination(net.ParseAddress("8.8.8.8"), 53), 8},
+		{net.UDPDestination(net.AnyIP, 5000), 4},
+	}
+	for _, c := range cases {
+		header, err := EncodeDestination(c.dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(header) != c.size {
+			t.Fatalf("%v encoded to %d bytes, want %d", c.dest, len(header), c.size)
+		}
+		dest, rest, err := ParseDestination(append(header, "payload"...))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dest != c.dest {
+			t.Fatalf("round trip gave %v, want %v", dest, c.dest)
+		}
+		if !bytes.Equal(rest, []byte("payload")) {
+			t.Fatalf("unexpected payload %q", rest)
+		}
+	}
+}
+
+// TestDestinationWireFormat pins the bytes both ends must agree on.
+func TestDestinationWireFormat(t *testing.T) {
+	for _, c := range []struct {
+		dest net.Destination
+		want []byte
+	}{
+		{net.TCPDestination(net.ParseAddress("1.2.3.4"), 443), []byte{CommandTCP, 0x01, 0xBB, AddressTypeIPv4, 1, 2, 3, 4}},
+		{net.TCPDestination(net.DomainAddress("a.io"), 80), []byte{CommandTCP, 0x00, 0x50, AddressTypeDomain, 4, 'a', '.', 'i', 'o'}},
+		{net.UDPDestination(net.AnyIP, 5000), []byte{CommandUDP, 0x13, 0x88, AddressTypeNone}},
+	} {
+		header, err := EncodeDestination(c.dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(header, c.want) {
+			t.Fatalf("%v encoded to %x, want %x", c.dest, header, c.want)
+		}
+	}
+}
+
+func TestParseDestinationRejectsMalformed(t *testing.T) {
+	for _, data := range [][]byte{
+		{CommandTCP, 0, 80},
+		{0x09, 0, 80, AddressTypeIPv4, 1, 2, 3, 4},
+		{CommandTCP, 0, 80, AddressTypeNone},
+		{CommandTCP, 0, 80, AddressTypeIPv4, 1, 2},
+		{CommandTCP, 0, 80, AddressTypeIPv6, 1, 2, 3, 4},
+		{CommandTCP, 0, 80, AddressTypeDomain, 5, 'a'},
+		{CommandTCP, 0, 80, AddressTypeDomain, 0},
+		{CommandTCP, 0, 80, 0x7F},
+	} {
+		if _, _, err := ParseDestination(data); err == nil {
+			t.Fatalf("expected %v to be rejected", data)
+		}
+	}
+}
+
+func FuzzParseDestination(f *testing.F) {
+	for _, dest := range []net.Destination{
+		net.TCPDestination(net.ParseAddress("1.2.3.4"), 443),
+		net.TCPDestination(net.ParseAddress("2001:db8::1"), 443),
+		net.TCPDestination(net.DomainAddress("example.com"), 80),
+		net.UDPDestination(net.AnyIP, 5000),
+	} {
+		header, err := EncodeDestination(dest)
+		if err != nil {
+			f.Fatal(err)
+		}
+		f.Add(append(header, "payload"...))
+	}
+	f.Add([]byte{CommandTCP, 0, 80, AddressTypeDomain, 200, 'a'})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		dest, rest, err := ParseDestination(data)
+		if err != nil {
+			return
+		}
+		header, err := EncodeDestination(dest)
+		if err != nil {
+			t.Fatalf("parsed %v does not re-encode: %v", dest, err)
+		}
+		again, againRest, err := ParseDestination(append(header, rest...))
+		if err != nil || again != dest || !bytes.Equal(againRest, rest) {
+			t.Fatalf("%v did not survive re-encoding: %v, %v", dest, again, err)
+		}
+	})
+}
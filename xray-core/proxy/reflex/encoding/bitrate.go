@@ -0,0 +1,88 @@
+package encoding
+
+import (
+	"time"
+)
+
+const (
+	// defaultRampUp is how long a bitrate-targeting profile takes to reach
+	// its target when RampUp is unset.
+	defaultRampUp = 2 * time.Second
+	// rampFloor is the fraction of the target a ramp starts from.
+	rampFloor = 0.1
+	// bitrateIdleReset is how long a flow may have nothing to send before
+	// it ramps up again from the floor, like a player starting a new
+	// segment or TCP restarting after idle.
+	bitrateIdleReset = time.Second
+	// maxCatchUp caps how much intervals shrink while a flow makes up for
+	// time spent in burst gaps: at most to 1/maxCatchUp of their length.
+	maxCatchUp = 2
+)
+
+// IntervalAfter returns the delay to wait after a packet of size bytes.
+// Without a TargetBitrate it is NextInterval. With one, the delay is the
+// time size takes at the current rate, jittered by the shape of Delays, so
+// the aggregate throughput follows the target while packets still look like
+// the profile. The rate ramps up over RampUp whenever the flow starts or
+// resumes after being idle, and time spent in burst gaps is made up by
+// sending faster afterwards. busy reports that more data is waiting behind
+// this packet, in which case no burst gap is inserted.
+func (p *TrafficProfile) IntervalAfter(size int, busy bool) time.Duration {
+	if p.TargetBitrate == 0 {
+		return p.nextInterval(busy)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := time.Now()
+	if p.rampStart.IsZero() || now.Sub(p.pacedUntil) > bitrateIdleReset {
+		p.rampStart = now
+		p.gapDebt = 0
+	}
+	gap := p.advanceBurstLocked(busy)
+	d := p.bitrateIntervalLocked(size, now)
+	switch {
+	case p.nextDelay > 0:
+		d = p.nextDelay
+		p.nextDelay = 0
+	case gap > 0:
+		p.gapDebt += gap
+		d = gap
+	default:
+		cut := min(p.gapDebt, d-d/maxCatchUp)
+		p.gapDebt -= cut
+		d -= cut
+	}
+	p.pacedUntil = now.Add(d)
+	return d
+}
+
+// bitrateIntervalLocked is how long size bytes take at the ramped rate,
+// scaled by a draw from Delays relative to their mean.
+func (p *TrafficProfile) bitrateIntervalLocked(size int, now time.Time) time.Duration {
+	rate := float64(p.TargetBitrate)
+	rampUp := p.RampUp
+	if rampUp == 0 {
+		rampUp = defaultRampUp
+	}
+	if elapsed := now.Sub(p.rampStart); elapsed < rampUp {
+		rate *= rampFloor + (1-rampFloor)*float64(elapsed)/float64(rampUp)
+	}
+	d := time.Duration(float64(size*8) * float64(time.Second) / rate)
+	if mean := meanDelay(p.Delays); mean > 0 {
+		d = time.Duration(float64(d) * float64(p.sampleDelayLocked()) / float64(mean))
+	}
+	return d
+}
+
+// meanDelay is the weighted mean of values.
+func meanDelay(values []DelayDist) time.Duration {
+	var sum, weights float64
+	for _, v := range values {
+		sum += float64(v.Delay) * v.Weight
+		weights += v.Weight
+	}
+	if weights == 0 {
+		return 0
+	}
+	return time.Duration(sum / weights)
+}
@@ -0,0 +1,84 @@
+package encoding
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIntervalAfterTracksTargetBitrate(t *testing.T) {
+	p := &TrafficProfile{
+		Name:          "test",
+		PacketSizes:   []PacketSizeDist{{Size: 1000, Weight: 1}},
+		Delays:        []DelayDist{{Delay: 5 * time.Millisecond, Weight: 0.5}, {Delay: 15 * time.Millisecond, Weight: 0.5}},
+		TargetBitrate: 8_000_000,
+		RampUp:        time.Second,
+	}
+	// Fresh flows start at a tenth of the target: 1000 bytes at 800 kbit/s
+	// take 10ms, jittered by half or one and a half.
+	if d := p.IntervalAfter(1000, false); d < 4*time.Millisecond || d > 15*time.Millisecond {
+		t.Fatalf("first interval %v", d)
+	}
+
+	p.rampStart = time.Now().Add(-time.Minute)
+	var total time.Duration
+	for i := 0; i < 1000; i++ {
+		total += p.IntervalAfter(1000, false)
+	}
+	// 1000 packets of 1000 bytes at 8 Mbit/s take a second.
+	if total < 900*time.Millisecond || total > 1100*time.Millisecond {
+		t.Fatalf("1 MB paced over %v", total)
+	}
+
+	p.pacedUntil = time.Now().Add(-2 * bitrateIdleReset)
+	if d := p.IntervalAfter(1000, false); d < 5*time.Millisecond {
+		t.Fatalf("idle flow resumed at full rate: %v", d)
+	}
+}
+
+func TestIntervalAfterMakesUpBurstGaps(t *testing.T) {
+	p := &TrafficProfile{
+		Name:          "test",
+		PacketSizes:   []PacketSizeDist{{Size: 1000, Weight: 1}},
+		Delays:        []DelayDist{{Delay: 10 * time.Millisecond, Weight: 1}},
+		BurstLengths:  []BurstDist{{Packets: 2, Weight: 1}},
+		BurstGaps:     []DelayDist{{Delay: 100 * time.Millisecond, Weight: 1}},
+		TargetBitrate: 8_000_000,
+		rampStart:     time.Now().Add(-time.Minute),
+		pacedUntil:    time.Now(),
+	}
+	want := []time.Duration{time.Millisecond, 100 * time.Millisecond, time.Millisecond / 2}
+	for i, w := range want {
+		if d := p.IntervalAfter(1000, false); d != w {
+			t.Fatalf("interval %d: got %v, want %v", i, d, w)
+		}
+	}
+
+	p = &TrafficProfile{Name: "test", Delays: []DelayDist{{Delay: 10 * time.Millisecond, Weight: 1}}}
+	if d := p.IntervalAfter(1000, false); d != 10*time.Millisecond {
+		t.Fatalf("profile without a target paced %v", d)
+	}
+}
+
+func TestProfileJSONTargetBitrate(t *testing.T) {
+	p, err := ParseProfileJSON([]byte(`{"name":"video","packetSizes":[{"size":1200,"weight":1}],"targetKbps":4000,"rampUpMs":1500}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.TargetBitrate != 4_000_000 || p.RampUp != 1500*time.Millisecond {
+		t.Fatalf("parsed %d bit/s over %v", p.TargetBitrate, p.RampUp)
+	}
+	data, err := MarshalProfileJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseProfileJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.TargetBitrate != p.TargetBitrate || again.RampUp != p.RampUp {
+		t.Fatalf("round trip lost the target: %s", data)
+	}
+	if _, err := ParseProfileJSON([]byte(`{"name":"video","packetSizes":[{"size":1200,"weight":1}],"rampUpMs":-1}`)); err == nil {
+		t.Fatal("negative ramp-up accepted")
+	}
+}
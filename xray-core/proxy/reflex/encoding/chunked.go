@@ -0,0 +1,128 @@
+package encoding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// httpStreamConn carries a Reflex byte stream as the chunked body of a
+// single HTTP exchange, for middleboxes that reassemble HTTP and drop
+// anything that isn't. Writes go out as chunks after the message head;
+// reads come from the peer's decoded body.
+type httpStreamConn struct {
+	net.Conn
+
+	writeMu sync.Mutex
+	head    []byte
+
+	readOnce sync.Once
+	openBody func() (io.Reader, error)
+	body     io.Reader
+	bodyErr  error
+}
+
+// NewHTTPStreamConn writes head and then a chunked body on conn, and reads
+// the body openBody returns once the first read needs it.
+func NewHTTPStreamConn(conn net.Conn, head []byte, openBody func() (io.Reader, error)) net.Conn {
+	return &httpStreamConn{
+		Conn:     conn,
+		head:     head,
+		openBody: openBody,
+	}
+}
+
+func (c *httpStreamConn) Read(b []byte) (int, error) {
+	c.readOnce.Do(func() {
+		c.body, c.bodyErr = c.openBody()
+	})
+	if c.bodyErr != nil {
+		return 0, c.bodyErr
+	}
+	return c.body.Read(b)
+}
+
+// Write sends b as one chunk, preceded by the message head on first use,
+// in a single write to the connection.
+func (c *httpStreamConn) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	out := make([]byte, 0, len(c.head)+len(b)+12)
+	out = append(out, c.head...)
+	out = strconv.AppendInt(out, int64(len(b)), 16)
+	out = append(out, "\r\n"...)
+	out = append(out, b...)
+	out = append(out, "\r\n"...)
+	if _, err := c.Conn.Write(out); err != nil {
+		return 0, err
+	}
+	c.head = nil
+	return len(b), nil
+}
+
+// Close ends the body with the last chunk, if the head went out, and closes
+// the connection.
+func (c *httpStreamConn) Close() error {
+	c.writeMu.Lock()
+	if c.head == nil {
+		io.WriteString(c.Conn, "0\r\n\r\n")
+	}
+	c.writeMu.Unlock()
+	return c.Conn.Close()
+}
+
+// WriteStreamedHandshake sends a server handshake with a length prefix, as
+// the first bytes of a chunked response body.
+func WriteStreamedHandshake(w io.Writer, hs ServerHandshake) error {
+	raw := MarshalServerHandshake(hs)
+	_, err := w.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(raw))), raw...))
+	return err
+}
+
+// readStreamedHandshake reads what writeStreamedHandshake wrote.
+func readStreamedHandshake(r io.Reader) (ServerHandshake, error) {
+	var size [2]byte
+	if _, err := io.ReadFull(r, size[:]); err != nil {
+		return ServerHandshake{}, errors.New("failed to read reflex handshake response").Base(err)
+	}
+	raw := make([]byte, binary.BigEndian.Uint16(size[:]))
+	if _, err := io.ReadFull(r, raw); err != nil {
+		return ServerHandshake{}, errors.New("failed to read reflex handshake response").Base(err)
+	}
+	return parseServerHandshake(raw)
+}
+
+// DialChunkedHTTP wraps conn so a Reflex session runs as one chunked POST to
+// path and its chunked response, with extra headers from header. Any TLS is
+// expected to be applied to conn by the transport already.
+func DialChunkedHTTP(conn net.Conn, host, path string, header http.Header) net.Conn {
+	head := fmt.Sprintf("POST %s HTTP/1.1\r\nHost: %s\r\n", path, host)
+	if header.Get("Content-Type") == "" {
+		head += "Content-Type: application/octet-stream\r\n"
+	}
+	var extra strings.Builder
+	header.Write(&extra)
+	head += extra.String() + "Transfer-Encoding: chunked\r\n\r\n"
+	return NewHTTPStreamConn(conn, []byte(head), func() (io.Reader, error) {
+		resp, err := http.ReadResponse(bufio.NewReader(conn), nil)
+		if err != nil {
+			return nil, errors.New("failed to read reflex handshake response").Base(err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			return nil, rejected(resp)
+		}
+		return resp.Body, nil
+	})
+}
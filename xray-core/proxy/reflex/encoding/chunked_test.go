@@ -0,0 +1,33 @@
+package encoding
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestHTTPStreamConnFraming(t *testing.T) {
+	server, client := net.Pipe()
+	defer server.Close()
+	stream := DialChunkedHTTP(client, "h", "/p", nil)
+	go func() {
+		stream.Write([]byte("abc"))
+		stream.Write([]byte("de"))
+		stream.Close()
+	}()
+	req, err := readAll(server)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "POST /p HTTP/1.1\r\nHost: h\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: chunked\r\n\r\n3\r\nabc\r\n2\r\nde\r\n0\r\n\r\n"
+	if req != want {
+		t.Fatalf("unexpected request:\n%q\nwant\n%q", req, want)
+	}
+}
+
+func readAll(conn net.Conn) (string, error) {
+	var sb strings.Builder
+	_, err := bufio.NewReader(conn).WriteTo(&sb)
+	return sb.String(), err
+}
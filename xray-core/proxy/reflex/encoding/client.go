@@ -0,0 +1,556 @@
+package encoding
+
+import (
+	"bufio"
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// keepaliveInterval is how long a session granted FeatureKeepalive may stay
+// silent before the client pings.
+const keepaliveInterval = 30 * time.Second
+
+// ClientConfig describes the client side of a Reflex handshake.
+type ClientConfig struct {
+	UserID [16]byte
+	// Policy is sent as PolicyReq. Without it the server applies the
+	// account's configured policy and answers with a plain grant.
+	Policy *PolicyRequest
+	// PuzzleDifficulty pre-solves the server's handshake puzzle.
+	PuzzleDifficulty uint32
+	// Coalesce batches uplink frames into fewer writes; see
+	// Session.SetCoalescing.
+	Coalesce bool
+	// MaxFrameSize caps uplink frames on the wire; 0 derives it from conn.
+	// See Session.SetMaxFrameSize.
+	MaxFrameSize uint32
+	// Watermarks bound the uplink data queued for shaping.
+	Watermarks Watermarks
+	// HTTP, if set, sends the handshake as a JSON POST shaped by it instead
+	// of in binary.
+	HTTP *HTTPRequest
+	// Fragment, if set, splits the handshake into several writes.
+	Fragment *Fragment
+	// Binding is the server's handshake_binding, if it sets one.
+	Binding string
+	// MinVersion is the lowest protocol version offered; 0 offers all.
+	MinVersion uint8
+	// ServerIdentity, if set, is the public key grants must be signed with.
+	// Verified grants are cached per server and user, and a reconnect pads
+	// its handshake to the cached uplink profile.
+	ServerIdentity ed25519.PublicKey
+	// PSK is the server's pre-shared key, if it sets one; see MixPSK.
+	PSK []byte
+}
+
+// grantCacheKey identifies a server, by its identity key, and a user.
+type grantCacheKey struct {
+	server string
+	user   [16]byte
+}
+
+// grantCache holds the last verified *PolicyGrant per grantCacheKey.
+var grantCache sync.Map
+
+func (c *ClientConfig) cacheKey() grantCacheKey {
+	return grantCacheKey{server: string(c.ServerIdentity), user: c.UserID}
+}
+
+// CachedGrant returns the grant last verified for this server and user, if
+// the server's identity is pinned.
+func (c *ClientConfig) CachedGrant() *PolicyGrant {
+	if c.ServerIdentity == nil {
+		return nil
+	}
+	if g, ok := grantCache.Load(c.cacheKey()); ok {
+		return g.(*PolicyGrant)
+	}
+	return nil
+}
+
+// ClientConn is the client side of an established Reflex session. Uplink
+// frames are shaped by the granted uplink profile and padding level, and the
+// grant's features run in the background until Close.
+type ClientConn struct {
+	session *Session
+	marks   Watermarks
+	key     []byte
+	reader  *bufio.Reader
+	writer  io.Writer
+	ctx     context.Context
+	// conn is closed once a heartbeat finds the server dead.
+	conn     io.ReadWriter
+	peerDead atomic.Bool
+
+	// grantParts holds FrameTypePolicyContinuation payloads until the
+	// policy update that completes them.
+	grantParts []byte
+	// identity verifies policy updates when the server's is pinned; they
+	// are cached under cacheKey.
+	identity ed25519.PublicKey
+	cacheKey grantCacheKey
+
+	mu           sync.Mutex
+	grant        *PolicyGrant
+	stopFeatures context.CancelFunc
+}
+
+// NewClientConn performs the client handshake over conn and configures the
+// session from the server's policy grant.
+func NewClientConn(ctx context.Context, conn io.ReadWriter, config *ClientConfig) (*ClientConn, error) {
+	priv, pub, err := GenerateKeyPair()
+	if err != nil {
+		return nil, err
+	}
+	hs := ClientHandshake{PublicKey: pub, Timestamp: time.Now().Unix(), Versions: OfferedVersions(config.MinVersion)}
+	if hs.Versions == 0 {
+		return nil, errors.New("no supported reflex protocol version is at least ", config.MinVersion)
+	}
+	hs.UserID = UserToken(config.UserID, pub, hs.Timestamp, []byte(config.Binding))
+	if _, err := io.ReadFull(rand.Reader, hs.Nonce[:]); err != nil {
+		return nil, err
+	}
+	profile := profileFromPolicy("")
+	if config.Policy != nil {
+		req := *config.Policy
+		if req.Version == 0 {
+			req.Version = PolicyVersion
+		}
+		if hs.PolicyReq, err = json.Marshal(req); err != nil {
+			return nil, err
+		}
+		if _, ok := Profiles[req.Uplink]; ok {
+			profile = profileFromPolicy(req.Uplink)
+		} else if req.Uplink != "" {
+			errors.LogInfo(ctx, "reflex handshake padded as http2-api: requested uplink profile ", req.Uplink, " is not built in")
+		}
+	}
+	if cached := config.CachedGrant(); cached != nil {
+		if p, err := cached.profile(cached.Uplink); err == nil {
+			profile = p
+		} else {
+			errors.LogInfoInner(ctx, err, "reflex handshake not padded as the cached grant")
+		}
+	}
+	SolvePuzzle(&hs, config.PuzzleDifficulty)
+	if hs.Padding, err = HandshakePadding(profile, 75+len(hs.PolicyReq)); err != nil {
+		return nil, err
+	}
+
+	raw := binary.BigEndian.AppendUint32(nil, ReflexMagic)
+	raw = append(raw, EncodeClientHandshake(hs)...)
+	if config.HTTP != nil {
+		if raw, err = config.HTTP.handshakeRequest(raw); err != nil {
+			return nil, err
+		}
+	}
+	if err := config.Fragment.write(ctx, conn, raw); err != nil {
+		return nil, errors.New("failed to send reflex handshake").Base(err)
+	}
+	reader := bufio.NewReader(conn)
+	var serverHS ServerHandshake
+	if _, ok := conn.(*httpStreamConn); ok {
+		serverHS, err = readStreamedHandshake(reader)
+	} else {
+		serverHS, err = ReadHandshakeResponse(reader, config.HTTP)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	// The server always answers an offer with a version; a reply without
+	// one means the offer was stripped on the way.
+	if serverHS.Version == 0 || hs.Versions&(1<<(serverHS.Version-1)) == 0 {
+		return nil, errors.New("reflex server selected unsupported protocol version ", serverHS.Version)
+	}
+
+	shared, err := DeriveSharedKey(priv, serverHS.PublicKey)
+	if err != nil {
+		return nil, err
+	}
+	key, err := DeriveSessionKey(MixPSK(shared, config.PSK), hs.Nonce[:], SessionKeyInfo(hs, serverHS.PublicKey, serverHS.Version))
+	if err != nil {
+		return nil, err
+	}
+	plain, err := decryptPolicyGrant(key, serverHS.PolicyGrant)
+	if err != nil {
+		return nil, errors.New("failed to decrypt reflex policy grant").Base(err)
+	}
+	grant, err := ParsePolicyGrant(key, plain)
+	if err != nil {
+		return nil, err
+	}
+	if config.ServerIdentity != nil {
+		if err := grant.verifyIdentity(key, config.ServerIdentity); err != nil {
+			return nil, err
+		}
+		grantCache.Store(config.cacheKey(), grant)
+	}
+	session, err := NewSession(key)
+	if err != nil {
+		return nil, err
+	}
+
+	session.SetProtocolVersion(serverHS.Version)
+	session.SetCoalescing(config.Coalesce)
+	session.SetMaxFrameSize(FrameSizeFor(conn, config.MaxFrameSize))
+
+	// Flow control and the record layout are fixed for the session's
+	// lifetime; policy updates may not switch them.
+	if grant.Has(FeatureFlow) {
+		session.EnableFlowControl()
+	}
+	session.SetStreamMode(grant.Has(FeatureStream))
+	c := &ClientConn{session: session, marks: config.Watermarks, key: key, reader: reader, writer: conn, ctx: ctx, conn: conn}
+	c.identity, c.cacheKey = config.ServerIdentity, config.cacheKey()
+	if grant.More && serverHS.Version >= ProtocolVersion5 {
+		// The server sends the full grant before anything else, and the
+		// uplink can't be shaped without the profiles it embeds.
+		if grant, err = c.readFullGrant(); err != nil {
+			return nil, err
+		}
+	}
+	if err := c.applyGrant(grant); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// readFullGrant reads the grant that completes one cut short in the
+// handshake.
+func (c *ClientConn) readFullGrant() (*PolicyGrant, error) {
+	for {
+		frame, err := c.session.ReadFrame(c.reader)
+		if err != nil {
+			return nil, errors.New("failed to read the full reflex policy grant").Base(err)
+		}
+		switch frame.Type {
+		case FrameTypePolicyContinuation:
+			if err := c.addGrantPart(frame.Payload); err != nil {
+				return nil, err
+			}
+		case FrameTypePolicyUpdate:
+			return c.policyUpdate(frame.Payload)
+		default:
+			return nil, errors.New("reflex frame type ", frame.Type, " came before the full policy grant")
+		}
+	}
+}
+
+// addGrantPart holds a FrameTypePolicyContinuation payload for the policy
+// update that completes it.
+func (c *ClientConn) addGrantPart(part []byte) error {
+	if len(c.grantParts)+len(part) > maxPolicyGrantSize {
+		return errors.New("reflex policy update too large")
+	}
+	c.grantParts = append(c.grantParts, part...)
+	return nil
+}
+
+// policyUpdate verifies the grant completed by the last part and caches it
+// if the server's identity is pinned.
+func (c *ClientConn) policyUpdate(last []byte) (*PolicyGrant, error) {
+	payload := last
+	if c.grantParts != nil {
+		payload = append(c.grantParts, payload...)
+		c.grantParts = nil
+	}
+	grant, err := ParsePolicyGrant(c.key, payload)
+	if err == nil && c.identity != nil {
+		err = grant.verifyIdentity(c.key, c.identity)
+	}
+	if err != nil {
+		return nil, errors.New("invalid reflex policy update").Base(err)
+	}
+	if c.identity != nil {
+		grantCache.Store(c.cacheKey, grant)
+	}
+	return grant, nil
+}
+
+// RejectedError reports that the server answered the handshake with an HTTP
+// error status.
+type RejectedError struct {
+	StatusCode int
+	Status     string
+	// PuzzleDifficulty is set when the server enforces a handshake puzzle
+	// the handshake didn't solve; a retry solving it may be admitted.
+	PuzzleDifficulty uint32
+}
+
+func rejected(resp *http.Response) *RejectedError {
+	e := &RejectedError{StatusCode: resp.StatusCode, Status: resp.Status}
+	if resp.StatusCode == http.StatusTooManyRequests {
+		if d, err := strconv.ParseUint(resp.Header.Get(PuzzleHeader), 10, 32); err == nil {
+			e.PuzzleDifficulty = uint32(d)
+		}
+	}
+	return e
+}
+
+func (e *RejectedError) Error() string {
+	return "reflex handshake rejected: " + e.Status
+}
+
+// Permanent reports whether the server refused the credentials, which no
+// retry with the same account fixes. The server does not say why, so clock
+// skew and replays land here too.
+func (e *RejectedError) Permanent() bool {
+	return e.StatusCode == http.StatusUnauthorized || e.StatusCode == http.StatusForbidden
+}
+
+// ReadHandshakeResponse reads the server's HTTP handshake response to
+// request, which is nil for binary handshakes.
+func ReadHandshakeResponse(reader *bufio.Reader, request *HTTPRequest) (ServerHandshake, error) {
+	resp, err := http.ReadResponse(reader, nil)
+	if err != nil {
+		return ServerHandshake{}, errors.New("failed to read reflex handshake response").Base(err)
+	}
+	defer resp.Body.Close()
+	request.storeCookies(resp)
+	if resp.StatusCode == http.StatusSwitchingProtocols && request != nil && request.Upgrade != "" {
+		if !strings.EqualFold(resp.Header.Get("Upgrade"), request.Upgrade) {
+			return ServerHandshake{}, errors.New("reflex server switched to ", resp.Header.Get("Upgrade"), ", not ", request.Upgrade)
+		}
+		// The switched protocol opens with the handshake, length-prefixed
+		// as in a chunked body.
+		return readStreamedHandshake(reader)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return ServerHandshake{}, rejected(resp)
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, MaxHandshakeBodySize))
+	if err != nil {
+		return ServerHandshake{}, err
+	}
+	var envelope HandshakeHTTPEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil {
+		return ServerHandshake{}, errors.New("malformed reflex handshake response").Base(err)
+	}
+	raw, err := base64.StdEncoding.DecodeString(envelope.Data)
+	if err != nil {
+		return ServerHandshake{}, errors.New("malformed reflex handshake response").Base(err)
+	}
+	return parseServerHandshake(raw)
+}
+
+// Grant returns the policy currently in force.
+func (c *ClientConn) Grant() *PolicyGrant {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.grant
+}
+
+// applyGrant shapes uplink frames by g and restarts the background features
+// it grants.
+func (c *ClientConn) applyGrant(g *PolicyGrant) error {
+	profile, err := g.profile(g.Uplink)
+	if err != nil {
+		return err
+	}
+	c.session.SetTrafficProfile(profile)
+	c.session.SetPaddingLevel(g.Padding)
+	c.session.SetCompression(g.Has(FeatureCompress))
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.grant = g
+	if c.stopFeatures != nil {
+		c.stopFeatures()
+	}
+	ctx, cancel := context.WithCancel(c.ctx)
+	c.stopFeatures = cancel
+	switch {
+	case g.Has(FeatureCover):
+		go c.session.RunCoverTraffic(ctx, c.writer)
+	case g.Has(FeatureKeepalive):
+		go c.session.runKeepalive(ctx, c.writer, keepaliveInterval)
+	}
+	go c.session.RunWindowUpdates(ctx, c.writer)
+	if g.Has(FeatureHeartbeat) {
+		go c.heartbeat(ctx)
+	}
+	return nil
+}
+
+// heartbeat pings the server and closes the connection once it stops
+// answering, which ends CopyTo.
+func (c *ClientConn) heartbeat(ctx context.Context) {
+	if c.session.RunHeartbeat(ctx, c.writer, HeartbeatInterval) != ErrPeerDead {
+		return
+	}
+	c.peerDead.Store(true)
+	if closer, ok := c.conn.(io.Closer); ok {
+		closer.Close()
+	}
+}
+
+// RTT returns the smoothed round trip to the server, or 0 unless
+// FeatureHeartbeat was granted and answered.
+func (c *ClientConn) RTT() time.Duration {
+	return c.session.RTT()
+}
+
+// Ping sends a heartbeat request now rather than at the next interval. It
+// needs FeatureHeartbeat, or the server ends the session.
+func (c *ClientConn) Ping() error {
+	return c.session.Ping(c.writer)
+}
+
+// Session returns the session c runs, for its statistics and shaping.
+func (c *ClientConn) Session() *Session {
+	return c.session
+}
+
+// WriteDestination sends the first DATA frame naming the upstream target.
+// It is never morphed, so the header always arrives in one frame.
+func (c *ClientConn) WriteDestination(dest net.Destination) error {
+	_, err := c.WriteRequest(dest, nil)
+	return err
+}
+
+// WriteRequest sends the destination frame carrying as much of first as
+// fits in it, so the server's dispatcher can sniff the request before it
+// routes. It returns the part of first that did not fit, which the caller
+// must send next.
+func (c *ClientConn) WriteRequest(dest net.Destination, first buf.MultiBuffer) (buf.MultiBuffer, error) {
+	header, err := reflex.EncodeDestination(dest)
+	if err != nil {
+		buf.ReleaseMulti(first)
+		return nil, err
+	}
+	room := c.session.maxDataPayload(c.session.compress.Load())
+	if room == 0 {
+		room = defaultMaxFrameSize - 3 - c.session.aead.Overhead() - 1
+	}
+	rest, head := buf.SplitSize(first, int32(max(room-len(header), 0)))
+	for _, b := range head {
+		header = append(header, b.Bytes()...)
+	}
+	buf.ReleaseMulti(head)
+	if err := c.session.WriteFrame(c.writer, FrameTypeData, header); err != nil {
+		buf.ReleaseMulti(rest)
+		return nil, err
+	}
+	return rest, nil
+}
+
+// CopyFrom sends everything read from reader as shaped DATA frames, then
+// a Close frame: a FIN once reader ends, so the server closes upstream but
+// keeps the downlink flowing, or a RST if reading failed.
+func (c *ClientConn) CopyFrom(reader buf.Reader) error {
+	pipeline := NewMorphPipeline(c.session, c.writer, c.marks)
+	for {
+		mb, err := reader.ReadMultiBuffer()
+		if err != nil {
+			if closeErr := pipeline.Close(); closeErr != nil {
+				return closeErr
+			}
+			if closeErr := c.session.WriteFrame(c.writer, FrameTypeClose, ClosePayload(err, CloseErrorUpstream)); closeErr != nil && err == io.EOF {
+				return closeErr
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		if err := pipeline.Write(mb); err != nil {
+			pipeline.Close()
+			return err
+		}
+	}
+}
+
+// CopyTo writes received DATA frames to writer and handles control frames,
+// until the server closes the session. A session the server aborts ends
+// with a *CloseError.
+func (c *ClientConn) CopyTo(writer buf.Writer) error {
+	for {
+		frame, err := c.session.ReadFrame(c.reader)
+		if err != nil {
+			if c.peerDead.Load() {
+				return ErrPeerDead
+			}
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		switch frame.Type {
+		case FrameTypeData:
+			if err := c.session.ReceivedData(frame); err != nil {
+				return err
+			}
+			if len(frame.Payload) == 0 {
+				c.session.ConsumeData(int(frame.Length))
+				continue
+			}
+			c.session.AwaitRelease(c.ctx)
+			if err := writer.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes(frame.Payload)}); err != nil {
+				return err
+			}
+			c.session.ConsumeData(int(frame.Length))
+		case FrameTypePadding, FrameTypeTiming:
+			if err := c.session.HandleControlFrame(frame); err != nil {
+				return err
+			}
+		case FrameTypePolicyContinuation:
+			if err := c.addGrantPart(frame.Payload); err != nil {
+				return err
+			}
+		case FrameTypePolicyUpdate:
+			grant, err := c.policyUpdate(frame.Payload)
+			if err != nil {
+				return err
+			}
+			if err := c.applyGrant(grant); err != nil {
+				return err
+			}
+			errors.LogInfo(c.ctx, "reflex policy updated: uplink ", grant.Uplink, ", downlink ", grant.Downlink)
+		case FrameTypeWindowUpdate:
+			if err := c.session.HandleWindowUpdate(frame); err != nil {
+				return err
+			}
+		case FrameTypePing:
+			if err := c.session.HandlePing(c.writer, frame); err != nil {
+				return err
+			}
+		case FrameTypeClose:
+			if IsReset(frame) {
+				return closeError(frame)
+			}
+			return nil
+		default:
+			return errors.New("unknown reflex frame type ", frame.Type)
+		}
+	}
+}
+
+// Close stops the background features. The underlying connection is left to
+// the caller.
+func (c *ClientConn) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stopFeatures != nil {
+		c.stopFeatures()
+		c.stopFeatures = nil
+	}
+	c.session.CloseFlow()
+	return nil
+}
@@ -0,0 +1,166 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/common/buf"
+)
+
+// collectWriter hands every written byte to a channel.
+type collectWriter chan []byte
+
+func (w collectWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	for _, b := range mb {
+		w <- append([]byte(nil), b.Bytes()...)
+	}
+	buf.ReleaseMulti(mb)
+	return nil
+}
+
+// signedGrant encodes g as a server without an identity key signs it for
+// the session with key.
+func signedGrant(key []byte, g PolicyGrant) []byte {
+	body, _ := json.Marshal(g)
+	return SignGrant(key, nil, body)
+}
+
+func TestClientConnAppliesPolicyUpdate(t *testing.T) {
+	key := testKey()
+	server, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	update := PolicyGrant{Version: PolicyVersion, Uplink: "zoom", Downlink: "zoom", Padding: PaddingMax}
+	var wire bytes.Buffer
+	if err := server.WriteFrame(&wire, FrameTypePolicyUpdate, signedGrant(key, update)); err != nil {
+		t.Fatal(err)
+	}
+	if err := server.WriteFrame(&wire, FrameTypeClose, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ClientConn{session: session, key: key, reader: bufio.NewReader(&wire), writer: io.Discard, ctx: context.Background()}
+	c.applyGrant(&PolicyGrant{Uplink: "youtube", Downlink: "youtube", Padding: PaddingProfile})
+	defer c.Close()
+
+	if err := c.CopyTo(make(collectWriter, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if g := c.Grant(); g.Uplink != "zoom" || g.Padding != PaddingMax {
+		t.Fatalf("policy update not applied: %+v", g)
+	}
+	if profile, padding := session.Shaping(); profile.Name != "zoom" || padding != PaddingMax {
+		t.Fatalf("session not reshaped: %s %s", profile.Name, padding)
+	}
+
+	// Updates must carry this session's signature.
+	forged := PolicyGrant{Version: PolicyVersion, Uplink: "youtube"}
+	other := testKey()
+	other[0] ^= 0xFF
+	wire.Reset()
+	if err := server.WriteFrame(&wire, FrameTypePolicyUpdate, signedGrant(other, forged)); err != nil {
+		t.Fatal(err)
+	}
+	c.reader = bufio.NewReader(&wire)
+	if err := c.CopyTo(make(collectWriter, 1)); err == nil {
+		t.Fatal("expected forged policy update to be rejected")
+	}
+}
+
+func TestClientConnRejectsUndefinedProfile(t *testing.T) {
+	key := testKey()
+	session, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &ClientConn{session: session, key: key, writer: io.Discard, ctx: context.Background()}
+	defer c.Close()
+	if err := c.applyGrant(&PolicyGrant{Uplink: "youtube", Padding: PaddingProfile}); err != nil {
+		t.Fatal(err)
+	}
+
+	// A loaded profile the grant doesn't define can't be shaped by.
+	err = c.applyGrant(&PolicyGrant{Uplink: "custom-video", Padding: PaddingProfile})
+	if err == nil || !strings.Contains(err.Error(), "custom-video") {
+		t.Fatalf("undefined profile applied: %v", err)
+	}
+	if profile, _ := session.Shaping(); profile.Name != "youtube" {
+		t.Fatalf("session reshaped as %s by a rejected grant", profile.Name)
+	}
+
+	server, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	update := PolicyGrant{Version: PolicyVersion, Uplink: "custom-video", Downlink: "zoom", Padding: PaddingProfile}
+	if err := server.WriteFrame(&wire, FrameTypePolicyUpdate, signedGrant(key, update)); err != nil {
+		t.Fatal(err)
+	}
+	c.reader = bufio.NewReader(&wire)
+	if err := c.CopyTo(make(collectWriter, 1)); err == nil {
+		t.Fatal("policy update with an undefined profile accepted")
+	}
+}
+
+func TestClientConnReassemblesLargeGrant(t *testing.T) {
+	key := testKey()
+	ext := []byte(`{"hints":"` + strings.Repeat("h", 3*policyChunkSize) + `"}`)
+	full := PolicyGrant{Version: PolicyVersion, Uplink: "zoom", Downlink: "zoom", Padding: PaddingMax, Ext: ext}
+	// What the handshake carried: the grant without Ext, flagged More.
+	g := full
+	g.Ext, g.More = nil, true
+
+	server, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.SetProtocolVersion(ProtocolVersion5)
+	var wire bytes.Buffer
+	if err := server.WritePolicyGrant(&wire, signedGrant(key, full)); err != nil {
+		t.Fatal(err)
+	}
+	if n := server.Stats().FramesSent[FrameTypePolicyContinuation]; n != 3 {
+		t.Fatalf("grant sent with %d continuation frames, want 3", n)
+	}
+	if err := server.WriteFrame(&wire, FrameTypeClose, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	session, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	session.SetProtocolVersion(ProtocolVersion5)
+	c := &ClientConn{session: session, key: key, reader: bufio.NewReader(&wire), writer: io.Discard, ctx: context.Background()}
+	c.applyGrant(&g)
+	defer c.Close()
+	if err := c.CopyTo(make(collectWriter, 1)); err != nil {
+		t.Fatal(err)
+	}
+	if g := c.Grant(); g.More || !bytes.Equal(g.Ext, ext) {
+		t.Fatalf("full grant not applied: more %v, %d ext bytes", g.More, len(g.Ext))
+	}
+
+	// Older sessions keep one frame per grant.
+	old, err := NewSession(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := old.WritePolicyGrant(io.Discard, signedGrant(key, full)); err != nil {
+		t.Fatal(err)
+	}
+	if n := old.Stats().FramesSent[FrameTypePolicyContinuation]; n != 0 {
+		t.Fatalf("version 1 session sent %d continuation frames", n)
+	}
+}
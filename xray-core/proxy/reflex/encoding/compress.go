@@ -0,0 +1,73 @@
+package encoding
+
+import (
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// Codec bytes prefixed to DATA payloads once FeatureCompress is granted.
+const (
+	codecRaw  = 0x00
+	codecZstd = 0x01
+
+	// minCompressSize is the smallest payload worth compressing.
+	minCompressSize = 64
+)
+
+var (
+	zstdOnce    sync.Once
+	zstdEncoder *zstd.Encoder
+	zstdDecoder *zstd.Decoder
+)
+
+func zstdCodec() (*zstd.Encoder, *zstd.Decoder) {
+	zstdOnce.Do(func() {
+		zstdEncoder, _ = zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedFastest), zstd.WithEncoderConcurrency(1))
+		// Decoding is capped at one frame's worth of data so a small
+		// payload can't expand into an arbitrarily large allocation.
+		zstdDecoder, _ = zstd.NewReader(nil, zstd.WithDecoderMaxMemory(maxFramePayloadSize), zstd.WithDecoderConcurrency(0))
+	})
+	return zstdEncoder, zstdDecoder
+}
+
+// compressData encodes a DATA payload for a compressing session. The result
+// is only zstd when that is actually smaller, so incompressible streams cost
+// one byte per frame.
+func compressData(payload []byte) []byte {
+	if len(payload) >= minCompressSize {
+		enc, _ := zstdCodec()
+		out := enc.EncodeAll(payload, []byte{codecZstd})
+		if len(out) < len(payload)+1 {
+			return out
+		}
+	}
+	out := make([]byte, 0, 1+len(payload))
+	out = append(out, codecRaw)
+	return append(out, payload...)
+}
+
+// decompressData reverses compressData.
+func decompressData(payload []byte) ([]byte, error) {
+	if len(payload) == 0 {
+		return nil, errors.New("compressed data frame is missing its codec")
+	}
+	switch payload[0] {
+	case codecRaw:
+		return payload[1:], nil
+	case codecZstd:
+		_, dec := zstdCodec()
+		out, err := dec.DecodeAll(payload[1:], nil)
+		if err != nil {
+			return nil, errors.New("failed to decompress data frame").Base(err)
+		}
+		if len(out) > maxFramePayloadSize {
+			return nil, errors.New("decompressed data frame too large")
+		}
+		return out, nil
+	default:
+		return nil, errors.New("unknown data frame codec ", payload[0])
+	}
+}
@@ -0,0 +1,90 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+func TestCompressDataRoundTrip(t *testing.T) {
+	text := bytes.Repeat([]byte(`{"status":"ok","items":[1,2,3]}`), 64)
+	random := make([]byte, 512)
+	for i := range random {
+		random[i] = byte(i*131 + i*i*7)
+	}
+
+	for _, payload := range [][]byte{nil, []byte("short"), text, random} {
+		encoded := compressData(payload)
+		decoded, err := decompressData(encoded)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(decoded, payload) {
+			t.Fatalf("round trip mismatch for %d bytes", len(payload))
+		}
+		if len(encoded) > len(payload)+1 {
+			t.Fatalf("encoding grew %d bytes to %d", len(payload), len(encoded))
+		}
+	}
+	if encoded := compressData(text); encoded[0] != codecZstd || len(encoded) >= len(text)/4 {
+		t.Fatalf("text not compressed: %d of %d bytes", len(encoded), len(text))
+	}
+}
+
+func TestDecompressDataRejectsBadInput(t *testing.T) {
+	// A small payload that would expand past one frame is refused.
+	enc, err := zstd.NewWriter(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	bomb := enc.EncodeAll(make([]byte, 4*maxFramePayloadSize), []byte{codecZstd})
+	if _, err := decompressData(bomb); err == nil {
+		t.Fatal("expected oversized payload to be rejected")
+	}
+	if _, err := decompressData([]byte{0x7F, 1, 2}); err == nil {
+		t.Fatal("expected unknown codec to be rejected")
+	}
+	if _, err := decompressData(nil); err == nil {
+		t.Fatal("expected missing codec to be rejected")
+	}
+}
+
+func TestSessionCompression(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 1200, Weight: 1.0}},
+	})
+	writerSession.SetPaddingLevel(PaddingNone)
+	writerSession.SetCompression(true)
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession.SetCompression(true)
+
+	data := bytes.Repeat([]byte("GET /api/v1/items HTTP/1.1\r\n"), 100)
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, data); err != nil {
+		t.Fatal(err)
+	}
+	if wire.Len() >= len(data)/2 {
+		t.Fatalf("wire carried %d bytes for %d of text", wire.Len(), len(data))
+	}
+
+	var got []byte
+	for wire.Len() > 0 {
+		frame, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, frame.Payload...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("decompressed stream mismatch")
+	}
+}
@@ -0,0 +1,52 @@
+package encoding
+
+import (
+	"time"
+)
+
+const (
+	// writeStallThreshold is how long a write to the connection may block
+	// before its send buffer counts as full.
+	writeStallThreshold = 50 * time.Millisecond
+	// rttSpikeFactor: a heartbeat RTT this many times the smoothed one
+	// means packets are queueing somewhere on the path. Spikes below
+	// minRTTSpike are jitter on a fast path and are ignored.
+	rttSpikeFactor = 2
+	minRTTSpike    = 20 * time.Millisecond
+	// congestionHold is how long morphing stays in pass-through after the
+	// last sign of congestion.
+	congestionHold = 2 * time.Second
+)
+
+// markCongested switches morphing to pass-through for congestionHold:
+// sleeping between frames and padding them would only deepen the queue.
+// Every further sign of congestion extends the hold.
+func (s *Session) markCongested(reason string) {
+	now := time.Now()
+	if s.congestedUntil.Swap(now.Add(congestionHold).UnixNano()) <= now.UnixNano() {
+		if s.observer != nil {
+			s.observer.Passthrough(reason)
+		}
+	}
+}
+
+// congested reports whether morphing is in pass-through.
+func (s *Session) congested() bool {
+	return time.Now().UnixNano() < s.congestedUntil.Load()
+}
+
+// observeWrite marks the session congested if writing to the connection
+// took long enough that its send buffer must have been full.
+func (s *Session) observeWrite(took time.Duration) {
+	if took >= writeStallThreshold {
+		s.markCongested("send buffer full")
+	}
+}
+
+// observeRTTSpike marks the session congested if sample is well above the
+// smoothed RTT srtt.
+func (s *Session) observeRTTSpike(sample, srtt time.Duration) {
+	if srtt > 0 && sample >= minRTTSpike && sample > rttSpikeFactor*srtt {
+		s.markCongested("rtt spike")
+	}
+}
@@ -0,0 +1,76 @@
+package encoding
+
+import (
+	"testing"
+	"time"
+)
+
+// stallingWriter counts writes, sleeping for stall in each.
+type stallingWriter struct {
+	writes int
+	stall  time.Duration
+}
+
+func (w *stallingWriter) Write(p []byte) (int, error) {
+	w.writes++
+	time.Sleep(w.stall)
+	return len(p), nil
+}
+
+func TestCongestionSwitchesMorphingToPassthrough(t *testing.T) {
+	s, err := NewSession(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 100, Weight: 1}},
+		Delays:      []DelayDist{{Delay: 300 * time.Millisecond, Weight: 1}},
+		Pacing:      PacingReceiver,
+	})
+
+	w := &stallingWriter{}
+	if err := s.WriteFrameWithMorphing(w, FrameTypeData, make([]byte, 300)); err != nil {
+		t.Fatal(err)
+	}
+	// Three chunks, each with a PADDING and a TIMING frame.
+	if w.writes != 9 || s.congested() {
+		t.Fatalf("shaped write took %d frames, congested %v", w.writes, s.congested())
+	}
+
+	stalled := &stallingWriter{stall: writeStallThreshold}
+	if err := s.WriteFrame(stalled, FrameTypePadding, []byte{0, 0}); err != nil {
+		t.Fatal(err)
+	}
+	if !s.congested() {
+		t.Fatal("stalled write did not signal congestion")
+	}
+	w.writes = 0
+	if err := s.WriteFrameWithMorphing(w, FrameTypeData, make([]byte, 300)); err != nil {
+		t.Fatal(err)
+	}
+	if w.writes != 1 {
+		t.Fatalf("pass-through write took %d frames", w.writes)
+	}
+
+	s.congestedUntil.Store(time.Now().UnixNano())
+	if s.congested() {
+		t.Fatal("pass-through outlasted the hold")
+	}
+}
+
+func TestRTTSpikeSignalsCongestion(t *testing.T) {
+	s, err := NewSession(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.observeRTT(5 * time.Millisecond)
+	s.observeRTT(15 * time.Millisecond)
+	if s.congested() {
+		t.Fatal("jitter on a fast path signalled congestion")
+	}
+	s.observeRTT(40 * time.Millisecond)
+	if !s.congested() {
+		t.Fatal("RTT spike did not signal congestion")
+	}
+}
@@ -0,0 +1,34 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/testing/netsim"
+)
+
+func TestSessionRejectsReorderedFrames(t *testing.T) {
+	key := bytes.Repeat([]byte{1}, 32)
+	writer, _ := NewSession(key)
+	reader, _ := NewSession(key)
+	link := netsim.NewLink(netsim.Conditions{Jitter: 20 * time.Millisecond, Reorder: true, Seed: 3})
+	for i := 0; i < 20; i++ {
+		if err := writer.WriteFrame(link, FrameTypeData, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	link.Close()
+	for i := 0; ; i++ {
+		frame, err := reader.ReadFrame(link)
+		if err != nil {
+			if i == 20 {
+				t.Fatal("reordered frames all authenticated")
+			}
+			return
+		}
+		if frame.Payload[0] != byte(i) {
+			t.Fatalf("frame %d accepted out of order", frame.Payload[0])
+		}
+	}
+}
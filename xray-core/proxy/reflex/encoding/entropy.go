@@ -0,0 +1,80 @@
+package encoding
+
+import (
+	"context"
+	"math"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	// entropyWindow is how many written bytes each entropy estimate covers.
+	// Fewer would understate the entropy of even random bytes.
+	entropyWindow = 4096
+	// minWireEntropy is the byte entropy, in bits, below which a window is
+	// flagged. Sealed frames measure close to 8 even with their headers;
+	// text and most protocol plaintext measure well under 6.
+	minWireEntropy = 7.0
+)
+
+// entropyMonitor estimates the byte entropy of what a session writes, as a
+// canary for plaintext reaching the wire, say through a mixup between the
+// session and a fallback. It is only used during the session's write turn.
+type entropyMonitor struct {
+	ctx    context.Context
+	counts [256]int
+	n      int
+	// flagged is set once a low window was logged, so a leaking session
+	// logs it once.
+	flagged bool
+}
+
+func newEntropyMonitor(ctx context.Context) *entropyMonitor {
+	return &entropyMonitor{ctx: ctx}
+}
+
+// observe adds written bytes and reports whether they completed a window of
+// low entropy.
+func (m *entropyMonitor) observe(written []byte) (low bool) {
+	for len(written) > 0 {
+		chunk := written[:min(len(written), entropyWindow-m.n)]
+		written = written[len(chunk):]
+		for _, b := range chunk {
+			m.counts[b]++
+		}
+		m.n += len(chunk)
+		if m.n < entropyWindow {
+			continue
+		}
+		if h := m.entropy(); h < minWireEntropy {
+			low = true
+			if !m.flagged {
+				m.flagged = true
+				errors.LogWarning(m.ctx, "reflex session wrote ", entropyWindow, " bytes of ", h, " bits entropy, which doesn't look encrypted")
+			}
+		}
+		m.counts = [256]int{}
+		m.n = 0
+	}
+	return low
+}
+
+// MonitorEntropy makes the session estimate the entropy of what it writes
+// and warn on ctx's log, and count, when a window doesn't look encrypted.
+// Call it before the first frame.
+func (s *Session) MonitorEntropy(ctx context.Context) {
+	s.entropy = newEntropyMonitor(ctx)
+}
+
+// entropy is the Shannon entropy of the current window in bits per byte.
+func (m *entropyMonitor) entropy() float64 {
+	var h float64
+	for _, c := range m.counts {
+		if c == 0 {
+			continue
+		}
+		p := float64(c) / float64(m.n)
+		h -= p * math.Log2(p)
+	}
+	return h
+}
@@ -0,0 +1,35 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestEntropyMonitorFlagsPlaintext(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.MonitorEntropy(context.Background())
+	var wire bytes.Buffer
+	// Small frames carry the most header per byte sealed.
+	for wire.Len() < 4*entropyWindow {
+		if err := s.WriteFrame(&wire, FrameTypePadding, []byte{0, 0}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.WriteFrame(&wire, FrameTypeData, make([]byte, 900)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := s.Stats().LowEntropyWindows; n != 0 {
+		t.Fatalf("%d windows of sealed frames flagged", n)
+	}
+
+	m := newEntropyMonitor(context.Background())
+	text := []byte(strings.Repeat("GET /index.html HTTP/1.1\r\nHost: example.com\r\n\r\n", 100))
+	if !m.observe(text) || !m.flagged {
+		t.Fatal("plaintext not flagged")
+	}
+}
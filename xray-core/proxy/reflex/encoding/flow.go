@@ -0,0 +1,204 @@
+package encoding
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"sync"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	// FlowWindowSize is how many DATA bytes, counted as sealed on the wire,
+	// each side may have in flight before the receiver hands them on. It
+	// must exceed the largest write WriteFrames makes: a coalesced batch of
+	// coalesceLimit plus one full frame.
+	FlowWindowSize = 256 * 1024
+	// flowUpdateThreshold is how much consumed credit the receiver collects
+	// before announcing it, so updates don't follow every frame.
+	flowUpdateThreshold = FlowWindowSize / 4
+)
+
+var errFlowClosed = errors.New("reflex flow window closed")
+
+// sendWindow is the credit a sender has left for DATA frames. WINDOW_UPDATE
+// frames from the peer replenish it.
+type sendWindow struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	credit int
+	closed bool
+}
+
+func newSendWindow() *sendWindow {
+	w := &sendWindow{credit: FlowWindowSize}
+	w.cond = sync.NewCond(&w.mu)
+	return w
+}
+
+// acquire takes n bytes of credit, waiting until the peer has granted them.
+func (w *sendWindow) acquire(n int) error {
+	if n > FlowWindowSize {
+		return errors.New("reflex write of ", n, " bytes exceeds the flow window")
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for w.credit < n && !w.closed {
+		w.cond.Wait()
+	}
+	if w.closed {
+		return errFlowClosed
+	}
+	w.credit -= n
+	return nil
+}
+
+// grant adds credit from a WINDOW_UPDATE. A peer granting more than it could
+// have consumed is broken.
+func (w *sendWindow) grant(n int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if n <= 0 || w.credit+n > FlowWindowSize {
+		return errors.New("invalid reflex window update")
+	}
+	w.credit += n
+	w.cond.Broadcast()
+	return nil
+}
+
+// close wakes writers waiting for credit that will never come.
+func (w *sendWindow) close() {
+	w.mu.Lock()
+	w.closed = true
+	w.mu.Unlock()
+	w.cond.Broadcast()
+}
+
+// recvWindow tracks DATA bytes the peer sent against the window it was
+// given, and the credit to hand back once they are consumed.
+type recvWindow struct {
+	mu       sync.Mutex
+	inFlight int
+	consumed int
+	// ready wakes runWindowUpdates once consumed reaches the threshold.
+	ready chan struct{}
+}
+
+func newRecvWindow() *recvWindow {
+	return &recvWindow{ready: make(chan struct{}, 1)}
+}
+
+// received charges n bytes against the window.
+func (w *recvWindow) received(n int) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight += n
+	if w.inFlight > FlowWindowSize {
+		return errors.New("reflex peer overran its flow window")
+	}
+	return nil
+}
+
+// consume releases n bytes that have been handed on.
+func (w *recvWindow) consume(n int) {
+	if n == 0 {
+		return
+	}
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.inFlight -= n
+	w.consumed += n
+	if w.consumed >= flowUpdateThreshold {
+		select {
+		case w.ready <- struct{}{}:
+		default:
+		}
+	}
+}
+
+// take returns the credit collected for the next WINDOW_UPDATE.
+func (w *recvWindow) take() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	n := w.consumed
+	w.consumed = 0
+	return n
+}
+
+// EnableFlowControl switches the session to windowed DATA transfer, as
+// FeatureFlow grants. Both peers must switch right after the handshake, and
+// runWindowUpdates must run for as long as the session does.
+func (s *Session) EnableFlowControl() {
+	s.sendWindow = newSendWindow()
+	s.recvWindow = newRecvWindow()
+}
+
+// CloseFlow releases writers blocked on credit once the session ends.
+func (s *Session) CloseFlow() {
+	if s.sendWindow != nil {
+		s.sendWindow.close()
+	}
+}
+
+// acquireCredit charges the sealed size of the DATA frames among frames
+// against the send window.
+func (s *Session) acquireCredit(frames []OutgoingFrame) error {
+	if s.sendWindow == nil {
+		return nil
+	}
+	n := 0
+	for _, f := range frames {
+		if f.Type == FrameTypeData {
+			n += len(f.Payload) + s.aead.Overhead()
+		}
+	}
+	if n == 0 {
+		return nil
+	}
+	return s.sendWindow.acquire(n)
+}
+
+// ReceivedData charges a DATA frame against the receive window. The caller
+// must consume it once the payload has been handed on.
+func (s *Session) ReceivedData(frame *Frame) error {
+	if s.recvWindow == nil {
+		return nil
+	}
+	return s.recvWindow.received(int(frame.Length))
+}
+
+// ConsumeData returns n delivered bytes of credit to the peer.
+func (s *Session) ConsumeData(n int) {
+	if s.recvWindow != nil {
+		s.recvWindow.consume(n)
+	}
+}
+
+// HandleWindowUpdate applies a WINDOW_UPDATE frame.
+func (s *Session) HandleWindowUpdate(frame *Frame) error {
+	if s.sendWindow == nil || len(frame.Payload) != 4 {
+		return errors.New("unexpected reflex window update")
+	}
+	return s.sendWindow.grant(int(binary.BigEndian.Uint32(frame.Payload)))
+}
+
+// RunWindowUpdates announces consumed credit to the peer. It writes from its
+// own goroutine so the read loop never blocks on the connection.
+func (s *Session) RunWindowUpdates(ctx context.Context, writer io.Writer) error {
+	if s.recvWindow == nil {
+		return nil
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-s.recvWindow.ready:
+		}
+		if n := s.recvWindow.take(); n > 0 {
+			if err := s.WriteFrame(writer, FrameTypeWindowUpdate, binary.BigEndian.AppendUint32(nil, uint32(n))); err != nil {
+				return err
+			}
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package encoding
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSendWindow(t *testing.T) {
+	w := newSendWindow()
+	if err := w.acquire(FlowWindowSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.grant(FlowWindowSize + 1); err == nil {
+		t.Fatal("expected a grant beyond the window to fail")
+	}
+	acquired := make(chan error, 1)
+	go func() { acquired <- w.acquire(100) }()
+	select {
+	case <-acquired:
+		t.Fatal("acquire did not wait for credit")
+	case <-time.After(50 * time.Millisecond):
+	}
+	if err := w.grant(100); err != nil {
+		t.Fatal(err)
+	}
+	if err := <-acquired; err != nil {
+		t.Fatal(err)
+	}
+
+	go func() { acquired <- w.acquire(1) }()
+	w.close()
+	if err := <-acquired; err != errFlowClosed {
+		t.Fatalf("expected errFlowClosed, got %v", err)
+	}
+}
+
+func TestRecvWindowRejectsOverrun(t *testing.T) {
+	w := newRecvWindow()
+	if err := w.received(FlowWindowSize); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.received(1); err == nil {
+		t.Fatal("expected an overrun to fail")
+	}
+}
+
+func TestFlowControlStallsSenderUntilConsumed(t *testing.T) {
+	senderConn, receiverConn := net.Pipe()
+	defer senderConn.Close()
+	defer receiverConn.Close()
+	sender, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	receiver, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	sender.EnableFlowControl()
+	receiver.EnableFlowControl()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go receiver.RunWindowUpdates(ctx, receiverConn)
+	go func() {
+		for {
+			frame, err := sender.ReadFrame(senderConn)
+			if err != nil {
+				return
+			}
+			if frame.Type == FrameTypeWindowUpdate {
+				sender.HandleWindowUpdate(frame)
+			}
+		}
+	}()
+
+	chunk := make([]byte, 60000)
+	var sent atomic.Int32
+	go func() {
+		for i := 0; i < 8; i++ {
+			if err := sender.WriteFrame(senderConn, FrameTypeData, chunk); err != nil {
+				return
+			}
+			sent.Add(1)
+		}
+	}()
+
+	var frames []*Frame
+	for len(frames) < 4 {
+		frame, err := receiver.ReadFrame(receiverConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := receiver.ReceivedData(frame); err != nil {
+			t.Fatal(err)
+		}
+		frames = append(frames, frame)
+	}
+	time.Sleep(100 * time.Millisecond)
+	if n := sent.Load(); n != 4 {
+		t.Fatalf("sender wrote %d frames into a window of 4", n)
+	}
+
+	for _, f := range frames {
+		receiver.ConsumeData(int(f.Length))
+	}
+	for i := 4; i < 8; i++ {
+		frame, err := receiver.ReadFrame(receiverConn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := receiver.ReceivedData(frame); err != nil {
+			t.Fatal(err)
+		}
+		receiver.ConsumeData(int(frame.Length))
+	}
+}
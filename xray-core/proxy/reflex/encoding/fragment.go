@@ -0,0 +1,58 @@
+package encoding
+
+import (
+	"context"
+	"io"
+	"math/rand"
+	"time"
+)
+
+// Fragment splits the client's first flight into small writes with pauses
+// between them, so middleboxes that only inspect the first packet of a
+// connection never see the whole magic and handshake. Go disables Nagle on
+// TCP, so every write leaves as its own segment.
+type Fragment struct {
+	// MinLength and MaxLength bound each piece; MaxLength defaults to
+	// MinLength.
+	MinLength int
+	MaxLength int
+	// MinInterval and MaxInterval bound the pause after each piece.
+	MinInterval time.Duration
+	MaxInterval time.Duration
+}
+
+// between draws uniformly from [lo, hi], or returns lo if hi isn't above it.
+func between[T int | time.Duration](lo, hi T) T {
+	if hi <= lo {
+		return lo
+	}
+	return lo + T(rand.Int63n(int64(hi-lo)+1))
+}
+
+// write sends data to w in pieces. Pauses stop early when ctx is done.
+func (f *Fragment) write(ctx context.Context, w io.Writer, data []byte) error {
+	if f == nil || f.MinLength <= 0 {
+		_, err := w.Write(data)
+		return err
+	}
+	for len(data) > 0 {
+		n := min(between(f.MinLength, f.MaxLength), len(data))
+		if _, err := w.Write(data[:n]); err != nil {
+			return err
+		}
+		data = data[n:]
+		if len(data) == 0 {
+			break
+		}
+		if delay := between(f.MinInterval, f.MaxInterval); delay > 0 {
+			timer := time.NewTimer(delay)
+			select {
+			case <-timer.C:
+			case <-ctx.Done():
+				timer.Stop()
+				return ctx.Err()
+			}
+		}
+	}
+	return nil
+}
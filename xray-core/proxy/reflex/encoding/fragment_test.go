@@ -0,0 +1,43 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+// recordingWriter keeps every write separately.
+type recordingWriter [][]byte
+
+func (w *recordingWriter) Write(p []byte) (int, error) {
+	*w = append(*w, append([]byte(nil), p...))
+	return len(p), nil
+}
+
+func TestFragmentSplitsWrites(t *testing.T) {
+	data := bytes.Repeat([]byte("reflex"), 50)
+	f := &Fragment{MinLength: 5, MaxLength: 20, MinInterval: time.Millisecond, MaxInterval: 2 * time.Millisecond}
+	var w recordingWriter
+	if err := f.write(context.Background(), &w, data); err != nil {
+		t.Fatal(err)
+	}
+	if len(w) < len(data)/20 {
+		t.Fatalf("only %d writes", len(w))
+	}
+	for i, piece := range w {
+		if len(piece) > 20 || (len(piece) < 5 && i != len(w)-1) {
+			t.Fatalf("piece %d has %d bytes", i, len(piece))
+		}
+	}
+	if !bytes.Equal(bytes.Join(w, nil), data) {
+		t.Fatal("pieces don't add up to the data")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	slow := &Fragment{MinLength: 1, MinInterval: time.Hour}
+	if err := slow.write(ctx, &recordingWriter{}, data); err == nil {
+		t.Fatal("pause ignored a cancelled context")
+	}
+}
@@ -0,0 +1,74 @@
+package encoding
+
+import (
+	"io"
+	"syscall"
+
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+const (
+	// defaultMaxFrameSize keeps a frame inside one segment of a typical
+	// 1500-byte path when the MSS cannot be read from the connection.
+	defaultMaxFrameSize = 1400
+	// minFrameSize leaves room for a useful DATA payload after the header,
+	// the AEAD tag and the codec byte.
+	minFrameSize = 128
+	// maxFrameSize is the largest frame the length field can describe.
+	maxFrameSize = 3 + maxFramePayloadSize
+	// tlsRecordOverhead is the most a TLS record adds to its payload: the
+	// header, and the explicit nonce and tag of TLS 1.2 AES-GCM.
+	tlsRecordOverhead = 5 + 8 + 16
+)
+
+// FrameSizeFor returns the largest wire frame for conn: configured if set,
+// else the TCP MSS of the socket underneath less what TLS layers such as a
+// TLS or REALITY transport add, else defaultMaxFrameSize. Envelopes add
+// their own bytes, so a configured size is the way to account for them.
+func FrameSizeFor(conn io.ReadWriter, configured uint32) int {
+	size := int(configured)
+	if size == 0 {
+		size = defaultMaxFrameSize
+		if mss := socketMSS(conn); mss >= minFrameSize {
+			size = mss
+		}
+	}
+	return min(max(size, minFrameSize), maxFrameSize)
+}
+
+// socketMSS reads the TCP MSS of conn's socket, less the record overhead of
+// each TLS layer on top of it, or returns 0 when conn is not a socket.
+func socketMSS(conn io.ReadWriter) int {
+	nc, ok := conn.(net.Conn)
+	if !ok {
+		return 0
+	}
+	overhead := 0
+	for {
+		nc = stat.TryUnwrapStatsConn(nc)
+		// crypto/tls, uTLS and REALITY connections expose what they run on.
+		layer, ok := nc.(interface{ NetConn() net.Conn })
+		if !ok {
+			break
+		}
+		nc = layer.NetConn()
+		overhead += tlsRecordOverhead
+	}
+	sc, ok := nc.(syscall.Conn)
+	if !ok {
+		return 0
+	}
+	raw, err := sc.SyscallConn()
+	if err != nil {
+		return 0
+	}
+	mss := 0
+	raw.Control(func(fd uintptr) {
+		mss = tcpMSS(fd)
+	})
+	if mss <= overhead {
+		return 0
+	}
+	return mss - overhead
+}
@@ -0,0 +1,13 @@
+package encoding
+
+import (
+	"syscall"
+)
+
+func tcpMSS(fd uintptr) int {
+	mss, err := syscall.GetsockoptInt(int(fd), syscall.IPPROTO_TCP, syscall.TCP_MAXSEG)
+	if err != nil {
+		return 0
+	}
+	return mss
+}
@@ -0,0 +1,7 @@
+//go:build !linux
+
+package encoding
+
+func tcpMSS(uintptr) int {
+	return 0
+}
@@ -0,0 +1,99 @@
+package encoding
+
+import (
+	"bytes"
+	gotls "crypto/tls"
+	"net"
+	"runtime"
+	"testing"
+)
+
+func TestFrameSizeFor(t *testing.T) {
+	a, b := net.Pipe()
+	defer a.Close()
+	defer b.Close()
+	if got := FrameSizeFor(a, 0); got != defaultMaxFrameSize {
+		t.Fatalf("pipe frame size = %d, want the default", got)
+	}
+	if got := FrameSizeFor(a, 900); got != 900 {
+		t.Fatalf("configured frame size = %d, want 900", got)
+	}
+	if got := FrameSizeFor(a, 1<<20); got != maxFrameSize {
+		t.Fatalf("oversized frame size = %d, want %d", got, maxFrameSize)
+	}
+
+	if runtime.GOOS != "linux" {
+		return
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	if mss := socketMSS(conn); mss < minFrameSize {
+		t.Fatalf("socket MSS = %d", mss)
+	}
+}
+
+func TestSocketMSSThroughTLS(t *testing.T) {
+	if runtime.GOOS != "linux" {
+		return
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	// The MSS is read off the socket, so no TLS handshake is needed.
+	tlsConn := gotls.Client(conn, &gotls.Config{InsecureSkipVerify: true})
+	if got, want := socketMSS(tlsConn), socketMSS(conn)-tlsRecordOverhead; got != want {
+		t.Fatalf("MSS through TLS = %d, want %d", got, want)
+	}
+}
+
+func TestWriteFrameWithMorphingClampsToMaxFrameSize(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 4000, Weight: 1.0}},
+	})
+	writerSession.SetPaddingLevel(PaddingNone)
+	writerSession.SetMaxFrameSize(1400)
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data := bytes.Repeat([]byte("x"), 5000)
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, data); err != nil {
+		t.Fatal(err)
+	}
+	var got []byte
+	for wire.Len() > 0 {
+		frame, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size := 3 + len(frame.Payload) + 16; size > 1400 {
+			t.Fatalf("frame of %d bytes exceeds the cap", size)
+		}
+		got = append(got, frame.Payload...)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatal("clamped frames do not reassemble the data")
+	}
+}
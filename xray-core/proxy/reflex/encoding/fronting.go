@@ -0,0 +1,178 @@
+package encoding
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// HTTPRequest shapes the requests a client sends so they blend into the
+// fronted domain's traffic.
+type HTTPRequest struct {
+	Host   string
+	Path   string
+	Header map[string]string
+	// Browser renders the handshake POST with the headers, values and
+	// header order of a browser's fetch(): "chrome" or "firefox". Header
+	// entries override the browser's values.
+	Browser string
+	// Jar, if set, supplies the Cookie header and keeps cookies the server
+	// sets, like a browser's cookie jar.
+	Jar http.CookieJar
+	// Upgrade, if set, asks the server to switch to this protocol with a
+	// 101 response instead of answering 200 and keeping the connection
+	// alive.
+	Upgrade string
+}
+
+// headerField is one header of a browser preset. An empty value is derived
+// from the request, or left out.
+type headerField struct {
+	name  string
+	value string
+}
+
+// browserHeaders are the headers of a same-origin fetch() POST, in the
+// order each browser sends them.
+var browserHeaders = map[string][]headerField{
+	"chrome": {
+		{"Host", ""},
+		{"Connection", "keep-alive"},
+		{"Content-Length", ""},
+		{"sec-ch-ua", `"Google Chrome";v="131", "Chromium";v="131", "Not_A Brand";v="24"`},
+		{"sec-ch-ua-mobile", "?0"},
+		{"sec-ch-ua-platform", `"Windows"`},
+		{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/131.0.0.0 Safari/537.36"},
+		{"Content-Type", ""},
+		{"Accept", "*/*"},
+		{"Origin", ""},
+		{"Sec-Fetch-Site", "same-origin"},
+		{"Sec-Fetch-Mode", "cors"},
+		{"Sec-Fetch-Dest", "empty"},
+		{"Referer", ""},
+		{"Accept-Encoding", "gzip, deflate, br, zstd"},
+		{"Accept-Language", "en-US,en;q=0.9"},
+		{"Cookie", ""},
+	},
+	"firefox": {
+		{"Host", ""},
+		{"User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64; rv:133.0) Gecko/20100101 Firefox/133.0"},
+		{"Accept", "*/*"},
+		{"Accept-Language", "en-US,en;q=0.5"},
+		{"Accept-Encoding", "gzip, deflate, br, zstd"},
+		{"Content-Type", ""},
+		{"Content-Length", ""},
+		{"Origin", ""},
+		{"Connection", "keep-alive"},
+		{"Referer", ""},
+		{"Cookie", ""},
+		{"Sec-Fetch-Dest", "empty"},
+		{"Sec-Fetch-Mode", "cors"},
+		{"Sec-Fetch-Site", "same-origin"},
+		{"Priority", "u=4"},
+	},
+}
+
+// header returns the configured headers as an http.Header.
+func (r *HTTPRequest) header() http.Header {
+	header := make(http.Header, len(r.Header))
+	for k, v := range r.Header {
+		header.Set(k, v)
+	}
+	return header
+}
+
+func (r *HTTPRequest) url() *url.URL {
+	return &url.URL{Scheme: "https", Host: r.Host, Path: r.Path}
+}
+
+// handshakeRequest wraps a raw handshake, magic included, in the JSON POST
+// the server's handshake reader expects.
+func (r *HTTPRequest) handshakeRequest(raw []byte) ([]byte, error) {
+	body, err := json.Marshal(HandshakeHTTPEnvelope{Data: base64.StdEncoding.EncodeToString(raw)})
+	if err != nil {
+		return nil, err
+	}
+	header := r.header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", "application/json")
+	}
+	if r.Upgrade != "" {
+		header.Set("Connection", "Upgrade")
+		header.Set("Upgrade", r.Upgrade)
+	}
+	if r.Jar != nil && header.Get("Cookie") == "" {
+		var cookies []string
+		for _, c := range r.Jar.Cookies(r.url()) {
+			cookies = append(cookies, c.String())
+		}
+		if len(cookies) > 0 {
+			header.Set("Cookie", strings.Join(cookies, "; "))
+		}
+	}
+	if fields, ok := browserHeaders[r.Browser]; ok {
+		return r.render(fields, header, body), nil
+	}
+
+	req, err := http.NewRequest(http.MethodPost, "http://"+r.Host+r.Path, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header = header
+	var out bytes.Buffer
+	if err := req.Write(&out); err != nil {
+		return nil, err
+	}
+	return out.Bytes(), nil
+}
+
+// render writes the request with the preset's headers in its order,
+// followed by any other configured headers.
+func (r *HTTPRequest) render(fields []headerField, header http.Header, body []byte) []byte {
+	origin := "https://" + r.Host
+	derived := map[string]string{
+		"Host":           r.Host,
+		"Content-Length": strconv.Itoa(len(body)),
+		"Origin":         origin,
+		"Referer":        origin + "/",
+	}
+	out := []byte("POST " + r.Path + " HTTP/1.1\r\n")
+	for _, f := range fields {
+		key := http.CanonicalHeaderKey(f.name)
+		value := header.Get(key)
+		if value == "" {
+			value = derived[key]
+		}
+		if value == "" {
+			value = f.value
+		}
+		header.Del(key)
+		if value != "" {
+			out = append(out, f.name+": "+value+"\r\n"...)
+		}
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, k+": "+header.Get(k)+"\r\n"...)
+	}
+	out = append(out, "\r\n"...)
+	return append(out, body...)
+}
+
+// storeCookies keeps the cookies resp sets, if there is a jar.
+func (r *HTTPRequest) storeCookies(resp *http.Response) {
+	if r != nil && r.Jar != nil {
+		if cookies := resp.Cookies(); len(cookies) > 0 {
+			r.Jar.SetCookies(r.url(), cookies)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+	"testing"
+)
+
+func TestBrowserHandshakeRequest(t *testing.T) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := &HTTPRequest{
+		Host:    "api.example.com",
+		Path:    "/v1/sync",
+		Header:  map[string]string{"Accept-Language": "de-DE,de;q=0.9", "X-Client": "app"},
+		Browser: "chrome",
+		Jar:     jar,
+	}
+	r.storeCookies(&http.Response{Header: http.Header{"Set-Cookie": {"sid=abc; Path=/; Secure"}}})
+
+	raw, err := r.handshakeRequest([]byte("handshake"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	head := string(raw[:strings.Index(string(raw), "\r\n\r\n")])
+	var names []string
+	for _, line := range strings.Split(head, "\r\n")[1:] {
+		names = append(names, line[:strings.Index(line, ":")])
+	}
+	want := "Host Connection Content-Length sec-ch-ua sec-ch-ua-mobile sec-ch-ua-platform User-Agent Content-Type Accept Origin Sec-Fetch-Site Sec-Fetch-Mode Sec-Fetch-Dest Referer Accept-Encoding Accept-Language Cookie X-Client"
+	if got := strings.Join(names, " "); got != want {
+		t.Fatalf("header order:\n%s\nwant\n%s", got, want)
+	}
+
+	req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(raw)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if req.Header.Get("Accept-Language") != "de-DE,de;q=0.9" || req.Header.Get("Cookie") != "sid=abc" {
+		t.Fatalf("unexpected headers: %v", req.Header)
+	}
+	if req.Header.Get("Origin") != "https://api.example.com" || !strings.Contains(req.UserAgent(), "Chrome/") {
+		t.Fatalf("unexpected browser headers: %v", req.Header)
+	}
+	body, _ := io.ReadAll(req.Body)
+	var envelope HandshakeHTTPEnvelope
+	if err := json.Unmarshal(body, &envelope); err != nil || envelope.Data != base64.StdEncoding.EncodeToString([]byte("handshake")) {
+		t.Fatalf("unexpected body %q", body)
+	}
+}
@@ -0,0 +1,129 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+)
+
+// fuzzKey keys both ends of the sessions ReadFrame is fuzzed with, so
+// seeded frames authenticate.
+var fuzzKey = bytes.Repeat([]byte{7}, 32)
+
+func handshakeSeeds() [][]byte {
+	var hs ClientHandshake
+	hs.PublicKey[0], hs.UserID[0], hs.Nonce[0] = 1, 2, 3
+	hs.Timestamp = 1700000000
+	plain := EncodeClientHandshake(hs)
+	hs.Versions = 1
+	hs.PolicyReq = []byte(`{"v":1,"uplink":"zoom"}`)
+	hs.Padding = make([]byte, 16)
+	full := EncodeClientHandshake(hs)
+	hs.Padding = []byte{}
+	emptyPadding := EncodeClientHandshake(hs)
+	return [][]byte{plain, full, emptyPadding, full[:80], plain[:73], append(plain[:72:72], 0xff, 0xff)}
+}
+
+func FuzzParseBinaryHandshake(f *testing.F) {
+	for _, seed := range handshakeSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		hs, err := ParseBinaryHandshake(raw)
+		if err != nil {
+			return
+		}
+		again, err := ParseBinaryHandshake(EncodeClientHandshake(hs))
+		if err != nil {
+			t.Fatalf("re-encoded handshake does not parse: %v", err)
+		}
+		if !reflect.DeepEqual(hs, again) {
+			t.Fatalf("handshake changed across re-encoding: %+v != %+v", hs, again)
+		}
+	})
+}
+
+func FuzzReadBinaryHandshake(f *testing.F) {
+	for _, seed := range handshakeSeeds() {
+		f.Add(seed)
+	}
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		r := bytes.NewReader(raw)
+		hs, err := ReadBinaryHandshake(r)
+		if err != nil {
+			return
+		}
+		// The streaming reader must agree with the parser on what it read.
+		consumed := raw[:len(raw)-r.Len()]
+		parsed, err := ParseBinaryHandshake(consumed)
+		if err != nil {
+			t.Fatalf("read a handshake the parser rejects: %v", err)
+		}
+		if !reflect.DeepEqual(hs, parsed) {
+			t.Fatalf("reader and parser disagree: %+v != %+v", hs, parsed)
+		}
+	})
+}
+
+func FuzzReadFrame(f *testing.F) {
+	writer, err := NewSession(fuzzKey)
+	if err != nil {
+		f.Fatal(err)
+	}
+	var frames bytes.Buffer
+	for _, frame := range []struct {
+		typ     uint8
+		payload []byte
+	}{
+		{FrameTypeData, []byte("hello")},
+		{FrameTypePadding, make([]byte, 300)},
+		{FrameTypeClose, []byte{CloseRST, CloseErrorUpstream}},
+	} {
+		if err := writer.WriteFrame(&frames, frame.typ, frame.payload); err != nil {
+			f.Fatal(err)
+		}
+	}
+	f.Add(frames.Bytes())
+	f.Add(frames.Bytes()[:10])
+	f.Add([]byte{0xff, 0xff, FrameTypeData})
+	f.Add([]byte{0x00, 0x00, FrameTypeData})
+	f.Fuzz(func(t *testing.T, raw []byte) {
+		s, err := NewSession(fuzzKey)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := bytes.NewReader(raw)
+		for {
+			frame, err := s.ReadFrame(r)
+			if err != nil {
+				return
+			}
+			if len(frame.Payload) > maxFramePayloadSize {
+				t.Fatalf("%d-byte payload exceeds a frame", len(frame.Payload))
+			}
+		}
+	})
+}
+
+func TestReadFrameDoesNotTrustLength(t *testing.T) {
+	s, err := NewSession(fuzzKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := []byte{0xff, 0xff, FrameTypeData}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	const headers = 1000
+	for i := 0; i < headers; i++ {
+		if _, err := s.ReadFrame(bytes.NewReader(header)); err != io.EOF {
+			t.Fatalf("headers alone read as %v", err)
+		}
+	}
+	runtime.ReadMemStats(&after)
+	// Trusting the length would allocate 64 KiB per header.
+	if allocated := after.TotalAlloc - before.TotalAlloc; allocated > headers*2*frameReadChunk {
+		t.Fatalf("%d forged headers allocated %d bytes", headers, allocated)
+	}
+}
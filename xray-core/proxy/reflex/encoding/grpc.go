@@ -0,0 +1,200 @@
+package encoding
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"golang.org/x/net/http2"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+
+	// defaultGRPCMethod matches the method name of Xray's gun transport.
+	defaultGRPCMethod = "Tun"
+	// maxGRPCMessageSize bounds one message; Reflex writes are a few frames.
+	maxGRPCMessageSize = 4 * (3 + maxFramePayloadSize)
+)
+
+// GRPCPath is the request path of a streaming call to service/method.
+func GRPCPath(service, method string) string {
+	if method == "" {
+		method = defaultGRPCMethod
+	}
+	return "/" + service + "/" + method
+}
+
+// grpcStreamConn carries a Reflex byte stream in the messages of one
+// bidirectional gRPC call. Each message is a protobuf with the bytes in
+// field 1, like gun's Hunk, so gRPC-aware proxies see well-formed traffic.
+type grpcStreamConn struct {
+	net.Conn
+
+	reader  io.Reader
+	pending []byte
+
+	writeMu sync.Mutex
+	writer  io.Writer
+	flush   func()
+	done    func()
+	closed  bool
+}
+
+// NewGRPCStreamConn serves a call on conn from the server side: it reads the
+// messages of body and writes them to w, flushing after each.
+func NewGRPCStreamConn(conn net.Conn, body io.Reader, w io.Writer, flush func()) net.Conn {
+	return &grpcStreamConn{Conn: conn, reader: body, writer: w, flush: flush}
+}
+
+func (c *grpcStreamConn) Read(b []byte) (int, error) {
+	for len(c.pending) == 0 {
+		var header [5]byte
+		if _, err := io.ReadFull(c.reader, header[:]); err != nil {
+			return 0, err
+		}
+		if header[0] != 0 {
+			return 0, errors.New("compressed grpc messages are not supported")
+		}
+		size := binary.BigEndian.Uint32(header[1:])
+		if size > maxGRPCMessageSize {
+			return 0, errors.New("grpc message too large: ", size)
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(c.reader, msg); err != nil {
+			return 0, err
+		}
+		data, err := decodeHunk(msg)
+		if err != nil {
+			return 0, err
+		}
+		c.pending = data
+	}
+	n := copy(b, c.pending)
+	c.pending = c.pending[n:]
+	return n, nil
+}
+
+// Write sends b as one gRPC message.
+func (c *grpcStreamConn) Write(b []byte) (int, error) {
+	if len(b) == 0 {
+		return 0, nil
+	}
+	msg := make([]byte, 5, 5+1+binary.MaxVarintLen64+len(b))
+	msg = append(msg, 0x0A)
+	msg = binary.AppendUvarint(msg, uint64(len(b)))
+	msg = append(msg, b...)
+	binary.BigEndian.PutUint32(msg[1:5], uint32(len(msg)-5))
+
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closed {
+		return 0, io.ErrClosedPipe
+	}
+	if _, err := c.writer.Write(msg); err != nil {
+		return 0, err
+	}
+	if c.flush != nil {
+		c.flush()
+	}
+	return len(b), nil
+}
+
+// Close stops further writes, which on the server must not outlive the
+// handler that owns the response writer.
+func (c *grpcStreamConn) Close() error {
+	c.writeMu.Lock()
+	c.closed = true
+	c.writeMu.Unlock()
+	if c.done != nil {
+		c.done()
+	}
+	return nil
+}
+
+func (*grpcStreamConn) SetDeadline(time.Time) error      { return nil }
+func (*grpcStreamConn) SetReadDeadline(time.Time) error  { return nil }
+func (*grpcStreamConn) SetWriteDeadline(time.Time) error { return nil }
+
+// decodeHunk extracts field 1 from a Hunk message.
+func decodeHunk(msg []byte) ([]byte, error) {
+	if len(msg) == 0 {
+		return nil, nil
+	}
+	if msg[0] != 0x0A {
+		return nil, errors.New("unexpected grpc message field ", msg[0])
+	}
+	size, n := binary.Uvarint(msg[1:])
+	if n <= 0 || uint64(len(msg)-1-n) != size {
+		return nil, errors.New("malformed grpc message")
+	}
+	return msg[1+n:], nil
+}
+
+// DialGRPC starts a streaming call to service/method over conn and returns
+// it as a connection for a Reflex session. Any TLS is expected to be applied
+// to conn by the transport already.
+func DialGRPC(ctx context.Context, conn net.Conn, host, service, method string) (net.Conn, error) {
+	transport := &http2.Transport{AllowHTTP: true}
+	cc, err := transport.NewClientConn(conn)
+	if err != nil {
+		return nil, errors.New("failed to start reflex grpc connection").Base(err)
+	}
+	body, bodyWriter := io.Pipe()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "http://"+host+GRPCPath(service, method), body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/grpc")
+	req.Header.Set("Te", "trailers")
+
+	// The call must be in flight before the first write, since the body
+	// pipe only drains once the request is being sent.
+	respCh := make(chan io.Reader, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		resp, err := cc.RoundTrip(req)
+		if err != nil {
+			errCh <- errors.New("reflex grpc call failed").Base(err)
+			return
+		}
+		if resp.StatusCode != http.StatusOK {
+			resp.Body.Close()
+			errCh <- errors.New("reflex grpc call rejected").Base(rejected(resp))
+			return
+		}
+		respCh <- resp.Body
+	}()
+	return &grpcStreamConn{
+		Conn:   conn,
+		reader: &lazyReader{ch: respCh, errCh: errCh},
+		writer: bodyWriter,
+		done: func() {
+			bodyWriter.Close()
+			cc.Close()
+		},
+	}, nil
+}
+
+// lazyReader reads from a response body once it arrives.
+type lazyReader struct {
+	ch    <-chan io.Reader
+	errCh <-chan error
+	r     io.Reader
+}
+
+func (l *lazyReader) Read(b []byte) (int, error) {
+	if l.r == nil {
+		select {
+		case l.r = <-l.ch:
+		case err := <-l.errCh:
+			return 0, err
+		}
+	}
+	return l.r.Read(b)
+}
@@ -0,0 +1,41 @@
+package encoding
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestGRPCStreamConnMessages(t *testing.T) {
+	var wire bytes.Buffer
+	writer := &grpcStreamConn{writer: &wire}
+	for _, msg := range []string{"hello", "", "reflex"} {
+		if _, err := writer.Write([]byte(msg)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Two messages; the empty write sends nothing.
+	if got := wire.Bytes()[:7]; !bytes.Equal(got, []byte{0, 0, 0, 0, 7, 0x0A, 5}) {
+		t.Fatalf("unexpected message prefix %x", got)
+	}
+
+	reader := &grpcStreamConn{reader: &wire}
+	got := make([]byte, 0, 16)
+	chunk := make([]byte, 3)
+	for len(got) < len("helloreflex") {
+		n, err := reader.Read(chunk)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got = append(got, chunk[:n]...)
+	}
+	if string(got) != "helloreflex" {
+		t.Fatalf("unexpected stream %q", got)
+	}
+
+	if _, err := (&grpcStreamConn{reader: bytes.NewReader([]byte{1, 0, 0, 0, 0})}).Read(chunk); err == nil {
+		t.Fatal("expected compressed message to be rejected")
+	}
+	if _, err := decodeHunk([]byte{0x0A, 5, 'a'}); err == nil {
+		t.Fatal("expected truncated hunk to be rejected")
+	}
+}
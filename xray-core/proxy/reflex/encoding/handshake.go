@@ -0,0 +1,522 @@
+package encoding
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/ecdh"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	mathrand "math/rand"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/crypto/hkdf"
+
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	ReflexMagic          uint32 = 0x5246584C // REFX
+	MaxPolicyPayloadSize        = 4096
+	handshakeSkew               = 5 * time.Minute
+
+	// The policy length field only needs 13 bits; the top bits carry flags.
+	handshakeLengthMask  uint16 = 0x1FFF
+	handshakeFlagPadding uint16 = 0x8000
+	handshakeFlagVersion uint16 = 0x4000
+
+	maxHandshakePaddingSize = 1500
+	MaxHandshakeBodySize    = 16 * 1024
+)
+
+// Protocol versions. Version 1 is the original handshake, which carries no
+// version field. Later clients flag a version byte offering a bitmask of the
+// versions they speak, and the server answers with the one it picked; both
+// are bound into the session key so the choice can't be rewritten in transit.
+// Version 3 also authenticates frame headers, version 4 masks their lengths
+// and version 5 lets a policy grant span several frames.
+const (
+	ProtocolVersion1 uint8 = 1
+	ProtocolVersion2 uint8 = 2
+	ProtocolVersion3 uint8 = 3
+	ProtocolVersion4 uint8 = 4
+	ProtocolVersion5 uint8 = 5
+
+	supportedProtocolVersions = 1<<(ProtocolVersion1-1) | 1<<(ProtocolVersion2-1) | 1<<(ProtocolVersion3-1) | 1<<(ProtocolVersion4-1) | 1<<(ProtocolVersion5-1)
+)
+
+// ClientHandshake is the parsed handshake payload from the client.
+type ClientHandshake struct {
+	PublicKey [32]byte
+	UserID    [16]byte
+	PolicyReq []byte
+	Timestamp int64
+	Nonce     [16]byte
+	Padding   []byte
+	// Versions is the bitmask of offered protocol versions, bit 0 being
+	// version 1. Zero means the client predates version negotiation.
+	Versions uint8
+}
+
+// ServerHandshake is the handshake payload sent by the server.
+type ServerHandshake struct {
+	PublicKey   [32]byte
+	PolicyGrant []byte
+	Padding     []byte
+	// Version is the selected protocol version, zero when the client didn't
+	// negotiate.
+	Version uint8
+}
+
+// SelectProtocolVersion picks the highest version offered that this side
+// supports.
+func SelectProtocolVersion(offered uint8) (uint8, bool) {
+	common := offered & supportedProtocolVersions
+	for v := uint8(8); v > 0; v-- {
+		if common&(1<<(v-1)) != 0 {
+			return v, true
+		}
+	}
+	return 0, false
+}
+
+// SupportedProtocolVersion reports whether v is a protocol version this
+// build speaks.
+func SupportedProtocolVersion(v uint8) bool {
+	return v >= 1 && v <= 8 && supportedProtocolVersions&(1<<(v-1)) != 0
+}
+
+// OfferedVersions is the bitmask of supported versions from min up.
+func OfferedVersions(min uint8) uint8 {
+	if min <= 1 {
+		return supportedProtocolVersions
+	}
+	if min > 8 {
+		return 0
+	}
+	return supportedProtocolVersions &^ (1<<(min-1) - 1)
+}
+
+// SessionKeyInfo is the HKDF info for a session. Negotiated sessions bind
+// the client's offer, the server's choice and the handshake transcript, so
+// altering any handshake field in transit yields different keys on the two
+// sides.
+func SessionKeyInfo(client ClientHandshake, serverPub [32]byte, selected uint8) []byte {
+	info := []byte("reflex-session")
+	if client.Versions == 0 {
+		return info
+	}
+	transcript := handshakeTranscript(client, serverPub, selected)
+	info = append(info, client.Versions, selected)
+	return append(info, transcript[:]...)
+}
+
+// handshakeTranscript hashes what both sides know before the key exists:
+// the whole client handshake and the server's public key and version. The
+// grant is sealed under the resulting key and padding carries nothing, so
+// neither needs binding.
+func handshakeTranscript(client ClientHandshake, serverPub [32]byte, selected uint8) [32]byte {
+	h := sha256.New()
+	h.Write([]byte("reflex-transcript"))
+	h.Write(EncodeClientHandshake(client))
+	h.Write(serverPub[:])
+	h.Write([]byte{selected})
+	var sum [32]byte
+	h.Sum(sum[:0])
+	return sum
+}
+
+type HandshakeHTTPEnvelope struct {
+	Data string `json:"data"`
+}
+
+func ReadBinaryHandshake(r io.Reader) (ClientHandshake, error) {
+	var head [32 + 16 + 8 + 16 + 2]byte
+	if _, err := io.ReadFull(r, head[:]); err != nil {
+		return ClientHandshake{}, err
+	}
+
+	var hs ClientHandshake
+	copy(hs.PublicKey[:], head[0:32])
+	copy(hs.UserID[:], head[32:48])
+	hs.Timestamp = int64(binary.BigEndian.Uint64(head[48:56]))
+	copy(hs.Nonce[:], head[56:72])
+	lengthField := binary.BigEndian.Uint16(head[72:74])
+	policyLen := lengthField & handshakeLengthMask
+
+	if policyLen > MaxPolicyPayloadSize {
+		return ClientHandshake{}, errors.New("reflex handshake policy too large")
+	}
+	if lengthField&handshakeFlagVersion != 0 {
+		var versions [1]byte
+		if _, err := io.ReadFull(r, versions[:]); err != nil {
+			return ClientHandshake{}, err
+		}
+		if versions[0] == 0 {
+			return ClientHandshake{}, errors.New("reflex handshake offers no protocol version")
+		}
+		hs.Versions = versions[0]
+	}
+	if policyLen > 0 {
+		hs.PolicyReq = make([]byte, policyLen)
+		if _, err := io.ReadFull(r, hs.PolicyReq); err != nil {
+			return ClientHandshake{}, err
+		}
+	}
+	if lengthField&handshakeFlagPadding != 0 {
+		padding, err := readHandshakePadding(r)
+		if err != nil {
+			return ClientHandshake{}, err
+		}
+		hs.Padding = padding
+	}
+	return hs, nil
+}
+
+func readHandshakePadding(r io.Reader) ([]byte, error) {
+	var lenBuf [2]byte
+	if _, err := io.ReadFull(r, lenBuf[:]); err != nil {
+		return nil, err
+	}
+	padLen := binary.BigEndian.Uint16(lenBuf[:])
+	if padLen > maxHandshakePaddingSize {
+		return nil, errors.New("reflex handshake padding too large")
+	}
+	padding := make([]byte, padLen)
+	if _, err := io.ReadFull(r, padding); err != nil {
+		return nil, err
+	}
+	return padding, nil
+}
+
+func ParseBinaryHandshake(raw []byte) (ClientHandshake, error) {
+	if len(raw) < 74 {
+		return ClientHandshake{}, errors.New("reflex handshake too short")
+	}
+	lengthField := binary.BigEndian.Uint16(raw[72:74])
+	policyLen := int(lengthField & handshakeLengthMask)
+	if policyLen > MaxPolicyPayloadSize {
+		return ClientHandshake{}, errors.New("reflex handshake policy too large")
+	}
+	var hs ClientHandshake
+	body := raw[74:]
+	if lengthField&handshakeFlagVersion != 0 {
+		if len(body) < 1 || body[0] == 0 {
+			return ClientHandshake{}, errors.New("reflex handshake offers no protocol version")
+		}
+		hs.Versions, body = body[0], body[1:]
+	}
+	if len(body) < policyLen {
+		return ClientHandshake{}, errors.New("reflex handshake malformed payload length")
+	}
+	copy(hs.PublicKey[:], raw[0:32])
+	copy(hs.UserID[:], raw[32:48])
+	hs.Timestamp = int64(binary.BigEndian.Uint64(raw[48:56]))
+	copy(hs.Nonce[:], raw[56:72])
+	if policyLen > 0 {
+		hs.PolicyReq = append([]byte(nil), body[:policyLen]...)
+	}
+	padding, err := parseHandshakePadding(body[policyLen:], lengthField&handshakeFlagPadding != 0)
+	if err != nil {
+		return ClientHandshake{}, err
+	}
+	hs.Padding = padding
+	return hs, nil
+}
+
+// parseHandshakePadding validates the bytes trailing a handshake body, which
+// must be exactly one length-prefixed padding block when flagged and empty otherwise.
+func parseHandshakePadding(rest []byte, flagged bool) ([]byte, error) {
+	if !flagged {
+		if len(rest) != 0 {
+			return nil, errors.New("reflex handshake malformed payload length")
+		}
+		return nil, nil
+	}
+	if len(rest) < 2 {
+		return nil, errors.New("reflex handshake padding truncated")
+	}
+	padLen := int(binary.BigEndian.Uint16(rest[:2]))
+	if padLen > maxHandshakePaddingSize {
+		return nil, errors.New("reflex handshake padding too large")
+	}
+	if len(rest) != 2+padLen {
+		return nil, errors.New("reflex handshake malformed payload length")
+	}
+	// Keep empty padding non-nil so re-encoding keeps the flag, which the
+	// transcript depends on.
+	padding := make([]byte, padLen)
+	copy(padding, rest[2:])
+	return padding, nil
+}
+
+// EncodeClientHandshake serializes a client handshake without the magic prefix.
+func EncodeClientHandshake(hs ClientHandshake) []byte {
+	lengthField := uint16(len(hs.PolicyReq))
+	size := 74 + len(hs.PolicyReq)
+	if hs.Versions != 0 {
+		lengthField |= handshakeFlagVersion
+		size++
+	}
+	if hs.Padding != nil {
+		lengthField |= handshakeFlagPadding
+		size += 2 + len(hs.Padding)
+	}
+	raw := make([]byte, size)
+	copy(raw[0:32], hs.PublicKey[:])
+	copy(raw[32:48], hs.UserID[:])
+	binary.BigEndian.PutUint64(raw[48:56], uint64(hs.Timestamp))
+	copy(raw[56:72], hs.Nonce[:])
+	binary.BigEndian.PutUint16(raw[72:74], lengthField)
+	n := 74
+	if hs.Versions != 0 {
+		raw[n] = hs.Versions
+		n++
+	}
+	n += copy(raw[n:], hs.PolicyReq)
+	if hs.Padding != nil {
+		binary.BigEndian.PutUint16(raw[n:n+2], uint16(len(hs.Padding)))
+		copy(raw[n+2:], hs.Padding)
+	}
+	return raw
+}
+
+// HandshakePadding draws a padding block so that a handshake of baseLen bytes
+// grows to a packet size sampled from profile. It is never nil, so callers
+// always emit the padding flag and the padded size itself varies.
+func HandshakePadding(profile *TrafficProfile, baseLen int) ([]byte, error) {
+	padLen := 0
+	if profile != nil {
+		padLen = weightedPickSize(profile.PacketSizes) - baseLen
+	}
+	if padLen <= 0 {
+		padLen = mathrand.Intn(64)
+	}
+	if padLen > maxHandshakePaddingSize {
+		padLen = maxHandshakePaddingSize
+	}
+	padding := make([]byte, padLen)
+	if _, err := io.ReadFull(rand.Reader, padding); err != nil {
+		return nil, err
+	}
+	return padding, nil
+}
+
+func ValidateHandshakeTimestamp(ts int64) error {
+	t := time.Unix(ts, 0)
+	now := time.Now()
+	if t.Before(now.Add(-handshakeSkew)) || t.After(now.Add(handshakeSkew)) {
+		return errors.New("reflex handshake timestamp out of range")
+	}
+	return nil
+}
+
+func GenerateKeyPair() ([]byte, [32]byte, error) {
+	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	if err != nil {
+		return nil, [32]byte{}, err
+	}
+	pub := privateKey.PublicKey().Bytes()
+	var publicKey [32]byte
+	copy(publicKey[:], pub)
+	return privateKey.Bytes(), publicKey, nil
+}
+
+func DeriveSharedKey(privateKey []byte, peerPublic [32]byte) ([32]byte, error) {
+	// X25519 is the Montgomery form of Curve25519 used for ECDH key agreement.
+	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	peer, err := ecdh.X25519().NewPublicKey(peerPublic[:])
+	if err != nil {
+		return [32]byte{}, err
+	}
+	secret, err := priv.ECDH(peer)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	var shared [32]byte
+	copy(shared[:], secret)
+	return shared, nil
+}
+
+// PSKSize is the size of a pre-shared key.
+const PSKSize = 32
+
+// MixPSK folds a pre-shared key into the X25519 shared secret, so that the
+// session key also depends on a secret that never crosses the wire. Without
+// a PSK the shared secret is used as is.
+func MixPSK(shared [32]byte, psk []byte) []byte {
+	if len(psk) == 0 {
+		return shared[:]
+	}
+	mac := hmac.New(sha256.New, psk)
+	mac.Write([]byte("reflex-psk"))
+	mac.Write(shared[:])
+	return mac.Sum(nil)
+}
+
+func DeriveSessionKey(sharedKey, salt, info []byte) ([]byte, error) {
+	r := hkdf.New(sha256.New, sharedKey, salt, info)
+	key := make([]byte, chacha20poly1305.KeySize)
+	if _, err := io.ReadFull(r, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+// TokenBucketSeconds is the period a user's index cipher stays the same
+// for. A handshake timestamp within handshakeSkew of now falls in the
+// current bucket or one next to it.
+const TokenBucketSeconds = int64(handshakeSkew / time.Second)
+
+// UserToken is what a negotiating client sends in place of its UUID. The
+// first half indexes the user: the ephemeral key encrypted under a cipher
+// keyed by the UUID and the timestamp's bucket, which lets the server match
+// it with one block encryption per user instead of an HMAC. As the
+// ephemeral key is fresh for every handshake so is the index, and an
+// observer can't link a user's handshakes by it. The second half is an
+// HMAC of the ephemeral key and timestamp, so a token is good for one
+// handshake only. A non-empty binding, the server's handshake_binding, is
+// MACed into it so the token authenticates at that server only.
+func UserToken(id [16]byte, pub [32]byte, ts int64, binding []byte) [16]byte {
+	var token [16]byte
+	index := UserTokenIndex(UserIndexCipher(id, ts/TokenBucketSeconds), pub)
+	copy(token[:8], index[:])
+	mac := hmac.New(sha256.New, id[:])
+	mac.Write([]byte("reflex-user-id"))
+	mac.Write(pub[:])
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(ts)))
+	if len(binding) > 0 {
+		mac.Write([]byte("reflex-binding"))
+		mac.Write(binding)
+	}
+	copy(token[8:], mac.Sum(nil))
+	return token
+}
+
+// UserIndexCipher is the cipher of the index halves of id's userTokens in
+// bucket.
+func UserIndexCipher(id [16]byte, bucket int64) cipher.Block {
+	mac := hmac.New(sha256.New, id[:])
+	mac.Write([]byte("reflex-user-index"))
+	mac.Write(binary.BigEndian.AppendUint64(nil, uint64(bucket)))
+	return common.Must2(aes.NewCipher(mac.Sum(nil)[:16]))
+}
+
+// UserTokenIndex is the index half of a userToken for ephemeral key pub
+// under the user's index cipher for the token's bucket.
+func UserTokenIndex(block cipher.Block, pub [32]byte) [8]byte {
+	var sealed [aes.BlockSize]byte
+	block.Encrypt(sealed[:], pub[:aes.BlockSize])
+	var index [8]byte
+	copy(index[:], sealed[:])
+	return index
+}
+
+func EncryptPolicyGrant(sessionKey []byte, policy string) ([]byte, error) {
+	aead, err := chacha20poly1305.New(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+	ciphertext := aead.Seal(nil, nonce, []byte(policy), nil)
+	return append(nonce, ciphertext...), nil
+}
+
+func decryptPolicyGrant(sessionKey, grant []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.New(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(grant) < aead.NonceSize()+aead.Overhead() {
+		return nil, errors.New("reflex policy grant too short")
+	}
+	nonce, ciphertext := grant[:aead.NonceSize()], grant[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, nil)
+}
+
+// ParseClientHandshake decodes a binary client handshake. A leading magic
+// number is accepted and skipped.
+func ParseClientHandshake(raw []byte) (ClientHandshake, error) {
+	if len(raw) >= 4 && binary.BigEndian.Uint32(raw[:4]) == ReflexMagic {
+		raw = raw[4:]
+	}
+	return ParseBinaryHandshake(raw)
+}
+
+// ParseServerHandshake decodes the binary server handshake carried in the
+// handshake response envelope.
+func ParseServerHandshake(raw []byte) (ServerHandshake, error) {
+	return parseServerHandshake(raw)
+}
+
+// DecryptPolicyGrant opens a policy grant with the negotiated session key.
+func DecryptPolicyGrant(sessionKey, grant []byte) ([]byte, error) {
+	return decryptPolicyGrant(sessionKey, grant)
+}
+
+func MarshalServerHandshake(hs ServerHandshake) []byte {
+	policyLen := len(hs.PolicyGrant)
+	lengthField := uint16(policyLen)
+	size := 32 + 2 + policyLen
+	if hs.Version != 0 {
+		lengthField |= handshakeFlagVersion
+		size++
+	}
+	if hs.Padding != nil {
+		lengthField |= handshakeFlagPadding
+		size += 2 + len(hs.Padding)
+	}
+	payload := make([]byte, size)
+	copy(payload[:32], hs.PublicKey[:])
+	binary.BigEndian.PutUint16(payload[32:34], lengthField)
+	n := 34
+	if hs.Version != 0 {
+		payload[n] = hs.Version
+		n++
+	}
+	n += copy(payload[n:], hs.PolicyGrant)
+	if hs.Padding != nil {
+		binary.BigEndian.PutUint16(payload[n:n+2], uint16(len(hs.Padding)))
+		copy(payload[n+2:], hs.Padding)
+	}
+	return payload
+}
+
+func parseServerHandshake(raw []byte) (ServerHandshake, error) {
+	if len(raw) < 34 {
+		return ServerHandshake{}, errors.New("reflex server handshake too short")
+	}
+	lengthField := binary.BigEndian.Uint16(raw[32:34])
+	policyLen := int(lengthField & handshakeLengthMask)
+	var hs ServerHandshake
+	body := raw[34:]
+	if lengthField&handshakeFlagVersion != 0 {
+		if len(body) < 1 || body[0] == 0 {
+			return ServerHandshake{}, errors.New("reflex server handshake has no protocol version")
+		}
+		hs.Version, body = body[0], body[1:]
+	}
+	if len(body) < policyLen {
+		return ServerHandshake{}, errors.New("reflex server handshake malformed payload length")
+	}
+	copy(hs.PublicKey[:], raw[:32])
+	if policyLen > 0 {
+		hs.PolicyGrant = append([]byte(nil), body[:policyLen]...)
+	}
+	padding, err := parseHandshakePadding(body[policyLen:], lengthField&handshakeFlagPadding != 0)
+	if err != nil {
+		return ServerHandshake{}, err
+	}
+	hs.Padding = padding
+	return hs, nil
+}
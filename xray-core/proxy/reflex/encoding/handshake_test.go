@@ -0,0 +1,325 @@
+package encoding
+
+import (
+	"bytes"
+	"crypto/ecdh"
+	"crypto/rand"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+func buildClientHandshake(t *testing.T, id [16]byte, ts int64, nonce [16]byte, policy []byte) ClientHandshake {
+	t.Helper()
+	curve := ecdh.X25519()
+	priv, err := curve.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("failed to generate client key: %v", err)
+	}
+
+	var pub [32]byte
+	copy(pub[:], priv.PublicKey().Bytes())
+	return ClientHandshake{
+		PublicKey: pub,
+		UserID:    id,
+		PolicyReq: policy,
+		Timestamp: ts,
+		Nonce:     nonce,
+	}
+}
+
+func marshalClientHandshake(hs ClientHandshake) []byte {
+	raw := make([]byte, 74+len(hs.PolicyReq))
+	copy(raw[0:32], hs.PublicKey[:])
+	copy(raw[32:48], hs.UserID[:])
+	binary.BigEndian.PutUint64(raw[48:56], uint64(hs.Timestamp))
+	copy(raw[56:72], hs.Nonce[:])
+	binary.BigEndian.PutUint16(raw[72:74], uint16(len(hs.PolicyReq)))
+	copy(raw[74:], hs.PolicyReq)
+	return raw
+}
+
+func TestBinaryHandshakeRoundTrip(t *testing.T) {
+	var id [16]byte
+	copy(id[:], []byte("0123456789abcdef"))
+	var nonce [16]byte
+	copy(nonce[:], []byte("fedcba9876543210"))
+
+	hs := ClientHandshake{
+		UserID:    id,
+		Timestamp: time.Now().Unix(),
+		Nonce:     nonce,
+		PolicyReq: []byte(`{"mode":"test"}`),
+	}
+	raw := marshalClientHandshake(hs)
+
+	parsed, err := ParseBinaryHandshake(raw)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if parsed.Timestamp != hs.Timestamp {
+		t.Fatalf("timestamp mismatch: got=%d want=%d", parsed.Timestamp, hs.Timestamp)
+	}
+
+	magic := make([]byte, 4, 4+len(raw))
+	binary.BigEndian.PutUint32(magic, ReflexMagic)
+	exported, err := ParseClientHandshake(append(magic, raw...))
+	if err != nil {
+		t.Fatalf("parse with magic failed: %v", err)
+	}
+	if exported.Nonce != hs.Nonce {
+		t.Fatal("nonce mismatch after parsing with magic")
+	}
+
+	readParsed, err := ReadBinaryHandshake(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(readParsed.PolicyReq, hs.PolicyReq) {
+		t.Fatalf("policy mismatch: got=%q want=%q", string(readParsed.PolicyReq), string(hs.PolicyReq))
+	}
+}
+
+func TestValidateHandshakeTimestamp(t *testing.T) {
+	if err := ValidateHandshakeTimestamp(time.Now().Unix()); err != nil {
+		t.Fatalf("expected valid timestamp: %v", err)
+	}
+	if err := ValidateHandshakeTimestamp(time.Now().Add(-10 * time.Minute).Unix()); err == nil {
+		t.Fatal("expected timestamp out of range")
+	}
+}
+
+func TestUserTokensUnlinkable(t *testing.T) {
+	id := [16]byte{1, 2, 3}
+	// Two handshakes of one user in the same bucket.
+	ts := time.Now().Unix() / TokenBucketSeconds * TokenBucketSeconds
+	_, pub1, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, pub2, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	first := UserToken(id, pub1, ts, nil)
+	second := UserToken(id, pub2, ts+1, nil)
+	if bytes.Equal(first[:8], second[:8]) || bytes.Equal(first[8:], second[8:]) {
+		t.Fatalf("tokens %x and %x share a half", first, second)
+	}
+	// The server still finds the user by the index under its bucket cipher.
+	index := UserTokenIndex(UserIndexCipher(id, ts/TokenBucketSeconds), pub2)
+	if !bytes.Equal(index[:], second[:8]) {
+		t.Fatalf("index %x doesn't match token %x", index, second)
+	}
+}
+
+func TestKeyDerivationAndPolicyEncrypt(t *testing.T) {
+	privA, pubA, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	privB, pubB, err := GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedA, err := DeriveSharedKey(privA, pubB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sharedB, err := DeriveSharedKey(privB, pubA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if sharedA != sharedB {
+		t.Fatal("shared keys should match")
+	}
+
+	sessionKey, err := DeriveSessionKey(sharedA[:], []byte("1234567890123456"), SessionKeyInfo(ClientHandshake{}, [32]byte{}, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	grant, err := EncryptPolicyGrant(sessionKey, "strict")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(grant) <= 12 {
+		t.Fatal("encrypted grant should include nonce and ciphertext")
+	}
+	policy, err := DecryptPolicyGrant(sessionKey, grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(policy) != "strict" {
+		t.Fatalf("decrypted policy = %q", policy)
+	}
+	grant[len(grant)-1] ^= 0xFF
+	if _, err := DecryptPolicyGrant(sessionKey, grant); err == nil {
+		t.Fatal("tampered grant should not decrypt")
+	}
+}
+
+func TestClientHandshakePaddingRoundTrip(t *testing.T) {
+	hs := buildClientHandshake(t, [16]byte{1}, time.Now().Unix(), [16]byte{2}, []byte("policy"))
+	padding, err := HandshakePadding(profileFromPolicy("youtube"), 74+len(hs.PolicyReq))
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs.Padding = padding
+	raw := EncodeClientHandshake(hs)
+
+	parsed, err := ParseBinaryHandshake(raw)
+	if err != nil {
+		t.Fatalf("parse failed: %v", err)
+	}
+	if !bytes.Equal(parsed.PolicyReq, hs.PolicyReq) || !bytes.Equal(parsed.Padding, hs.Padding) {
+		t.Fatal("policy or padding mismatch after parse")
+	}
+	read, err := ReadBinaryHandshake(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatalf("read failed: %v", err)
+	}
+	if !bytes.Equal(read.Padding, hs.Padding) {
+		t.Fatal("padding mismatch after read")
+	}
+
+	if _, err := ParseBinaryHandshake(raw[:len(raw)-1]); err == nil {
+		t.Fatal("expected truncated padding to be rejected")
+	}
+	if _, err := ParseBinaryHandshake(append(marshalClientHandshake(hs), 0)); err == nil {
+		t.Fatal("expected trailing bytes without padding flag to be rejected")
+	}
+}
+
+func TestServerHandshakePaddingRoundTrip(t *testing.T) {
+	hs := ServerHandshake{PolicyGrant: []byte("grant"), Padding: []byte("cover")}
+	copy(hs.PublicKey[:], []byte("12345678901234567890123456789012"))
+	parsed, err := parseServerHandshake(MarshalServerHandshake(hs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.PublicKey != hs.PublicKey || !bytes.Equal(parsed.PolicyGrant, hs.PolicyGrant) || !bytes.Equal(parsed.Padding, hs.Padding) {
+		t.Fatal("server handshake mismatch")
+	}
+
+	hs.Padding = nil
+	parsed, err = parseServerHandshake(MarshalServerHandshake(hs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Padding != nil {
+		t.Fatal("unpadded server handshake should not carry padding")
+	}
+}
+
+func TestProtocolVersionNegotiation(t *testing.T) {
+	for offered, want := range map[uint8]uint8{
+		0x01: ProtocolVersion1,
+		0x03: ProtocolVersion2,
+		0x82: ProtocolVersion2,
+		0x07: ProtocolVersion3,
+		0x0f: ProtocolVersion4,
+		0x1f: ProtocolVersion5,
+		0x80: 0,
+	} {
+		got, ok := SelectProtocolVersion(offered)
+		if got != want || ok != (want != 0) {
+			t.Fatalf("offer %#x selected %d, want %d", offered, got, want)
+		}
+	}
+	for min, want := range map[uint8]uint8{0: 0x1f, 1: 0x1f, 3: 0x1c, 4: 0x18, 9: 0} {
+		if got := OfferedVersions(min); got != want {
+			t.Fatalf("offer from version %d is %#x, want %#x", min, got, want)
+		}
+	}
+
+	hs := buildClientHandshake(t, [16]byte{1}, time.Now().Unix(), [16]byte{2}, []byte("policy"))
+	hs.Versions = OfferedVersions(0)
+	hs.Padding = []byte("pad")
+	raw := EncodeClientHandshake(hs)
+	parsed, err := ParseBinaryHandshake(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadBinaryHandshake(bytes.NewReader(raw))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsed.Versions != hs.Versions || read.Versions != hs.Versions || !bytes.Equal(parsed.PolicyReq, hs.PolicyReq) {
+		t.Fatalf("version offer lost: %+v", parsed)
+	}
+
+	server := ServerHandshake{PolicyGrant: []byte("grant"), Version: ProtocolVersion2}
+	parsedServer, err := parseServerHandshake(MarshalServerHandshake(server))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parsedServer.Version != ProtocolVersion2 || !bytes.Equal(parsedServer.PolicyGrant, server.PolicyGrant) {
+		t.Fatalf("server version lost: %+v", parsedServer)
+	}
+
+	// Stripping the offer must change the key the server derives.
+	shared := bytes.Repeat([]byte{7}, 32)
+	negotiated, err := DeriveSessionKey(shared, hs.Nonce[:], SessionKeyInfo(hs, server.PublicKey, ProtocolVersion2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	stripped := hs
+	stripped.Versions = 0
+	legacy, err := DeriveSessionKey(shared, hs.Nonce[:], SessionKeyInfo(stripped, server.PublicKey, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	downgraded, err := DeriveSessionKey(shared, hs.Nonce[:], SessionKeyInfo(hs, server.PublicKey, ProtocolVersion1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(negotiated, legacy) || bytes.Equal(negotiated, downgraded) {
+		t.Fatal("version negotiation is not bound into the session key")
+	}
+}
+
+func TestSessionKeyBindsTranscript(t *testing.T) {
+	hs := buildClientHandshake(t, [16]byte{1}, time.Now().Unix(), [16]byte{2}, []byte(`{"v":1}`))
+	hs.Versions = OfferedVersions(0)
+	hs.Padding = []byte{}
+	var serverPub [32]byte
+	copy(serverPub[:], bytes.Repeat([]byte{9}, 32))
+	shared := bytes.Repeat([]byte{7}, 32)
+	derive := func(hs ClientHandshake, pub [32]byte) []byte {
+		key, err := DeriveSessionKey(shared, hs.Nonce[:], SessionKeyInfo(hs, pub, ProtocolVersion2))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return key
+	}
+	base := derive(hs, serverPub)
+
+	// The server sees the handshake as parsed off the wire; empty padding
+	// must survive that so both sides hash the same bytes.
+	parsed, err := ParseBinaryHandshake(EncodeClientHandshake(hs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(derive(parsed, serverPub), base) {
+		t.Fatal("parsed handshake derives a different key")
+	}
+
+	tampered := []func(*ClientHandshake){
+		func(h *ClientHandshake) { h.UserID[0] ^= 1 },
+		func(h *ClientHandshake) { h.Timestamp++ },
+		func(h *ClientHandshake) { h.PolicyReq = []byte(`{"v":1,"padding":"none"}`) },
+		func(h *ClientHandshake) { h.Padding = []byte{0} },
+	}
+	for i, tamper := range tampered {
+		modified := hs
+		tamper(&modified)
+		if bytes.Equal(derive(modified, serverPub), base) {
+			t.Fatalf("tampering %d did not change the key", i)
+		}
+	}
+	otherPub := serverPub
+	otherPub[0] ^= 1
+	if bytes.Equal(derive(hs, otherPub), base) {
+		t.Fatal("server public key is not bound")
+	}
+}
@@ -0,0 +1,117 @@
+package encoding
+
+import (
+	"context"
+	"encoding/binary"
+	"io"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	// HeartbeatInterval is how often a session granted FeatureHeartbeat
+	// pings its peer.
+	HeartbeatInterval = 15 * time.Second
+	// heartbeatMisses is how many intervals may pass without a reply before
+	// the peer is presumed dead.
+	heartbeatMisses = 3
+
+	// PING frames carry a flag byte and the sender's clock in unix
+	// nanoseconds, which the reply echoes back unchanged.
+	pingRequest = 0x00
+	pingReply   = 0x01
+
+	// interactiveLatency is the round trip beyond which morphing stops
+	// adding delays, since users start to notice.
+	interactiveLatency = 150 * time.Millisecond
+)
+
+var ErrPeerDead = errors.New("reflex peer stopped answering heartbeats")
+
+func pingPayload(flag byte, sent int64) []byte {
+	payload := make([]byte, 9)
+	payload[0] = flag
+	binary.BigEndian.PutUint64(payload[1:], uint64(sent))
+	return payload
+}
+
+// HandlePing answers a peer's PING on w, or takes an RTT sample from the
+// reply to one of ours.
+func (s *Session) HandlePing(w io.Writer, frame *Frame) error {
+	if len(frame.Payload) != 9 {
+		return errors.New("invalid ping payload")
+	}
+	sent := int64(binary.BigEndian.Uint64(frame.Payload[1:]))
+	switch frame.Payload[0] {
+	case pingRequest:
+		return s.WriteFrame(w, FrameTypePing, pingPayload(pingReply, sent))
+	case pingReply:
+		now := time.Now()
+		s.lastPong.Store(now.UnixNano())
+		if sample := now.Sub(time.Unix(0, sent)); sample > 0 {
+			s.observeRTT(sample)
+		}
+		return nil
+	}
+	return errors.New("unknown ping flag")
+}
+
+// observeRTT folds sample into the smoothed RTT as TCP does (RFC 6298),
+// weighting each new sample by 1/8.
+func (s *Session) observeRTT(sample time.Duration) {
+	srtt := time.Duration(s.srtt.Load())
+	s.observeRTTSpike(sample, srtt)
+	if srtt == 0 {
+		srtt = sample
+	} else {
+		srtt += (sample - srtt) / 8
+	}
+	s.srtt.Store(int64(srtt))
+	if s.observer != nil {
+		s.observer.RTT(srtt)
+	}
+}
+
+// RTT returns the smoothed round-trip time measured by heartbeats, or 0
+// before the first reply.
+func (s *Session) RTT() time.Duration {
+	return time.Duration(s.srtt.Load())
+}
+
+// paceDelay trims a profile delay so that, added to the measured RTT, it
+// stays within interactiveLatency. Without a measurement it is unchanged.
+func (s *Session) paceDelay(delay time.Duration) time.Duration {
+	rtt := s.RTT()
+	if rtt == 0 || delay <= 0 {
+		return delay
+	}
+	return min(delay, max(interactiveLatency-rtt, 0))
+}
+
+// RunHeartbeat pings the peer every interval until ctx is done or a write
+// fails. It returns ErrPeerDead once heartbeatMisses intervals pass without
+// a reply.
+func (s *Session) RunHeartbeat(ctx context.Context, w io.Writer, interval time.Duration) error {
+	s.lastPong.Store(time.Now().UnixNano())
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, s.lastPong.Load())) > heartbeatMisses*interval {
+			return ErrPeerDead
+		}
+		if err := s.Ping(w); err != nil {
+			return err
+		}
+	}
+}
+
+// Ping sends a heartbeat request on w. The peer's reply updates RTT.
+func (s *Session) Ping(w io.Writer) error {
+	return s.WriteFrame(w, FrameTypePing, pingPayload(pingRequest, time.Now().UnixNano()))
+}
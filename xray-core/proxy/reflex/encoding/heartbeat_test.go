@@ -0,0 +1,44 @@
+package encoding
+
+import (
+	"context"
+	"io"
+	"testing"
+	"time"
+)
+
+func TestHeartbeatDetectsDeadPeer(t *testing.T) {
+	s, err := NewSession(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.RunHeartbeat(ctx, io.Discard, 10*time.Millisecond); err != ErrPeerDead {
+		t.Fatalf("unanswered heartbeat ended with %v", err)
+	}
+}
+
+func TestPaceDelayKeepsInteractiveLatency(t *testing.T) {
+	s, err := NewSession(make([]byte, 32))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.paceDelay(500 * time.Millisecond); d != 500*time.Millisecond {
+		t.Fatalf("delay trimmed to %v without an RTT", d)
+	}
+	s.observeRTT(100 * time.Millisecond)
+	if d := s.paceDelay(500 * time.Millisecond); d != interactiveLatency-100*time.Millisecond {
+		t.Fatalf("delay %v at 100ms RTT", d)
+	}
+	if d := s.paceDelay(20 * time.Millisecond); d != 20*time.Millisecond {
+		t.Fatalf("short delay trimmed to %v", d)
+	}
+	s.observeRTT(900 * time.Millisecond)
+	if rtt := s.RTT(); rtt != 200*time.Millisecond {
+		t.Fatalf("smoothed RTT %v", rtt)
+	}
+	if d := s.paceDelay(20 * time.Millisecond); d != 0 {
+		t.Fatalf("delay %v past interactive latency", d)
+	}
+}
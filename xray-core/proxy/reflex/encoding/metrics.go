@@ -0,0 +1,64 @@
+package encoding
+
+import (
+	"sync"
+)
+
+const (
+	// sizeSampleCount is how many recent DATA sizes the live KS distance
+	// is computed over.
+	sizeSampleCount = 256
+	// sizeSampleInterval is how many DATA frames pass between computations.
+	sizeSampleInterval = 64
+)
+
+// sizeSampler keeps the most recent DATA payload sizes a session sent, for
+// the live KS distance from the session's profile.
+type sizeSampler struct {
+	mu      sync.Mutex
+	samples []float64
+	next    int
+	seen    int
+}
+
+// record adds size and reports whether sizeSampleInterval sizes have passed
+// since the last report.
+func (s *sizeSampler) record(size int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if len(s.samples) < sizeSampleCount {
+		s.samples = append(s.samples, float64(size))
+	} else {
+		s.samples[s.next] = float64(size)
+		s.next = (s.next + 1) % sizeSampleCount
+	}
+	s.seen++
+	return s.seen%sizeSampleInterval == 0
+}
+
+func (s *sizeSampler) snapshot() []float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]float64(nil), s.samples...)
+}
+
+// recordDataSize samples a sent DATA payload size and periodically publishes
+// the live KS distance.
+func (s *Session) recordDataSize(size int) {
+	if s.sizes.record(size) && s.observer != nil {
+		if d := s.SizeDistance(); d >= 0 {
+			s.observer.SizeDistance(d)
+		}
+	}
+}
+
+// SizeDistance is the KS distance of the recently sent DATA sizes from the
+// session's profile, or -1 without a profile or samples.
+func (s *Session) SizeDistance() float64 {
+	profile, _ := s.Shaping()
+	samples := s.sizes.snapshot()
+	if profile == nil || len(samples) == 0 {
+		return -1
+	}
+	return KolmogorovSmirnovStatistic(samples, profile.SizeSamples(1000))
+}
@@ -0,0 +1,39 @@
+package encoding
+
+import (
+	"testing"
+)
+
+// sizeObserver records the size distances a session reports; the session
+// calls nothing else while only DATA sizes are recorded.
+type sizeObserver struct {
+	Observer
+	distances []float64
+}
+
+func (o *sizeObserver) SizeDistance(d float64) {
+	o.distances = append(o.distances, d)
+}
+
+func TestSessionReportsSizeDistance(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := &sizeObserver{}
+	s.SetObserver(o)
+	s.SetTrafficProfile(&TrafficProfile{Name: "test", PacketSizes: []PacketSizeDist{{Size: 100, Weight: 1}}})
+
+	for i := 0; i < sizeSampleInterval; i++ {
+		s.recordDataSize(100)
+	}
+	if len(o.distances) != 1 || o.distances[0] != 0 {
+		t.Fatalf("matching sizes scored %v", o.distances)
+	}
+	for i := 0; i < sizeSampleCount; i++ {
+		s.recordDataSize(1000)
+	}
+	if d := o.distances[len(o.distances)-1]; d != 1 {
+		t.Fatalf("disjoint sizes scored %v, want 1", d)
+	}
+}
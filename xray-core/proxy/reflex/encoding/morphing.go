@@ -0,0 +1,786 @@
+package encoding
+
+import (
+	"context"
+	cryptorand "crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math/rand"
+	"sort"
+	"sync"
+	"time"
+)
+
+// minCoverInterval bounds how often idle cover frames may be emitted.
+const minCoverInterval = 5 * time.Millisecond
+
+// PacketSizeDist is a weighted packet-size bucket.
+type PacketSizeDist struct {
+	Size   int
+	Weight float64
+}
+
+// DelayDist is a weighted inter-frame delay bucket.
+type DelayDist struct {
+	Delay  time.Duration
+	Weight float64
+}
+
+// BurstDist is a weighted burst-length bucket, in packets.
+type BurstDist struct {
+	Packets int
+	Weight  float64
+}
+
+// PacingMode selects which side of a session realizes profile delays.
+type PacingMode int
+
+const (
+	// PacingSender sleeps in the writer after announcing each delay.
+	PacingSender PacingMode = iota
+	// PacingReceiver only announces delays; the peer holds back data it
+	// reads until the announced release time, so the sender never blocks.
+	PacingReceiver
+	// PacingNone skips delays entirely, for latency-sensitive policies.
+	PacingNone
+)
+
+// timingFlagAbsorb asks the receiver of a TIMING frame to absorb the delay.
+const timingFlagAbsorb = 0x01
+
+// MorphModel selects how successive packet sizes and delays are sampled.
+type MorphModel int
+
+const (
+	// ModelIndependent draws every size and delay from the weighted buckets.
+	ModelIndependent MorphModel = iota
+	// ModelMarkov draws the next bucket from the transition-matrix row of the
+	// previous one, reproducing the autocorrelation of the observed traffic.
+	ModelMarkov
+	// ModelTrace replays Trace packet by packet, starting over at its end,
+	// so a session reproduces a captured reference flow exactly rather than
+	// its distributions. Cover frames while idle continue the trace.
+	ModelTrace
+)
+
+// TracePacket is one packet of a recorded flow: its size and the delay
+// before the next one.
+type TracePacket struct {
+	Size  int
+	Delay time.Duration
+}
+
+// burstGapThreshold splits observed traffic into bursts: any inter-arrival
+// delay at least this long is treated as an idle gap between bursts.
+const burstGapThreshold = 100 * time.Millisecond
+
+// TrafficProfile defines packet-size and timing distributions.
+//
+// When BurstLengths is set the profile alternates between ON periods of a
+// drawn number of packets spaced by Delays and OFF periods drawn from
+// BurstGaps, instead of spacing every packet independently. OFF periods are
+// only taken while the sender is idle: with data still waiting, a burst that
+// is used up runs straight into the next one.
+//
+// With ModelMarkov, SizeTransitions[i][j] weighs PacketSizes[j] following
+// PacketSizes[i], and DelayTransitions does the same for Delays. A missing
+// matrix leaves that dimension independent.
+//
+// TargetBitrate, in bits per second, makes the shaper pace data to that
+// average instead of spacing packets by Delays alone; see IntervalAfter.
+//
+// With ModelTrace, PacketSizes and Delays only describe Trace, for padding
+// to the largest size and for the live distance from the profile.
+type TrafficProfile struct {
+	Name             string
+	PacketSizes      []PacketSizeDist
+	Delays           []DelayDist
+	BurstLengths     []BurstDist
+	BurstGaps        []DelayDist
+	Pacing           PacingMode
+	Model            MorphModel
+	SizeTransitions  [][]float64
+	DelayTransitions [][]float64
+	TargetBitrate    uint64
+	RampUp           time.Duration
+	Trace            []TracePacket
+
+	nextPacketSize int
+	nextDelay      time.Duration
+	burstLeft      int
+	bursting       bool
+	lastSize       int
+	lastDelay      int
+	rampStart      time.Time
+	pacedUntil     time.Time
+	gapDebt        time.Duration
+	// traceNext is the index in Trace of the packet being sent.
+	traceNext int
+	mu        sync.Mutex
+}
+
+// Profiles contains built-in traffic profiles.
+var Profiles = map[string]*TrafficProfile{
+	"youtube": {
+		Name: "youtube",
+		PacketSizes: []PacketSizeDist{
+			{Size: 1400, Weight: 0.35},
+			{Size: 1200, Weight: 0.25},
+			{Size: 1000, Weight: 0.2},
+			{Size: 800, Weight: 0.1},
+			{Size: 600, Weight: 0.1},
+		},
+		Delays: []DelayDist{
+			{Delay: 8 * time.Millisecond, Weight: 0.30},
+			{Delay: 12 * time.Millisecond, Weight: 0.25},
+			{Delay: 16 * time.Millisecond, Weight: 0.20},
+			{Delay: 20 * time.Millisecond, Weight: 0.15},
+			{Delay: 30 * time.Millisecond, Weight: 0.10},
+		},
+		BurstLengths: []BurstDist{
+			{Packets: 20, Weight: 0.30},
+			{Packets: 40, Weight: 0.40},
+			{Packets: 80, Weight: 0.30},
+		},
+		BurstGaps: []DelayDist{
+			{Delay: 500 * time.Millisecond, Weight: 0.40},
+			{Delay: 1000 * time.Millisecond, Weight: 0.40},
+			{Delay: 2000 * time.Millisecond, Weight: 0.20},
+		},
+		TargetBitrate: 4_000_000,
+	},
+	"zoom": {
+		Name: "zoom",
+		PacketSizes: []PacketSizeDist{
+			{Size: 500, Weight: 0.30},
+			{Size: 600, Weight: 0.40},
+			{Size: 700, Weight: 0.30},
+		},
+		Delays: []DelayDist{
+			{Delay: 30 * time.Millisecond, Weight: 0.40},
+			{Delay: 40 * time.Millisecond, Weight: 0.40},
+			{Delay: 50 * time.Millisecond, Weight: 0.20},
+		},
+	},
+	"http2-api": {
+		Name: "http2-api",
+		PacketSizes: []PacketSizeDist{
+			{Size: 200, Weight: 0.20},
+			{Size: 500, Weight: 0.30},
+			{Size: 1000, Weight: 0.30},
+			{Size: 1400, Weight: 0.20},
+		},
+		Delays: []DelayDist{
+			{Delay: 5 * time.Millisecond, Weight: 0.30},
+			{Delay: 10 * time.Millisecond, Weight: 0.40},
+			{Delay: 15 * time.Millisecond, Weight: 0.30},
+		},
+	},
+	"mimic-http2-api": {
+		Name: "mimic-http2-api",
+		PacketSizes: []PacketSizeDist{
+			{Size: 200, Weight: 0.20},
+			{Size: 500, Weight: 0.30},
+			{Size: 1000, Weight: 0.30},
+			{Size: 1400, Weight: 0.20},
+		},
+		Delays: []DelayDist{
+			{Delay: 5 * time.Millisecond, Weight: 0.30},
+			{Delay: 10 * time.Millisecond, Weight: 0.40},
+			{Delay: 15 * time.Millisecond, Weight: 0.30},
+		},
+	},
+}
+
+func cloneProfile(p *TrafficProfile) *TrafficProfile {
+	cp := &TrafficProfile{Name: p.Name, Pacing: p.Pacing, Model: p.Model, TargetBitrate: p.TargetBitrate, RampUp: p.RampUp}
+	cp.PacketSizes = append(cp.PacketSizes, p.PacketSizes...)
+	cp.Delays = append(cp.Delays, p.Delays...)
+	cp.BurstLengths = append(cp.BurstLengths, p.BurstLengths...)
+	cp.BurstGaps = append(cp.BurstGaps, p.BurstGaps...)
+	cp.SizeTransitions = append(cp.SizeTransitions, p.SizeTransitions...)
+	cp.DelayTransitions = append(cp.DelayTransitions, p.DelayTransitions...)
+	cp.Trace = append(cp.Trace, p.Trace...)
+	return cp
+}
+
+// profileFromPolicy returns a copy of the built-in profile named policy, or
+// of http2-api. Clients have no profile directory, so they shape by these.
+func profileFromPolicy(policy string) *TrafficProfile {
+	return (*ProfileSet)(nil).Profile(policy)
+}
+
+func weightedPickSize(values []PacketSizeDist) int {
+	if len(values) == 0 {
+		return 0
+	}
+	pick := rand.Float64()
+	sum := 0.0
+	for _, d := range values {
+		sum += d.Weight
+		if pick <= sum {
+			return d.Size
+		}
+	}
+	return values[len(values)-1].Size
+}
+
+func weightedPickDelay(values []DelayDist) time.Duration {
+	if len(values) == 0 {
+		return 0
+	}
+	pick := rand.Float64()
+	sum := 0.0
+	for _, d := range values {
+		sum += d.Weight
+		if pick <= sum {
+			return d.Delay
+		}
+	}
+	return values[len(values)-1].Delay
+}
+
+func weightedPickBurst(values []BurstDist) int {
+	if len(values) == 0 {
+		return 0
+	}
+	pick := rand.Float64()
+	sum := 0.0
+	for _, d := range values {
+		sum += d.Weight
+		if pick <= sum {
+			return d.Packets
+		}
+	}
+	return values[len(values)-1].Packets
+}
+
+// weightedIndex picks an index in proportion to weights, or returns -1 if
+// they carry no mass.
+func weightedIndex(weights []float64) int {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return -1
+	}
+	pick := rand.Float64() * total
+	for i, w := range weights {
+		pick -= w
+		if pick < 0 {
+			return i
+		}
+	}
+	return len(weights) - 1
+}
+
+// markovStep returns the bucket following prev in matrix, falling back to the
+// stationary weights at the start of a chain or on an empty row.
+func markovStep(matrix [][]float64, prev int, stationary func() []float64) int {
+	if prev > 0 && prev <= len(matrix) {
+		if next := weightedIndex(matrix[prev-1]); next >= 0 {
+			return next
+		}
+	}
+	return weightedIndex(stationary())
+}
+
+// sampleSizeLocked draws the next packet size according to the profile model.
+func (p *TrafficProfile) sampleSizeLocked() int {
+	if p.Model == ModelTrace && len(p.Trace) > 0 {
+		return p.Trace[p.traceNext].Size
+	}
+	if p.Model != ModelMarkov || len(p.SizeTransitions) == 0 || len(p.PacketSizes) == 0 {
+		return weightedPickSize(p.PacketSizes)
+	}
+	i := markovStep(p.SizeTransitions, p.lastSize, func() []float64 {
+		w := make([]float64, len(p.PacketSizes))
+		for j, d := range p.PacketSizes {
+			w[j] = d.Weight
+		}
+		return w
+	})
+	if i < 0 || i >= len(p.PacketSizes) {
+		return weightedPickSize(p.PacketSizes)
+	}
+	// Bucket indices are stored 1-based so the zero value means "no history".
+	p.lastSize = i + 1
+	return p.PacketSizes[i].Size
+}
+
+// sampleDelayLocked draws the next inter-packet delay according to the
+// profile model. A trace moves on to its next packet.
+func (p *TrafficProfile) sampleDelayLocked() time.Duration {
+	if p.Model == ModelTrace && len(p.Trace) > 0 {
+		d := p.Trace[p.traceNext].Delay
+		p.traceNext = (p.traceNext + 1) % len(p.Trace)
+		return d
+	}
+	if p.Model != ModelMarkov || len(p.DelayTransitions) == 0 || len(p.Delays) == 0 {
+		return weightedPickDelay(p.Delays)
+	}
+	i := markovStep(p.DelayTransitions, p.lastDelay, func() []float64 {
+		w := make([]float64, len(p.Delays))
+		for j, d := range p.Delays {
+			w[j] = d.Weight
+		}
+		return w
+	})
+	if i < 0 || i >= len(p.Delays) {
+		return weightedPickDelay(p.Delays)
+	}
+	p.lastDelay = i + 1
+	return p.Delays[i].Delay
+}
+
+// GetPacketSize returns next packet size using override or the profile model.
+func (p *TrafficProfile) GetPacketSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nextPacketSize > 0 {
+		size := p.nextPacketSize
+		p.nextPacketSize = 0
+		return size
+	}
+	return p.sampleSizeLocked()
+}
+
+// GetDelay returns next delay using override or the profile model.
+func (p *TrafficProfile) GetDelay() time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.nextDelay > 0 {
+		d := p.nextDelay
+		p.nextDelay = 0
+		return d
+	}
+	return p.sampleDelayLocked()
+}
+
+// maxPacketSize returns the largest size in the profile's distribution.
+func (p *TrafficProfile) maxPacketSize() int {
+	size := 0
+	for _, d := range p.PacketSizes {
+		if d.Size > size {
+			size = d.Size
+		}
+	}
+	return size
+}
+
+// sampleSize draws a packet size without consuming a SetNextPacketSize
+// override, for cover frames that aren't carrying data.
+func (p *TrafficProfile) sampleSize() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sampleSizeLocked()
+}
+
+// NextInterval returns the delay to wait after the current packet. Inside a
+// burst this is an ordinary Delays sample; when the burst is used up it is an
+// idle gap from BurstGaps and a new burst length is drawn. A SetNextDelay
+// override still wins, but the packet counts towards the burst either way.
+func (p *TrafficProfile) NextInterval() time.Duration {
+	return p.nextInterval(false)
+}
+
+// nextInterval is NextInterval for a sender that has more data waiting when
+// busy, which ends a used-up burst without its idle gap.
+func (p *TrafficProfile) nextInterval(busy bool) time.Duration {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	gap := p.advanceBurstLocked(busy)
+	if p.nextDelay > 0 {
+		d := p.nextDelay
+		p.nextDelay = 0
+		return d
+	}
+	if gap > 0 {
+		return gap
+	}
+	return p.sampleDelayLocked()
+}
+
+// advanceBurstLocked accounts for one sent packet and returns the idle gap to
+// insert after it, or 0 while the current burst continues or busy says data
+// is waiting to be sent.
+func (p *TrafficProfile) advanceBurstLocked(busy bool) time.Duration {
+	if len(p.BurstLengths) == 0 {
+		return 0
+	}
+	if !p.bursting {
+		p.bursting = true
+		p.burstLeft = weightedPickBurst(p.BurstLengths)
+	}
+	p.burstLeft--
+	if p.burstLeft > 0 {
+		return 0
+	}
+	p.bursting = false
+	if busy {
+		return 0
+	}
+	return weightedPickDelay(p.BurstGaps)
+}
+
+// SetNextPacketSize overrides the next packet size.
+func (p *TrafficProfile) SetNextPacketSize(size int) {
+	if size <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.nextPacketSize = size
+	p.mu.Unlock()
+}
+
+// SetNextDelay overrides the next delay.
+func (p *TrafficProfile) SetNextDelay(delay time.Duration) {
+	if delay <= 0 {
+		return
+	}
+	p.mu.Lock()
+	p.nextDelay = delay
+	p.mu.Unlock()
+}
+
+// SendPaddingControl sends a PADDING_CTRL frame with target size.
+func (s *Session) SendPaddingControl(writer io.Writer, targetSize int) error {
+	return s.SendPadding(writer, targetSize, 0)
+}
+
+// SendPadding sends a PADDING frame carrying the target size hint followed by
+// fill random cover bytes. The receiver only interprets the size hint.
+func (s *Session) SendPadding(writer io.Writer, targetSize, fill int) error {
+	payload, err := s.paddingPayload(targetSize, fill)
+	if err != nil {
+		return err
+	}
+	return s.WriteFrame(writer, FrameTypePadding, payload)
+}
+
+// paddingPayload builds the body of a PADDING frame for SendPadding.
+func (s *Session) paddingPayload(targetSize, fill int) ([]byte, error) {
+	if targetSize <= 0 || targetSize > 65535 {
+		return nil, errors.New("invalid target size")
+	}
+	if fill < 0 {
+		return nil, errors.New("invalid padding length")
+	}
+	if maxFill := maxFramePayloadSize - s.sealedSize(2); fill > maxFill {
+		fill = maxFill
+	}
+	payload := make([]byte, 2+fill)
+	binary.BigEndian.PutUint16(payload, uint16(targetSize))
+	if fill > 0 {
+		if _, err := cryptorand.Read(payload[2:]); err != nil {
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// SendTimingControl sends a TIMING_CTRL frame with delay in milliseconds.
+func (s *Session) SendTimingControl(writer io.Writer, delay time.Duration) error {
+	return s.sendTimingFrame(writer, delay, 0)
+}
+
+// sendTimingFrame sends a TIMING frame; a non-zero flags byte is appended
+// after the 8-byte delay so plain control frames keep their original layout.
+func (s *Session) sendTimingFrame(writer io.Writer, delay time.Duration, flags byte) error {
+	if delay <= 0 {
+		return errors.New("invalid delay")
+	}
+	return s.WriteFrame(writer, FrameTypeTiming, timingPayload(delay, flags))
+}
+
+func timingPayload(delay time.Duration, flags byte) []byte {
+	payload := make([]byte, 8, 9)
+	binary.BigEndian.PutUint64(payload, uint64(delay.Milliseconds()))
+	if flags != 0 {
+		payload = append(payload, flags)
+	}
+	return payload
+}
+
+// AwaitRelease blocks until data held back by an absorbing TIMING frame may
+// be released, or ctx is done.
+func (s *Session) AwaitRelease(ctx context.Context) {
+	wait := time.Until(time.Unix(0, s.releaseAt.Load()))
+	if wait <= 0 {
+		return
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+	case <-timer.C:
+	}
+}
+
+// HandleControlFrame applies control-frame overrides to current profile.
+func (s *Session) HandleControlFrame(frame *Frame) error {
+	if frame.Type == FrameTypeTiming && len(frame.Payload) == 9 && frame.Payload[8]&timingFlagAbsorb != 0 {
+		ms := binary.BigEndian.Uint64(frame.Payload[:8])
+		s.releaseAt.Store(time.Now().Add(time.Duration(ms) * time.Millisecond).UnixNano())
+		return nil
+	}
+	profile, _ := s.Shaping()
+	if profile == nil {
+		return nil
+	}
+	switch frame.Type {
+	case FrameTypePadding:
+		// Anything after the 2-byte size hint is cover bytes and is discarded.
+		if len(frame.Payload) < 2 {
+			return errors.New("invalid padding control payload")
+		}
+		profile.SetNextPacketSize(int(binary.BigEndian.Uint16(frame.Payload[:2])))
+	case FrameTypeTiming:
+		if len(frame.Payload) != 8 {
+			return errors.New("invalid timing control payload")
+		}
+		ms := binary.BigEndian.Uint64(frame.Payload)
+		profile.SetNextDelay(time.Duration(ms) * time.Millisecond)
+	}
+	return nil
+}
+
+// RunCoverTraffic emits padding frames whenever the session has been silent
+// for longer than a delay drawn from the profile, until ctx is done or a
+// write fails.
+func (s *Session) RunCoverTraffic(ctx context.Context, writer io.Writer) error {
+	for {
+		// Re-read the profile each round so policy updates take effect.
+		profile, _ := s.Shaping()
+		if profile == nil {
+			return nil
+		}
+		delay := profile.NextInterval()
+		if delay < minCoverInterval {
+			delay = minCoverInterval
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return ctx.Err()
+		case <-timer.C:
+		}
+		if time.Since(time.Unix(0, s.lastWrite.Load())) < delay {
+			continue
+		}
+		size := profile.sampleSize()
+		if size <= 0 {
+			continue
+		}
+		if err := s.SendPadding(writer, size, size); err != nil {
+			return err
+		}
+	}
+}
+
+// runKeepalive sends an empty PADDING frame whenever the session has been
+// silent for interval, until ctx is done or a write fails. The zero size hint
+// leaves the peer's shaping untouched.
+func (s *Session) runKeepalive(ctx context.Context, writer io.Writer, interval time.Duration) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		if time.Since(time.Unix(0, s.lastWrite.Load())) < interval {
+			continue
+		}
+		if err := s.WriteFrame(writer, FrameTypePadding, []byte{0, 0}); err != nil {
+			return err
+		}
+	}
+}
+
+// CreateProfileFromObservations builds a profile from captured sizes and delays.
+// If the delays show at least two idle gaps of burstGapThreshold or more, the
+// capture is modelled as bursts: the gaps feed BurstGaps, the packet counts
+// between them feed BurstLengths and only the remaining delays feed Delays.
+func CreateProfileFromObservations(name string, packetSizes []int, delays []time.Duration) (*TrafficProfile, error) {
+	if len(packetSizes) == 0 || len(delays) == 0 {
+		return nil, errors.New("insufficient samples")
+	}
+	p := &TrafficProfile{
+		Name:        name,
+		PacketSizes: calculateSizeDistribution(packetSizes),
+		Delays:      calculateDelayDistribution(delays),
+	}
+	intra, lengths, gaps := splitBursts(delays, burstGapThreshold)
+	if len(gaps) >= 2 && len(intra) > 0 {
+		p.Delays = calculateDelayDistribution(intra)
+		p.BurstLengths = calculateBurstDistribution(lengths)
+		p.BurstGaps = calculateDelayDistribution(gaps)
+	}
+	return p, nil
+}
+
+// splitBursts separates inter-arrival delays into intra-burst delays, burst
+// lengths in packets and the idle gaps between bursts.
+func splitBursts(delays []time.Duration, threshold time.Duration) (intra []time.Duration, lengths []int, gaps []time.Duration) {
+	packets := 1
+	for _, d := range delays {
+		if d >= threshold {
+			lengths = append(lengths, packets)
+			gaps = append(gaps, d)
+			packets = 1
+			continue
+		}
+		intra = append(intra, d)
+		packets++
+	}
+	lengths = append(lengths, packets)
+	return intra, lengths, gaps
+}
+
+// CreateMarkovProfileFromObservations builds a ModelMarkov profile whose
+// transition matrices count which size and delay bucket followed which in the
+// observed sequences.
+func CreateMarkovProfileFromObservations(name string, packetSizes []int, delays []time.Duration) (*TrafficProfile, error) {
+	p, err := CreateProfileFromObservations(name, packetSizes, delays)
+	if err != nil {
+		return nil, err
+	}
+	p.Model = ModelMarkov
+
+	sizeIndex := make(map[int]int, len(p.PacketSizes))
+	for i, d := range p.PacketSizes {
+		sizeIndex[d.Size] = i
+	}
+	var sizeStates []int
+	for _, v := range packetSizes {
+		if i, ok := sizeIndex[v]; ok {
+			sizeStates = append(sizeStates, i)
+		}
+	}
+	p.SizeTransitions = transitionMatrix(sizeStates, len(p.PacketSizes))
+
+	delayIndex := make(map[time.Duration]int, len(p.Delays))
+	for i, d := range p.Delays {
+		delayIndex[d.Delay] = i
+	}
+	// Delays on either side of a burst gap aren't adjacent on the wire, so
+	// the chain restarts there.
+	var delayStates []int
+	for _, v := range delays {
+		if i, ok := delayIndex[v]; ok {
+			delayStates = append(delayStates, i)
+		} else {
+			delayStates = append(delayStates, -1)
+		}
+	}
+	p.DelayTransitions = transitionMatrix(delayStates, len(p.Delays))
+	return p, nil
+}
+
+// CreateTraceProfileFromObservations builds a ModelTrace profile replaying
+// the observed sizes, each followed by its observed delay.
+func CreateTraceProfileFromObservations(name string, packetSizes []int, delays []time.Duration) (*TrafficProfile, error) {
+	if len(packetSizes) == 0 {
+		return nil, errors.New("insufficient samples")
+	}
+	p := &TrafficProfile{Name: name, Model: ModelTrace, Trace: make([]TracePacket, len(packetSizes))}
+	for i, size := range packetSizes {
+		p.Trace[i].Size = size
+		if i < len(delays) {
+			p.Trace[i].Delay = delays[i]
+		}
+	}
+	p.describeTrace()
+	return p, nil
+}
+
+// describeTrace sets PacketSizes and Delays to the distributions of Trace.
+func (p *TrafficProfile) describeTrace() {
+	sizes := make([]int, len(p.Trace))
+	delays := make([]time.Duration, len(p.Trace))
+	for i, t := range p.Trace {
+		sizes[i], delays[i] = t.Size, t.Delay
+	}
+	p.PacketSizes = calculateSizeDistribution(sizes)
+	p.Delays = calculateDelayDistribution(delays)
+}
+
+// transitionMatrix counts state-to-state transitions in seq and normalizes
+// every row. Negative states break the chain.
+func transitionMatrix(seq []int, n int) [][]float64 {
+	matrix := make([][]float64, n)
+	for i := range matrix {
+		matrix[i] = make([]float64, n)
+	}
+	for i := 1; i < len(seq); i++ {
+		if seq[i-1] < 0 || seq[i] < 0 {
+			continue
+		}
+		matrix[seq[i-1]][seq[i]]++
+	}
+	for _, row := range matrix {
+		total := 0.0
+		for _, c := range row {
+			total += c
+		}
+		if total == 0 {
+			continue
+		}
+		for j := range row {
+			row[j] /= total
+		}
+	}
+	return matrix
+}
+
+func calculateBurstDistribution(values []int) []BurstDist {
+	sizes := calculateSizeDistribution(values)
+	dist := make([]BurstDist, len(sizes))
+	for i, d := range sizes {
+		dist[i] = BurstDist{Packets: d.Size, Weight: d.Weight}
+	}
+	return dist
+}
+
+func calculateSizeDistribution(values []int) []PacketSizeDist {
+	freq := map[int]int{}
+	for _, v := range values {
+		if v > 0 {
+			freq[v]++
+		}
+	}
+	total := 0
+	for _, c := range freq {
+		total += c
+	}
+	dist := make([]PacketSizeDist, 0, len(freq))
+	for size, count := range freq {
+		dist = append(dist, PacketSizeDist{Size: size, Weight: float64(count) / float64(total)})
+	}
+	sort.Slice(dist, func(i, j int) bool { return dist[i].Size < dist[j].Size })
+	return dist
+}
+
+func calculateDelayDistribution(values []time.Duration) []DelayDist {
+	freq := map[time.Duration]int{}
+	for _, v := range values {
+		if v > 0 {
+			freq[v]++
+		}
+	}
+	total := 0
+	for _, c := range freq {
+		total += c
+	}
+	dist := make([]DelayDist, 0, len(freq))
+	for delay, count := range freq {
+		dist = append(dist, DelayDist{Delay: delay, Weight: float64(count) / float64(total)})
+	}
+	sort.Slice(dist, func(i, j int) bool { return dist[i].Delay < dist[j].Delay })
+	return dist
+}
@@ -0,0 +1,501 @@
+package encoding
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestTrafficProfileOverrides(t *testing.T) {
+	p := profileFromPolicy("http2-api")
+	p.SetNextPacketSize(777)
+	if got := p.GetPacketSize(); got != 777 {
+		t.Fatalf("unexpected override packet size: %d", got)
+	}
+	p.SetNextDelay(42 * time.Millisecond)
+	if got := p.GetDelay(); got != 42*time.Millisecond {
+		t.Fatalf("unexpected override delay: %v", got)
+	}
+}
+
+func TestHandleControlFrame(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.SetTrafficProfile(profileFromPolicy("http2-api"))
+
+	if err := s.HandleControlFrame(&Frame{Type: FrameTypePadding, Payload: []byte{0x03, 0xE8}}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.profile.GetPacketSize(); got != 1000 {
+		t.Fatalf("expected 1000 override, got %d", got)
+	}
+
+	payload := make([]byte, 8)
+	payload[7] = 25
+	if err := s.HandleControlFrame(&Frame{Type: FrameTypeTiming, Payload: payload}); err != nil {
+		t.Fatal(err)
+	}
+	if got := s.profile.GetDelay(); got != 25*time.Millisecond {
+		t.Fatalf("expected 25ms override, got %v", got)
+	}
+}
+
+func TestWriteFrameWithMorphingSendsControlFrames(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	profile := &TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 5, Weight: 1.0}},
+		Delays:      []DelayDist{{Delay: 0, Weight: 1.0}},
+	}
+	writerSession.SetTrafficProfile(profile)
+
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	f1, err := readerSession.ReadFrame(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f1.Type != FrameTypeData {
+		t.Fatalf("first frame type = %d", f1.Type)
+	}
+
+	f2, err := readerSession.ReadFrame(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f2.Type != FrameTypePadding {
+		t.Fatalf("second frame type = %d", f2.Type)
+	}
+	if len(f2.Payload) != 2 {
+		t.Fatalf("unexpected padding ctrl length: %d", len(f2.Payload))
+	}
+}
+
+func TestCreateProfileFromObservations(t *testing.T) {
+	p, err := CreateProfileFromObservations("capture", []int{100, 100, 200}, []time.Duration{10 * time.Millisecond, 20 * time.Millisecond, 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "capture" {
+		t.Fatalf("unexpected profile name: %s", p.Name)
+	}
+	if len(p.PacketSizes) != 2 {
+		t.Fatalf("unexpected packet distribution count: %d", len(p.PacketSizes))
+	}
+	if len(p.Delays) != 2 {
+		t.Fatalf("unexpected delay distribution count: %d", len(p.Delays))
+	}
+}
+
+func TestCreateProfileFromObservationsDetectsBursts(t *testing.T) {
+	ms := time.Millisecond
+	delays := []time.Duration{
+		2 * ms, 2 * ms, 500 * ms, // burst of 3, gap
+		2 * ms, 3 * ms, 2 * ms, 1000 * ms, // burst of 4, gap
+		2 * ms, 2 * ms, // final burst of 3
+	}
+	p, err := CreateProfileFromObservations("bursty", []int{1400}, delays)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.BurstLengths) != 2 || p.BurstLengths[0].Packets != 3 || p.BurstLengths[1].Packets != 4 {
+		t.Fatalf("unexpected burst lengths: %+v", p.BurstLengths)
+	}
+	if len(p.BurstGaps) != 2 || p.BurstGaps[0].Delay != 500*ms {
+		t.Fatalf("unexpected burst gaps: %+v", p.BurstGaps)
+	}
+	for _, d := range p.Delays {
+		if d.Delay >= burstGapThreshold {
+			t.Fatalf("gap leaked into intra-burst delays: %+v", p.Delays)
+		}
+	}
+}
+
+func TestTrafficProfileAlternatesBursts(t *testing.T) {
+	p := &TrafficProfile{
+		Delays:       []DelayDist{{Delay: time.Millisecond, Weight: 1}},
+		BurstLengths: []BurstDist{{Packets: 3, Weight: 1}},
+		BurstGaps:    []DelayDist{{Delay: time.Second, Weight: 1}},
+	}
+	var got []time.Duration
+	for i := 0; i < 7; i++ {
+		got = append(got, p.NextInterval())
+	}
+	want := []time.Duration{time.Millisecond, time.Millisecond, time.Second, time.Millisecond, time.Millisecond, time.Second, time.Millisecond}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("interval %d = %v, want %v (all: %v)", i, got[i], want[i], got)
+		}
+	}
+	// With data waiting, used-up bursts run into the next without a gap.
+	for i := 0; i < 7; i++ {
+		if d := p.nextInterval(true); d != time.Millisecond {
+			t.Fatalf("busy interval %d = %v", i, d)
+		}
+	}
+
+	// Profiles without a burst model keep spacing every packet by Delays.
+	flat := &TrafficProfile{Delays: []DelayDist{{Delay: time.Millisecond, Weight: 1}}}
+	for i := 0; i < 5; i++ {
+		if d := flat.NextInterval(); d != time.Millisecond {
+			t.Fatalf("unexpected flat interval: %v", d)
+		}
+	}
+}
+
+func TestMarkovProfileFollowsTransitions(t *testing.T) {
+	ms := time.Millisecond
+	p, err := CreateMarkovProfileFromObservations("alternating",
+		[]int{100, 1400, 100, 1400, 100, 1400},
+		[]time.Duration{5 * ms, 40 * ms, 5 * ms, 40 * ms, 5 * ms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Model != ModelMarkov || len(p.SizeTransitions) != 2 || p.SizeTransitions[0][1] != 1 || p.SizeTransitions[1][0] != 1 {
+		t.Fatalf("unexpected size transitions: %v", p.SizeTransitions)
+	}
+
+	prev := p.GetPacketSize()
+	prevDelay := p.GetDelay()
+	for i := 0; i < 20; i++ {
+		size := p.GetPacketSize()
+		if size == prev {
+			t.Fatalf("markov sizes should alternate, got %d twice", size)
+		}
+		delay := p.GetDelay()
+		if delay == prevDelay {
+			t.Fatalf("markov delays should alternate, got %v twice", delay)
+		}
+		prev, prevDelay = size, delay
+	}
+
+	// Overrides from control frames still take precedence.
+	p.SetNextPacketSize(777)
+	if got := p.GetPacketSize(); got != 777 {
+		t.Fatalf("override ignored: %d", got)
+	}
+}
+
+func TestTraceProfileReplaysInOrder(t *testing.T) {
+	ms := time.Millisecond
+	p, err := CreateTraceProfileFromObservations("trace", []int{300, 1400, 80}, []time.Duration{2 * ms, 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	want := []TracePacket{{300, 2 * ms}, {1400, 0}, {80, 0}}
+	for round := 0; round < 2; round++ {
+		for i, w := range want {
+			if size, delay := p.GetPacketSize(), p.NextInterval(); size != w.Size || delay != w.Delay {
+				t.Fatalf("round %d packet %d: %d after %v, want %+v", round, i, size, delay, w)
+			}
+		}
+	}
+	if p.maxPacketSize() != 1400 {
+		t.Fatalf("trace described with largest size %d", p.maxPacketSize())
+	}
+}
+
+func TestWriteFrameWithMorphingPadsToTargetSize(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 64, Weight: 1.0}},
+	})
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession.SetTrafficProfile(profileFromPolicy("http2-api"))
+
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := readerSession.ReadFrame(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	padding, err := readerSession.ReadFrame(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if padding.Type != FrameTypePadding {
+		t.Fatalf("second frame type = %d", padding.Type)
+	}
+	if got := len(data.Payload) + len(padding.Payload) - 2; got != 64 {
+		t.Fatalf("data plus cover bytes = %d, want 64", got)
+	}
+	if err := readerSession.HandleControlFrame(padding); err != nil {
+		t.Fatalf("padding with cover bytes should be accepted: %v", err)
+	}
+	if got := readerSession.profile.GetPacketSize(); got != 64 {
+		t.Fatalf("expected size hint 64, got %d", got)
+	}
+}
+
+func TestWriteFrameWithMorphingCoalescing(t *testing.T) {
+	profile := &TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 100, Weight: 1.0}},
+	}
+	data := bytes.Repeat([]byte{'x'}, 1000)
+
+	for _, tc := range []struct{ coalesce, stream bool }{
+		{false, false},
+		{true, false},
+		{false, true},
+		{true, true},
+	} {
+		coalesce := tc.coalesce
+		writerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writerSession.SetTrafficProfile(profile)
+		writerSession.SetCoalescing(coalesce)
+		readerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, s := range []*Session{writerSession, readerSession} {
+			s.SetProtocolVersion(ProtocolVersion5)
+			s.SetStreamMode(tc.stream)
+		}
+
+		var wire countingWriter
+		if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, data); err != nil {
+			t.Fatal(err)
+		}
+		// Ten chunks, each followed by a padding frame.
+		want := 20
+		if coalesce {
+			want = 1
+		}
+		if len(wire.writes) != want {
+			t.Fatalf("%+v: %d writes, want %d", tc, len(wire.writes), want)
+		}
+
+		var got []byte
+		for frames := 0; frames < 20; frames++ {
+			frame, err := readerSession.ReadFrame(&wire)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if frame.Type == FrameTypeData {
+				got = append(got, frame.Payload...)
+			}
+		}
+		if !bytes.Equal(got, data) {
+			t.Fatalf("%+v: data mismatch", tc)
+		}
+	}
+}
+
+func TestFrameBatchSizeMatchesWire(t *testing.T) {
+	for _, stream := range []bool{false, true} {
+		session, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		session.SetProtocolVersion(ProtocolVersion5)
+		session.SetStreamMode(stream)
+
+		var wire bytes.Buffer
+		batch := &frameBatch{session: session, writer: &wire, coalesce: true}
+		for _, n := range []int{0, 1, 100, 1000} {
+			if err := batch.add(OutgoingFrame{Type: FrameTypeData, Payload: make([]byte, n)}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		size := batch.size
+		if err := batch.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if size != wire.Len() {
+			t.Errorf("stream=%v: batch counted %d bytes, wrote %d", stream, size, wire.Len())
+		}
+	}
+}
+
+func TestWriteFrameWithMorphingPaddingLevels(t *testing.T) {
+	profile := &TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 64, Weight: 1.0}, {Size: 256, Weight: 0}},
+	}
+	for _, tc := range []struct {
+		level string
+		total int
+	}{
+		{PaddingNone, 0},
+		{PaddingMax, 256},
+	} {
+		writerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writerSession.SetTrafficProfile(cloneProfile(profile))
+		writerSession.SetPaddingLevel(tc.level)
+		readerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var wire bytes.Buffer
+		if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, []byte("hello")); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := readerSession.ReadFrame(&wire); err != nil {
+			t.Fatal(err)
+		}
+		if tc.level == PaddingNone {
+			if wire.Len() != 0 {
+				t.Fatalf("padding level none still sent %d bytes of padding", wire.Len())
+			}
+			continue
+		}
+		padding, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := len("hello") + len(padding.Payload) - 2; got != tc.total {
+			t.Fatalf("%s: data plus cover bytes = %d, want %d", tc.level, got, tc.total)
+		}
+	}
+}
+
+func TestRunCoverTrafficWhileIdle(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 100, Weight: 1.0}},
+		Delays:      []DelayDist{{Delay: 5 * time.Millisecond, Weight: 1.0}},
+	})
+
+	var wire bytes.Buffer
+	ctx, cancel := context.WithTimeout(context.Background(), 60*time.Millisecond)
+	defer cancel()
+	if err := writerSession.RunCoverTraffic(ctx, &wire); err != context.DeadlineExceeded {
+		t.Fatalf("unexpected cover traffic result: %v", err)
+	}
+
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames := 0
+	for wire.Len() > 0 {
+		f, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type != FrameTypePadding || len(f.Payload) != 102 {
+			t.Fatalf("unexpected cover frame: type=%d len=%d", f.Type, len(f.Payload))
+		}
+		frames++
+	}
+	if frames == 0 {
+		t.Fatal("expected cover frames on an idle session")
+	}
+}
+
+func TestReceiverPacingAbsorbsDelay(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 5, Weight: 1.0}},
+		Delays:      []DelayDist{{Delay: 200 * time.Millisecond, Weight: 1.0}},
+		Pacing:      PacingReceiver,
+	})
+
+	var wire bytes.Buffer
+	start := time.Now()
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed >= 200*time.Millisecond {
+		t.Fatalf("receiver-paced sender should not sleep, took %v", elapsed)
+	}
+
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var timing *Frame
+	for wire.Len() > 0 {
+		f, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type == FrameTypeTiming {
+			timing = f
+		}
+	}
+	if timing == nil || len(timing.Payload) != 9 {
+		t.Fatal("expected absorbing timing frame")
+	}
+	if err := readerSession.HandleControlFrame(timing); err != nil {
+		t.Fatal(err)
+	}
+	start = time.Now()
+	readerSession.AwaitRelease(context.Background())
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond {
+		t.Fatalf("receiver should hold data back, waited %v", elapsed)
+	}
+}
+
+func TestNoPacingSkipsTimingFrames(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 5, Weight: 1.0}},
+		Delays:      []DelayDist{{Delay: time.Second, Weight: 1.0}},
+		Pacing:      PacingNone,
+	})
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrameWithMorphing(&wire, FrameTypeData, []byte("hello")); err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for wire.Len() > 0 {
+		f, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type == FrameTypeTiming {
+			t.Fatal("unpaced profile should not send timing frames")
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package encoding
+
+import (
+	"io"
+	"sync"
+
+	"github.com/xtls/xray-core/common/buf"
+)
+
+// defaultHighWatermark is how many bytes of shaped data a session queues
+// before it stops reading from upstream.
+const defaultHighWatermark = 512 * 1024
+
+// Watermarks bound the data a session queues for the morphing writer. Once
+// High bytes are queued, reading from upstream pauses until the writer has
+// drained the queue to Low, so the upstream pipe fills and pushes back
+// instead of the session buffering. Zero values take the defaults: 512 KiB
+// and half of High.
+type Watermarks struct {
+	High int
+	Low  int
+}
+
+func (w Watermarks) withDefaults() Watermarks {
+	if w.High <= 0 {
+		w.High = defaultHighWatermark
+	}
+	if w.Low <= 0 || w.Low > w.High {
+		w.Low = w.High / 2
+	}
+	return w
+}
+
+// morphPipeline hands outgoing data to a dedicated writer goroutine that
+// applies morphing and pacing, so the upstream reader never sleeps on profile
+// delays. The queue is bounded by Watermarks: Write blocks while it is paused,
+// which is the backpressure signal towards the upstream link.
+type morphPipeline struct {
+	session *Session
+	writer  io.Writer
+	marks   Watermarks
+	done    chan struct{}
+
+	mu     sync.Mutex
+	cond   *sync.Cond
+	queue  []*buf.Buffer
+	queued int
+	paused bool
+	closed bool
+	err    error
+}
+
+func NewMorphPipeline(session *Session, writer io.Writer, marks Watermarks) *morphPipeline {
+	p := &morphPipeline{
+		session: session,
+		writer:  writer,
+		marks:   marks.withDefaults(),
+		done:    make(chan struct{}),
+	}
+	p.cond = sync.NewCond(&p.mu)
+	go p.run()
+	return p
+}
+
+func (p *morphPipeline) run() {
+	defer close(p.done)
+	for {
+		p.mu.Lock()
+		for len(p.queue) == 0 && !p.closed {
+			p.cond.Wait()
+		}
+		if len(p.queue) == 0 {
+			p.mu.Unlock()
+			return
+		}
+		b := p.queue[0]
+		p.queue[0] = nil
+		p.queue = p.queue[1:]
+		p.session.pending.Add(-1)
+		failed := p.err != nil
+		p.mu.Unlock()
+
+		var err error
+		if !failed {
+			err = p.session.WriteFrameWithMorphing(p.writer, FrameTypeData, b.Bytes())
+		}
+
+		p.mu.Lock()
+		p.queued -= int(b.Len())
+		if p.session.observer != nil {
+			p.session.observer.Queued(-int(b.Len()))
+		}
+		if err != nil && p.err == nil {
+			p.err = err
+		}
+		if p.paused && (p.queued <= p.marks.Low || p.err != nil) {
+			p.paused = false
+		}
+		p.cond.Broadcast()
+		p.mu.Unlock()
+		b.Release()
+	}
+}
+
+func (p *morphPipeline) getErr() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.err
+}
+
+// Write queues mb for the writer goroutine, blocking while the queue is
+// paused above the high watermark. It must not be called concurrently with
+// Close.
+func (p *morphPipeline) Write(mb buf.MultiBuffer) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, b := range mb {
+		for p.paused && p.err == nil {
+			p.cond.Wait()
+		}
+		if p.err != nil {
+			buf.ReleaseMulti(mb[i:])
+			return p.err
+		}
+		p.queue = append(p.queue, b)
+		p.session.pending.Add(1)
+		p.queued += int(b.Len())
+		if p.session.observer != nil {
+			p.session.observer.Queued(int(b.Len()))
+		}
+		if p.queued >= p.marks.High {
+			p.paused = true
+		}
+		p.cond.Broadcast()
+	}
+	return nil
+}
+
+// Depth returns the number of buffers waiting to be written.
+func (p *morphPipeline) Depth() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.queue)
+}
+
+// Close flushes queued data and returns the first write error, if any.
+func (p *morphPipeline) Close() error {
+	p.mu.Lock()
+	p.closed = true
+	p.cond.Broadcast()
+	p.mu.Unlock()
+	<-p.done
+	return p.getErr()
+}
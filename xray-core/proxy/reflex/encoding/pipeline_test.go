@@ -0,0 +1,141 @@
+package encoding
+
+import (
+	"bytes"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+)
+
+func TestMorphPipelineDoesNotBlockOnDelays(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetTrafficProfile(&TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 1400, Weight: 1.0}},
+		Delays:      []DelayDist{{Delay: 40 * time.Millisecond, Weight: 1.0}},
+	})
+
+	var wire bytes.Buffer
+	p := NewMorphPipeline(writerSession, &wire, Watermarks{})
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := p.Write(buf.MultiBuffer{buf.FromBytes([]byte("chunk"))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed >= 40*time.Millisecond {
+		t.Fatalf("queued writes should not wait for pacing, took %v", elapsed)
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if p.Depth() != 0 {
+		t.Fatal("close should flush the queue")
+	}
+
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	data := 0
+	for wire.Len() > 0 {
+		f, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if f.Type == FrameTypeData {
+			data++
+		}
+	}
+	if data != 3 {
+		t.Fatalf("expected 3 data frames, got %d", data)
+	}
+}
+
+func TestMorphPipelineBulkThroughputUnderYoutube(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Skip the ramp so only the 4 Mbit/s target paces the transfer.
+	profile := cloneProfile(Profiles["youtube"])
+	profile.RampUp = time.Millisecond
+	writerSession.SetTrafficProfile(profile)
+
+	// 256 KiB take about half a second at the target and outlast two of the
+	// longest youtube bursts, so a writer that took burst gaps on queued
+	// data would pace for at least another second.
+	p := NewMorphPipeline(writerSession, io.Discard, Watermarks{})
+	for i := 0; i < 16; i++ {
+		if err := p.Write(buf.MultiBuffer{buf.FromBytes(make([]byte, 16*1024))}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Duration(writerSession.counters.delay.Load()); d >= time.Second {
+		t.Fatalf("256 KiB paced for %v under the youtube profile", d)
+	}
+}
+
+func TestMorphPipelineReportsWriteError(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := net.Pipe()
+	c2.Close()
+	p := NewMorphPipeline(writerSession, c1, Watermarks{High: 1})
+	_ = p.Write(buf.MultiBuffer{buf.FromBytes([]byte("x"))})
+	if err := p.Close(); err == nil {
+		t.Fatal("expected write error to surface on close")
+	}
+	if err := p.Write(buf.MultiBuffer{buf.FromBytes([]byte("y"))}); err == nil {
+		t.Fatal("expected write after failure to return the error")
+	}
+}
+
+func TestMorphPipelinePausesAtHighWatermark(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := net.Pipe()
+	defer c1.Close()
+	defer c2.Close()
+	p := NewMorphPipeline(writerSession, c1, Watermarks{High: 300, Low: 100})
+	chunk := bytes.Repeat([]byte("x"), 100)
+	for i := 0; i < 3; i++ {
+		if err := p.Write(buf.MultiBuffer{buf.FromBytes(chunk)}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	resumed := make(chan error, 1)
+	go func() { resumed <- p.Write(buf.MultiBuffer{buf.FromBytes(chunk)}) }()
+	select {
+	case <-resumed:
+		t.Fatal("write above the high watermark did not pause")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	go io.Copy(io.Discard, c2)
+	select {
+	case err := <-resumed:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("write did not resume once the queue drained")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,236 @@
+package encoding
+
+import (
+	"crypto/ed25519"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/json"
+	"io"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// PolicyVersion is the negotiation format carried in PolicyReq/PolicyGrant.
+const PolicyVersion = 1
+
+const (
+	// maxPolicyGrantSize bounds a grant reassembled from several frames.
+	maxPolicyGrantSize = 256 * 1024
+	// policyChunkSize is the most of a grant one frame carries.
+	policyChunkSize = 16 * 1024
+)
+
+// Features a client may propose. A feature is only granted when the server
+// supports it for this inbound.
+const (
+	// FeatureMux lets a session carry Xray's mux, which the inbound's
+	// dispatcher demultiplexes.
+	FeatureMux   = "mux"
+	FeatureUDP   = "udp"
+	FeatureCover = "cover"
+	// FeatureKeepalive lets an idle client ping with empty PADDING frames.
+	FeatureKeepalive = "keepalive"
+	// FeatureCompress zstd-compresses DATA payloads before encryption.
+	// Savings only reach the wire when the padding level leaves room.
+	FeatureCompress = "compress"
+	// FeatureFlow bounds DATA in flight per session with receive windows
+	// and WINDOW_UPDATE frames, so a slow reader stalls its sender instead
+	// of buffering. Xray mux sub-connections share their session's window.
+	FeatureFlow = "flow"
+	// FeatureHeartbeat has both sides exchange PING frames to measure the
+	// RTT and to drop a session whose peer stopped answering. Morphing
+	// then keeps its delays within interactive latency.
+	FeatureHeartbeat = "heartbeat"
+	// FeatureStream seals frame types inside the ciphertext and masks the
+	// lengths, leaving no cleartext record structure; see
+	// Session.SetStreamMode.
+	FeatureStream = "stream"
+)
+
+// KnownFeature reports whether name is a feature this version implements.
+func KnownFeature(name string) bool {
+	switch name {
+	case FeatureMux, FeatureUDP, FeatureCover, FeatureKeepalive, FeatureCompress, FeatureFlow, FeatureHeartbeat, FeatureStream:
+		return true
+	}
+	return false
+}
+
+// Padding levels. PaddingProfile fills every chunk up to the size drawn from
+// the profile, PaddingMax up to the profile's largest size, and PaddingNone
+// sends data frames unpadded.
+const (
+	PaddingNone    = "none"
+	PaddingProfile = "profile"
+	PaddingMax     = "max"
+)
+
+// PolicyRequest is the client's proposal carried in PolicyReq as JSON.
+type PolicyRequest struct {
+	Version  int      `json:"v"`
+	Uplink   string   `json:"uplink,omitempty"`
+	Downlink string   `json:"downlink,omitempty"`
+	Features []string `json:"features,omitempty"`
+	Padding  string   `json:"padding,omitempty"`
+}
+
+// PolicyGrant is what the server allows for one session. Both sides
+// configure their session from it: Downlink shapes server-to-client frames,
+// Uplink is for the client's own writes.
+type PolicyGrant struct {
+	Version   int      `json:"v"`
+	Uplink    string   `json:"uplink"`
+	Downlink  string   `json:"downlink"`
+	Features  []string `json:"features,omitempty"`
+	Padding   string   `json:"padding"`
+	Signature []byte   `json:"-"`
+	// Ext holds extensions, a GrantExt. The profile definitions it embeds
+	// are what can make a grant outgrow the handshake.
+	Ext json.RawMessage `json:"ext,omitempty"`
+	// More marks a handshake grant cut short to fit, with Ext left out. The
+	// full grant follows as the session's first policy update.
+	More bool `json:"more,omitempty"`
+	// ServerSignature signs the grant with the server's identity key,
+	// bound to the session; see verifyIdentity.
+	ServerSignature []byte `json:"-"`
+
+	// body is the JSON the signatures cover, as received.
+	body []byte
+}
+
+// GrantExt is the content of a grant's Ext.
+type GrantExt struct {
+	// Profiles defines granted profiles the client doesn't know by name,
+	// those loaded from the server's profile directory, in the format read
+	// by ParseProfileJSON.
+	Profiles []json.RawMessage `json:"profiles,omitempty"`
+}
+
+// profile returns a copy of the named profile for the client to shape by:
+// the definition embedded in Ext, or else the built-in one. A profile that
+// is neither fails, as shaping by another would not be what was granted.
+func (g *PolicyGrant) profile(name string) (*TrafficProfile, error) {
+	if len(g.Ext) > 0 {
+		var ext GrantExt
+		if err := json.Unmarshal(g.Ext, &ext); err != nil {
+			return nil, errors.New("malformed reflex policy grant extensions").Base(err)
+		}
+		for _, def := range ext.Profiles {
+			p, err := ParseProfileJSON(def)
+			if err != nil {
+				return nil, errors.New("invalid profile in reflex policy grant").Base(err)
+			}
+			if p.Name == name {
+				return p, nil
+			}
+		}
+	}
+	if _, ok := Profiles[name]; !ok && name != "" {
+		return nil, errors.New("reflex server granted profile ", name, " without its definition")
+	}
+	return profileFromPolicy(name), nil
+}
+
+// Has reports whether feature was granted.
+func (g *PolicyGrant) Has(feature string) bool {
+	for _, f := range g.Features {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// grantSignature authenticates a grant body and the identity signature
+// after it under the session key, binding them to this session
+// independently of the envelope they travel in.
+func grantSignature(sessionKey, signed []byte) []byte {
+	mac := hmac.New(sha256.New, sessionKey)
+	mac.Write([]byte("reflex-policy-grant"))
+	mac.Write(signed)
+	return mac.Sum(nil)
+}
+
+// SignGrant appends the trailer to a grant body: the identity signature,
+// if identity is set, the session HMAC over everything before it and one
+// byte giving the identity signature's length. Signatures cover the body
+// exactly as sent, so fields a client doesn't know can't break them.
+func SignGrant(sessionKey []byte, identity ed25519.PrivateKey, body []byte) []byte {
+	signed := body
+	if identity != nil {
+		signed = append(signed[:len(signed):len(signed)], ed25519.Sign(identity, identityMessage(sessionKey, body))...)
+	}
+	trailer := len(signed) - len(body)
+	grant := append(signed[:len(signed):len(signed)], grantSignature(sessionKey, signed)...)
+	return append(grant, byte(trailer))
+}
+
+// identityMessage is what the server's identity key signs: the grant body
+// and a hash of the session key, which an on-path box that terminated the
+// key exchange on both sides can't make match.
+func identityMessage(sessionKey, body []byte) []byte {
+	keyHash := sha256.Sum256(sessionKey)
+	msg := append([]byte("reflex-policy-identity"), keyHash[:]...)
+	return append(msg, body...)
+}
+
+// verifyIdentity checks that the server holding the identity key for
+// server signed g for this session. A plain or unsigned grant fails too,
+// since stripping the signature is how a downgrade would look.
+func (g *PolicyGrant) verifyIdentity(sessionKey []byte, server ed25519.PublicKey) error {
+	if len(g.ServerSignature) == 0 {
+		return errors.New("reflex policy grant is not signed by the server identity")
+	}
+	if !ed25519.Verify(server, identityMessage(sessionKey, g.body), g.ServerSignature) {
+		return errors.New("reflex policy grant server signature mismatch")
+	}
+	return nil
+}
+
+// WritePolicyGrant sends grant as a policy update. From ProtocolVersion5 on,
+// a grant larger than policyChunkSize is split: its leading parts go out as
+// FrameTypePolicyContinuation frames and the update carries the last one.
+func (s *Session) WritePolicyGrant(w io.Writer, grant []byte) error {
+	if len(grant) > maxPolicyGrantSize {
+		return errors.New("reflex policy grant too large")
+	}
+	var frames []OutgoingFrame
+	for s.chunkGrants && len(grant) > policyChunkSize {
+		frames = append(frames, OutgoingFrame{Type: FrameTypePolicyContinuation, Payload: grant[:policyChunkSize]})
+		grant = grant[policyChunkSize:]
+	}
+	frames = append(frames, OutgoingFrame{Type: FrameTypePolicyUpdate, Payload: grant})
+	return s.WriteFrames(w, frames...)
+}
+
+// ParsePolicyGrant verifies a decrypted grant's signature and decodes it. A
+// plain policy name from a server that doesn't negotiate is returned as a
+// grant of that profile in both directions.
+func ParsePolicyGrant(sessionKey []byte, grant []byte) (*PolicyGrant, error) {
+	if len(grant) == 0 || grant[0] != '{' {
+		return &PolicyGrant{Uplink: string(grant), Downlink: string(grant), Padding: PaddingProfile}, nil
+	}
+	n := len(grant) - 1
+	identityLen := int(grant[n])
+	if identityLen != 0 && identityLen != ed25519.SignatureSize || n < 1+identityLen+sha256.Size {
+		return nil, errors.New("malformed reflex policy grant trailer")
+	}
+	signed, signature := grant[:n-sha256.Size], grant[n-sha256.Size:n]
+	if !hmac.Equal(signature, grantSignature(sessionKey, signed)) {
+		return nil, errors.New("reflex policy grant signature mismatch")
+	}
+	body := signed[:len(signed)-identityLen]
+	g := new(PolicyGrant)
+	if err := json.Unmarshal(body, g); err != nil {
+		return nil, errors.New("malformed reflex policy grant").Base(err)
+	}
+	if g.Version != PolicyVersion {
+		return nil, errors.New("unsupported reflex policy grant version ", g.Version)
+	}
+	g.body = append([]byte(nil), body...)
+	g.Signature = append([]byte(nil), signature...)
+	if identityLen > 0 {
+		g.ServerSignature = append([]byte(nil), signed[len(body):]...)
+	}
+	return g, nil
+}
@@ -0,0 +1,38 @@
+package encoding
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"testing"
+)
+
+func TestGrantSignaturesCoverTheSentBytes(t *testing.T) {
+	key := testKey()
+	identity := ed25519.NewKeyFromSeed(bytes.Repeat([]byte{7}, ed25519.SeedSize))
+	// A newer server's grant: unknown fields, its own key order and spacing.
+	body := []byte(`{"downlink": "zoom", "v": 1, "uplink": "zoom", "route": {"via": "edge"}, "padding": "max"}`)
+	grant := SignGrant(key, identity, body)
+
+	g, err := ParsePolicyGrant(key, grant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Uplink != "zoom" || g.Padding != PaddingMax {
+		t.Fatalf("unexpected grant: %+v", g)
+	}
+	if err := g.verifyIdentity(key, identity.Public().(ed25519.PublicKey)); err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := ed25519.GenerateKey(nil)
+	if err := g.verifyIdentity(key, other); err == nil {
+		t.Fatal("grant verified under another identity")
+	}
+
+	unsigned, err := ParsePolicyGrant(key, SignGrant(key, nil, body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := unsigned.verifyIdentity(key, identity.Public().(ed25519.PublicKey)); err == nil {
+		t.Fatal("grant without an identity signature verified")
+	}
+}
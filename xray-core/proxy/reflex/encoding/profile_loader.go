@@ -0,0 +1,263 @@
+package encoding
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// profileJSON is the on-disk representation of a TrafficProfile.
+type profileJSON struct {
+	Name         string           `json:"name"`
+	PacketSizes  []packetSizeJSON `json:"packetSizes"`
+	Delays       []delayJSON      `json:"delays"`
+	BurstLengths []burstJSON      `json:"burstLengths,omitempty"`
+	BurstGaps    []delayJSON      `json:"burstGaps,omitempty"`
+	Pacing       string           `json:"pacing,omitempty"`
+	Model        string           `json:"model,omitempty"`
+	// SizeTransitions and DelayTransitions are row-per-bucket weights used
+	// by the "markov" model, in the order of packetSizes and delays.
+	SizeTransitions  [][]float64 `json:"sizeTransitions,omitempty"`
+	DelayTransitions [][]float64 `json:"delayTransitions,omitempty"`
+	// TargetKbps paces data to an average bitrate, reached over RampUpMs.
+	TargetKbps uint64  `json:"targetKbps,omitempty"`
+	RampUpMs   float64 `json:"rampUpMs,omitempty"`
+	// Trace is replayed in order by the "trace" model.
+	Trace []tracePacketJSON `json:"trace,omitempty"`
+}
+
+type packetSizeJSON struct {
+	Size   int     `json:"size"`
+	Weight float64 `json:"weight"`
+}
+
+type delayJSON struct {
+	DelayMs float64 `json:"delayMs"`
+	Weight  float64 `json:"weight"`
+}
+
+type tracePacketJSON struct {
+	Size    int     `json:"size"`
+	DelayMs float64 `json:"delayMs"`
+}
+
+type burstJSON struct {
+	Packets int     `json:"packets"`
+	Weight  float64 `json:"weight"`
+}
+
+var pacingNames = map[string]PacingMode{
+	"":         PacingSender,
+	"sender":   PacingSender,
+	"receiver": PacingReceiver,
+	"none":     PacingNone,
+}
+
+var modelNames = map[string]MorphModel{
+	"":            ModelIndependent,
+	"independent": ModelIndependent,
+	"markov":      ModelMarkov,
+	"trace":       ModelTrace,
+}
+
+// ParseProfileJSON decodes one profile definition and checks it with
+// Validate, which normalizes its weights.
+func ParseProfileJSON(data []byte) (*TrafficProfile, error) {
+	var pj profileJSON
+	if err := json.Unmarshal(data, &pj); err != nil {
+		return nil, err
+	}
+	if pj.Name == "" {
+		return nil, errors.New("profile name is empty")
+	}
+	pacing, ok := pacingNames[strings.ToLower(pj.Pacing)]
+	if !ok {
+		return nil, errors.New("profile ", pj.Name, " has unknown pacing ", pj.Pacing)
+	}
+	model, ok := modelNames[strings.ToLower(pj.Model)]
+	if !ok {
+		return nil, errors.New("profile ", pj.Name, " has unknown model ", pj.Model)
+	}
+	p := &TrafficProfile{
+		Name:             pj.Name,
+		Pacing:           pacing,
+		Model:            model,
+		SizeTransitions:  pj.SizeTransitions,
+		DelayTransitions: pj.DelayTransitions,
+		TargetBitrate:    pj.TargetKbps * 1000,
+		RampUp:           time.Duration(pj.RampUpMs * float64(time.Millisecond)),
+	}
+	for _, s := range pj.PacketSizes {
+		p.PacketSizes = append(p.PacketSizes, PacketSizeDist{Size: s.Size, Weight: s.Weight})
+	}
+	for _, d := range pj.Delays {
+		p.Delays = append(p.Delays, DelayDist{Delay: time.Duration(d.DelayMs * float64(time.Millisecond)), Weight: d.Weight})
+	}
+	for _, b := range pj.BurstLengths {
+		p.BurstLengths = append(p.BurstLengths, BurstDist{Packets: b.Packets, Weight: b.Weight})
+	}
+	for _, g := range pj.BurstGaps {
+		p.BurstGaps = append(p.BurstGaps, DelayDist{Delay: time.Duration(g.DelayMs * float64(time.Millisecond)), Weight: g.Weight})
+	}
+	for _, t := range pj.Trace {
+		p.Trace = append(p.Trace, TracePacket{Size: t.Size, Delay: time.Duration(t.DelayMs * float64(time.Millisecond))})
+	}
+	if err := p.Validate(); err != nil {
+		return nil, errors.New("profile ", pj.Name, " is invalid").Base(err)
+	}
+	return p, nil
+}
+
+// validTransitions checks that matrix is n by n with non-negative weights.
+func validTransitions(matrix [][]float64, n int) error {
+	if len(matrix) != n {
+		return errors.New("expected ", n, " rows, got ", len(matrix))
+	}
+	for i, row := range matrix {
+		if len(row) != n {
+			return errors.New("row ", i, " has ", len(row), " columns, expected ", n)
+		}
+		for _, w := range row {
+			if w < 0 {
+				return errors.New("row ", i, " has a negative weight")
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalProfileJSON encodes p in the format read by ParseProfileJSON.
+func MarshalProfileJSON(p *TrafficProfile) ([]byte, error) {
+	return json.MarshalIndent(toProfileJSON(p), "", "  ")
+}
+
+func toProfileJSON(p *TrafficProfile) profileJSON {
+	pj := profileJSON{
+		Name:       p.Name,
+		TargetKbps: p.TargetBitrate / 1000,
+		RampUpMs:   float64(p.RampUp) / float64(time.Millisecond),
+	}
+	switch p.Pacing {
+	case PacingReceiver:
+		pj.Pacing = "receiver"
+	case PacingNone:
+		pj.Pacing = "none"
+	}
+	switch p.Model {
+	case ModelMarkov:
+		pj.Model = "markov"
+		pj.SizeTransitions = p.SizeTransitions
+		pj.DelayTransitions = p.DelayTransitions
+	case ModelTrace:
+		pj.Model = "trace"
+		for _, t := range p.Trace {
+			pj.Trace = append(pj.Trace, tracePacketJSON{Size: t.Size, DelayMs: float64(t.Delay) / float64(time.Millisecond)})
+		}
+	}
+	for _, s := range p.PacketSizes {
+		pj.PacketSizes = append(pj.PacketSizes, packetSizeJSON{Size: s.Size, Weight: s.Weight})
+	}
+	for _, d := range p.Delays {
+		pj.Delays = append(pj.Delays, delayJSON{DelayMs: float64(d.Delay) / float64(time.Millisecond), Weight: d.Weight})
+	}
+	for _, b := range p.BurstLengths {
+		pj.BurstLengths = append(pj.BurstLengths, burstJSON{Packets: b.Packets, Weight: b.Weight})
+	}
+	for _, g := range p.BurstGaps {
+		pj.BurstGaps = append(pj.BurstGaps, delayJSON{DelayMs: float64(g.Delay) / float64(time.Millisecond), Weight: g.Weight})
+	}
+	return pj
+}
+
+// readProfileDir parses every *.json profile in dir.
+func readProfileDir(dir string) (map[string]*TrafficProfile, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(files)
+	profiles := make(map[string]*TrafficProfile, len(files))
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		p, err := ParseProfileJSON(data)
+		if err != nil {
+			return nil, errors.New("failed to load reflex profile ", file).Base(err)
+		}
+		profiles[p.Name] = p
+	}
+	return profiles, nil
+}
+
+// ProfileSet is the profiles an inbound resolves policies to: those loaded
+// from its profile_dir, then the built-ins. A nil set has the built-ins
+// only.
+type ProfileSet struct {
+	mu     sync.RWMutex
+	loaded map[string]*TrafficProfile
+}
+
+// Load replaces the loaded profiles with those in dir and returns how many
+// there are. On error the set is left as it was.
+func (s *ProfileSet) Load(dir string) (int, error) {
+	profiles, err := readProfileDir(dir)
+	if err != nil {
+		return 0, err
+	}
+	s.mu.Lock()
+	s.loaded = profiles
+	s.mu.Unlock()
+	return len(profiles), nil
+}
+
+// Lookup finds a profile by name.
+func (s *ProfileSet) Lookup(name string) (*TrafficProfile, bool) {
+	if s != nil {
+		s.mu.RLock()
+		p, ok := s.loaded[name]
+		s.mu.RUnlock()
+		if ok {
+			return p, true
+		}
+	}
+	p, ok := Profiles[name]
+	return p, ok
+}
+
+// Profile returns a copy of the named profile for one session to shape
+// with, or of http2-api if there is none by that name.
+func (s *ProfileSet) Profile(name string) *TrafficProfile {
+	if p, ok := s.Lookup(name); ok {
+		return cloneProfile(p)
+	}
+	return cloneProfile(Profiles["http2-api"])
+}
+
+// GrantExt returns the Ext of a grant whose uplink is the named profile. A
+// loaded profile is embedded, since the client only knows the built-ins by
+// name; for a built-in one it is nil.
+func (s *ProfileSet) GrantExt(name string) json.RawMessage {
+	if s == nil {
+		return nil
+	}
+	s.mu.RLock()
+	p, ok := s.loaded[name]
+	s.mu.RUnlock()
+	if !ok {
+		return nil
+	}
+	def, err := json.Marshal(toProfileJSON(p))
+	if err != nil {
+		return nil
+	}
+	ext, _ := json.Marshal(GrantExt{Profiles: []json.RawMessage{def}})
+	return ext
+}
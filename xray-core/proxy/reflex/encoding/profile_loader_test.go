@@ -0,0 +1,133 @@
+package encoding
+
+import (
+	"testing"
+	"time"
+)
+
+const testProfileJSON = `{
+  "name": "custom-video",
+  "packetSizes": [{"size": 1300, "weight": 0.7}, {"size": 400, "weight": 0.3}],
+  "delays": [{"delayMs": 12.5, "weight": 1}],
+  "pacing": "receiver"
+}`
+
+func TestParseAndMarshalProfileJSON(t *testing.T) {
+	p, err := ParseProfileJSON([]byte(testProfileJSON))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Name != "custom-video" || len(p.PacketSizes) != 2 || p.Pacing != PacingReceiver {
+		t.Fatalf("unexpected profile: %+v", p)
+	}
+	if p.Delays[0].Delay != 12500*time.Microsecond {
+		t.Fatalf("unexpected delay: %v", p.Delays[0].Delay)
+	}
+
+	data, err := MarshalProfileJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseProfileJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Name != p.Name || again.Pacing != p.Pacing || again.Delays[0].Delay != p.Delays[0].Delay {
+		t.Fatal("profile did not survive a JSON round trip")
+	}
+
+	for _, bad := range []string{
+		`{}`,
+		`{"name":"x"}`,
+		`{"name":"x","packetSizes":[{"size":-1,"weight":1}]}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1}],"pacing":"warp"}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1}],"burstLengths":[{"packets":4,"weight":1}]}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1}],"burstLengths":[{"packets":0,"weight":1}],"burstGaps":[{"delayMs":1,"weight":1}]}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1}],"model":"markov"}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1}],"model":"hmm"}`,
+		`{"name":"x","packetSizes":[{"size":1,"weight":1},{"size":2,"weight":1}],"model":"markov","sizeTransitions":[[1,0]]}`,
+	} {
+		if _, err := ParseProfileJSON([]byte(bad)); err == nil {
+			t.Fatalf("expected error for %s", bad)
+		}
+	}
+}
+
+func TestProfileJSONBursts(t *testing.T) {
+	p, err := ParseProfileJSON([]byte(`{
+  "name": "bursty",
+  "packetSizes": [{"size": 1400, "weight": 1}],
+  "delays": [{"delayMs": 1, "weight": 1}],
+  "burstLengths": [{"packets": 30, "weight": 1}],
+  "burstGaps": [{"delayMs": 800, "weight": 1}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.BurstLengths) != 1 || p.BurstLengths[0].Packets != 30 || p.BurstGaps[0].Delay != 800*time.Millisecond {
+		t.Fatalf("unexpected burst model: %+v %+v", p.BurstLengths, p.BurstGaps)
+	}
+	data, err := MarshalProfileJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseProfileJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(again.BurstLengths) != 1 || again.BurstGaps[0].Delay != p.BurstGaps[0].Delay {
+		t.Fatal("burst model did not survive a JSON round trip")
+	}
+}
+
+func TestProfileJSONMarkov(t *testing.T) {
+	p, err := ParseProfileJSON([]byte(`{
+  "name": "chain",
+  "packetSizes": [{"size": 200, "weight": 0.5}, {"size": 1400, "weight": 0.5}],
+  "delays": [{"delayMs": 5, "weight": 1}],
+  "model": "markov",
+  "sizeTransitions": [[0.1, 0.9], [0.8, 0.2]]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Model != ModelMarkov || p.SizeTransitions[1][0] != 0.8 || p.DelayTransitions != nil {
+		t.Fatalf("unexpected markov profile: %+v", p)
+	}
+	data, err := MarshalProfileJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseProfileJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Model != ModelMarkov || again.SizeTransitions[0][1] != 0.9 {
+		t.Fatal("markov model did not survive a JSON round trip")
+	}
+}
+
+func TestProfileJSONTrace(t *testing.T) {
+	p, err := ParseProfileJSON([]byte(`{
+  "name": "reference",
+  "model": "trace",
+  "trace": [{"size": 517, "delayMs": 30}, {"size": 1400, "delayMs": 0.5}]
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Model != ModelTrace || len(p.Trace) != 2 || p.Trace[1].Delay != 500*time.Microsecond || len(p.PacketSizes) != 2 {
+		t.Fatalf("unexpected trace profile: %+v", p)
+	}
+	data, err := MarshalProfileJSON(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := ParseProfileJSON(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.Model != ModelTrace || len(again.Trace) != 2 || again.Trace[0] != p.Trace[0] {
+		t.Fatal("trace did not survive a JSON round trip")
+	}
+}
@@ -0,0 +1,133 @@
+package encoding
+
+import (
+	"math"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	// weightTolerance is how far the weights of a distribution may sum from
+	// 1 before Validate rescales them.
+	weightTolerance = 0.01
+	// maxProfileDelay bounds delays and burst gaps. Longer waits would run
+	// sessions into their idle timeout.
+	maxProfileDelay = 30 * time.Second
+)
+
+// Validate checks that p can drive a session and normalizes it: every
+// distribution's weights are rescaled to sum to 1 unless they already do,
+// since sampling assumes they do. Sizes must fit in a frame and delays lie
+// within maxProfileDelay. A trace without PacketSizes gets its distributions
+// filled in. Call it before the profile is in use.
+func (p *TrafficProfile) Validate() error {
+	if p.Model == ModelTrace {
+		if err := p.validTrace(); err != nil {
+			return err
+		}
+	}
+	if len(p.PacketSizes) == 0 {
+		return errors.New("no packet sizes")
+	}
+	for _, s := range p.PacketSizes {
+		if s.Size <= 0 || s.Size > maxFramePayloadSize {
+			return errors.New("packet size ", s.Size, " does not fit in a frame")
+		}
+	}
+	if err := normalizeWeights(len(p.PacketSizes), func(i int) *float64 { return &p.PacketSizes[i].Weight }); err != nil {
+		return errors.New("invalid packet size weights").Base(err)
+	}
+	if err := validDelays(p.Delays); err != nil {
+		return errors.New("invalid delays").Base(err)
+	}
+	for _, b := range p.BurstLengths {
+		if b.Packets <= 0 {
+			return errors.New("burst length ", b.Packets, " is not positive")
+		}
+	}
+	if err := normalizeWeights(len(p.BurstLengths), func(i int) *float64 { return &p.BurstLengths[i].Weight }); err != nil {
+		return errors.New("invalid burst length weights").Base(err)
+	}
+	if len(p.BurstLengths) > 0 && len(p.BurstGaps) == 0 {
+		return errors.New("burst lengths but no burst gaps")
+	}
+	if err := validDelays(p.BurstGaps); err != nil {
+		return errors.New("invalid burst gaps").Base(err)
+	}
+	if p.SizeTransitions != nil {
+		if err := validTransitions(p.SizeTransitions, len(p.PacketSizes)); err != nil {
+			return errors.New("invalid size transitions").Base(err)
+		}
+	}
+	if p.DelayTransitions != nil {
+		if err := validTransitions(p.DelayTransitions, len(p.Delays)); err != nil {
+			return errors.New("invalid delay transitions").Base(err)
+		}
+	}
+	if p.Model == ModelMarkov && p.SizeTransitions == nil && p.DelayTransitions == nil {
+		return errors.New("markov model without transitions")
+	}
+	if p.RampUp < 0 {
+		return errors.New("negative ramp-up")
+	}
+	return nil
+}
+
+// validTrace checks a ModelTrace profile's trace and the settings a trace
+// leaves no room for.
+func (p *TrafficProfile) validTrace() error {
+	if len(p.Trace) == 0 {
+		return errors.New("trace model without a trace")
+	}
+	for i, t := range p.Trace {
+		if t.Size <= 0 || t.Size > maxFramePayloadSize {
+			return errors.New("trace packet ", i, " of size ", t.Size, " does not fit in a frame")
+		}
+		if t.Delay < 0 || t.Delay > maxProfileDelay {
+			return errors.New("trace packet ", i, " delay ", t.Delay, " is outside [0, ", maxProfileDelay, "]")
+		}
+	}
+	if len(p.BurstLengths) > 0 || p.TargetBitrate > 0 {
+		return errors.New("trace model with bursts or a target bitrate")
+	}
+	if len(p.PacketSizes) == 0 {
+		p.describeTrace()
+	}
+	return nil
+}
+
+// validDelays checks and normalizes a delay distribution.
+func validDelays(values []DelayDist) error {
+	for _, d := range values {
+		if d.Delay < 0 || d.Delay > maxProfileDelay {
+			return errors.New("delay ", d.Delay, " is outside [0, ", maxProfileDelay, "]")
+		}
+	}
+	return normalizeWeights(len(values), func(i int) *float64 { return &values[i].Weight })
+}
+
+// normalizeWeights checks the n weights reached through weight and rescales
+// them to sum to 1 if they are further than weightTolerance from it.
+func normalizeWeights(n int, weight func(i int) *float64) error {
+	if n == 0 {
+		return nil
+	}
+	var sum float64
+	for i := 0; i < n; i++ {
+		w := *weight(i)
+		if w < 0 || math.IsNaN(w) || math.IsInf(w, 0) {
+			return errors.New("weight ", w, " is not a non-negative number")
+		}
+		sum += w
+	}
+	if sum == 0 {
+		return errors.New("weights sum to zero")
+	}
+	if math.Abs(sum-1) > weightTolerance {
+		for i := 0; i < n; i++ {
+			*weight(i) /= sum
+		}
+	}
+	return nil
+}
@@ -0,0 +1,51 @@
+package encoding
+
+import (
+	"math"
+	"testing"
+	"time"
+)
+
+func TestValidateNormalizesWeights(t *testing.T) {
+	p := &TrafficProfile{
+		Name:        "test",
+		PacketSizes: []PacketSizeDist{{Size: 100, Weight: 2}, {Size: 200, Weight: 6}},
+		Delays:      []DelayDist{{Delay: time.Millisecond, Weight: 0.5}, {Delay: 2 * time.Millisecond, Weight: 0.499}},
+	}
+	if err := p.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	if p.PacketSizes[0].Weight != 0.25 || p.PacketSizes[1].Weight != 0.75 {
+		t.Fatalf("size weights not normalized: %v", p.PacketSizes)
+	}
+	if p.Delays[1].Weight != 0.499 {
+		t.Fatalf("weights within tolerance were rescaled: %v", p.Delays)
+	}
+
+	for name, p := range Profiles {
+		if err := cloneProfile(p).Validate(); err != nil {
+			t.Errorf("built-in profile %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidateRejectsMalformedProfiles(t *testing.T) {
+	sizes := []PacketSizeDist{{Size: 100, Weight: 1}}
+	for name, p := range map[string]*TrafficProfile{
+		"no sizes":        {},
+		"oversized":       {PacketSizes: []PacketSizeDist{{Size: maxFramePayloadSize + 1, Weight: 1}}},
+		"negative weight": {PacketSizes: []PacketSizeDist{{Size: 100, Weight: -1}, {Size: 200, Weight: 2}}},
+		"zero weights":    {PacketSizes: []PacketSizeDist{{Size: 100, Weight: 0}}},
+		"NaN weight":      {PacketSizes: []PacketSizeDist{{Size: 100, Weight: math.NaN()}}},
+		"negative delay":  {PacketSizes: sizes, Delays: []DelayDist{{Delay: -time.Millisecond, Weight: 1}}},
+		"endless delay":   {PacketSizes: sizes, Delays: []DelayDist{{Delay: time.Hour, Weight: 1}}},
+		"gapless bursts":  {PacketSizes: sizes, BurstLengths: []BurstDist{{Packets: 4, Weight: 1}}},
+		"markov":          {PacketSizes: sizes, Model: ModelMarkov},
+		"empty trace":     {Model: ModelTrace},
+		"paced trace":     {Model: ModelTrace, Trace: []TracePacket{{Size: 100}}, TargetBitrate: 1000},
+	} {
+		if err := p.Validate(); err == nil {
+			t.Errorf("%s: accepted", name)
+		}
+	}
+}
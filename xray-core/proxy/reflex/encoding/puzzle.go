@@ -0,0 +1,54 @@
+package encoding
+
+import (
+	"crypto/sha256"
+	"encoding/binary"
+	"math/bits"
+)
+
+const MaxPuzzleDifficulty = 32
+
+// PuzzleHeader carries the difficulty in the 429 answering a handshake
+// without an enforced puzzle's solution, so the client can solve it and
+// retry.
+const PuzzleHeader = "X-Puzzle-Difficulty"
+
+// puzzleDigest hashes the handshake fields a client grinds for the puzzle.
+func puzzleDigest(hs *ClientHandshake) [32]byte {
+	var buf [32 + 16 + 8]byte
+	copy(buf[:32], hs.PublicKey[:])
+	copy(buf[32:48], hs.Nonce[:])
+	binary.BigEndian.PutUint64(buf[48:], uint64(hs.Timestamp))
+	return sha256.Sum256(buf[:])
+}
+
+func leadingZeroBits(digest [32]byte) int {
+	n := 0
+	for _, b := range digest {
+		if b != 0 {
+			return n + bits.LeadingZeros8(b)
+		}
+		n += 8
+	}
+	return n
+}
+
+func VerifyPuzzle(hs *ClientHandshake, difficulty uint32) bool {
+	return leadingZeroBits(puzzleDigest(hs)) >= int(difficulty)
+}
+
+// SolvePuzzle rewrites the tail of hs.Nonce until the handshake satisfies
+// difficulty. The leading half of the nonce keeps its random prefix.
+func SolvePuzzle(hs *ClientHandshake, difficulty uint32) {
+	if difficulty == 0 {
+		return
+	}
+	if difficulty > MaxPuzzleDifficulty {
+		difficulty = MaxPuzzleDifficulty
+	}
+	counter := binary.BigEndian.Uint64(hs.Nonce[8:])
+	for !VerifyPuzzle(hs, difficulty) {
+		counter++
+		binary.BigEndian.PutUint64(hs.Nonce[8:], counter)
+	}
+}
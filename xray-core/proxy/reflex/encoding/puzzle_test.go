@@ -0,0 +1,20 @@
+package encoding
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSolveAndVerifyPuzzle(t *testing.T) {
+	hs := buildClientHandshake(t, [16]byte{1}, time.Now().Unix(), [16]byte{2}, nil)
+	SolvePuzzle(&hs, 12)
+	if !VerifyPuzzle(&hs, 12) {
+		t.Fatal("solved puzzle should verify")
+	}
+
+	nonce := hs.Nonce
+	SolvePuzzle(&hs, 0)
+	if hs.Nonce != nonce {
+		t.Fatal("zero difficulty should leave the nonce untouched")
+	}
+}
@@ -0,0 +1,91 @@
+package encoding
+
+import (
+	"context"
+	"crypto/tls"
+	"net"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/xtls/xray-core/common/errors"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/transport/internet"
+)
+
+// QUICALPN is the ALPN protocol of Reflex over QUIC. It isn't "h3": the
+// listener doesn't speak HTTP/3, and claiming it would give that away to the
+// first HTTP/3 request.
+const QUICALPN = "reflex"
+
+// quicStreamConn carries a Reflex byte stream on one bidirectional QUIC
+// stream. Streams of the same connection are independent, so a lost packet
+// only stalls the session it belongs to.
+type quicStreamConn struct {
+	*quic.Stream
+	conn *quic.Conn
+}
+
+// NewQUICStreamConn is stream of conn as a connection.
+func NewQUICStreamConn(stream *quic.Stream, conn *quic.Conn) net.Conn {
+	return &quicStreamConn{Stream: stream, conn: conn}
+}
+
+func (c *quicStreamConn) LocalAddr() net.Addr  { return c.conn.LocalAddr() }
+func (c *quicStreamConn) RemoteAddr() net.Addr { return c.conn.RemoteAddr() }
+
+// Close ends both directions of the stream.
+func (c *quicStreamConn) Close() error {
+	c.CancelRead(0)
+	return c.Stream.Close()
+}
+
+// quicClientConn owns the QUIC connection of a dialed stream.
+type quicClientConn struct {
+	quicStreamConn
+}
+
+func (c *quicClientConn) Close() error {
+	c.quicStreamConn.Close()
+	return c.conn.CloseWithError(0, "")
+}
+
+func QUICConfig() *quic.Config {
+	return &quic.Config{
+		MaxIdleTimeout:  xnet.ConnIdleTimeout,
+		KeepAlivePeriod: xnet.QuicgoH3KeepAlivePeriod,
+	}
+}
+
+// DialQUIC opens a QUIC connection over conn, a connected UDP socket from
+// the outbound's dialer, and returns its first stream for a Reflex session.
+// serverName is sent as SNI and verified unless allowInsecure is set.
+func DialQUIC(ctx context.Context, conn net.Conn, serverName string, allowInsecure bool) (net.Conn, error) {
+	var packetConn net.PacketConn
+	switch c := conn.(type) {
+	case *internet.PacketConnWrapper:
+		packetConn = c.Conn
+	case *net.UDPConn:
+		packetConn = c
+	default:
+		packetConn = &internet.FakePacketConn{Conn: c}
+	}
+	addr, err := net.ResolveUDPAddr("udp", conn.RemoteAddr().String())
+	if err != nil {
+		return nil, err
+	}
+	qc, err := quic.Dial(ctx, packetConn, addr, &tls.Config{
+		ServerName:         serverName,
+		NextProtos:         []string{QUICALPN},
+		MinVersion:         tls.VersionTLS13,
+		InsecureSkipVerify: allowInsecure,
+	}, QUICConfig())
+	if err != nil {
+		return nil, errors.New("reflex quic handshake failed").Base(err)
+	}
+	stream, err := qc.OpenStreamSync(ctx)
+	if err != nil {
+		qc.CloseWithError(0, "")
+		return nil, errors.New("failed to open reflex quic stream").Base(err)
+	}
+	return &quicClientConn{quicStreamConn{Stream: stream, conn: qc}}, nil
+}
@@ -0,0 +1,98 @@
+package encoding
+
+import "sync"
+
+// writeQuantum is how many wire bytes a writer may send per round of
+// writeScheduler before the next waiting writer gets a turn.
+const writeQuantum = coalesceLimit
+
+// writeScheduler hands out the turn to write a session's frames. Each
+// goroutine writing to a session, the data copy, heartbeats, window updates,
+// cover traffic, is a stream of its own, told apart by the type of the
+// first frame it writes. Waiting streams get the turn by deficit round
+// robin over the bytes they write, so a bulk stream handing the writer
+// 64 KiB batches can't hold off a ping or window update behind it, as it
+// could by winning a plain mutex again and again.
+type writeScheduler struct {
+	mu   sync.Mutex
+	busy bool
+	// queues are the waiting writes of each stream, and active the streams
+	// with waiting writes in round robin order. visiting is set once
+	// active[0] got its quantum for the current round.
+	queues   map[uint8]*writeQueue
+	active   []uint8
+	visiting bool
+}
+
+type writeQueue struct {
+	turns   []*writeTurn
+	deficit int
+}
+
+type writeTurn struct {
+	size  int
+	ready chan struct{}
+}
+
+// acquire blocks until stream may write size bytes. The caller ends its
+// turn with release.
+func (w *writeScheduler) acquire(stream uint8, size int) {
+	w.mu.Lock()
+	if !w.busy {
+		w.busy = true
+		w.mu.Unlock()
+		return
+	}
+	if w.queues == nil {
+		w.queues = make(map[uint8]*writeQueue)
+	}
+	q := w.queues[stream]
+	if q == nil {
+		q = &writeQueue{}
+		w.queues[stream] = q
+		w.active = append(w.active, stream)
+	}
+	turn := &writeTurn{size: size, ready: make(chan struct{})}
+	q.turns = append(q.turns, turn)
+	w.mu.Unlock()
+	<-turn.ready
+}
+
+// release ends the current turn and passes it on to the next waiting write,
+// if any.
+func (w *writeScheduler) release() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if turn := w.next(); turn != nil {
+		close(turn.ready)
+		return
+	}
+	w.busy = false
+}
+
+// next dequeues the write that goes next. The caller holds mu.
+func (w *writeScheduler) next() *writeTurn {
+	for len(w.active) > 0 {
+		stream := w.active[0]
+		q := w.queues[stream]
+		if len(q.turns) == 0 {
+			delete(w.queues, stream)
+			w.active = w.active[1:]
+			w.visiting = false
+			continue
+		}
+		if !w.visiting {
+			q.deficit += writeQuantum
+			w.visiting = true
+		}
+		if turn := q.turns[0]; turn.size <= q.deficit {
+			q.deficit -= turn.size
+			q.turns = q.turns[1:]
+			return turn
+		}
+		// The stream used up its quantum; the others go first.
+		w.active = append(w.active[1:], stream)
+		w.visiting = false
+	}
+	return nil
+}
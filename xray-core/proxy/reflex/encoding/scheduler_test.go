@@ -0,0 +1,108 @@
+package encoding
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// slowWriter takes a while over every write and counts the large ones.
+type slowWriter struct {
+	bulk atomic.Int64
+}
+
+func (w *slowWriter) Write(p []byte) (int, error) {
+	time.Sleep(100 * time.Microsecond)
+	if len(p) > 1024 {
+		w.bulk.Add(1)
+	}
+	return len(p), nil
+}
+
+func TestBulkWriterCantStarvePings(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &slowWriter{}
+	stop := make(chan struct{})
+	var wg sync.WaitGroup
+	defer wg.Wait()
+	defer close(stop)
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		data := make([]byte, 8*1024)
+		for {
+			select {
+			case <-stop:
+				return
+			default:
+			}
+			if err := s.WriteFrame(w, FrameTypeData, data); err != nil {
+				t.Error(err)
+				return
+			}
+		}
+	}()
+	for w.bulk.Load() == 0 {
+		time.Sleep(time.Millisecond)
+	}
+
+	for i := 0; i < 50; i++ {
+		before := w.bulk.Load()
+		if err := s.Ping(w); err != nil {
+			t.Fatal(err)
+		}
+		// At most the bulk write holding the turn goes before the ping.
+		if passed := w.bulk.Load() - before; passed > 1 {
+			t.Fatalf("ping %d waited for %d bulk writes", i, passed)
+		}
+	}
+}
+
+func TestWriteSchedulerSharesByBytes(t *testing.T) {
+	var w writeScheduler
+	w.acquire(FrameTypeData, 0)
+
+	// While the turn is taken, a bulk stream queues four writes of more than
+	// a quantum each and a control stream two small writes.
+	var order []uint8
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	enqueue := func(stream uint8, size int) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			w.acquire(stream, size)
+			mu.Lock()
+			order = append(order, stream)
+			mu.Unlock()
+			w.release()
+		}()
+		for queued := false; !queued; {
+			time.Sleep(time.Millisecond)
+			w.mu.Lock()
+			q := w.queues[stream]
+			queued = q != nil && len(q.turns) > 0 && q.turns[len(q.turns)-1].size == size
+			w.mu.Unlock()
+		}
+	}
+	for i := 0; i < 4; i++ {
+		enqueue(FrameTypeData, writeQuantum+1+i)
+	}
+	enqueue(FrameTypePing, 10)
+	enqueue(FrameTypePing, 11)
+	w.release()
+	wg.Wait()
+
+	// A bulk write of more than a quantum takes two rounds, so the pings,
+	// well within one, go out first.
+	want := []uint8{FrameTypePing, FrameTypePing, FrameTypeData, FrameTypeData, FrameTypeData, FrameTypeData}
+	for i := range want {
+		if order[i] != want[i] {
+			t.Fatalf("writes went out as %v; want %v", order, want)
+		}
+	}
+}
@@ -0,0 +1,696 @@
+package encoding
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	FrameTypeData    = 0x01
+	FrameTypePadding = 0x02
+	FrameTypeTiming  = 0x03
+	FrameTypeClose   = 0x04
+	// FrameTypePolicyUpdate carries a new signed PolicyGrant mid-session.
+	FrameTypePolicyUpdate = 0x05
+	// FrameTypeWindowUpdate returns flow credit once FeatureFlow is granted:
+	// a 4-byte count of DATA bytes, as sealed on the wire, handed on.
+	FrameTypeWindowUpdate = 0x06
+	// FrameTypePing measures the round trip once FeatureHeartbeat is
+	// granted: a request is echoed back as a reply.
+	FrameTypePing = 0x07
+	// FrameTypePolicyContinuation carries the leading part of a grant too
+	// large for one frame, from ProtocolVersion5 on. The FrameTypePolicyUpdate
+	// that follows completes it.
+	FrameTypePolicyContinuation = 0x08
+
+	// CloseFIN and CloseRST flag a Close frame. FIN ends the sender's
+	// direction while the other keeps flowing; RST aborts both and is
+	// followed by one of the CloseError codes. An empty payload, as older
+	// peers send, is a FIN.
+	CloseFIN = 0x00
+	CloseRST = 0x01
+
+	// CloseErrorUnknown is all an older server's RST says.
+	CloseErrorUnknown = 0x00
+	// CloseErrorUpstream: the connection to the destination failed.
+	CloseErrorUpstream = 0x01
+	// CloseErrorDispatch: the destination could not be routed or reached.
+	CloseErrorDispatch = 0x02
+	// CloseErrorShutdown: the server is shutting down.
+	CloseErrorShutdown = 0x03
+
+	maxFramePayloadSize = 65535
+	replayWindowSize    = 1000
+
+	// coalesceLimit is how many bytes of sealed frames a coalescing session
+	// collects before writing them.
+	coalesceLimit = 16 * 1024
+	// maxPooledFrameBuf keeps oversized coalesced buffers out of the pool.
+	maxPooledFrameBuf = 4 * (3 + maxFramePayloadSize)
+	// frameReadChunk is how much of a frame's payload ReadFrame allocates
+	// before any of it arrived; the buffer grows as the rest does.
+	frameReadChunk = 4 * 1024
+)
+
+var frameBufPool = sync.Pool{
+	New: func() interface{} {
+		b := make([]byte, 0, 3+maxFramePayloadSize)
+		return &b
+	},
+}
+
+// Frame is one encrypted Reflex frame.
+type Frame struct {
+	Length  uint16
+	Type    uint8
+	Payload []byte
+}
+
+// Session stores framing and AEAD state for one Reflex connection.
+type Session struct {
+	aead       cipherAEAD
+	readNonce  uint64
+	writeNonce uint64
+	// authHeaders seals each frame's header as additional data,
+	// maskLengths hides its length field under maskKey and chunkGrants lets
+	// a policy grant span frames; see SetProtocolVersion.
+	authHeaders bool
+	maskLengths bool
+	chunkGrants bool
+	maskKey     [32]byte
+	// stream selects the record layout of FeatureStream; see SetStreamMode.
+	stream bool
+
+	// profileMu guards profile and padding, which a policy update may swap
+	// while frames are being written.
+	profileMu sync.RWMutex
+	profile   *TrafficProfile
+	padding   string
+
+	writes    writeScheduler
+	lastWrite atomic.Int64
+	coalesce  atomic.Bool
+	compress  atomic.Bool
+	maxFrame  atomic.Int32
+
+	// sendWindow and recvWindow are set once FeatureFlow is granted.
+	sendWindow *sendWindow
+	recvWindow *recvWindow
+
+	// releaseAt is when data read after an absorbing TIMING frame may be
+	// passed on, as unix nanoseconds.
+	releaseAt atomic.Int64
+
+	replayMu    sync.Mutex
+	replaySeen  map[[32]byte]struct{}
+	replayOrder [][32]byte
+
+	// observer is set on server sessions that are counted or logged.
+	observer Observer
+	sizes    sizeSampler
+
+	counters sessionCounters
+	// entropy watches written bytes when the inbound enables it.
+	entropy *entropyMonitor
+
+	// srtt is the smoothed heartbeat RTT and lastPong when the last reply
+	// arrived, both in nanoseconds.
+	srtt     atomic.Int64
+	lastPong atomic.Int64
+	// congestedUntil is when morphing leaves pass-through, in unix
+	// nanoseconds.
+	congestedUntil atomic.Int64
+	// pending counts the buffers a morph pipeline holds that the morphing
+	// writer hasn't picked up yet; burst gaps wait until it is zero.
+	pending atomic.Int64
+}
+
+type cipherAEAD interface {
+	NonceSize() int
+	Overhead() int
+	Seal(dst, nonce, plaintext, additionalData []byte) []byte
+	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
+}
+
+// NewSession creates a new encrypted frame session.
+func NewSession(sessionKey []byte) (*Session, error) {
+	aead, err := chacha20poly1305.New(sessionKey)
+	if err != nil {
+		return nil, err
+	}
+	return &Session{
+		aead:       aead,
+		replaySeen: make(map[[32]byte]struct{}),
+		maskKey:    sha256.Sum256(append([]byte("reflex-length-mask"), sessionKey...)),
+	}, nil
+}
+
+// SetProtocolVersion applies the framing of the negotiated version. From
+// ProtocolVersion3 on, a frame's header is authenticated with its payload,
+// so a rewritten type or length fails decryption. From ProtocolVersion4 on,
+// the length field is masked so passive observers can't read record sizes
+// off the wire. From ProtocolVersion5 on, a policy grant may span several
+// frames. Call it before the first frame.
+func (s *Session) SetProtocolVersion(version uint8) {
+	s.authHeaders = version >= ProtocolVersion3
+	s.maskLengths = version >= ProtocolVersion4
+	s.chunkGrants = version >= ProtocolVersion5
+}
+
+// SetStreamMode switches to the record layout of FeatureStream: the frame
+// type moves inside the ciphertext and the header shrinks to a masked
+// length, so nothing on the wire repeats from record to record and the
+// stream splits only where the profile's writes do. Both peers must switch
+// right after the grant, before the first frame.
+func (s *Session) SetStreamMode(enabled bool) {
+	s.stream = enabled
+}
+
+// headerSize is the size of the cleartext record header.
+func (s *Session) headerSize() int {
+	if s.stream {
+		return 2
+	}
+	return 3
+}
+
+// sealedSize is the length field of a frame with payload bytes: the sealed
+// payload and, in stream mode, the type sealed along with it.
+func (s *Session) sealedSize(payload int) int {
+	n := payload + s.aead.Overhead()
+	if s.stream {
+		n++
+	}
+	return n
+}
+
+// lengthMask is XORed onto the length field of the frame sealed with nonce
+// counter, or 0 while lengths are unmasked. It is keyed by the session key
+// and counter alone, so a buffered frame's length can be read before the
+// frame is.
+func (s *Session) lengthMask(counter uint64) uint16 {
+	if !s.maskLengths && !s.stream {
+		return 0
+	}
+	var block [32 + 8]byte
+	copy(block[:], s.maskKey[:])
+	binary.BigEndian.PutUint64(block[32:], counter)
+	sum := sha256.Sum256(block[:])
+	return binary.BigEndian.Uint16(sum[:2])
+}
+
+// SetTrafficProfile sets traffic morphing profile for this session.
+func (s *Session) SetTrafficProfile(profile *TrafficProfile) {
+	s.profileMu.Lock()
+	s.profile = profile
+	s.profileMu.Unlock()
+}
+
+// SetPaddingLevel sets how data frames are padded under the profile; see
+// PaddingProfile, PaddingMax and PaddingNone.
+func (s *Session) SetPaddingLevel(level string) {
+	s.profileMu.Lock()
+	s.padding = level
+	s.profileMu.Unlock()
+}
+
+// SetCoalescing makes morphed writes batch each data chunk with its padding
+// and timing frames, and small chunks with each other, into single writes.
+func (s *Session) SetCoalescing(enabled bool) {
+	s.coalesce.Store(enabled)
+}
+
+// SetCompression switches DATA payloads to the codec-prefixed encoding of
+// FeatureCompress. Both peers must switch together, right after the grant.
+func (s *Session) SetCompression(enabled bool) {
+	s.compress.Store(enabled)
+}
+
+// SetMaxFrameSize caps morphed DATA frames, header and tag included, at size
+// bytes on the wire, so one frame fits a single TCP segment. Profile sizes
+// above the cap are clamped; 0 leaves them as drawn.
+func (s *Session) SetMaxFrameSize(size int) {
+	s.maxFrame.Store(int32(size))
+}
+
+// maxDataPayload is the largest DATA payload that fits the frame cap, or 0
+// without one.
+func (s *Session) maxDataPayload(compress bool) int {
+	size := int(s.maxFrame.Load())
+	if size == 0 {
+		return 0
+	}
+	size -= s.headerSize() + s.sealedSize(0)
+	if compress {
+		// compressData may add its codec byte to incompressible data.
+		size--
+	}
+	return size
+}
+
+// Shaping returns the current profile and padding level.
+func (s *Session) Shaping() (*TrafficProfile, string) {
+	s.profileMu.RLock()
+	defer s.profileMu.RUnlock()
+	return s.profile, s.padding
+}
+
+func makeNonce(counter uint64) []byte {
+	nonce := make([]byte, chacha20poly1305.NonceSize)
+	binary.BigEndian.PutUint64(nonce[4:], counter)
+	return nonce
+}
+
+func (s *Session) rememberCiphertext(ciphertext []byte) bool {
+	h := sha256.Sum256(ciphertext)
+	s.replayMu.Lock()
+	defer s.replayMu.Unlock()
+
+	if _, found := s.replaySeen[h]; found {
+		return false
+	}
+	s.replaySeen[h] = struct{}{}
+	s.replayOrder = append(s.replayOrder, h)
+	if len(s.replayOrder) > replayWindowSize {
+		old := s.replayOrder[0]
+		s.replayOrder = s.replayOrder[1:]
+		delete(s.replaySeen, old)
+	}
+	return true
+}
+
+// ReadFrame reads and decrypts one frame from reader.
+func (s *Session) ReadFrame(reader io.Reader) (*Frame, error) {
+	var header [3]byte
+	head := header[:s.headerSize()]
+	if _, err := io.ReadFull(reader, head); err != nil {
+		return nil, err
+	}
+
+	length := binary.BigEndian.Uint16(header[:2]) ^ s.lengthMask(s.readNonce)
+	// Headers are authenticated as sent before masking.
+	binary.BigEndian.PutUint16(header[:2], length)
+	frameType := header[2]
+	if length == 0 || int(length) > maxFramePayloadSize {
+		return nil, errors.New("invalid reflex frame length")
+	}
+
+	encryptedPayload, err := readFramePayload(reader, int(length))
+	if err != nil {
+		return nil, err
+	}
+	if !s.rememberCiphertext(encryptedPayload) {
+		s.counters.replays.Add(1)
+		return nil, errors.New("replay detected")
+	}
+
+	nonce := makeNonce(s.readNonce)
+	s.readNonce++
+	var additional []byte
+	if s.authHeaders {
+		additional = head
+	}
+	payload, err := s.aead.Open(encryptedPayload[:0], nonce, encryptedPayload, additional)
+	if err != nil {
+		return nil, err
+	}
+	if s.stream {
+		if len(payload) == 0 {
+			return nil, errors.New("reflex record without a frame type")
+		}
+		frameType, payload = payload[0], payload[1:]
+	}
+	wireSize := len(head) + int(length)
+	s.counters.frameReceived(frameType, wireSize)
+	if s.observer != nil {
+		s.observer.FrameReceived(frameType, wireSize)
+	}
+	if frameType == FrameTypeData && s.compress.Load() {
+		if payload, err = decompressData(payload); err != nil {
+			return nil, err
+		}
+	}
+
+	return &Frame{Length: length, Type: frameType, Payload: payload}, nil
+}
+
+// readFramePayload reads n bytes like io.ReadFull, but grows the buffer as
+// data arrives instead of trusting the unauthenticated length up front, so
+// a forged header costs a peer the bytes it sends.
+func readFramePayload(reader io.Reader, n int) ([]byte, error) {
+	payload := make([]byte, 0, min(n, frameReadChunk))
+	for len(payload) < n {
+		if len(payload) == cap(payload) {
+			payload = slices.Grow(payload, min(cap(payload), n-len(payload)))
+		}
+		m, err := reader.Read(payload[len(payload):min(cap(payload), n)])
+		payload = payload[:len(payload)+m]
+		if err != nil && len(payload) < n {
+			if err == io.EOF && len(payload) > 0 {
+				err = io.ErrUnexpectedEOF
+			}
+			return nil, err
+		}
+	}
+	return payload, nil
+}
+
+// ReadFrames reads one frame, blocking if needed, followed by every frame
+// already complete in reader's buffer, up to limit frames in all. The caller
+// can then handle a burst of DATA at once instead of waking per frame. Frames
+// read before a failure are returned along with the error.
+func (s *Session) ReadFrames(reader *bufio.Reader, limit int) ([]*Frame, error) {
+	return s.ReadFramesInto(reader, make([]*Frame, 0, limit), limit)
+}
+
+// ReadFramesInto is ReadFrames reusing the frames slice.
+func (s *Session) ReadFramesInto(reader *bufio.Reader, frames []*Frame, limit int) ([]*Frame, error) {
+	frames = frames[:0]
+	for len(frames) == 0 || len(frames) < limit {
+		if len(frames) > 0 && !s.frameBuffered(reader) {
+			break
+		}
+		frame, err := s.ReadFrame(reader)
+		if err != nil {
+			return frames, err
+		}
+		frames = append(frames, frame)
+	}
+	return frames, nil
+}
+
+// frameBuffered reports whether the next frame can be read whole without
+// blocking.
+func (s *Session) frameBuffered(reader *bufio.Reader) bool {
+	if reader.Buffered() < s.headerSize() {
+		return false
+	}
+	header, _ := reader.Peek(2)
+	length := binary.BigEndian.Uint16(header) ^ s.lengthMask(s.readNonce)
+	return reader.Buffered() >= s.headerSize()+int(length)
+}
+
+// OutgoingFrame is a plaintext frame passed to WriteFrames.
+type OutgoingFrame struct {
+	Type    uint8
+	Payload []byte
+
+	// encoded marks a DATA payload that already carries its codec byte.
+	encoded bool
+}
+
+// WriteFrame encrypts and writes one frame.
+func (s *Session) WriteFrame(writer io.Writer, frameType uint8, data []byte) error {
+	return s.WriteFrames(writer, OutgoingFrame{Type: frameType, Payload: data})
+}
+
+// WriteFrames seals frames back to back into one pooled buffer and hands it
+// to writer in a single call, so neither the header/payload split nor the
+// frame boundaries show up as separate writes.
+func (s *Session) WriteFrames(writer io.Writer, frames ...OutgoingFrame) error {
+	if len(frames) == 0 {
+		return nil
+	}
+	if s.compress.Load() {
+		encoded := make([]OutgoingFrame, len(frames))
+		for i, f := range frames {
+			if f.Type == FrameTypeData && !f.encoded {
+				f = OutgoingFrame{Type: f.Type, Payload: compressData(f.Payload), encoded: true}
+			}
+			encoded[i] = f
+		}
+		frames = encoded
+	}
+	for _, f := range frames {
+		if s.sealedSize(len(f.Payload)) > maxFramePayloadSize {
+			return errors.New("frame too large")
+		}
+	}
+	// Credit is taken before the write turn, so control frames, window
+	// updates among them, still go out while data waits for the peer.
+	if err := s.acquireCredit(frames); err != nil {
+		return err
+	}
+
+	bp := frameBufPool.Get().(*[]byte)
+	defer func() {
+		if cap(*bp) <= maxPooledFrameBuf {
+			frameBufPool.Put(bp)
+		}
+	}()
+
+	size := 0
+	for _, f := range frames {
+		size += s.headerSize() + s.sealedSize(len(f.Payload))
+	}
+	s.writes.acquire(frames[0].Type, size)
+	defer s.writes.release()
+
+	out := (*bp)[:0]
+	for _, f := range frames {
+		out = s.appendFrame(out, f.Type, f.Payload)
+	}
+	*bp = out[:0]
+	start := time.Now()
+	if _, err := writer.Write(out); err != nil {
+		return err
+	}
+	now := time.Now()
+	s.observeWrite(now.Sub(start))
+	s.lastWrite.Store(now.UnixNano())
+	s.counters.bytesSent.Add(int64(len(out)))
+	if s.entropy != nil && s.entropy.observe(out) {
+		s.counters.lowEntropy.Add(1)
+		if s.observer != nil {
+			s.observer.LowEntropy()
+		}
+	}
+	for _, f := range frames {
+		if f.Type == FrameTypeData {
+			s.recordDataSize(len(f.Payload))
+		}
+		wireSize := s.headerSize() + s.sealedSize(len(f.Payload))
+		s.counters.frameSent(f.Type, wireSize)
+		if s.observer != nil {
+			s.observer.FrameSent(f.Type, wireSize)
+		}
+	}
+	return nil
+}
+
+// appendFrame seals one frame onto dst. The caller holds the write turn and has
+// checked the payload size.
+func (s *Session) appendFrame(dst []byte, frameType uint8, data []byte) []byte {
+	counter := s.writeNonce
+	s.writeNonce++
+	header := [3]byte{2: frameType}
+	head := header[:s.headerSize()]
+	length := s.sealedSize(len(data))
+	binary.BigEndian.PutUint16(header[:2], uint16(length))
+	var additional []byte
+	if s.authHeaders {
+		additional = head
+	}
+	dst = append(dst, head...)
+	binary.BigEndian.PutUint16(dst[len(dst)-len(head):], uint16(length)^s.lengthMask(counter))
+	if s.stream {
+		// Seal the type with the payload, in place.
+		start := len(dst)
+		dst = append(append(dst, frameType), data...)
+		return s.aead.Seal(dst[:start], makeNonce(counter), dst[start:], additional)
+	}
+	return s.aead.Seal(dst, makeNonce(counter), data, additional)
+}
+
+// frameBatch collects the frames of one morphed write. In coalescing mode
+// they go out together once coalesceLimit bytes are pending or the caller
+// flushes; otherwise each frame is written as soon as it is added.
+type frameBatch struct {
+	session  *Session
+	writer   io.Writer
+	coalesce bool
+	frames   []OutgoingFrame
+	size     int
+}
+
+func (b *frameBatch) add(f OutgoingFrame) error {
+	if !b.coalesce {
+		return b.session.WriteFrames(b.writer, f)
+	}
+	b.frames = append(b.frames, f)
+	b.size += b.session.headerSize() + b.session.sealedSize(len(f.Payload))
+	if b.size >= coalesceLimit {
+		return b.flush()
+	}
+	return nil
+}
+
+func (b *frameBatch) flush() error {
+	if len(b.frames) == 0 {
+		return nil
+	}
+	err := b.session.WriteFrames(b.writer, b.frames...)
+	b.frames = b.frames[:0]
+	b.size = 0
+	return err
+}
+
+// WriteFrameWithMorphing writes data frames with size/timing shaping.
+func (s *Session) WriteFrameWithMorphing(writer io.Writer, frameType uint8, data []byte) error {
+	profile, padding := s.Shaping()
+	if frameType != FrameTypeData || profile == nil {
+		return s.WriteFrame(writer, frameType, data)
+	}
+
+	batch := &frameBatch{session: s, writer: writer, coalesce: s.coalesce.Load()}
+	compress := s.compress.Load()
+	limit := s.maxDataPayload(compress)
+	remaining := data
+	for len(remaining) > 0 {
+		// Under congestion, chunks go out unpadded and without delays
+		// until it clears.
+		passthrough := s.congested()
+		targetSize := profile.GetPacketSize()
+		if targetSize <= 0 || passthrough {
+			targetSize = len(remaining)
+		}
+		if limit > 0 && targetSize > limit {
+			targetSize = limit
+		}
+
+		chunkSize := len(remaining)
+		if chunkSize > targetSize {
+			chunkSize = targetSize
+		}
+		chunk := OutgoingFrame{Type: FrameTypeData, Payload: remaining[:chunkSize]}
+		remaining = remaining[chunkSize:]
+		if compress {
+			// Pad around the compressed size so the wire still follows
+			// the profile.
+			chunk = OutgoingFrame{Type: FrameTypeData, Payload: compressData(chunk.Payload), encoded: true}
+			chunkSize = len(chunk.Payload)
+		}
+
+		if err := batch.add(chunk); err != nil {
+			return err
+		}
+
+		// Use control frames to coordinate peer-side shaping, and fill the
+		// rest of the chosen size with cover bytes so wire sizes follow the profile.
+		if passthrough {
+			continue
+		}
+
+		switch padding {
+		case PaddingNone:
+		case PaddingMax:
+			if maxSize := profile.maxPacketSize(); maxSize > targetSize {
+				targetSize = maxSize
+				if limit > 0 && targetSize > limit {
+					targetSize = limit
+				}
+			}
+			fallthrough
+		default:
+			payload, err := s.paddingPayload(targetSize, targetSize-chunkSize)
+			if err != nil {
+				return err
+			}
+			if err := batch.add(OutgoingFrame{Type: FrameTypePadding, Payload: payload}); err != nil {
+				return err
+			}
+		}
+		frameSize := targetSize
+		if padding == PaddingNone {
+			frameSize = chunkSize
+		}
+		busy := len(remaining) > 0 || s.pending.Load() > 0
+		delay := s.paceDelay(profile.IntervalAfter(frameSize, busy))
+		if s.observer != nil {
+			s.observer.Morphed(chunkSize, targetSize, delay)
+		}
+		if delay <= 0 {
+			continue
+		}
+		s.counters.delay.Add(int64(delay))
+		switch profile.Pacing {
+		case PacingSender:
+			if err := batch.add(OutgoingFrame{Type: FrameTypeTiming, Payload: timingPayload(delay, 0)}); err != nil {
+				return err
+			}
+			if err := batch.flush(); err != nil {
+				return err
+			}
+			time.Sleep(delay)
+		case PacingReceiver:
+			if err := batch.add(OutgoingFrame{Type: FrameTypeTiming, Payload: timingPayload(delay, timingFlagAbsorb)}); err != nil {
+				return err
+			}
+		}
+	}
+
+	return batch.flush()
+}
+
+// ClosePayload is the payload of a Close frame: a FIN when err is io.EOF,
+// otherwise a RST with code.
+func ClosePayload(err error, code byte) []byte {
+	if err == io.EOF {
+		return []byte{CloseFIN}
+	}
+	return []byte{CloseRST, code}
+}
+
+// IsReset reports whether a Close frame aborts the session.
+func IsReset(frame *Frame) bool {
+	return len(frame.Payload) > 0 && frame.Payload[0]&CloseRST != 0
+}
+
+// CloseError is a session the peer aborted with a RST.
+type CloseError struct {
+	Code byte
+}
+
+// closeError returns the error a RST frame carries.
+func closeError(frame *Frame) *CloseError {
+	e := &CloseError{Code: CloseErrorUnknown}
+	if len(frame.Payload) > 1 {
+		e.Code = frame.Payload[1]
+	}
+	return e
+}
+
+func (e *CloseError) Error() string {
+	switch e.Code {
+	case CloseErrorUpstream:
+		return "reflex session reset: upstream connection failed"
+	case CloseErrorDispatch:
+		return "reflex session reset: destination unreachable"
+	case CloseErrorShutdown:
+		return "reflex session reset: server shutting down"
+	}
+	return "reflex session reset"
+}
+
+// Unwrap maps the code to the socket error a direct connection would have
+// seen, so applications behind the client get a familiar failure.
+func (e *CloseError) Unwrap() error {
+	switch e.Code {
+	case CloseErrorUpstream, CloseErrorShutdown:
+		return syscall.ECONNRESET
+	case CloseErrorDispatch:
+		return syscall.ECONNREFUSED
+	}
+	return nil
+}
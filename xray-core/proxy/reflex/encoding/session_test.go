@@ -0,0 +1,444 @@
+package encoding
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func testKey() []byte {
+	k := make([]byte, 32)
+	for i := range k {
+		k[i] = byte(i + 1)
+	}
+	return k
+}
+
+func TestSessionWriteReadFrame(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	payload := []byte("hello reflex")
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, payload); err != nil {
+		t.Fatal(err)
+	}
+
+	frame, err := readerSession.ReadFrame(&wire)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if frame.Type != FrameTypeData {
+		t.Fatalf("unexpected frame type: %d", frame.Type)
+	}
+	if !bytes.Equal(frame.Payload, payload) {
+		t.Fatalf("payload mismatch: got=%q want=%q", frame.Payload, payload)
+	}
+}
+
+// countingWriter records the size of every Write call.
+type countingWriter struct {
+	bytes.Buffer
+	writes []int
+}
+
+func (w *countingWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, len(p))
+	return w.Buffer.Write(p)
+}
+
+func TestWriteFrameSingleWrite(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire countingWriter
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("one write")); err != nil {
+		t.Fatal(err)
+	}
+	if err := writerSession.WriteFrames(&wire,
+		OutgoingFrame{Type: FrameTypeData, Payload: []byte("a")},
+		OutgoingFrame{Type: FrameTypePadding, Payload: []byte{0, 64}},
+	); err != nil {
+		t.Fatal(err)
+	}
+	if len(wire.writes) != 2 {
+		t.Fatalf("expected one write per call, got %v", wire.writes)
+	}
+
+	for _, want := range []string{"one write", "a"} {
+		frame, err := readerSession.ReadFrame(&wire)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(frame.Payload) != want {
+			t.Fatalf("payload = %q, want %q", frame.Payload, want)
+		}
+	}
+	if frame, err := readerSession.ReadFrame(&wire); err != nil || frame.Type != FrameTypePadding {
+		t.Fatalf("expected padding frame, got %v %v", frame, err)
+	}
+
+	// An oversized frame must not consume a nonce, or the peer would desync.
+	if err := writerSession.WriteFrames(&wire,
+		OutgoingFrame{Type: FrameTypeData, Payload: []byte("x")},
+		OutgoingFrame{Type: FrameTypeData, Payload: make([]byte, maxFramePayloadSize)},
+	); err == nil {
+		t.Fatal("expected oversized frame to be rejected")
+	}
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	if frame, err := readerSession.ReadFrame(&wire); err != nil || string(frame.Payload) != "after" {
+		t.Fatalf("session desynced after rejected frame: %v %v", frame, err)
+	}
+}
+
+func TestReadFramesDrainsBufferedFrames(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	for _, p := range []string{"a", "b", "c"} {
+		if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte(p)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// A partial frame must be left for the next blocking read.
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("d")); err != nil {
+		t.Fatal(err)
+	}
+	tail := wire.Bytes()[wire.Len()-4:]
+	wire.Truncate(wire.Len() - 4)
+
+	reader := bufio.NewReader(io.MultiReader(&wire, bytes.NewReader(tail)))
+	frames, err := readerSession.ReadFrames(reader, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 {
+		t.Fatalf("expected 2 frames under the limit, got %d", len(frames))
+	}
+	rest, err := readerSession.ReadFrames(reader, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames = append(frames, rest...)
+	if len(frames) != 3 {
+		t.Fatalf("expected 3 buffered frames, got %d", len(frames))
+	}
+	for i, want := range []string{"a", "b", "c"} {
+		if string(frames[i].Payload) != want {
+			t.Fatalf("frame %d = %q, want %q", i, frames[i].Payload, want)
+		}
+	}
+	frames, err = readerSession.ReadFramesInto(reader, frames, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 1 || string(frames[0].Payload) != "d" {
+		t.Fatalf("unexpected second batch: %v", frames)
+	}
+}
+
+func TestSessionReplayDetection(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var wire bytes.Buffer
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("abc")); err != nil {
+		t.Fatal(err)
+	}
+	frameBytes := append([]byte(nil), wire.Bytes()...)
+
+	if _, err := readerSession.ReadFrame(bytes.NewReader(frameBytes)); err != nil {
+		t.Fatalf("first read failed: %v", err)
+	}
+
+	_, err = readerSession.ReadFrame(bytes.NewReader(frameBytes))
+	if err == nil {
+		t.Fatal("expected replay detection error")
+	}
+	if !strings.Contains(err.Error(), "replay") {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if st := readerSession.Stats(); st.Replays != 1 || st.FramesReceived[FrameTypeData] != 1 || st.BytesReceived != int64(len(frameBytes)) {
+		t.Fatalf("stats after a replay: %+v", st)
+	}
+}
+
+func TestSessionStatsPaddingOverhead(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	if err := s.WriteFrame(&wire, FrameTypeData, make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.SendPadding(&wire, 200, 98); err != nil {
+		t.Fatal(err)
+	}
+	st := s.Stats()
+	if st.BytesSent != int64(wire.Len()) || st.FramesSent[FrameTypeData] != 1 || st.FramesSent[FrameTypePadding] != 1 {
+		t.Fatalf("unexpected stats: %+v", st)
+	}
+	if st.PaddingOverhead != 0.5 || st.AddedDelay != 0 {
+		t.Fatalf("padding overhead %v, delay %v; want 0.5 and 0", st.PaddingOverhead, st.AddedDelay)
+	}
+}
+
+func TestAuthenticatedHeadersRejectTampering(t *testing.T) {
+	for _, version := range []uint8{ProtocolVersion2, ProtocolVersion3} {
+		writerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		readerSession, err := NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		writerSession.SetProtocolVersion(version)
+		readerSession.SetProtocolVersion(version)
+
+		var wire bytes.Buffer
+		if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("abc")); err != nil {
+			t.Fatal(err)
+		}
+		wire.Bytes()[2] = FrameTypeClose
+		frame, err := readerSession.ReadFrame(&wire)
+		if version >= ProtocolVersion3 && err == nil {
+			t.Fatalf("version %d accepted a frame whose type was rewritten", version)
+		}
+		if version < ProtocolVersion3 && (err != nil || frame.Type != FrameTypeClose) {
+			t.Fatalf("version %d should not authenticate headers: %v", version, err)
+		}
+	}
+}
+
+func TestMaskedFrameLengths(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	writerSession.SetProtocolVersion(ProtocolVersion4)
+	readerSession.SetProtocolVersion(ProtocolVersion4)
+
+	var wire bytes.Buffer
+	readable := 0
+	for i := 0; i < 8; i++ {
+		start := wire.Len()
+		if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("same size")); err != nil {
+			t.Fatal(err)
+		}
+		if int(binary.BigEndian.Uint16(wire.Bytes()[start:])) == wire.Len()-start-3 {
+			readable++
+		}
+	}
+	if readable > 1 {
+		t.Fatalf("%d of 8 frame lengths readable on the wire", readable)
+	}
+
+	frames, err := readerSession.ReadFrames(bufio.NewReader(&wire), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 8 {
+		t.Fatalf("batch read %d of 8 masked frames", len(frames))
+	}
+	for _, f := range frames {
+		if string(f.Payload) != "same size" {
+			t.Fatalf("unexpected payload %q", f.Payload)
+		}
+	}
+}
+
+func TestStreamModeHidesFrameTypes(t *testing.T) {
+	writerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	readerSession, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []*Session{writerSession, readerSession} {
+		s.SetProtocolVersion(ProtocolVersion3)
+		s.SetStreamMode(true)
+	}
+
+	var wire bytes.Buffer
+	types := []uint8{FrameTypeData, FrameTypePadding, FrameTypeData, FrameTypeTiming, FrameTypeClose}
+	for i, typ := range types {
+		start := wire.Len()
+		if err := writerSession.WriteFrame(&wire, typ, []byte{byte(i)}); err != nil {
+			t.Fatal(err)
+		}
+		if got := wire.Len() - start; got != 3+1+writerSession.aead.Overhead() {
+			t.Fatalf("record %d is %d bytes on the wire", i, got)
+		}
+	}
+	frames, err := readerSession.ReadFrames(bufio.NewReader(&wire), 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != len(types) {
+		t.Fatalf("read %d of %d records", len(frames), len(types))
+	}
+	for i, f := range frames {
+		if f.Type != types[i] || !bytes.Equal(f.Payload, []byte{byte(i)}) {
+			t.Fatalf("record %d read as type %d payload %v", i, f.Type, f.Payload)
+		}
+	}
+
+	// A frame-mode peer can't make sense of the records.
+	var record bytes.Buffer
+	if err := writerSession.WriteFrame(&record, FrameTypeData, []byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	framed, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	framed.readNonce = writerSession.writeNonce - 1
+	if _, err := framed.ReadFrame(&record); err == nil {
+		t.Fatal("stream record read as a frame")
+	}
+
+	// The sealed type counts against the largest record: the payload that
+	// just fits a frame would wrap the length field.
+	largest := maxFramePayloadSize - writerSession.aead.Overhead()
+	if err := writerSession.WriteFrame(io.Discard, FrameTypeData, make([]byte, largest)); err == nil {
+		t.Fatal("record with a wrapped length written")
+	}
+	wire.Reset()
+	if err := writerSession.WriteFrame(&wire, FrameTypeData, make([]byte, largest-1)); err != nil {
+		t.Fatal(err)
+	}
+	readerSession.readNonce = writerSession.writeNonce - 1
+	if f, err := readerSession.ReadFrame(&wire); err != nil || len(f.Payload) != largest-1 {
+		t.Fatalf("largest record read back with %v", err)
+	}
+}
+
+func TestEmptyData(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	if err := s.WriteFrame(&wire, FrameTypeData, []byte{}); err != nil {
+		t.Fatalf("empty payload should not crash: %v", err)
+	}
+}
+
+func TestLargeData(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wire bytes.Buffer
+	large := make([]byte, 10*1024*1024)
+	if err := s.WriteFrame(&wire, FrameTypeData, large); err == nil {
+		t.Fatal("expected oversized frame error")
+	}
+}
+
+func TestClosedConnection(t *testing.T) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c1, c2 := net.Pipe()
+	_ = c2.Close()
+	if err := s.WriteFrame(c1, FrameTypeData, []byte("test")); err == nil {
+		t.Fatal("expected write error on closed connection")
+	}
+	_ = c1.Close()
+}
+
+func BenchmarkEncryption(b *testing.B) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1024)
+	var wire bytes.Buffer
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wire.Reset()
+		if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkEncryptionSizes(b *testing.B) {
+	sizes := []int{64, 256, 1024, 4096, 16384}
+	for _, size := range sizes {
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			s, err := NewSession(testKey())
+			if err != nil {
+				b.Fatal(err)
+			}
+			data := make([]byte, size)
+			var wire bytes.Buffer
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				wire.Reset()
+				if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkMemoryAllocation(b *testing.B) {
+	s, err := NewSession(testKey())
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := make([]byte, 1024)
+	var wire bytes.Buffer
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		wire.Reset()
+		if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,133 @@
+package encoding
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// frameTypeNames names the frame types, indexed by type.
+var frameTypeNames = [...]string{
+	FrameTypeData:               "data",
+	FrameTypePadding:            "padding",
+	FrameTypeTiming:             "timing",
+	FrameTypeClose:              "close",
+	FrameTypePolicyUpdate:       "policy_update",
+	FrameTypeWindowUpdate:       "window_update",
+	FrameTypePing:               "ping",
+	FrameTypePolicyContinuation: "policy_continuation",
+}
+
+// FrameTypeCount bounds the frame types SessionStats counts.
+const FrameTypeCount = len(frameTypeNames)
+
+// FrameTypeName is the lower-case name of frame type t, as in counter names,
+// or "" for a type this version doesn't know.
+func FrameTypeName(t uint8) string {
+	if int(t) < FrameTypeCount {
+		return frameTypeNames[t]
+	}
+	return ""
+}
+
+// SessionStats is a snapshot of a session's counters. Frame counts are
+// indexed by frame type; wire sizes include headers and AEAD overhead.
+type SessionStats struct {
+	FramesSent     [FrameTypeCount]int64
+	FramesReceived [FrameTypeCount]int64
+	BytesSent      int64
+	BytesReceived  int64
+	// Replays counts received frames dropped as replayed ciphertext.
+	Replays int64
+	// PaddingOverhead is the share of the bytes sent that went to PADDING
+	// frames, from 0 to 1.
+	PaddingOverhead float64
+	// AddedDelay is the pacing delay morphing added per DATA frame sent,
+	// on average.
+	AddedDelay time.Duration
+	// LowEntropyWindows counts windows of written bytes the entropy
+	// monitor found not to look encrypted; always 0 without the monitor.
+	LowEntropyWindows int64
+}
+
+// Observer is told what a session does as it happens, for the counters and
+// logs a server keeps across sessions. Its methods are called from the
+// session's reading and writing goroutines and must not block.
+type Observer interface {
+	// FrameSent and FrameReceived report one sealed frame of wireSize
+	// bytes.
+	FrameSent(frameType uint8, wireSize int)
+	FrameReceived(frameType uint8, wireSize int)
+	// Morphed reports how a chunk of data was shaped and how long the
+	// next write waits.
+	Morphed(chunk, target int, delay time.Duration)
+	// Passthrough reports that congestion paused morphing, and why.
+	Passthrough(reason string)
+	// LowEntropy reports a window of written bytes that did not look
+	// encrypted.
+	LowEntropy()
+	// RTT reports the smoothed heartbeat round trip time.
+	RTT(srtt time.Duration)
+	// SizeDistance reports the KS distance between the DATA sizes recently
+	// sent and the downlink profile.
+	SizeDistance(d float64)
+	// Queued moves the count of bytes waiting in the morph pipeline by
+	// delta.
+	Queued(delta int)
+}
+
+// SetObserver makes o observe the session. Call it before the first frame.
+func (s *Session) SetObserver(o Observer) {
+	s.observer = o
+}
+
+// sessionCounters are the counters behind Session.Stats. Unlike metrics,
+// they are kept for every session.
+type sessionCounters struct {
+	framesSent     [FrameTypeCount]atomic.Int64
+	framesReceived [FrameTypeCount]atomic.Int64
+	// bytesSent and bytesReceived count frames on the wire.
+	bytesSent     atomic.Int64
+	bytesReceived atomic.Int64
+	replays       atomic.Int64
+	paddingBytes  atomic.Int64
+	// delay is the sum of pacing delays, in nanoseconds.
+	delay      atomic.Int64
+	lowEntropy atomic.Int64
+}
+
+func (c *sessionCounters) frameSent(frameType uint8, wireSize int) {
+	if int(frameType) < len(c.framesSent) {
+		c.framesSent[frameType].Add(1)
+	}
+	if frameType == FrameTypePadding {
+		c.paddingBytes.Add(int64(wireSize))
+	}
+}
+
+func (c *sessionCounters) frameReceived(frameType uint8, wireSize int) {
+	if int(frameType) < len(c.framesReceived) {
+		c.framesReceived[frameType].Add(1)
+	}
+	c.bytesReceived.Add(int64(wireSize))
+}
+
+// Stats snapshots the session's counters.
+func (s *Session) Stats() SessionStats {
+	c := &s.counters
+	var st SessionStats
+	for i := range st.FramesSent {
+		st.FramesSent[i] = c.framesSent[i].Load()
+		st.FramesReceived[i] = c.framesReceived[i].Load()
+	}
+	st.BytesSent = c.bytesSent.Load()
+	st.BytesReceived = c.bytesReceived.Load()
+	st.Replays = c.replays.Load()
+	st.LowEntropyWindows = c.lowEntropy.Load()
+	if st.BytesSent > 0 {
+		st.PaddingOverhead = float64(c.paddingBytes.Load()) / float64(st.BytesSent)
+	}
+	if data := st.FramesSent[FrameTypeData]; data > 0 {
+		st.AddedDelay = time.Duration(c.delay.Load() / data)
+	}
+	return st
+}
@@ -0,0 +1,280 @@
+package encoding
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// DistanceMetric selects how two samples are compared.
+type DistanceMetric int
+
+const (
+	// MetricKS is the two-sample Kolmogorov-Smirnov D statistic.
+	MetricKS DistanceMetric = iota
+	// MetricChiSquare is the two-sample chi-square statistic over shared bins.
+	MetricChiSquare
+	// MetricJensenShannon is the Jensen-Shannon divergence in bits, in [0, 1].
+	MetricJensenShannon
+	// MetricAndersonDarling is the two-sample Anderson-Darling statistic,
+	// which weighs the tails more heavily than KS.
+	MetricAndersonDarling
+)
+
+var metricNames = map[string]DistanceMetric{
+	"ks":   MetricKS,
+	"chi2": MetricChiSquare,
+	"js":   MetricJensenShannon,
+	"ad":   MetricAndersonDarling,
+}
+
+// maxHistogramBins caps the number of bins used by the binned metrics.
+const maxHistogramBins = 64
+
+// ParseDistanceMetric maps "ks", "chi2", "js" or "ad" to a metric.
+func ParseDistanceMetric(name string) (DistanceMetric, error) {
+	m, ok := metricNames[strings.ToLower(name)]
+	if !ok {
+		return 0, errors.New("unknown distance metric ", name)
+	}
+	return m, nil
+}
+
+// Distance compares samples a and b with metric. Lower is closer for all
+// metrics.
+func Distance(metric DistanceMetric, a, b []float64) float64 {
+	switch metric {
+	case MetricChiSquare:
+		return ChiSquareStatistic(a, b)
+	case MetricJensenShannon:
+		return JensenShannonDivergence(a, b)
+	case MetricAndersonDarling:
+		return AndersonDarlingStatistic(a, b)
+	default:
+		return KolmogorovSmirnovStatistic(a, b)
+	}
+}
+
+// KolmogorovSmirnovStatistic returns the two-sample KS D statistic.
+func KolmogorovSmirnovStatistic(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 1.0
+	}
+	aa := append([]float64(nil), a...)
+	bb := append([]float64(nil), b...)
+	sort.Float64s(aa)
+	sort.Float64s(bb)
+
+	// Step over runs of equal values together, so ties between the samples
+	// do not open a gap that isn't there.
+	i, j := 0, 0
+	var d float64
+	for i < len(aa) && j < len(bb) {
+		v := math.Min(aa[i], bb[j])
+		for i < len(aa) && aa[i] == v {
+			i++
+		}
+		for j < len(bb) && bb[j] == v {
+			j++
+		}
+		d = math.Max(d, math.Abs(float64(i)/float64(len(aa))-float64(j)/float64(len(bb))))
+	}
+	// Once one sample is used up the gap only shrinks.
+	return d
+}
+
+// histograms bins a and b over shared bins: one per distinct value when there
+// are few of them, as with packet sizes, and equal-width bins otherwise.
+func histograms(a, b []float64) ([]float64, []float64) {
+	distinct := map[float64]int{}
+	for _, v := range a {
+		distinct[v] = 0
+	}
+	for _, v := range b {
+		distinct[v] = 0
+	}
+	if len(distinct) <= maxHistogramBins {
+		keys := make([]float64, 0, len(distinct))
+		for v := range distinct {
+			keys = append(keys, v)
+		}
+		sort.Float64s(keys)
+		for i, v := range keys {
+			distinct[v] = i
+		}
+		ha, hb := make([]float64, len(keys)), make([]float64, len(keys))
+		for _, v := range a {
+			ha[distinct[v]]++
+		}
+		for _, v := range b {
+			hb[distinct[v]]++
+		}
+		return ha, hb
+	}
+
+	lo, hi := math.Inf(1), math.Inf(-1)
+	for _, v := range append(append([]float64(nil), a...), b...) {
+		lo = math.Min(lo, v)
+		hi = math.Max(hi, v)
+	}
+	bins := int(math.Sqrt(float64(len(a) + len(b))))
+	if bins > maxHistogramBins {
+		bins = maxHistogramBins
+	}
+	if bins < 2 {
+		bins = 2
+	}
+	width := (hi - lo) / float64(bins)
+	bin := func(v float64) int {
+		i := int((v - lo) / width)
+		if i >= bins {
+			i = bins - 1
+		}
+		return i
+	}
+	ha, hb := make([]float64, bins), make([]float64, bins)
+	for _, v := range a {
+		ha[bin(v)]++
+	}
+	for _, v := range b {
+		hb[bin(v)]++
+	}
+	return ha, hb
+}
+
+// ChiSquareStatistic returns the two-sample chi-square statistic for samples
+// of possibly different sizes.
+func ChiSquareStatistic(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.Inf(1)
+	}
+	ha, hb := histograms(a, b)
+	ka := math.Sqrt(float64(len(b)) / float64(len(a)))
+	kb := math.Sqrt(float64(len(a)) / float64(len(b)))
+	var chi float64
+	for i := range ha {
+		if ha[i]+hb[i] == 0 {
+			continue
+		}
+		d := ka*ha[i] - kb*hb[i]
+		chi += d * d / (ha[i] + hb[i])
+	}
+	return chi
+}
+
+// JensenShannonDivergence returns the base-2 JS divergence of the binned
+// samples, from 0 for identical histograms to 1 for disjoint ones.
+func JensenShannonDivergence(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return 1.0
+	}
+	ha, hb := histograms(a, b)
+	var js float64
+	for i := range ha {
+		p := ha[i] / float64(len(a))
+		q := hb[i] / float64(len(b))
+		m := (p + q) / 2
+		if p > 0 {
+			js += p * math.Log2(p/m) / 2
+		}
+		if q > 0 {
+			js += q * math.Log2(q/m) / 2
+		}
+	}
+	return js
+}
+
+// AndersonDarlingStatistic returns the two-sample Anderson-Darling statistic
+// A²akN of Scholz and Stephens, which handles tied values via midranks.
+func AndersonDarlingStatistic(a, b []float64) float64 {
+	if len(a) == 0 || len(b) == 0 {
+		return math.Inf(1)
+	}
+	samples := [][]float64{append([]float64(nil), a...), append([]float64(nil), b...)}
+	pooled := append(append([]float64(nil), a...), b...)
+	sort.Float64s(pooled)
+	for _, s := range samples {
+		sort.Float64s(s)
+	}
+	n := float64(len(pooled))
+
+	var ad float64
+	for _, s := range samples {
+		ni := float64(len(s))
+		var sum, below, belowPooled float64
+		si, pj := 0, 0
+		for pj < len(pooled) {
+			z := pooled[pj]
+			var l, f float64
+			for pj < len(pooled) && pooled[pj] == z {
+				l++
+				pj++
+			}
+			for si < len(s) && s[si] == z {
+				f++
+				si++
+			}
+			m := below + f/2
+			bj := belowPooled + l/2
+			denom := bj*(n-bj) - n*l/4
+			if denom > 0 {
+				d := n*m - ni*bj
+				sum += l * d * d / denom
+			}
+			below += f
+			belowPooled += l
+		}
+		ad += sum / ni
+	}
+	return ad * (n - 1) / (n * n)
+}
+
+// SizeSamples expands the packet-size distribution into about n values in
+// proportion to the bucket weights, for comparison against observations.
+func (p *TrafficProfile) SizeSamples(n int) []float64 {
+	weights := make([]float64, len(p.PacketSizes))
+	values := make([]float64, len(p.PacketSizes))
+	for i, d := range p.PacketSizes {
+		weights[i], values[i] = d.Weight, float64(d.Size)
+	}
+	return expandWeights(values, weights, n)
+}
+
+// DelaySamples expands the delay distribution into about n values, in
+// milliseconds.
+func (p *TrafficProfile) DelaySamples(n int) []float64 {
+	weights := make([]float64, len(p.Delays))
+	values := make([]float64, len(p.Delays))
+	for i, d := range p.Delays {
+		weights[i], values[i] = d.Weight, float64(d.Delay)/float64(time.Millisecond)
+	}
+	return expandWeights(values, weights, n)
+}
+
+func expandWeights(values, weights []float64, n int) []float64 {
+	total := 0.0
+	for _, w := range weights {
+		total += w
+	}
+	if total <= 0 {
+		return nil
+	}
+	var out []float64
+	for i, v := range values {
+		for c := int(math.Round(weights[i] / total * float64(n))); c > 0; c-- {
+			out = append(out, v)
+		}
+	}
+	return out
+}
+
+// ScoreProfile compares observed packet sizes and delays (in milliseconds)
+// with profile p using metric, returning one distance for each.
+func ScoreProfile(p *TrafficProfile, sizes, delaysMs []float64, metric DistanceMetric) (sizeDistance, delayDistance float64) {
+	sizeDistance = Distance(metric, sizes, p.SizeSamples(max(len(sizes), 1000)))
+	delayDistance = Distance(metric, delaysMs, p.DelaySamples(max(len(delaysMs), 1000)))
+	return sizeDistance, delayDistance
+}
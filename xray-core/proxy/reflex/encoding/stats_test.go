@@ -0,0 +1,82 @@
+package encoding
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKolmogorovSmirnovStatistic(t *testing.T) {
+	a := []float64{1, 2, 3, 4, 5, 6, 7, 8}
+	b := []float64{1.1, 2.1, 3.0, 4.2, 5.1, 6.2, 7.3, 8.1}
+	c := []float64{100, 110, 120, 130, 140, 150, 160, 170}
+
+	dClose := KolmogorovSmirnovStatistic(a, b)
+	dFar := KolmogorovSmirnovStatistic(a, c)
+	if !(dClose < dFar) {
+		t.Fatalf("expected close distributions to have lower D: close=%f far=%f", dClose, dFar)
+	}
+}
+
+func TestDistanceMetricsOrderSamples(t *testing.T) {
+	a := []float64{500, 600, 600, 700, 700, 700, 800, 900}
+	b := []float64{500, 600, 700, 700, 700, 800, 800, 900}
+	c := []float64{1400, 1400, 1400, 1300, 1300, 1200, 1200, 1500}
+
+	for name, metric := range metricNames {
+		dClose := Distance(metric, a, b)
+		dFar := Distance(metric, a, c)
+		if !(dClose < dFar) {
+			t.Fatalf("%s: expected close samples to score lower: close=%f far=%f", name, dClose, dFar)
+		}
+	}
+
+	if d := JensenShannonDivergence(a, a); d != 0 {
+		t.Fatalf("identical samples should have zero JS divergence, got %f", d)
+	}
+	if d := JensenShannonDivergence(a, c); math.Abs(d-1) > 1e-9 {
+		t.Fatalf("disjoint samples should have JS divergence 1, got %f", d)
+	}
+	if d := ChiSquareStatistic(a, a); d != 0 {
+		t.Fatalf("identical samples should have zero chi-square, got %f", d)
+	}
+}
+
+func TestDistanceMetricsContinuousSamples(t *testing.T) {
+	var a, b, c []float64
+	for i := 0; i < 200; i++ {
+		a = append(a, float64(i))
+		b = append(b, float64(i)+0.5)
+		c = append(c, float64(i)*3+100)
+	}
+	for name, metric := range metricNames {
+		if !(Distance(metric, a, b) < Distance(metric, a, c)) {
+			t.Fatalf("%s: binned comparison misordered continuous samples", name)
+		}
+	}
+}
+
+func TestParseDistanceMetric(t *testing.T) {
+	if m, err := ParseDistanceMetric("AD"); err != nil || m != MetricAndersonDarling {
+		t.Fatalf("unexpected metric %v, %v", m, err)
+	}
+	if _, err := ParseDistanceMetric("wasserstein"); err == nil {
+		t.Fatal("expected unknown metric to fail")
+	}
+}
+
+func TestScoreProfile(t *testing.T) {
+	p := cloneProfile(Profiles["zoom"])
+	own := p.SizeSamples(100)
+	if len(own) != 100 {
+		t.Fatalf("unexpected sample count: %d", len(own))
+	}
+	delays := p.DelaySamples(100)
+	sizeClose, delayClose := ScoreProfile(p, own, delays, MetricJensenShannon)
+	sizeFar, _ := ScoreProfile(p, Profiles["youtube"].SizeSamples(100), delays, MetricJensenShannon)
+	if sizeClose > 0.01 || delayClose > 0.01 {
+		t.Fatalf("profile should match its own samples: size=%f delay=%f", sizeClose, delayClose)
+	}
+	if !(sizeFar > sizeClose) {
+		t.Fatalf("foreign sizes should score worse: %f <= %f", sizeFar, sizeClose)
+	}
+}
@@ -0,0 +1,96 @@
+package encoding
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// wsConn carries a Reflex byte stream in binary WebSocket messages.
+type wsConn struct {
+	*websocket.Conn
+	reader  io.Reader
+	writeMu sync.Mutex
+}
+
+// NewWebSocketConn carries a byte stream in the binary messages of c.
+func NewWebSocketConn(c *websocket.Conn) net.Conn {
+	return &wsConn{Conn: c}
+}
+
+func (c *wsConn) Read(b []byte) (int, error) {
+	for {
+		if c.reader == nil {
+			mt, r, err := c.NextReader()
+			if err != nil {
+				if websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+					return 0, io.EOF
+				}
+				return 0, err
+			}
+			if mt != websocket.BinaryMessage {
+				continue
+			}
+			c.reader = r
+		}
+		n, err := c.reader.Read(b)
+		if err == io.EOF {
+			c.reader = nil
+			if n > 0 {
+				return n, nil
+			}
+			continue
+		}
+		return n, err
+	}
+}
+
+// Write sends b as one binary message, so each Reflex write stays a single
+// WebSocket frame.
+func (c *wsConn) Write(b []byte) (int, error) {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if err := c.WriteMessage(websocket.BinaryMessage, b); err != nil {
+		return 0, err
+	}
+	return len(b), nil
+}
+
+func (c *wsConn) SetDeadline(t time.Time) error {
+	if err := c.SetReadDeadline(t); err != nil {
+		return err
+	}
+	return c.SetWriteDeadline(t)
+}
+
+// DialWebSocket upgrades an established connection to a WebSocket on path,
+// for Reflex sessions that must traverse CDNs, sending header with the
+// upgrade request. Any TLS is expected to be applied to conn by the
+// transport already.
+func DialWebSocket(ctx context.Context, conn net.Conn, host, path string, header http.Header) (net.Conn, error) {
+	dialer := &websocket.Dialer{
+		NetDialContext: func(context.Context, string, string) (net.Conn, error) {
+			return conn, nil
+		},
+		HandshakeTimeout: handshakeSkew,
+	}
+	ws, resp, err := dialer.DialContext(ctx, "ws://"+host+path, header)
+	if err != nil {
+		if resp != nil {
+			resp.Body.Close()
+			if resp.StatusCode != http.StatusSwitchingProtocols {
+				err = rejected(resp)
+			}
+		}
+		return nil, errors.New("reflex websocket upgrade failed").Base(err)
+	}
+	resp.Body.Close()
+	return NewWebSocketConn(ws), nil
+}
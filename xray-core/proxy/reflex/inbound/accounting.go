@@ -0,0 +1,234 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+const defaultTrafficFlushInterval = time.Minute
+
+// userTraffic counts one user's payload bytes. Sessions add to it as they
+// forward data; a nil *userTraffic counts nothing.
+type userTraffic struct {
+	uplink   atomic.Int64
+	downlink atomic.Int64
+	// quota is the user's Quota, stored by each session that starts.
+	quota atomic.Uint64
+	// since is guarded by the ledger's mu.
+	since time.Time
+}
+
+// addUplink counts n bytes from the user and reports whether they are now
+// over their quota.
+func (u *userTraffic) addUplink(n int) bool {
+	if u == nil {
+		return false
+	}
+	u.uplink.Add(int64(n))
+	return u.exceeded()
+}
+
+// addDownlink counts n bytes to the user and reports whether they are now
+// over their quota.
+func (u *userTraffic) addDownlink(n int) bool {
+	if u == nil {
+		return false
+	}
+	u.downlink.Add(int64(n))
+	return u.exceeded()
+}
+
+// used returns the bytes counted in both directions.
+func (u *userTraffic) used() uint64 {
+	if u == nil {
+		return 0
+	}
+	return uint64(u.uplink.Load() + u.downlink.Load())
+}
+
+// exceeded reports whether the user has a quota and went past it. Using
+// exactly the quota only stops new handshakes, so the bytes that reach it
+// are still delivered.
+func (u *userTraffic) exceeded() bool {
+	q := u.quota.Load()
+	return q > 0 && u.used() > q
+}
+
+// trafficRecord is a user's entry in the accounting file.
+type trafficRecord struct {
+	Uplink   int64     `json:"uplink"`
+	Downlink int64     `json:"downlink"`
+	Since    time.Time `json:"since"`
+}
+
+// trafficLedger keeps per-user traffic totals by email and writes them to
+// a JSON file periodically, so they survive restarts.
+type trafficLedger struct {
+	path string
+
+	mu    sync.Mutex
+	users map[string]*userTraffic
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newTrafficLedger loads the totals in the configured file, if any, and
+// starts flushing them. It returns nil when accounting is off.
+func newTrafficLedger(config *reflex.TrafficAccounting) (*trafficLedger, error) {
+	if config.GetFile() == "" {
+		return nil, nil
+	}
+	l := &trafficLedger{
+		path:  config.GetFile(),
+		users: make(map[string]*userTraffic),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	data, err := os.ReadFile(l.path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, errors.New("failed to read reflex traffic file ", l.path).Base(err)
+	}
+	if len(data) > 0 {
+		var records map[string]trafficRecord
+		if err := json.Unmarshal(data, &records); err != nil {
+			return nil, errors.New("invalid reflex traffic file ", l.path).Base(err)
+		}
+		for email, r := range records {
+			u := &userTraffic{since: r.Since}
+			u.uplink.Store(r.Uplink)
+			u.downlink.Store(r.Downlink)
+			l.users[email] = u
+		}
+	}
+	interval := time.Duration(config.GetFlushInterval()) * time.Second
+	if interval == 0 {
+		interval = defaultTrafficFlushInterval
+	}
+	go l.run(interval)
+	return l, nil
+}
+
+func (l *trafficLedger) run(interval time.Duration) {
+	defer close(l.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := l.flush(); err != nil {
+				errors.LogWarningInner(context.Background(), err, "failed to save reflex traffic")
+			}
+		case <-l.stop:
+			return
+		}
+	}
+}
+
+// user returns the counters of email, starting them if it has none.
+func (l *trafficLedger) user(email string) *userTraffic {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	u := l.users[email]
+	if u == nil {
+		u = &userTraffic{since: time.Now().UTC()}
+		l.users[email] = u
+	}
+	return u
+}
+
+// totals returns the traffic of email, or of every user if email is empty,
+// sorted by email. With reset, the counters restart from zero.
+func (l *trafficLedger) totals(email string, reset bool) []reflex.UserTraffic {
+	if l == nil {
+		return nil
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := time.Now().UTC()
+	var traffic []reflex.UserTraffic
+	for e, u := range l.users {
+		if email != "" && e != email {
+			continue
+		}
+		t := reflex.UserTraffic{Email: e, Since: u.since}
+		if reset {
+			t.Uplink, t.Downlink = u.uplink.Swap(0), u.downlink.Swap(0)
+			u.since = now
+		} else {
+			t.Uplink, t.Downlink = u.uplink.Load(), u.downlink.Load()
+		}
+		traffic = append(traffic, t)
+	}
+	sort.Slice(traffic, func(i, j int) bool { return traffic[i].Email < traffic[j].Email })
+	return traffic
+}
+
+// flush replaces the file with the current totals.
+func (l *trafficLedger) flush() error {
+	l.mu.Lock()
+	records := make(map[string]trafficRecord, len(l.users))
+	for email, u := range l.users {
+		records[email] = trafficRecord{Uplink: u.uplink.Load(), Downlink: u.downlink.Load(), Since: u.since}
+	}
+	l.mu.Unlock()
+	data, err := json.MarshalIndent(records, "", "  ")
+	if err != nil {
+		return err
+	}
+	// Writing a temporary file and renaming it keeps the old totals intact
+	// if the process dies halfway.
+	f, err := os.CreateTemp(filepath.Dir(l.path), filepath.Base(l.path)+".*")
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), l.path)
+}
+
+// Close stops the periodic flush and saves the totals one last time.
+func (l *trafficLedger) Close() error {
+	if l == nil {
+		return nil
+	}
+	close(l.stop)
+	<-l.done
+	return l.flush()
+}
+
+// Traffic implements reflex.TrafficAccountant.
+func (h *Handler) Traffic(email string) []reflex.UserTraffic {
+	return h.traffic.totals(email, false)
+}
+
+// ResetTraffic implements reflex.TrafficAccountant. The reset is saved
+// right away.
+func (h *Handler) ResetTraffic(email string) []reflex.UserTraffic {
+	traffic := h.traffic.totals(email, true)
+	if h.traffic != nil {
+		if err := h.traffic.flush(); err != nil {
+			errors.LogWarningInner(context.Background(), err, "failed to save reflex traffic")
+		}
+	}
+	return traffic
+}
@@ -0,0 +1,188 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/pipe"
+)
+
+func TestTrafficAccountingPersistsAndResets(t *testing.T) {
+	id := uuid.New()
+	config := &reflex.InboundConfig{
+		Clients:           []*reflex.User{{Id: id.String(), Email: "billed@example.com"}},
+		TrafficAccounting: &reflex.TrafficAccounting{File: filepath.Join(t.TempDir(), "traffic.json")},
+	}
+	in, err := New(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+
+	serverConn, clientConn := net.Pipe()
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+	clientConfig := &encoding.ClientConfig{}
+	copy(clientConfig.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "metered")
+	c.Close()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		traffic := h.Traffic("billed@example.com")
+		if len(traffic) == 1 && traffic[0].Uplink == 7 && traffic[0].Downlink == 7 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("unexpected traffic: %+v", traffic)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	in, err = New(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h = in.(*Handler)
+	defer h.Close()
+	if traffic := h.ResetTraffic(""); len(traffic) != 1 || traffic[0].Uplink != 7 {
+		t.Fatalf("totals not restored: %+v", traffic)
+	}
+	if traffic := h.Traffic(""); len(traffic) != 1 || traffic[0].Uplink != 0 || traffic[0].Downlink != 0 {
+		t.Fatalf("totals not reset: %+v", traffic)
+	}
+}
+
+func TestHandshakeEnforcesExpiryAndQuota(t *testing.T) {
+	expired, quota := uuid.New(), uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{
+			{Id: expired.String(), Email: "expired@example.com", ExpiresAt: time.Now().Add(-time.Minute).Unix()},
+			{Id: quota.String(), Email: "quota@example.com", Quota: 10},
+		},
+		TrafficAccounting: &reflex.TrafficAccounting{File: filepath.Join(t.TempDir(), "traffic.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	connect := func(id uuid.UUID) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	if _, err := connect(expired); err == nil {
+		t.Fatal("expired user accepted")
+	}
+	c, err := connect(quota)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "spent")
+	c.Close()
+	deadline := time.Now().Add(2 * time.Second)
+	for h.traffic.user("quota@example.com").used() < 10 {
+		if time.Now().After(deadline) {
+			t.Fatal("traffic not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if _, err := connect(quota); err == nil {
+		t.Fatal("user over quota accepted")
+	}
+	h.ResetTraffic("quota@example.com")
+	if c, err = connect(quota); err != nil {
+		t.Fatalf("quota not renewed by a reset: %v", err)
+	}
+	c.Close()
+
+	if _, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: quota.String(), Quota: 10}},
+	}); err == nil {
+		t.Fatal("quota accepted without traffic accounting")
+	}
+}
+
+func TestLiveSessionsEndAtQuotaAndExpiry(t *testing.T) {
+	quota, expiring := uuid.New(), uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{
+			{Id: quota.String(), Email: "quota@example.com", Quota: 20},
+			{Id: expiring.String(), Email: "expiring@example.com", ExpiresAt: time.Now().Add(2 * time.Second).Unix()},
+		},
+		TrafficAccounting: &reflex.TrafficAccounting{File: filepath.Join(t.TempDir(), "traffic.json")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	connect := func(id uuid.UUID) *encoding.ClientConn {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	waitSessions := func(email string, n int) {
+		t.Helper()
+		deadline := time.Now().Add(5 * time.Second)
+		for len(h.Sessions(email)) != n {
+			if time.Now().After(deadline) {
+				t.Fatalf("%d live sessions of %s, want %d", len(h.Sessions(email)), email, n)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+
+	// Reaching the quota exactly leaves the sessions running.
+	c := connect(quota)
+	waitSessions("quota@example.com", 1)
+	assertEcho(t, connect(quota), "ten bytes!")
+	deadline := time.Now().Add(5 * time.Second)
+	for h.traffic.user("quota@example.com").used() < 20 {
+		if time.Now().After(deadline) {
+			t.Fatal("traffic not counted")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	waitSessions("quota@example.com", 2)
+	// Going past it on one session ends the other as well.
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	go c.CopyFrom(up)
+	if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes([]byte("more"))}); err != nil {
+		t.Fatal(err)
+	}
+	waitSessions("quota@example.com", 0)
+
+	connect(expiring)
+	waitSessions("expiring@example.com", 1)
+	waitSessions("expiring@example.com", 0)
+}
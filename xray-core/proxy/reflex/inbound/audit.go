@@ -0,0 +1,132 @@
+package inbound
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"sync"
+	"time"
+
+	c "github.com/xtls/xray-core/common/ctx"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/log"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// auditRecord is one line of the audit log.
+type auditRecord struct {
+	Time    time.Time `json:"time"`
+	Event   string    `json:"event"`
+	Session uint32    `json:"session,omitempty"`
+	Source  string    `json:"source,omitempty"`
+	Email   string    `json:"email,omitempty"`
+	// UserID is the account ID of an accepted user, or the UUID a legacy
+	// client claimed. Versioned clients only send a token, which names no
+	// one until it matches.
+	UserID string `json:"user_id,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+// auditLog records handshake outcomes for tooling that bans abusive
+// sources. A nil *auditLog records nothing.
+type auditLog struct {
+	access bool
+
+	mu   sync.Mutex
+	file *os.File
+}
+
+// newAuditLog opens the audit file at path, if any. It returns nil when
+// nothing is to be audited.
+func newAuditLog(path string, access bool) (*auditLog, error) {
+	if path == "" && !access {
+		return nil, nil
+	}
+	a := &auditLog{access: access}
+	if path != "" {
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+		if err != nil {
+			return nil, errors.New("failed to open reflex audit log ", path).Base(err)
+		}
+		a.file = f
+	}
+	return a, nil
+}
+
+// record writes r, stamped with the time and the session ID and source of
+// ctx.
+func (a *auditLog) record(ctx context.Context, r auditRecord) {
+	if a == nil {
+		return
+	}
+	r.Time = time.Now().UTC()
+	r.Session = uint32(c.IDFromContext(ctx))
+	var from interface{}
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.Address != nil {
+		r.Source = inbound.Source.NetAddr()
+		from = inbound.Source
+	}
+
+	if a.access {
+		msg := &log.AccessMessage{
+			From:   from,
+			To:     "reflex handshake",
+			Status: log.AccessAccepted,
+			Email:  r.Email,
+		}
+		if r.Event == "rejected" {
+			msg.Status = log.AccessRejected
+			msg.Reason = r.Reason
+		}
+		log.Record(msg)
+	}
+	if a.file == nil {
+		return
+	}
+	line, err := json.Marshal(r)
+	if err != nil {
+		return
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if _, err := a.file.Write(append(line, '\n')); err != nil {
+		errors.LogWarningInner(ctx, err, "failed to write reflex audit record")
+	}
+}
+
+func (a *auditLog) Close() error {
+	if a == nil || a.file == nil {
+		return nil
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.file.Close()
+}
+
+// auditAccepted records that user completed a handshake.
+func (h *Handler) auditAccepted(ctx context.Context, user *protocol.MemoryUser) {
+	r := auditRecord{Event: "accepted"}
+	if user != nil {
+		r.Email = user.Email
+		if account, ok := user.Account.(*reflex.MemoryAccount); ok {
+			r.UserID = account.ID
+		}
+	}
+	h.audit.record(ctx, r)
+}
+
+// auditRejected records that hs was refused for reason. hs is nil when the
+// connection was refused before its handshake was read.
+func (h *Handler) auditRejected(ctx context.Context, reason rejectReason, hs *encoding.ClientHandshake) {
+	r := auditRecord{Event: "rejected", Reason: string(reason)}
+	if hs != nil && hs.Versions == 0 {
+		if id, err := uuid.ParseBytes(hs.UserID[:]); err == nil {
+			r.UserID = id.String()
+		}
+	}
+	h.audit.record(ctx, r)
+}
@@ -0,0 +1,89 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestAuditLogRecordsHandshakes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:  []*reflex.User{{Id: id.String(), Email: "alice@example.com", Policy: "zoom"}},
+		AuditLog: path,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+
+	source := xnet.TCPDestination(xnet.ParseAddress("192.0.2.7"), 40000)
+	connect := func(userID uuid.UUID) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		ctx := session.ContextWithInbound(context.Background(), &session.Inbound{Source: source})
+		go h.Process(ctx, xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], userID.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	if _, err := connect(uuid.New()); err == nil {
+		t.Fatal("unknown user was accepted")
+	}
+	c, err := connect(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "audited")
+	c.Close()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	var records []auditRecord
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var r auditRecord
+		if err := json.Unmarshal(scanner.Bytes(), &r); err != nil {
+			t.Fatalf("malformed audit line %q: %v", scanner.Text(), err)
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d audit records, want 2", len(records))
+	}
+	if r := records[0]; r.Event != "rejected" || r.Reason != string(rejectAuth) || r.Source != source.NetAddr() || r.Session == 0 {
+		t.Fatalf("unexpected rejection record: %+v", r)
+	}
+	if r := records[1]; r.Event != "accepted" || r.Email != "alice@example.com" || r.UserID != id.String() || r.Reason != "" {
+		t.Fatalf("unexpected acceptance record: %+v", r)
+	}
+}
+
+func TestAuditLogDisabled(t *testing.T) {
+	a, err := newAuditLog("", false)
+	if err != nil || a != nil {
+		t.Fatalf("audit log without a destination: %v, %v", a, err)
+	}
+	a.record(context.Background(), auditRecord{Event: "accepted"})
+	if err := a.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
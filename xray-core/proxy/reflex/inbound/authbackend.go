@@ -0,0 +1,235 @@
+package inbound
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+const (
+	defaultAuthCacheTTL = time.Minute
+	defaultAuthTimeout  = 2 * time.Second
+	// maxAuthResponseSize bounds what is read of a backend response.
+	maxAuthResponseSize = 64 * 1024
+)
+
+// authRequest is what the backend is asked. Negotiating clients only send
+// an HMAC of their UUID, so the backend gets its inputs and must find the
+// user whose token matches; older clients send their UUID, of which the
+// backend gets the SHA-256.
+type authRequest struct {
+	Token      string `json:"token,omitempty"`
+	PublicKey  string `json:"public_key,omitempty"`
+	Timestamp  int64  `json:"timestamp,omitempty"`
+	UserIDHash string `json:"user_id_hash,omitempty"`
+	// Binding is the handshake_binding the token was computed with.
+	Binding string `json:"binding,omitempty"`
+}
+
+// authResponse is the backend's decision. An admitted user comes with its
+// UUID, which must match the handshake, and its settings as in clients.
+type authResponse struct {
+	Allow           bool     `json:"allow"`
+	ID              string   `json:"id"`
+	Email           string   `json:"email"`
+	Level           uint32   `json:"level"`
+	Policy          string   `json:"policy"`
+	UplinkPolicy    string   `json:"uplink_policy"`
+	DownlinkPolicy  string   `json:"downlink_policy"`
+	AllowedPolicies []string `json:"allowed_policies"`
+	// UplinkRate and DownlinkRate are the user's rate limits in bytes per
+	// second.
+	UplinkRate   uint64 `json:"uplink_rate"`
+	DownlinkRate uint64 `json:"downlink_rate"`
+	// TTL overrides the configured cache TTL, in seconds.
+	TTL uint32 `json:"ttl"`
+}
+
+type cachedUser struct {
+	user    *protocol.MemoryUser
+	expires time.Time
+}
+
+// authBackend authenticates users that aren't configured statically against
+// an HTTP endpoint. Admitted users are cached, and take part in token
+// matching like configured ones until they expire. Refusals can only be
+// cached for older clients, whose UUID is stable; repeated failures of
+// newer ones are left to the source ban.
+type authBackend struct {
+	url     string
+	ttl     time.Duration
+	client  *http.Client
+	binding []byte
+
+	mu     sync.Mutex
+	users  map[[16]byte]cachedUser
+	denied map[[16]byte]time.Time
+	// tokens indexes the cached users.
+	tokens tokenIndex
+}
+
+func newAuthBackend(config *reflex.AuthBackend, binding string) *authBackend {
+	if config.GetUrl() == "" {
+		return nil
+	}
+	a := &authBackend{
+		url:     config.GetUrl(),
+		ttl:     time.Duration(config.GetCacheTtl()) * time.Second,
+		client:  &http.Client{Timeout: time.Duration(config.GetTimeout()) * time.Millisecond},
+		binding: []byte(binding),
+		users:   make(map[[16]byte]cachedUser),
+		denied:  make(map[[16]byte]time.Time),
+	}
+	if a.ttl == 0 {
+		a.ttl = defaultAuthCacheTTL
+	}
+	if a.client.Timeout == 0 {
+		a.client.Timeout = defaultAuthTimeout
+	}
+	return a
+}
+
+// cached drops the cached users that expired at now and returns the one
+// behind hs, if cached, and whether the UUID of a non-negotiating hs was
+// recently refused.
+func (a *authBackend) cached(hs *encoding.ClientHandshake, now time.Time) (*protocol.MemoryUser, bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for id, c := range a.users {
+		if now.After(c.expires) {
+			delete(a.users, id)
+			a.tokens.remove(id)
+		}
+	}
+	for id, expires := range a.denied {
+		if now.After(expires) {
+			delete(a.denied, id)
+		}
+	}
+	if hs.Versions != 0 {
+		return a.tokens.lookup(hs, a.binding), false
+	}
+	_, denied := a.denied[hs.UserID]
+	return a.users[hs.UserID].user, denied
+}
+
+// authenticate finds the user behind hs in the cache or else asks the
+// backend.
+func (a *authBackend) authenticate(ctx context.Context, hs *encoding.ClientHandshake) (*protocol.MemoryUser, error) {
+	now := time.Now()
+	user, denied := a.cached(hs, now)
+	if denied {
+		return nil, errors.New("reflex user refused by auth backend")
+	}
+	if user != nil {
+		return user, nil
+	}
+
+	resp, err := a.query(ctx, hs)
+	if err != nil {
+		return nil, errors.New("reflex auth backend failed").Base(err)
+	}
+	if !resp.Allow {
+		if hs.Versions == 0 {
+			a.mu.Lock()
+			a.denied[hs.UserID] = now.Add(a.ttl)
+			a.mu.Unlock()
+		}
+		return nil, errors.New("reflex user refused by auth backend")
+	}
+	id, user, err := resp.user(hs, a.binding)
+	if err != nil {
+		return nil, err
+	}
+	ttl := a.ttl
+	if resp.TTL > 0 {
+		ttl = time.Duration(resp.TTL) * time.Second
+	}
+	a.mu.Lock()
+	a.users[id] = cachedUser{user: user, expires: now.Add(ttl)}
+	a.tokens.add(id, user)
+	a.mu.Unlock()
+	return user, nil
+}
+
+func (a *authBackend) query(ctx context.Context, hs *encoding.ClientHandshake) (*authResponse, error) {
+	var request authRequest
+	if hs.Versions == 0 {
+		sum := sha256.Sum256(hs.UserID[:])
+		request.UserIDHash = hex.EncodeToString(sum[:])
+	} else {
+		request.Token = hex.EncodeToString(hs.UserID[:])
+		request.PublicKey = hex.EncodeToString(hs.PublicKey[:])
+		request.Timestamp = hs.Timestamp
+		request.Binding = string(a.binding)
+	}
+	body, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, a.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	httpResp, err := a.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer httpResp.Body.Close()
+	if httpResp.StatusCode != http.StatusOK {
+		return nil, errors.New("unexpected status ", httpResp.Status)
+	}
+	resp := new(authResponse)
+	if err := json.NewDecoder(io.LimitReader(httpResp.Body, maxAuthResponseSize)).Decode(resp); err != nil {
+		return nil, err
+	}
+	return resp, nil
+}
+
+// user builds the admitted user, after checking that it is the one hs
+// authenticates, so the backend can't hand out an identity by mistake.
+func (r *authResponse) user(hs *encoding.ClientHandshake, binding []byte) ([16]byte, *protocol.MemoryUser, error) {
+	uid, err := uuid.ParseString(r.ID)
+	if err != nil {
+		return [16]byte{}, nil, errors.New("reflex auth backend returned an invalid id").Base(err)
+	}
+	var id [16]byte
+	copy(id[:], uid.Bytes())
+	match := id == hs.UserID
+	if hs.Versions != 0 {
+		token := encoding.UserToken(id, hs.PublicKey, hs.Timestamp, binding)
+		match = token == hs.UserID
+	}
+	if !match {
+		return id, nil, errors.New("reflex auth backend admitted a user the handshake doesn't match")
+	}
+	r.ID = uid.String()
+	email := r.Email
+	if email == "" {
+		email = r.ID
+	}
+	account := &reflex.MemoryAccount{
+		ID:              r.ID,
+		Policy:          r.Policy,
+		UplinkPolicy:    r.UplinkPolicy,
+		DownlinkPolicy:  r.DownlinkPolicy,
+		AllowedPolicies: r.AllowedPolicies,
+	}
+	if r.UplinkRate > 0 || r.DownlinkRate > 0 {
+		account.RateLimit = &reflex.RateLimit{Uplink: r.UplinkRate, Downlink: r.DownlinkRate}
+	}
+	return id, &protocol.MemoryUser{Email: email, Level: r.Level, Account: account}, nil
+}
@@ -0,0 +1,83 @@
+package inbound
+
+import (
+	"context"
+	"encoding/hex"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestAuthBackendAdmitsAndCachesUsers(t *testing.T) {
+	known := uuid.New()
+	var knownID [16]byte
+	copy(knownID[:], known.Bytes())
+	var calls atomic.Int32
+	var lie atomic.Bool
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req authRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		var pub [32]byte
+		key, _ := hex.DecodeString(req.PublicKey)
+		copy(pub[:], key)
+		token := encoding.UserToken(knownID, pub, req.Timestamp, []byte(req.Binding))
+		resp := authResponse{}
+		switch {
+		case lie.Load():
+			other := uuid.New()
+			resp = authResponse{Allow: true, ID: other.String()}
+		case req.Token == hex.EncodeToString(token[:]):
+			resp = authResponse{Allow: true, ID: known.String(), Email: "panel@example.com", Policy: "zoom"}
+		}
+		json.NewEncoder(w).Encode(resp)
+	}))
+	defer backend.Close()
+
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		AuthBackend: &reflex.AuthBackend{Url: backend.URL},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	connect := func(id uuid.UUID) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	if _, err := connect(uuid.New()); err == nil {
+		t.Fatal("user unknown to the backend was accepted")
+	}
+	for i := 0; i < 2; i++ {
+		c, err := connect(known)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEcho(t, c, "via panel")
+		c.Close()
+	}
+	if n := calls.Load(); n != 2 {
+		t.Fatalf("backend called %d times, want 2 with the admitted user cached", n)
+	}
+
+	lie.Store(true)
+	if _, err := connect(uuid.New()); err == nil {
+		t.Fatal("user the handshake doesn't match was accepted")
+	}
+}
@@ -0,0 +1,130 @@
+package inbound
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+const (
+	defaultBanWindow   = time.Minute
+	defaultBanDuration = 10 * time.Minute
+)
+
+// banList counts failed handshakes per source and bans sources that fail
+// too often, so probes and brute force reach the fallback without costing
+// a key exchange. A nil *banList bans nothing.
+type banList struct {
+	maxFailures uint32
+	window      time.Duration
+	duration    time.Duration
+
+	mu        sync.Mutex
+	sources   map[string]*banEntry
+	lastSweep time.Time
+}
+
+type banEntry struct {
+	windowStart time.Time
+	failures    uint32
+	bannedUntil time.Time
+}
+
+func newBanList(config *reflex.SourceBan) *banList {
+	if config.GetMaxFailures() == 0 {
+		return nil
+	}
+	b := &banList{
+		maxFailures: config.GetMaxFailures(),
+		window:      time.Duration(config.GetWindow()) * time.Second,
+		duration:    time.Duration(config.GetDuration()) * time.Second,
+		sources:     make(map[string]*banEntry),
+	}
+	if b.window == 0 {
+		b.window = defaultBanWindow
+	}
+	if b.duration == 0 {
+		b.duration = defaultBanDuration
+	}
+	return b
+}
+
+// banKey returns what ip is banned as: the address itself, or its /64 for
+// IPv6, where one host commonly holds the whole prefix.
+func banKey(ip net.IP) string {
+	if ip4 := ip.To4(); ip4 != nil {
+		return ip4.String()
+	}
+	return ip.Mask(net.CIDRMask(64, 8*net.IPv6len)).String()
+}
+
+// banned reports whether ip is banned at now. Unknown sources never are.
+func (b *banList) banned(ip net.IP, now time.Time) bool {
+	if b == nil || ip == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	e := b.sources[banKey(ip)]
+	return e != nil && now.Before(e.bannedUntil)
+}
+
+// fail records a failed handshake from ip at now and reports whether it got
+// ip banned.
+func (b *banList) fail(ip net.IP, now time.Time) bool {
+	if b == nil || ip == nil {
+		return false
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.sweep(now)
+	key := banKey(ip)
+	e := b.sources[key]
+	if e == nil {
+		e = &banEntry{windowStart: now}
+		b.sources[key] = e
+	}
+	if now.Before(e.bannedUntil) {
+		return false
+	}
+	if now.Sub(e.windowStart) >= b.window {
+		e.windowStart = now
+		e.failures = 0
+	}
+	e.failures++
+	if e.failures < b.maxFailures {
+		return false
+	}
+	e.bannedUntil = now.Add(b.duration)
+	e.failures = 0
+	return true
+}
+
+// succeed forgets the failures of ip after it completed a handshake at now.
+func (b *banList) succeed(ip net.IP, now time.Time) {
+	if b == nil || ip == nil {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	key := banKey(ip)
+	if e := b.sources[key]; e != nil && !now.Before(e.bannedUntil) {
+		delete(b.sources, key)
+	}
+}
+
+// sweep drops sources whose window and ban have both run out, at most once
+// per window.
+func (b *banList) sweep(now time.Time) {
+	if now.Sub(b.lastSweep) < b.window {
+		return
+	}
+	b.lastSweep = now
+	for key, e := range b.sources {
+		if now.Sub(e.windowStart) >= b.window && !now.Before(e.bannedUntil) {
+			delete(b.sources, key)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestBanList(t *testing.T) {
+	if b := newBanList(&reflex.SourceBan{}); b != nil {
+		t.Fatal("ban list enabled without max_failures")
+	}
+	b := newBanList(&reflex.SourceBan{MaxFailures: 3, Window: 10, Duration: 60})
+	ip := net.ParseIP("192.0.2.1")
+	now := time.Now()
+
+	b.fail(ip, now)
+	b.fail(ip, now.Add(11*time.Second))
+	if b.fail(ip, now.Add(12*time.Second)) {
+		t.Fatal("failures outside the window counted")
+	}
+	if !b.fail(ip, now.Add(13*time.Second)) {
+		t.Fatal("source not banned after three failures in the window")
+	}
+	if !b.banned(ip, now.Add(14*time.Second)) || b.banned(net.ParseIP("192.0.2.2"), now.Add(14*time.Second)) {
+		t.Fatal("ban applied to the wrong sources")
+	}
+	if b.banned(ip, now.Add(74*time.Second)) {
+		t.Fatal("ban outlived its duration")
+	}
+
+	v6 := net.ParseIP("2001:db8:1:2::1")
+	for i := 0; i < 3; i++ {
+		b.fail(v6, now)
+	}
+	if !b.banned(net.ParseIP("2001:db8:1:2::ffff"), now) || b.banned(net.ParseIP("2001:db8:1:3::1"), now) {
+		t.Fatal("IPv6 bans should cover exactly the /64")
+	}
+
+	other := net.ParseIP("198.51.100.1")
+	b.fail(other, now)
+	b.fail(other, now)
+	b.succeed(other, now)
+	if b.fail(other, now) {
+		t.Fatal("failures survived a successful handshake")
+	}
+
+	var none *banList
+	if none.fail(ip, now) || none.banned(ip, now) {
+		t.Fatal("nil ban list banned a source")
+	}
+}
+
+func TestBannedSourceSkipsHandshake(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:   []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+		SourceBan: &reflex.SourceBan{MaxFailures: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+
+	connect := func(userID uuid.UUID) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		ctx := session.ContextWithInbound(context.Background(), &session.Inbound{
+			Source: xnet.TCPDestination(xnet.ParseAddress("192.0.2.9"), 40000),
+		})
+		// Xray's worker closes the connection once Process returns.
+		go func() {
+			h.Process(ctx, xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+			serverConn.Close()
+		}()
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], userID.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	for i := 0; i < 2; i++ {
+		if _, err := connect(uuid.New()); err == nil {
+			t.Fatal("unknown user was accepted")
+		}
+	}
+	if _, err := connect(id); err == nil {
+		t.Fatal("banned source completed a handshake")
+	}
+}
@@ -0,0 +1,121 @@
+package inbound
+
+import (
+	"fmt"
+	stdnet "net"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// checkDialTimeout bounds each fallback reachability probe.
+const checkDialTimeout = 2 * time.Second
+
+// CheckConfig reports what in config would break sessions at runtime even
+// though New accepts it: malformed or duplicate user IDs, policies naming
+// no profile, profile files that do not parse and fallbacks nothing listens
+// on. It returns one error per problem and changes no global state.
+func CheckConfig(config *reflex.InboundConfig) []error {
+	var problems []error
+	known := make(map[string]bool, len(encoding.Profiles))
+	for name := range encoding.Profiles {
+		known[name] = true
+	}
+	if dir := config.GetProfileDir(); dir != "" {
+		names, errs := checkProfileDir(dir)
+		problems = append(problems, errs...)
+		for _, name := range names {
+			known[name] = true
+		}
+	}
+	checkPolicy := func(owner, name string) {
+		if name != "" && !known[name] {
+			problems = append(problems, errors.New(owner, ": unknown policy ", name))
+		}
+	}
+
+	ids := make(map[string]bool, len(config.GetClients()))
+	fallbacks := []*reflex.Fallback{config.GetFallback()}
+	for _, c := range config.GetClients() {
+		owner := "user " + c.GetEmail()
+		if c.GetEmail() == "" {
+			owner = "user " + c.GetId()
+		}
+		if id, err := uuid.ParseString(c.GetId()); err != nil {
+			problems = append(problems, errors.New(owner, ": invalid id").Base(err))
+		} else if ids[id.String()] {
+			problems = append(problems, errors.New(owner, ": duplicate id"))
+		} else {
+			ids[id.String()] = true
+		}
+		checkPolicy(owner, c.GetPolicy())
+		checkPolicy(owner, c.GetUplinkPolicy())
+		checkPolicy(owner, c.GetDownlinkPolicy())
+		for _, name := range c.GetAllowedPolicies() {
+			checkPolicy(owner, name)
+		}
+		fallbacks = append(fallbacks, c.GetFallback())
+	}
+	limited := make([]string, 0, len(config.GetPolicyRateLimits()))
+	for name := range config.GetPolicyRateLimits() {
+		limited = append(limited, name)
+	}
+	sort.Strings(limited)
+	for _, name := range limited {
+		checkPolicy("policyRateLimits", name)
+	}
+
+	probed := make(map[uint32]bool)
+	for _, f := range fallbacks {
+		ports := []uint32{f.GetDest()}
+		for _, geo := range f.GetGeo() {
+			ports = append(ports, geo.GetDest())
+		}
+		for _, port := range ports {
+			if port == 0 || probed[port] {
+				continue
+			}
+			probed[port] = true
+			conn, err := stdnet.DialTimeout("tcp", fmt.Sprintf("127.0.0.1:%d", port), checkDialTimeout)
+			if err != nil {
+				problems = append(problems, errors.New("fallback ", port, " is unreachable").Base(err))
+				continue
+			}
+			conn.Close()
+		}
+	}
+	return problems
+}
+
+// checkProfileDir parses every profile in dir, returning the names of those
+// that load and an error for each that does not.
+func checkProfileDir(dir string) ([]string, []error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, []error{errors.New("invalid profileDir").Base(err)}
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return nil, []error{errors.New("invalid profileDir").Base(err)}
+	}
+	sort.Strings(files)
+	var names []string
+	var problems []error
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		if err == nil {
+			var p *encoding.TrafficProfile
+			if p, err = encoding.ParseProfileJSON(data); err == nil {
+				names = append(names, p.Name)
+				continue
+			}
+		}
+		problems = append(problems, errors.New("profile file ", file).Base(err))
+	}
+	return names, problems
+}
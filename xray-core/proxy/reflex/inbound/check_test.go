@@ -0,0 +1,78 @@
+package inbound
+
+import (
+	stdnet "net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+func TestCheckConfigAcceptsValidConfig(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "video.json"), []byte(testProfileJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	decoy, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoy.Close()
+	id := uuid.New()
+	config := &reflex.InboundConfig{
+		ProfileDir: dir,
+		Fallback:   &reflex.Fallback{Dest: uint32(decoy.Addr().(*stdnet.TCPAddr).Port)},
+		Clients: []*reflex.User{{
+			Id:              id.String(),
+			Policy:          "custom-video",
+			AllowedPolicies: []string{"zoom"},
+		}},
+	}
+	if problems := CheckConfig(config); len(problems) != 0 {
+		t.Fatalf("valid config reported %v", problems)
+	}
+}
+
+func TestCheckConfigReportsEveryProblem(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "broken.json"), []byte(`{"name":"x"}`), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	closed, err := stdnet.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := uint32(closed.Addr().(*stdnet.TCPAddr).Port)
+	closed.Close()
+	u := uuid.New()
+	id := u.String()
+	config := &reflex.InboundConfig{
+		ProfileDir: dir,
+		Fallback:   &reflex.Fallback{Dest: port},
+		Clients: []*reflex.User{
+			{Id: id, Policy: "zoom", UplinkPolicy: "no-such-profile"},
+			{Id: id, Email: "twin@example.com"},
+			{Id: "this-id-is-too-long-to-be-hashed-into-a-uuid"},
+		},
+		PolicyRateLimits: map[string]*reflex.RateLimit{"missing": {}},
+	}
+	var got []string
+	for _, err := range CheckConfig(config) {
+		got = append(got, err.Error())
+	}
+	for _, want := range []string{"broken.json", "unknown policy no-such-profile", "twin@example.com: duplicate id", "too-long-to-be-hashed-into-a-uuid: invalid id", "unknown policy missing", "is unreachable"} {
+		found := false
+		for _, problem := range got {
+			found = found || strings.Contains(problem, want)
+		}
+		if !found {
+			t.Errorf("%q not reported in %q", want, got)
+		}
+	}
+	if len(got) != 6 {
+		t.Fatalf("reported %d problems, want 6: %q", len(got), got)
+	}
+}
@@ -0,0 +1,42 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+func isChunked(te []string) bool {
+	return len(te) > 0 && te[0] == "chunked"
+}
+
+// handleChunkedHTTP runs a session whose client streams its handshake and
+// frames as a chunked POST body. The reply is a chunked 200 response that
+// opens with the server handshake, and only goes out once the handshake is
+// accepted, so rejections are still ordinary error responses.
+func (h *Handler) handleChunkedHTTP(ctx context.Context, req *http.Request, conn stat.Connection, dispatcher routing.Dispatcher) error {
+	body := bufio.NewReader(req.Body)
+	var magic [4]byte
+	if _, err := io.ReadFull(body, magic[:]); err != nil || !h.isReflexMagic(magic[:]) {
+		_ = h.writeErrorPage(ctx, conn, http.StatusBadRequest)
+		return errors.New("reflex chunked request did not start with a handshake")
+	}
+	clientHS, err := encoding.ReadBinaryHandshake(body)
+	if err != nil {
+		_ = h.writeErrorPage(ctx, conn, http.StatusBadRequest)
+		return errors.New("malformed reflex chunked handshake").Base(err)
+	}
+
+	head := []byte("HTTP/1.1 200 OK\r\nContent-Type: application/octet-stream\r\nTransfer-Encoding: chunked\r\nCache-Control: no-store\r\n\r\n")
+	stream := encoding.NewHTTPStreamConn(conn, head, func() (io.Reader, error) { return body, nil })
+	defer stream.Close()
+	return h.processHandshake(ctx, body, conn, dispatcher, clientHS, func(hs encoding.ServerHandshake) (stat.Connection, error) {
+		return stream, encoding.WriteStreamedHandshake(stream, hs)
+	})
+}
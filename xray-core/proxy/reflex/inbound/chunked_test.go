@@ -0,0 +1,52 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// chunkedSession connects a client with id to a fresh inbound over a chunked
+// HTTP exchange.
+func chunkedSession(t *testing.T, id uuid.UUID, clientID uuid.UUID) (*encoding.ClientConn, error) {
+	t.Helper()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	dispatcher := echoDispatcher{dest: make(chan xnet.Destination, 1)}
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], clientID.Bytes())
+	return encoding.NewClientConn(ctx, encoding.DialChunkedHTTP(clientConn, "api.example.com", "/upload", nil), config)
+}
+
+func TestChunkedSessionEndToEnd(t *testing.T) {
+	id := uuid.New()
+	c, err := chunkedSession(t, id, id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "over chunked http")
+}
+
+func TestChunkedSessionRejected(t *testing.T) {
+	_, err := chunkedSession(t, uuid.New(), uuid.New())
+	if err == nil || !strings.Contains(err.Error(), "403") {
+		t.Fatalf("expected a 403 rejection, got %v", err)
+	}
+}
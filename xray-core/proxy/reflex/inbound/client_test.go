@@ -0,0 +1,640 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/ed25519"
+	"encoding/binary"
+	goerrors "errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport"
+	"github.com/xtls/xray-core/transport/pipe"
+)
+
+// echoDispatcher links every session to a pipe that loops writes back.
+type echoDispatcher struct {
+	dest chan xnet.Destination
+}
+
+func (echoDispatcher) Type() interface{} { return (*routing.Dispatcher)(nil) }
+func (echoDispatcher) Start() error      { return nil }
+func (echoDispatcher) Close() error      { return nil }
+func (d echoDispatcher) Dispatch(_ context.Context, dest xnet.Destination) (*transport.Link, error) {
+	d.dest <- dest
+	r, w := pipe.New(pipe.WithoutSizeLimit())
+	return &transport.Link{Reader: r, Writer: w}, nil
+}
+func (echoDispatcher) DispatchLink(context.Context, xnet.Destination, *transport.Link) error {
+	return io.EOF
+}
+
+// collectWriter hands every written byte to a channel.
+type collectWriter chan []byte
+
+func (w collectWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	for _, b := range mb {
+		w <- append([]byte(nil), b.Bytes()...)
+	}
+	buf.ReleaseMulti(mb)
+	return nil
+}
+
+// startTestSession runs a handler with one user whose policy is "zoom" and
+// connects a client to it over an in-memory pipe.
+func startTestSession(t *testing.T, policy *encoding.PolicyRequest) (*Handler, *encoding.ClientConn, echoDispatcher) {
+	t.Helper()
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom", AllowedPolicies: []string{"youtube"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	dispatcher := echoDispatcher{dest: make(chan xnet.Destination, 1)}
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+
+	config := &encoding.ClientConfig{Policy: policy}
+	copy(config.UserID[:], id.Bytes())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, err := encoding.NewClientConn(ctx, clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return h, c, dispatcher
+}
+
+// assertEcho sends msg through c to an echoDispatcher and waits for it to
+// come back.
+func assertEcho(t *testing.T, c *encoding.ClientConn, msg string) {
+	t.Helper()
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	go c.CopyFrom(up)
+	if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes([]byte(msg))}); err != nil {
+		t.Fatal(err)
+	}
+	received := make(collectWriter, 16)
+	go c.CopyTo(received)
+
+	var echoed []byte
+	for len(echoed) < len(msg) {
+		select {
+		case b := <-received:
+			echoed = append(echoed, b...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo incomplete: %q", echoed)
+		}
+	}
+	if string(echoed) != msg {
+		t.Fatalf("unexpected echo: %q", echoed)
+	}
+}
+
+func TestClientConnStreamMode(t *testing.T) {
+	_, c, _ := startTestSession(t, &encoding.PolicyRequest{Features: []string{encoding.FeatureStream, encoding.FeatureFlow}})
+	if !c.Grant().Has(encoding.FeatureStream) {
+		t.Fatalf("stream mode not granted: %v", c.Grant().Features)
+	}
+	assertEcho(t, c, strings.Repeat("stream ", 500))
+}
+
+func TestClientConnEndToEnd(t *testing.T) {
+	_, c, dispatcher := startTestSession(t, &encoding.PolicyRequest{
+		Downlink: "youtube",
+		Features: []string{encoding.FeatureKeepalive, encoding.FeatureMux, encoding.FeatureUDP, encoding.FeatureCompress},
+		Padding:  encoding.PaddingNone,
+	})
+
+	grant := c.Grant()
+	if grant.Downlink != "youtube" || grant.Uplink != "zoom" || grant.Padding != encoding.PaddingNone {
+		t.Fatalf("unexpected grant: %+v", grant)
+	}
+	if !grant.Has(encoding.FeatureKeepalive) || !grant.Has(encoding.FeatureCompress) || !grant.Has(encoding.FeatureMux) || grant.Has(encoding.FeatureUDP) {
+		t.Fatalf("unexpected features: %v", grant.Features)
+	}
+	if profile, padding := c.Session().Shaping(); profile.Name != "zoom" || padding != encoding.PaddingNone {
+		t.Fatalf("uplink not shaped by grant: %s %s", profile.Name, padding)
+	}
+
+	target := xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)
+	if err := c.WriteDestination(target); err != nil {
+		t.Fatal(err)
+	}
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	go c.CopyFrom(up)
+	if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes([]byte("hello reflex"))}); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(collectWriter, 16)
+	go c.CopyTo(received)
+
+	select {
+	case dest := <-dispatcher.dest:
+		if dest != target {
+			t.Fatalf("server dispatched to %v, want %v", dest, target)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never dispatched")
+	}
+	var echoed []byte
+	for len(echoed) < len("hello reflex") {
+		select {
+		case b := <-received:
+			echoed = append(echoed, b...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo incomplete: %q", echoed)
+		}
+	}
+	if string(echoed) != "hello reflex" {
+		t.Fatalf("unexpected echo: %q", echoed)
+	}
+}
+
+func TestServerIdentitySignsGrants(t *testing.T) {
+	id := uuid.New()
+	seed := bytes.Repeat([]byte{7}, ed25519.SeedSize)
+	connect := func(identityKey []byte, pinned ed25519.PublicKey) (*encoding.ClientConn, error) {
+		in, err := New(context.Background(), &reflex.InboundConfig{
+			Clients:     []*reflex.User{{Id: id.String(), Policy: "zoom", AllowedPolicies: []string{"youtube"}}},
+			IdentityKey: identityKey,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{Policy: &encoding.PolicyRequest{Uplink: "youtube"}, ServerIdentity: pinned}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+	public := ed25519.NewKeyFromSeed(seed).Public().(ed25519.PublicKey)
+
+	c, err := connect(seed, public)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if len(c.Grant().ServerSignature) == 0 {
+		t.Fatal("grant not signed by the server identity")
+	}
+	config := &encoding.ClientConfig{ServerIdentity: public}
+	copy(config.UserID[:], id.Bytes())
+	if g := config.CachedGrant(); g == nil || g.Uplink != "youtube" {
+		t.Fatalf("verified grant not cached: %+v", g)
+	}
+
+	other, _, _ := ed25519.GenerateKey(nil)
+	if _, err := connect(seed, other); err == nil {
+		t.Fatal("grant signed by another identity accepted")
+	}
+	if _, err := connect(nil, public); err == nil {
+		t.Fatal("unsigned grant accepted from a pinned server")
+	}
+}
+
+func TestClientConnWriteRequestCarriesFirstPayload(t *testing.T) {
+	_, c, dispatcher := startTestSession(t, nil)
+
+	request := "GET / HTTP/1.1\r\nHost: example.org\r\n\r\n"
+	body := bytes.Repeat([]byte("b"), 4000)
+	first := buf.MergeBytes(nil, append([]byte(request), body...))
+	rest, err := c.WriteRequest(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80), first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := int(rest.Len()); got == 0 || got >= len(body) {
+		t.Fatalf("%d bytes left over, want the part beyond one frame", got)
+	}
+	buf.ReleaseMulti(rest)
+	<-dispatcher.dest
+
+	// The request comes back without any further frames from the client.
+	received := make(collectWriter, 16)
+	go c.CopyTo(received)
+	var echoed []byte
+	for len(echoed) < len(request) {
+		select {
+		case b := <-received:
+			echoed = append(echoed, b...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("first payload never reached upstream: %q", echoed)
+		}
+	}
+	if !bytes.HasPrefix(echoed, []byte(request)) {
+		t.Fatalf("unexpected echo: %q", echoed)
+	}
+}
+
+// startProfileSession runs a handler with user, whose id it sets, and the
+// profiles defined in a profile directory, and connects a negotiating
+// client to it.
+func startProfileSession(t *testing.T, user *reflex.User, profiles ...string) (*Handler, *encoding.ClientConn) {
+	t.Helper()
+	dir := t.TempDir()
+	for i, def := range profiles {
+		if err := os.WriteFile(filepath.Join(dir, fmt.Sprint(i, ".json")), []byte(def), 0o600); err != nil {
+			t.Fatal(err)
+		}
+	}
+	id := uuid.New()
+	user.Id = id.String()
+	in, err := New(context.Background(), &reflex.InboundConfig{ProfileDir: dir, Clients: []*reflex.User{user}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	serverConn, clientConn := net.Pipe()
+	t.Cleanup(func() { clientConn.Close() })
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+
+	config := &encoding.ClientConfig{Policy: &encoding.PolicyRequest{}}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return h, c
+}
+
+// traceProfileJSON defines a trace profile called name of n packets.
+func traceProfileJSON(name string, n int) string {
+	packets := make([]string, n)
+	for i := range packets {
+		packets[i] = fmt.Sprintf(`{"size": %d, "delayMs": 0}`, 100+i)
+	}
+	return `{"name": "` + name + `", "model": "trace", "trace": [` + strings.Join(packets, ", ") + `]}`
+}
+
+func TestClientReceivesGrantLargerThanHandshake(t *testing.T) {
+	_, c := startProfileSession(t, &reflex.User{Policy: "long-trace"}, traceProfileJSON("long-trace", 500))
+
+	g := c.Grant()
+	if g.More || len(g.Ext) <= encoding.MaxPolicyPayloadSize {
+		t.Fatalf("grant arrived cut short: more %v, %d ext bytes", g.More, len(g.Ext))
+	}
+	profile, _ := c.Session().Shaping()
+	if profile.Name != "long-trace" || len(profile.Trace) != 500 || profile.Trace[499].Size != 599 {
+		t.Fatalf("uplink shaped by %s with %d trace packets", profile.Name, len(profile.Trace))
+	}
+	// The frames of the deferred grant left the session in step.
+	assertEcho(t, c, "after a large grant")
+}
+
+func TestClientShapesByCustomUplinkProfile(t *testing.T) {
+	user := &reflex.User{UplinkPolicy: "custom-video", DownlinkPolicy: "youtube"}
+	h, c := startProfileSession(t, user, testProfileJSON, traceProfileJSON("custom-up", 3))
+
+	if g := c.Grant(); g.Uplink != "custom-video" || g.Downlink != "youtube" {
+		t.Fatalf("unexpected grant: %+v", g)
+	}
+	profile, _ := c.Session().Shaping()
+	if profile.Name != "custom-video" || len(profile.PacketSizes) != 2 || profile.PacketSizes[0].Size != 1300 || profile.Pacing != encoding.PacingReceiver {
+		t.Fatalf("uplink not shaped by the server's definition: %+v", profile)
+	}
+	assertEcho(t, c, "custom uplink")
+
+	// A live switch to another loaded uplink profile carries its definition.
+	if n, err := h.UpdatePolicy(context.Background(), "", "custom-up", ""); err != nil || n != 1 {
+		t.Fatalf("updated %d sessions, err %v", n, err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if profile, _ := c.Session().Shaping(); profile.Name == "custom-up" {
+			if len(profile.Trace) != 3 {
+				t.Fatalf("updated uplink has %d trace packets", len(profile.Trace))
+			}
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client uplink never switched from %s", c.Grant().Uplink)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if g := c.Grant(); g.Downlink != "youtube" {
+		t.Fatalf("downlink changed to %s", g.Downlink)
+	}
+}
+
+// failingReader fails its first read.
+type failingReader struct{}
+
+func (failingReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	return nil, io.ErrClosedPipe
+}
+
+func TestClientFINKeepsDownlinkFlowing(t *testing.T) {
+	_, c, _ := startTestSession(t, nil)
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+		t.Fatal(err)
+	}
+	// The whole request, then EOF, as a client that half-closes after
+	// sending it.
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	msg := bytes.Repeat([]byte("request "), 512)
+	if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes(msg)}); err != nil {
+		t.Fatal(err)
+	}
+	upWriter.Close()
+	if err := c.CopyFrom(up); err != nil {
+		t.Fatal(err)
+	}
+
+	received := make(collectWriter, 64)
+	done := make(chan error, 1)
+	go func() { done <- c.CopyTo(received) }()
+	var echoed []byte
+	for {
+		select {
+		case b := <-received:
+			echoed = append(echoed, b...)
+			continue
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("downlink stalled after %d bytes", len(echoed))
+		}
+		break
+	}
+	for len(received) > 0 {
+		echoed = append(echoed, <-received...)
+	}
+	if !bytes.Equal(echoed, msg) {
+		t.Fatalf("got %d bytes back after FIN, want %d", len(echoed), len(msg))
+	}
+}
+
+// sinkDispatcher links every session to an upstream that sends nothing and
+// ends at once, and hands what the client sends to uplink.
+type sinkDispatcher struct {
+	echoDispatcher
+	uplink chan buf.Reader
+}
+
+func (d sinkDispatcher) Dispatch(_ context.Context, dest xnet.Destination) (*transport.Link, error) {
+	down, downWriter := pipe.New(pipe.WithoutSizeLimit())
+	downWriter.Close()
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	d.uplink <- up
+	return &transport.Link{Reader: down, Writer: upWriter}, nil
+}
+
+func TestServerFINKeepsUplinkFlowing(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{Clients: []*reflex.User{{Id: id.String()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	// A server that hangs up early leaves the client's writes blocked.
+	clientConn.SetDeadline(time.Now().Add(5 * time.Second))
+	dispatcher := sinkDispatcher{uplink: make(chan buf.Reader, 1)}
+	processed := make(chan error, 1)
+	go func() {
+		processed <- in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+	}()
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+		t.Fatal(err)
+	}
+	// Upstream ends first, so the server's FIN arrives before any data.
+	if err := c.CopyTo(make(collectWriter, 16)); err != nil {
+		t.Fatalf("downlink: %v", err)
+	}
+
+	// The client goes on sending, then half-closes too.
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	msg := bytes.Repeat([]byte("late "), 1024)
+	if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes(msg)}); err != nil {
+		t.Fatal(err)
+	}
+	upWriter.Close()
+	if err := c.CopyFrom(up); err != nil {
+		t.Fatalf("uplink after server FIN: %v", err)
+	}
+
+	uplink := <-dispatcher.uplink
+	var got []byte
+	for {
+		mb, err := uplink.ReadMultiBuffer()
+		for _, b := range mb {
+			got = append(got, b.Bytes()...)
+		}
+		buf.ReleaseMulti(mb)
+		if err != nil {
+			break
+		}
+	}
+	if !bytes.Equal(got, msg) {
+		t.Fatalf("upstream got %d bytes after the server's FIN, want %d", len(got), len(msg))
+	}
+	select {
+	case err := <-processed:
+		if err != nil {
+			t.Fatalf("session ended with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session outlived both FINs")
+	}
+}
+
+func TestClientRSTAbortsSession(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{Clients: []*reflex.User{{Id: id.String()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	processed := make(chan error, 1)
+	go func() {
+		processed <- in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+	}()
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.CopyFrom(failingReader{}); err == nil {
+		t.Fatal("failed read not reported")
+	}
+	select {
+	case err := <-processed:
+		if err == nil {
+			t.Fatal("reset session ended cleanly")
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server kept the reset session open")
+	}
+}
+
+// failingDispatcher fails every Dispatch, or with upstream set hands out
+// links whose downlink breaks right away.
+type failingDispatcher struct {
+	echoDispatcher
+	upstream bool
+}
+
+func (d failingDispatcher) Dispatch(_ context.Context, dest xnet.Destination) (*transport.Link, error) {
+	if !d.upstream {
+		return nil, io.ErrUnexpectedEOF
+	}
+	r, w := pipe.New(pipe.WithoutSizeLimit())
+	w.Interrupt()
+	return &transport.Link{Reader: r, Writer: w}, nil
+}
+
+func TestServerResetCarriesReason(t *testing.T) {
+	for _, tc := range []struct {
+		upstream bool
+		code     byte
+		errno    syscall.Errno
+	}{
+		{upstream: true, code: encoding.CloseErrorUpstream, errno: syscall.ECONNRESET},
+		{upstream: false, code: encoding.CloseErrorDispatch, errno: syscall.ECONNREFUSED},
+	} {
+		id := uuid.New()
+		in, err := New(context.Background(), &reflex.InboundConfig{Clients: []*reflex.User{{Id: id.String()}}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, failingDispatcher{upstream: tc.upstream})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+			t.Fatal(err)
+		}
+		err = c.CopyTo(make(collectWriter, 16))
+		var closeErr *encoding.CloseError
+		if !goerrors.As(err, &closeErr) || closeErr.Code != tc.code || !goerrors.Is(err, tc.errno) {
+			t.Fatalf("upstream=%v: got %v", tc.upstream, err)
+		}
+	}
+}
+
+func TestHandshakeBinding(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:          []*reflex.User{{Id: id.String()}},
+		HandshakeBinding: "a.example.com:443",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	start := func() net.Conn {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		return clientConn
+	}
+	for _, binding := range []string{"", "b.example.com:443"} {
+		config := &encoding.ClientConfig{Binding: binding}
+		copy(config.UserID[:], id.Bytes())
+		if _, err := encoding.NewClientConn(context.Background(), start(), config); err == nil {
+			t.Fatalf("handshake bound to %q accepted", binding)
+		}
+	}
+
+	config := &encoding.ClientConfig{Binding: "a.example.com:443"}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), start(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "bound")
+
+	// Legacy clients send their UUID, so they can't be bound at all.
+	_, pub, err := encoding.GenerateKeyPair()
+	if err != nil {
+		t.Fatal(err)
+	}
+	hs := encoding.ClientHandshake{PublicKey: pub, Timestamp: time.Now().Unix(), Nonce: [16]byte{1}}
+	copy(hs.UserID[:], id.Bytes())
+	conn := start()
+	go conn.Write(append(binary.BigEndian.AppendUint32(nil, encoding.ReflexMagic), encoding.EncodeClientHandshake(hs)...))
+	if _, err := encoding.ReadHandshakeResponse(bufio.NewReader(conn), nil); err == nil {
+		t.Fatal("legacy handshake accepted by a bound server")
+	}
+}
+
+func TestPSK(t *testing.T) {
+	id := uuid.New()
+	psk := bytes.Repeat([]byte{7}, encoding.PSKSize)
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String()}},
+		Psk:     psk,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	connect := func(psk []byte) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{PSK: psk}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+	for _, wrong := range [][]byte{nil, bytes.Repeat([]byte{8}, encoding.PSKSize)} {
+		if _, err := connect(wrong); err == nil {
+			t.Fatalf("session keyed without the server's psk: %x", wrong)
+		}
+	}
+	c, err := connect(psk)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "psk")
+
+	if _, err := New(context.Background(), &reflex.InboundConfig{Psk: []byte("short")}); err == nil {
+		t.Fatal("short psk accepted")
+	}
+}
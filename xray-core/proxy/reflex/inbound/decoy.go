@@ -0,0 +1,255 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	stdnet "net"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+const (
+	defaultPrefetchRefresh = 5 * time.Minute
+	// maxPrefetchBody keeps large downloads out of memory; such paths are
+	// always relayed.
+	maxPrefetchBody = 1 << 20
+	prefetchTimeout = 10 * time.Second
+)
+
+// cachedResponse is a decoy response kept for replay.
+type cachedResponse struct {
+	status int
+	header http.Header
+	body   []byte
+}
+
+// decoyCache prefetches common responses of one fallback decoy and serves
+// them from memory, so probes get answers as fast as from a locally hosted
+// site even when the decoy behind the fallback port is remote.
+type decoyCache struct {
+	dest    uint32
+	host    string
+	paths   []string
+	refresh time.Duration
+	client  *http.Client
+
+	mu        sync.RWMutex
+	responses map[string]*cachedResponse
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// addPrefetch registers the paths f prefetches, error pages included, for
+// each of its decoys. Paths of fallbacks sharing a decoy are merged.
+func (s *settings) addPrefetch(f *reflex.Fallback) {
+	paths := append([]string(nil), f.GetPrefetch()...)
+	for _, path := range f.GetErrorPages() {
+		paths = append(paths, path)
+	}
+	if len(paths) == 0 {
+		return
+	}
+	dests := []uint32{f.GetDest()}
+	for _, geo := range f.GetGeo() {
+		dests = append(dests, geo.GetDest())
+	}
+	for _, dest := range dests {
+		if dest == 0 {
+			continue
+		}
+		if s.decoys == nil {
+			s.decoys = make(map[uint32]*decoyCache)
+		}
+		c := s.decoys[dest]
+		if c == nil {
+			c = newDecoyCache(dest, f.GetPrefetchHost(), time.Duration(f.GetPrefetchRefresh())*time.Second)
+			s.decoys[dest] = c
+		}
+		c.paths = append(c.paths, paths...)
+	}
+}
+
+func newDecoyCache(dest uint32, host string, refresh time.Duration) *decoyCache {
+	if host == "" {
+		host = "localhost"
+	}
+	if refresh == 0 {
+		refresh = defaultPrefetchRefresh
+	}
+	addr := fmt.Sprintf("127.0.0.1:%d", dest)
+	return &decoyCache{
+		dest:    dest,
+		host:    host,
+		refresh: refresh,
+		client: &http.Client{
+			Timeout: prefetchTimeout,
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (stdnet.Conn, error) {
+					var d stdnet.Dialer
+					return d.DialContext(ctx, "tcp", addr)
+				},
+				// Cache bodies as the decoy sends them to clients that
+				// don't ask for compression.
+				DisableCompression: true,
+			},
+			// Redirects are cached as they are, like any other answer.
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		},
+		responses: make(map[string]*cachedResponse),
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+}
+
+// start fetches the paths now and again every refresh interval until Close.
+func (c *decoyCache) start() {
+	go func() {
+		defer close(c.done)
+		ticker := time.NewTicker(c.refresh)
+		defer ticker.Stop()
+		for {
+			c.fetchAll()
+			select {
+			case <-ticker.C:
+			case <-c.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (c *decoyCache) Close() error {
+	close(c.stop)
+	<-c.done
+	c.client.CloseIdleConnections()
+	return nil
+}
+
+// fetchAll refreshes every path. A path that fails keeps its previous
+// response.
+func (c *decoyCache) fetchAll() {
+	for _, path := range c.paths {
+		resp, err := c.fetch(path)
+		if err != nil {
+			errors.LogWarningInner(context.Background(), err, "failed to prefetch reflex decoy ", c.dest, path)
+			continue
+		}
+		c.mu.Lock()
+		c.responses[path] = resp
+		c.mu.Unlock()
+	}
+}
+
+func (c *decoyCache) fetch(path string) (*cachedResponse, error) {
+	req, err := http.NewRequest(http.MethodGet, "http://"+c.host+path, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxPrefetchBody+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(body) > maxPrefetchBody {
+		return nil, errors.New("response is larger than ", maxPrefetchBody, " bytes")
+	}
+	header := resp.Header.Clone()
+	// These are rewritten for every replay.
+	for _, h := range []string{"Connection", "Keep-Alive", "Transfer-Encoding", "Content-Length", "Date"} {
+		header.Del(h)
+	}
+	return &cachedResponse{status: resp.StatusCode, header: header, body: body}, nil
+}
+
+func (c *decoyCache) lookup(path string) *cachedResponse {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.responses[path]
+}
+
+// serve answers the requests already buffered in reader from the cache, for
+// as long as they are cacheable. It reports whether it answered a request
+// that closes the connection; otherwise whatever is left of the connection
+// belongs to the decoy.
+func (c *decoyCache) serve(reader *bufio.Reader, w io.Writer) (bool, error) {
+	for {
+		buffered, _ := reader.Peek(reader.Buffered())
+		end := bytes.Index(buffered, []byte("\r\n\r\n"))
+		if end < 0 {
+			return false, nil
+		}
+		head := buffered[:end+4]
+		req, err := http.ReadRequest(bufio.NewReader(bytes.NewReader(head)))
+		if err != nil || (req.Method != http.MethodGet && req.Method != http.MethodHead) || req.ContentLength != 0 || len(req.TransferEncoding) > 0 {
+			return false, nil
+		}
+		resp := c.lookup(req.URL.RequestURI())
+		if resp == nil {
+			return false, nil
+		}
+		reader.Discard(len(head))
+		if err := resp.write(w, req); err != nil {
+			return true, err
+		}
+		if req.Close {
+			return true, nil
+		}
+	}
+}
+
+func (r *cachedResponse) write(w io.Writer, req *http.Request) error {
+	header := r.header.Clone()
+	header.Set("Date", time.Now().UTC().Format(http.TimeFormat))
+	resp := &http.Response{
+		StatusCode:    r.status,
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(bytes.NewReader(r.body)),
+		ContentLength: int64(len(r.body)),
+		Close:         req.Close,
+		Request:       req,
+	}
+	return resp.Write(w)
+}
+
+// errorPage returns the decoy's page for status, as the inbound's fallback
+// serves a client at ip, if its error_pages has it cached.
+func (s *settings) errorPage(ip stdnet.IP, status int) *cachedResponse {
+	path, ok := s.fallback.GetErrorPages()[uint32(status)]
+	if !ok {
+		return nil
+	}
+	cache := s.decoys[s.fallbackDest(s.fallback, ip)]
+	if cache == nil {
+		return nil
+	}
+	if resp := cache.lookup(path); resp != nil && resp.status == status {
+		return resp
+	}
+	return nil
+}
+
+// writeErrorPage answers conn with status, in the decoy's own page where
+// there is one, so a refusal looks like the site's.
+func (h *Handler) writeErrorPage(ctx context.Context, conn stat.Connection, status int) error {
+	if resp := h.settings().errorPage(sourceIP(ctx, conn), status); resp != nil {
+		return resp.write(conn, &http.Request{Method: http.MethodPost, Close: true})
+	}
+	return writeHTTPError(conn, status)
+}
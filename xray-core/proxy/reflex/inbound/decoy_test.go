@@ -0,0 +1,145 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+func TestFallbackServesPrefetchedDecoyResponses(t *testing.T) {
+	var mu sync.Mutex
+	hits := make(map[string]int)
+	decoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		hits[r.URL.Path]++
+		mu.Unlock()
+		w.Header().Set("X-Decoy", "1")
+		w.Write([]byte("decoy " + r.URL.Path))
+	}))
+	defer decoy.Close()
+	hitCount := func(path string) int {
+		mu.Lock()
+		defer mu.Unlock()
+		return hits[path]
+	}
+
+	port := uint32(decoy.Listener.Addr().(*net.TCPAddr).Port)
+	fallback := &reflex.Fallback{Dest: port, Prefetch: []string{"/"}}
+	in, err := New(context.Background(), &reflex.InboundConfig{Fallback: fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for h.settings().decoys[port].lookup("/") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("decoy was not prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	probe := func(conn *fakeConn, requests string) {
+		reader := bufio.NewReader(strings.NewReader(requests))
+		// The handshake check has buffered the request by the time a
+		// connection falls back.
+		reader.Peek(1)
+		if err := h.fallbackTo(context.Background(), reader, conn, fallback); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	conn := newFakeConn(nil)
+	probe(conn, "GET / HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	resp, err := http.ReadResponse(bufio.NewReader(&conn.w), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var body bytes.Buffer
+	body.ReadFrom(resp.Body)
+	if resp.StatusCode != 200 || body.String() != "decoy /" || resp.Header.Get("X-Decoy") != "1" || resp.Header.Get("Date") == "" {
+		t.Fatalf("cached response %d %v %q", resp.StatusCode, resp.Header, body.String())
+	}
+	if n := hitCount("/"); n != 1 {
+		t.Fatalf("decoy saw %d requests for a prefetched path", n)
+	}
+
+	// A pipelined request that isn't cached still reaches the decoy.
+	probe(newFakeConn(nil), "GET / HTTP/1.1\r\nHost: example.com\r\n\r\nGET /other HTTP/1.1\r\nHost: example.com\r\nConnection: close\r\n\r\n")
+	for hitCount("/other") == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("uncached request was not relayed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := hitCount("/"); n != 1 {
+		t.Fatalf("decoy saw %d requests for a prefetched path", n)
+	}
+}
+
+func TestErrorPagesComeFromTheDecoy(t *testing.T) {
+	decoy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Server", "nginx")
+		switch r.URL.Path {
+		case "/.ht":
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte("<html>403 Forbidden</html>"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("<html>404 Not Found</html>"))
+		}
+	}))
+	defer decoy.Close()
+
+	port := uint32(decoy.Listener.Addr().(*net.TCPAddr).Port)
+	in, err := New(context.Background(), &reflex.InboundConfig{Fallback: &reflex.Fallback{
+		Dest:       port,
+		ErrorPages: map[uint32]string{403: "/.ht", 500: "/missing"},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	deadline := time.Now().Add(5 * time.Second)
+	for h.settings().decoys[port].lookup("/.ht") == nil || h.settings().decoys[port].lookup("/missing") == nil {
+		if time.Now().After(deadline) {
+			t.Fatal("error pages were not prefetched")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	page := func(status int) (*http.Response, string) {
+		conn := newFakeConn(nil)
+		if err := h.writeErrorPage(context.Background(), conn, status); err != nil {
+			t.Fatal(err)
+		}
+		resp, err := http.ReadResponse(bufio.NewReader(&conn.w), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var body bytes.Buffer
+		body.ReadFrom(resp.Body)
+		return resp, body.String()
+	}
+	resp, body := page(http.StatusForbidden)
+	if resp.StatusCode != http.StatusForbidden || body != "<html>403 Forbidden</html>" || resp.Header.Get("Server") != "nginx" {
+		t.Fatalf("403 page %d %v %q", resp.StatusCode, resp.Header, body)
+	}
+	// The path for 500 answers 404, so it is not used.
+	if resp, body := page(http.StatusInternalServerError); resp.StatusCode != http.StatusInternalServerError || body != "Internal Server Error" {
+		t.Fatalf("500 page %d %q", resp.StatusCode, body)
+	}
+	if resp, body := page(http.StatusServiceUnavailable); resp.StatusCode != http.StatusServiceUnavailable || body != "Service Unavailable" {
+		t.Fatalf("503 page %d %q", resp.StatusCode, body)
+	}
+}
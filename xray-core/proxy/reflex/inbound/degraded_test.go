@@ -0,0 +1,66 @@
+package inbound
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/testing/netsim"
+)
+
+// startSimulatedSession is startTestSession over a link degraded by cond in
+// both directions.
+func startSimulatedSession(t *testing.T, cond netsim.Conditions, policy *encoding.PolicyRequest) *encoding.ClientConn {
+	t.Helper()
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom", AllowedPolicies: []string{"http2-api"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := netsim.Pipe(cond, cond)
+	t.Cleanup(func() { clientConn.Close() })
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+
+	config := &encoding.ClientConfig{Policy: policy}
+	copy(config.UserID[:], id.Bytes())
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	c, err := encoding.NewClientConn(ctx, clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestSessionOverJitteryLossyLink(t *testing.T) {
+	cond := netsim.Conditions{Latency: 10 * time.Millisecond, Jitter: 10 * time.Millisecond, Loss: 0.05, RTO: 30 * time.Millisecond, Seed: 7}
+	c := startSimulatedSession(t, cond, &encoding.PolicyRequest{
+		Uplink:   "http2-api",
+		Downlink: "http2-api",
+		Features: []string{encoding.FeatureHeartbeat, encoding.FeatureFlow},
+	})
+	// Long enough to be morphed into several frames each way.
+	assertEcho(t, c, strings.Repeat("degraded ", 1000))
+
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no RTT measured")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rtt := c.RTT(); rtt < 2*cond.Latency {
+		t.Fatalf("RTT %v below the simulated latency", rtt)
+	}
+}
@@ -0,0 +1,98 @@
+package inbound
+
+import (
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// shutdownGrace is how long Close waits for reset sessions to wind down
+// before closing their connections.
+const shutdownGrace = time.Second
+
+// sessionGate admits sessions up to a limit until the inbound starts
+// draining. The zero value admits any number.
+type sessionGate struct {
+	// max is the most sessions at once; 0 is unlimited.
+	max int
+
+	mu       sync.Mutex
+	n        int
+	draining bool
+	// idle is closed once draining and no session is left.
+	idle chan struct{}
+}
+
+// enter admits a session, or reports false when the gate is full or
+// draining. An admitted session must leave.
+func (g *sessionGate) enter() bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.draining || g.max > 0 && g.n >= g.max {
+		return false
+	}
+	g.n++
+	return true
+}
+
+func (g *sessionGate) leave() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.n--
+	if g.draining && g.n == 0 {
+		close(g.idle)
+	}
+}
+
+// drain stops admitting sessions and returns a channel closed once every
+// admitted session has left.
+func (g *sessionGate) drain() <-chan struct{} {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if !g.draining {
+		g.draining = true
+		g.idle = make(chan struct{})
+		if g.n == 0 {
+			close(g.idle)
+		}
+	}
+	return g.idle
+}
+
+// drain stops new sessions and waits up to drainTimeout for the running ones
+// to end. The rest are sent a shutdown RST and canceled.
+func (h *Handler) drain() {
+	idle := h.sessions.drain()
+	if h.drainTimeout > 0 {
+		timer := time.NewTimer(h.drainTimeout)
+		defer timer.Stop()
+		select {
+		case <-idle:
+			return
+		case <-timer.C:
+		}
+	}
+
+	h.liveMu.Lock()
+	targets := make([]*liveSession, 0, len(h.live))
+	for ls := range h.live {
+		targets = append(targets, ls)
+	}
+	h.liveMu.Unlock()
+	// A peer that stopped reading blocks the write until cancel closes its
+	// connection.
+	for _, ls := range targets {
+		go func() {
+			ls.session.WriteFrame(ls.writer, encoding.FrameTypeClose, []byte{encoding.CloseRST, encoding.CloseErrorShutdown})
+			ls.cancel()
+		}()
+	}
+	select {
+	case <-idle:
+	case <-time.After(shutdownGrace):
+		for _, ls := range targets {
+			ls.cancel()
+		}
+	}
+}
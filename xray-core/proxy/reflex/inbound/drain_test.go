@@ -0,0 +1,86 @@
+package inbound
+
+import (
+	"context"
+	goerrors "errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestSessionGate(t *testing.T) {
+	g := sessionGate{max: 2}
+	if !g.enter() || !g.enter() {
+		t.Fatal("gate refused a session under its limit")
+	}
+	if g.enter() {
+		t.Fatal("gate admitted a session over its limit")
+	}
+	idle := g.drain()
+	g.leave()
+	if g.enter() {
+		t.Fatal("draining gate admitted a session")
+	}
+	select {
+	case <-idle:
+		t.Fatal("drained with a session left")
+	default:
+	}
+	g.leave()
+	<-idle
+	if g.drain() != idle {
+		t.Fatal("second drain made a new channel")
+	}
+}
+
+func TestMaxSessionsAndDrain(t *testing.T) {
+	h, c, dispatcher := startTestSession(t, nil)
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+		t.Fatal(err)
+	}
+	<-dispatcher.dest
+	copyErr := make(chan error, 1)
+	go func() { copyErr <- c.CopyTo(make(collectWriter, 16)) }()
+
+	// The running session takes the only slot.
+	h.sessions.max = 1
+	id, err := uuid.ParseString(h.users()[0].user.Account.(*reflex.MemoryAccount).ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	_, err = encoding.NewClientConn(context.Background(), clientConn, config)
+	var rejectedErr *encoding.RejectedError
+	if !goerrors.As(err, &rejectedErr) || rejectedErr.StatusCode != http.StatusServiceUnavailable || rejectedErr.Permanent() {
+		t.Fatalf("handshake over the limit: %v", err)
+	}
+
+	h.drainTimeout = 50 * time.Millisecond
+	start := time.Now()
+	h.Close()
+	if elapsed := time.Since(start); elapsed < h.drainTimeout {
+		t.Fatalf("close returned after %v, before the drain timeout", elapsed)
+	}
+	select {
+	case err := <-copyErr:
+		var closeErr *encoding.CloseError
+		if !goerrors.As(err, &closeErr) || closeErr.Code != encoding.CloseErrorShutdown {
+			t.Fatalf("session ended with %v, want a shutdown reset", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("session not reset by close")
+	}
+	if h.sessions.enter() {
+		t.Fatal("closed inbound admitted a session")
+	}
+}
@@ -0,0 +1,63 @@
+package inbound
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/pipe"
+)
+
+func TestFlowControlEndToEnd(t *testing.T) {
+	h, c, _ := startTestSession(t, &encoding.PolicyRequest{Features: []string{encoding.FeatureFlow}, Padding: encoding.PaddingNone})
+	if !c.Grant().Has(encoding.FeatureFlow) {
+		t.Fatalf("flow not granted: %v", c.Grant().Features)
+	}
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	up, upWriter := pipe.New(pipe.WithoutSizeLimit())
+	go c.CopyFrom(up)
+	received := make(collectWriter, 16)
+	go c.CopyTo(received)
+
+	// Unshaped, so the transfer is bounded by the windows, not by pacing.
+	// The server session is tracked once the destination has arrived.
+	c.Session().SetTrafficProfile(nil)
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(10 * time.Millisecond) {
+		h.liveMu.Lock()
+		for ls := range h.live {
+			ls.session.SetTrafficProfile(nil)
+		}
+		tracked := len(h.live) > 0
+		h.liveMu.Unlock()
+		if tracked {
+			break
+		}
+	}
+
+	// Several windows' worth each way needs updates from both sides.
+	msg := bytes.Repeat([]byte("0123456789abcdef"), 4*encoding.FlowWindowSize/16)
+	for b := msg; len(b) > 0; {
+		n := min(len(b), buf.Size)
+		if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes(b[:n])}); err != nil {
+			t.Fatal(err)
+		}
+		b = b[n:]
+	}
+	var echoed []byte
+	for len(echoed) < len(msg) {
+		select {
+		case b := <-received:
+			echoed = append(echoed, b...)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("echo stalled after %d of %d bytes", len(echoed), len(msg))
+		}
+	}
+	if !bytes.Equal(echoed, msg) {
+		t.Fatal("echo corrupted")
+	}
+}
@@ -0,0 +1,31 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestFragmentedHandshakeIsAccepted(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{Clients: []*reflex.User{{Id: id.String()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+	config := &encoding.ClientConfig{Fragment: &encoding.Fragment{MinLength: 1, MaxLength: 3, MaxInterval: time.Millisecond}}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "in pieces")
+}
@@ -0,0 +1,55 @@
+package inbound
+
+import (
+	"context"
+	gotls "crypto/tls"
+	"net"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol/tls/cert"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestReflexBehindTLS(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{Clients: []*reflex.User{{Id: id.String()}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	certPEM, keyPEM := cert.MustGenerate(nil, cert.DNSNames("reflex.example.com")).ToPEM()
+	pair, err := gotls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		// As a TLS or REALITY streamSettings hands its connection over.
+		tlsConn := gotls.Server(conn, &gotls.Config{Certificates: []gotls.Certificate{pair}})
+		in.(*Handler).Process(context.Background(), xnet.Network_TCP, tlsConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		tlsConn.Close()
+	}()
+
+	conn, err := gotls.Dial("tcp", ln.Addr().String(), &gotls.Config{ServerName: "reflex.example.com", InsecureSkipVerify: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), conn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "inside tls")
+}
@@ -0,0 +1,226 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	mathrand "math/rand"
+	"mime"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// requestTemplate is what the server expects of HTTP handshake requests.
+// Empty fields accept anything.
+type requestTemplate struct {
+	hosts  []string
+	paths  []string
+	header map[string]string
+	// required headers must be present, with any value.
+	required []string
+	// contentType is the media type the body must declare.
+	contentType string
+}
+
+func (t *requestTemplate) empty() bool {
+	return len(t.hosts) == 0 && len(t.paths) == 0 && len(t.header) == 0 && len(t.required) == 0 && t.contentType == ""
+}
+
+// matches reports whether req has an expected Host, path and headers. A
+// configured host without a port also matches the host with any port.
+// Header values may be secrets, so they are compared in constant time.
+func (t *requestTemplate) matches(req *http.Request) bool {
+	if len(t.hosts) > 0 {
+		hostname := req.Host
+		if h, _, err := net.SplitHostPort(req.Host); err == nil {
+			hostname = h
+		}
+		found := false
+		for _, host := range t.hosts {
+			if strings.EqualFold(host, req.Host) || strings.EqualFold(host, hostname) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	if len(t.paths) > 0 {
+		found := false
+		for _, path := range t.paths {
+			if path == req.URL.Path {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	for k, v := range t.header {
+		if subtle.ConstantTimeCompare([]byte(req.Header.Get(k)), []byte(v)) != 1 {
+			return false
+		}
+	}
+	for _, k := range t.required {
+		if len(req.Header.Values(k)) == 0 {
+			return false
+		}
+	}
+	if t.contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(req.Header.Get("Content-Type"))
+		if err != nil || !strings.EqualFold(mediaType, t.contentType) {
+			return false
+		}
+	}
+	return true
+}
+
+// peekRequestHead parses the request head buffered in reader without
+// consuming it, so a mismatching request can still be relayed whole.
+func peekRequestHead(reader *bufio.Reader) (*http.Request, error) {
+	for n := reader.Buffered(); ; n = reader.Buffered() + 1 {
+		if n > reader.Size() {
+			return nil, errors.New("http request head exceeds buffer")
+		}
+		peeked, err := reader.Peek(n)
+		if i := bytes.Index(peeked, []byte("\r\n\r\n")); i >= 0 {
+			return http.ReadRequest(bufio.NewReader(bytes.NewReader(peeked[:i+4])))
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// headerField is one header of a server preset. An empty value is derived
+// from the response, or left out.
+type headerField struct {
+	name  string
+	value string
+}
+
+// serverHeaders are the headers of a JSON API response as each server sends
+// them, in its order. An empty value is derived from the response. "go",
+// Go's net/http, is the default.
+var serverHeaders = map[string][]headerField{
+	"go": {
+		{"Content-Type", "application/json"},
+		{"Date", ""},
+		{"Content-Length", ""},
+	},
+	"nginx": {
+		{"Server", "nginx"},
+		{"Date", ""},
+		{"Content-Type", "application/json"},
+		{"Content-Length", ""},
+		{"Connection", "keep-alive"},
+		{"Cache-Control", "no-store"},
+		{"X-Request-Id", ""},
+	},
+	"cloudflare": {
+		{"Date", ""},
+		{"Content-Type", "application/json; charset=utf-8"},
+		{"Content-Length", ""},
+		{"Connection", "keep-alive"},
+		{"Cache-Control", "private, no-store"},
+		{"CF-Cache-Status", "DYNAMIC"},
+		{"Server", "cloudflare"},
+		{"CF-RAY", ""},
+	},
+	"apache": {
+		{"Date", ""},
+		{"Server", "Apache"},
+		{"Cache-Control", "no-cache, private"},
+		{"Content-Length", ""},
+		{"Keep-Alive", "timeout=5, max=100"},
+		{"Connection", "Keep-Alive"},
+		{"Content-Type", "application/json"},
+	},
+}
+
+// cloudflareColos are data centers a CF-RAY ID may name.
+var cloudflareColos = []string{"AMS", "CDG", "FRA", "LHR", "IAD", "EWR", "ORD", "SJC", "NRT", "SIN"}
+
+// KnownHTTPServer reports whether name is a server whose responses
+// http_server can imitate; empty means "go".
+func KnownHTTPServer(name string) bool {
+	_, ok := serverHeaders[name]
+	return ok || name == ""
+}
+
+// responseTemplate is how the server's HTTP handshake responses look.
+type responseTemplate struct {
+	// server names the serverHeaders preset.
+	server string
+	// header overrides the preset's values and adds headers after them.
+	header map[string]string
+	// colo is the data center of CF-RAY IDs, fixed per inbound like the
+	// edge nearest a real server.
+	colo string
+}
+
+func newResponseTemplate(server string, header map[string]string) responseTemplate {
+	return responseTemplate{
+		server: server,
+		header: header,
+		colo:   cloudflareColos[mathrand.Intn(len(cloudflareColos))],
+	}
+}
+
+// render returns a 200 response carrying body.
+func (t *responseTemplate) render(body []byte, now time.Time) []byte {
+	fields, ok := serverHeaders[t.server]
+	if !ok {
+		fields = serverHeaders["go"]
+	}
+	header := make(http.Header, len(t.header))
+	for k, v := range t.header {
+		header.Set(k, v)
+	}
+	derived := map[string]string{
+		"Date":           now.UTC().Format(http.TimeFormat),
+		"Content-Length": strconv.Itoa(len(body)),
+		"X-Request-Id":   randomHex(16),
+		"Cf-Ray":         randomHex(8) + "-" + t.colo,
+	}
+	out := []byte("HTTP/1.1 200 OK\r\n")
+	for _, f := range fields {
+		key := http.CanonicalHeaderKey(f.name)
+		value := header.Get(key)
+		if value == "" {
+			value = f.value
+		}
+		if value == "" {
+			value = derived[key]
+		}
+		header.Del(key)
+		out = append(out, f.name+": "+value+"\r\n"...)
+	}
+	keys := make([]string, 0, len(header))
+	for k := range header {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		out = append(out, k+": "+header.Get(k)+"\r\n"...)
+	}
+	out = append(out, "\r\n"...)
+	return append(out, body...)
+}
+
+// randomHex returns n random bytes in hex, as in request and ray IDs.
+func randomHex(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,227 @@
+package inbound
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestRequestTemplateMatches(t *testing.T) {
+	tmpl := requestTemplate{
+		hosts:  []string{"api.example.com"},
+		paths:  []string{"/v1/sync"},
+		header: map[string]string{"X-Client": "app"},
+	}
+	cases := []struct {
+		head string
+		want bool
+	}{
+		{"POST /v1/sync HTTP/1.1\r\nHost: API.example.com:443\r\nX-Client: app\r\n\r\n", true},
+		{"POST /v1/sync HTTP/1.1\r\nHost: other.example.com\r\nX-Client: app\r\n\r\n", false},
+		{"POST /v2/sync HTTP/1.1\r\nHost: api.example.com\r\nX-Client: app\r\n\r\n", false},
+		{"POST /v1/sync HTTP/1.1\r\nHost: api.example.com\r\n\r\n", false},
+	}
+	for _, tc := range cases {
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(tc.head)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := tmpl.matches(req); got != tc.want {
+			t.Errorf("matches(%q) = %v, want %v", tc.head, got, tc.want)
+		}
+	}
+	if !(&requestTemplate{}).empty() || tmpl.empty() {
+		t.Fatal("unexpected empty()")
+	}
+
+	strict := requestTemplate{required: []string{"Origin", "X-Token"}, contentType: "application/json"}
+	for head, want := range map[string]bool{
+		"POST / HTTP/1.1\r\nHost: a\r\nOrigin: https://a\r\nX-Token: t\r\nContent-Type: application/json; charset=utf-8\r\n\r\n": true,
+		"POST / HTTP/1.1\r\nHost: a\r\nOrigin: https://a\r\nX-Token:\r\nContent-Type: Application/JSON\r\n\r\n":                  true,
+		"POST / HTTP/1.1\r\nHost: a\r\nOrigin: https://a\r\nContent-Type: application/json\r\n\r\n":                              false,
+		"POST / HTTP/1.1\r\nHost: a\r\nOrigin: https://a\r\nX-Token: t\r\nContent-Type: text/plain\r\n\r\n":                      false,
+		"POST / HTTP/1.1\r\nHost: a\r\nOrigin: https://a\r\nX-Token: t\r\n\r\n":                                                  false,
+	} {
+		req, err := http.ReadRequest(bufio.NewReader(strings.NewReader(head)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := strict.matches(req); got != want {
+			t.Errorf("strict matches(%q) = %v, want %v", head, got, want)
+		}
+	}
+}
+
+func TestHTTPHandshakeWithTemplate(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:     []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+		HttpHosts:   []string{"api.example.com"},
+		HttpPaths:   []string{"/v1/sync"},
+		HttpHeaders: map[string]string{"X-Client": "app"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+
+	config := &encoding.ClientConfig{HTTP: &encoding.HTTPRequest{
+		Host:    "api.example.com",
+		Path:    "/v1/sync",
+		Header:  map[string]string{"X-Client": "app"},
+		Browser: "firefox",
+	}}
+	copy(config.UserID[:], id.Bytes())
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	c, err := encoding.NewClientConn(ctx, clientConn, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "fronted")
+}
+
+// recordingConn keeps what is read from it.
+type recordingConn struct {
+	net.Conn
+	read bytes.Buffer
+}
+
+func (c *recordingConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	c.read.Write(b[:n])
+	return n, err
+}
+
+func TestHTTPHandshakeUpgrade(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, browser := range []string{"", "chrome"} {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+
+		config := &encoding.ClientConfig{HTTP: &encoding.HTTPRequest{
+			Host:    "api.example.com",
+			Path:    "/v1/sync",
+			Browser: browser,
+			Upgrade: "sync/2",
+		}}
+		copy(config.UserID[:], id.Bytes())
+		conn := &recordingConn{Conn: clientConn}
+		c, err := encoding.NewClientConn(context.Background(), conn, config)
+		if err != nil {
+			t.Fatalf("%q: %v", browser, err)
+		}
+		if head := conn.read.String(); !strings.HasPrefix(head, "HTTP/1.1 101 Switching Protocols\r\n") || !strings.Contains(head, "Upgrade: sync/2\r\n") {
+			t.Fatalf("%q: server answered %q", browser, head)
+		}
+		assertEcho(t, c, "upgraded")
+		c.Close()
+	}
+}
+
+func TestHTTPTemplateMismatchFallsBackIntact(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		data, _ := io.ReadAll(c)
+		received <- data
+	}()
+
+	h := &Handler{httpTemplate: requestTemplate{paths: []string{"/v1/sync"}}}
+	h.current.Store(&settings{fallback: &reflex.Fallback{Dest: uint32(ln.Addr().(*net.TCPAddr).Port)}})
+	request := "POST /login HTTP/1.1\r\nHost: api.example.com\r\nContent-Length: 4\r\n\r\nuser"
+	conn := newFakeConn([]byte(request))
+	if err := h.handleReflexHTTP(context.Background(), bufio.NewReader(conn), conn, noOpDispatcher{}); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if string(data) != request {
+			t.Fatalf("fallback got %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fallback did not receive the request")
+	}
+}
+
+func TestResponseTemplate(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	body := []byte(`{"data":"x"}`)
+	headerNames := func(raw []byte) []string {
+		var names []string
+		for _, line := range strings.Split(string(raw), "\r\n")[1:] {
+			if line == "" {
+				break
+			}
+			names = append(names, strings.SplitN(line, ":", 2)[0])
+		}
+		return names
+	}
+
+	plain := responseTemplate{}
+	if got := strings.Join(headerNames(plain.render(body, now)), ","); got != "Content-Type,Date,Content-Length" {
+		t.Fatalf("default headers %s", got)
+	}
+
+	tmpl := newResponseTemplate("nginx", map[string]string{"Server": "nginx/1.24.0", "Vary": "Origin"})
+	raw := tmpl.render(body, now)
+	if got := strings.Join(headerNames(raw), ","); got != "Server,Date,Content-Type,Content-Length,Connection,Cache-Control,X-Request-Id,Vary" {
+		t.Fatalf("nginx headers %s", got)
+	}
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(raw)), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK || string(got) != string(body) {
+		t.Fatalf("response %d %q", resp.StatusCode, got)
+	}
+	if resp.Header.Get("Server") != "nginx/1.24.0" || resp.Header.Get("Date") != "Sun, 01 Mar 2026 12:00:00 GMT" {
+		t.Fatalf("headers %v", resp.Header)
+	}
+	if id := resp.Header.Get("X-Request-Id"); len(id) != 32 || bytes.Contains(tmpl.render(body, now), []byte(id)) {
+		t.Fatalf("request ID %q not fresh per response", id)
+	}
+
+	cf := newResponseTemplate("cloudflare", nil)
+	resp, err = http.ReadResponse(bufio.NewReader(bytes.NewReader(cf.render(body, now))), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ray := resp.Header.Get("CF-RAY"); len(ray) != 20 || !strings.HasSuffix(ray, "-"+cf.colo) {
+		t.Fatalf("CF-RAY %q", ray)
+	}
+	if !KnownHTTPServer("") || !KnownHTTPServer("apache") || KnownHTTPServer("iis") {
+		t.Fatal("KnownHTTPServer")
+	}
+}
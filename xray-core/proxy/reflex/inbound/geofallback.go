@@ -0,0 +1,51 @@
+package inbound
+
+import (
+	"net"
+
+	"github.com/xtls/xray-core/app/router"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// geoFallback is a decoy for clients whose address matcher matches.
+type geoFallback struct {
+	matcher router.GeoIPMatcher
+	dest    uint32
+}
+
+// compileFallback builds the GeoIP matchers of f and indexes them by f, so
+// fallbackDest can pick a decoy per client. Fallbacks without GeoIP entries
+// need nothing compiled.
+func (s *settings) compileFallback(f *reflex.Fallback) error {
+	s.addPrefetch(f)
+	if len(f.GetGeo()) == 0 {
+		return nil
+	}
+	routes := make([]geoFallback, 0, len(f.GetGeo()))
+	for _, geo := range f.GetGeo() {
+		matcher, err := router.BuildOptimizedGeoIPMatcher(geo.GetGeoip()...)
+		if err != nil {
+			return errors.New("invalid reflex geoip fallback").Base(err)
+		}
+		routes = append(routes, geoFallback{matcher: matcher, dest: geo.GetDest()})
+	}
+	if s.geoFallbacks == nil {
+		s.geoFallbacks = make(map[*reflex.Fallback][]geoFallback)
+	}
+	s.geoFallbacks[f] = routes
+	return nil
+}
+
+// fallbackDest returns the port of f's decoy for a client at ip: the first
+// GeoIP entry that matches, or else f's own dest.
+func (s *settings) fallbackDest(f *reflex.Fallback, ip net.IP) uint32 {
+	if ip != nil {
+		for _, route := range s.geoFallbacks[f] {
+			if route.matcher.Match(ip) {
+				return route.dest
+			}
+		}
+	}
+	return f.GetDest()
+}
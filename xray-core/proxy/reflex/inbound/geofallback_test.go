@@ -0,0 +1,77 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/app/router"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+func TestGeoFallbackPicksDecoyBySource(t *testing.T) {
+	listen := func() (uint32, chan []byte) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		received := make(chan []byte, 1)
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			data, _ := io.ReadAll(c)
+			received <- data
+		}()
+		return uint32(ln.Addr().(*net.TCPAddr).Port), received
+	}
+	genericPort, generic := listen()
+	localPort, local := listen()
+
+	fallback := &reflex.Fallback{
+		Dest: genericPort,
+		Geo: []*reflex.GeoFallback{{
+			Geoip: []*router.GeoIP{{Cidr: []*router.CIDR{{Ip: net.ParseIP("192.0.2.0").To4(), Prefix: 24}}}},
+			Dest:  localPort,
+		}},
+	}
+	in, err := New(context.Background(), &reflex.InboundConfig{Fallback: fallback})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	if dest := h.settings().fallbackDest(fallback, nil); dest != genericPort {
+		t.Fatalf("unknown source sent to %d", dest)
+	}
+
+	probe := func(source, payload string) {
+		ctx := session.ContextWithInbound(context.Background(), &session.Inbound{
+			Source: xnet.TCPDestination(xnet.ParseAddress(source), 40000),
+		})
+		if err := h.fallbackTo(ctx, bufio.NewReader(strings.NewReader(payload)), newFakeConn(nil), fallback); err != nil {
+			t.Fatal(err)
+		}
+	}
+	probe("192.0.2.33", "domestic")
+	probe("198.51.100.1", "foreign")
+
+	for name, c := range map[string]chan []byte{"domestic": local, "foreign": generic} {
+		select {
+		case data := <-c:
+			if string(data) != name {
+				t.Fatalf("%s decoy got %q", name, data)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatalf("%s decoy got nothing", name)
+		}
+	}
+}
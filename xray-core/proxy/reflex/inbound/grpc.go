@@ -0,0 +1,55 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"net/http"
+
+	"golang.org/x/net/http2"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+const (
+	http2Preface = "PRI *"
+)
+
+// handleGRPC serves an HTTP/2 connection on which the configured streaming
+// method carries Reflex sessions. Other calls are answered as unimplemented.
+func (h *Handler) handleGRPC(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher) error {
+	path := encoding.GRPCPath(h.grpcService, h.grpcMethod)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost || r.URL.Path != path || r.Header.Get("Content-Type") != "application/grpc" {
+			w.Header().Set("Content-Type", "application/grpc")
+			w.Header().Set("Grpc-Status", "12")
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		w.Header().Set("Content-Type", "application/grpc")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.WriteHeader(http.StatusOK)
+		flusher, _ := w.(http.Flusher)
+		flusher.Flush()
+
+		stream := encoding.NewGRPCStreamConn(conn, r.Body, w, flusher.Flush)
+		streamReader := bufio.NewReader(stream)
+		peeked, err := peekForDetection(streamReader, 4)
+		if err == nil && h.isReflexMagic(peeked) {
+			err = h.handleReflexMagic(ctx, streamReader, stream, dispatcher)
+		}
+		if err != nil {
+			errors.LogInfoInner(ctx, err, "reflex grpc stream ended")
+		}
+		stream.Close()
+		w.Header().Set("Grpc-Status", "0")
+	})
+	server := &http2.Server{}
+	server.ServeConn(&preloadedConn{Reader: reader, Connection: conn}, &http2.ServeConnOpts{
+		Context: ctx,
+		Handler: handler,
+	})
+	return nil
+}
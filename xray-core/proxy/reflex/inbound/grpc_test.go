@@ -0,0 +1,43 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestGRPCSessionEndToEnd(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:     []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+		GrpcService: "example.Tunnel",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	dispatcher := echoDispatcher{dest: make(chan xnet.Destination, 1)}
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stream, err := encoding.DialGRPC(ctx, clientConn, "lb.example.com", "example.Tunnel", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(ctx, stream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "over grpc")
+}
@@ -2,10 +2,8 @@ package inbound
 
 import (
 	"bufio"
+	"bytes"
 	"context"
-	"crypto/ecdh"
-	"crypto/rand"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"encoding/json"
@@ -15,43 +13,24 @@ import (
 	"net/http"
 	"time"
 
-	"golang.org/x/crypto/chacha20poly1305"
-	"golang.org/x/crypto/hkdf"
+	"golang.org/x/net/http/httpguts"
 
 	"github.com/xtls/xray-core/common/errors"
 	"github.com/xtls/xray-core/common/protocol"
-	"github.com/xtls/xray-core/common/uuid"
 	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	"github.com/xtls/xray-core/transport/internet/stat"
 )
 
 const (
-	ReflexMagic            uint32 = 0x5246584C // REFX
-	reflexMinHandshakeSize        = 64
-	maxPolicyPayloadSize          = 4096
-	handshakeSkew                 = 5 * time.Minute
-	defaultNonceLifetime          = 15 * time.Minute
+	reflexMinHandshakeSize = 64
+	defaultNonceLifetime   = 15 * time.Minute
+	// defaultResponseFloor is how soon after it arrives a handshake is
+	// answered at the earliest, unless handshake_response_floor is set.
+	defaultResponseFloor = 10 * time.Millisecond
 )
 
-// ClientHandshake is the parsed handshake payload from the client.
-type ClientHandshake struct {
-	PublicKey [32]byte
-	UserID    [16]byte
-	PolicyReq []byte
-	Timestamp int64
-	Nonce     [16]byte
-}
-
-// ServerHandshake is the handshake payload sent by the server.
-type ServerHandshake struct {
-	PublicKey   [32]byte
-	PolicyGrant []byte
-}
-
-type handshakeHTTPEnvelope struct {
-	Data string `json:"data"`
-}
-
 type preloadedConn struct {
 	*bufio.Reader
 	stat.Connection
@@ -77,7 +56,7 @@ func peekForDetection(reader *bufio.Reader, n int) ([]byte, error) {
 }
 
 func (h *Handler) isReflexMagic(data []byte) bool {
-	return len(data) >= 4 && binary.BigEndian.Uint32(data[:4]) == ReflexMagic
+	return len(data) >= 4 && binary.BigEndian.Uint32(data[:4]) == encoding.ReflexMagic
 }
 
 func (h *Handler) isHTTPPostLike(data []byte) bool {
@@ -96,18 +75,24 @@ func (h *Handler) handleReflexMagic(ctx context.Context, reader *bufio.Reader, c
 	if _, err := io.ReadFull(reader, magic[:]); err != nil {
 		return err
 	}
-	if binary.BigEndian.Uint32(magic[:]) != ReflexMagic {
+	if binary.BigEndian.Uint32(magic[:]) != encoding.ReflexMagic {
 		return h.handleFallback(ctx, reader, conn)
 	}
 
-	clientHS, err := readBinaryHandshake(reader)
+	clientHS, err := encoding.ReadBinaryHandshake(reader)
 	if err != nil {
 		return h.handleFallback(ctx, reader, conn)
 	}
-	return h.processHandshake(ctx, reader, conn, dispatcher, clientHS)
+	return h.processHandshake(ctx, reader, conn, dispatcher, clientHS, h.httpReply(conn))
 }
 
 func (h *Handler) handleReflexHTTP(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher) error {
+	if !h.httpTemplate.empty() {
+		head, err := peekRequestHead(reader)
+		if err != nil || !h.httpTemplate.matches(head) {
+			return h.handleFallback(ctx, reader, conn)
+		}
+	}
 	req, err := http.ReadRequest(reader)
 	if err != nil {
 		return h.handleFallback(ctx, reader, conn)
@@ -117,12 +102,15 @@ func (h *Handler) handleReflexHTTP(ctx context.Context, reader *bufio.Reader, co
 	if req.Method != http.MethodPost {
 		return h.handleFallback(ctx, reader, conn)
 	}
+	if isChunked(req.TransferEncoding) {
+		return h.handleChunkedHTTP(ctx, req, conn, dispatcher)
+	}
 
-	body, err := io.ReadAll(io.LimitReader(req.Body, maxPolicyPayloadSize))
+	body, err := io.ReadAll(io.LimitReader(req.Body, encoding.MaxHandshakeBodySize))
 	if err != nil {
 		return h.handleFallback(ctx, reader, conn)
 	}
-	var envelope handshakeHTTPEnvelope
+	var envelope encoding.HandshakeHTTPEnvelope
 	if err := json.Unmarshal(body, &envelope); err != nil {
 		return h.handleFallback(ctx, reader, conn)
 	}
@@ -131,172 +119,199 @@ func (h *Handler) handleReflexHTTP(ctx context.Context, reader *bufio.Reader, co
 	if err != nil {
 		return h.handleFallback(ctx, reader, conn)
 	}
-	if len(rawPayload) >= 4 && binary.BigEndian.Uint32(rawPayload[:4]) == ReflexMagic {
+	if len(rawPayload) >= 4 && binary.BigEndian.Uint32(rawPayload[:4]) == encoding.ReflexMagic {
 		rawPayload = rawPayload[4:]
 	}
 
-	clientHS, err := parseBinaryHandshake(rawPayload)
+	clientHS, err := encoding.ParseBinaryHandshake(rawPayload)
 	if err != nil {
 		return h.handleFallback(ctx, reader, conn)
 	}
-	return h.processHandshake(ctx, reader, conn, dispatcher, clientHS)
-}
-
-func readBinaryHandshake(r io.Reader) (ClientHandshake, error) {
-	var head [32 + 16 + 8 + 16 + 2]byte
-	if _, err := io.ReadFull(r, head[:]); err != nil {
-		return ClientHandshake{}, err
+	reply := h.httpReply(conn)
+	if protocol := upgradeProtocol(req); protocol != "" {
+		reply = upgradeReply(conn, protocol)
 	}
+	return h.processHandshake(ctx, reader, conn, dispatcher, clientHS, reply)
+}
 
-	var hs ClientHandshake
-	copy(hs.PublicKey[:], head[0:32])
-	copy(hs.UserID[:], head[32:48])
-	hs.Timestamp = int64(binary.BigEndian.Uint64(head[48:56]))
-	copy(hs.Nonce[:], head[56:72])
-	policyLen := binary.BigEndian.Uint16(head[72:74])
+// handshakeReply sends the server handshake in the envelope the client used
+// and returns the connection the session continues on.
+type handshakeReply func(encoding.ServerHandshake) (stat.Connection, error)
 
-	if policyLen > maxPolicyPayloadSize {
-		return ClientHandshake{}, errors.New("reflex handshake policy too large")
+// httpReply answers with a JSON envelope in a plain HTTP response shaped by
+// the inbound's response template, after which frames follow on conn
+// directly.
+func (h *Handler) httpReply(conn stat.Connection) handshakeReply {
+	return func(hs encoding.ServerHandshake) (stat.Connection, error) {
+		return conn, writeHandshakeResponse(conn, hs, &h.httpResponse)
 	}
-	if policyLen > 0 {
-		hs.PolicyReq = make([]byte, policyLen)
-		if _, err := io.ReadFull(r, hs.PolicyReq); err != nil {
-			return ClientHandshake{}, err
+}
+
+// upgradeReply answers a handshake that asked to upgrade to protocol with a
+// 101 response, after which the switched protocol opens with the
+// length-prefixed handshake.
+func upgradeReply(conn stat.Connection, protocol string) handshakeReply {
+	return func(hs encoding.ServerHandshake) (stat.Connection, error) {
+		var out bytes.Buffer
+		fmt.Fprintf(&out, "HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: %s\r\n\r\n", protocol)
+		if err := encoding.WriteStreamedHandshake(&out, hs); err != nil {
+			return nil, err
 		}
+		_, err := conn.Write(out.Bytes())
+		return conn, err
 	}
-	return hs, nil
 }
 
-func parseBinaryHandshake(raw []byte) (ClientHandshake, error) {
-	if len(raw) < 74 {
-		return ClientHandshake{}, errors.New("reflex handshake too short")
-	}
-	policyLen := int(binary.BigEndian.Uint16(raw[72:74]))
-	if policyLen > maxPolicyPayloadSize {
-		return ClientHandshake{}, errors.New("reflex handshake policy too large")
-	}
-	if len(raw) != 74+policyLen {
-		return ClientHandshake{}, errors.New("reflex handshake malformed payload length")
-	}
-	var hs ClientHandshake
-	copy(hs.PublicKey[:], raw[0:32])
-	copy(hs.UserID[:], raw[32:48])
-	hs.Timestamp = int64(binary.BigEndian.Uint64(raw[48:56]))
-	copy(hs.Nonce[:], raw[56:72])
-	if policyLen > 0 {
-		hs.PolicyReq = append([]byte(nil), raw[74:]...)
+// upgradeProtocol returns the protocol req asks to upgrade to, if any.
+func upgradeProtocol(req *http.Request) string {
+	if !httpguts.HeaderValuesContainsToken(req.Header["Connection"], "upgrade") {
+		return ""
 	}
-	return hs, nil
+	return req.Header.Get("Upgrade")
 }
 
-func (h *Handler) processHandshake(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher, clientHS ClientHandshake) error {
-	if err := validateHandshakeTimestamp(clientHS.Timestamp); err != nil {
-		_ = writeHTTPError(conn, http.StatusForbidden)
-		return h.handleFallback(ctx, reader, conn)
-	}
-	if !h.checkAndStoreNonce(clientHS.Nonce) {
-		_ = writeHTTPError(conn, http.StatusForbidden)
+func (h *Handler) processHandshake(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher, clientHS encoding.ClientHandshake, reply handshakeReply) error {
+	// Every answer waits for the floor, so how soon it comes doesn't tell
+	// whether or at which check a handshake failed.
+	floor := time.Now().Add(h.responseFloor)
+	holdUntilFloor := func() { time.Sleep(time.Until(floor)) }
+	ctx = withSessionID(ctx)
+	source := sourceIP(ctx, conn)
+	refuse := func(reason rejectReason, hs *encoding.ClientHandshake) error {
+		h.rejectHandshake(ctx, source, reason, hs)
+		holdUntilFloor()
+		if reason == rejectPuzzle {
+			_ = h.writePuzzleChallenge(ctx, conn)
+		} else {
+			_ = h.writeErrorPage(ctx, conn, http.StatusForbidden)
+		}
 		return h.handleFallback(ctx, reader, conn)
 	}
-
-	serverPriv, serverPub, err := generateKeyPair()
-	if err != nil {
-		_ = writeHTTPError(conn, http.StatusInternalServerError)
+	fail := func(err error) error {
+		holdUntilFloor()
+		_ = h.writeErrorPage(ctx, conn, http.StatusInternalServerError)
 		return err
 	}
-	sharedKey, err := deriveSharedKey(serverPriv, clientHS.PublicKey)
-	if err != nil {
-		_ = writeHTTPError(conn, http.StatusForbidden)
-		return h.handleFallback(ctx, reader, conn)
+	if h.bans.banned(source, time.Now()) {
+		return refuse(rejectBanned, nil)
+	}
+	if !h.puzzle.admit(&clientHS, time.Now()) {
+		return refuse(rejectPuzzle, &clientHS)
 	}
-	sessionKey, err := deriveSessionKey(sharedKey[:], clientHS.Nonce[:])
+	// Past the puzzle, the key agreement is done before any other check, so
+	// that work is part of every outcome.
+	serverPriv, serverPub, err := encoding.GenerateKeyPair()
 	if err != nil {
-		_ = writeHTTPError(conn, http.StatusInternalServerError)
-		return err
+		return fail(err)
 	}
-
-	user, err := h.authenticateUser(clientHS.UserID)
+	sharedKey, err := encoding.DeriveSharedKey(serverPriv, clientHS.PublicKey)
 	if err != nil {
-		_ = writeHTTPError(conn, http.StatusForbidden)
-		return h.handleFallback(ctx, reader, conn)
+		return refuse(rejectKey, &clientHS)
 	}
-
-	grant, err := encryptPolicyGrant(sessionKey, userPolicy(user))
+	if err := encoding.ValidateHandshakeTimestamp(clientHS.Timestamp); err != nil {
+		return refuse(rejectTimestamp, &clientHS)
+	}
+	// Legacy clients send their UUID, which no binding can tie to this
+	// server.
+	if clientHS.Versions == 0 && len(h.binding) > 0 {
+		return refuse(rejectVersion, &clientHS)
+	}
+	var version uint8
+	if clientHS.Versions != 0 {
+		v, ok := encoding.SelectProtocolVersion(clientHS.Versions)
+		if !ok {
+			return refuse(rejectVersion, &clientHS)
+		}
+		version = v
+	}
+	sessionKey, err := encoding.DeriveSessionKey(encoding.MixPSK(sharedKey, h.psk), clientHS.Nonce[:], encoding.SessionKeyInfo(clientHS, serverPub, version))
 	if err != nil {
-		_ = writeHTTPError(conn, http.StatusInternalServerError)
-		return err
+		return fail(err)
 	}
 
-	serverHS := ServerHandshake{PublicKey: serverPub, PolicyGrant: grant}
-	if err := writeHandshakeResponse(conn, serverHS); err != nil {
-		return err
+	user, err := h.authenticateHandshake(&clientHS)
+	if err != nil && h.authBackend != nil {
+		user, err = h.authBackend.authenticate(ctx, &clientHS)
 	}
-
-	return h.handleSession(ctx, reader, conn, dispatcher, sessionKey, user)
-}
-
-func validateHandshakeTimestamp(ts int64) error {
-	t := time.Unix(ts, 0)
-	now := time.Now()
-	if t.Before(now.Add(-handshakeSkew)) || t.After(now.Add(handshakeSkew)) {
-		return errors.New("reflex handshake timestamp out of range")
+	if err != nil {
+		return refuse(rejectAuth, &clientHS)
+	}
+	// Only authenticated handshakes take a place in the nonce cache, so a
+	// flood of made-up ones can't fill it.
+	if !h.checkAndStoreNonce(clientHS.Nonce) {
+		return refuse(rejectReplay, &clientHS)
+	}
+	if account, ok := user.Account.(*reflex.MemoryAccount); ok {
+		reason := rejectReason("")
+		switch {
+		case !account.Admits(source):
+			reason = rejectSource
+		case !account.ExpiresAt.IsZero() && !time.Now().Before(account.ExpiresAt):
+			reason = rejectExpired
+		case account.Quota > 0 && h.traffic.user(user.Email).used() >= account.Quota:
+			reason = rejectQuota
+		}
+		if reason != "" {
+			return refuse(reason, &clientHS)
+		}
 	}
-	return nil
-}
 
-func generateKeyPair() ([]byte, [32]byte, error) {
-	privateKey, err := ecdh.X25519().GenerateKey(rand.Reader)
+	policy := h.negotiatePolicy(user, clientHS.PolicyReq)
+	policy.version = version
+	plainGrant, cut := policy.handshakeGrant(sessionKey)
+	// Before version 5 the cut grant is all the client gets.
+	policy.deferred = cut && version >= encoding.ProtocolVersion5
+	grant, err := encoding.EncryptPolicyGrant(sessionKey, plainGrant)
 	if err != nil {
-		return nil, [32]byte{}, err
+		return fail(err)
 	}
-	pub := privateKey.PublicKey().Bytes()
-	var publicKey [32]byte
-	copy(publicKey[:], pub)
-	return privateKey.Bytes(), publicKey, nil
-}
 
-func deriveSharedKey(privateKey []byte, peerPublic [32]byte) ([32]byte, error) {
-	// X25519 is the Montgomery form of Curve25519 used for ECDH key agreement.
-	priv, err := ecdh.X25519().NewPrivateKey(privateKey)
+	serverHS := encoding.ServerHandshake{PublicKey: serverPub, PolicyGrant: grant, Version: version}
+	serverHS.Padding, err = encoding.HandshakePadding(h.profiles.Profile(policy.Downlink), 37+len(grant))
 	if err != nil {
-		return [32]byte{}, err
+		return fail(err)
 	}
-	peer, err := ecdh.X25519().NewPublicKey(peerPublic[:])
-	if err != nil {
-		return [32]byte{}, err
+	holdUntilFloor()
+	if !h.sessions.enter() {
+		_ = h.writeErrorPage(ctx, conn, http.StatusServiceUnavailable)
+		return errors.New("reflex inbound is draining or at max sessions")
 	}
-	secret, err := priv.ECDH(peer)
+	sessionConn, err := reply(serverHS)
 	if err != nil {
-		return [32]byte{}, err
+		h.sessions.leave()
+		return err
+	}
+	h.acceptHandshake(ctx, source, user)
+
+	err = h.handleSession(ctx, reader, sessionConn, dispatcher, sessionKey, user, policy)
+	h.sessions.leave()
+	if fallback := userFallback(user); fallback != nil && isPolicyViolation(err) {
+		errors.LogInfoInner(ctx, err, "reflex session handed to user fallback")
+		return h.fallbackTo(ctx, reader, sessionConn, fallback)
 	}
-	var shared [32]byte
-	copy(shared[:], secret)
-	return shared, nil
+	return err
 }
 
-func deriveSessionKey(sharedKey, salt []byte) ([]byte, error) {
-	r := hkdf.New(sha256.New, sharedKey, salt, []byte("reflex-session"))
-	key := make([]byte, chacha20poly1305.KeySize)
-	if _, err := io.ReadFull(r, key); err != nil {
-		return nil, err
+// authenticateHandshake finds the user behind hs. Clients that negotiate a
+// protocol version send a userToken; older ones send their UUID. Either is
+// looked up in an index, so the work per handshake doesn't grow with the
+// number of users.
+func (h *Handler) authenticateHandshake(hs *encoding.ClientHandshake) (*protocol.MemoryUser, error) {
+	if hs.Versions == 0 {
+		return h.authenticateUser(hs.UserID)
+	}
+	if found := h.tokens.lookup(hs, h.binding); found != nil {
+		return found, nil
 	}
-	return key, nil
+	return nil, errors.New("reflex user not found")
 }
 
+// authenticateUser finds the user with the UUID a legacy client sent. The
+// index hashes the whole ID, so unlike comparing strings the time taken
+// doesn't depend on how much of an ID matched.
 func (h *Handler) authenticateUser(userID [16]byte) (*protocol.MemoryUser, error) {
-	uid, err := uuid.ParseBytes(userID[:])
-	if err != nil {
-		return nil, err
-	}
-	uidStr := uid.String()
-	for _, user := range h.clients {
-		account, ok := user.Account.(*MemoryAccount)
-		if !ok {
-			continue
-		}
-		if account.ID == uidStr {
-			return user, nil
-		}
+	if user := h.userByID(userID); user != nil {
+		return user, nil
 	}
 	return nil, errors.New("reflex user not found")
 }
@@ -305,41 +320,29 @@ func userPolicy(user *protocol.MemoryUser) string {
 	if user == nil {
 		return ""
 	}
-	if account, ok := user.Account.(*MemoryAccount); ok {
+	if account, ok := user.Account.(*reflex.MemoryAccount); ok {
 		return account.Policy
 	}
 	return ""
 }
 
-func encryptPolicyGrant(sessionKey []byte, policy string) ([]byte, error) {
-	aead, err := chacha20poly1305.New(sessionKey)
-	if err != nil {
-		return nil, err
+func userFallback(user *protocol.MemoryUser) *reflex.Fallback {
+	if user == nil {
+		return nil
 	}
-	nonce := make([]byte, chacha20poly1305.NonceSize)
-	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
-		return nil, err
+	if account, ok := user.Account.(*reflex.MemoryAccount); ok && (account.Fallback.GetDest() != 0 || len(account.Fallback.GetGeo()) > 0) {
+		return account.Fallback
 	}
-	ciphertext := aead.Seal(nil, nonce, []byte(policy), nil)
-	return append(nonce, ciphertext...), nil
-}
-
-func marshalServerHandshake(hs ServerHandshake) []byte {
-	policyLen := len(hs.PolicyGrant)
-	payload := make([]byte, 32+2+policyLen)
-	copy(payload[:32], hs.PublicKey[:])
-	binary.BigEndian.PutUint16(payload[32:34], uint16(policyLen))
-	copy(payload[34:], hs.PolicyGrant)
-	return payload
+	return nil
 }
 
-func writeHandshakeResponse(w io.Writer, hs ServerHandshake) error {
-	encoded := base64.StdEncoding.EncodeToString(marshalServerHandshake(hs))
-	body, err := json.Marshal(handshakeHTTPEnvelope{Data: encoded})
+func writeHandshakeResponse(w io.Writer, hs encoding.ServerHandshake, t *responseTemplate) error {
+	encoded := base64.StdEncoding.EncodeToString(encoding.MarshalServerHandshake(hs))
+	body, err := json.Marshal(encoding.HandshakeHTTPEnvelope{Data: encoded})
 	if err != nil {
 		return err
 	}
-	_, err = fmt.Fprintf(w, "HTTP/1.1 200 OK\r\nContent-Type: application/json\r\nContent-Length: %d\r\nConnection: keep-alive\r\n\r\n%s", len(body), body)
+	_, err = w.Write(t.render(body, time.Now()))
 	return err
 }
 
@@ -353,33 +356,31 @@ func writeHTTPError(w io.Writer, status int) error {
 	return err
 }
 
-func (h *Handler) checkAndStoreNonce(nonce [16]byte) bool {
-	h.nonceMu.Lock()
-	defer h.nonceMu.Unlock()
-
-	now := time.Now().Unix()
-	h.cleanupExpiredNonces(now)
-	if _, ok := h.seenNonces[nonce]; ok {
-		return false
-	}
-	h.seenNonces[nonce] = now
-	return true
-}
-
-func (h *Handler) cleanupExpiredNonces(now int64) {
-	for nonce, ts := range h.seenNonces {
-		if now-ts > int64(h.nonceLifetime/time.Second) {
-			delete(h.seenNonces, nonce)
-		}
+func (h *Handler) handleFallback(ctx context.Context, reader *bufio.Reader, conn stat.Connection) error {
+	fallback := h.settings().fallback
+	if fallback == nil {
+		h.refuseUnmatched(ctx, conn)
+		return errors.New("reflex handshake not matched and fallback is not configured")
 	}
+	return h.fallbackTo(ctx, reader, conn, fallback)
 }
 
-func (h *Handler) handleFallback(ctx context.Context, reader *bufio.Reader, conn stat.Connection) error {
-	_ = ctx
-	if h.fallback == nil || h.fallback.Dest == 0 {
+// fallbackTo relays the remaining connection, including anything still
+// buffered in reader, to the given fallback destination.
+func (h *Handler) fallbackTo(ctx context.Context, reader *bufio.Reader, conn stat.Connection, fallback *reflex.Fallback) error {
+	settings := h.settings()
+	dest := settings.fallbackDest(fallback, sourceIP(ctx, conn))
+	if dest == 0 {
+		h.refuseUnmatched(ctx, conn)
 		return errors.New("reflex handshake not matched and fallback is not configured")
 	}
-	target, err := stdnet.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", h.fallback.Dest))
+	h.metrics.fallback()
+	if cache := settings.decoys[dest]; cache != nil {
+		if closed, err := cache.serve(reader, conn); closed || err != nil {
+			return err
+		}
+	}
+	target, err := stdnet.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", dest))
 	if err != nil {
 		return err
 	}
@@ -20,6 +20,8 @@ import (
 	"github.com/xtls/xray-core/common/protocol"
 	"github.com/xtls/xray-core/common/uuid"
 	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	"github.com/xtls/xray-core/transport"
 )
 
@@ -53,7 +55,7 @@ func (noOpDispatcher) DispatchLink(context.Context, xnet.Destination, *transport
 	return io.EOF
 }
 
-func buildClientHandshake(t *testing.T, id [16]byte, ts int64, nonce [16]byte, policy []byte) ClientHandshake {
+func buildClientHandshake(t *testing.T, id [16]byte, ts int64, nonce [16]byte, policy []byte) encoding.ClientHandshake {
 	t.Helper()
 	curve := ecdh.X25519()
 	priv, err := curve.GenerateKey(rand.Reader)
@@ -63,7 +65,7 @@ func buildClientHandshake(t *testing.T, id [16]byte, ts int64, nonce [16]byte, p
 
 	var pub [32]byte
 	copy(pub[:], priv.PublicKey().Bytes())
-	return ClientHandshake{
+	return encoding.ClientHandshake{
 		PublicKey: pub,
 		UserID:    id,
 		PolicyReq: policy,
@@ -72,7 +74,7 @@ func buildClientHandshake(t *testing.T, id [16]byte, ts int64, nonce [16]byte, p
 	}
 }
 
-func marshalClientHandshake(hs ClientHandshake) []byte {
+func marshalClientHandshake(hs encoding.ClientHandshake) []byte {
 	raw := make([]byte, 74+len(hs.PolicyReq))
 	copy(raw[0:32], hs.PublicKey[:])
 	copy(raw[32:48], hs.UserID[:])
@@ -107,75 +109,14 @@ func TestPeekForDetection(t *testing.T) {
 	}
 }
 
-func TestBinaryHandshakeRoundTrip(t *testing.T) {
-	var id [16]byte
-	copy(id[:], []byte("0123456789abcdef"))
-	var nonce [16]byte
-	copy(nonce[:], []byte("fedcba9876543210"))
-
-	hs := ClientHandshake{
-		UserID:    id,
-		Timestamp: time.Now().Unix(),
-		Nonce:     nonce,
-		PolicyReq: []byte(`{"mode":"test"}`),
-	}
-	raw := marshalClientHandshake(hs)
-
-	parsed, err := parseBinaryHandshake(raw)
-	if err != nil {
-		t.Fatalf("parse failed: %v", err)
-	}
-	if parsed.Timestamp != hs.Timestamp {
-		t.Fatalf("timestamp mismatch: got=%d want=%d", parsed.Timestamp, hs.Timestamp)
-	}
-
-	readParsed, err := readBinaryHandshake(bytes.NewReader(raw))
-	if err != nil {
-		t.Fatalf("read failed: %v", err)
-	}
-	if !bytes.Equal(readParsed.PolicyReq, hs.PolicyReq) {
-		t.Fatalf("policy mismatch: got=%q want=%q", string(readParsed.PolicyReq), string(hs.PolicyReq))
-	}
-}
-
-func TestValidateHandshakeTimestamp(t *testing.T) {
-	if err := validateHandshakeTimestamp(time.Now().Unix()); err != nil {
-		t.Fatalf("expected valid timestamp: %v", err)
-	}
-	if err := validateHandshakeTimestamp(time.Now().Add(-10 * time.Minute).Unix()); err == nil {
-		t.Fatal("expected timestamp out of range")
-	}
-}
-
-func TestNonceStoreAndCleanup(t *testing.T) {
-	h := &Handler{
-		seenNonces:    make(map[[16]byte]int64),
-		nonceLifetime: time.Second,
-	}
-	var nonce [16]byte
-	nonce[0] = 1
-	if !h.checkAndStoreNonce(nonce) {
-		t.Fatal("first nonce insert should pass")
-	}
-	if h.checkAndStoreNonce(nonce) {
-		t.Fatal("duplicate nonce should fail")
-	}
-	h.seenNonces[nonce] = time.Now().Add(-3 * time.Second).Unix()
-	h.cleanupExpiredNonces(time.Now().Unix())
-	if len(h.seenNonces) != 0 {
-		t.Fatal("expected expired nonce cleanup")
-	}
-}
-
 func TestAuthenticateUserAndPolicy(t *testing.T) {
 	id := uuid.New()
-	h := &Handler{
-		clients: []*protocol.MemoryUser{
-			{
-				Email:   id.String(),
-				Account: &MemoryAccount{ID: id.String(), Policy: "p"},
-			},
-		},
+	h := &Handler{userStore: &userStore{}}
+	if err := h.addUser(&protocol.MemoryUser{
+		Email:   id.String(),
+		Account: &reflex.MemoryAccount{ID: id.String(), Policy: "p"},
+	}); err != nil {
+		t.Fatal(err)
 	}
 	var userID [16]byte
 	copy(userID[:], id.Bytes())
@@ -189,46 +130,64 @@ func TestAuthenticateUserAndPolicy(t *testing.T) {
 	}
 }
 
-func TestKeyDerivationAndPolicyEncrypt(t *testing.T) {
-	privA, pubA, err := generateKeyPair()
-	if err != nil {
-		t.Fatal(err)
-	}
-	privB, pubB, err := generateKeyPair()
-	if err != nil {
-		t.Fatal(err)
-	}
-	sharedA, err := deriveSharedKey(privA, pubB)
+func TestAuthenticateHandshakeToken(t *testing.T) {
+	id := uuid.New()
+	other := uuid.New()
+	h := &Handler{userStore: &userStore{}}
+	for _, user := range []*protocol.MemoryUser{
+		{Email: "other", Account: &reflex.MemoryAccount{ID: other.String()}},
+		{Email: id.String(), Account: &reflex.MemoryAccount{ID: id.String(), Policy: "p"}},
+	} {
+		if err := h.addUser(user); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var raw [16]byte
+	copy(raw[:], id.Bytes())
+	hs := encoding.ClientHandshake{Timestamp: time.Now().Unix(), Versions: encoding.OfferedVersions(0)}
+	hs.PublicKey[0] = 1
+	hs.UserID = encoding.UserToken(raw, hs.PublicKey, hs.Timestamp, nil)
+
+	user, err := h.authenticateHandshake(&hs)
 	if err != nil {
 		t.Fatal(err)
 	}
-	sharedB, err := deriveSharedKey(privB, pubA)
-	if err != nil {
-		t.Fatal(err)
+	if user.Email != id.String() {
+		t.Fatalf("matched wrong user %q", user.Email)
 	}
-	if sharedA != sharedB {
-		t.Fatal("shared keys should match")
+	if hs.UserID == raw {
+		t.Fatal("token must not be the raw UUID")
 	}
 
-	sessionKey, err := deriveSessionKey(sharedA[:], []byte("1234567890123456"))
-	if err != nil {
-		t.Fatal(err)
-	}
-	grant, err := encryptPolicyGrant(sessionKey, "strict")
-	if err != nil {
-		t.Fatal(err)
-	}
-	if len(grant) <= 12 {
-		t.Fatal("encrypted grant should include nonce and ciphertext")
+	// The token is tied to the ephemeral key and timestamp.
+	moved := hs
+	moved.PublicKey[0] = 2
+	if _, err := h.authenticateHandshake(&moved); err == nil {
+		t.Fatal("token accepted with a different public key")
+	}
+	moved = hs
+	moved.Timestamp++
+	if _, err := h.authenticateHandshake(&moved); err == nil {
+		t.Fatal("token accepted with a different timestamp")
+	}
+	// Negotiating clients can't fall back to the cleartext UUID.
+	plain := hs
+	plain.UserID = raw
+	if _, err := h.authenticateHandshake(&plain); err == nil {
+		t.Fatal("cleartext UUID accepted from a negotiating client")
+	}
+	plain.Versions = 0
+	if _, err := h.authenticateHandshake(&plain); err != nil {
+		t.Fatalf("legacy client rejected: %v", err)
 	}
 }
 
 func TestHandshakeResponseAndHTTPError(t *testing.T) {
 	var w bytes.Buffer
-	hs := ServerHandshake{}
+	hs := encoding.ServerHandshake{}
 	copy(hs.PublicKey[:], []byte("12345678901234567890123456789012"))
 	hs.PolicyGrant = []byte("abc")
-	if err := writeHandshakeResponse(&w, hs); err != nil {
+	if err := writeHandshakeResponse(&w, hs, &responseTemplate{}); err != nil {
 		t.Fatal(err)
 	}
 	if !strings.Contains(w.String(), "200 OK") {
@@ -259,12 +218,10 @@ func TestHandleReflexHTTPSuccessPathToSessionError(t *testing.T) {
 	var nonce [16]byte
 	copy(nonce[:], []byte("nonce-1234567890"))
 
-	h := &Handler{
-		clients: []*protocol.MemoryUser{
-			{Account: &MemoryAccount{ID: id.String(), Policy: "normal"}},
-		},
-		seenNonces:    make(map[[16]byte]int64),
-		nonceLifetime: defaultNonceLifetime,
+	h := &Handler{userStore: &userStore{nonces: newNonceCache(defaultNonceLifetime, 0)}}
+	defer h.nonces.Close()
+	if err := h.addUser(&protocol.MemoryUser{Account: &reflex.MemoryAccount{ID: id.String(), Policy: "normal"}}); err != nil {
+		t.Fatal(err)
 	}
 	hs := buildClientHandshake(t, userID, time.Now().Unix(), nonce, nil)
 	raw := marshalClientHandshake(hs)
@@ -287,3 +244,54 @@ func TestHandleFallbackWithoutConfig(t *testing.T) {
 		t.Fatal("expected fallback config error")
 	}
 }
+
+func TestAddUserRejectsInvalidAndDuplicateIDs(t *testing.T) {
+	id := uuid.New()
+	h := &Handler{userStore: &userStore{}}
+	if err := h.addUser(&protocol.MemoryUser{Account: &reflex.MemoryAccount{ID: "zzzzzzzz-zzzz-zzzz-zzzz-zzzzzzzzzzzz"}}); err == nil {
+		t.Fatal("invalid id accepted")
+	}
+	if err := h.addUser(&protocol.MemoryUser{Account: &reflex.MemoryAccount{ID: id.String()}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.addUser(&protocol.MemoryUser{Account: &reflex.MemoryAccount{ID: id.String()}}); err == nil {
+		t.Fatal("duplicate id accepted")
+	}
+	if len(h.clients) != 1 || len(h.clientsByID) != 1 {
+		t.Fatalf("indexed %d users, %d ids", len(h.clients), len(h.clientsByID))
+	}
+}
+
+func TestHandshakeAnswersWaitForFloor(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:                []*reflex.User{{Id: id.String()}},
+		HandshakeResponseFloor: 100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	var userID, stranger [16]byte
+	copy(userID[:], id.Bytes())
+	stranger[0] = 1
+
+	for name, tc := range map[string]struct {
+		hs   encoding.ClientHandshake
+		want string
+	}{
+		"stale":   {buildClientHandshake(t, userID, time.Now().Add(-time.Hour).Unix(), [16]byte{1}, nil), "403 Forbidden"},
+		"unknown": {buildClientHandshake(t, stranger, time.Now().Unix(), [16]byte{2}, nil), "403 Forbidden"},
+		"valid":   {buildClientHandshake(t, userID, time.Now().Unix(), [16]byte{3}, nil), "200 OK"},
+	} {
+		conn := newFakeConn(nil)
+		start := time.Now()
+		h.processHandshake(context.Background(), bufio.NewReader(conn), conn, noOpDispatcher{}, tc.hs, h.httpReply(conn))
+		if elapsed := time.Since(start); elapsed < 100*time.Millisecond {
+			t.Errorf("%s handshake answered after %v, before the floor", name, elapsed)
+		}
+		if !strings.Contains(conn.w.String(), tc.want) {
+			t.Errorf("%s handshake answered %q", name, conn.w.String())
+		}
+	}
+}
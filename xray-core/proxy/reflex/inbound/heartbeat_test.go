@@ -0,0 +1,26 @@
+package inbound
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestHeartbeatMeasuresRTT(t *testing.T) {
+	_, c, _ := startTestSession(t, &encoding.PolicyRequest{Features: []string{encoding.FeatureHeartbeat}})
+	if !c.Grant().Has(encoding.FeatureHeartbeat) {
+		t.Fatal("heartbeat was not granted")
+	}
+	assertEcho(t, c, "ping")
+	if err := c.Ping(); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for c.RTT() == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("no RTT measured")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
@@ -1,22 +1,27 @@
-// Package inbound implements the Reflex inbound handler.
-// This is a stub; replace with full implementation per step docs.
+// Package inbound implements the Reflex inbound handler. It authenticates
+// client handshakes, relays the session's frames to the dispatcher, and
+// hands anything that is not a Reflex client to the configured fallback.
 package inbound
 
 import (
 	"bufio"
 	"context"
+	"crypto/ed25519"
 	"sync"
+	"sync/atomic"
 	"time"
 
-	"google.golang.org/protobuf/proto"
-
 	"github.com/xtls/xray-core/common"
 	"github.com/xtls/xray-core/common/errors"
 	"github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/policy"
 	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/features/stats"
 	"github.com/xtls/xray-core/proxy"
 	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	"github.com/xtls/xray-core/transport/internet/stat"
 )
 
@@ -26,33 +31,54 @@ func init() {
 	}))
 }
 
-// MemoryAccount is the in-memory Reflex user account.
-type MemoryAccount struct {
-	ID     string
-	Policy string
-}
-
-// Equals implements protocol.Account.
-func (a *MemoryAccount) Equals(account protocol.Account) bool {
-	other, ok := account.(*MemoryAccount)
-	if !ok {
-		return false
-	}
-	return a.ID == other.ID
-}
-
-// ToProto implements protocol.Account.
-func (a *MemoryAccount) ToProto() proto.Message {
-	return &reflex.Account{Id: a.ID}
-}
-
 // Handler is the Reflex inbound handler.
 type Handler struct {
-	clients       []*protocol.MemoryUser
-	fallback      *reflex.Fallback
-	seenNonces    map[[16]byte]int64
-	nonceLifetime time.Duration
-	nonceMu       sync.Mutex
+	*userStore
+	coverTraffic  bool
+	puzzle        *puzzleGate
+	profileDir    string
+	coalesce      bool
+	maxFrameSize  uint32
+	watermarks    encoding.Watermarks
+	websocketPath string
+	grpcService   string
+	grpcMethod    string
+	quic          *quicServer
+	policyManager policy.Manager
+	metrics       *metrics
+	logVerbosity  uint32
+	logUsers      map[string]bool
+	audit         *auditLog
+	bans          *banList
+	authBackend   *authBackend
+	httpTemplate  requestTemplate
+	httpResponse  responseTemplate
+	// binding is the configured handshake_binding; see userToken.
+	binding []byte
+	// responseFloor is the configured handshake_response_floor.
+	responseFloor time.Duration
+	// entropyMonitor watches the entropy of what sessions write.
+	entropyMonitor bool
+	// unmatched is how connections without a fallback end; see
+	// refuseUnmatched.
+	unmatched string
+	// sessions limits the running sessions and drains them on Close.
+	sessions sessionGate
+	// drainTimeout is the configured drain_timeout.
+	drainTimeout time.Duration
+	// identity signs policy grants; see identity_key.
+	identity ed25519.PrivateKey
+	// psk is mixed into every session key; see encoding.MixPSK.
+	psk []byte
+	// current holds the settings Reload swaps; see settings.
+	current atomic.Pointer[settings]
+	// profiles are the built-ins and those loaded from profileDir.
+	profiles encoding.ProfileSet
+	// rateBuckets are the rate limits of running sessions.
+	rateBuckets rateBuckets
+
+	liveMu sync.Mutex
+	live   map[*liveSession]struct{}
 }
 
 // Network implements proxy.Inbound.Network().
@@ -66,6 +92,11 @@ func (h *Handler) Process(ctx context.Context, network net.Network, conn stat.Co
 	}
 
 	reader := bufio.NewReader(conn)
+	// Banned sources reach the fallback before anything is parsed.
+	if source := sourceIP(ctx, conn); h.bans.banned(source, time.Now()) {
+		h.rejectHandshake(withSessionID(ctx), source, rejectBanned, nil)
+		return h.handleFallback(ctx, reader, conn)
+	}
 	peeked, err := peekForDetection(reader, 5)
 	if err != nil && err.Error() != "EOF" {
 		return err
@@ -77,6 +108,12 @@ func (h *Handler) Process(ctx context.Context, network net.Network, conn stat.Co
 	if h.isReflexMagic(peeked) {
 		return h.handleReflexMagic(ctx, reader, conn, dispatcher)
 	}
+	if h.grpcService != "" && string(peeked) == http2Preface {
+		return h.handleGRPC(ctx, reader, conn, dispatcher)
+	}
+	if h.isWebSocketRequest(reader) {
+		return h.handleWebSocket(ctx, reader, conn, dispatcher)
+	}
 	if h.isHTTPPostLike(peeked) {
 		return h.handleReflexHTTP(ctx, reader, conn, dispatcher)
 	}
@@ -85,20 +122,221 @@ func (h *Handler) Process(ctx context.Context, network net.Network, conn stat.Co
 
 // New creates a new Reflex inbound handler from config.
 func New(ctx context.Context, config *reflex.InboundConfig) (proxy.Inbound, error) {
-	_ = ctx
 	h := &Handler{
-		fallback:      config.GetFallback(),
-		seenNonces:    make(map[[16]byte]int64),
-		nonceLifetime: defaultNonceLifetime,
-	}
-	for _, c := range config.GetClients() {
-		h.clients = append(h.clients, &protocol.MemoryUser{
-			Email: c.GetId(),
-			Account: &MemoryAccount{
-				ID:     c.GetId(),
-				Policy: c.GetPolicy(),
-			},
-		})
+		coverTraffic: config.GetCoverTraffic(),
+		puzzle:       newPuzzleGate(config.GetPuzzle()),
+		bans:         newBanList(config.GetSourceBan()),
+		authBackend:  newAuthBackend(config.GetAuthBackend(), config.GetHandshakeBinding()),
+		profileDir:   config.GetProfileDir(),
+		coalesce:     config.GetCoalesceWrites(),
+		maxFrameSize: config.GetMaxFrameSize(),
+		watermarks: encoding.Watermarks{
+			High: int(config.GetHighWatermark()),
+			Low:  int(config.GetLowWatermark()),
+		},
+		logVerbosity:  config.GetLogVerbosity(),
+		websocketPath: config.GetWebsocketPath(),
+		grpcService:   config.GetGrpcService(),
+		grpcMethod:    config.GetGrpcMethod(),
+		httpTemplate: requestTemplate{
+			hosts:       config.GetHttpHosts(),
+			paths:       config.GetHttpPaths(),
+			header:      config.GetHttpHeaders(),
+			required:    config.GetHttpRequiredHeaders(),
+			contentType: config.GetHttpContentType(),
+		},
+		httpResponse:   newResponseTemplate(config.GetHttpServer(), config.GetHttpResponseHeaders()),
+		binding:        []byte(config.GetHandshakeBinding()),
+		entropyMonitor: config.GetEntropyMonitor(),
+		unmatched:      config.GetUnmatched(),
+		sessions:       sessionGate{max: int(config.GetMaxSessions())},
+		drainTimeout:   time.Duration(config.GetDrainTimeout()) * time.Second,
+	}
+	if !KnownUnmatched(h.unmatched) {
+		return nil, errors.New("unknown reflex unmatched action ", h.unmatched)
+	}
+	if !KnownHTTPServer(config.GetHttpServer()) {
+		return nil, errors.New("unknown reflex http server ", config.GetHttpServer())
+	}
+	if seed := config.GetIdentityKey(); len(seed) > 0 {
+		if len(seed) != ed25519.SeedSize {
+			return nil, errors.New("reflex identity key must be a ", ed25519.SeedSize, "-byte Ed25519 seed")
+		}
+		h.identity = ed25519.NewKeyFromSeed(seed)
+	}
+	if psk := config.GetPsk(); len(psk) > 0 {
+		if len(psk) != encoding.PSKSize {
+			return nil, errors.New("reflex psk must be ", encoding.PSKSize, " bytes")
+		}
+		h.psk = psk
+	}
+	h.responseFloor = defaultResponseFloor
+	if floor := config.GetHandshakeResponseFloor(); floor > 0 {
+		h.responseFloor = time.Duration(floor) * time.Millisecond
+	}
+	if users := config.GetLogUsers(); len(users) > 0 {
+		h.logUsers = make(map[string]bool, len(users))
+		for _, email := range users {
+			h.logUsers[email] = true
+		}
+	}
+	if h.profileDir != "" {
+		if _, err := h.profiles.Load(h.profileDir); err != nil {
+			return nil, err
+		}
+	}
+	if name := config.GetUserStore(); name != "" {
+		if len(config.GetClients()) > 0 || config.GetTrafficAccounting() != nil || config.GetMaxNonces() != 0 {
+			return nil, errors.New("reflex inbound with a user store can't set clients, traffic accounting or max nonces")
+		}
+		var stores *UserStores
+		if v := core.FromContext(ctx); v != nil {
+			stores, _ = v.GetFeature(UserStoresType()).(*UserStores)
+		}
+		store, err := stores.get(name)
+		if err != nil {
+			return nil, err
+		}
+		h.userStore = store
+	} else {
+		store, err := newUserStore(config.GetClients(), config.GetTrafficAccounting(), config.GetMaxNonces())
+		if err != nil {
+			return nil, err
+		}
+		h.userStore = store
+	}
+	settings, err := h.newSettings(config.GetFallback(), config.GetPolicyRateLimits())
+	if err != nil {
+		h.release()
+		return nil, err
+	}
+	audit, err := newAuditLog(config.GetAuditLog(), config.GetAuditAccessLog())
+	if err != nil {
+		h.release()
+		return nil, err
+	}
+	h.audit = audit
+	settings.start()
+	h.current.Store(settings)
+	if v := core.FromContext(ctx); v != nil {
+		h.policyManager, _ = v.GetFeature(policy.ManagerType()).(policy.Manager)
+		if m, ok := v.GetFeature(stats.ManagerType()).(stats.Manager); ok {
+			h.metrics = newMetrics(m)
+		}
+		if h.metrics != nil {
+			h.nonces.countOverflows(h.metrics.noncesFull)
+		}
+	}
+	if addr := config.GetQuicListen(); addr != "" {
+		quic, err := newQUICServer(ctx, addr, config.GetQuicCertificateFile(), config.GetQuicKeyFile())
+		if err != nil {
+			h.Close()
+			return nil, err
+		}
+		h.quic = quic
+		if v := core.FromContext(ctx); v != nil {
+			if err := v.RequireFeatures(func(d routing.Dispatcher) {
+				quic.dispatcher = d
+			}, false); err != nil {
+				h.Close()
+				return nil, err
+			}
+		}
 	}
 	return h, nil
 }
+
+// Start implements common.Runnable. It opens the QUIC listener, if any.
+func (h *Handler) Start() error {
+	if h.quic == nil {
+		return nil
+	}
+	return h.quic.start(h)
+}
+
+// applyLevelPolicy puts the buffer policy of user's level on ctx and returns
+// the level's session policy, whose timeouts bound the session, so operators'
+// policy levels apply to Reflex sessions. Outside an Xray instance Xray's
+// defaults apply.
+func (h *Handler) applyLevelPolicy(ctx context.Context, user *protocol.MemoryUser) (context.Context, policy.Session) {
+	p := policy.SessionDefault()
+	if h.policyManager != nil {
+		var level uint32
+		if user != nil {
+			level = user.Level
+		}
+		p = h.policyManager.ForLevel(level)
+	}
+	return policy.ContextWithBufferPolicy(ctx, p.Buffer), p
+}
+
+// Close implements common.Closable. It drains the running sessions, stops
+// the QUIC listener, if any, closes the audit log, saves the traffic totals
+// unless a shared user store keeps them and stops prefetching decoys.
+func (h *Handler) Close() error {
+	h.drain()
+	var errs []error
+	if h.quic != nil {
+		if err := h.quic.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if err := h.audit.Close(); err != nil {
+		errs = append(errs, err)
+	}
+	if h.userStore != nil {
+		if err := h.release(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	h.settings().stop()
+	return errors.Combine(errs...)
+}
+
+// AddUser implements proxy.UserManager.AddUser(). Like configured users, a
+// user without an email is known by its ID. Inbounds sharing a user store
+// all see the user.
+func (h *Handler) AddUser(ctx context.Context, u *protocol.MemoryUser) error {
+	account, ok := u.Account.(*reflex.MemoryAccount)
+	if !ok {
+		return errors.New("reflex user ", u.Email, " has no reflex account")
+	}
+	if u.Email == "" {
+		u.Email = account.ID
+	}
+	if account.Quota > 0 && h.traffic == nil {
+		return errors.New("reflex user ", u.Email, ": quota needs traffic accounting")
+	}
+	if len(account.Fallback.GetGeo()) > 0 {
+		return errors.New("reflex user ", u.Email, ": geo fallbacks can only be configured")
+	}
+	if h.userByEmail(u.Email) != nil {
+		return errors.New("reflex user ", u.Email, " already exists")
+	}
+	return h.addUser(u)
+}
+
+// RemoveUser implements proxy.UserManager.RemoveUser().
+func (h *Handler) RemoveUser(ctx context.Context, email string) error {
+	return h.removeUser(email)
+}
+
+// GetUser implements proxy.UserManager.GetUser().
+func (h *Handler) GetUser(ctx context.Context, email string) *protocol.MemoryUser {
+	return h.userByEmail(email)
+}
+
+// GetUsers implements proxy.UserManager.GetUsers().
+func (h *Handler) GetUsers(ctx context.Context) []*protocol.MemoryUser {
+	clients := h.users()
+	users := make([]*protocol.MemoryUser, len(clients))
+	for i, u := range clients {
+		users[i] = u.user
+	}
+	return users
+}
+
+// GetUsersCount implements proxy.UserManager.GetUsersCount().
+func (h *Handler) GetUsersCount(context.Context) int64 {
+	return int64(len(h.users()))
+}
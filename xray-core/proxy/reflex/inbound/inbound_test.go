@@ -23,12 +23,12 @@ func TestMemoryAccountAndNewHandler(t *testing.T) {
 	if len(h.clients) != 1 {
 		t.Fatalf("unexpected clients len: %d", len(h.clients))
 	}
-	if h.fallback == nil || h.fallback.Dest != 8080 {
+	if f := h.settings().fallback; f == nil || f.Dest != 8080 {
 		t.Fatal("fallback config not applied")
 	}
 
-	acc1 := &MemoryAccount{ID: "a"}
-	acc2 := &MemoryAccount{ID: "a"}
+	acc1 := &reflex.MemoryAccount{ID: "a"}
+	acc2 := &reflex.MemoryAccount{ID: "a"}
 	if !acc1.Equals(acc2) {
 		t.Fatal("equal accounts should match")
 	}
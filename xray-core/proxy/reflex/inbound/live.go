@@ -0,0 +1,218 @@
+package inbound
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+
+	c "github.com/xtls/xray-core/common/ctx"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// liveSession is an established session that can be re-policied while it
+// runs.
+type liveSession struct {
+	id      uint32
+	email   string
+	source  string
+	started time.Time
+	session *encoding.Session
+	log     *sessionLog
+	writer  io.Writer
+	key     []byte
+	// cancel ends the session.
+	cancel context.CancelFunc
+	// profiles resolves the policies of updates.
+	profiles *encoding.ProfileSet
+
+	mu     sync.Mutex
+	policy sessionPolicy
+}
+
+// update switches the session to new profiles and, for clients that
+// negotiate, pushes the re-signed grant. Older clients only see the new
+// downlink shaping.
+func (ls *liveSession) update(uplink, downlink string) error {
+	ls.mu.Lock()
+	defer ls.mu.Unlock()
+	if uplink != "" {
+		ls.policy.Uplink = uplink
+		ls.policy.Ext = ls.profiles.GrantExt(uplink)
+	}
+	if downlink != "" {
+		ls.policy.Downlink = downlink
+	}
+	ls.session.SetTrafficProfile(ls.profiles.Profile(ls.policy.Downlink))
+	if !ls.policy.requested {
+		return nil
+	}
+	return ls.session.WritePolicyGrant(ls.writer, []byte(ls.policy.grant(ls.key)))
+}
+
+// info snapshots the session for the Reflex API.
+func (ls *liveSession) info() reflex.SessionInfo {
+	ls.mu.Lock()
+	uplink, downlink := ls.policy.Uplink, ls.policy.Downlink
+	ls.mu.Unlock()
+	stats := ls.session.Stats()
+	return reflex.SessionInfo{
+		ID:              ls.id,
+		Email:           ls.email,
+		Source:          ls.source,
+		Started:         ls.started,
+		BytesSent:       stats.BytesSent,
+		BytesReceived:   stats.BytesReceived,
+		UplinkPolicy:    uplink,
+		DownlinkPolicy:  downlink,
+		SizeDistance:    ls.session.SizeDistance(),
+		RTT:             ls.session.RTT(),
+		Replays:         stats.Replays,
+		PaddingOverhead: stats.PaddingOverhead,
+		AddedDelay:      stats.AddedDelay,
+	}
+}
+
+// track registers a running session. ctx carries its ID and source, and
+// cancel ends it.
+func (h *Handler) track(ctx context.Context, cancel context.CancelFunc, user *protocol.MemoryUser, sess *encoding.Session, log *sessionLog, writer io.Writer, key []byte, policy sessionPolicy) *liveSession {
+	ls := &liveSession{
+		id:       uint32(c.IDFromContext(ctx)),
+		started:  time.Now(),
+		session:  sess,
+		log:      log,
+		writer:   writer,
+		key:      key,
+		cancel:   cancel,
+		policy:   policy,
+		profiles: &h.profiles,
+	}
+	if user != nil {
+		ls.email = user.Email
+	}
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.Address != nil {
+		ls.source = inbound.Source.NetAddr()
+	}
+	h.liveMu.Lock()
+	defer h.liveMu.Unlock()
+	if h.live == nil {
+		h.live = make(map[*liveSession]struct{})
+	}
+	h.live[ls] = struct{}{}
+	return ls
+}
+
+func (h *Handler) untrack(ls *liveSession) {
+	h.liveMu.Lock()
+	defer h.liveMu.Unlock()
+	delete(h.live, ls)
+}
+
+// closeUser ends every live session of email, logging why.
+func (h *Handler) closeUser(email, reason string) {
+	h.liveMu.Lock()
+	defer h.liveMu.Unlock()
+	for ls := range h.live {
+		if ls.email == email {
+			ls.log.event("reflex session closed: ", reason)
+			ls.cancel()
+		}
+	}
+}
+
+// UpdatePolicy implements reflex.PolicyUpdater.
+func (h *Handler) UpdatePolicy(ctx context.Context, email, uplink, downlink string) (int, error) {
+	for _, name := range []string{uplink, downlink} {
+		if name == "" {
+			continue
+		}
+		if _, ok := h.profiles.Lookup(name); !ok {
+			return 0, errors.New("unknown reflex profile ", name)
+		}
+	}
+
+	h.liveMu.Lock()
+	targets := make([]*liveSession, 0, len(h.live))
+	for ls := range h.live {
+		if email == "" || ls.email == email {
+			targets = append(targets, ls)
+		}
+	}
+	h.liveMu.Unlock()
+
+	updated := 0
+	for _, ls := range targets {
+		if err := ls.update(uplink, downlink); err != nil {
+			errors.LogInfoInner(ctx, err, "failed to push reflex policy update")
+			continue
+		}
+		updated++
+	}
+	return updated, nil
+}
+
+// Sessions implements reflex.SessionController.
+func (h *Handler) Sessions(email string) []reflex.SessionInfo {
+	h.liveMu.Lock()
+	targets := make([]*liveSession, 0, len(h.live))
+	for ls := range h.live {
+		if email == "" || ls.email == email {
+			targets = append(targets, ls)
+		}
+	}
+	h.liveMu.Unlock()
+
+	infos := make([]reflex.SessionInfo, 0, len(targets))
+	for _, ls := range targets {
+		infos = append(infos, ls.info())
+	}
+	return infos
+}
+
+// lookup returns the live session with id.
+func (h *Handler) lookup(id uint32) *liveSession {
+	h.liveMu.Lock()
+	defer h.liveMu.Unlock()
+	for ls := range h.live {
+		if ls.id == id {
+			return ls
+		}
+	}
+	return nil
+}
+
+// CloseSession implements reflex.SessionController.
+func (h *Handler) CloseSession(id uint32) bool {
+	ls := h.lookup(id)
+	if ls == nil {
+		return false
+	}
+	ls.cancel()
+	return true
+}
+
+// UpdateSession implements reflex.SessionController.
+func (h *Handler) UpdateSession(ctx context.Context, id uint32, uplink, downlink string) (bool, error) {
+	ls := h.lookup(id)
+	if ls == nil {
+		return false, nil
+	}
+	for _, name := range []string{uplink, downlink} {
+		if name == "" {
+			continue
+		}
+		if _, ok := h.profiles.Lookup(name); !ok {
+			return true, errors.New("unknown reflex profile ", name)
+		}
+	}
+	return true, ls.update(uplink, downlink)
+}
+
+var (
+	_ reflex.PolicyUpdater     = (*Handler)(nil)
+	_ reflex.SessionController = (*Handler)(nil)
+)
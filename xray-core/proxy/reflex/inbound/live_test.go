@@ -0,0 +1,105 @@
+package inbound
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestUpdatePolicyPushesToLiveSessions(t *testing.T) {
+	h, c, dispatcher := startTestSession(t, &encoding.PolicyRequest{Downlink: "youtube"})
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 80)); err != nil {
+		t.Fatal(err)
+	}
+	<-dispatcher.dest
+	go c.CopyTo(make(collectWriter, 16))
+
+	ctx := context.Background()
+	if _, err := h.UpdatePolicy(ctx, "", "", "no-such-profile"); err == nil {
+		t.Fatal("expected unknown profile to be rejected")
+	}
+	if n, err := h.UpdatePolicy(ctx, "someone-else", "", "http2-api"); err != nil || n != 0 {
+		t.Fatalf("update for another user touched %d sessions, err %v", n, err)
+	}
+	n, err := h.UpdatePolicy(ctx, "", "youtube", "http2-api")
+	if err != nil || n != 1 {
+		t.Fatalf("expected one live session to be updated, got %d, err %v", n, err)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		g := c.Grant()
+		if g.Uplink == "youtube" && g.Downlink == "http2-api" {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("client never saw the update: %+v", g)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if profile, _ := c.Session().Shaping(); profile.Name != "youtube" {
+		t.Fatalf("client uplink not reshaped: %s", profile.Name)
+	}
+}
+
+func TestSessionControllerListsUpdatesAndCloses(t *testing.T) {
+	h, c, _ := startTestSession(t, &encoding.PolicyRequest{Downlink: "youtube"})
+	assertEcho(t, c, "hello")
+
+	if infos := h.Sessions("someone-else"); len(infos) != 0 {
+		t.Fatalf("listed %d sessions of another user", len(infos))
+	}
+	// The echo can arrive before the server's write returns, so wait for
+	// the sent bytes to be counted.
+	var info reflex.SessionInfo
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		infos := h.Sessions("")
+		if len(infos) != 1 {
+			t.Fatalf("expected one live session, got %d", len(infos))
+		}
+		info = infos[0]
+		if info.BytesSent != 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("sent bytes not counted: %+v", info)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if info.ID == 0 || info.DownlinkPolicy != "youtube" || info.Started.IsZero() || info.BytesReceived == 0 {
+		t.Fatalf("unexpected session info: %+v", info)
+	}
+
+	ctx := context.Background()
+	if found, _ := h.UpdateSession(ctx, info.ID+1, "", "zoom"); found {
+		t.Fatal("updated a session that does not exist")
+	}
+	if _, err := h.UpdateSession(ctx, info.ID, "", "no-such-profile"); err == nil {
+		t.Fatal("expected unknown profile to be rejected")
+	}
+	if found, err := h.UpdateSession(ctx, info.ID, "", "zoom"); !found || err != nil {
+		t.Fatalf("update failed: found %v, err %v", found, err)
+	}
+	if got := h.Sessions("")[0].DownlinkPolicy; got != "zoom" {
+		t.Fatalf("downlink policy not switched: %s", got)
+	}
+
+	if h.CloseSession(info.ID + 1) {
+		t.Fatal("closed a session that does not exist")
+	}
+	if !h.CloseSession(info.ID) {
+		t.Fatal("live session not closed")
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for len(h.Sessions("")) != 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("closed session still listed")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
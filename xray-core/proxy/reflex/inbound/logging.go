@@ -0,0 +1,153 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"strconv"
+	"time"
+
+	c "github.com/xtls/xray-core/common/ctx"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// Levels of InboundConfig.log_verbosity.
+const (
+	verbosityQuiet uint32 = iota
+	verbositySessions
+	verbosityFrames
+)
+
+// withSessionID tags ctx with a session ID, which Xray prints on every log
+// line, unless the connection already carries one.
+func withSessionID(ctx context.Context) context.Context {
+	if c.IDFromContext(ctx) != 0 {
+		return ctx
+	}
+	return c.ContextWithID(ctx, session.NewID())
+}
+
+// sessionLog is the debug log of one session. A nil *sessionLog logs
+// nothing, so sessions of users who aren't traced cost one nil check.
+type sessionLog struct {
+	ctx       context.Context
+	verbosity uint32
+}
+
+// logging reports whether sessions of the user with email are logged at
+// verbosity v or above. An empty email stands for a connection that has not
+// authenticated, which is logged only when no users are singled out.
+func (h *Handler) logging(email string, v uint32) bool {
+	if h.logVerbosity < v {
+		return false
+	}
+	if len(h.logUsers) == 0 {
+		return true
+	}
+	return email != "" && h.logUsers[email]
+}
+
+// newSessionLog returns the log for a session of the user with email, or nil
+// if that session is not logged.
+func (h *Handler) newSessionLog(ctx context.Context, email string) *sessionLog {
+	if !h.logging(email, verbositySessions) {
+		return nil
+	}
+	return &sessionLog{ctx: ctx, verbosity: h.logVerbosity}
+}
+
+// rejectHandshake records why hs, from source, was refused, and bans source
+// if it failed too often. hs is nil when source was already banned.
+func (h *Handler) rejectHandshake(ctx context.Context, source net.IP, reason rejectReason, hs *encoding.ClientHandshake) {
+	h.metrics.handshakeRejected(reason)
+	h.auditRejected(ctx, reason, hs)
+	if h.logging("", verbositySessions) {
+		errors.LogInfo(ctx, "reflex handshake rejected: ", string(reason))
+	}
+	if hs != nil && h.bans.fail(source, time.Now()) {
+		errors.LogWarning(ctx, "reflex source ", source, " banned after repeated failed handshakes")
+	}
+}
+
+// acceptHandshake records that user completed a handshake from source.
+func (h *Handler) acceptHandshake(ctx context.Context, source net.IP, user *protocol.MemoryUser) {
+	h.metrics.handshakeAccepted()
+	h.auditAccepted(ctx, user)
+	h.bans.succeed(source, time.Now())
+}
+
+// event logs a session lifecycle message.
+func (l *sessionLog) event(msg ...interface{}) {
+	if l != nil {
+		errors.LogInfo(l.ctx, msg...)
+	}
+}
+
+// frame traces one frame sent or received.
+func (l *sessionLog) frame(direction string, frameType uint8, length int) {
+	if l != nil && l.verbosity >= verbosityFrames {
+		errors.LogInfo(l.ctx, "reflex frame ", direction, ": ", frameTypeName(frameType), ", ", length, " bytes")
+	}
+}
+
+// morph traces how a chunk of data was shaped.
+func (l *sessionLog) morph(chunk, target int, delay time.Duration) {
+	if l != nil && l.verbosity >= verbosityFrames {
+		errors.LogInfo(l.ctx, "reflex morph: ", chunk, " data bytes in a ", target, " byte frame, next after ", delay)
+	}
+}
+
+// sessionObserver feeds a session's events to the handler's metrics and the
+// session's log.
+type sessionObserver struct {
+	metrics *metrics
+	log     *sessionLog
+}
+
+func (o sessionObserver) FrameSent(frameType uint8, wireSize int) {
+	o.metrics.frameSent(frameType, wireSize)
+	o.log.frame("sent", frameType, wireSize)
+}
+
+func (o sessionObserver) FrameReceived(frameType uint8, wireSize int) {
+	o.metrics.frameReceived(frameType, wireSize)
+	o.log.frame("received", frameType, wireSize)
+}
+
+func (o sessionObserver) Morphed(chunk, target int, delay time.Duration) {
+	o.log.morph(chunk, target, delay)
+}
+
+func (o sessionObserver) Passthrough(reason string) {
+	o.metrics.passthrough()
+	o.log.event("reflex morphing paused: ", reason)
+}
+
+func (o sessionObserver) LowEntropy() {
+	o.metrics.lowEntropyWindow()
+}
+
+func (o sessionObserver) RTT(srtt time.Duration) {
+	if o.metrics != nil {
+		o.metrics.rtt.Set(srtt.Milliseconds())
+	}
+}
+
+func (o sessionObserver) SizeDistance(d float64) {
+	if o.metrics != nil {
+		o.metrics.sizeDistance.Set(int64(d * 1000))
+	}
+}
+
+func (o sessionObserver) Queued(delta int) {
+	o.metrics.queuedBytes(delta)
+}
+
+func frameTypeName(t uint8) string {
+	if name := encoding.FrameTypeName(t); name != "" {
+		return name
+	}
+	return "type " + strconv.Itoa(int(t))
+}
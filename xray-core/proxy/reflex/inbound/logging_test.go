@@ -0,0 +1,50 @@
+package inbound
+
+import (
+	"context"
+	"testing"
+
+	c "github.com/xtls/xray-core/common/ctx"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestWithSessionID(t *testing.T) {
+	ctx := withSessionID(context.Background())
+	if c.IDFromContext(ctx) == 0 {
+		t.Fatal("no session id assigned")
+	}
+	connCtx := c.ContextWithID(context.Background(), 42)
+	if id := c.IDFromContext(withSessionID(connCtx)); id != 42 {
+		t.Fatalf("connection id replaced with %d", id)
+	}
+}
+
+func TestSessionLogSelectsUsers(t *testing.T) {
+	h := &Handler{}
+	if h.newSessionLog(context.Background(), "alice@example.com") != nil {
+		t.Fatal("sessions logged at verbosity 0")
+	}
+
+	h.logVerbosity = verbosityFrames
+	if l := h.newSessionLog(context.Background(), "alice@example.com"); l == nil || l.verbosity != verbosityFrames {
+		t.Fatalf("unexpected log without a user filter: %+v", l)
+	}
+	if !h.logging("", verbositySessions) {
+		t.Fatal("rejections not logged without a user filter")
+	}
+
+	h.logUsers = map[string]bool{"alice@example.com": true}
+	if h.newSessionLog(context.Background(), "alice@example.com") == nil {
+		t.Fatal("selected user not logged")
+	}
+	if h.newSessionLog(context.Background(), "bob@example.com") != nil {
+		t.Fatal("unselected user logged")
+	}
+	if h.logging("", verbositySessions) {
+		t.Fatal("unauthenticated handshakes logged despite a user filter")
+	}
+
+	var l *sessionLog
+	l.event("ignored")
+	l.frame("sent", encoding.FrameTypeData, 100)
+}
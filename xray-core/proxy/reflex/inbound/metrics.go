@@ -0,0 +1,180 @@
+package inbound
+
+import (
+	"github.com/xtls/xray-core/features/stats"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// Reflex registers its counters in Xray's stats manager under these names,
+// so the metrics app's /debug/vars and the stats API publish them next to the
+// traffic counters. All Reflex inbounds of an instance share them.
+const (
+	metricHandshakeAccepted = "reflex>>>handshake>>>accepted"
+	metricHandshakeRejected = "reflex>>>handshake>>>rejected>>>"
+	metricFallbacks         = "reflex>>>fallbacks"
+	metricActiveSessions    = "reflex>>>sessions>>>active"
+	metricFramesSent        = "reflex>>>frames>>>sent>>>"
+	metricFramesReceived    = "reflex>>>frames>>>received>>>"
+	metricBytesSent         = "reflex>>>bytes>>>sent>>>"
+	metricBytesReceived     = "reflex>>>bytes>>>received>>>"
+	metricQueuedBytes       = "reflex>>>morphing>>>queued_bytes"
+	// metricSizeDistance is the KS distance, in thousandths, between the
+	// DATA sizes a session recently sent and its downlink profile.
+	metricSizeDistance = "reflex>>>morphing>>>size_ks_permille"
+	// metricRTT is the latest smoothed heartbeat RTT of a session, in
+	// milliseconds.
+	metricRTT = "reflex>>>sessions>>>rtt_ms"
+	// metricPassthrough counts how often congestion paused morphing.
+	metricPassthrough = "reflex>>>morphing>>>passthrough"
+	// metricNoncesFull counts authenticated handshakes refused because the
+	// nonce cache was full of unexpired nonces.
+	metricNoncesFull = "reflex>>>nonces>>>full"
+	// metricLowEntropy counts windows of bytes a session wrote that the
+	// entropy monitor found not to look encrypted.
+	metricLowEntropy = "reflex>>>integrity>>>low_entropy"
+)
+
+// rejectReason is why processHandshake refused a handshake.
+type rejectReason string
+
+const (
+	rejectPuzzle    rejectReason = "puzzle"
+	rejectTimestamp rejectReason = "timestamp"
+	rejectReplay    rejectReason = "replay"
+	rejectVersion   rejectReason = "version"
+	rejectKey       rejectReason = "key"
+	rejectAuth      rejectReason = "auth"
+	rejectSource    rejectReason = "source"
+	rejectBanned    rejectReason = "banned"
+	rejectExpired   rejectReason = "expired"
+	rejectQuota     rejectReason = "quota"
+)
+
+var rejectReasons = []rejectReason{rejectPuzzle, rejectTimestamp, rejectReplay, rejectVersion, rejectKey, rejectAuth, rejectSource, rejectBanned, rejectExpired, rejectQuota}
+
+// metrics holds the registered Reflex counters. A nil *metrics, as used
+// without a stats manager, records nothing.
+type metrics struct {
+	accepted     stats.Counter
+	rejected     map[rejectReason]stats.Counter
+	fallbacks    stats.Counter
+	active       stats.Counter
+	queued       stats.Counter
+	sizeDistance stats.Counter
+	rtt          stats.Counter
+	passthroughs stats.Counter
+	// noncesFull is handed to the nonce cache, which counts itself.
+	noncesFull stats.Counter
+	lowEntropy stats.Counter
+
+	framesSent, framesReceived [encoding.FrameTypeCount]stats.Counter
+	bytesSent, bytesReceived   [encoding.FrameTypeCount]stats.Counter
+}
+
+// newMetrics registers the counters in m. It returns nil when m cannot hold
+// them, as with the stats manager of an instance without stats configured.
+func newMetrics(m stats.Manager) *metrics {
+	if m == nil {
+		return nil
+	}
+	ok := true
+	counter := func(name string) stats.Counter {
+		c, err := stats.GetOrRegisterCounter(m, name)
+		if err != nil {
+			ok = false
+		}
+		return c
+	}
+	r := &metrics{
+		accepted:     counter(metricHandshakeAccepted),
+		rejected:     make(map[rejectReason]stats.Counter, len(rejectReasons)),
+		fallbacks:    counter(metricFallbacks),
+		active:       counter(metricActiveSessions),
+		queued:       counter(metricQueuedBytes),
+		sizeDistance: counter(metricSizeDistance),
+		rtt:          counter(metricRTT),
+		passthroughs: counter(metricPassthrough),
+
+		noncesFull: counter(metricNoncesFull),
+		lowEntropy: counter(metricLowEntropy),
+	}
+	for _, reason := range rejectReasons {
+		r.rejected[reason] = counter(metricHandshakeRejected + string(reason))
+	}
+	for t := range encoding.FrameTypeCount {
+		name := encoding.FrameTypeName(uint8(t))
+		if name == "" {
+			continue
+		}
+		r.framesSent[t] = counter(metricFramesSent + name)
+		r.framesReceived[t] = counter(metricFramesReceived + name)
+		r.bytesSent[t] = counter(metricBytesSent + name)
+		r.bytesReceived[t] = counter(metricBytesReceived + name)
+	}
+	if !ok {
+		return nil
+	}
+	return r
+}
+
+func (m *metrics) handshakeAccepted() {
+	if m != nil {
+		m.accepted.Add(1)
+	}
+}
+
+func (m *metrics) handshakeRejected(reason rejectReason) {
+	if m != nil {
+		m.rejected[reason].Add(1)
+	}
+}
+
+func (m *metrics) fallback() {
+	if m != nil {
+		m.fallbacks.Add(1)
+	}
+}
+
+// sessionActive moves the active session gauge by delta.
+func (m *metrics) sessionActive(delta int64) {
+	if m != nil {
+		m.active.Add(delta)
+	}
+}
+
+// queuedBytes moves the gauge of data waiting in morph pipelines by delta.
+func (m *metrics) queuedBytes(delta int) {
+	if m != nil {
+		m.queued.Add(int64(delta))
+	}
+}
+
+// passthrough counts a session whose morphing congestion paused.
+func (m *metrics) passthrough() {
+	if m != nil {
+		m.passthroughs.Add(1)
+	}
+}
+
+// lowEntropyWindow counts a window the entropy monitor flagged.
+func (m *metrics) lowEntropyWindow() {
+	if m != nil {
+		m.lowEntropy.Add(1)
+	}
+}
+
+// frameSent counts one sealed frame of wireSize bytes.
+func (m *metrics) frameSent(frameType uint8, wireSize int) {
+	if m != nil && int(frameType) < encoding.FrameTypeCount && m.framesSent[frameType] != nil {
+		m.framesSent[frameType].Add(1)
+		m.bytesSent[frameType].Add(int64(wireSize))
+	}
+}
+
+// frameReceived counts one sealed frame of wireSize bytes.
+func (m *metrics) frameReceived(frameType uint8, wireSize int) {
+	if m != nil && int(frameType) < encoding.FrameTypeCount && m.framesReceived[frameType] != nil {
+		m.framesReceived[frameType].Add(1)
+		m.bytesReceived[frameType].Add(int64(wireSize))
+	}
+}
@@ -0,0 +1,103 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/app/stats"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	feature_stats "github.com/xtls/xray-core/features/stats"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestMetricsWithoutStatsManager(t *testing.T) {
+	if m := newMetrics(feature_stats.NoopManager{}); m != nil {
+		t.Fatal("metrics registered with the no-op stats manager")
+	}
+	var m *metrics
+	m.handshakeAccepted()
+	m.frameSent(encoding.FrameTypeData, 100)
+}
+
+func TestHandlerRecordsMetrics(t *testing.T) {
+	manager, err := stats.NewManager(context.Background(), &stats.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	h.metrics = newMetrics(manager)
+	value := func(name string) int64 {
+		t.Helper()
+		c := manager.GetCounter(name)
+		if c == nil {
+			t.Fatalf("counter %s not registered", name)
+		}
+		return c.Value()
+	}
+
+	connect := func(userID uuid.UUID) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], userID.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	if _, err := connect(uuid.New()); err == nil {
+		t.Fatal("unknown user was accepted")
+	}
+	if n := value(metricHandshakeRejected + string(rejectAuth)); n != 1 {
+		t.Fatalf("recorded %d auth rejections, want 1", n)
+	}
+
+	c, err := connect(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "metered")
+	if n := value(metricHandshakeAccepted); n != 1 {
+		t.Fatalf("recorded %d accepted handshakes, want 1", n)
+	}
+	if n := value(metricActiveSessions); n != 1 {
+		t.Fatalf("active sessions gauge is %d, want 1", n)
+	}
+	if value(metricFramesReceived+"data") == 0 {
+		t.Fatal("received data frames were not counted")
+	}
+	// The server counts its echo once the write has returned.
+	for deadline := time.Now().Add(5 * time.Second); value(metricBytesSent+"data") == 0; time.Sleep(10 * time.Millisecond) {
+		if time.Now().After(deadline) {
+			t.Fatal("sent data bytes were not counted")
+		}
+	}
+}
+
+func TestLiveSizeDistance(t *testing.T) {
+	manager, err := stats.NewManager(context.Background(), &stats.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := sessionObserver{metrics: newMetrics(manager)}
+	gauge := manager.GetCounter(metricSizeDistance)
+	o.SizeDistance(0.25)
+	if d := gauge.Value(); d != 250 {
+		t.Fatalf("distance 0.25 published as %d", d)
+	}
+	o.SizeDistance(1)
+	if d := gauge.Value(); d != 1000 {
+		t.Fatalf("distance 1 published as %d", d)
+	}
+}
@@ -0,0 +1,158 @@
+package inbound
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/features/stats"
+)
+
+const (
+	// defaultMaxNonces caps a nonce cache unless max_nonces is set. Each
+	// entry takes about 120 bytes.
+	defaultMaxNonces = 1 << 18
+	// nonceExpiryInterval is how often expired nonces are dropped.
+	nonceExpiryInterval = time.Minute
+	// nonceShards is how many independently locked parts a nonce cache is
+	// split into by the first nonce byte, so concurrent handshakes rarely
+	// wait on each other. Nonces are random, so the parts fill evenly.
+	nonceShards = 32
+)
+
+type nonceEntry struct {
+	nonce [16]byte
+	at    time.Time
+}
+
+// nonceCache remembers the nonces of recent handshakes so replays are
+// refused. Each shard keeps its entries in arrival order, so expiry only
+// looks at the oldest. A shard holding its share of max unexpired entries
+// refuses new nonces rather than forget one early: evicting would let a
+// flood of handshakes flush the cache and a captured handshake be replayed.
+type nonceCache struct {
+	shards   [nonceShards]nonceShard
+	lifetime time.Duration
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+type nonceShard struct {
+	mu    sync.Mutex
+	seen  map[[16]byte]*list.Element
+	order list.List
+	max   int
+	// overflows counts nonces refused because the shard was full, if set.
+	overflows stats.Counter
+}
+
+// newNonceCache returns a cache keeping nonces for lifetime, about max of
+// them, or defaultMaxNonces if max is 0. It drops expired nonces in the
+// background until Close.
+func newNonceCache(lifetime time.Duration, max int) *nonceCache {
+	if max <= 0 {
+		max = defaultMaxNonces
+	}
+	c := &nonceCache{
+		lifetime: lifetime,
+		stop:     make(chan struct{}),
+		done:     make(chan struct{}),
+	}
+	for i := range c.shards {
+		c.shards[i].seen = make(map[[16]byte]*list.Element)
+		c.shards[i].max = (max + nonceShards - 1) / nonceShards
+	}
+	go c.run(nonceExpiryInterval)
+	return c
+}
+
+func (c *nonceCache) run(interval time.Duration) {
+	defer close(c.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			c.expire(now)
+		case <-c.stop:
+			return
+		}
+	}
+}
+
+// add records nonce as seen at now. It reports false if nonce was already
+// seen within the lifetime, or if its shard is full of unexpired nonces.
+func (c *nonceCache) add(nonce [16]byte, now time.Time) bool {
+	s := &c.shards[nonce[0]%nonceShards]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if e, ok := s.seen[nonce]; ok {
+		if now.Sub(e.Value.(*nonceEntry).at) <= c.lifetime {
+			return false
+		}
+		s.remove(e)
+	}
+	if len(s.seen) >= s.max {
+		s.expire(now, c.lifetime)
+	}
+	if len(s.seen) >= s.max {
+		if s.overflows != nil {
+			s.overflows.Add(1)
+		}
+		return false
+	}
+	s.seen[nonce] = s.order.PushBack(&nonceEntry{nonce: nonce, at: now})
+	return true
+}
+
+// expire drops the nonces older than the lifetime at now, one shard at a
+// time.
+func (c *nonceCache) expire(now time.Time) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.expire(now, c.lifetime)
+		s.mu.Unlock()
+	}
+}
+
+// expire drops the shard's nonces older than lifetime at now. The caller
+// holds mu.
+func (s *nonceShard) expire(now time.Time, lifetime time.Duration) {
+	for e := s.order.Front(); e != nil && now.Sub(e.Value.(*nonceEntry).at) > lifetime; e = s.order.Front() {
+		s.remove(e)
+	}
+}
+
+func (s *nonceShard) remove(e *list.Element) {
+	delete(s.seen, s.order.Remove(e).(*nonceEntry).nonce)
+}
+
+// len returns the number of nonces held.
+func (c *nonceCache) len() int {
+	n := 0
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		n += len(s.seen)
+		s.mu.Unlock()
+	}
+	return n
+}
+
+// countOverflows adds refusals of a full cache to counter from now on.
+func (c *nonceCache) countOverflows(counter stats.Counter) {
+	for i := range c.shards {
+		s := &c.shards[i]
+		s.mu.Lock()
+		s.overflows = counter
+		s.mu.Unlock()
+	}
+}
+
+// Close stops the background expiry.
+func (c *nonceCache) Close() {
+	close(c.stop)
+	<-c.done
+}
@@ -0,0 +1,103 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/app/stats"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestNonceCacheExpiresAndFailsClosed(t *testing.T) {
+	c := newNonceCache(time.Second, 2*nonceShards)
+	defer c.Close()
+	overflows := new(stats.Counter)
+	c.countOverflows(overflows)
+
+	now := time.Now()
+	if !c.add([16]byte{0, 1}, now) {
+		t.Fatal("first nonce refused")
+	}
+	if c.add([16]byte{0, 1}, now.Add(time.Second)) {
+		t.Fatal("replayed nonce accepted")
+	}
+	if !c.add([16]byte{0, 1}, now.Add(2*time.Second)) {
+		t.Fatal("expired nonce refused")
+	}
+
+	if !c.add([16]byte{0, 2}, now.Add(2*time.Second)) {
+		t.Fatal("nonce refused below the limit")
+	}
+	if c.add([16]byte{0, 3}, now.Add(2*time.Second)) {
+		t.Fatal("full shard accepted a nonce")
+	}
+	if c.len() != 2 || overflows.Value() != 1 {
+		t.Fatalf("%d nonces held, %d overflows; want 2 and 1", c.len(), overflows.Value())
+	}
+	if c.add([16]byte{0, 1}, now.Add(2*time.Second)) {
+		t.Fatal("full shard forgot a nonce")
+	}
+
+	// Nonces in other shards leave the full one alone.
+	for i := 1; i < nonceShards; i++ {
+		c.add([16]byte{byte(i)}, now.Add(2*time.Second))
+	}
+	if overflows.Value() != 1 {
+		t.Fatalf("%d overflows; want 1", overflows.Value())
+	}
+
+	// A full shard makes room once its nonces expire.
+	if !c.add([16]byte{0, 3}, now.Add(4*time.Second)) {
+		t.Fatal("nonce refused after the shard expired")
+	}
+	c.expire(now.Add(6 * time.Second))
+	if c.len() != 0 {
+		t.Fatalf("%d nonces left after expiry", c.len())
+	}
+}
+
+func TestReplayAfterHandshakeFlood(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:   []*reflex.User{{Id: id.String()}},
+		MaxNonces: nonceShards,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	var userID, stranger [16]byte
+	copy(userID[:], id.Bytes())
+	stranger[0] = 1
+	answer := func(hs encoding.ClientHandshake) string {
+		conn := newFakeConn(nil)
+		h.processHandshake(context.Background(), bufio.NewReader(conn), conn, noOpDispatcher{}, hs, h.httpReply(conn))
+		return conn.w.String()
+	}
+
+	captured := buildClientHandshake(t, userID, time.Now().Unix(), [16]byte{0, 1}, nil)
+	if got := answer(captured); !strings.Contains(got, "200 OK") {
+		t.Fatalf("captured handshake answered %q", got)
+	}
+	// Made-up handshakes with fresh nonces in every shard don't flush it.
+	for i := 0; i < 4*nonceShards; i++ {
+		answer(buildClientHandshake(t, stranger, time.Now().Unix(), [16]byte{byte(i), 2, byte(i >> 8)}, nil))
+	}
+	if got := answer(captured); !strings.Contains(got, "403 Forbidden") {
+		t.Fatalf("replay after a flood answered %q", got)
+	}
+	// Nor do authenticated ones: the full shard refuses instead of
+	// forgetting the captured nonce.
+	if got := answer(buildClientHandshake(t, userID, time.Now().Unix(), [16]byte{0, 3}, nil)); !strings.Contains(got, "403 Forbidden") {
+		t.Fatalf("handshake into a full shard answered %q", got)
+	}
+	if got := answer(captured); !strings.Contains(got, "403 Forbidden") {
+		t.Fatalf("replay answered %q", got)
+	}
+}
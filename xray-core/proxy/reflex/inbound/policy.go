@@ -0,0 +1,154 @@
+package inbound
+
+import (
+	"crypto/ed25519"
+	"encoding/json"
+
+	"golang.org/x/crypto/chacha20poly1305"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// sessionPolicy is the negotiated policy of one session.
+type sessionPolicy struct {
+	encoding.PolicyGrant
+	// requested records whether the client negotiated at all, so old
+	// clients keep receiving the plain policy name as their grant.
+	requested bool
+	// version is the protocol version selected in the handshake.
+	version uint8
+	// deferred marks a grant cut short in the handshake; the full one is
+	// sent as the session starts.
+	deferred bool
+	// identity, if set, signs the grant as the server.
+	identity ed25519.PrivateKey
+}
+
+// parsePolicyRequest decodes a JSON PolicyReq. Requests that aren't JSON
+// objects are treated as absent, since older clients send opaque bytes.
+func parsePolicyRequest(raw []byte) (encoding.PolicyRequest, bool) {
+	var req encoding.PolicyRequest
+	if len(raw) == 0 || raw[0] != '{' {
+		return req, false
+	}
+	if err := json.Unmarshal(raw, &req); err != nil {
+		return encoding.PolicyRequest{}, false
+	}
+	return req, true
+}
+
+// selectPolicy picks the session profiles for user: requested ones if the
+// account allows them and they exist in profiles, otherwise the
+// per-direction policy, otherwise the account-wide policy. A negotiating
+// client is sent the definition of a loaded uplink profile to shape by.
+func selectPolicy(profiles *encoding.ProfileSet, user *protocol.MemoryUser, policyReq []byte) sessionPolicy {
+	var account reflex.MemoryAccount
+	if user != nil {
+		if a, ok := user.Account.(*reflex.MemoryAccount); ok {
+			account = *a
+		}
+	}
+	sp := sessionPolicy{PolicyGrant: encoding.PolicyGrant{
+		Version:  encoding.PolicyVersion,
+		Uplink:   account.UplinkPolicy,
+		Downlink: account.DownlinkPolicy,
+		Padding:  encoding.PaddingProfile,
+	}}
+	if sp.Uplink == "" {
+		sp.Uplink = account.Policy
+	}
+	if sp.Downlink == "" {
+		sp.Downlink = account.Policy
+	}
+
+	req, ok := parsePolicyRequest(policyReq)
+	if !ok {
+		return sp
+	}
+	sp.requested = true
+	if allowedProfile(profiles, &account, req.Uplink) {
+		sp.Uplink = req.Uplink
+	}
+	if allowedProfile(profiles, &account, req.Downlink) {
+		sp.Downlink = req.Downlink
+	}
+	switch req.Padding {
+	case encoding.PaddingNone, encoding.PaddingMax:
+		sp.Padding = req.Padding
+	}
+	sp.Ext = profiles.GrantExt(sp.Uplink)
+	return sp
+}
+
+// negotiatePolicy selects profiles for user and grants the proposed
+// features this inbound supports. Clients that don't negotiate get cover
+// traffic whenever the inbound enables it.
+func (h *Handler) negotiatePolicy(user *protocol.MemoryUser, policyReq []byte) sessionPolicy {
+	sp := selectPolicy(&h.profiles, user, policyReq)
+	sp.identity = h.identity
+	if !sp.requested {
+		if h.coverTraffic {
+			sp.Features = []string{encoding.FeatureCover}
+		}
+		return sp
+	}
+	req, _ := parsePolicyRequest(policyReq)
+	for _, f := range req.Features {
+		if h.supports(f) && !sp.Has(f) {
+			sp.Features = append(sp.Features, f)
+		}
+	}
+	return sp
+}
+
+// supports reports whether this inbound can honour feature.
+func (h *Handler) supports(feature string) bool {
+	switch feature {
+	case encoding.FeatureCover:
+		return h.coverTraffic
+	case encoding.FeatureKeepalive, encoding.FeatureCompress, encoding.FeatureMux, encoding.FeatureFlow, encoding.FeatureHeartbeat, encoding.FeatureStream:
+		return true
+	}
+	return false
+}
+
+// allowedProfile reports whether a client of account may request the named
+// profile of profiles.
+func allowedProfile(profiles *encoding.ProfileSet, a *reflex.MemoryAccount, name string) bool {
+	if name == "" {
+		return false
+	}
+	if _, ok := profiles.Lookup(name); !ok {
+		return false
+	}
+	for _, allowed := range a.AllowedPolicies {
+		if allowed == name {
+			return true
+		}
+	}
+	return false
+}
+
+// grant encodes the policy sent back to the client. Negotiating clients get
+// a signed JSON grant; others get the downlink policy name.
+func (sp sessionPolicy) grant(sessionKey []byte) string {
+	if !sp.requested {
+		return sp.Downlink
+	}
+	body, _ := json.Marshal(sp.PolicyGrant)
+	return string(encoding.SignGrant(sessionKey, sp.identity, body))
+}
+
+// handshakeGrant encodes the grant for the server handshake. One that would
+// not fit is sent without Ext and flagged More, which cut reports.
+func (sp sessionPolicy) handshakeGrant(sessionKey []byte) (grant string, cut bool) {
+	grant = sp.grant(sessionKey)
+	if len(grant)+chacha20poly1305.NonceSize+chacha20poly1305.Overhead <= encoding.MaxPolicyPayloadSize || len(sp.Ext) == 0 {
+		return grant, false
+	}
+	sp.Ext = nil
+	sp.More = true
+	return sp.grant(sessionKey), true
+}
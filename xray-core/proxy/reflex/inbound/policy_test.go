@@ -0,0 +1,132 @@
+package inbound
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestSelectPolicy(t *testing.T) {
+	user := &protocol.MemoryUser{Account: &reflex.MemoryAccount{
+		Policy:          "http2-api",
+		UplinkPolicy:    "zoom",
+		AllowedPolicies: []string{"youtube", "made-up"},
+	}}
+
+	sp := selectPolicy(nil, user, nil)
+	if sp.Uplink != "zoom" || sp.Downlink != "http2-api" {
+		t.Fatalf("unexpected configured policy: %+v", sp)
+	}
+
+	sp = selectPolicy(nil, user, []byte(`{"downlink":"youtube","uplink":"mimic-http2-api"}`))
+	if sp.Downlink != "youtube" {
+		t.Fatalf("allowed downlink request ignored: %+v", sp)
+	}
+	if sp.Uplink != "zoom" {
+		t.Fatalf("request outside the allowlist should be refused: %+v", sp)
+	}
+
+	// Allowlisted names still have to exist.
+	if sp := selectPolicy(nil, user, []byte(`{"downlink":"made-up"}`)); sp.Downlink != "http2-api" {
+		t.Fatalf("unknown profile granted: %+v", sp)
+	}
+
+	// Opaque requests from older clients are ignored.
+	if sp := selectPolicy(nil, user, []byte("youtube")); sp.Downlink != "http2-api" || sp.requested {
+		t.Fatalf("opaque request changed policy: %+v", sp)
+	}
+
+	if sp := selectPolicy(nil, nil, []byte(`{"downlink":"youtube"}`)); sp.Downlink != "" {
+		t.Fatalf("anonymous request granted: %+v", sp)
+	}
+}
+
+func TestPolicyGrantRoundTrip(t *testing.T) {
+	key := testKey()
+	legacy := sessionPolicy{PolicyGrant: encoding.PolicyGrant{Uplink: "zoom", Downlink: "zoom"}}
+	if got := legacy.grant(key); got != "zoom" {
+		t.Fatalf("legacy grant should be the plain policy name, got %q", got)
+	}
+	g, err := encoding.ParsePolicyGrant(key, []byte("zoom"))
+	if err != nil || g.Downlink != "zoom" || g.Padding != encoding.PaddingProfile {
+		t.Fatalf("unexpected legacy grant: %+v, %v", g, err)
+	}
+
+	sp := sessionPolicy{
+		PolicyGrant: encoding.PolicyGrant{Version: encoding.PolicyVersion, Uplink: "zoom", Downlink: "youtube", Features: []string{encoding.FeatureCover}, Padding: encoding.PaddingMax},
+		requested:   true,
+	}
+	grant := sp.grant(key)
+	g, err = encoding.ParsePolicyGrant(key, []byte(grant))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if g.Uplink != "zoom" || g.Downlink != "youtube" || !g.Has(encoding.FeatureCover) || g.Padding != encoding.PaddingMax {
+		t.Fatalf("unexpected grant: %+v", g)
+	}
+
+	tampered := strings.Replace(grant, `"youtube"`, `"zoom"`, 1)
+	if _, err := encoding.ParsePolicyGrant(key, []byte(tampered)); err == nil {
+		t.Fatal("expected tampered grant to be rejected")
+	}
+	if _, err := encoding.ParsePolicyGrant(key, []byte(grant[:len(grant)-1])); err == nil {
+		t.Fatal("expected grant without its trailer to be rejected")
+	}
+	other := testKey()
+	other[0] ^= 0xFF
+	if _, err := encoding.ParsePolicyGrant(other, []byte(grant)); err == nil {
+		t.Fatal("expected grant signed for another session to be rejected")
+	}
+}
+
+func TestHandshakeGrantCutsLargeExt(t *testing.T) {
+	key := testKey()
+	ext := []byte(`{"hints":"` + strings.Repeat("h", encoding.MaxPolicyPayloadSize) + `"}`)
+	sp := sessionPolicy{
+		PolicyGrant: encoding.PolicyGrant{Version: encoding.PolicyVersion, Uplink: "zoom", Downlink: "zoom", Padding: encoding.PaddingMax, Ext: ext},
+		requested:   true,
+	}
+	stub, cut := sp.handshakeGrant(key)
+	if !cut || len(stub) > encoding.MaxPolicyPayloadSize {
+		t.Fatalf("handshake grant of %d bytes not cut short", len(stub))
+	}
+	g, err := encoding.ParsePolicyGrant(key, []byte(stub))
+	if err != nil || !g.More || g.Ext != nil || g.Uplink != "zoom" {
+		t.Fatalf("unexpected handshake grant: %+v, %v", g, err)
+	}
+	sp.Ext = []byte(`{"hints":"short"}`)
+	if grant, cut := sp.handshakeGrant(key); cut {
+		t.Fatalf("handshake grant of %d bytes cut short", len(grant))
+	}
+}
+
+func TestNegotiatePolicyFeatures(t *testing.T) {
+	user := &protocol.MemoryUser{Account: &reflex.MemoryAccount{Policy: "zoom"}}
+	req := []byte(`{"v":1,"features":["cover","udp"],"padding":"none"}`)
+
+	h := &Handler{}
+	if sp := h.negotiatePolicy(user, req); len(sp.Features) != 0 || sp.Padding != encoding.PaddingNone {
+		t.Fatalf("unsupported features granted: %+v", sp)
+	}
+
+	h.coverTraffic = true
+	sp := h.negotiatePolicy(user, req)
+	if len(sp.Features) != 1 || !sp.Has(encoding.FeatureCover) {
+		t.Fatalf("expected only cover to be granted: %+v", sp.Features)
+	}
+	if sp := h.negotiatePolicy(user, []byte(`{"v":1,"features":["mux"]}`)); !sp.Has(encoding.FeatureMux) {
+		t.Fatalf("mux not granted: %+v", sp.Features)
+	}
+	if sp := h.negotiatePolicy(user, []byte(`{"v":1}`)); sp.Has(encoding.FeatureCover) || sp.Padding != encoding.PaddingProfile {
+		t.Fatalf("cover granted without being proposed: %+v", sp)
+	}
+	if sp := h.negotiatePolicy(user, []byte(`{"v":1,"features":["compress"]}`)); !sp.Has(encoding.FeatureCompress) {
+		t.Fatalf("compression not granted: %+v", sp.Features)
+	}
+	if sp := h.negotiatePolicy(user, nil); !sp.Has(encoding.FeatureCover) || sp.requested {
+		t.Fatalf("legacy clients should keep inbound cover traffic: %+v", sp)
+	}
+}
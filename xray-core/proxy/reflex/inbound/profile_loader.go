@@ -0,0 +1,19 @@
+package inbound
+
+import (
+	"context"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// ReloadProfiles re-reads the handler's profile directory.
+func (h *Handler) ReloadProfiles() error {
+	if h.profileDir == "" {
+		return errors.New("reflex inbound has no profile directory")
+	}
+	n, err := h.profiles.Load(h.profileDir)
+	if err == nil {
+		errors.LogInfo(context.Background(), "reloaded ", n, " reflex profiles from ", h.profileDir)
+	}
+	return err
+}
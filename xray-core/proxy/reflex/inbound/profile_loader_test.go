@@ -0,0 +1,58 @@
+package inbound
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+const testProfileJSON = `{
+  "name": "custom-video",
+  "packetSizes": [{"size": 1300, "weight": 0.7}, {"size": 400, "weight": 0.3}],
+  "delays": [{"delayMs": 12.5, "weight": 1}],
+  "pacing": "receiver"
+}`
+
+func TestHandlerLoadsAndReloadsProfileDir(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "video.json"), []byte(testProfileJSON), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	in, err := New(context.Background(), &reflex.InboundConfig{ProfileDir: dir})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	if got := h.profiles.Profile("custom-video"); got.Name != "custom-video" {
+		t.Fatalf("policy should resolve loaded profile, got %s", got.Name)
+	}
+	// Other inbounds and clients don't see it.
+	other, err := New(context.Background(), &reflex.InboundConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := other.(*Handler).profiles.Profile("custom-video"); got.Name != "http2-api" {
+		t.Fatalf("profile leaked to another inbound as %s", got.Name)
+	}
+	if got := (*encoding.ProfileSet)(nil).Profile("custom-video"); got.Name != "http2-api" {
+		t.Fatalf("profile leaked to clients as %s", got.Name)
+	}
+
+	if err := os.Remove(filepath.Join(dir, "video.json")); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.ReloadProfiles(); err != nil {
+		t.Fatal(err)
+	}
+	if got := h.profiles.Profile("custom-video"); got.Name != "http2-api" {
+		t.Fatalf("removed profile should no longer resolve, got %s", got.Name)
+	}
+
+	if err := (&Handler{}).ReloadProfiles(); err == nil {
+		t.Fatal("expected error without a profile directory")
+	}
+}
@@ -0,0 +1,83 @@
+package inbound
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+// puzzleGate decides whether incoming handshakes must carry a solved puzzle,
+// switching on when the observed handshake rate exceeds the trigger.
+type puzzleGate struct {
+	difficulty  uint32
+	triggerRate uint32
+
+	mu          sync.Mutex
+	windowStart time.Time
+	count       uint32
+	lastRate    uint32
+}
+
+func newPuzzleGate(config *reflex.HandshakePuzzle) *puzzleGate {
+	if config.GetDifficulty() == 0 {
+		return nil
+	}
+	difficulty := config.GetDifficulty()
+	if difficulty > encoding.MaxPuzzleDifficulty {
+		difficulty = encoding.MaxPuzzleDifficulty
+	}
+	return &puzzleGate{difficulty: difficulty, triggerRate: config.GetTriggerRate()}
+}
+
+// observe records one handshake and reports whether the puzzle is enforced.
+func (g *puzzleGate) observe(now time.Time) bool {
+	if g == nil {
+		return false
+	}
+	if g.triggerRate == 0 {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if now.Sub(g.windowStart) >= time.Second {
+		g.lastRate = g.count
+		if now.Sub(g.windowStart) >= 2*time.Second {
+			g.lastRate = 0
+		}
+		g.windowStart = now
+		g.count = 0
+	}
+	g.count++
+	return g.count > g.triggerRate || g.lastRate > g.triggerRate
+}
+
+// admit reports whether hs may proceed past the puzzle gate.
+func (g *puzzleGate) admit(hs *encoding.ClientHandshake, now time.Time) bool {
+	if !g.observe(now) {
+		return true
+	}
+	return encoding.VerifyPuzzle(hs, g.difficulty)
+}
+
+// writePuzzleChallenge answers a handshake that didn't solve the enforced
+// puzzle with 429 and the difficulty to retry with, in the decoy's own page
+// where there is one.
+func (h *Handler) writePuzzleChallenge(ctx context.Context, conn stat.Connection) error {
+	page := &cachedResponse{
+		status: http.StatusTooManyRequests,
+		header: http.Header{"Content-Type": {"text/plain"}},
+		body:   []byte(http.StatusText(http.StatusTooManyRequests)),
+	}
+	if resp := h.settings().errorPage(sourceIP(ctx, conn), http.StatusTooManyRequests); resp != nil {
+		page = &cachedResponse{status: resp.status, header: resp.header.Clone(), body: resp.body}
+	}
+	page.header.Set("Retry-After", "0")
+	page.header.Set(encoding.PuzzleHeader, strconv.FormatUint(uint64(h.puzzle.difficulty), 10))
+	return page.write(conn, &http.Request{Method: http.MethodPost, Close: true})
+}
@@ -0,0 +1,76 @@
+package inbound
+
+import (
+	"context"
+	goerrors "errors"
+	"net"
+	"net/http"
+	"testing"
+	"time"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestPuzzleGateTriggersOnRate(t *testing.T) {
+	if newPuzzleGate(&reflex.HandshakePuzzle{}) != nil {
+		t.Fatal("zero difficulty should disable the gate")
+	}
+	g := newPuzzleGate(&reflex.HandshakePuzzle{Difficulty: 16, TriggerRate: 3})
+	hs := buildClientHandshake(t, [16]byte{1}, time.Now().Unix(), [16]byte{3}, nil)
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if !g.admit(&hs, now) {
+			t.Fatal("handshakes under the trigger rate should pass without a puzzle")
+		}
+	}
+	if !encoding.VerifyPuzzle(&hs, 16) && g.admit(&hs, now) {
+		t.Fatal("unsolved handshake should be rejected above the trigger rate")
+	}
+	encoding.SolvePuzzle(&hs, 16)
+	if !g.admit(&hs, now) {
+		t.Fatal("solved handshake should pass while the gate is active")
+	}
+
+	later := now.Add(3 * time.Second)
+	unsolved := buildClientHandshake(t, [16]byte{1}, later.Unix(), [16]byte{4}, nil)
+	if !g.admit(&unsolved, later) {
+		t.Fatal("gate should relax once the rate drops")
+	}
+}
+
+func TestUnsolvedPuzzleTellsTheDifficulty(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String()}},
+		Puzzle:  &reflex.HandshakePuzzle{Difficulty: 10},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+	connect := func(difficulty uint32) error {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{PuzzleDifficulty: difficulty}
+		copy(config.UserID[:], id.Bytes())
+		_, err := encoding.NewClientConn(context.Background(), clientConn, config)
+		return err
+	}
+
+	var rejected *encoding.RejectedError
+	if err := connect(0); !goerrors.As(err, &rejected) {
+		t.Fatalf("unsolved handshake answered %v", err)
+	}
+	if rejected.StatusCode != http.StatusTooManyRequests || rejected.PuzzleDifficulty != 10 || rejected.Permanent() {
+		t.Fatalf("unsolved handshake rejected with %+v", rejected)
+	}
+	if err := connect(rejected.PuzzleDifficulty); err != nil {
+		t.Fatalf("solved handshake failed: %v", err)
+	}
+}
@@ -0,0 +1,131 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"sync"
+
+	"github.com/quic-go/quic-go"
+
+	"github.com/xtls/xray-core/common/errors"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// quicServer is the QUIC listener configured with quic_listen. The handler's
+// Start opens it and Close stops it along with the connections it accepted.
+type quicServer struct {
+	addr       string
+	tlsConfig  *tls.Config
+	ctx        context.Context
+	dispatcher routing.Dispatcher
+
+	access   sync.Mutex
+	listener *quic.Listener
+	cancel   context.CancelFunc
+}
+
+// newQUICServer loads the certificate of a QUIC listener on addr, so a bad
+// certificate fails the config rather than Start.
+func newQUICServer(ctx context.Context, addr, certFile, keyFile string) (*quicServer, error) {
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return nil, errors.New("failed to load reflex quic certificate").Base(err)
+	}
+	return &quicServer{
+		addr: addr,
+		tlsConfig: &tls.Config{
+			Certificates: []tls.Certificate{cert},
+			NextProtos:   []string{encoding.QUICALPN},
+			MinVersion:   tls.VersionTLS13,
+		},
+		ctx: ctx,
+	}, nil
+}
+
+// start listens and serves sessions for h until close.
+func (s *quicServer) start(h *Handler) error {
+	s.access.Lock()
+	defer s.access.Unlock()
+	if s.listener != nil {
+		return nil
+	}
+	if s.dispatcher == nil {
+		return errors.New("reflex quic listener has no dispatcher")
+	}
+	l, err := quic.ListenAddr(s.addr, s.tlsConfig, encoding.QUICConfig())
+	if err != nil {
+		return errors.New("failed to listen reflex quic on ", s.addr).Base(err)
+	}
+	ctx, cancel := context.WithCancel(s.ctx)
+	s.listener, s.cancel = l, cancel
+	go h.serveQUIC(ctx, l, s.dispatcher)
+	return nil
+}
+
+// close stops the listener and closes its connections.
+func (s *quicServer) close() error {
+	s.access.Lock()
+	defer s.access.Unlock()
+	if s.listener == nil {
+		return nil
+	}
+	s.cancel()
+	err := s.listener.Close()
+	s.listener, s.cancel = nil, nil
+	return err
+}
+
+// serveQUIC accepts connections until l is closed.
+func (h *Handler) serveQUIC(ctx context.Context, l *quic.Listener, dispatcher routing.Dispatcher) {
+	for {
+		conn, err := l.Accept(ctx)
+		if err != nil {
+			errors.LogInfoInner(ctx, err, "reflex quic listener stopped")
+			return
+		}
+		go h.serveQUICConn(ctx, conn, dispatcher)
+	}
+}
+
+// serveQUICConn runs a session on every stream the client opens, until the
+// connection ends or the listener is closed.
+func (h *Handler) serveQUICConn(ctx context.Context, conn *quic.Conn, dispatcher routing.Dispatcher) {
+	defer conn.CloseWithError(0, "")
+	source := xnet.DestinationFromAddr(conn.RemoteAddr())
+	for {
+		stream, err := conn.AcceptStream(ctx)
+		if err != nil {
+			return
+		}
+		// Each stream is a session of its own, with its own user.
+		streamCtx := session.ContextWithInbound(ctx, &session.Inbound{Source: source})
+		go func() {
+			if err := h.serveQUICStream(streamCtx, stream, conn, dispatcher); err != nil {
+				errors.LogInfoInner(streamCtx, err, "reflex quic stream ended")
+			}
+		}()
+	}
+}
+
+// serveQUICStream runs one session. Like a TCP connection, a stream that
+// does not start with the magic goes to the fallback.
+func (h *Handler) serveQUICStream(ctx context.Context, stream *quic.Stream, conn *quic.Conn, dispatcher routing.Dispatcher) error {
+	streamConn := encoding.NewQUICStreamConn(stream, conn)
+	defer streamConn.Close()
+	reader := bufio.NewReader(streamConn)
+	peeked, err := peekForDetection(reader, 4)
+	if err != nil && err.Error() != "EOF" {
+		return err
+	}
+	if len(peeked) == 0 {
+		return nil
+	}
+	if h.isReflexMagic(peeked) {
+		return h.handleReflexMagic(ctx, reader, streamConn, dispatcher)
+	}
+	return h.handleFallback(ctx, reader, streamConn)
+}
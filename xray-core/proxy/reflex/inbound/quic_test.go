@@ -0,0 +1,149 @@
+package inbound
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/quic-go/quic-go"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol/tls/cert"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/internet"
+)
+
+// startQUIC starts a handler listening for QUIC as config, plus a
+// certificate for quic.example.com, and returns it with its address. The
+// caller closes the handler.
+func startQUIC(t *testing.T, config *reflex.InboundConfig) (*Handler, net.Addr) {
+	t.Helper()
+	dir := t.TempDir()
+	certPEM, keyPEM := cert.MustGenerate(nil, cert.DNSNames("quic.example.com")).ToPEM()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, certPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	config.QuicListen = "127.0.0.1:0"
+	config.QuicCertificateFile, config.QuicKeyFile = certFile, keyFile
+	in, err := New(context.Background(), config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	h.quic.dispatcher = echoDispatcher{dest: make(chan xnet.Destination, 1)}
+	if err := h.Start(); err != nil {
+		t.Fatal(err)
+	}
+	return h, h.quic.listener.Addr()
+}
+
+func TestQUICSessionEndToEnd(t *testing.T) {
+	id := uuid.New()
+	h, addr := startQUIC(t, &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+	})
+	defer h.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	// The outbound's dialer hands out UDP sockets in this wrapper.
+	udp, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer udp.Close()
+	stream, err := encoding.DialQUIC(ctx, &internet.PacketConnWrapper{Conn: udp, Dest: addr}, "quic.example.com", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stream.Close()
+
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(ctx, stream, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "over quic")
+}
+
+func TestQUICStreamFallsBack(t *testing.T) {
+	decoy, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer decoy.Close()
+	go func() {
+		conn, err := decoy.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		conn.Read(make([]byte, 64))
+		io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n")
+	}()
+	h, addr := startQUIC(t, &reflex.InboundConfig{
+		Fallback: &reflex.Fallback{Dest: uint32(decoy.Addr().(*net.TCPAddr).Port)},
+	})
+	defer h.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	conn, err := quic.DialAddr(ctx, addr.String(), &tls.Config{
+		NextProtos:         []string{encoding.QUICALPN},
+		InsecureSkipVerify: true,
+	}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.CloseWithError(0, "")
+	stream, err := conn.OpenStreamSync(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream.SetDeadline(time.Now().Add(5 * time.Second))
+	if _, err := io.WriteString(stream, "GET / HTTP/1.1\r\nHost: quic.example.com\r\n\r\n"); err != nil {
+		t.Fatal(err)
+	}
+	reply := make([]byte, len("HTTP/1.1 200 OK"))
+	if _, err := io.ReadFull(stream, reply); err != nil {
+		t.Fatalf("no fallback reply: %v", err)
+	}
+	if string(reply) != "HTTP/1.1 200 OK" {
+		t.Fatalf("fallback replied %q", reply)
+	}
+}
+
+func TestQUICListenerStopsOnClose(t *testing.T) {
+	h, addr := startQUIC(t, &reflex.InboundConfig{})
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if conn, err := quic.DialAddr(ctx, addr.String(), &tls.Config{
+		NextProtos:         []string{encoding.QUICALPN},
+		InsecureSkipVerify: true,
+	}, nil); err == nil {
+		conn.CloseWithError(0, "")
+		t.Fatal("closed handler still accepts quic connections")
+	}
+}
+
+func TestQUICRequiresCertificate(t *testing.T) {
+	if _, err := New(context.Background(), &reflex.InboundConfig{QuicListen: "127.0.0.1:0"}); err == nil {
+		t.Fatal("expected listening without a certificate to fail")
+	}
+}
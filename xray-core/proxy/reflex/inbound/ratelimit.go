@@ -0,0 +1,140 @@
+package inbound
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// tokenBucket throttles one direction of a user's sessions to rate bytes
+// per second, with bursts of up to a second's worth. The sessions share it,
+// so it is locked. A nil bucket is unlimited.
+type tokenBucket struct {
+	rate float64
+
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(rate uint64) *tokenBucket {
+	if rate == 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), tokens: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens, blocking until the bucket has refilled enough to
+// cover them or ctx is done. Writes larger than the burst go into debt, so
+// they are never stuck, and concurrent writers queue behind each other's
+// debt.
+func (b *tokenBucket) wait(ctx context.Context, n int) error {
+	if b == nil || n <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	tokens := b.tokens
+	b.mu.Unlock()
+	if tokens >= 0 {
+		return nil
+	}
+	timer := time.NewTimer(time.Duration(-tokens / b.rate * float64(time.Second)))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// rateKey names a shared bucket: one direction of a user's sessions under
+// a policy, at a rate. A changed limit starts a new bucket.
+type rateKey struct {
+	email  string
+	policy string
+	uplink bool
+	rate   uint64
+}
+
+type sharedBucket struct {
+	*tokenBucket
+	refs int
+}
+
+// rateBuckets holds the buckets of the sessions that are running, so all
+// sessions of a user draw from the same ones.
+type rateBuckets struct {
+	mu      sync.Mutex
+	buckets map[rateKey]*sharedBucket
+}
+
+// acquire returns the bucket of key, creating it for the first session.
+func (r *rateBuckets) acquire(key rateKey) *tokenBucket {
+	if key.rate == 0 {
+		return nil
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.buckets == nil {
+		r.buckets = make(map[rateKey]*sharedBucket)
+	}
+	b := r.buckets[key]
+	if b == nil {
+		b = &sharedBucket{tokenBucket: newTokenBucket(key.rate)}
+		r.buckets[key] = b
+	}
+	b.refs++
+	return b.tokenBucket
+}
+
+// release drops a session's hold on the bucket of key, forgetting the
+// bucket with the last one.
+func (r *rateBuckets) release(key rateKey) {
+	if key.rate == 0 {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if b := r.buckets[key]; b != nil {
+		if b.refs--; b.refs == 0 {
+			delete(r.buckets, key)
+		}
+	}
+}
+
+// rateLimits returns the buckets of a session of user under policy, shared
+// with the user's other sessions under the same policies, and the function
+// that gives them back when the session ends. The user's own limits win
+// over those of its policies.
+func (h *Handler) rateLimits(user *protocol.MemoryUser, policy sessionPolicy) (uplink, downlink *tokenBucket, release func()) {
+	limits := h.settings().policyRateLimits
+	up := rateKey{policy: policy.Uplink, uplink: true, rate: limits[policy.Uplink].GetUplink()}
+	down := rateKey{policy: policy.Downlink, rate: limits[policy.Downlink].GetDownlink()}
+	if user != nil {
+		up.email, down.email = user.Email, user.Email
+		if account, ok := user.Account.(*reflex.MemoryAccount); ok && account.RateLimit != nil {
+			if account.RateLimit.GetUplink() > 0 {
+				up.policy, up.rate = "", account.RateLimit.GetUplink()
+			}
+			if account.RateLimit.GetDownlink() > 0 {
+				down.policy, down.rate = "", account.RateLimit.GetDownlink()
+			}
+		}
+	}
+	release = func() {
+		h.rateBuckets.release(up)
+		h.rateBuckets.release(down)
+	}
+	return h.rateBuckets.acquire(up), h.rateBuckets.acquire(down), release
+}
@@ -0,0 +1,100 @@
+package inbound
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestTokenBucketThrottles(t *testing.T) {
+	b := newTokenBucket(10000)
+	start := time.Now()
+	if err := b.wait(context.Background(), 10000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 100*time.Millisecond {
+		t.Fatalf("burst waited %v", elapsed)
+	}
+	if err := b.wait(context.Background(), 3000); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("3000 bytes over the burst at 10000/s took only %v", elapsed)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := b.wait(ctx, 100000); err == nil {
+		t.Fatal("wait ignored a cancelled context")
+	}
+	if err := (*tokenBucket)(nil).wait(ctx, 100000); err != nil {
+		t.Fatal("nil bucket throttled")
+	}
+}
+
+func TestRateLimitsPreferUserOverPolicy(t *testing.T) {
+	h := &Handler{}
+	h.current.Store(&settings{policyRateLimits: map[string]*reflex.RateLimit{
+		"free": {Uplink: 1000, Downlink: 2000},
+	}})
+	policy := sessionPolicy{PolicyGrant: encoding.PolicyGrant{Uplink: "free", Downlink: "free"}}
+	up, down, _ := h.rateLimits(nil, policy)
+	if up.rate != 1000 || down.rate != 2000 {
+		t.Fatalf("policy limits %v/%v", up.rate, down.rate)
+	}
+
+	user := &protocol.MemoryUser{Account: &reflex.MemoryAccount{RateLimit: &reflex.RateLimit{Downlink: 5000}}}
+	up, down, _ = h.rateLimits(user, policy)
+	if up.rate != 1000 || down.rate != 5000 {
+		t.Fatalf("user limits %v/%v", up.rate, down.rate)
+	}
+
+	policy.Downlink = "paid"
+	if _, down, _ = h.rateLimits(nil, policy); down != nil {
+		t.Fatal("unlimited policy throttled")
+	}
+}
+
+func TestRateLimitsAreSharedByAUsersSessions(t *testing.T) {
+	h := &Handler{}
+	h.current.Store(&settings{policyRateLimits: map[string]*reflex.RateLimit{
+		"free": {Uplink: 10000},
+	}})
+	policy := sessionPolicy{PolicyGrant: encoding.PolicyGrant{Uplink: "free", Downlink: "free"}}
+	alice := &protocol.MemoryUser{Email: "alice"}
+	first, _, releaseFirst := h.rateLimits(alice, policy)
+	second, _, releaseSecond := h.rateLimits(alice, policy)
+	if first != second {
+		t.Fatal("sessions of one user got separate buckets")
+	}
+	if other, _, release := h.rateLimits(&protocol.MemoryUser{Email: "bob"}, policy); other == first {
+		t.Fatal("users share a bucket")
+	} else {
+		release()
+	}
+
+	// Two sessions draining the burst at once wait for each other's debt.
+	start := time.Now()
+	errs := make(chan error, 2)
+	for _, b := range []*tokenBucket{first, second} {
+		go func() { errs <- b.wait(context.Background(), 8000) }()
+	}
+	for i := 0; i < 2; i++ {
+		if err := <-errs; err != nil {
+			t.Fatal(err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 500*time.Millisecond {
+		t.Fatalf("16000 bytes at 10000/s took only %v", elapsed)
+	}
+
+	releaseFirst()
+	releaseSecond()
+	if len(h.rateBuckets.buckets) != 0 {
+		t.Fatalf("%d buckets left after the sessions ended", len(h.rateBuckets.buckets))
+	}
+}
@@ -0,0 +1,78 @@
+package inbound
+
+import (
+	"context"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// settings are the parts of an inbound's config that Reload swaps while it
+// runs, with what is compiled from them. A snapshot is never modified once
+// stored, so a connection sees one consistent set.
+type settings struct {
+	fallback *reflex.Fallback
+	// policyRateLimits throttles sessions by policy name.
+	policyRateLimits map[string]*reflex.RateLimit
+	// geoFallbacks and decoys are compiled from the inbound's and the
+	// users' fallbacks.
+	geoFallbacks map[*reflex.Fallback][]geoFallback
+	decoys       map[uint32]*decoyCache
+}
+
+// settings returns the current snapshot.
+func (h *Handler) settings() *settings {
+	if s := h.current.Load(); s != nil {
+		return s
+	}
+	return &settings{}
+}
+
+// newSettings compiles a snapshot of fallback, the users' fallbacks and
+// policyRateLimits. Its decoys are not prefetching until start.
+func (h *Handler) newSettings(fallback *reflex.Fallback, policyRateLimits map[string]*reflex.RateLimit) (*settings, error) {
+	s := &settings{fallback: fallback, policyRateLimits: policyRateLimits}
+	for _, u := range h.users() {
+		if err := s.compileFallback(u.user.Account.(*reflex.MemoryAccount).Fallback); err != nil {
+			return nil, errors.New("reflex user ", u.user.Email).Base(err)
+		}
+	}
+	if err := s.compileFallback(fallback); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *settings) start() {
+	for _, d := range s.decoys {
+		d.start()
+	}
+}
+
+func (s *settings) stop() {
+	for _, d := range s.decoys {
+		d.Close()
+	}
+}
+
+// Reload implements reflex.Reloader. Connections already relayed to a
+// fallback and running sessions keep what they started with.
+func (h *Handler) Reload(ctx context.Context, fallback *reflex.Fallback, policyRateLimits map[string]*reflex.RateLimit, reloadProfiles bool) error {
+	if reloadProfiles {
+		if err := h.ReloadProfiles(); err != nil {
+			return err
+		}
+	}
+	s, err := h.newSettings(fallback, policyRateLimits)
+	if err != nil {
+		return err
+	}
+	s.start()
+	if old := h.current.Swap(s); old != nil {
+		old.stop()
+	}
+	errors.LogInfo(ctx, "reflex inbound settings reloaded")
+	return nil
+}
+
+var _ reflex.Reloader = (*Handler)(nil)
@@ -0,0 +1,74 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestReloadSwapsFallbackAndRateLimits(t *testing.T) {
+	listen := func() (uint32, chan []byte) {
+		ln, err := net.Listen("tcp", "127.0.0.1:0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { ln.Close() })
+		received := make(chan []byte, 1)
+		go func() {
+			c, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer c.Close()
+			data, _ := io.ReadAll(c)
+			received <- data
+		}()
+		return uint32(ln.Addr().(*net.TCPAddr).Port), received
+	}
+	oldPort, _ := listen()
+	newPort, received := listen()
+
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Fallback:         &reflex.Fallback{Dest: oldPort},
+		PolicyRateLimits: map[string]*reflex.RateLimit{"free": {Uplink: 1000}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+
+	if err := h.Reload(context.Background(), &reflex.Fallback{Dest: newPort}, nil, true); err == nil {
+		t.Fatal("reloaded profiles without a profile directory")
+	}
+	if h.settings().fallback.GetDest() != oldPort {
+		t.Fatal("failed reload changed the settings")
+	}
+
+	limits := map[string]*reflex.RateLimit{"free": {Uplink: 5000}}
+	if err := h.Reload(context.Background(), &reflex.Fallback{Dest: newPort}, limits, false); err != nil {
+		t.Fatal(err)
+	}
+	policy := sessionPolicy{PolicyGrant: encoding.PolicyGrant{Uplink: "free", Downlink: "free"}}
+	if up, _, _ := h.rateLimits(nil, policy); up.rate != 5000 {
+		t.Fatalf("uplink limit %v after reload", up.rate)
+	}
+	if err := h.handleFallback(context.Background(), bufio.NewReader(strings.NewReader("GET / HTTP/1.1\r\n\r\n")), newFakeConn(nil)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if !strings.HasPrefix(string(data), "GET /") {
+			t.Fatalf("new fallback got %q", data)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("fallback not sent to the reloaded destination")
+	}
+}
@@ -3,302 +3,381 @@ package inbound
 import (
 	"bufio"
 	"context"
-	"crypto/sha256"
-	"encoding/binary"
 	"io"
-	"sync"
 	"time"
 
-	"golang.org/x/crypto/chacha20poly1305"
-
 	"github.com/xtls/xray-core/common"
 	"github.com/xtls/xray-core/common/buf"
 	"github.com/xtls/xray-core/common/errors"
 	"github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/signal"
 	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	"github.com/xtls/xray-core/transport"
 	"github.com/xtls/xray-core/transport/internet/stat"
 )
 
 const (
-	FrameTypeData    = 0x01
-	FrameTypePadding = 0x02
-	FrameTypeTiming  = 0x03
-	FrameTypeClose   = 0x04
-
-	maxFramePayloadSize = 65535
-	replayWindowSize    = 1000
+	// maxReadBatch caps how many frames the session loop drains per wakeup.
+	maxReadBatch = 64
+	// sessionReadBufferSize lets the session loop buffer several frames from
+	// one read, so bursts are handed upstream together.
+	sessionReadBufferSize = 32 * 1024
 )
 
-// Frame is one encrypted Reflex frame.
-type Frame struct {
-	Length  uint16
-	Type    uint8
-	Payload []byte
-}
-
-// Session stores framing and AEAD state for one Reflex connection.
-type Session struct {
-	aead       cipherAEAD
-	readNonce  uint64
-	writeNonce uint64
-	profile    *TrafficProfile
-
-	writeMu sync.Mutex
-
-	replayMu    sync.Mutex
-	replaySeen  map[[32]byte]struct{}
-	replayOrder [][32]byte
+// policyViolation marks an error caused by the authenticated peer breaking
+// the session protocol, as opposed to transport or upstream failures.
+type policyViolation struct {
+	err error
 }
 
-type cipherAEAD interface {
-	NonceSize() int
-	Overhead() int
-	Seal(dst, nonce, plaintext, additionalData []byte) []byte
-	Open(dst, nonce, ciphertext, additionalData []byte) ([]byte, error)
+func (v *policyViolation) Error() string {
+	return "reflex session policy violation: " + v.err.Error()
 }
 
-// NewSession creates a new encrypted frame session.
-func NewSession(sessionKey []byte) (*Session, error) {
-	aead, err := chacha20poly1305.New(sessionKey)
-	if err != nil {
-		return nil, err
-	}
-	return &Session{
-		aead:       aead,
-		replaySeen: make(map[[32]byte]struct{}),
-	}, nil
+func (v *policyViolation) Unwrap() error {
+	return v.err
 }
 
-// SetTrafficProfile sets traffic morphing profile for this session.
-func (s *Session) SetTrafficProfile(profile *TrafficProfile) {
-	s.profile = profile
+func isPolicyViolation(err error) bool {
+	_, ok := err.(*policyViolation)
+	return ok
 }
 
-func makeNonce(counter uint64) []byte {
-	nonce := make([]byte, chacha20poly1305.NonceSize)
-	binary.BigEndian.PutUint64(nonce[4:], counter)
-	return nonce
-}
-
-func (s *Session) rememberCiphertext(ciphertext []byte) bool {
-	h := sha256.Sum256(ciphertext)
-	s.replayMu.Lock()
-	defer s.replayMu.Unlock()
-
-	if _, found := s.replaySeen[h]; found {
-		return false
-	}
-	s.replaySeen[h] = struct{}{}
-	s.replayOrder = append(s.replayOrder, h)
-	if len(s.replayOrder) > replayWindowSize {
-		old := s.replayOrder[0]
-		s.replayOrder = s.replayOrder[1:]
-		delete(s.replaySeen, old)
+// appendPayload adds a DATA payload to the batch for the upstream link.
+func appendPayload(mb buf.MultiBuffer, payload []byte) buf.MultiBuffer {
+	if len(payload) == 0 {
+		return mb
 	}
-	return true
+	return append(mb, buf.FromBytes(payload))
 }
 
-// ReadFrame reads and decrypts one frame from reader.
-func (s *Session) ReadFrame(reader io.Reader) (*Frame, error) {
-	header := make([]byte, 3)
-	if _, err := io.ReadFull(reader, header); err != nil {
-		return nil, err
+func forwardUpstreamToClient(ctx context.Context, link *transport.Link, session *encoding.Session, conn stat.Connection, marks encoding.Watermarks, limit *tokenBucket, timer *signal.ActivityTimer, uplinkOnly time.Duration, traffic *userTraffic, quotaExhausted func(), errCh chan<- error) {
+	pipeline := encoding.NewMorphPipeline(session, conn, marks)
+	for {
+		mb, err := link.Reader.ReadMultiBuffer()
+		if err != nil {
+			// Flush queued frames first so a Close frame never overtakes data.
+			if writeErr := pipeline.Close(); writeErr != nil {
+				err = writeErr
+			} else {
+				// Tell the client right away whether upstream finished or
+				// failed; it may be idle and not send anything that would
+				// wake the read loop.
+				writeErr := session.WriteFrame(conn, encoding.FrameTypeClose, encoding.ClosePayload(err, encoding.CloseErrorUpstream))
+				if writeErr != nil && err == io.EOF {
+					err = writeErr
+				}
+			}
+			if err == io.EOF {
+				// Only the client may still send.
+				timer.SetTimeout(uplinkOnly)
+			}
+			errCh <- err
+			return
+		}
+		timer.Update()
+		n := int(mb.Len())
+		if waitErr := limit.wait(ctx, n); waitErr != nil {
+			buf.ReleaseMulti(mb)
+			pipeline.Close()
+			errCh <- waitErr
+			return
+		}
+		if writeErr := pipeline.Write(mb); writeErr != nil {
+			pipeline.Close()
+			errCh <- writeErr
+			return
+		}
+		if traffic.addDownlink(n) {
+			quotaExhausted()
+		}
 	}
+}
 
-	length := binary.BigEndian.Uint16(header[:2])
-	frameType := header[2]
-	if length == 0 || int(length) > maxFramePayloadSize {
-		return nil, errors.New("invalid reflex frame length")
+// muxCoolAddress is the destination of Xray's mux sessions.
+var muxCoolAddress = net.DomainAddress("v1.mux.cool")
+
+// sessionContext records the authenticated user, the client's address and
+// the protocol on ctx, so routing rules on user email or level, source IP
+// and protocol see this session.
+func sessionContext(ctx context.Context, conn stat.Connection, user *protocol.MemoryUser) context.Context {
+	inbound := session.InboundFromContext(ctx)
+	if inbound == nil {
+		inbound = &session.Inbound{}
+		ctx = session.ContextWithInbound(ctx, inbound)
 	}
-
-	encryptedPayload := make([]byte, int(length))
-	if _, err := io.ReadFull(reader, encryptedPayload); err != nil {
-		return nil, err
+	inbound.Name = "reflex"
+	inbound.User = user
+	inbound.CanSpliceCopy = 3
+	if !inbound.Source.IsValid() {
+		switch addr := conn.RemoteAddr().(type) {
+		case *net.TCPAddr, *net.UDPAddr:
+			inbound.Source = net.DestinationFromAddr(addr)
+		}
 	}
-	if !s.rememberCiphertext(encryptedPayload) {
-		return nil, errors.New("replay detected")
+	content := session.ContentFromContext(ctx)
+	if content == nil {
+		content = new(session.Content)
+		ctx = session.ContextWithContent(ctx, content)
 	}
-
-	nonce := makeNonce(s.readNonce)
-	s.readNonce++
-	payload, err := s.aead.Open(nil, nonce, encryptedPayload, nil)
-	if err != nil {
-		return nil, err
+	if content.Protocol == "" {
+		content.Protocol = "reflex"
 	}
-
-	return &Frame{Length: length, Type: frameType, Payload: payload}, nil
+	return ctx
 }
 
-// WriteFrame encrypts and writes one frame.
-func (s *Session) WriteFrame(writer io.Writer, frameType uint8, data []byte) error {
-	s.writeMu.Lock()
-	defer s.writeMu.Unlock()
-
-	nonce := makeNonce(s.writeNonce)
-	s.writeNonce++
-	encrypted := s.aead.Seal(nil, nonce, data, nil)
-	if len(encrypted) > maxFramePayloadSize {
-		return errors.New("frame too large")
-	}
-
-	header := make([]byte, 3)
-	binary.BigEndian.PutUint16(header[:2], uint16(len(encrypted)))
-	header[2] = frameType
-
-	if _, err := writer.Write(header); err != nil {
+func (h *Handler) handleSession(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher, sessionKey []byte, user *protocol.MemoryUser, policy sessionPolicy) (err error) {
+	ctx = sessionContext(ctx, conn, user)
+	ctx, levelPolicy := h.applyLevelPolicy(ctx, user)
+	ctx, cancel := context.WithCancel(ctx)
+	timer := signal.CancelAfterInactivity(ctx, cancel, levelPolicy.Timeouts.ConnectionIdle)
+	defer timer.SetTimeout(0)
+	// Closing conn is what unblocks reads in every envelope. A session that
+	// ends normally stops this first, so conn stays usable for a fallback.
+	stopIdleClose := context.AfterFunc(ctx, func() { conn.Close() })
+	defer stopIdleClose()
+	session, err := encoding.NewSession(sessionKey)
+	if err != nil {
 		return err
 	}
-	if _, err := writer.Write(encrypted); err != nil {
-		return err
+	session.SetProtocolVersion(policy.version)
+	session.SetTrafficProfile(h.profiles.Profile(policy.Downlink))
+	session.SetPaddingLevel(policy.Padding)
+	session.SetCoalescing(h.coalesce)
+	session.SetCompression(policy.Has(encoding.FeatureCompress))
+	session.SetStreamMode(policy.Has(encoding.FeatureStream))
+	session.SetMaxFrameSize(encoding.FrameSizeFor(conn, h.maxFrameSize))
+	var email string
+	if user != nil {
+		email = user.Email
 	}
-	return nil
-}
-
-// WriteFrameWithMorphing writes data frames with size/timing shaping.
-func (s *Session) WriteFrameWithMorphing(writer io.Writer, frameType uint8, data []byte) error {
-	if frameType != FrameTypeData || s.profile == nil {
-		return s.WriteFrame(writer, frameType, data)
+	log := h.newSessionLog(ctx, email)
+	if h.metrics != nil || log != nil {
+		session.SetObserver(sessionObserver{metrics: h.metrics, log: log})
 	}
-
-	remaining := data
-	for len(remaining) > 0 {
-		targetSize := s.profile.GetPacketSize()
-		if targetSize <= 0 {
-			targetSize = len(remaining)
-		}
-
-		chunkSize := len(remaining)
-		if chunkSize > targetSize {
-			chunkSize = targetSize
+	if h.entropyMonitor {
+		session.MonitorEntropy(ctx)
+	}
+	// traffic accounts the payload to the user, and quotaExhausted ends the
+	// user's sessions once that goes over their quota.
+	var traffic *userTraffic
+	quotaExhausted := func() { h.closeUser(email, "quota exhausted") }
+	if user != nil {
+		traffic = h.traffic.user(email)
+		if account, ok := user.Account.(*reflex.MemoryAccount); ok {
+			if traffic != nil {
+				traffic.quota.Store(account.Quota)
+			}
+			// Sessions don't outlive their user.
+			if !account.ExpiresAt.IsZero() {
+				expire := time.AfterFunc(time.Until(account.ExpiresAt), func() {
+					log.event("reflex session closed: user expired")
+					cancel()
+				})
+				defer expire.Stop()
+			}
 		}
-		chunk := remaining[:chunkSize]
-		remaining = remaining[chunkSize:]
-
-		if err := s.WriteFrame(writer, FrameTypeData, chunk); err != nil {
-			return err
+	}
+	log.event("reflex session started for ", email, ": uplink ", policy.Uplink, ", downlink ", policy.Downlink, ", padding ", policy.Padding, ", features ", policy.Features)
+	defer func() {
+		if err != nil {
+			log.event("reflex session ended: ", err)
+		} else {
+			log.event("reflex session ended")
 		}
-
-		// Use control frames to coordinate peer-side shaping.
-		if err := s.SendPaddingControl(writer, targetSize); err != nil {
+	}()
+	uplinkLimit, downlinkLimit, releaseLimits := h.rateLimits(user, policy)
+	defer releaseLimits()
+	h.metrics.sessionActive(1)
+	defer h.metrics.sessionActive(-1)
+	// Sent before the session is tracked, so a live update can't be
+	// overtaken by it.
+	if policy.deferred {
+		if err := session.WritePolicyGrant(conn, []byte(policy.grant(sessionKey))); err != nil {
 			return err
 		}
-		delay := s.profile.GetDelay()
-		if delay > 0 {
-			if err := s.SendTimingControl(writer, delay); err != nil {
-				return err
-			}
-			time.Sleep(delay)
-		}
 	}
-
-	return nil
-}
-
-func parseDestination(data []byte) (net.Destination, []byte, error) {
-	if len(data) < 3 {
-		return net.Destination{}, nil, errors.New("data frame too short")
+	defer h.untrack(h.track(ctx, cancel, user, session, log, conn, sessionKey, policy))
+	if policy.Has(encoding.FeatureFlow) {
+		session.EnableFlowControl()
+		defer session.CloseFlow()
+		flowCtx, cancelFlow := context.WithCancel(ctx)
+		defer cancelFlow()
+		go session.RunWindowUpdates(flowCtx, conn)
 	}
-	addrLen := int(data[0])
-	if len(data) < 1+addrLen+2 {
-		return net.Destination{}, nil, errors.New("data frame missing destination")
-	}
-	addr := net.ParseAddress(string(data[1 : 1+addrLen]))
-	port := binary.BigEndian.Uint16(data[1+addrLen : 1+addrLen+2])
-	return net.TCPDestination(addr, net.Port(port)), data[1+addrLen+2:], nil
-}
-
-func writeUpstream(link *transport.Link, payload []byte) error {
-	if len(payload) == 0 {
-		return nil
+	if policy.Has(encoding.FeatureCover) {
+		coverCtx, cancelCover := context.WithCancel(ctx)
+		defer cancelCover()
+		go session.RunCoverTraffic(coverCtx, conn)
 	}
-	return link.Writer.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes(payload)})
-}
-
-func forwardUpstreamToClient(link *transport.Link, session *Session, conn stat.Connection, errCh chan<- error) {
-	for {
-		mb, err := link.Reader.ReadMultiBuffer()
-		if err != nil {
-			errCh <- err
-			return
-		}
-		for _, b := range mb {
-			if writeErr := session.WriteFrameWithMorphing(conn, FrameTypeData, b.Bytes()); writeErr != nil {
-				b.Release()
-				errCh <- writeErr
-				return
+	if policy.Has(encoding.FeatureHeartbeat) {
+		heartbeatCtx, cancelHeartbeat := context.WithCancel(ctx)
+		defer cancelHeartbeat()
+		go func() {
+			if session.RunHeartbeat(heartbeatCtx, conn, encoding.HeartbeatInterval) == encoding.ErrPeerDead {
+				log.event("reflex client stopped answering heartbeats")
+				cancel()
 			}
-			b.Release()
-		}
-	}
-}
-
-func (h *Handler) handleSession(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher, sessionKey []byte, user *protocol.MemoryUser) error {
-	session, err := NewSession(sessionKey)
-	if err != nil {
-		return err
+		}()
 	}
-	session.SetTrafficProfile(profileFromPolicy(userPolicy(user)))
 
 	var link *transport.Link
+	defer func() {
+		if link != nil && isPolicyViolation(err) {
+			common.Interrupt(link.Writer)
+		}
+	}()
 	upstreamErr := make(chan error, 1)
 
-	for {
-		frame, err := session.ReadFrame(reader)
-		if err != nil {
-			if err == io.EOF {
-				return nil
+	// Payloads are batched per wakeup and written upstream as one
+	// MultiBuffer; a TIMING frame flushes the batch so data it holds back
+	// is released in order.
+	var pending buf.MultiBuffer
+	var pendingCredit int
+	flush := func() error {
+		if !pending.IsEmpty() {
+			session.AwaitRelease(ctx)
+			mb := pending
+			pending = nil
+			n := int(mb.Len())
+			if err := uplinkLimit.wait(ctx, n); err != nil {
+				buf.ReleaseMulti(mb)
+				return err
 			}
-			return err
+			if err := link.Writer.WriteMultiBuffer(mb); err != nil {
+				return err
+			}
+			if traffic.addUplink(n) {
+				quotaExhausted()
+			}
+		}
+		session.ConsumeData(pendingCredit)
+		pendingCredit = 0
+		return nil
+	}
+	defer func() { buf.ReleaseMulti(pending) }()
+
+	// halfClosed is set once the client's FIN closed the upstream writer;
+	// the session then lives on until the downlink ends. downlinkDone is
+	// set once upstream ended and its FIN went out; the session then lives
+	// on until the client's FIN or the uplinkOnly timeout.
+	var halfClosed, downlinkDone bool
+	reader = bufio.NewReaderSize(reader, sessionReadBufferSize)
+	frames := make([]*encoding.Frame, 0, maxReadBatch)
+	for {
+		var readErr error
+		frames, readErr = session.ReadFramesInto(reader, frames, maxReadBatch)
+		if len(frames) > 0 {
+			timer.Update()
 		}
 
-		switch frame.Type {
-		case FrameTypeData:
-			if link == nil {
-				dest, payload, parseErr := parseDestination(frame.Payload)
-				if parseErr != nil {
-					return parseErr
+		for _, frame := range frames {
+			switch frame.Type {
+			case encoding.FrameTypeData:
+				if err := session.ReceivedData(frame); err != nil {
+					return &policyViolation{err: err}
 				}
-				link, err = dispatcher.Dispatch(ctx, dest)
-				if err != nil {
+				if halfClosed && len(frame.Payload) > 0 {
+					return &policyViolation{err: errors.New("data after close")}
+				}
+				pendingCredit += int(frame.Length)
+				if link == nil {
+					dest, payload, parseErr := reflex.ParseDestination(frame.Payload)
+					if parseErr != nil {
+						return &policyViolation{err: parseErr}
+					}
+					if dest.Network == net.Network_UDP && !policy.Has(encoding.FeatureUDP) {
+						return &policyViolation{err: errors.New("udp was not granted")}
+					}
+					if dest.Address == muxCoolAddress && !policy.Has(encoding.FeatureMux) {
+						return &policyViolation{err: errors.New("mux was not granted")}
+					}
+					link, err = dispatcher.Dispatch(ctx, dest)
+					if err != nil {
+						session.WriteFrame(conn, encoding.FrameTypeClose, encoding.ClosePayload(err, encoding.CloseErrorDispatch))
+						return err
+					}
+					go forwardUpstreamToClient(ctx, link, session, conn, h.watermarks, downlinkLimit, timer, levelPolicy.Timeouts.UplinkOnly, traffic, quotaExhausted, upstreamErr)
+					pending = appendPayload(pending, payload)
+					continue
+				}
+				pending = appendPayload(pending, frame.Payload)
+			case encoding.FrameTypePadding:
+				if err := session.HandleControlFrame(frame); err != nil {
+					return &policyViolation{err: err}
+				}
+			case encoding.FrameTypeTiming:
+				if err := flush(); err != nil {
 					return err
 				}
-				go forwardUpstreamToClient(link, session, conn, upstreamErr)
-				if err := writeUpstream(link, payload); err != nil {
+				if err := session.HandleControlFrame(frame); err != nil {
+					return &policyViolation{err: err}
+				}
+			case encoding.FrameTypeWindowUpdate:
+				if err := session.HandleWindowUpdate(frame); err != nil {
+					return &policyViolation{err: err}
+				}
+			case encoding.FrameTypePing:
+				if !policy.Has(encoding.FeatureHeartbeat) {
+					return &policyViolation{err: errors.New("heartbeat was not granted")}
+				}
+				if err := session.HandlePing(conn, frame); err != nil {
+					return &policyViolation{err: err}
+				}
+			case encoding.FrameTypeClose:
+				if err := flush(); err != nil {
 					return err
 				}
-				continue
-			}
-			if err := writeUpstream(link, frame.Payload); err != nil {
-				return err
-			}
-		case FrameTypePadding:
-			if err := session.HandleControlFrame(frame); err != nil {
-				return err
+				if encoding.IsReset(frame) {
+					if link != nil {
+						common.Interrupt(link.Writer)
+					}
+					return errors.New("reflex session reset by client")
+				}
+				if link == nil {
+					return nil
+				}
+				if !halfClosed {
+					common.Close(link.Writer)
+					halfClosed = true
+					if downlinkDone {
+						return nil
+					}
+					// Keep reading: window updates and keepalives still
+					// arrive while the downlink drains.
+					timer.SetTimeout(levelPolicy.Timeouts.DownlinkOnly)
+				}
+			default:
+				return &policyViolation{err: errors.New("unknown frame type")}
 			}
-			continue
-		case FrameTypeTiming:
-			if err := session.HandleControlFrame(frame); err != nil {
-				return err
+		}
+		if err := flush(); err != nil {
+			return err
+		}
+		if readErr != nil {
+			if readErr == io.EOF {
+				return nil
 			}
-			continue
-		case FrameTypeClose:
-			if link != nil {
-				common.Close(link.Writer)
+			if ctx.Err() != nil {
+				return errors.New("reflex session timed out or was cancelled").Base(readErr)
 			}
-			return nil
-		default:
-			return errors.New("unknown frame type")
+			return readErr
 		}
 
 		select {
 		case upErr := <-upstreamErr:
-			if upErr == io.EOF {
-				_ = session.WriteFrame(conn, FrameTypeClose, nil)
+			if upErr != io.EOF {
+				return upErr
+			}
+			if halfClosed {
 				return nil
 			}
-			return upErr
+			// Only the downlink is done; the client may still be sending.
+			downlinkDone = true
 		default:
 		}
 	}
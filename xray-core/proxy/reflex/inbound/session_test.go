@@ -1,11 +1,26 @@
 package inbound
 
 import (
+	"bufio"
 	"bytes"
-	"fmt"
+	"context"
+	"io"
 	"net"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/features/policy"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport"
+	"github.com/xtls/xray-core/transport/pipe"
 )
 
 func testKey() []byte {
@@ -16,149 +31,301 @@ func testKey() []byte {
 	return k
 }
 
-func TestSessionWriteReadFrame(t *testing.T) {
-	writerSession, err := NewSession(testKey())
+func TestHandleSessionPolicyViolation(t *testing.T) {
+	client, err := encoding.NewSession(testKey())
 	if err != nil {
 		t.Fatal(err)
 	}
-	readerSession, err := NewSession(testKey())
-	if err != nil {
+	var wire bytes.Buffer
+	if err := client.WriteFrame(&wire, 0x7F, []byte("bogus")); err != nil {
 		t.Fatal(err)
 	}
 
-	var wire bytes.Buffer
-	payload := []byte("hello reflex")
-	if err := writerSession.WriteFrame(&wire, FrameTypeData, payload); err != nil {
-		t.Fatal(err)
+	h := &Handler{}
+	conn := newFakeConn(wire.Bytes())
+	err = h.handleSession(context.Background(), bufio.NewReader(conn), conn, noOpDispatcher{}, testKey(), nil, sessionPolicy{})
+	if !isPolicyViolation(err) {
+		t.Fatalf("expected policy violation, got %v", err)
 	}
+}
 
-	frame, err := readerSession.ReadFrame(&wire)
+func TestHandleSessionRejectsUngrantedDestinations(t *testing.T) {
+	for _, dest := range []xnet.Destination{
+		xnet.UDPDestination(xnet.ParseAddress("8.8.8.8"), 53),
+		xnet.TCPDestination(muxCoolAddress, 9527),
+	} {
+		client, err := encoding.NewSession(testKey())
+		if err != nil {
+			t.Fatal(err)
+		}
+		header, err := reflex.EncodeDestination(dest)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var wire bytes.Buffer
+		if err := client.WriteFrame(&wire, encoding.FrameTypeData, header); err != nil {
+			t.Fatal(err)
+		}
+
+		h := &Handler{}
+		conn := newFakeConn(wire.Bytes())
+		err = h.handleSession(context.Background(), bufio.NewReader(conn), conn, noOpDispatcher{}, testKey(), nil, sessionPolicy{})
+		if !isPolicyViolation(err) {
+			t.Fatalf("%v: expected policy violation, got %v", dest, err)
+		}
+	}
+}
+
+func TestUserFallbackReceivesRemainingBytes(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	if frame.Type != FrameTypeData {
-		t.Fatalf("unexpected frame type: %d", frame.Type)
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		c, err := ln.Accept()
+		if err != nil {
+			return
+		}
+		defer c.Close()
+		data, _ := io.ReadAll(c)
+		received <- data
+	}()
+
+	user := &protocol.MemoryUser{Account: &reflex.MemoryAccount{
+		ID:       "u",
+		Fallback: &reflex.Fallback{Dest: uint32(ln.Addr().(*net.TCPAddr).Port)},
+	}}
+	fallback := userFallback(user)
+	if fallback == nil {
+		t.Fatal("expected user fallback")
+	}
+
+	h := &Handler{}
+	conn := newFakeConn(nil)
+	if err := h.fallbackTo(context.Background(), bufio.NewReader(strings.NewReader("leftover")), conn, fallback); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case data := <-received:
+		if string(data) != "leftover" {
+			t.Fatalf("fallback got %q", data)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("fallback did not receive data")
 	}
-	if !bytes.Equal(frame.Payload, payload) {
-		t.Fatalf("payload mismatch: got=%q want=%q", frame.Payload, payload)
+
+	if userFallback(&protocol.MemoryUser{Account: &reflex.MemoryAccount{ID: "u"}}) != nil {
+		t.Fatal("user without fallback should not get one")
 	}
 }
 
-func TestSessionReplayDetection(t *testing.T) {
-	writerSession, err := NewSession(testKey())
+func TestSessionContextCarriesUserAndSource(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
 	if err != nil {
 		t.Fatal(err)
 	}
-	readerSession, err := NewSession(testKey())
+	defer ln.Close()
+	conn, err := net.Dial("tcp", ln.Addr().String())
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer conn.Close()
 
-	var wire bytes.Buffer
-	if err := writerSession.WriteFrame(&wire, FrameTypeData, []byte("abc")); err != nil {
-		t.Fatal(err)
+	user := &protocol.MemoryUser{Email: "alice@example.com", Level: 1}
+	ctx := sessionContext(context.Background(), conn, user)
+	inbound := session.InboundFromContext(ctx)
+	if inbound.Name != "reflex" || inbound.User != user {
+		t.Fatalf("unexpected inbound: %+v", inbound)
 	}
-	frameBytes := append([]byte(nil), wire.Bytes()...)
-
-	if _, err := readerSession.ReadFrame(bytes.NewReader(frameBytes)); err != nil {
-		t.Fatalf("first read failed: %v", err)
+	if inbound.Source != xnet.DestinationFromAddr(conn.RemoteAddr()) {
+		t.Fatalf("source %v, want %v", inbound.Source, conn.RemoteAddr())
+	}
+	if content := session.ContentFromContext(ctx); content.Protocol != "reflex" {
+		t.Fatalf("unexpected protocol %q", content.Protocol)
 	}
 
-	_, err = readerSession.ReadFrame(bytes.NewReader(frameBytes))
-	if err == nil {
-		t.Fatal("expected replay detection error")
+	// A source the transport already recorded, e.g. from a proxy header,
+	// and a sniffed protocol are kept.
+	src := xnet.TCPDestination(xnet.ParseAddress("203.0.113.9"), 4433)
+	ctx = session.ContextWithInbound(context.Background(), &session.Inbound{Source: src, Tag: "reflex-in"})
+	ctx = session.ContextWithContent(ctx, &session.Content{Protocol: "tls"})
+	ctx = sessionContext(ctx, conn, user)
+	if inbound := session.InboundFromContext(ctx); inbound.Source != src || inbound.Tag != "reflex-in" {
+		t.Fatalf("inbound metadata overwritten: %+v", inbound)
 	}
-	if !strings.Contains(err.Error(), "replay") {
-		t.Fatalf("unexpected error: %v", err)
+	if content := session.ContentFromContext(ctx); content.Protocol != "tls" {
+		t.Fatalf("protocol overwritten: %q", content.Protocol)
 	}
 }
 
-func TestEmptyData(t *testing.T) {
-	s, err := NewSession(testKey())
+// ctxDispatcher echoes like echoDispatcher and hands over each dispatch's
+// context.
+type ctxDispatcher struct {
+	echoDispatcher
+	ctx chan context.Context
+}
+
+func (d ctxDispatcher) Dispatch(ctx context.Context, dest xnet.Destination) (*transport.Link, error) {
+	d.ctx <- ctx
+	return d.echoDispatcher.Dispatch(ctx, dest)
+}
+
+func TestDispatchSeesAuthenticatedUser(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom", Email: "alice@example.com", Level: 2}},
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	var wire bytes.Buffer
-	if err := s.WriteFrame(&wire, FrameTypeData, []byte{}); err != nil {
-		t.Fatalf("empty payload should not crash: %v", err)
-	}
-}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	dispatcher := ctxDispatcher{echoDispatcher: echoDispatcher{dest: make(chan xnet.Destination, 1)}, ctx: make(chan context.Context, 1)}
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
 
-func TestLargeData(t *testing.T) {
-	s, err := NewSession(testKey())
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
 	if err != nil {
 		t.Fatal(err)
 	}
-	var wire bytes.Buffer
-	large := make([]byte, 10*1024*1024)
-	if err := s.WriteFrame(&wire, FrameTypeData, large); err == nil {
-		t.Fatal("expected oversized frame error")
+	defer c.Close()
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ctx := <-dispatcher.ctx:
+		user := session.InboundFromContext(ctx).User
+		if user == nil || user.Email != "alice@example.com" || user.Level != 2 {
+			t.Fatalf("dispatched without the authenticated user: %+v", user)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never dispatched")
+	}
+}
+
+// levelPolicy is a policy.Manager serving fixed session policies by level.
+type levelPolicy struct {
+	levels map[uint32]policy.Session
+}
+
+func (levelPolicy) Type() interface{} { return policy.ManagerType() }
+func (levelPolicy) Start() error      { return nil }
+func (levelPolicy) Close() error      { return nil }
+
+func (m levelPolicy) ForLevel(level uint32) policy.Session {
+	if p, ok := m.levels[level]; ok {
+		return p
 	}
+	return policy.SessionDefault()
 }
 
-func TestClosedConnection(t *testing.T) {
-	s, err := NewSession(testKey())
+func (levelPolicy) ForSystem() policy.System { return policy.System{} }
+
+// silentDispatcher links every session to an upstream that accepts writes
+// but never answers nor closes.
+type silentDispatcher struct{}
+
+func (silentDispatcher) Type() interface{} { return (*routing.Dispatcher)(nil) }
+func (silentDispatcher) Start() error      { return nil }
+func (silentDispatcher) Close() error      { return nil }
+func (silentDispatcher) Dispatch(context.Context, xnet.Destination) (*transport.Link, error) {
+	r, _ := pipe.New(pipe.WithoutSizeLimit())
+	_, w := pipe.New(pipe.WithoutSizeLimit())
+	return &transport.Link{Reader: r, Writer: w}, nil
+}
+func (silentDispatcher) DispatchLink(context.Context, xnet.Destination, *transport.Link) error {
+	return io.EOF
+}
+
+func TestSessionAppliesLevelDownlinkOnlyTimeout(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Level: 1}},
+	})
 	if err != nil {
 		t.Fatal(err)
 	}
-	c1, c2 := net.Pipe()
-	_ = c2.Close()
-	if err := s.WriteFrame(c1, FrameTypeData, []byte("test")); err == nil {
-		t.Fatal("expected write error on closed connection")
-	}
-	_ = c1.Close()
-}
+	h := in.(*Handler)
+	levelOne := policy.SessionDefault()
+	levelOne.Timeouts.ConnectionIdle = time.Minute
+	levelOne.Timeouts.DownlinkOnly = 200 * time.Millisecond
+	h.policyManager = levelPolicy{levels: map[uint32]policy.Session{1: levelOne}}
 
-func BenchmarkEncryption(b *testing.B) {
-	s, err := NewSession(testKey())
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, silentDispatcher{})
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
-	data := make([]byte, 1024)
-	var wire bytes.Buffer
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		wire.Reset()
-		if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
-			b.Fatal(err)
-		}
+	defer c.Close()
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	// Once the client is done sending, a silent upstream gets the level's
+	// downlink-only timeout rather than its idle timeout.
+	if err := c.CopyFrom(buf.NewReader(bytes.NewReader(nil))); err != nil {
+		t.Fatal(err)
+	}
+	done := make(chan error, 1)
+	go func() { done <- c.CopyTo(make(collectWriter, 16)) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("half-closed session outlived the level's downlink-only timeout")
 	}
 }
 
-func BenchmarkEncryptionSizes(b *testing.B) {
-	sizes := []int{64, 256, 1024, 4096, 16384}
-	for _, size := range sizes {
-		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
-			s, err := NewSession(testKey())
-			if err != nil {
-				b.Fatal(err)
-			}
-			data := make([]byte, size)
-			var wire bytes.Buffer
-			b.ResetTimer()
-			for i := 0; i < b.N; i++ {
-				wire.Reset()
-				if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
-					b.Fatal(err)
-				}
-			}
-		})
+func TestSessionAppliesLevelPolicy(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom", Level: 1}},
+	})
+	if err != nil {
+		t.Fatal(err)
 	}
-}
+	h := in.(*Handler)
+	levelOne := policy.SessionDefault()
+	levelOne.Timeouts.ConnectionIdle = 200 * time.Millisecond
+	levelOne.Buffer.PerConnection = 4096
+	h.policyManager = levelPolicy{levels: map[uint32]policy.Session{1: levelOne}}
+
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	dispatcher := ctxDispatcher{echoDispatcher: echoDispatcher{dest: make(chan xnet.Destination, 1)}, ctx: make(chan context.Context, 1)}
+	go h.Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
 
-func BenchmarkMemoryAllocation(b *testing.B) {
-	s, err := NewSession(testKey())
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(context.Background(), clientConn, config)
 	if err != nil {
-		b.Fatal(err)
+		t.Fatal(err)
 	}
-	data := make([]byte, 1024)
-	var wire bytes.Buffer
-	b.ReportAllocs()
-	b.ResetTimer()
-	for i := 0; i < b.N; i++ {
-		wire.Reset()
-		if err := s.WriteFrame(&wire, FrameTypeData, data); err != nil {
-			b.Fatal(err)
+	defer c.Close()
+	if err := c.WriteDestination(xnet.TCPDestination(xnet.DomainAddress("example.com"), 443)); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case ctx := <-dispatcher.ctx:
+		if got := policy.BufferPolicyFromContext(ctx).PerConnection; got != 4096 {
+			t.Fatalf("dispatched with a per-connection buffer of %d, want 4096", got)
 		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("server never dispatched")
+	}
+
+	// With nothing sent either way, the session ends at the level's idle
+	// timeout.
+	done := make(chan error, 1)
+	go func() { done <- c.CopyTo(make(collectWriter, 16)) }()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("idle session outlived the level's idle timeout")
 	}
 }
@@ -0,0 +1,27 @@
+package inbound
+
+import (
+	"context"
+	"net"
+
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+// sourceIP returns the address conn comes from, as the inbound recorded it
+// on ctx or else as conn reports it, or nil if it is not known.
+func sourceIP(ctx context.Context, conn stat.Connection) net.IP {
+	if inbound := session.InboundFromContext(ctx); inbound != nil && inbound.Source.IsValid() {
+		if inbound.Source.Address.Family().IsIP() {
+			return inbound.Source.Address.IP()
+		}
+		return nil
+	}
+	switch addr := conn.RemoteAddr().(type) {
+	case *net.TCPAddr:
+		return addr.IP
+	case *net.UDPAddr:
+		return addr.IP
+	}
+	return nil
+}
@@ -0,0 +1,52 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestHandshakeChecksUserSource(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom", AllowedSources: []string{"192.0.2.0/24"}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+
+	connect := func(source string) (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		ctx := session.ContextWithInbound(context.Background(), &session.Inbound{
+			Source: xnet.TCPDestination(xnet.ParseAddress(source), 40000),
+		})
+		go h.Process(ctx, xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+
+	if _, err := connect("198.51.100.1"); err == nil {
+		t.Fatal("user accepted from outside its networks")
+	}
+	c, err := connect("192.0.2.10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	assertEcho(t, c, "from home")
+
+	if _, err := New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), DeniedSources: []string{"bogus"}}},
+	}); err == nil {
+		t.Fatal("invalid source list accepted")
+	}
+}
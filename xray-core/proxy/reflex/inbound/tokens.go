@@ -0,0 +1,117 @@
+package inbound
+
+import (
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/subtle"
+	"sync"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+// tokenIndex finds users by the index half of their userToken. Matching the
+// index costs one AES block per user, and only the users it matches, almost
+// always one, cost a full HMAC. The index ciphers of each bucket are derived
+// on first use; timestamps are checked before, so only the buckets around
+// now ever are.
+type tokenIndex struct {
+	mu      sync.Mutex
+	users   map[[16]byte]*protocol.MemoryUser
+	buckets map[int64][]bucketUser
+}
+
+// bucketUser is a user with its index cipher for one bucket.
+type bucketUser struct {
+	indexedUser
+	index cipher.Block
+}
+
+// add indexes user under id, replacing any user with the same id.
+func (x *tokenIndex) add(id [16]byte, user *protocol.MemoryUser) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(id)
+	if x.users == nil {
+		x.users = make(map[[16]byte]*protocol.MemoryUser)
+	}
+	x.users[id] = user
+	for bucket, users := range x.buckets {
+		x.buckets[bucket] = append(users, bucketUser{
+			indexedUser: indexedUser{id: id, user: user},
+			index:       encoding.UserIndexCipher(id, bucket),
+		})
+	}
+}
+
+// remove drops the user with id.
+func (x *tokenIndex) remove(id [16]byte) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	x.removeLocked(id)
+}
+
+func (x *tokenIndex) removeLocked(id [16]byte) {
+	if _, ok := x.users[id]; !ok {
+		return
+	}
+	delete(x.users, id)
+	for bucket, users := range x.buckets {
+		for i, u := range users {
+			if u.id == id {
+				// A copy, as lookups may still be reading the old slice.
+				x.buckets[bucket] = append(users[:i:i], users[i+1:]...)
+				break
+			}
+		}
+	}
+}
+
+// lookup returns the user whose userToken for binding hs carries, or nil.
+func (x *tokenIndex) lookup(hs *encoding.ClientHandshake, binding []byte) *protocol.MemoryUser {
+	x.mu.Lock()
+	users := x.bucket(hs.Timestamp / encoding.TokenBucketSeconds)
+	x.mu.Unlock()
+	// Every user's index is tried, so the time taken doesn't tell which one
+	// matched.
+	var candidates []indexedUser
+	for _, u := range users {
+		index := encoding.UserTokenIndex(u.index, hs.PublicKey)
+		if subtle.ConstantTimeCompare(index[:], hs.UserID[:8]) == 1 {
+			candidates = append(candidates, u.indexedUser)
+		}
+	}
+	for _, u := range candidates {
+		token := encoding.UserToken(u.id, hs.PublicKey, hs.Timestamp, binding)
+		if hmac.Equal(token[:], hs.UserID[:]) {
+			return u.user
+		}
+	}
+	return nil
+}
+
+// bucket returns the users of bucket with their index ciphers, deriving
+// them if needed and dropping buckets too far from it to be asked for
+// again. The caller holds mu.
+func (x *tokenIndex) bucket(bucket int64) []bucketUser {
+	if users, ok := x.buckets[bucket]; ok {
+		return users
+	}
+	if x.buckets == nil {
+		x.buckets = make(map[int64][]bucketUser)
+	}
+	for b := range x.buckets {
+		if b < bucket-2 || b > bucket+2 {
+			delete(x.buckets, b)
+		}
+	}
+	users := make([]bucketUser, 0, len(x.users))
+	for id, user := range x.users {
+		users = append(users, bucketUser{
+			indexedUser: indexedUser{id: id, user: user},
+			index:       encoding.UserIndexCipher(id, bucket),
+		})
+	}
+	x.buckets[bucket] = users
+	return users
+}
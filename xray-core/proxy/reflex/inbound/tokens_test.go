@@ -0,0 +1,49 @@
+package inbound
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestTokenIndexFindsUsersAcrossBuckets(t *testing.T) {
+	var x tokenIndex
+	ids := make([][16]byte, 1000)
+	for i := range ids {
+		ids[i][0], ids[i][1] = byte(i), byte(i>>8)
+		x.add(ids[i], &protocol.MemoryUser{Email: fmt.Sprint(i)})
+	}
+	handshake := func(id [16]byte, ts int64) *encoding.ClientHandshake {
+		hs := &encoding.ClientHandshake{Timestamp: ts, Versions: encoding.OfferedVersions(0)}
+		hs.PublicKey[0] = 7
+		hs.UserID = encoding.UserToken(id, hs.PublicKey, ts, []byte("binding"))
+		return hs
+	}
+
+	now := time.Now().Unix()
+	for _, ts := range []int64{now - encoding.TokenBucketSeconds, now, now + encoding.TokenBucketSeconds} {
+		if u := x.lookup(handshake(ids[421], ts), []byte("binding")); u == nil || u.Email != "421" {
+			t.Fatalf("token at %d matched %v", ts, u)
+		}
+	}
+	if u := x.lookup(handshake(ids[421], now), nil); u != nil {
+		t.Fatal("token matched without its binding")
+	}
+	if len(x.buckets) > 3 {
+		t.Fatalf("%d buckets built for timestamps within the skew", len(x.buckets))
+	}
+
+	// Changes reach the buckets already built.
+	x.remove(ids[421])
+	if u := x.lookup(handshake(ids[421], now), []byte("binding")); u != nil {
+		t.Fatal("removed user matched")
+	}
+	late := [16]byte{0xff, 0xff}
+	x.add(late, &protocol.MemoryUser{Email: "late"})
+	if u := x.lookup(handshake(late, now), []byte("binding")); u == nil || u.Email != "late" {
+		t.Fatalf("user added after indexing matched %v", u)
+	}
+}
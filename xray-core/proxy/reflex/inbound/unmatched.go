@@ -0,0 +1,95 @@
+package inbound
+
+import (
+	"context"
+	"crypto/rand"
+	"net"
+	"sync/atomic"
+	"time"
+
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+// Ways to end a connection that is not Reflex and has no fallback to go to,
+// as set by unmatched. Scanners tell them apart: a graceful close looks like
+// a server that dislikes the request, a reset like a firewall or a crashed
+// process, and a tarpit like a slow server while keeping the scanner busy.
+const (
+	UnmatchedClose  = "close"
+	UnmatchedReset  = "reset"
+	UnmatchedTarpit = "tarpit"
+)
+
+const (
+	// tarpitDrip is how often a tarpitted connection gets one random byte.
+	tarpitDrip = 10 * time.Second
+	// tarpitLimit is how long a connection is tarpitted at most.
+	tarpitLimit = 5 * time.Minute
+	// maxTarpits bounds the connections tarpitted at once. Beyond it they
+	// are closed, so a scanner can't pin unbounded goroutines.
+	maxTarpits = 1024
+)
+
+// tarpits counts the connections being tarpitted across inbounds.
+var tarpits atomic.Int32
+
+// KnownUnmatched reports whether action is a valid unmatched setting; empty
+// means UnmatchedClose.
+func KnownUnmatched(action string) bool {
+	switch action {
+	case "", UnmatchedClose, UnmatchedReset, UnmatchedTarpit:
+		return true
+	}
+	return false
+}
+
+// refuseUnmatched ends conn as the inbound's unmatched setting says. The
+// caller closes conn afterwards, which is the graceful close.
+func (h *Handler) refuseUnmatched(ctx context.Context, conn net.Conn) {
+	switch h.unmatched {
+	case UnmatchedReset:
+		resetConn(conn)
+	case UnmatchedTarpit:
+		if tarpits.Add(1) > maxTarpits {
+			tarpits.Add(-1)
+			return
+		}
+		defer tarpits.Add(-1)
+		tarpit(ctx, conn, tarpitDrip)
+	}
+}
+
+// resetConn makes closing conn send a RST instead of a FIN, where the
+// underlying TCP connection can be reached.
+func resetConn(conn net.Conn) {
+	conn = stat.TryUnwrapStatsConn(conn)
+	if c, ok := conn.(interface{ NetConn() net.Conn }); ok {
+		conn = c.NetConn()
+	}
+	if c, ok := conn.(interface{ SetLinger(int) error }); ok {
+		c.SetLinger(0)
+	}
+	conn.Close()
+}
+
+// tarpit holds conn open, writing a random byte every drip, until the peer
+// leaves, ctx is done or tarpitLimit passes.
+func tarpit(ctx context.Context, conn net.Conn, drip time.Duration) {
+	ctx, cancel := context.WithTimeout(ctx, tarpitLimit)
+	defer cancel()
+	ticker := time.NewTicker(drip)
+	defer ticker.Stop()
+	var b [1]byte
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		rand.Read(b[:])
+		conn.SetWriteDeadline(time.Now().Add(drip))
+		if _, err := conn.Write(b[:]); err != nil {
+			return
+		}
+	}
+}
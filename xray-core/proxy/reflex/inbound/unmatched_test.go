@@ -0,0 +1,66 @@
+package inbound
+
+import (
+	"context"
+	"errors"
+	"net"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// acceptPair returns both ends of a loopback TCP connection.
+func acceptPair(t *testing.T) (server, client net.Conn) {
+	t.Helper()
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	client, err = net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { client.Close() })
+	server, err = l.Accept()
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { server.Close() })
+	return server, client
+}
+
+func TestResetConnSendsRST(t *testing.T) {
+	server, client := acceptPair(t)
+	resetConn(server)
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); !errors.Is(err, syscall.ECONNRESET) {
+		t.Fatalf("read after reset returned %v", err)
+	}
+}
+
+func TestTarpitDripsUntilDone(t *testing.T) {
+	server, client := acceptPair(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		tarpit(ctx, server, 10*time.Millisecond)
+		close(done)
+	}()
+	client.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err := client.Read(make([]byte, 1)); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("tarpit outlived its context")
+	}
+
+	if _, err := New(context.Background(), &reflex.InboundConfig{Unmatched: "drop"}); err == nil {
+		t.Fatal("unknown unmatched action accepted")
+	}
+}
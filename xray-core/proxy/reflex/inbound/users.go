@@ -0,0 +1,158 @@
+package inbound
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+// indexedUser is a user with its UUID parsed once, for token matching.
+type indexedUser struct {
+	id   [16]byte
+	user *protocol.MemoryUser
+}
+
+// userStore is the state of an inbound's users: who they are, the nonces
+// their handshakes used and their traffic totals. Inbounds naming the same
+// reflex.UserStore share one.
+type userStore struct {
+	// clients is replaced rather than modified in place, so a slice read
+	// under mu stays valid after it is released.
+	clients     []indexedUser
+	clientsByID map[[16]byte]*protocol.MemoryUser
+	usersMu     sync.RWMutex
+	// tokens finds the users of negotiating clients.
+	tokens tokenIndex
+
+	nonces *nonceCache
+
+	traffic *trafficLedger
+	// shared is set on stores of the UserStores feature, which closes them
+	// in place of the inbounds.
+	shared bool
+}
+
+// newUserStore indexes clients and starts their traffic accounting and the
+// expiry of their nonces, keeping at most maxNonces.
+func newUserStore(clients []*reflex.User, accounting *reflex.TrafficAccounting, maxNonces uint32) (*userStore, error) {
+	s := &userStore{}
+	for _, c := range clients {
+		email := c.GetEmail()
+		if email == "" {
+			email = c.GetId()
+		}
+		account, err := c.Account().AsAccount()
+		if err != nil {
+			return nil, errors.New("reflex user ", email).Base(err)
+		}
+		if c.GetQuota() > 0 && accounting.GetFile() == "" {
+			return nil, errors.New("reflex user ", email, ": quota needs traffic accounting")
+		}
+		user := &protocol.MemoryUser{Email: email, Level: c.GetLevel(), Account: account}
+		if err := s.addUser(user); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if s.traffic, err = newTrafficLedger(accounting); err != nil {
+		return nil, err
+	}
+	s.nonces = newNonceCache(defaultNonceLifetime, int(maxNonces))
+	return s, nil
+}
+
+// release closes an inbound's own store. Shared stores are left to the
+// UserStores feature.
+func (s *userStore) release() error {
+	if s.shared {
+		return nil
+	}
+	return s.close()
+}
+
+// close stops the nonce expiry and saves the traffic totals.
+func (s *userStore) close() error {
+	s.nonces.Close()
+	return s.traffic.Close()
+}
+
+// addUser indexes user by the UUID of its account.
+func (s *userStore) addUser(user *protocol.MemoryUser) error {
+	account, ok := user.Account.(*reflex.MemoryAccount)
+	if !ok {
+		return errors.New("reflex user ", user.Email, " has no reflex account")
+	}
+	uid, err := uuid.ParseString(account.ID)
+	if err != nil {
+		return errors.New("invalid reflex user id ", account.ID).Base(err)
+	}
+	var id [16]byte
+	copy(id[:], uid.Bytes())
+
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	if s.clientsByID == nil {
+		s.clientsByID = make(map[[16]byte]*protocol.MemoryUser)
+	}
+	if _, dup := s.clientsByID[id]; dup {
+		return errors.New("duplicate reflex user id ", account.ID)
+	}
+	s.clientsByID[id] = user
+	s.tokens.add(id, user)
+	clients := make([]indexedUser, len(s.clients), len(s.clients)+1)
+	copy(clients, s.clients)
+	s.clients = append(clients, indexedUser{id: id, user: user})
+	return nil
+}
+
+// removeUser drops the user with email from the index.
+func (s *userStore) removeUser(email string) error {
+	s.usersMu.Lock()
+	defer s.usersMu.Unlock()
+	for i, u := range s.clients {
+		if !strings.EqualFold(u.user.Email, email) {
+			continue
+		}
+		delete(s.clientsByID, u.id)
+		s.tokens.remove(u.id)
+		clients := make([]indexedUser, 0, len(s.clients)-1)
+		clients = append(clients, s.clients[:i]...)
+		s.clients = append(clients, s.clients[i+1:]...)
+		return nil
+	}
+	return errors.New("reflex user ", email, " not found")
+}
+
+// users returns the indexed users. The slice must not be modified.
+func (s *userStore) users() []indexedUser {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+	return s.clients
+}
+
+// userByEmail returns the user with email, compared case-insensitively, or
+// nil.
+func (s *userStore) userByEmail(email string) *protocol.MemoryUser {
+	for _, u := range s.users() {
+		if strings.EqualFold(u.user.Email, email) {
+			return u.user
+		}
+	}
+	return nil
+}
+
+// userByID returns the user whose UUID is id, or nil.
+func (s *userStore) userByID(id [16]byte) *protocol.MemoryUser {
+	s.usersMu.RLock()
+	defer s.usersMu.RUnlock()
+	return s.clientsByID[id]
+}
+
+func (s *userStore) checkAndStoreNonce(nonce [16]byte) bool {
+	return s.nonces.add(nonce, time.Now())
+}
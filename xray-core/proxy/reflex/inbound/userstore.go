@@ -0,0 +1,82 @@
+package inbound
+
+import (
+	"context"
+
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/proxy/reflex"
+)
+
+func init() {
+	common.Must(common.RegisterConfig((*reflex.UserStoreConfig)(nil), func(ctx context.Context, config interface{}) (interface{}, error) {
+		return NewUserStores(config.(*reflex.UserStoreConfig))
+	}))
+}
+
+// UserStores is the feature holding the named user stores of a
+// reflex.UserStoreConfig, which inbounds pick by their user_store.
+type UserStores struct {
+	stores map[string]*userStore
+}
+
+// UserStoresType returns the feature type of UserStores.
+func UserStoresType() interface{} {
+	return (*UserStores)(nil)
+}
+
+// NewUserStores indexes the users of every store in config and starts their
+// traffic accounting.
+func NewUserStores(config *reflex.UserStoreConfig) (*UserStores, error) {
+	s := &UserStores{stores: make(map[string]*userStore, len(config.GetStores()))}
+	for _, c := range config.GetStores() {
+		if c.GetName() == "" {
+			s.Close()
+			return nil, errors.New("reflex user store has no name")
+		}
+		if _, dup := s.stores[c.GetName()]; dup {
+			s.Close()
+			return nil, errors.New("duplicate reflex user store ", c.GetName())
+		}
+		store, err := newUserStore(c.GetClients(), c.GetTrafficAccounting(), c.GetMaxNonces())
+		if err != nil {
+			s.Close()
+			return nil, errors.New("reflex user store ", c.GetName()).Base(err)
+		}
+		store.shared = true
+		s.stores[c.GetName()] = store
+	}
+	return s, nil
+}
+
+// Type implements common.HasType.
+func (*UserStores) Type() interface{} {
+	return UserStoresType()
+}
+
+// Start implements common.Runnable.
+func (*UserStores) Start() error {
+	return nil
+}
+
+// Close implements common.Closable. It saves the traffic totals of every
+// store and stops the expiry of their nonces.
+func (s *UserStores) Close() error {
+	var errs []error
+	for _, store := range s.stores {
+		if err := store.close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Combine(errs...)
+}
+
+// get returns the store called name.
+func (s *UserStores) get(name string) (*userStore, error) {
+	if s != nil {
+		if store := s.stores[name]; store != nil {
+			return store, nil
+		}
+	}
+	return nil, errors.New("unknown reflex user store ", name)
+}
@@ -0,0 +1,157 @@
+package inbound
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestInboundsShareUserStore(t *testing.T) {
+	id := uuid.New()
+	instance, err := core.New(&core.Config{App: []*serial.TypedMessage{
+		serial.ToTypedMessage(&reflex.UserStoreConfig{Stores: []*reflex.UserStore{{
+			Name:    "shared",
+			Clients: []*reflex.User{{Id: id.String(), Email: "shared@example.com"}},
+		}}}),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+	ctx := context.WithValue(context.Background(), core.XrayKey(1), instance)
+
+	handlers := make([]*Handler, 2)
+	for i := range handlers {
+		in, err := New(ctx, &reflex.InboundConfig{UserStore: "shared"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		handlers[i] = in.(*Handler)
+		defer handlers[i].Close()
+	}
+	if handlers[0].userStore != handlers[1].userStore {
+		t.Fatal("inbounds naming one store got different ones")
+	}
+
+	for _, h := range handlers {
+		serverConn, clientConn := net.Pipe()
+		defer clientConn.Close()
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		c, err := encoding.NewClientConn(context.Background(), clientConn, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assertEcho(t, c, "shared")
+		c.Close()
+	}
+
+	// A nonce one inbound accepted is a replay at the other.
+	nonce := [16]byte{9}
+	if !handlers[0].checkAndStoreNonce(nonce) || handlers[1].checkAndStoreNonce(nonce) {
+		t.Fatal("nonce not shared across the store's inbounds")
+	}
+}
+
+func TestInboundUserStoreErrors(t *testing.T) {
+	instance, err := core.New(&core.Config{App: []*serial.TypedMessage{
+		serial.ToTypedMessage(&reflex.UserStoreConfig{Stores: []*reflex.UserStore{{Name: "shared"}}}),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer instance.Close()
+	ctx := context.WithValue(context.Background(), core.XrayKey(1), instance)
+
+	if _, err := New(ctx, &reflex.InboundConfig{UserStore: "missing"}); err == nil {
+		t.Fatal("unknown store accepted")
+	}
+	id := uuid.New()
+	if _, err := New(ctx, &reflex.InboundConfig{UserStore: "shared", Clients: []*reflex.User{{Id: id.String()}}}); err == nil {
+		t.Fatal("clients accepted alongside a store")
+	}
+	if _, err := NewUserStores(&reflex.UserStoreConfig{Stores: []*reflex.UserStore{{Name: "a"}, {Name: "a"}}}); err == nil {
+		t.Fatal("duplicate store names accepted")
+	}
+}
+
+func TestHandlerManagesUsers(t *testing.T) {
+	in, err := New(context.Background(), &reflex.InboundConfig{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := in.(*Handler)
+	defer h.Close()
+
+	id := uuid.New()
+	user, err := (&protocol.User{
+		Level:   1,
+		Account: serial.ToTypedMessage(&reflex.Account{Id: id.String(), Policy: "zoom"}),
+	}).ToMemoryUser()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddUser(context.Background(), user); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.AddUser(context.Background(), user); err == nil {
+		t.Fatal("user added twice")
+	}
+	if got := h.GetUser(context.Background(), id.String()); got != user || h.GetUsersCount(context.Background()) != 1 {
+		t.Fatal("added user not listed by its id")
+	}
+	if account := user.Account.ToProto().(*reflex.Account); account.GetPolicy() != "zoom" {
+		t.Fatalf("account round-tripped as %v", account)
+	}
+
+	connect := func() (*encoding.ClientConn, error) {
+		serverConn, clientConn := net.Pipe()
+		t.Cleanup(func() { clientConn.Close() })
+		go h.Process(context.Background(), xnet.Network_TCP, serverConn, echoDispatcher{dest: make(chan xnet.Destination, 1)})
+		config := &encoding.ClientConfig{}
+		copy(config.UserID[:], id.Bytes())
+		return encoding.NewClientConn(context.Background(), clientConn, config)
+	}
+	c, err := connect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertEcho(t, c, "added")
+	c.Close()
+
+	if err := h.RemoveUser(context.Background(), id.String()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := connect(); err == nil {
+		t.Fatal("removed user accepted")
+	}
+	if err := h.RemoveUser(context.Background(), id.String()); err == nil {
+		t.Fatal("removed user removed again")
+	}
+	if _, err := (&reflex.Account{Id: "this-id-is-too-long-to-be-hashed-into-a-uuid"}).AsAccount(); err == nil {
+		t.Fatal("invalid id accepted")
+	}
+
+	// Accounts this inbound can't honour are refused rather than added.
+	for _, account := range []*reflex.Account{
+		{Id: id.String(), Quota: 1000},
+		{Id: id.String(), Fallback: &reflex.Fallback{Geo: []*reflex.GeoFallback{{Dest: 8080}}}},
+	} {
+		user, err := (&protocol.User{Account: serial.ToTypedMessage(account)}).ToMemoryUser()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := h.AddUser(context.Background(), user); err == nil {
+			t.Fatalf("account %v added", account)
+		}
+	}
+}
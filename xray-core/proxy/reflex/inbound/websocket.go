@@ -0,0 +1,88 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"net/http"
+
+	"github.com/gorilla/websocket"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+// isWebSocketRequest reports whether the buffered request line is a GET for
+// the configured WebSocket path. Nothing is consumed, so other requests can
+// still go to the fallback intact.
+func (h *Handler) isWebSocketRequest(reader *bufio.Reader) bool {
+	if h.websocketPath == "" {
+		return false
+	}
+	if method, err := reader.Peek(4); err != nil || string(method) != "GET " {
+		return false
+	}
+	prefix := "GET " + h.websocketPath
+	peeked, err := reader.Peek(len(prefix) + 1)
+	if err != nil || string(peeked[:len(prefix)]) != prefix {
+		return false
+	}
+	next := peeked[len(prefix)]
+	return next == ' ' || next == '?'
+}
+
+// hijackWriter lets the WebSocket upgrader take over a connection that was
+// read without net/http.
+type hijackWriter struct {
+	conn   stat.Connection
+	reader *bufio.Reader
+	header http.Header
+}
+
+func (w *hijackWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *hijackWriter) Write(b []byte) (int, error) {
+	return len(b), nil
+}
+
+func (w *hijackWriter) WriteHeader(int) {}
+
+func (w *hijackWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.conn, bufio.NewReadWriter(w.reader, bufio.NewWriter(w.conn)), nil
+}
+
+// handleWebSocket completes the upgrade and runs the session inside it. The
+// handshake arrives in the first binary message, with the magic prefix.
+func (h *Handler) handleWebSocket(ctx context.Context, reader *bufio.Reader, conn stat.Connection, dispatcher routing.Dispatcher) error {
+	req, err := http.ReadRequest(reader)
+	if err != nil {
+		return err
+	}
+	upgrader := &websocket.Upgrader{
+		// Behind a CDN the origin is whatever page the operator fronts.
+		CheckOrigin: func(*http.Request) bool { return true },
+		Error: func(_ http.ResponseWriter, _ *http.Request, status int, _ error) {
+			_ = h.writeErrorPage(ctx, conn, status)
+		},
+	}
+	ws, err := upgrader.Upgrade(&hijackWriter{conn: conn, reader: reader, header: make(http.Header)}, req, nil)
+	if err != nil {
+		return errors.New("reflex websocket upgrade failed").Base(err)
+	}
+	wc := encoding.NewWebSocketConn(ws)
+	defer wc.Close()
+
+	wsReader := bufio.NewReader(wc)
+	peeked, err := peekForDetection(wsReader, 4)
+	if err != nil {
+		return err
+	}
+	if !h.isReflexMagic(peeked) {
+		return errors.New("reflex websocket session did not start with a handshake")
+	}
+	return h.handleReflexMagic(ctx, wsReader, wc, dispatcher)
+}
@@ -0,0 +1,67 @@
+package inbound
+
+import (
+	"bufio"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+func TestIsWebSocketRequest(t *testing.T) {
+	h := &Handler{websocketPath: "/ws"}
+	for request, want := range map[string]bool{
+		"GET /ws HTTP/1.1\r\n":         true,
+		"GET /ws?ed=2048 HTTP/1.1\r\n": true,
+		"GET /wss HTTP/1.1\r\n":        false,
+		"GET / HTTP/1.1\r\n":           false,
+		"POST /ws HTTP/1.1\r\n":        false,
+	} {
+		reader := bufio.NewReader(strings.NewReader(request))
+		if got := h.isWebSocketRequest(reader); got != want {
+			t.Fatalf("%q detected as %v", request, got)
+		}
+		if reader.Buffered() != len(request) {
+			t.Fatalf("%q: detection consumed input", request)
+		}
+	}
+	if (&Handler{}).isWebSocketRequest(bufio.NewReader(strings.NewReader("GET /ws HTTP/1.1\r\n"))) {
+		t.Fatal("websocket detected without a configured path")
+	}
+}
+
+func TestWebSocketSessionEndToEnd(t *testing.T) {
+	id := uuid.New()
+	in, err := New(context.Background(), &reflex.InboundConfig{
+		Clients:       []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+		WebsocketPath: "/reflex",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	serverConn, clientConn := net.Pipe()
+	defer clientConn.Close()
+	dispatcher := echoDispatcher{dest: make(chan xnet.Destination, 1)}
+	go in.(*Handler).Process(context.Background(), xnet.Network_TCP, serverConn, dispatcher)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ws, err := encoding.DialWebSocket(ctx, clientConn, "cdn.example.com", "/reflex", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	config := &encoding.ClientConfig{}
+	copy(config.UserID[:], id.Bytes())
+	c, err := encoding.NewClientConn(ctx, ws, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	assertEcho(t, c, "over websocket")
+}
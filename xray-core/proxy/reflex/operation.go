@@ -0,0 +1,57 @@
+package reflex
+
+import (
+	"context"
+
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/features/inbound"
+	"github.com/xtls/xray-core/proxy"
+)
+
+// PolicyUpdater is implemented by inbounds that can switch the profiles of
+// their live sessions.
+type PolicyUpdater interface {
+	// UpdatePolicy applies new profiles to the sessions of email, or to all
+	// sessions if email is empty, and returns how many were updated.
+	UpdatePolicy(ctx context.Context, email, uplink, downlink string) (int, error)
+}
+
+// ApplyInbound implements the handler API's InboundOperation.
+func (op *UpdatePolicyOperation) ApplyInbound(ctx context.Context, handler inbound.Handler) error {
+	gi, ok := handler.(proxy.GetInbound)
+	if !ok {
+		return errors.New("can't get inbound proxy from handler")
+	}
+	updater, ok := gi.GetInbound().(PolicyUpdater)
+	if !ok {
+		return errors.New("inbound is not a reflex inbound")
+	}
+	if op.GetUplinkPolicy() == "" && op.GetDownlinkPolicy() == "" {
+		return errors.New("no policy to update")
+	}
+	n, err := updater.UpdatePolicy(ctx, op.GetEmail(), op.GetUplinkPolicy(), op.GetDownlinkPolicy())
+	if err != nil {
+		return err
+	}
+	errors.LogInfo(ctx, "reflex policy updated on ", n, " live sessions")
+	return nil
+}
+
+// Reloader is implemented by inbounds whose fallback, policy rate limits and
+// profiles can be swapped while they run.
+type Reloader interface {
+	Reload(ctx context.Context, fallback *Fallback, policyRateLimits map[string]*RateLimit, reloadProfiles bool) error
+}
+
+// ApplyInbound implements the handler API's InboundOperation.
+func (op *ReloadOperation) ApplyInbound(ctx context.Context, handler inbound.Handler) error {
+	gi, ok := handler.(proxy.GetInbound)
+	if !ok {
+		return errors.New("can't get inbound proxy from handler")
+	}
+	reloader, ok := gi.GetInbound().(Reloader)
+	if !ok {
+		return errors.New("inbound is not a reflex inbound")
+	}
+	return reloader.Reload(ctx, op.GetFallback(), op.GetPolicyRateLimits(), op.GetReloadProfiles())
+}
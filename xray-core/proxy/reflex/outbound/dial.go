@@ -0,0 +1,163 @@
+package outbound
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/xtls/xray-core/app/proxyman"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+// connectionAttemptDelay is RFC 8305's recommended delay between racing
+// connection attempts.
+const connectionAttemptDelay = 250 * time.Millisecond
+
+// lookupServerIP resolves the server's domain through Xray's DNS, both
+// families.
+func lookupServerIP(domain string) ([]net.IP, error) {
+	return internet.LookupForIP(domain, internet.DomainStrategy_USE_IP, nil)
+}
+
+// interleaveFamilies orders addresses per RFC 8305 section 4: IPv6 first,
+// then alternating families.
+func interleaveFamilies(ips []net.IP) []net.IP {
+	var v4, v6 []net.IP
+	for _, ip := range ips {
+		if ip.To4() != nil {
+			v4 = append(v4, ip)
+		} else {
+			v6 = append(v6, ip)
+		}
+	}
+	out := make([]net.IP, 0, len(ips))
+	for len(v4) > 0 || len(v6) > 0 {
+		if len(v6) > 0 {
+			out = append(out, v6[0])
+			v6 = v6[1:]
+		}
+		if len(v4) > 0 {
+			out = append(out, v4[0])
+			v4 = v4[1:]
+		}
+	}
+	return out
+}
+
+// senderConfig returns the sender settings of d if it is proxyman's outbound
+// handler, otherwise nil.
+func senderConfig(d internet.Dialer) *proxyman.SenderConfig {
+	handler, ok := d.(interface{ SenderSettings() *serial.TypedMessage })
+	if !ok || handler.SenderSettings() == nil {
+		return nil
+	}
+	instance, err := handler.SenderSettings().GetInstance()
+	if err != nil {
+		return nil
+	}
+	sender, _ := instance.(*proxyman.SenderConfig)
+	return sender
+}
+
+// chained reports whether d relays through another outbound, by
+// proxySettings.tag or sockopt.dialerProxy. The server's name is then left
+// for that outbound to resolve.
+func chained(d internet.Dialer) bool {
+	sender := senderConfig(d)
+	return sender.GetProxySettings().GetTag() != "" || sender.GetStreamSettings().GetSocketSettings().GetDialerProxy() != ""
+}
+
+// streamLayers returns the transport streamSettings runs d's connections
+// over, "" for raw TCP, and their security, such as "tls" or "reality".
+func streamLayers(d internet.Dialer) (transport, security string) {
+	stream := senderConfig(d).GetStreamSettings()
+	if p := stream.GetEffectiveProtocol(); p != "tcp" {
+		transport = p
+	}
+	if t := stream.GetSecurityType(); t != "" {
+		// Security types are message names such as
+		// xray.transport.internet.tls.Config.
+		parts := strings.Split(t, ".")
+		security = parts[max(len(parts)-2, 0)]
+	}
+	return transport, security
+}
+
+type dialResult struct {
+	conn stat.Connection
+	err  error
+}
+
+// raceDial dials the resolved addresses of dest through d per RFC 8305:
+// a new attempt starts every connectionAttemptDelay, or as soon as one
+// fails, and the first to connect wins. Going through d keeps the stream
+// settings, so TLS needs an explicit server name.
+func raceDial(ctx context.Context, d internet.Dialer, dest net.Destination, lookup func(string) ([]net.IP, error)) (stat.Connection, error) {
+	if !dest.Address.Family().IsDomain() {
+		return d.Dial(ctx, dest)
+	}
+	ips, err := lookup(dest.Address.Domain())
+	if err != nil {
+		return nil, errors.New("failed to resolve reflex server ", dest.Address).Base(err)
+	}
+	ips = interleaveFamilies(ips)
+	if len(ips) == 1 {
+		return d.Dial(ctx, net.Destination{Network: dest.Network, Address: net.IPAddress(ips[0]), Port: dest.Port})
+	}
+
+	raceCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	results := make(chan dialResult, len(ips))
+	start := func(ip net.IP) {
+		target := net.Destination{Network: dest.Network, Address: net.IPAddress(ip), Port: dest.Port}
+		go func() {
+			conn, err := d.Dial(raceCtx, target)
+			results <- dialResult{conn: conn, err: err}
+		}()
+	}
+
+	next, pending := 0, 0
+	timer := time.NewTimer(0)
+	defer timer.Stop()
+	var lastErr error
+	for {
+		select {
+		case <-timer.C:
+			if next < len(ips) {
+				start(ips[next])
+				next++
+				pending++
+				timer.Reset(connectionAttemptDelay)
+			}
+		case r := <-results:
+			pending--
+			if r.err == nil {
+				cancel()
+				go closeLate(results, pending)
+				return r.conn, nil
+			}
+			lastErr = r.err
+			if next < len(ips) {
+				timer.Reset(0)
+			} else if pending == 0 {
+				return nil, errors.New("failed to dial reflex server ", dest.Address).Base(lastErr)
+			}
+		case <-ctx.Done():
+			go closeLate(results, pending)
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// closeLate closes connections from attempts that finish after the race.
+func closeLate(results <-chan dialResult, pending int) {
+	for ; pending > 0; pending-- {
+		if late := <-results; late.conn != nil {
+			late.conn.Close()
+		}
+	}
+}
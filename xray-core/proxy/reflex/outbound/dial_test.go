@@ -0,0 +1,252 @@
+package outbound
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/app/proxyman"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/serial"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/stat"
+)
+
+func TestInterleaveFamilies(t *testing.T) {
+	ips := []net.IP{
+		net.ParseIP("192.0.2.1"), net.ParseIP("192.0.2.2"),
+		net.ParseIP("2001:db8::1"), net.ParseIP("192.0.2.3"), net.ParseIP("2001:db8::2"),
+	}
+	want := []string{"2001:db8::1", "192.0.2.1", "2001:db8::2", "192.0.2.2", "192.0.2.3"}
+	got := interleaveFamilies(ips)
+	for i := range want {
+		if got[i].String() != want[i] {
+			t.Fatalf("got %v, want %v", got, want)
+		}
+	}
+}
+
+// scriptedDialer answers each IP as scripted: connect, fail, or hang until
+// the race is cancelled.
+type scriptedDialer struct {
+	mu     sync.Mutex
+	script map[string]string
+	dialed []string
+}
+
+func (d *scriptedDialer) Dial(ctx context.Context, dest xnet.Destination) (stat.Connection, error) {
+	ip := dest.Address.IP().String()
+	d.mu.Lock()
+	d.dialed = append(d.dialed, ip)
+	d.mu.Unlock()
+	switch d.script[ip] {
+	case "connect":
+		c, _ := net.Pipe()
+		return c, nil
+	case "fail":
+		return nil, errors.New("unreachable")
+	}
+	<-ctx.Done()
+	return nil, ctx.Err()
+}
+
+func (*scriptedDialer) DestIpAddress() net.IP { return nil }
+
+func (*scriptedDialer) SetOutboundGateway(context.Context, *session.Outbound) {}
+
+func TestRaceDial(t *testing.T) {
+	dest := xnet.TCPDestination(xnet.DomainAddress("reflex.example.com"), 443)
+	lookup := func(string) ([]net.IP, error) {
+		return []net.IP{net.ParseIP("192.0.2.1"), net.ParseIP("2001:db8::1")}, nil
+	}
+
+	// A black-holed IPv6 path falls back to IPv4 after the attempt delay.
+	d := &scriptedDialer{script: map[string]string{"192.0.2.1": "connect"}}
+	start := time.Now()
+	conn, err := raceDial(context.Background(), d, dest, lookup)
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed < connectionAttemptDelay {
+		t.Fatalf("IPv4 attempt started after %v, before the attempt delay", elapsed)
+	}
+	if d.dialed[0] != "2001:db8::1" {
+		t.Fatalf("IPv6 was not tried first: %v", d.dialed)
+	}
+
+	// A failed attempt starts the next one at once.
+	d = &scriptedDialer{script: map[string]string{"2001:db8::1": "fail", "192.0.2.1": "connect"}}
+	start = time.Now()
+	if conn, err = raceDial(context.Background(), d, dest, lookup); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+	if elapsed := time.Since(start); elapsed >= connectionAttemptDelay {
+		t.Fatalf("fallback waited %v after a failure", elapsed)
+	}
+
+	d = &scriptedDialer{script: map[string]string{"2001:db8::1": "fail", "192.0.2.1": "fail"}}
+	if _, err := raceDial(context.Background(), d, dest, lookup); err == nil {
+		t.Fatal("expected the race to fail when every address fails")
+	}
+
+	// IP addresses are dialed directly.
+	d = &scriptedDialer{script: map[string]string{"198.51.100.7": "connect"}}
+	if conn, err = raceDial(context.Background(), d, xnet.TCPDestination(xnet.ParseAddress("198.51.100.7"), 443), nil); err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
+
+// senderDialer reports its sender settings as proxyman's outbound handler
+// does, and records what it is asked to dial.
+type senderDialer struct {
+	sender *proxyman.SenderConfig
+	dialed chan xnet.Destination
+}
+
+func (d senderDialer) Dial(_ context.Context, dest xnet.Destination) (stat.Connection, error) {
+	d.dialed <- dest
+	return nil, errors.New("unreachable")
+}
+
+func (senderDialer) DestIpAddress() net.IP { return nil }
+
+func (senderDialer) SetOutboundGateway(context.Context, *session.Outbound) {}
+
+func (d senderDialer) SenderSettings() *serial.TypedMessage {
+	return serial.ToTypedMessage(d.sender)
+}
+
+func TestChainedDialSkipsHappyEyeballs(t *testing.T) {
+	for _, tc := range []struct {
+		sender  *proxyman.SenderConfig
+		chained bool
+	}{
+		{&proxyman.SenderConfig{}, false},
+		{&proxyman.SenderConfig{ProxySettings: &internet.ProxyConfig{Tag: "warp"}}, true},
+		{&proxyman.SenderConfig{StreamSettings: &internet.StreamConfig{SocketSettings: &internet.SocketConfig{DialerProxy: "ssh"}}}, true},
+	} {
+		if got := chained(senderDialer{sender: tc.sender}); got != tc.chained {
+			t.Errorf("chained(%v) = %v", tc.sender, got)
+		}
+	}
+
+	id := uuid.New()
+	out, err := New(context.Background(), &reflex.OutboundConfig{
+		Address:       "reflex.example.com",
+		Port:          443,
+		Id:            id.String(),
+		HappyEyeballs: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := out.(*Handler)
+	h.lookupIP = func(string) ([]net.IP, error) {
+		t.Error("chained outbound resolved the server itself")
+		return nil, errors.New("no lookup")
+	}
+	d := senderDialer{sender: &proxyman.SenderConfig{ProxySettings: &internet.ProxyConfig{Tag: "warp"}}, dialed: make(chan xnet.Destination, 1)}
+	if _, err := h.connect(context.Background(), d, h.client); err == nil {
+		t.Fatal("dial error not reported")
+	}
+	if dest := <-d.dialed; !dest.Address.Family().IsDomain() {
+		t.Fatalf("dialed %v, want the server's domain", dest)
+	}
+}
+
+func TestCheckStreamRejectsDoubleLayers(t *testing.T) {
+	ws := &internet.StreamConfig{ProtocolName: "websocket"}
+	tls := &internet.StreamConfig{SecurityType: "xray.transport.internet.tls.Config"}
+	for _, tc := range []struct {
+		config *reflex.OutboundConfig
+		stream *internet.StreamConfig
+		ok     bool
+	}{
+		{&reflex.OutboundConfig{WebsocketPath: "/ws"}, nil, true},
+		{&reflex.OutboundConfig{WebsocketPath: "/ws"}, tls, true},
+		{&reflex.OutboundConfig{WebsocketPath: "/ws"}, ws, false},
+		{&reflex.OutboundConfig{GrpcService: "svc"}, ws, false},
+		{&reflex.OutboundConfig{Fingerprint: "chrome"}, ws, true},
+		{&reflex.OutboundConfig{Fingerprint: "chrome"}, tls, false},
+		{&reflex.OutboundConfig{Quic: true}, tls, false},
+		{&reflex.OutboundConfig{}, ws, true},
+	} {
+		h := &Handler{config: tc.config}
+		err := h.checkStream(senderDialer{sender: &proxyman.SenderConfig{StreamSettings: tc.stream}})
+		if (err == nil) != tc.ok {
+			t.Errorf("%v over %v: got %v", tc.config, tc.stream, err)
+		}
+	}
+	if transport, security := streamLayers(senderDialer{sender: &proxyman.SenderConfig{StreamSettings: tls}}); transport != "" || security != "tls" {
+		t.Fatalf("layers read as %q, %q", transport, security)
+	}
+}
+
+// deafConn ignores deadlines, as connections chained through another
+// outbound may.
+type deafConn struct{ net.Conn }
+
+func (deafConn) SetDeadline(time.Time) error { return nil }
+
+// stallDialer connects to a server that reads the handshake and never
+// answers. closed is closed once the client closes the connection.
+type stallDialer struct {
+	senderDialer
+	closed chan struct{}
+}
+
+func (d stallDialer) Dial(context.Context, xnet.Destination) (stat.Connection, error) {
+	client, server := net.Pipe()
+	go func() {
+		io.Copy(io.Discard, server)
+		close(d.closed)
+	}()
+	return deafConn{client}, nil
+}
+
+func TestConnectHonorsContext(t *testing.T) {
+	id := uuid.New()
+	out, err := New(context.Background(), &reflex.OutboundConfig{
+		Address: "127.0.0.1",
+		Port:    443,
+		Id:      id.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := out.(*Handler)
+	canceled, cancel := context.WithCancel(context.Background())
+	time.AfterFunc(50*time.Millisecond, cancel)
+	expired, cancelExpired := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancelExpired()
+
+	for name, ctx := range map[string]context.Context{"canceled": canceled, "expired": expired} {
+		d := stallDialer{senderDialer{sender: &proxyman.SenderConfig{}}, make(chan struct{})}
+		start := time.Now()
+		_, err := h.connect(ctx, d, h.client)
+		if !errors.Is(err, ctx.Err()) {
+			t.Fatalf("%s: err = %v, want %v", name, err, ctx.Err())
+		}
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Fatalf("%s: handshake returned after %v", name, elapsed)
+		}
+		select {
+		case <-d.closed:
+		case <-time.After(time.Second):
+			t.Fatalf("%s: half-established connection left open", name)
+		}
+		if kind, _ := classify(err); name == "expired" && kind != failureTimeout {
+			t.Fatalf("expired handshake classified as %v", kind)
+		}
+	}
+}
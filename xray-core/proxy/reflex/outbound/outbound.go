@@ -1,20 +1,35 @@
-// Package outbound implements the Reflex outbound handler (stub).
+// Package outbound implements the Reflex outbound handler.
 package outbound
 
 import (
 	"context"
+	"crypto/ed25519"
+	gotls "crypto/tls"
+	goerrors "errors"
+	"net/http"
+	"net/http/cookiejar"
+	"slices"
 	"time"
 
 	"github.com/xtls/xray-core/common"
 	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/dice"
 	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/mux"
 	"github.com/xtls/xray-core/common/net"
 	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/signal"
 	"github.com/xtls/xray-core/common/task"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/core"
+	"github.com/xtls/xray-core/features/policy"
 	"github.com/xtls/xray-core/proxy"
 	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	"github.com/xtls/xray-core/transport"
 	"github.com/xtls/xray-core/transport/internet"
+	"github.com/xtls/xray-core/transport/internet/stat"
+	"github.com/xtls/xray-core/transport/internet/tls"
 )
 
 func init() {
@@ -23,9 +38,26 @@ func init() {
 	}))
 }
 
-// Handler is the Reflex outbound handler (stub).
+// firstPayloadTimeout is how long Process waits for the first request bytes
+// to send with the destination.
+const firstPayloadTimeout = 100 * time.Millisecond
+
+// Handler is the Reflex outbound handler.
 type Handler struct {
 	config *reflex.OutboundConfig
+	client *encoding.ClientConfig
+	host   string
+	header http.Header
+	pool   *sessionPool
+	// levelPolicy is the policy of the configured level.
+	levelPolicy policy.Session
+	// muxClient is client proposing the mux feature too, for sessions
+	// carrying Xray's mux, so mux settings work without listing it.
+	muxClient *encoding.ClientConfig
+	// puzzle is the handshake puzzle the server last demanded.
+	puzzle puzzleDemand
+
+	lookupIP func(domain string) ([]net.IP, error)
 }
 
 // Process implements proxy.Outbound.Process().
@@ -41,36 +73,354 @@ func (h *Handler) Process(ctx context.Context, link *transport.Link, d internet.
 	}
 
 	outbounds := session.OutboundsFromContext(ctx)
-	if len(outbounds) > 0 {
-		outbounds[len(outbounds)-1].Name = "reflex"
+	if len(outbounds) == 0 {
+		return errors.New("reflex outbound has no outbound session")
 	}
+	outbounds[len(outbounds)-1].Name = "reflex"
 
-	dest := net.TCPDestination(net.ParseAddress(h.config.GetAddress()), net.Port(h.config.GetPort()))
-	conn, err := d.Dial(ctx, dest)
-	if err != nil {
-		return errors.New("reflex outbound failed to dial destination").Base(err)
+	ob := outbounds[len(outbounds)-1]
+	if !ob.Target.IsValid() {
+		return errors.New("reflex outbound has no target")
+	}
+	if ob.Target.Network != net.Network_TCP {
+		return errors.New("reflex outbound only supports TCP, got ", ob.Target.Network)
+	}
+	if err := h.checkStream(d); err != nil {
+		return err
+	}
+	if h.pool != nil && ob.Target.Address != muxCoolAddress {
+		return h.pool.dispatch(ctx, link, &mux.DialingWorkerFactory{Proxy: h, Dialer: d, Strategy: h.pool.strategy})
 	}
-	defer conn.Close()
 
-	if err := conn.SetDeadline(time.Time{}); err != nil {
-		errors.LogInfoInner(ctx, err, "reflex outbound failed to clear deadline")
+	clientConfig := h.client
+	if ob.Target.Address == muxCoolAddress {
+		clientConfig = h.muxClient
+	}
+	client, err := retry(ctx, func() (*sessionConn, error) {
+		return h.connect(ctx, d, clientConfig)
+	})
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+	grant := client.Grant()
+	for _, f := range h.config.GetFeatures() {
+		if !grant.Has(f) {
+			errors.LogInfo(ctx, "reflex server declined feature ", f)
+		}
+	}
+	if ob.Target.Address == muxCoolAddress && !grant.Has(encoding.FeatureMux) {
+		return errors.New("reflex server declined mux; disable mux on this outbound or upgrade the server")
+	}
+	// Send the start of the request along with the destination, so sniffing
+	// on the server sees it before routing.
+	var first buf.MultiBuffer
+	if timeoutReader, ok := link.Reader.(buf.TimeoutReader); ok {
+		first, err = timeoutReader.ReadMultiBufferTimeout(firstPayloadTimeout)
+		if err != nil && err != buf.ErrReadTimeout {
+			return err
+		}
+	}
+	rest, err := client.WriteRequest(ob.Target, first)
+	if err != nil {
+		return errors.New("reflex outbound failed to send destination").Base(err)
 	}
 
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	timer := signal.CancelAfterInactivity(ctx, cancel, h.levelPolicy.Timeouts.ConnectionIdle)
 	requestDone := func() error {
-		return buf.Copy(link.Reader, buf.NewWriter(conn))
+		defer timer.SetTimeout(h.levelPolicy.Timeouts.DownlinkOnly)
+		return client.CopyFrom(&buf.BufferedReader{Reader: activityReader{link.Reader, timer}, Buffer: rest})
 	}
 	responseDone := func() error {
-		return buf.Copy(buf.NewReader(conn), link.Writer)
+		defer timer.SetTimeout(h.levelPolicy.Timeouts.UplinkOnly)
+		return client.CopyTo(activityWriter{link.Writer, timer})
 	}
 
 	if err := task.Run(ctx, requestDone, task.OnSuccess(responseDone, task.Close(link.Writer))); err != nil {
+		// The server reset the session for the destination's sake; the
+		// error unwraps to the socket error the application would have
+		// seen connecting directly.
+		var closeErr *encoding.CloseError
+		if goerrors.As(err, &closeErr) {
+			return errors.New("reflex server closed the connection").Base(closeErr).AtInfo()
+		}
 		return errors.New("reflex outbound connection ended").Base(err)
 	}
 	return nil
 }
 
+// activityReader and activityWriter keep timer running while payload
+// flows, so idle connections end after the level's timeouts.
+type activityReader struct {
+	buf.Reader
+	timer signal.ActivityUpdater
+}
+
+func (r activityReader) ReadMultiBuffer() (buf.MultiBuffer, error) {
+	mb, err := r.Reader.ReadMultiBuffer()
+	if !mb.IsEmpty() {
+		r.timer.Update()
+	}
+	return mb, err
+}
+
+type activityWriter struct {
+	buf.Writer
+	timer signal.ActivityUpdater
+}
+
+func (w activityWriter) WriteMultiBuffer(mb buf.MultiBuffer) error {
+	w.timer.Update()
+	return w.Writer.WriteMultiBuffer(mb)
+}
+
+// sessionConn is an established Reflex session and the layers it runs on,
+// which Close tears down innermost first.
+type sessionConn struct {
+	*encoding.ClientConn
+	closers []func() error
+}
+
+func (c *sessionConn) Close() error {
+	for i := len(c.closers) - 1; i >= 0; i-- {
+		c.closers[i]()
+	}
+	return nil
+}
+
+// checkStream rejects the outbound's own layers where streamSettings
+// already provides them, which would wrap the session twice: an envelope
+// over a transport other than raw TCP, uTLS over the stream's security, or
+// QUIC, whose UDP dial would bypass both.
+func (h *Handler) checkStream(d internet.Dialer) error {
+	transport, security := streamLayers(d)
+	switch {
+	case h.config.GetQuic() && (transport != "" || security != ""):
+		return errors.New("reflex outbound cannot run QUIC over the transport or security of streamSettings")
+	case transport != "" && (h.config.GetWebsocketPath() != "" || h.config.GetChunkedPath() != "" || h.config.GetGrpcService() != ""):
+		return errors.New("reflex outbound cannot run its own envelope over the ", transport, " transport of streamSettings")
+	case security != "" && h.config.GetFingerprint() != "":
+		return errors.New("reflex outbound cannot run uTLS over the ", security, " of streamSettings; set the fingerprint there instead")
+	}
+	return nil
+}
+
+// connect dials the server, wraps the connection in the configured TLS and
+// envelope, and runs the Reflex handshake as client within handshakeTimeout.
+// A failed or interrupted handshake closes everything established so far.
+func (h *Handler) connect(ctx context.Context, d internet.Dialer, client *encoding.ClientConfig) (_ *sessionConn, err error) {
+	dest := net.TCPDestination(net.ParseAddress(h.config.GetAddress()), h.serverPort())
+	if h.config.GetQuic() {
+		dest.Network = net.Network_UDP
+	}
+	var conn stat.Connection
+	if h.config.GetHappyEyeballs() && !chained(d) {
+		conn, err = raceDial(ctx, d, dest, h.lookupIP)
+	} else {
+		conn, err = d.Dial(ctx, dest)
+	}
+	if err != nil {
+		return nil, &dialError{err: err}
+	}
+	c := &sessionConn{closers: []func() error{conn.Close}}
+	defer func() {
+		if err != nil {
+			c.Close()
+		}
+	}()
+
+	// The handshake ends by handshakeTimeout or ctx's own deadline, and
+	// when ctx is canceled. Closing conn then unblocks every layer above
+	// it, including a chained conn that ignores deadlines. quic-go owns the
+	// packet conn, so QUIC bounds the handshake on its stream instead.
+	hsCtx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	deadline, _ := hsCtx.Deadline()
+	stop := context.AfterFunc(hsCtx, func() { conn.Close() })
+	defer func() {
+		if !stop() || err != nil && hsCtx.Err() != nil {
+			err = errors.New("reflex outbound handshake interrupted").Base(hsCtx.Err())
+		}
+	}()
+	if !h.config.GetQuic() {
+		if err := conn.SetDeadline(deadline); err != nil {
+			errors.LogInfoInner(ctx, err, "reflex outbound failed to set handshake deadline")
+		}
+	}
+
+	host := h.host
+	var stream net.Conn = conn
+	if fp := h.config.GetFingerprint(); fp != "" {
+		if stream, err = clientTLS(hsCtx, conn, &gotls.Config{ServerName: host}, fp, h.config.GetGrpcService() != ""); err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, stream.Close)
+	}
+	switch {
+	case h.config.GetWebsocketPath() != "":
+		if stream, err = encoding.DialWebSocket(hsCtx, stream, host, h.config.GetWebsocketPath(), h.header); err != nil {
+			return nil, err
+		}
+	case h.config.GetChunkedPath() != "":
+		stream = encoding.DialChunkedHTTP(stream, host, h.config.GetChunkedPath(), h.header)
+	case h.config.GetGrpcService() != "":
+		// The call lives as long as the session, so it cannot take hsCtx.
+		if stream, err = encoding.DialGRPC(ctx, stream, host, h.config.GetGrpcService(), h.config.GetGrpcMethod()); err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, stream.Close)
+	case h.config.GetQuic():
+		if stream, err = encoding.DialQUIC(hsCtx, stream, host, h.config.GetQuicAllowInsecure()); err != nil {
+			return nil, err
+		}
+		c.closers = append(c.closers, stream.Close)
+		if err := stream.SetDeadline(deadline); err != nil {
+			errors.LogInfoInner(ctx, err, "reflex outbound failed to set handshake deadline")
+		}
+	}
+
+	if c.ClientConn, err = encoding.NewClientConn(ctx, stream, h.puzzle.apply(client)); err != nil {
+		h.puzzle.observe(err)
+		return nil, errors.New("reflex outbound handshake failed").Base(err)
+	}
+	c.closers = append(c.closers, c.ClientConn.Close)
+	for _, layer := range []net.Conn{conn, stream} {
+		if err := layer.SetDeadline(time.Time{}); err != nil {
+			errors.LogInfoInner(ctx, err, "reflex outbound failed to clear deadline")
+		}
+	}
+	return c, nil
+}
+
+// serverPort is the port to dial: a random one of port_range if set, so
+// sessions spread over the range, otherwise port.
+func (h *Handler) serverPort() net.Port {
+	r := h.config.GetPortRange()
+	if r == nil {
+		return net.Port(h.config.GetPort())
+	}
+	return net.Port(r.From + uint32(dice.Roll(int(r.To-r.From+1))))
+}
+
+// clientTLS runs a TLS handshake over conn whose ClientHello mimics the
+// named fingerprint. gRPC needs h2; every other mode speaks HTTP/1.1.
+func clientTLS(ctx context.Context, conn net.Conn, config *gotls.Config, fingerprint string, h2 bool) (net.Conn, error) {
+	hello := tls.GetFingerprint(fingerprint)
+	if hello == nil {
+		return nil, errors.New("unknown reflex fingerprint ", fingerprint)
+	}
+	uconn := tls.UClient(conn, config, hello).(*tls.UConn)
+	var err error
+	if h2 {
+		err = uconn.HandshakeContext(ctx)
+	} else {
+		err = uconn.WebsocketHandshakeContext(ctx)
+	}
+	if err != nil {
+		return nil, errors.New("reflex tls handshake failed").Base(err)
+	}
+	return uconn, nil
+}
+
 // New creates a new Reflex outbound handler.
 func New(ctx context.Context, config *reflex.OutboundConfig) (proxy.Outbound, error) {
-	_ = ctx
-	return &Handler{config: config}, nil
+	h := &Handler{config: config, client: &encoding.ClientConfig{}, lookupIP: lookupServerIP, levelPolicy: policy.SessionDefault()}
+	if config == nil {
+		return h, nil
+	}
+	if v := core.FromContext(ctx); v != nil {
+		if m, ok := v.GetFeature(policy.ManagerType()).(policy.Manager); ok {
+			h.levelPolicy = m.ForLevel(config.GetLevel())
+		}
+	}
+	if min := config.GetMinProtocolVersion(); min != 0 {
+		if min > 255 || !encoding.SupportedProtocolVersion(uint8(min)) {
+			return nil, errors.New("unsupported reflex protocol version ", min)
+		}
+		h.client.MinVersion = uint8(min)
+	}
+	id, err := uuid.ParseString(config.GetId())
+	if err != nil {
+		return nil, errors.New("invalid reflex outbound id").Base(err)
+	}
+	copy(h.client.UserID[:], id.Bytes())
+	h.client.PuzzleDifficulty = config.GetPuzzleDifficulty()
+	h.client.Coalesce = config.GetCoalesceWrites()
+	h.client.MaxFrameSize = config.GetMaxFrameSize()
+	h.client.Binding = config.GetHandshakeBinding()
+	if key := config.GetServerIdentity(); len(key) > 0 {
+		if len(key) != ed25519.PublicKeySize {
+			return nil, errors.New("reflex server identity must be a ", ed25519.PublicKeySize, "-byte Ed25519 public key")
+		}
+		h.client.ServerIdentity = key
+	}
+	if psk := config.GetPsk(); len(psk) > 0 {
+		if len(psk) != encoding.PSKSize {
+			return nil, errors.New("reflex psk must be ", encoding.PSKSize, " bytes")
+		}
+		h.client.PSK = psk
+	}
+	h.client.Watermarks = encoding.Watermarks{
+		High: int(config.GetHighWatermark()),
+		Low:  int(config.GetLowWatermark()),
+	}
+	if f := config.GetFragment(); f != nil {
+		h.client.Fragment = &encoding.Fragment{
+			MinLength:   int(f.GetLengthMin()),
+			MaxLength:   int(f.GetLengthMax()),
+			MinInterval: time.Duration(f.GetIntervalMin()) * time.Millisecond,
+			MaxInterval: time.Duration(f.GetIntervalMax()) * time.Millisecond,
+		}
+	}
+	h.host = config.GetHost()
+	if h.host == "" {
+		h.host = config.GetAddress()
+	}
+	h.header = make(http.Header)
+	for k, v := range config.GetHttpHeaders() {
+		h.header.Set(k, v)
+	}
+	if path := config.GetHttpPath(); path != "" {
+		jar, err := cookiejar.New(nil)
+		if err != nil {
+			return nil, err
+		}
+		h.client.HTTP = &encoding.HTTPRequest{
+			Host:    h.host,
+			Path:    path,
+			Header:  config.GetHttpHeaders(),
+			Browser: config.GetHttpBrowser(),
+			Jar:     jar,
+			Upgrade: config.GetHttpUpgrade(),
+		}
+	}
+	if size := config.GetPoolSize(); size > 0 {
+		maxAge := config.GetPoolMaxAge()
+		if hop := config.GetHopInterval(); hop > 0 && (maxAge == 0 || hop < maxAge) {
+			maxAge = hop
+		}
+		h.pool = newSessionPool(size, maxAge, config.GetPoolConcurrency())
+	}
+	h.client.Policy = &encoding.PolicyRequest{
+		Uplink:   config.GetUplinkPolicy(),
+		Downlink: config.GetDownlinkPolicy(),
+		Features: config.GetFeatures(),
+		Padding:  config.GetPadding(),
+	}
+	if h.client.Policy.Uplink == "" {
+		h.client.Policy.Uplink = config.GetPolicy()
+	}
+	if h.client.Policy.Downlink == "" {
+		h.client.Policy.Downlink = config.GetPolicy()
+	}
+	h.muxClient = h.client
+	if !slices.Contains(h.client.Policy.Features, encoding.FeatureMux) {
+		muxClient, policy := *h.client, *h.client.Policy
+		policy.Features = append(slices.Clip(policy.Features), encoding.FeatureMux)
+		muxClient.Policy = &policy
+		h.muxClient = &muxClient
+	}
+	return h, nil
 }
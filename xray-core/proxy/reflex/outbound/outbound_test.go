@@ -2,9 +2,16 @@ package outbound
 
 import (
 	"context"
+	gotls "crypto/tls"
+	"crypto/x509"
+	"net"
+	"slices"
 	"strings"
 	"testing"
+	"time"
 
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/protocol/tls/cert"
 	"github.com/xtls/xray-core/common/session"
 	"github.com/xtls/xray-core/proxy/reflex"
 	"github.com/xtls/xray-core/transport"
@@ -30,3 +37,135 @@ func TestNewAndProcess(t *testing.T) {
 		t.Fatalf("unexpected process error: %v", err)
 	}
 }
+
+func TestNewAppliesUserPreferences(t *testing.T) {
+	hAny, err := New(context.Background(), &reflex.OutboundConfig{
+		Address:            "127.0.0.1",
+		Port:               443,
+		Id:                 "11111111-1111-1111-1111-111111111111",
+		Policy:             "zoom",
+		DownlinkPolicy:     "youtube",
+		MinProtocolVersion: 4,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hAny.(*Handler)
+	if p := h.client.Policy; p.Uplink != "zoom" || p.Downlink != "youtube" {
+		t.Fatalf("policy not applied per direction: %+v", p)
+	}
+	if h.client.MinVersion != 4 {
+		t.Fatalf("min version %d, want 4", h.client.MinVersion)
+	}
+	if _, err := New(context.Background(), &reflex.OutboundConfig{
+		Id:                 "11111111-1111-1111-1111-111111111111",
+		MinProtocolVersion: 9,
+	}); err == nil {
+		t.Fatal("unsupported protocol version accepted")
+	}
+	if _, err := New(context.Background(), &reflex.OutboundConfig{
+		Id:             "11111111-1111-1111-1111-111111111111",
+		ServerIdentity: make([]byte, 16),
+	}); err == nil {
+		t.Fatal("short server identity accepted")
+	}
+}
+
+func TestMuxSessionsProposeMux(t *testing.T) {
+	hAny, err := New(context.Background(), &reflex.OutboundConfig{
+		Address:  "127.0.0.1",
+		Port:     443,
+		Id:       "11111111-1111-1111-1111-111111111111",
+		Features: []string{"keepalive"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hAny.(*Handler)
+	if got := h.client.Policy.Features; !slices.Equal(got, []string{"keepalive"}) {
+		t.Fatalf("plain sessions propose %v", got)
+	}
+	if got := h.muxClient.Policy.Features; !slices.Equal(got, []string{"keepalive", "mux"}) {
+		t.Fatalf("mux sessions propose %v", got)
+	}
+	if h.muxClient.UserID != h.client.UserID {
+		t.Fatal("mux sessions lost the client settings")
+	}
+}
+
+func TestServerPortHopsWithinRange(t *testing.T) {
+	hAny, err := New(context.Background(), &reflex.OutboundConfig{
+		Address:     "127.0.0.1",
+		Id:          "11111111-1111-1111-1111-111111111111",
+		PortRange:   &xnet.PortRange{From: 20000, To: 20003},
+		PoolSize:    1,
+		PoolMaxAge:  600,
+		HopInterval: 30,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := hAny.(*Handler)
+	seen := make(map[xnet.Port]bool)
+	for i := 0; i < 200; i++ {
+		port := h.serverPort()
+		if port < 20000 || port > 20003 {
+			t.Fatalf("dialed port %d outside the range", port)
+		}
+		seen[port] = true
+	}
+	if len(seen) != 4 {
+		t.Fatalf("only hopped over %d ports", len(seen))
+	}
+	if h.pool.maxAge != 30*time.Second {
+		t.Fatalf("pooled sessions retire after %v, want the hop interval", h.pool.maxAge)
+	}
+}
+
+func TestClientTLSFingerprint(t *testing.T) {
+	serverCert := cert.MustGenerate(nil, cert.DNSNames("cdn.example.com"))
+	certPEM, keyPEM := serverCert.ToPEM()
+	pair, err := gotls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	roots := x509.NewCertPool()
+	roots.AppendCertsFromPEM(certPEM)
+
+	for _, h2 := range []bool{false, true} {
+		serverConn, clientConn := net.Pipe()
+		hellos := make(chan *gotls.ClientHelloInfo, 1)
+		server := gotls.Server(serverConn, &gotls.Config{
+			Certificates: []gotls.Certificate{pair},
+			NextProtos:   []string{"h2", "http/1.1"},
+			GetConfigForClient: func(hello *gotls.ClientHelloInfo) (*gotls.Config, error) {
+				hellos <- hello
+				return nil, nil
+			},
+		})
+		go server.Handshake()
+
+		conn, err := clientTLS(context.Background(), clientConn, &gotls.Config{ServerName: "cdn.example.com", RootCAs: roots}, "chrome", h2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		hello := <-hellos
+		want := []string{"http/1.1"}
+		if h2 {
+			want = []string{"h2", "http/1.1"}
+		}
+		if strings.Join(hello.SupportedProtos, ",") != strings.Join(want, ",") {
+			t.Errorf("h2=%v: offered ALPN %v", h2, hello.SupportedProtos)
+		}
+		// Go's own ClientHello never carries GREASE; Chrome's does.
+		if hello.CipherSuites[0]&0x0F0F != 0x0A0A {
+			t.Errorf("h2=%v: ClientHello does not look like Chrome: %x", h2, hello.CipherSuites)
+		}
+		conn.Close()
+		server.Close()
+	}
+
+	if _, err := clientTLS(context.Background(), nil, &gotls.Config{}, "netscape", false); err == nil {
+		t.Fatal("expected unknown fingerprint to be rejected")
+	}
+}
@@ -0,0 +1,146 @@
+package outbound
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common"
+	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/mux"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/transport"
+)
+
+// defaultPoolConcurrency is how many links share a pooled session unless
+// pool_concurrency says otherwise.
+const defaultPoolConcurrency = 8
+
+// muxCoolAddress is the target under which Xray's mux carries its
+// sub-connections; the server's dispatcher demultiplexes it.
+var muxCoolAddress = net.DomainAddress("v1.mux.cool")
+
+// sessionPool keeps authenticated Reflex sessions running Xray's mux, so a
+// new link attaches to one instead of paying for a dial and handshake.
+type sessionPool struct {
+	size     int
+	maxAge   time.Duration
+	strategy mux.ClientStrategy
+
+	mu      sync.Mutex
+	workers []*pooledWorker
+}
+
+type pooledWorker struct {
+	*mux.ClientWorker
+	created time.Time
+}
+
+func newSessionPool(size, maxAge, concurrency uint32) *sessionPool {
+	if concurrency == 0 {
+		concurrency = defaultPoolConcurrency
+	}
+	return &sessionPool{
+		size:     int(size),
+		maxAge:   time.Duration(maxAge) * time.Second,
+		strategy: mux.ClientStrategy{MaxConcurrency: concurrency},
+	}
+}
+
+// healthy reports whether w may take new links. Expired sessions leave the
+// pool but keep serving their links until mux closes them when idle.
+func (p *sessionPool) healthy(w *pooledWorker, now time.Time) bool {
+	return !w.Closed() && (p.maxAge == 0 || now.Sub(w.created) < p.maxAge)
+}
+
+// pick returns the least loaded session with room for another link, and
+// tops the pool up to its size. Sessions are dialed in the background, so
+// this never blocks on the network.
+func (p *sessionPool) pick(factory mux.ClientWorkerFactory) (*mux.ClientWorker, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	now := time.Now()
+	live := p.workers[:0]
+	var best *pooledWorker
+	for _, w := range p.workers {
+		if !p.healthy(w, now) {
+			continue
+		}
+		live = append(live, w)
+		if !w.IsFull() && (best == nil || w.ActiveConnections() < best.ActiveConnections()) {
+			best = w
+		}
+	}
+	clear(p.workers[len(live):])
+	p.workers = live
+
+	for best == nil || len(p.workers) < p.size {
+		w, err := factory.Create()
+		if err != nil {
+			if best != nil {
+				break
+			}
+			return nil, err
+		}
+		pw := &pooledWorker{ClientWorker: w, created: now}
+		p.workers = append(p.workers, pw)
+		go p.removeWhenClosed(pw)
+		if best == nil {
+			best = pw
+		}
+	}
+	return best.ClientWorker, nil
+}
+
+// removeWhenClosed drops a session from the pool once it ends, so a dead
+// connection is never handed out.
+func (p *sessionPool) removeWhenClosed(w *pooledWorker) {
+	<-w.WaitClosed()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, other := range p.workers {
+		if other == w {
+			p.workers = append(p.workers[:i], p.workers[i+1:]...)
+			return
+		}
+	}
+}
+
+// dispatch runs link over a pooled session and returns once mux is done
+// with it, as Process would for a dedicated connection.
+func (p *sessionPool) dispatch(ctx context.Context, link *transport.Link, factory mux.ClientWorkerFactory) error {
+	writer := &doneWriter{Writer: link.Writer, done: make(chan struct{})}
+	for {
+		w, err := p.pick(factory)
+		if err != nil {
+			return err
+		}
+		// A session may fill up between pick and Dispatch; try another.
+		if w.Dispatch(ctx, &transport.Link{Reader: link.Reader, Writer: writer}) {
+			break
+		}
+	}
+	select {
+	case <-writer.done:
+	case <-ctx.Done():
+	}
+	return nil
+}
+
+// doneWriter reports when mux closes a link's downlink.
+type doneWriter struct {
+	buf.Writer
+	once sync.Once
+	done chan struct{}
+}
+
+func (w *doneWriter) Close() error {
+	w.once.Do(func() { close(w.done) })
+	return common.Close(w.Writer)
+}
+
+func (w *doneWriter) Interrupt() {
+	w.once.Do(func() { close(w.done) })
+	common.Interrupt(w.Writer)
+}
@@ -0,0 +1,163 @@
+package outbound
+
+import (
+	"context"
+	"net"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/common/buf"
+	"github.com/xtls/xray-core/common/mux"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/features/routing"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	reflexin "github.com/xtls/xray-core/proxy/reflex/inbound"
+	"github.com/xtls/xray-core/transport"
+	"github.com/xtls/xray-core/transport/internet/stat"
+	"github.com/xtls/xray-core/transport/pipe"
+)
+
+// echoDispatcher loops every link back, and demultiplexes mux like the
+// dispatcher proxyman hands to inbounds.
+type echoDispatcher struct{}
+
+func (echoDispatcher) Type() interface{} { return (*routing.Dispatcher)(nil) }
+func (echoDispatcher) Start() error      { return nil }
+func (echoDispatcher) Close() error      { return nil }
+func (d echoDispatcher) Dispatch(ctx context.Context, dest xnet.Destination) (*transport.Link, error) {
+	if dest.Address == muxCoolAddress {
+		upReader, upWriter := pipe.New(pipe.WithoutSizeLimit())
+		downReader, downWriter := pipe.New(pipe.WithoutSizeLimit())
+		if _, err := mux.NewServerWorker(ctx, d, &transport.Link{Reader: upReader, Writer: downWriter}); err != nil {
+			return nil, err
+		}
+		return &transport.Link{Reader: downReader, Writer: upWriter}, nil
+	}
+	r, w := pipe.New(pipe.WithoutSizeLimit())
+	return &transport.Link{Reader: r, Writer: w}, nil
+}
+func (echoDispatcher) DispatchLink(context.Context, xnet.Destination, *transport.Link) error {
+	return nil
+}
+
+// pipeDialer connects every dial to a Reflex inbound over net.Pipe.
+type pipeDialer struct {
+	inbound *reflexin.Handler
+	dials   atomic.Int32
+}
+
+func (d *pipeDialer) Dial(ctx context.Context, _ xnet.Destination) (stat.Connection, error) {
+	d.dials.Add(1)
+	server, client := net.Pipe()
+	go d.inbound.Process(context.Background(), xnet.Network_TCP, server, echoDispatcher{})
+	return client, nil
+}
+
+func (*pipeDialer) DestIpAddress() net.IP { return nil }
+
+func (*pipeDialer) SetOutboundGateway(context.Context, *session.Outbound) {}
+
+func TestPooledLinksShareSession(t *testing.T) {
+	id := uuid.New()
+	in, err := reflexin.New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String(), Policy: "zoom"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New(context.Background(), &reflex.OutboundConfig{
+		Address:  "127.0.0.1",
+		Port:     443,
+		Id:       id.String(),
+		Features: []string{encoding.FeatureMux},
+		Padding:  encoding.PaddingNone,
+		PoolSize: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := &pipeDialer{inbound: in.(*reflexin.Handler)}
+
+	for _, msg := range []string{"first link", "second link"} {
+		upReader, upWriter := pipe.New(pipe.WithoutSizeLimit())
+		downReader, downWriter := pipe.New(pipe.WithoutSizeLimit())
+		ctx := session.ContextWithOutbounds(context.Background(), []*session.Outbound{{
+			Target: xnet.TCPDestination(xnet.DomainAddress("example.com"), 443),
+		}})
+		done := make(chan error, 1)
+		go func() {
+			done <- out.Process(ctx, &transport.Link{Reader: upReader, Writer: downWriter}, dialer)
+		}()
+
+		if err := upWriter.WriteMultiBuffer(buf.MultiBuffer{buf.FromBytes([]byte(msg))}); err != nil {
+			t.Fatal(err)
+		}
+		var echoed []byte
+		for len(echoed) < len(msg) {
+			mb, err := downReader.ReadMultiBufferTimeout(5 * time.Second)
+			if err != nil {
+				t.Fatalf("echo incomplete: %q: %v", echoed, err)
+			}
+			for _, b := range mb {
+				echoed = append(echoed, b.Bytes()...)
+			}
+			buf.ReleaseMulti(mb)
+		}
+		if string(echoed) != msg {
+			t.Fatalf("unexpected echo: %q", echoed)
+		}
+		upWriter.Close()
+		select {
+		case err := <-done:
+			if err != nil {
+				t.Fatal(err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("pooled link never finished")
+		}
+	}
+	if n := dialer.dials.Load(); n != 1 {
+		t.Fatalf("links dialed %d sessions, want 1", n)
+	}
+}
+
+func TestSessionPoolPrunesClosedAndExpired(t *testing.T) {
+	p := newSessionPool(2, 60, 0)
+	if p.strategy.MaxConcurrency != defaultPoolConcurrency {
+		t.Fatalf("unexpected default concurrency %d", p.strategy.MaxConcurrency)
+	}
+	created := 0
+	factory := factoryFunc(func() (*mux.ClientWorker, error) {
+		created++
+		r, _ := pipe.New()
+		_, w := pipe.New()
+		return mux.NewClientWorker(transport.Link{Reader: r, Writer: w}, p.strategy)
+	})
+
+	first, err := p.pick(factory)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if created != 2 {
+		t.Fatalf("pool warmed %d sessions, want 2", created)
+	}
+
+	first.Close()
+	p.mu.Lock()
+	p.workers[len(p.workers)-1].created = time.Now().Add(-time.Hour)
+	p.mu.Unlock()
+	if _, err := p.pick(factory); err != nil {
+		t.Fatal(err)
+	}
+	if created != 4 {
+		t.Fatalf("pool created %d sessions, want 4 after replacing a closed and an expired one", created)
+	}
+}
+
+type factoryFunc func() (*mux.ClientWorker, error)
+
+func (f factoryFunc) Create() (*mux.ClientWorker, error) { return f() }
@@ -0,0 +1,148 @@
+package outbound
+
+import (
+	"context"
+	goerrors "errors"
+	"sync"
+	"time"
+
+	"github.com/xtls/xray-core/common/dice"
+	"github.com/xtls/xray-core/common/errors"
+	"github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+)
+
+const (
+	// maxConnectAttempts bounds how often one link dials the server before
+	// giving up.
+	maxConnectAttempts = 3
+	retryBaseDelay     = 200 * time.Millisecond
+	retryMaxDelay      = 2 * time.Second
+	// handshakeTimeout bounds everything after the dial: TLS, the envelope
+	// and the Reflex handshake.
+	handshakeTimeout = 15 * time.Second
+	// puzzleMemory is how long handshakes keep solving a puzzle the server
+	// demanded, which it enforces for as long as it is under load.
+	puzzleMemory = time.Minute
+	// maxPuzzleDemand caps the difficulty a refusal can make handshakes
+	// solve. Refusals aren't authenticated, so anyone on the path could
+	// otherwise make the client grind for minutes.
+	maxPuzzleDemand = 24
+)
+
+// failure classifies why a connection attempt failed.
+type failure int
+
+const (
+	failureDial failure = iota
+	failureTimeout
+	failureRejected
+	failureHandshake
+)
+
+func (f failure) String() string {
+	switch f {
+	case failureDial:
+		return "dial"
+	case failureTimeout:
+		return "timeout"
+	case failureRejected:
+		return "rejected"
+	default:
+		return "handshake"
+	}
+}
+
+// dialError marks a failure to reach the server at all.
+type dialError struct{ err error }
+
+func (e *dialError) Error() string {
+	return "reflex outbound failed to dial destination: " + e.err.Error()
+}
+
+func (e *dialError) Unwrap() error { return e.err }
+
+// classify sorts err into a failure and reports whether another attempt
+// may succeed. Only a refusal of the credentials is final.
+func classify(err error) (failure, bool) {
+	var rejected *encoding.RejectedError
+	if goerrors.As(err, &rejected) {
+		return failureRejected, !rejected.Permanent()
+	}
+	var netErr net.Error
+	if goerrors.As(err, &netErr) && netErr.Timeout() {
+		return failureTimeout, true
+	}
+	var dialErr *dialError
+	if goerrors.As(err, &dialErr) {
+		return failureDial, true
+	}
+	return failureHandshake, true
+}
+
+// retryDelay is the full-jitter backoff before the attempt after attempt.
+func retryDelay(attempt int) time.Duration {
+	ceiling := retryBaseDelay << attempt
+	if ceiling > retryMaxDelay {
+		ceiling = retryMaxDelay
+	}
+	return time.Duration(dice.RollInt63n(int64(ceiling)))
+}
+
+// retry runs connect until it succeeds, fails permanently or runs out of
+// attempts. A permanent rejection comes back wrapping the server's
+// *encoding.RejectedError, so routing can tell it from a transient outage.
+func retry[T any](ctx context.Context, connect func() (T, error)) (T, error) {
+	for attempt := 0; ; attempt++ {
+		v, err := connect()
+		if err == nil {
+			return v, nil
+		}
+		kind, transient := classify(err)
+		if !transient {
+			return v, errors.New("reflex server rejected the credentials").Base(err)
+		}
+		if ctx.Err() != nil || attempt+1 >= maxConnectAttempts {
+			return v, errors.New("reflex outbound gave up after ", attempt+1, " attempts, last failure: ", kind).Base(err)
+		}
+		errors.LogInfoInner(ctx, err, "reflex outbound retrying after ", kind, " failure")
+		select {
+		case <-time.After(retryDelay(attempt)):
+		case <-ctx.Done():
+			return v, ctx.Err()
+		}
+	}
+}
+
+// puzzleDemand remembers the handshake puzzle difficulty the server last
+// answered with, so the retry and the handshakes after it solve it.
+type puzzleDemand struct {
+	mu         sync.Mutex
+	difficulty uint32
+	until      time.Time
+}
+
+// observe records the difficulty a rejection demands, if any.
+func (p *puzzleDemand) observe(err error) {
+	var rejected *encoding.RejectedError
+	if !goerrors.As(err, &rejected) || rejected.PuzzleDifficulty == 0 {
+		return
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.difficulty = min(rejected.PuzzleDifficulty, maxPuzzleDemand)
+	p.until = time.Now().Add(puzzleMemory)
+}
+
+// apply returns client, or a copy solving the demanded puzzle when that is
+// harder than the configured one.
+func (p *puzzleDemand) apply(client *encoding.ClientConfig) *encoding.ClientConfig {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.difficulty <= client.PuzzleDifficulty || time.Now().After(p.until) {
+		return client
+	}
+	demanded := *client
+	demanded.PuzzleDifficulty = p.difficulty
+	return &demanded
+}
@@ -0,0 +1,144 @@
+package outbound
+
+import (
+	"context"
+	goerrors "errors"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/xtls/xray-core/common/errors"
+	xnet "github.com/xtls/xray-core/common/net"
+	"github.com/xtls/xray-core/common/session"
+	"github.com/xtls/xray-core/common/uuid"
+	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
+	reflexin "github.com/xtls/xray-core/proxy/reflex/inbound"
+	"github.com/xtls/xray-core/transport"
+	"github.com/xtls/xray-core/transport/pipe"
+)
+
+func TestClassify(t *testing.T) {
+	cases := []struct {
+		err       error
+		kind      failure
+		transient bool
+	}{
+		{&dialError{err: goerrors.New("connection refused")}, failureDial, true},
+		{errors.New("reflex outbound handshake failed").Base(os.ErrDeadlineExceeded), failureTimeout, true},
+		{errors.New("reflex outbound handshake failed").Base(&encoding.RejectedError{StatusCode: http.StatusForbidden}), failureRejected, false},
+		{&encoding.RejectedError{StatusCode: http.StatusBadGateway}, failureRejected, true},
+		{&encoding.RejectedError{StatusCode: http.StatusTooManyRequests, PuzzleDifficulty: 12}, failureRejected, true},
+		{goerrors.New("unexpected EOF"), failureHandshake, true},
+	}
+	for _, tc := range cases {
+		kind, transient := classify(tc.err)
+		if kind != tc.kind || transient != tc.transient {
+			t.Errorf("classify(%v) = %v, %v, want %v, %v", tc.err, kind, transient, tc.kind, tc.transient)
+		}
+	}
+}
+
+func TestRetryDelayIsCapped(t *testing.T) {
+	for attempt := 0; attempt < 10; attempt++ {
+		if d := retryDelay(attempt); d < 0 || d >= retryMaxDelay {
+			t.Fatalf("retryDelay(%d) = %v", attempt, d)
+		}
+	}
+}
+
+func TestRetry(t *testing.T) {
+	attempts := 0
+	_, err := retry(context.Background(), func() (int, error) {
+		attempts++
+		return 0, &encoding.RejectedError{StatusCode: http.StatusServiceUnavailable}
+	})
+	if err == nil || attempts != maxConnectAttempts {
+		t.Fatalf("transient failure ran %d attempts, err %v", attempts, err)
+	}
+
+	attempts = 0
+	v, err := retry(context.Background(), func() (int, error) {
+		if attempts++; attempts < 2 {
+			return 0, &dialError{err: goerrors.New("connection reset")}
+		}
+		return 7, nil
+	})
+	if err != nil || v != 7 || attempts != 2 {
+		t.Fatalf("got %d after %d attempts, err %v", v, attempts, err)
+	}
+}
+
+func TestProcessFailsFastOnRejectedCredentials(t *testing.T) {
+	known, stranger := uuid.New(), uuid.New()
+	in, err := reflexin.New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: known.String(), Policy: "zoom"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New(context.Background(), &reflex.OutboundConfig{
+		Address: "127.0.0.1",
+		Port:    443,
+		Id:      stranger.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dialer := &pipeDialer{inbound: in.(*reflexin.Handler)}
+
+	upReader, _ := pipe.New(pipe.WithoutSizeLimit())
+	_, downWriter := pipe.New(pipe.WithoutSizeLimit())
+	ctx := session.ContextWithOutbounds(context.Background(), []*session.Outbound{{
+		Target: xnet.TCPDestination(xnet.DomainAddress("example.com"), 443),
+	}})
+	err = out.Process(ctx, &transport.Link{Reader: upReader, Writer: downWriter}, dialer)
+	var rejected *encoding.RejectedError
+	if !goerrors.As(err, &rejected) || !rejected.Permanent() {
+		t.Fatalf("expected a permanent rejection, got %v", err)
+	}
+	if n := dialer.dials.Load(); n != 1 {
+		t.Fatalf("rejected credentials were retried: %d dials", n)
+	}
+}
+
+func TestRetrySolvesTheDemandedPuzzle(t *testing.T) {
+	id := uuid.New()
+	in, err := reflexin.New(context.Background(), &reflex.InboundConfig{
+		Clients: []*reflex.User{{Id: id.String()}},
+		Puzzle:  &reflex.HandshakePuzzle{Difficulty: 12},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, err := New(context.Background(), &reflex.OutboundConfig{
+		Address: "127.0.0.1",
+		Port:    443,
+		Id:      id.String(),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := out.(*Handler)
+	dialer := &pipeDialer{inbound: in.(*reflexin.Handler)}
+
+	c, err := retry(context.Background(), func() (*sessionConn, error) {
+		return h.connect(context.Background(), dialer, h.client)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if n := dialer.dials.Load(); n != 2 {
+		t.Fatalf("connected after %d dials, want a retry solving the puzzle", n)
+	}
+	// Later handshakes solve it right away.
+	c, err = h.connect(context.Background(), dialer, h.client)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Close()
+	if h.client.PuzzleDifficulty != 0 {
+		t.Fatal("demanded puzzle changed the configuration")
+	}
+}
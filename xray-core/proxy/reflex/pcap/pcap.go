@@ -0,0 +1,252 @@
+// Package pcap extracts per-flow packet sizes and timings from classic
+// libpcap captures, for building Reflex traffic profiles.
+package pcap
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net/netip"
+	"sort"
+	"time"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+const (
+	magicMicro        = 0xa1b2c3d4
+	magicNano         = 0xa1b23c4d
+	linkTypeNull      = 0
+	linkTypeEthernet  = 1
+	linkTypeRaw       = 101
+	linkTypeLinuxSLL  = 113
+	linkTypeIPv4      = 228
+	linkTypeIPv6      = 229
+	maxSnapLen        = 256 * 1024
+	protoTCP          = 6
+	protoUDP          = 17
+	etherTypeIPv4     = 0x0800
+	etherTypeIPv6     = 0x86DD
+	etherTypeVLAN     = 0x8100
+	ipv6HeaderLen     = 40
+	udpHeaderLen      = 8
+	linuxSLLHeaderLen = 16
+)
+
+// Flow identifies one direction of a TCP or UDP conversation.
+type Flow struct {
+	Src   netip.AddrPort
+	Dst   netip.AddrPort
+	Proto uint8
+}
+
+func (f Flow) String() string {
+	name := "tcp"
+	if f.Proto == protoUDP {
+		name = "udp"
+	}
+	return fmt.Sprintf("%s %s>%s", name, f.Src, f.Dst)
+}
+
+// Packet is one transport packet with its application payload length.
+type Packet struct {
+	Time       time.Time
+	Flow       Flow
+	PayloadLen int
+}
+
+// ReadPackets parses a classic pcap stream, skipping frames that are not
+// TCP or UDP over IPv4/IPv6.
+func ReadPackets(r io.Reader) ([]Packet, error) {
+	var header [24]byte
+	if _, err := io.ReadFull(r, header[:]); err != nil {
+		return nil, errors.New("failed to read pcap header").Base(err)
+	}
+	var order binary.ByteOrder
+	var nano bool
+	switch {
+	case binary.LittleEndian.Uint32(header[:4]) == magicMicro:
+		order = binary.LittleEndian
+	case binary.BigEndian.Uint32(header[:4]) == magicMicro:
+		order = binary.BigEndian
+	case binary.LittleEndian.Uint32(header[:4]) == magicNano:
+		order, nano = binary.LittleEndian, true
+	case binary.BigEndian.Uint32(header[:4]) == magicNano:
+		order, nano = binary.BigEndian, true
+	default:
+		return nil, errors.New("not a pcap file (pcapng is not supported)")
+	}
+	linkType := order.Uint32(header[20:24]) & 0x0FFFFFFF
+
+	var packets []Packet
+	var record [16]byte
+	for {
+		if _, err := io.ReadFull(r, record[:]); err != nil {
+			if err == io.EOF {
+				return packets, nil
+			}
+			return nil, errors.New("truncated pcap record header").Base(err)
+		}
+		sec := int64(order.Uint32(record[0:4]))
+		frac := int64(order.Uint32(record[4:8]))
+		capLen := order.Uint32(record[8:12])
+		if capLen > maxSnapLen {
+			return nil, errors.New("pcap record too large: ", capLen)
+		}
+		data := make([]byte, capLen)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, errors.New("truncated pcap record").Base(err)
+		}
+		if !nano {
+			frac *= 1000
+		}
+		flow, payloadLen, ok := decodeFrame(linkType, data)
+		if !ok {
+			continue
+		}
+		packets = append(packets, Packet{Time: time.Unix(sec, frac), Flow: flow, PayloadLen: payloadLen})
+	}
+}
+
+func decodeFrame(linkType uint32, data []byte) (Flow, int, bool) {
+	switch linkType {
+	case linkTypeEthernet:
+		if len(data) < 14 {
+			return Flow{}, 0, false
+		}
+		etherType := binary.BigEndian.Uint16(data[12:14])
+		data = data[14:]
+		for etherType == etherTypeVLAN && len(data) >= 4 {
+			etherType = binary.BigEndian.Uint16(data[2:4])
+			data = data[4:]
+		}
+		if etherType != etherTypeIPv4 && etherType != etherTypeIPv6 {
+			return Flow{}, 0, false
+		}
+	case linkTypeLinuxSLL:
+		if len(data) < linuxSLLHeaderLen {
+			return Flow{}, 0, false
+		}
+		data = data[linuxSLLHeaderLen:]
+	case linkTypeNull:
+		if len(data) < 4 {
+			return Flow{}, 0, false
+		}
+		data = data[4:]
+	case linkTypeRaw, linkTypeIPv4, linkTypeIPv6:
+	default:
+		return Flow{}, 0, false
+	}
+	return decodeIP(data)
+}
+
+func decodeIP(data []byte) (Flow, int, bool) {
+	if len(data) < 1 {
+		return Flow{}, 0, false
+	}
+	var src, dst netip.Addr
+	var proto uint8
+	var payload []byte
+	var transportLen int
+	switch data[0] >> 4 {
+	case 4:
+		if len(data) < 20 {
+			return Flow{}, 0, false
+		}
+		ihl := int(data[0]&0x0F) * 4
+		total := int(binary.BigEndian.Uint16(data[2:4]))
+		if ihl < 20 || total < ihl || len(data) < ihl {
+			return Flow{}, 0, false
+		}
+		src = netip.AddrFrom4([4]byte(data[12:16]))
+		dst = netip.AddrFrom4([4]byte(data[16:20]))
+		proto = data[9]
+		payload = data[ihl:]
+		transportLen = total - ihl
+	case 6:
+		if len(data) < ipv6HeaderLen {
+			return Flow{}, 0, false
+		}
+		src = netip.AddrFrom16([16]byte(data[8:24]))
+		dst = netip.AddrFrom16([16]byte(data[24:40]))
+		proto = data[6]
+		payload = data[ipv6HeaderLen:]
+		transportLen = int(binary.BigEndian.Uint16(data[4:6]))
+	default:
+		return Flow{}, 0, false
+	}
+
+	var headerLen int
+	switch proto {
+	case protoTCP:
+		if len(payload) < 20 {
+			return Flow{}, 0, false
+		}
+		headerLen = int(payload[12]>>4) * 4
+	case protoUDP:
+		if len(payload) < udpHeaderLen {
+			return Flow{}, 0, false
+		}
+		headerLen = udpHeaderLen
+	default:
+		return Flow{}, 0, false
+	}
+	if transportLen < headerLen {
+		return Flow{}, 0, false
+	}
+	flow := Flow{
+		Src:   netip.AddrPortFrom(src, binary.BigEndian.Uint16(payload[0:2])),
+		Dst:   netip.AddrPortFrom(dst, binary.BigEndian.Uint16(payload[2:4])),
+		Proto: proto,
+	}
+	// Lengths come from the IP header so that snaplen truncation doesn't
+	// shrink the observed sizes.
+	return flow, transportLen - headerLen, true
+}
+
+// FlowStat summarizes the payload-carrying packets of one flow.
+type FlowStat struct {
+	Flow    Flow
+	Packets int
+	Bytes   int
+}
+
+// Flows returns per-flow statistics, busiest first.
+func Flows(packets []Packet) []FlowStat {
+	index := map[Flow]int{}
+	var stats []FlowStat
+	for _, p := range packets {
+		if p.PayloadLen == 0 {
+			continue
+		}
+		i, ok := index[p.Flow]
+		if !ok {
+			i = len(stats)
+			index[p.Flow] = i
+			stats = append(stats, FlowStat{Flow: p.Flow})
+		}
+		stats[i].Packets++
+		stats[i].Bytes += p.PayloadLen
+	}
+	sort.SliceStable(stats, func(i, j int) bool { return stats[i].Bytes > stats[j].Bytes })
+	return stats
+}
+
+// Observations returns payload sizes and inter-arrival delays of the
+// payload-carrying packets of flow, in capture order.
+func Observations(packets []Packet, flow Flow) ([]int, []time.Duration) {
+	var sizes []int
+	var delays []time.Duration
+	var last time.Time
+	for _, p := range packets {
+		if p.Flow != flow || p.PayloadLen == 0 {
+			continue
+		}
+		sizes = append(sizes, p.PayloadLen)
+		if !last.IsZero() {
+			delays = append(delays, p.Time.Sub(last))
+		}
+		last = p.Time
+	}
+	return sizes, delays
+}
@@ -0,0 +1,90 @@
+package pcap
+
+import (
+	"bytes"
+	"encoding/binary"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func ethernetTCP(src, dst [4]byte, sport, dport uint16, payload int) []byte {
+	frame := make([]byte, 14+20+20+payload)
+	binary.BigEndian.PutUint16(frame[12:14], etherTypeIPv4)
+	ip := frame[14:]
+	ip[0] = 0x45
+	binary.BigEndian.PutUint16(ip[2:4], uint16(20+20+payload))
+	ip[9] = protoTCP
+	copy(ip[12:16], src[:])
+	copy(ip[16:20], dst[:])
+	tcp := ip[20:]
+	binary.BigEndian.PutUint16(tcp[0:2], sport)
+	binary.BigEndian.PutUint16(tcp[2:4], dport)
+	tcp[12] = 5 << 4
+	return frame
+}
+
+func buildCapture(frames [][]byte, times []time.Time) []byte {
+	var out bytes.Buffer
+	header := make([]byte, 24)
+	binary.LittleEndian.PutUint32(header[0:4], magicMicro)
+	binary.LittleEndian.PutUint16(header[4:6], 2)
+	binary.LittleEndian.PutUint16(header[6:8], 4)
+	binary.LittleEndian.PutUint32(header[16:20], 65535)
+	binary.LittleEndian.PutUint32(header[20:24], linkTypeEthernet)
+	out.Write(header)
+	for i, f := range frames {
+		rec := make([]byte, 16)
+		binary.LittleEndian.PutUint32(rec[0:4], uint32(times[i].Unix()))
+		binary.LittleEndian.PutUint32(rec[4:8], uint32(times[i].Nanosecond()/1000))
+		binary.LittleEndian.PutUint32(rec[8:12], uint32(len(f)))
+		binary.LittleEndian.PutUint32(rec[12:16], uint32(len(f)))
+		out.Write(rec)
+		out.Write(f)
+	}
+	return out.Bytes()
+}
+
+func TestReadPacketsAndObservations(t *testing.T) {
+	server, client := [4]byte{10, 0, 0, 1}, [4]byte{10, 0, 0, 2}
+	base := time.Unix(1700000000, 0)
+	frames := [][]byte{
+		ethernetTCP(server, client, 443, 50000, 1400),
+		ethernetTCP(client, server, 50000, 443, 0),
+		ethernetTCP(server, client, 443, 50000, 1200),
+		ethernetTCP(server, client, 443, 50000, 600),
+		ethernetTCP(client, server, 50000, 443, 100),
+	}
+	times := []time.Time{base, base.Add(time.Millisecond), base.Add(10 * time.Millisecond), base.Add(30 * time.Millisecond), base.Add(31 * time.Millisecond)}
+
+	packets, err := ReadPackets(bytes.NewReader(buildCapture(frames, times)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(packets) != 5 {
+		t.Fatalf("expected 5 packets, got %d", len(packets))
+	}
+
+	flows := Flows(packets)
+	if len(flows) != 2 {
+		t.Fatalf("expected 2 payload flows, got %d", len(flows))
+	}
+	down := flows[0].Flow
+	if down.Src != netip.MustParseAddrPort("10.0.0.1:443") || flows[0].Bytes != 3200 {
+		t.Fatalf("unexpected busiest flow: %+v", flows[0])
+	}
+
+	sizes, delays := Observations(packets, down)
+	if len(sizes) != 3 || sizes[0] != 1400 || sizes[2] != 600 {
+		t.Fatalf("unexpected sizes: %v", sizes)
+	}
+	if len(delays) != 2 || delays[0] != 10*time.Millisecond || delays[1] != 20*time.Millisecond {
+		t.Fatalf("unexpected delays: %v", delays)
+	}
+}
+
+func TestReadPacketsRejectsGarbage(t *testing.T) {
+	if _, err := ReadPackets(bytes.NewReader(make([]byte, 24))); err == nil {
+		t.Fatal("expected error for unknown magic")
+	}
+}
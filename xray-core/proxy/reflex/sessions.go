@@ -0,0 +1,45 @@
+package reflex
+
+import (
+	"context"
+	"time"
+)
+
+// SessionInfo describes one live session for the Reflex API.
+type SessionInfo struct {
+	// ID is the session ID its log lines are tagged with.
+	ID      uint32
+	Email   string
+	Source  string
+	Started time.Time
+	// BytesSent and BytesReceived count the server's side on the wire.
+	BytesSent      int64
+	BytesReceived  int64
+	UplinkPolicy   string
+	DownlinkPolicy string
+	// SizeDistance is the KS distance of the session's recent DATA sizes
+	// from its downlink profile, or negative before there are any.
+	SizeDistance float64
+	// RTT is the smoothed heartbeat round trip, or 0 without heartbeats.
+	RTT time.Duration
+	// Replays counts frames dropped as replayed.
+	Replays int64
+	// PaddingOverhead is the share of BytesSent spent on padding frames.
+	PaddingOverhead float64
+	// AddedDelay is the average pacing delay per DATA frame sent.
+	AddedDelay time.Duration
+}
+
+// SessionController is implemented by inbounds that expose their live
+// sessions one by one.
+type SessionController interface {
+	// Sessions lists the live sessions of email, or all of them if email is
+	// empty.
+	Sessions(email string) []SessionInfo
+	// CloseSession ends the session with id and reports whether it was live.
+	CloseSession(id uint32) bool
+	// UpdateSession switches the profiles of the session with id, as
+	// PolicyUpdater does for a user's sessions, and reports whether it was
+	// live.
+	UpdateSession(ctx context.Context, id uint32, uplink, downlink string) (bool, error)
+}
@@ -0,0 +1,80 @@
+package reflex
+
+import (
+	"net"
+	"strings"
+
+	"github.com/xtls/xray-core/common/errors"
+)
+
+// sourceFilter restricts the addresses a user may connect from. A nil
+// *sourceFilter admits every source.
+type sourceFilter struct {
+	allow []*net.IPNet
+	deny  []*net.IPNet
+}
+
+// newSourceFilter parses the allow and deny lists of a user, each entry a
+// CIDR or a single address. It returns nil when both are empty.
+func newSourceFilter(allow, deny []string) (*sourceFilter, error) {
+	if len(allow) == 0 && len(deny) == 0 {
+		return nil, nil
+	}
+	f := &sourceFilter{}
+	var err error
+	if f.allow, err = parseSourceNets(allow); err != nil {
+		return nil, err
+	}
+	if f.deny, err = parseSourceNets(deny); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func parseSourceNets(entries []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(entries))
+	for _, entry := range entries {
+		if !strings.Contains(entry, "/") {
+			ip := net.ParseIP(entry)
+			if ip == nil {
+				return nil, errors.New("invalid reflex source address ", entry)
+			}
+			bits := 8 * net.IPv6len
+			if ip4 := ip.To4(); ip4 != nil {
+				ip, bits = ip4, 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(entry)
+		if err != nil {
+			return nil, errors.New("invalid reflex source range ", entry).Base(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+func containsIP(nets []*net.IPNet, ip net.IP) bool {
+	for _, n := range nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// admits reports whether a connection from ip passes f. An unknown source
+// only passes a filter without an allow list.
+func (f *sourceFilter) admits(ip net.IP) bool {
+	if f == nil {
+		return true
+	}
+	if ip == nil {
+		return len(f.allow) == 0
+	}
+	if containsIP(f.deny, ip) {
+		return false
+	}
+	return len(f.allow) == 0 || containsIP(f.allow, ip)
+}
@@ -0,0 +1,45 @@
+package reflex
+
+import (
+	"net"
+	"testing"
+)
+
+func TestSourceFilter(t *testing.T) {
+	if f, err := newSourceFilter(nil, nil); err != nil || f != nil || !f.admits(net.ParseIP("192.0.2.1")) {
+		t.Fatalf("empty lists should admit everything: %v, %v", f, err)
+	}
+	if _, err := newSourceFilter([]string{"192.0.2.0/33"}, nil); err == nil {
+		t.Fatal("invalid range accepted")
+	}
+	if _, err := newSourceFilter(nil, []string{"not-an-ip"}); err == nil {
+		t.Fatal("invalid address accepted")
+	}
+
+	f, err := newSourceFilter([]string{"192.0.2.0/24", "2001:db8::/32"}, []string{"192.0.2.66"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for ip, want := range map[string]bool{
+		"192.0.2.1":        true,
+		"2001:db8::1":      true,
+		"192.0.2.66":       false,
+		"198.51.100.1":     false,
+		"::ffff:192.0.2.1": true,
+	} {
+		if got := f.admits(net.ParseIP(ip)); got != want {
+			t.Errorf("admits(%s) = %v, want %v", ip, got, want)
+		}
+	}
+	if f.admits(nil) {
+		t.Error("unknown source passed an allow list")
+	}
+
+	denyOnly, err := newSourceFilter(nil, []string{"198.51.100.0/24"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !denyOnly.admits(nil) || !denyOnly.admits(net.ParseIP("192.0.2.1")) || denyOnly.admits(net.ParseIP("198.51.100.9")) {
+		t.Error("deny list misapplied")
+	}
+}
@@ -0,0 +1,23 @@
+package reflex
+
+import "time"
+
+// UserTraffic is the payload a user moved since Since.
+type UserTraffic struct {
+	Email string
+	// Uplink counts client-to-server bytes, Downlink server-to-client.
+	Uplink   int64
+	Downlink int64
+	Since    time.Time
+}
+
+// TrafficAccountant is implemented by inbounds that keep per-user traffic
+// totals across restarts.
+type TrafficAccountant interface {
+	// Traffic returns the totals of email, or of every user if email is
+	// empty.
+	Traffic(email string) []UserTraffic
+	// ResetTraffic restarts the totals of email, or of every user if email
+	// is empty, and returns them as they were before.
+	ResetTraffic(email string) []UserTraffic
+}
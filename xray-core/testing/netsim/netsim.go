@@ -0,0 +1,195 @@
+// Package netsim simulates degraded network links at the io.Reader/Writer
+// level, for testing protocols against latency, jitter and loss without a
+// real network.
+package netsim
+
+import (
+	"io"
+	"math/rand"
+	"net"
+	"sync"
+	"time"
+)
+
+// DefaultRTO is how long a lost write takes to be retransmitted when
+// Conditions.RTO is unset.
+const DefaultRTO = 200 * time.Millisecond
+
+// Conditions describe one direction of a link. Every write is delivered
+// Latency plus a uniform draw from [0, Jitter] after it was made; a lost
+// write arrives one RTO later, as after a retransmission.
+type Conditions struct {
+	Latency time.Duration
+	Jitter  time.Duration
+	// Loss is the probability that a write is lost.
+	Loss float64
+	RTO  time.Duration
+	// Reorder lets writes overtake each other as their delays allow, like
+	// datagrams. Otherwise delivery keeps write order, like a stream, and a
+	// late write holds back the ones behind it.
+	Reorder bool
+	// Seed makes the draws reproducible; 0 seeds from the clock.
+	Seed int64
+}
+
+// Link is one direction of a simulated connection: what is written to it
+// can be read from it once the conditions let it through. Writes never
+// block.
+type Link struct {
+	cond Conditions
+
+	rngMu sync.Mutex
+	rng   *rand.Rand
+	last  time.Time
+
+	mu      sync.Mutex
+	ready   *sync.Cond
+	buf     []byte
+	pending int
+	closed  bool
+	broken  bool
+	// In order, arrived holds writes that overtook an earlier one, by
+	// sequence number, until that one arrives.
+	sent    uint64
+	next    uint64
+	arrived map[uint64][]byte
+}
+
+// NewLink returns a link under c.
+func NewLink(c Conditions) *Link {
+	seed := c.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	if c.RTO == 0 {
+		c.RTO = DefaultRTO
+	}
+	l := &Link{cond: c, rng: rand.New(rand.NewSource(seed)), arrived: make(map[uint64][]byte)}
+	l.ready = sync.NewCond(&l.mu)
+	return l
+}
+
+// delay draws when a write made now is delivered.
+func (l *Link) delay(now time.Time) time.Duration {
+	l.rngMu.Lock()
+	defer l.rngMu.Unlock()
+	d := l.cond.Latency
+	if l.cond.Jitter > 0 {
+		d += time.Duration(l.rng.Int63n(int64(l.cond.Jitter) + 1))
+	}
+	if l.cond.Loss > 0 && l.rng.Float64() < l.cond.Loss {
+		d += l.cond.RTO
+	}
+	if !l.cond.Reorder {
+		if at := now.Add(d); at.Before(l.last) {
+			d = l.last.Sub(now)
+		}
+		l.last = now.Add(d)
+	}
+	return d
+}
+
+// Write implements io.Writer.
+func (l *Link) Write(p []byte) (int, error) {
+	l.mu.Lock()
+	if l.closed || l.broken {
+		l.mu.Unlock()
+		return 0, io.ErrClosedPipe
+	}
+	l.pending++
+	seq := l.sent
+	l.sent++
+	l.mu.Unlock()
+	data := append([]byte(nil), p...)
+	time.AfterFunc(l.delay(time.Now()), func() {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		l.pending--
+		if l.broken {
+			return
+		}
+		if l.cond.Reorder {
+			l.buf = append(l.buf, data...)
+		} else {
+			// Timers due at the same time fire in any order.
+			l.arrived[seq] = data
+			for d, ok := l.arrived[l.next]; ok; d, ok = l.arrived[l.next] {
+				l.buf = append(l.buf, d...)
+				delete(l.arrived, l.next)
+				l.next++
+			}
+		}
+		l.ready.Broadcast()
+	})
+	return len(p), nil
+}
+
+// Read implements io.Reader. It returns io.EOF once the link is closed and
+// everything written before has been read.
+func (l *Link) Read(p []byte) (int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for len(l.buf) == 0 {
+		if l.broken || (l.closed && l.pending == 0) {
+			return 0, io.EOF
+		}
+		l.ready.Wait()
+	}
+	n := copy(p, l.buf)
+	l.buf = l.buf[n:]
+	return n, nil
+}
+
+// Close ends the link for writers. Readers still get what is in flight.
+func (l *Link) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.closed = true
+	l.ready.Broadcast()
+	return nil
+}
+
+// abort drops everything in flight and fails reads and writes.
+func (l *Link) abort() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.broken = true
+	l.buf = nil
+	l.arrived = nil
+	l.ready.Broadcast()
+}
+
+// Pipe returns the two ends of a simulated connection. Data from a to b
+// travels under ab, data from b to a under ba. Deadlines are not
+// supported; closing an end unblocks its reads and sends EOF to the peer
+// after the data in flight.
+func Pipe(ab, ba Conditions) (a, b net.Conn) {
+	toB, toA := NewLink(ab), NewLink(ba)
+	return &conn{in: toA, out: toB, local: addr("a"), remote: addr("b")},
+		&conn{in: toB, out: toA, local: addr("b"), remote: addr("a")}
+}
+
+type conn struct {
+	in, out       *Link
+	local, remote net.Addr
+}
+
+func (c *conn) Read(p []byte) (int, error)  { return c.in.Read(p) }
+func (c *conn) Write(p []byte) (int, error) { return c.out.Write(p) }
+
+func (c *conn) Close() error {
+	c.out.Close()
+	c.in.abort()
+	return nil
+}
+
+func (c *conn) LocalAddr() net.Addr              { return c.local }
+func (c *conn) RemoteAddr() net.Addr             { return c.remote }
+func (c *conn) SetDeadline(time.Time) error      { return nil }
+func (c *conn) SetReadDeadline(time.Time) error  { return nil }
+func (c *conn) SetWriteDeadline(time.Time) error { return nil }
+
+type addr string
+
+func (a addr) Network() string { return "netsim" }
+func (a addr) String() string  { return string(a) }
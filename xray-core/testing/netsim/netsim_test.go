@@ -0,0 +1,64 @@
+package netsim_test
+
+import (
+	"io"
+	"testing"
+	"time"
+
+	"github.com/xtls/xray-core/testing/netsim"
+)
+
+func TestLinkKeepsStreamOrderUnderJitter(t *testing.T) {
+	l := netsim.NewLink(netsim.Conditions{Latency: 5 * time.Millisecond, Jitter: 20 * time.Millisecond, Loss: 0.2, RTO: 30 * time.Millisecond, Seed: 1})
+	start := time.Now()
+	var want []byte
+	for i := 0; i < 100; i++ {
+		want = append(want, byte(i))
+		l.Write([]byte{byte(i)})
+	}
+	l.Close()
+	got, err := io.ReadAll(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != string(want) {
+		t.Fatalf("stream delivered out of order: %v", got)
+	}
+	if elapsed := time.Since(start); elapsed < 5*time.Millisecond {
+		t.Fatalf("delivered after %v, before the latency", elapsed)
+	}
+}
+
+func TestLinkReorders(t *testing.T) {
+	l := netsim.NewLink(netsim.Conditions{Jitter: 50 * time.Millisecond, Reorder: true, Seed: 1})
+	for i := 0; i < 50; i++ {
+		l.Write([]byte{byte(i)})
+	}
+	l.Close()
+	got, err := io.ReadAll(l)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 50 {
+		t.Fatalf("delivered %d of 50 writes", len(got))
+	}
+	for i, b := range got {
+		if int(b) != i {
+			return
+		}
+	}
+	t.Fatal("writes never overtook each other")
+}
+
+func TestPipeCloseUnblocksReads(t *testing.T) {
+	a, b := netsim.Pipe(netsim.Conditions{Latency: 10 * time.Millisecond}, netsim.Conditions{})
+	a.Write([]byte("bye"))
+	a.Close()
+	if _, err := a.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("read on a closed end: %v", err)
+	}
+	got, err := io.ReadAll(b)
+	if err != nil || string(got) != "bye" {
+		t.Fatalf("peer read %q, %v", got, err)
+	}
+}
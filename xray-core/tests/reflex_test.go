@@ -15,6 +15,7 @@ import (
 	"github.com/xtls/xray-core/common/uuid"
 	"github.com/xtls/xray-core/features/routing"
 	"github.com/xtls/xray-core/proxy/reflex"
+	"github.com/xtls/xray-core/proxy/reflex/encoding"
 	reflexin "github.com/xtls/xray-core/proxy/reflex/inbound"
 	"github.com/xtls/xray-core/transport"
 )
@@ -60,7 +61,7 @@ func buildHandshakeBinary(t *testing.T, userID [16]byte) []byte {
 	copy(nonce[:], []byte("nonce-1234567890"))
 
 	raw := make([]byte, 4+74)
-	binary.BigEndian.PutUint32(raw[0:4], reflexin.ReflexMagic)
+	binary.BigEndian.PutUint32(raw[0:4], encoding.ReflexMagic)
 	copy(raw[4:36], pub[:])
 	copy(raw[36:52], userID[:])
 	binary.BigEndian.PutUint64(raw[52:60], uint64(time.Now().Unix()))
@@ -114,18 +115,18 @@ func TestReflexEncryptionRoundTrip(t *testing.T) {
 	for i := range key {
 		key[i] = byte(i + 1)
 	}
-	writer, err := reflexin.NewSession(key)
+	writer, err := encoding.NewSession(key)
 	if err != nil {
 		t.Fatal(err)
 	}
-	reader, err := reflexin.NewSession(key)
+	reader, err := encoding.NewSession(key)
 	if err != nil {
 		t.Fatal(err)
 	}
 
 	payload := []byte("test data")
 	var wire bytes.Buffer
-	if err := writer.WriteFrame(&wire, reflexin.FrameTypeData, payload); err != nil {
+	if err := writer.WriteFrame(&wire, encoding.FrameTypeData, payload); err != nil {
 		t.Fatal(err)
 	}
 	frame, err := reader.ReadFrame(&wire)